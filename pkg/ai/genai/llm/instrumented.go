@@ -4,7 +4,7 @@ import (
 	"context"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
-	"go.opentelemetry.io/otel"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
@@ -20,7 +20,7 @@ type InstrumentedClient struct {
 func NewInstrumentedClient(next Client) *InstrumentedClient {
 	return &InstrumentedClient{
 		next:   next,
-		tracer: otel.Tracer("pkg/ai/genai/llm"),
+		tracer: instrument.NewTracer("pkg/ai/genai/llm"),
 	}
 }
 
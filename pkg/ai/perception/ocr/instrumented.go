@@ -4,7 +4,7 @@ import (
 	"context"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
-	"go.opentelemetry.io/otel"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
@@ -20,7 +20,7 @@ type InstrumentedOCRClient struct {
 func NewInstrumentedOCRClient(next OCRClient) *InstrumentedOCRClient {
 	return &InstrumentedOCRClient{
 		next:   next,
-		tracer: otel.Tracer("pkg/ai/perception/ocr"),
+		tracer: instrument.NewTracer("pkg/ai/perception/ocr"),
 	}
 }
 
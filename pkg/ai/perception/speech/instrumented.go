@@ -4,7 +4,7 @@ import (
 	"context"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
-	"go.opentelemetry.io/otel"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
@@ -20,7 +20,7 @@ type InstrumentedSpeechClient struct {
 func NewInstrumentedSpeechClient(next SpeechClient) *InstrumentedSpeechClient {
 	return &InstrumentedSpeechClient{
 		next:   next,
-		tracer: otel.Tracer("pkg/ai/perception/speech"),
+		tracer: instrument.NewTracer("pkg/ai/perception/speech"),
 	}
 }
 
@@ -1,4 +1,16 @@
 /*
 Package paxos implements the Paxos consensus algorithm.
+
+Proposer and Acceptor run single-decree Paxos to agree on one value.
+
+MultiProposer and Replica extend this to Multi-Paxos, agreeing on a sequence
+of values indexed by slot. A MultiProposer acts as a distinguished leader: it
+runs phase 1 once for all slots, recovers values accepted under earlier
+ballots, fills holes with Noop, and then runs only phase 2 for each new slot
+until another proposer preempts it. Decisions are pushed to every Replica's
+Learner, and lagging learners are caught up on later proposals or Sync.
+
+Replica has the same ReceivePrepare and ReceiveAccept signatures as Acceptor,
+so both run over the same Transport.
 */
 package paxos
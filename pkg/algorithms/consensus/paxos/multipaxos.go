@@ -0,0 +1,296 @@
+package paxos
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+var (
+	// ErrNoQuorum is returned when a majority of replicas could not be reached.
+	ErrNoQuorum = errors.New("paxos: majority not reached")
+
+	// ErrPreempted is returned when a replica has promised a higher ballot,
+	// meaning another proposer has taken over leadership.
+	ErrPreempted = errors.New("paxos: preempted by higher ballot")
+)
+
+// ballotStride separates the round counter from the proposer ID inside a
+// ballot number, so ballots from different proposers never collide.
+const ballotStride = 1 << 16
+
+// Noop is decided in log slots that a new leader finds empty below the highest
+// accepted slot. Learners skip it when building the log.
+type Noop struct{}
+
+// AcceptRequest is the phase 2 payload of Multi-Paxos, sent as the value of
+// Transport.Accept.
+type AcceptRequest struct {
+	Slot  int
+	Value interface{}
+}
+
+// Decision tells a replica's learner that Value was chosen for Slot. It is
+// sent as the value of Transport.Accept and carries no ballot semantics.
+type Decision struct {
+	Slot  int
+	Value interface{}
+}
+
+// AcceptedSlot is a value an acceptor accepted for a slot, with its ballot.
+type AcceptedSlot struct {
+	Slot   int
+	Ballot int
+	Value  interface{}
+}
+
+// Promise is the value returned by Replica.ReceivePrepare. A single prepare
+// covers every slot, so it reports all accepted values.
+type Promise struct {
+	Accepted []AcceptedSlot
+	// FirstUndecided is the first slot the replica's learner has not learned.
+	FirstUndecided int
+}
+
+// Replica is the acceptor and learner for one member of a Multi-Paxos group.
+// ReceivePrepare and ReceiveAccept have the same signatures as Acceptor's,
+// so any Transport that reaches Acceptors can reach Replicas.
+type Replica struct {
+	promised int
+	accepted map[int]AcceptedSlot
+	learner  *Learner
+	mu       sync.Mutex
+}
+
+// NewReplica creates a Replica with an empty log.
+func NewReplica() *Replica {
+	return &Replica{
+		promised: -1,
+		accepted: make(map[int]AcceptedSlot),
+		learner:  NewLearner(),
+	}
+}
+
+// Learner returns the replica's learner.
+func (r *Replica) Learner() *Learner {
+	return r.learner
+}
+
+// ReceivePrepare promises ballot for every slot. On success the third result is
+// a *Promise; on rejection the second result is the ballot already promised.
+func (r *Replica) ReceivePrepare(ballot int) (bool, int, interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if ballot <= r.promised {
+		return false, r.promised, nil
+	}
+	r.promised = ballot
+
+	promise := &Promise{FirstUndecided: r.learner.FirstUndecided()}
+	highest := -1
+	for _, a := range r.accepted {
+		promise.Accepted = append(promise.Accepted, a)
+		if a.Ballot > highest {
+			highest = a.Ballot
+		}
+	}
+	sort.Slice(promise.Accepted, func(i, j int) bool {
+		return promise.Accepted[i].Slot < promise.Accepted[j].Slot
+	})
+	return true, highest, promise
+}
+
+// ReceiveAccept handles an *AcceptRequest (phase 2) or a *Decision.
+func (r *Replica) ReceiveAccept(ballot int, value interface{}) bool {
+	switch msg := value.(type) {
+	case *Decision:
+		r.learner.Learn(msg.Slot, msg.Value)
+		return true
+	case *AcceptRequest:
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if ballot < r.promised {
+			return false
+		}
+		r.promised = ballot
+		r.accepted[msg.Slot] = AcceptedSlot{Slot: msg.Slot, Ballot: ballot, Value: msg.Value}
+		return true
+	}
+	return false
+}
+
+// MultiProposer is the distinguished leader of a Multi-Paxos group. After one
+// successful phase 1 it assigns consecutive slots and runs only phase 2 for
+// each value, until a higher ballot preempts it.
+type MultiProposer struct {
+	id        int
+	numPeers  int
+	transport Transport
+
+	round    int
+	ballot   int
+	prepared bool
+	nextSlot int
+
+	decided map[int]interface{}
+	// learned[peer] is the first slot the peer's learner may be missing.
+	learned map[int]int
+
+	mu sync.Mutex
+}
+
+// NewMultiProposer creates a leader candidate. id must be unique among
+// proposers and smaller than 65536; peers are addressed as 0..numPeers-1.
+func NewMultiProposer(id int, numPeers int, transport Transport) *MultiProposer {
+	return &MultiProposer{
+		id:        id,
+		numPeers:  numPeers,
+		transport: transport,
+		decided:   make(map[int]interface{}),
+		learned:   make(map[int]int),
+	}
+}
+
+// Ballot returns the ballot the proposer is currently using.
+func (p *MultiProposer) Ballot() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.ballot
+}
+
+// Propose chooses value for the next free slot and returns the slot. The first
+// call, and the first call after being preempted, runs phase 1 and recovers
+// values accepted under earlier ballots before placing value.
+func (p *MultiProposer) Propose(value interface{}) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.prepared {
+		if err := p.prepare(); err != nil {
+			return 0, err
+		}
+	}
+
+	slot := p.nextSlot
+	if err := p.accept(slot, value); err != nil {
+		return 0, err
+	}
+	p.nextSlot++
+	p.decide(slot, value)
+	return slot, nil
+}
+
+// Sync re-sends decisions to replicas whose learners are behind, for example
+// after a partition heals.
+func (p *MultiProposer) Sync() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.broadcastDecisions()
+}
+
+// prepare runs phase 1 across all slots, then re-proposes recovered values and
+// fills gaps with Noop so the log has no holes. Caller must hold p.mu.
+func (p *MultiProposer) prepare() error {
+	p.round++
+	p.ballot = p.round*ballotStride + p.id
+
+	promises := 0
+	preempted := false
+	recovered := make(map[int]AcceptedSlot)
+	for i := 0; i < p.numPeers; i++ {
+		promised, b, v := p.transport.Prepare(i, p.ballot)
+		if !promised {
+			// Skip past the competing ballot on the next attempt.
+			if b > p.ballot {
+				preempted = true
+				p.round = b / ballotStride
+			}
+			continue
+		}
+		promises++
+
+		promise, ok := v.(*Promise)
+		if !ok {
+			continue
+		}
+		p.learned[i] = promise.FirstUndecided
+		for _, a := range promise.Accepted {
+			if cur, seen := recovered[a.Slot]; !seen || a.Ballot > cur.Ballot {
+				recovered[a.Slot] = a
+			}
+		}
+	}
+
+	if promises <= p.numPeers/2 {
+		if preempted {
+			return ErrPreempted
+		}
+		return ErrNoQuorum
+	}
+	p.prepared = true
+
+	maxSlot := p.nextSlot - 1
+	for slot := range recovered {
+		if slot > maxSlot {
+			maxSlot = slot
+		}
+	}
+	for slot := 0; slot <= maxSlot; slot++ {
+		if _, done := p.decided[slot]; done {
+			continue
+		}
+		var value interface{} = Noop{}
+		if a, ok := recovered[slot]; ok {
+			value = a.Value
+		}
+		if err := p.accept(slot, value); err != nil {
+			return err
+		}
+		p.decide(slot, value)
+	}
+	p.nextSlot = maxSlot + 1
+	return nil
+}
+
+// accept runs phase 2 for one slot. Caller must hold p.mu.
+func (p *MultiProposer) accept(slot int, value interface{}) error {
+	req := &AcceptRequest{Slot: slot, Value: value}
+	accepts := 0
+	for i := 0; i < p.numPeers; i++ {
+		if p.transport.Accept(i, p.ballot, req) {
+			accepts++
+		}
+	}
+	if accepts <= p.numPeers/2 {
+		// Replicas are unreachable or have promised a higher ballot; either
+		// way leadership must be re-established with a fresh phase 1.
+		p.prepared = false
+		return ErrNoQuorum
+	}
+	return nil
+}
+
+// decide records a chosen value and notifies learners. Caller must hold p.mu.
+func (p *MultiProposer) decide(slot int, value interface{}) {
+	p.decided[slot] = value
+	p.broadcastDecisions()
+}
+
+// broadcastDecisions sends every decision a replica has not yet acknowledged,
+// in slot order, so lagging learners catch up. Caller must hold p.mu.
+func (p *MultiProposer) broadcastDecisions() {
+	for i := 0; i < p.numPeers; i++ {
+		for slot := p.learned[i]; ; slot++ {
+			value, ok := p.decided[slot]
+			if !ok {
+				break
+			}
+			if !p.transport.Accept(i, p.ballot, &Decision{Slot: slot, Value: value}) {
+				break
+			}
+			p.learned[i] = slot + 1
+		}
+	}
+}
@@ -28,9 +28,11 @@ type Acceptor struct {
 	mu             sync.Mutex
 }
 
-// Learner learns the agreed value.
+// Learner learns the agreed values, one per log slot.
 type Learner struct {
-	// Reserved for future implementation that tracks quorum
+	decided map[int]interface{}
+	next    int // first slot not yet learned
+	mu      sync.Mutex
 }
 
 // Transport abstracts network.
@@ -47,6 +49,10 @@ func NewProposer(id int, numPeers int, transport Transport) *Proposer {
 	}
 }
 
+func NewLearner() *Learner {
+	return &Learner{decided: make(map[int]interface{})}
+}
+
 func NewAcceptor() *Acceptor {
 	return &Acceptor{
 		lastPromisedID: -1,
@@ -128,3 +134,52 @@ func (a *Acceptor) ReceiveAccept(proposalID int, value interface{}) bool {
 	}
 	return false
 }
+
+// Learn records that value was chosen for slot.
+func (l *Learner) Learn(slot int, value interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.decided[slot]; ok {
+		return
+	}
+	l.decided[slot] = value
+	for {
+		if _, ok := l.decided[l.next]; !ok {
+			break
+		}
+		l.next++
+	}
+}
+
+// Decided returns the value chosen for slot, if learned.
+func (l *Learner) Decided(slot int) (interface{}, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	v, ok := l.decided[slot]
+	return v, ok
+}
+
+// FirstUndecided returns the first slot that has not been learned. All slots
+// below it are known.
+func (l *Learner) FirstUndecided() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.next
+}
+
+// Log returns the values of the contiguous learned prefix, skipping Noops.
+func (l *Learner) Log() []interface{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	values := make([]interface{}, 0, l.next)
+	for i := 0; i < l.next; i++ {
+		if _, noop := l.decided[i].(Noop); noop {
+			continue
+		}
+		values = append(values, l.decided[i])
+	}
+	return values
+}
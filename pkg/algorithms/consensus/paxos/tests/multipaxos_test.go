@@ -0,0 +1,176 @@
+package paxos_test
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/algorithms/consensus/paxos"
+)
+
+type ReplicaTransport struct {
+	replicas map[int]*paxos.Replica
+	down     map[int]bool
+	prepares int
+	mu       sync.Mutex
+}
+
+func newReplicaTransport(n int) *ReplicaTransport {
+	t := &ReplicaTransport{
+		replicas: make(map[int]*paxos.Replica),
+		down:     make(map[int]bool),
+	}
+	for i := 0; i < n; i++ {
+		t.replicas[i] = paxos.NewReplica()
+	}
+	return t
+}
+
+func (t *ReplicaTransport) Prepare(peerID int, proposalID int) (bool, int, interface{}) {
+	t.mu.Lock()
+	t.prepares++
+	down := t.down[peerID]
+	t.mu.Unlock()
+	if down {
+		return false, -1, nil
+	}
+	return t.replicas[peerID].ReceivePrepare(proposalID)
+}
+
+func (t *ReplicaTransport) Accept(peerID int, proposalID int, value interface{}) bool {
+	t.mu.Lock()
+	down := t.down[peerID]
+	t.mu.Unlock()
+	if down {
+		return false
+	}
+	return t.replicas[peerID].ReceiveAccept(proposalID, value)
+}
+
+func (t *ReplicaTransport) setDown(peerID int, down bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.down[peerID] = down
+}
+
+func (t *ReplicaTransport) prepareCount() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.prepares
+}
+
+func TestMultiPaxosReplicatesLog(t *testing.T) {
+	transport := newReplicaTransport(3)
+	leader := paxos.NewMultiProposer(1, 3, transport)
+
+	values := []interface{}{"a", "b", "c", "d"}
+	for i, v := range values {
+		slot, err := leader.Propose(v)
+		if err != nil {
+			t.Fatalf("Propose(%v): %v", v, err)
+		}
+		if slot != i {
+			t.Errorf("Propose(%v) got slot %d, want %d", v, slot, i)
+		}
+	}
+
+	for id, r := range transport.replicas {
+		if got := r.Learner().Log(); !reflect.DeepEqual(got, values) {
+			t.Errorf("replica %d log = %v, want %v", id, got, values)
+		}
+	}
+}
+
+func TestMultiPaxosStableLeaderSkipsPrepare(t *testing.T) {
+	transport := newReplicaTransport(3)
+	leader := paxos.NewMultiProposer(1, 3, transport)
+
+	if _, err := leader.Propose("first"); err != nil {
+		t.Fatal(err)
+	}
+	after := transport.prepareCount()
+	for i := 0; i < 5; i++ {
+		if _, err := leader.Propose(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := transport.prepareCount(); got != after {
+		t.Errorf("stable leader sent %d extra prepares", got-after)
+	}
+}
+
+func TestMultiPaxosNewLeaderFillsGaps(t *testing.T) {
+	transport := newReplicaTransport(3)
+	old := paxos.NewMultiProposer(1, 3, transport)
+	if _, err := old.Propose("a"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The old leader pipelined slot 2 to a majority and crashed before slot 1
+	// reached anyone and before announcing the decision.
+	ballot := old.Ballot()
+	for _, id := range []int{0, 1} {
+		transport.replicas[id].ReceiveAccept(ballot, &paxos.AcceptRequest{Slot: 2, Value: "c"})
+	}
+
+	leader := paxos.NewMultiProposer(2, 3, transport)
+	slot, err := leader.Propose("d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slot != 3 {
+		t.Errorf("new value placed at slot %d, want 3", slot)
+	}
+
+	for id, r := range transport.replicas {
+		if v, _ := r.Learner().Decided(1); v != (paxos.Noop{}) {
+			t.Errorf("replica %d slot 1 = %v, want Noop", id, v)
+		}
+		want := []interface{}{"a", "c", "d"}
+		if got := r.Learner().Log(); !reflect.DeepEqual(got, want) {
+			t.Errorf("replica %d log = %v, want %v", id, got, want)
+		}
+	}
+
+	// The old leader has been preempted and must not overwrite decided slots.
+	if _, err := old.Propose("x"); err == nil {
+		t.Error("preempted leader proposed successfully")
+	}
+	if v, _ := transport.replicas[0].Learner().Decided(3); v != "d" {
+		t.Errorf("slot 3 changed to %v", v)
+	}
+}
+
+func TestMultiPaxosLearnerCatchUp(t *testing.T) {
+	transport := newReplicaTransport(3)
+	leader := paxos.NewMultiProposer(1, 3, transport)
+
+	transport.setDown(2, true)
+	for _, v := range []string{"a", "b", "c"} {
+		if _, err := leader.Propose(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := transport.replicas[2].Learner().FirstUndecided(); got != 0 {
+		t.Fatalf("down replica learned %d slots", got)
+	}
+
+	transport.setDown(2, false)
+	leader.Sync()
+
+	want := []interface{}{"a", "b", "c"}
+	if got := transport.replicas[2].Learner().Log(); !reflect.DeepEqual(got, want) {
+		t.Errorf("caught-up log = %v, want %v", got, want)
+	}
+}
+
+func TestMultiPaxosNoQuorum(t *testing.T) {
+	transport := newReplicaTransport(3)
+	leader := paxos.NewMultiProposer(1, 3, transport)
+
+	transport.setDown(0, true)
+	transport.setDown(1, true)
+	if _, err := leader.Propose("a"); err != paxos.ErrNoQuorum {
+		t.Errorf("expected ErrNoQuorum, got %v", err)
+	}
+}
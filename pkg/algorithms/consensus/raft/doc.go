@@ -1,4 +1,34 @@
 /*
 Package raft implements the Raft consensus algorithm.
+
+A Node runs leader election, log replication and commit tracking. Committed
+commands are delivered in order on the apply channel, and Propose blocks until
+the proposed command is committed by a majority.
+
+Term, vote and log are persisted through a Store (MemoryStore or FileStore) so
+that a node can restart without violating safety. Nodes talk through a
+Transport; MemoryTransport connects nodes in one process and can inject
+partitions and message loss for tests.
+
+Applications keep the log bounded by calling Snapshot with a serialized image
+of their state. Followers that fall behind the compacted log receive it through
+InstallSnapshot and see it on the apply channel as an ApplyMsg with
+SnapshotValid set.
+
+AddPeer and RemovePeer change the cluster membership one server at a time
+while the cluster keeps serving requests. New servers are started with
+Config.Join and receive the log from the leader once added.
+
+Usage:
+
+	transport := raft.NewMemoryTransport()
+	applyCh := make(chan raft.ApplyMsg, 64)
+
+	node := raft.New("a", []string{"b", "c"}, transport, applyCh)
+	transport.Register("a", node)
+	node.Start()
+	defer node.Stop()
+
+	index, err := node.Propose(ctx, []byte("set x=1"))
 */
 package raft
@@ -0,0 +1,134 @@
+package raft
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+)
+
+// ErrConfigChangeInProgress is returned when a membership change is requested
+// while a previous one is still uncommitted.
+var ErrConfigChangeInProgress = errors.New("raft: membership change already in progress")
+
+// Membership changes use the single-server algorithm from the Raft
+// dissertation: each change adds or removes exactly one member, takes effect
+// as soon as it is appended to a log, and a leader allows only one
+// uncommitted change at a time. Any two consecutive configurations then share
+// a majority, so no joint consensus phase is needed.
+
+// Members returns the current cluster configuration, including this node if it is a member.
+func (n *Node) Members() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]string(nil), n.members...)
+}
+
+// AddPeer adds id to the cluster and blocks until the change is committed.
+// The new node should be started with Config.Join so that it waits for the
+// leader instead of campaigning on its own.
+func (n *Node) AddPeer(ctx context.Context, id string) error {
+	return n.changeMembership(ctx, id, true)
+}
+
+// RemovePeer removes id from the cluster and blocks until the change is
+// committed. Removing the leader makes it step down once the change commits.
+func (n *Node) RemovePeer(ctx context.Context, id string) error {
+	return n.changeMembership(ctx, id, false)
+}
+
+func (n *Node) changeMembership(ctx context.Context, id string, add bool) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.stopped {
+		return ErrStopped
+	}
+	if n.state != Leader {
+		return ErrNotLeader
+	}
+	if n.configIndex > n.commitIndex {
+		return ErrConfigChangeInProgress
+	}
+	if n.isMember(id) == add {
+		return nil
+	}
+
+	var members []string
+	for _, m := range n.members {
+		if m != id {
+			members = append(members, m)
+		}
+	}
+	if add {
+		members = append(members, id)
+		n.nextIndex[id] = n.lastIndex() + 1
+		n.matchIndex[id] = 0
+	}
+	sort.Strings(members)
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return err
+	}
+	index, err := n.appendLocal(EntryConfig, data)
+	if err != nil {
+		return err
+	}
+	return n.waitCommitted(ctx, index, n.currentTerm)
+}
+
+// refreshMembers recomputes the active configuration from the log after it
+// changes; a truncated config entry reverts to the previous one. Caller must
+// hold n.mu.
+func (n *Node) refreshMembers() {
+	n.configIndex, n.members = n.configAt(n.lastIndex())
+}
+
+// membersAt returns the configuration in effect at index. Caller must hold n.mu.
+func (n *Node) membersAt(index int) []string {
+	_, members := n.configAt(index)
+	return members
+}
+
+func (n *Node) configAt(index int) (int, []string) {
+	base := n.log[0].Index
+	for i := index; i > base; i-- {
+		e := n.log[i-base]
+		if e.Type != EntryConfig {
+			continue
+		}
+		var members []string
+		if err := json.Unmarshal(e.Command, &members); err == nil {
+			return i, members
+		}
+	}
+	if n.snapshot != nil {
+		return n.snapshot.Index, append([]string(nil), n.snapshot.Members...)
+	}
+	if n.config.Join {
+		return 0, nil
+	}
+	members := append([]string{n.config.ID}, n.config.Peers...)
+	sort.Strings(members)
+	return 0, members
+}
+
+func (n *Node) isMember(id string) bool {
+	for _, m := range n.members {
+		if m == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *Node) otherMembers() []string {
+	peers := make([]string, 0, len(n.members))
+	for _, m := range n.members {
+		if m != n.id {
+			peers = append(peers, m)
+		}
+	}
+	return peers
+}
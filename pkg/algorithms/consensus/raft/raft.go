@@ -1,11 +1,26 @@
 package raft
 
 import (
+	"context"
+	"errors"
+	"hash/fnv"
 	"math/rand"
 	"sync"
 	"time"
 )
 
+var (
+	// ErrNotLeader is returned by Propose when the node is not the current leader.
+	ErrNotLeader = errors.New("raft: not leader")
+
+	// ErrLeadershipLost is returned by Propose when the node lost leadership before
+	// the entry was committed. The entry may still be committed by a later leader.
+	ErrLeadershipLost = errors.New("raft: leadership lost before commit")
+
+	// ErrStopped is returned when the node has been stopped.
+	ErrStopped = errors.New("raft: node stopped")
+)
+
 // State represents the Raft node state.
 type State int
 
@@ -15,138 +30,322 @@ const (
 	Leader
 )
 
+func (s State) String() string {
+	switch s {
+	case Follower:
+		return "follower"
+	case Candidate:
+		return "candidate"
+	case Leader:
+		return "leader"
+	}
+	return "unknown"
+}
+
+// EntryType distinguishes client commands from entries used internally by Raft.
+type EntryType int
+
+const (
+	// EntryCommand carries a client command and is delivered on the apply channel.
+	EntryCommand EntryType = iota
+	// EntryNoop is appended by a new leader to commit entries from previous terms.
+	EntryNoop
+	// EntryConfig carries a JSON-encoded cluster membership list.
+	EntryConfig
+)
+
 // LogEntry is a single log entry.
 type LogEntry struct {
+	Index   int
 	Term    int
-	Command interface{}
+	Type    EntryType
+	Command []byte
+}
+
+// ApplyMsg is sent on the apply channel for every committed command, in log order.
+type ApplyMsg struct {
+	Index   int
+	Term    int
+	Command []byte
+
+	// SnapshotValid is set when the state machine must replace its state with
+	// Snapshot, which covers every entry up to and including Index.
+	SnapshotValid bool
+	Snapshot      []byte
+}
+
+// Config holds configuration for a Raft node.
+type Config struct {
+	ID    string
+	Peers []string // IDs of the other members of the initial cluster
+
+	// Join starts the node without a configuration. It stays passive until a
+	// leader adds it with AddPeer and replicates the cluster configuration.
+	Join bool
+
+	// ElectionTimeout is the minimum election timeout; the actual timeout is
+	// randomized between ElectionTimeout and 2*ElectionTimeout.
+	ElectionTimeout   time.Duration
+	HeartbeatInterval time.Duration
+	MaxAppendEntries  int // Maximum entries sent in a single AppendEntries RPC
+
+	// Store persists term, vote and log. Defaults to a MemoryStore.
+	Store Store
 }
 
 // Node represents a Raft node.
 type Node struct {
-	id          string
-	peers       []string
+	id     string
+	config Config
+
+	// members is the latest configuration in the log (including uncommitted
+	// entries, as required for single-server changes), and configIndex the
+	// index of the entry it came from.
+	members     []string
+	configIndex int
+
 	state       State
 	currentTerm int
 	votedFor    string
-	log         []LogEntry
+	leaderID    string
+
+	// log[0] is a sentinel holding the index and term of the entry that
+	// precedes the first real entry, so index arithmetic never underflows.
+	log []LogEntry
 
 	commitIndex int
+	lastApplied int
+
+	snapshot        *Snapshot
+	pendingSnapshot *Snapshot // received from the leader, not yet delivered on applyCh
 
 	// Leader state
 	nextIndex  map[string]int
 	matchIndex map[string]int
 
-	mu sync.Mutex
+	lastContact     time.Time
+	lastHeartbeat   time.Time
+	electionTimeout time.Duration
+
+	mu        sync.Mutex
+	applyCond *sync.Cond
+	notifyCh  chan struct{} // closed and replaced whenever commit index or role changes
+	rng       *rand.Rand
 
-	// Mock transport
 	transport Transport
+	store     Store
 
 	// Channels
 	stopCh  chan struct{}
-	applyCh chan interface{}
+	applyCh chan<- ApplyMsg
+	wg      sync.WaitGroup
+	stopped bool
 }
 
-// Transport abstracts RPCs.
-type Transport interface {
-	RequestVote(peer string, term int, candidateID string, lastLogIndex int, lastLogTerm int) (int, bool)
-	AppendEntries(peer string, term int, leaderID string, prevLogIndex int, prevLogTerm int, entries []LogEntry, leaderCommit int) (int, bool)
+// New creates a Raft node with default timeouts and an in-memory store.
+func New(id string, peers []string, transport Transport, applyCh chan<- ApplyMsg) *Node {
+	// A MemoryStore never fails to load, so the error can be ignored.
+	n, _ := NewWithConfig(Config{ID: id, Peers: peers}, transport, applyCh)
+	return n
 }
 
-func New(id string, peers []string, transport Transport, applyCh chan interface{}) *Node {
-	return &Node{
-		id:         id,
-		peers:      peers,
-		state:      Follower,
-		log:        make([]LogEntry, 0), // Log is 1-indexed usually, but 0 here for simplicity
-		transport:  transport,
-		stopCh:     make(chan struct{}),
-		applyCh:    applyCh,
-		nextIndex:  make(map[string]int),
-		matchIndex: make(map[string]int),
+// NewWithConfig creates a Raft node, restoring term, vote and log from config.Store.
+func NewWithConfig(config Config, transport Transport, applyCh chan<- ApplyMsg) (*Node, error) {
+	if config.ElectionTimeout == 0 {
+		config.ElectionTimeout = 150 * time.Millisecond
+	}
+	if config.HeartbeatInterval == 0 {
+		config.HeartbeatInterval = 50 * time.Millisecond
 	}
+	if config.MaxAppendEntries == 0 {
+		config.MaxAppendEntries = 64
+	}
+	if config.Store == nil {
+		config.Store = NewMemoryStore()
+	}
+
+	st, err := config.Store.Load()
+	if err != nil {
+		return nil, err
+	}
+	snap, err := config.Store.LoadSnapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(config.ID))
+
+	n := &Node{
+		id:          config.ID,
+		config:      config,
+		snapshot:    snap,
+		state:       Follower,
+		currentTerm: st.Term,
+		votedFor:    st.VotedFor,
+		log:         st.Log,
+		transport:   transport,
+		store:       config.Store,
+		stopCh:      make(chan struct{}),
+		applyCh:     applyCh,
+		nextIndex:   make(map[string]int),
+		matchIndex:  make(map[string]int),
+		notifyCh:    make(chan struct{}),
+		rng:         rand.New(rand.NewSource(time.Now().UnixNano() ^ int64(h.Sum64()))),
+	}
+	if len(n.log) == 0 {
+		n.log = []LogEntry{{Index: 0, Term: 0}}
+	}
+	if snap != nil {
+		// The snapshot is saved before the log is trimmed, so a crash in
+		// between leaves entries the snapshot already covers.
+		if snap.Index > n.log[0].Index {
+			n.log = n.compactedLog(snap.Index, snap.Term)
+		}
+		n.pendingSnapshot = snap
+	}
+	n.commitIndex = n.log[0].Index
+	n.lastApplied = n.log[0].Index
+	n.refreshMembers()
+	n.applyCond = sync.NewCond(&n.mu)
+	n.resetElectionTimer()
+
+	return n, nil
 }
 
+// Start launches the background election, replication and apply loops.
 func (n *Node) Start() {
+	n.wg.Add(2)
 	go n.run()
+	go n.applier()
 }
 
-func (n *Node) run() {
-	for {
-		switch n.state {
-		case Follower:
-			n.runFollower()
-		case Candidate:
-			n.runCandidate()
-		case Leader:
-			n.runLeader()
-		}
+// Stop halts the node. Pending Propose calls return ErrStopped.
+func (n *Node) Stop() {
+	n.mu.Lock()
+	if n.stopped {
+		n.mu.Unlock()
+		return
 	}
+	n.stopped = true
+	close(n.stopCh)
+	n.applyCond.Broadcast()
+	n.notify()
+	n.mu.Unlock()
+
+	n.wg.Wait()
 }
 
-func (n *Node) runFollower() {
-	timeout := randomTimeout()
-	timer := time.NewTimer(timeout)
+// ID returns the node ID.
+func (n *Node) ID() string {
+	return n.id
+}
 
-	// In real impl, we listen for RPCs here.
-	// Since this is just the statemachine logic, we simulate waiting.
-	// RPC handlers would reset this timer.
+// State returns the current role and term.
+func (n *Node) State() (State, int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.state, n.currentTerm
+}
 
-	select {
-	case <-timer.C:
-		n.mu.Lock()
-		n.state = Candidate
-		n.mu.Unlock()
-	case <-n.stopCh:
-		return
-	}
+// Leader returns the ID of the last known leader, or "" if unknown.
+func (n *Node) Leader() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.leaderID
 }
 
-func (n *Node) runCandidate() {
+// CommitIndex returns the highest log index known to be committed.
+func (n *Node) CommitIndex() int {
 	n.mu.Lock()
-	n.currentTerm++
-	n.votedFor = n.id
-	term := n.currentTerm
-	// log info
-	lastLogIndex := len(n.log) - 1
-	lastLogTerm := 0
-	if lastLogIndex >= 0 {
-		lastLogTerm = n.log[lastLogIndex].Term
+	defer n.mu.Unlock()
+	return n.commitIndex
+}
+
+// Propose appends cmd to the leader's log and blocks until it is committed.
+// It returns the log index of the committed entry.
+func (n *Node) Propose(ctx context.Context, cmd []byte) (int, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.stopped {
+		return 0, ErrStopped
+	}
+	if n.state != Leader {
+		return 0, ErrNotLeader
 	}
-	n.mu.Unlock()
 
-	// Request Votes
-	votes := 1
-	for _, peer := range n.peers {
-		go func(p string) {
-			t, granted := n.transport.RequestVote(p, term, n.id, lastLogIndex, lastLogTerm)
-			if granted {
-				n.mu.Lock()
-				votes++
-				if n.state == Candidate && votes > (len(n.peers)+1)/2 {
-					n.state = Leader
-					// Init leader state
-					for _, p := range n.peers {
-						n.nextIndex[p] = len(n.log)
-						n.matchIndex[p] = -1
-					}
-				}
-				n.mu.Unlock()
-			} else if t > term {
-				n.mu.Lock()
-				n.state = Follower
-				n.currentTerm = t
-				n.votedFor = ""
-				n.mu.Unlock()
+	index, err := n.appendLocal(EntryCommand, cmd)
+	if err != nil {
+		return 0, err
+	}
+	if err := n.waitCommitted(ctx, index, n.currentTerm); err != nil {
+		return 0, err
+	}
+	return index, nil
+}
+
+// waitCommitted blocks until the entry at index from term is committed. Caller
+// must hold n.mu; it is released while waiting.
+func (n *Node) waitCommitted(ctx context.Context, index, term int) error {
+	for {
+		if n.stopped {
+			return ErrStopped
+		}
+		if n.commitIndex >= index {
+			// An index already folded into a snapshot was committed by definition.
+			if t, ok := n.termAt(index); ok && t != term {
+				return ErrLeadershipLost
 			}
-		}(peer)
+			return nil
+		}
+		if n.state != Leader || n.currentTerm != term {
+			return ErrLeadershipLost
+		}
+
+		ch := n.notifyCh
+		n.mu.Unlock()
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			n.mu.Lock()
+			return ctx.Err()
+		}
+		n.mu.Lock()
+	}
+}
+
+// appendLocal appends a new entry in the current term to the leader's log,
+// persists it and kicks off replication. Caller must hold n.mu.
+func (n *Node) appendLocal(typ EntryType, cmd []byte) (int, error) {
+	entry := LogEntry{
+		Index:   n.lastIndex() + 1,
+		Term:    n.currentTerm,
+		Type:    typ,
+		Command: cmd,
+	}
+	log := append(n.log[:len(n.log):len(n.log)], entry)
+	if err := n.save(n.currentTerm, n.votedFor, log); err != nil {
+		return 0, err
+	}
+	n.log = log
+	if typ == EntryConfig {
+		n.refreshMembers()
 	}
 
-	timeout := randomTimeout()
-	time.Sleep(timeout) // Wait for votes or timeout
+	n.advanceCommitIndex()
+	n.broadcastAppendEntries()
+	return entry.Index, nil
 }
 
-func (n *Node) runLeader() {
-	ticker := time.NewTicker(50 * time.Millisecond) // Heartbeat interval
+func (n *Node) run() {
+	defer n.wg.Done()
+
+	tick := n.config.HeartbeatInterval / 2
+	if tick <= 0 {
+		tick = time.Millisecond
+	}
+	ticker := time.NewTicker(tick)
 	defer ticker.Stop()
 
 	for {
@@ -155,38 +354,351 @@ func (n *Node) runLeader() {
 			return
 		case <-ticker.C:
 			n.mu.Lock()
-			if n.state != Leader {
-				n.mu.Unlock()
-				return
+			switch n.state {
+			case Leader:
+				if time.Since(n.lastHeartbeat) >= n.config.HeartbeatInterval {
+					n.broadcastAppendEntries()
+				}
+			default:
+				// Nodes outside the configuration (joining or removed) never campaign.
+				if n.isMember(n.id) && time.Since(n.lastContact) >= n.electionTimeout {
+					n.startElection()
+				}
 			}
 			n.mu.Unlock()
-			n.sendHeartbeats()
 		}
 	}
 }
 
-func (n *Node) sendHeartbeats() {
-	n.mu.Lock()
+// startElection transitions to candidate and requests votes. Caller must hold n.mu.
+func (n *Node) startElection() {
+	n.resetElectionTimer()
+	if err := n.save(n.currentTerm+1, n.id, n.log); err != nil {
+		// Without a durable vote we must not campaign; retry on the next timeout.
+		return
+	}
+	n.state = Candidate
+	n.currentTerm++
+	n.votedFor = n.id
+	n.leaderID = ""
+	n.notify()
+
 	term := n.currentTerm
-	leaderID := n.id
-	commit := n.commitIndex
-	n.mu.Unlock()
+	args := &RequestVoteArgs{
+		Term:         term,
+		CandidateID:  n.id,
+		LastLogIndex: n.lastIndex(),
+		LastLogTerm:  n.lastTerm(),
+	}
 
-	for _, peer := range n.peers {
-		// Mock empty append entries
+	votes := 1
+	if votes >= n.quorumSize() {
+		n.becomeLeader()
+		return
+	}
+
+	for _, peer := range n.otherMembers() {
 		go func(p string) {
-			t, _ := n.transport.AppendEntries(p, term, leaderID, 0, 0, nil, commit)
-			if t > term {
-				n.mu.Lock()
-				n.state = Follower
-				n.currentTerm = t
-				n.votedFor = ""
-				n.mu.Unlock()
+			ctx, cancel := context.WithTimeout(context.Background(), n.config.ElectionTimeout)
+			defer cancel()
+
+			reply, err := n.transport.RequestVote(ctx, p, args)
+			if err != nil {
+				return
+			}
+
+			n.mu.Lock()
+			defer n.mu.Unlock()
+
+			if reply.Term > n.currentTerm {
+				_ = n.becomeFollower(reply.Term)
+				return
+			}
+			if n.state != Candidate || n.currentTerm != term || !reply.VoteGranted {
+				return
+			}
+			votes++
+			if votes >= n.quorumSize() {
+				n.becomeLeader()
 			}
 		}(peer)
 	}
 }
 
-func randomTimeout() time.Duration {
-	return time.Duration(150+rand.Intn(150)) * time.Millisecond
+// becomeLeader initializes leader state. Caller must hold n.mu.
+func (n *Node) becomeLeader() {
+	n.state = Leader
+	n.leaderID = n.id
+	for _, p := range n.otherMembers() {
+		n.nextIndex[p] = n.lastIndex() + 1
+		n.matchIndex[p] = 0
+	}
+	n.notify()
+
+	// Committing a no-op in the new term lets entries from earlier terms commit
+	// without waiting for the next client proposal.
+	if _, err := n.appendLocal(EntryNoop, nil); err != nil {
+		_ = n.becomeFollower(n.currentTerm)
+	}
+}
+
+// becomeFollower steps down, adopting term if it is newer. The new term is
+// persisted before it is adopted; if that fails the node still steps down,
+// which is always safe, but keeps its term and vote and returns the error so
+// that RPC handlers reject the request. Caller must hold n.mu.
+func (n *Node) becomeFollower(term int) error {
+	var err error
+	if term > n.currentTerm {
+		if err = n.save(term, "", n.log); err == nil {
+			n.currentTerm = term
+			n.votedFor = ""
+			n.leaderID = ""
+		}
+	}
+	if n.state != Follower {
+		n.state = Follower
+		n.resetElectionTimer()
+	}
+	n.notify()
+	return err
+}
+
+// broadcastAppendEntries replicates to every peer. Caller must hold n.mu.
+func (n *Node) broadcastAppendEntries() {
+	n.lastHeartbeat = time.Now()
+	term := n.currentTerm
+	for _, peer := range n.otherMembers() {
+		go n.replicateTo(peer, term)
+	}
+}
+
+func (n *Node) replicateTo(peer string, term int) {
+	n.mu.Lock()
+	if n.state != Leader || n.currentTerm != term || n.stopped || !n.isMember(peer) {
+		n.mu.Unlock()
+		return
+	}
+
+	next := n.nextIndex[peer]
+	if next <= n.log[0].Index {
+		// The entries the peer needs were compacted away.
+		n.mu.Unlock()
+		n.sendSnapshot(peer, term)
+		return
+	}
+	prevIndex := next - 1
+	prevTerm, _ := n.termAt(prevIndex)
+
+	end := n.lastIndex()
+	if end-next+1 > n.config.MaxAppendEntries {
+		end = next + n.config.MaxAppendEntries - 1
+	}
+	var entries []LogEntry
+	if next <= end {
+		entries = append(entries, n.log[next-n.log[0].Index:end-n.log[0].Index+1]...)
+	}
+
+	args := &AppendEntriesArgs{
+		Term:         term,
+		LeaderID:     n.id,
+		PrevLogIndex: prevIndex,
+		PrevLogTerm:  prevTerm,
+		Entries:      entries,
+		LeaderCommit: n.commitIndex,
+	}
+	n.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), n.config.ElectionTimeout)
+	defer cancel()
+
+	reply, err := n.transport.AppendEntries(ctx, peer, args)
+	if err != nil {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if reply.Term > n.currentTerm {
+		_ = n.becomeFollower(reply.Term)
+		return
+	}
+	if n.state != Leader || n.currentTerm != term {
+		return
+	}
+
+	if reply.Success {
+		match := args.PrevLogIndex + len(args.Entries)
+		if match > n.matchIndex[peer] {
+			n.matchIndex[peer] = match
+		}
+		if match+1 > n.nextIndex[peer] {
+			n.nextIndex[peer] = match + 1
+		}
+		n.advanceCommitIndex()
+		if n.nextIndex[peer] <= n.lastIndex() {
+			go n.replicateTo(peer, term)
+		}
+		return
+	}
+
+	if reply.ConflictIndex == 0 {
+		// Rejected without a hint, e.g. because the follower failed to
+		// persist; the next heartbeat retries.
+		return
+	}
+
+	// Back off using the follower's conflict hint to skip a whole term at a time.
+	next = reply.ConflictIndex
+	if reply.ConflictTerm > 0 {
+		for i := n.lastIndex(); i > n.log[0].Index; i-- {
+			if t, _ := n.termAt(i); t == reply.ConflictTerm {
+				next = i + 1
+				break
+			}
+		}
+	}
+	if next < 1 {
+		next = 1
+	}
+	if next > n.lastIndex()+1 {
+		next = n.lastIndex() + 1
+	}
+	n.nextIndex[peer] = next
+	go n.replicateTo(peer, term)
+}
+
+// advanceCommitIndex commits the highest current-term index stored on a
+// majority. Caller must hold n.mu.
+func (n *Node) advanceCommitIndex() {
+	if n.state != Leader {
+		return
+	}
+	for idx := n.lastIndex(); idx > n.commitIndex; idx-- {
+		if t, _ := n.termAt(idx); t != n.currentTerm {
+			break
+		}
+		count := 0
+		for _, m := range n.members {
+			if m == n.id || n.matchIndex[m] >= idx {
+				count++
+			}
+		}
+		if count >= n.quorumSize() {
+			n.setCommitIndex(idx)
+			return
+		}
+	}
+}
+
+// setCommitIndex advances the commit index and wakes the applier. Caller must hold n.mu.
+func (n *Node) setCommitIndex(idx int) {
+	if idx <= n.commitIndex {
+		return
+	}
+	n.commitIndex = idx
+	n.applyCond.Broadcast()
+	n.notify()
+
+	// A leader that committed its own removal hands over by stepping down.
+	if n.state == Leader && n.configIndex <= idx && !n.isMember(n.id) {
+		_ = n.becomeFollower(n.currentTerm)
+	}
+}
+
+func (n *Node) applier() {
+	defer n.wg.Done()
+
+	for {
+		n.mu.Lock()
+		for n.lastApplied >= n.commitIndex && n.pendingSnapshot == nil && !n.stopped {
+			n.applyCond.Wait()
+		}
+		if n.stopped {
+			n.mu.Unlock()
+			return
+		}
+
+		if snap := n.pendingSnapshot; snap != nil {
+			n.pendingSnapshot = nil
+			if snap.Index > n.lastApplied {
+				n.lastApplied = snap.Index
+			}
+			n.mu.Unlock()
+
+			select {
+			case n.applyCh <- ApplyMsg{Index: snap.Index, Term: snap.Term, SnapshotValid: true, Snapshot: snap.Data}:
+			case <-n.stopCh:
+				return
+			}
+			continue
+		}
+
+		var msgs []ApplyMsg
+		for i := n.lastApplied + 1; i <= n.commitIndex; i++ {
+			e := n.log[i-n.log[0].Index]
+			if e.Type == EntryCommand {
+				msgs = append(msgs, ApplyMsg{Index: e.Index, Term: e.Term, Command: e.Command})
+			}
+		}
+		n.lastApplied = n.commitIndex
+		n.mu.Unlock()
+
+		for _, msg := range msgs {
+			select {
+			case n.applyCh <- msg:
+			case <-n.stopCh:
+				return
+			}
+		}
+	}
+}
+
+// persist writes the durable state to the store. Caller must hold n.mu.
+func (n *Node) persist() error {
+	return n.save(n.currentTerm, n.votedFor, n.log)
+}
+
+// save writes the given state to the store. Changes to the node's own state
+// are saved this way first and only applied once the write succeeded, so a
+// failed write leaves the node as it was. Caller must hold n.mu.
+func (n *Node) save(term int, votedFor string, log []LogEntry) error {
+	return n.store.Save(PersistentState{
+		Term:     term,
+		VotedFor: votedFor,
+		Log:      log,
+	})
+}
+
+// notify wakes goroutines waiting in Propose. Caller must hold n.mu.
+func (n *Node) notify() {
+	close(n.notifyCh)
+	n.notifyCh = make(chan struct{})
+}
+
+// resetElectionTimer picks a new randomized timeout. Caller must hold n.mu.
+func (n *Node) resetElectionTimer() {
+	n.lastContact = time.Now()
+	n.electionTimeout = n.config.ElectionTimeout + time.Duration(n.rng.Int63n(int64(n.config.ElectionTimeout)))
+}
+
+func (n *Node) quorumSize() int {
+	return len(n.members)/2 + 1
+}
+
+func (n *Node) lastIndex() int {
+	return n.log[len(n.log)-1].Index
+}
+
+func (n *Node) lastTerm() int {
+	return n.log[len(n.log)-1].Term
+}
+
+// termAt returns the term of the entry at index, if it is still in the log.
+func (n *Node) termAt(index int) (int, bool) {
+	base := n.log[0].Index
+	if index < base || index > n.lastIndex() {
+		return 0, false
+	}
+	return n.log[index-base].Term, true
 }
@@ -0,0 +1,241 @@
+package raft
+
+import (
+	"context"
+	"time"
+)
+
+// RequestVoteArgs is the RequestVote RPC request.
+type RequestVoteArgs struct {
+	Term         int
+	CandidateID  string
+	LastLogIndex int
+	LastLogTerm  int
+}
+
+// RequestVoteReply is the RequestVote RPC response.
+type RequestVoteReply struct {
+	Term        int
+	VoteGranted bool
+}
+
+// AppendEntriesArgs is the AppendEntries RPC request. An empty Entries slice is a heartbeat.
+type AppendEntriesArgs struct {
+	Term         int
+	LeaderID     string
+	PrevLogIndex int
+	PrevLogTerm  int
+	Entries      []LogEntry
+	LeaderCommit int
+}
+
+// AppendEntriesReply is the AppendEntries RPC response.
+type AppendEntriesReply struct {
+	Term    int
+	Success bool
+
+	// On failure, ConflictTerm is the term of the follower's entry at
+	// PrevLogIndex (0 if the follower's log is too short) and ConflictIndex is
+	// the first index the leader should retry from. ConflictIndex is 0 if the
+	// follower rejected the entries for another reason, such as a failed write.
+	ConflictTerm  int
+	ConflictIndex int
+}
+
+// InstallSnapshotArgs is the InstallSnapshot RPC request. The snapshot is
+// sent in a single message.
+type InstallSnapshotArgs struct {
+	Term              int
+	LeaderID          string
+	LastIncludedIndex int
+	LastIncludedTerm  int
+	Members           []string
+	Data              []byte
+}
+
+// InstallSnapshotReply is the InstallSnapshot RPC response.
+type InstallSnapshotReply struct {
+	Term int
+
+	// Success is false if the follower could not store the snapshot.
+	Success bool
+}
+
+// Transport abstracts RPCs between nodes.
+type Transport interface {
+	RequestVote(ctx context.Context, peer string, args *RequestVoteArgs) (*RequestVoteReply, error)
+	AppendEntries(ctx context.Context, peer string, args *AppendEntriesArgs) (*AppendEntriesReply, error)
+	InstallSnapshot(ctx context.Context, peer string, args *InstallSnapshotArgs) (*InstallSnapshotReply, error)
+}
+
+// Handler receives inbound RPCs. *Node implements Handler; network transports
+// decode requests and dispatch them to it.
+type Handler interface {
+	HandleRequestVote(args *RequestVoteArgs) *RequestVoteReply
+	HandleAppendEntries(args *AppendEntriesArgs) *AppendEntriesReply
+	HandleInstallSnapshot(args *InstallSnapshotArgs) *InstallSnapshotReply
+}
+
+// HandleRequestVote processes a RequestVote RPC.
+func (n *Node) HandleRequestVote(args *RequestVoteArgs) *RequestVoteReply {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	// Ignore candidates while a leader is known to be alive. This keeps
+	// removed servers, which no longer receive heartbeats, from disrupting
+	// the cluster with ever-increasing terms.
+	leaderAlive := n.state == Leader ||
+		(n.leaderID != "" && time.Since(n.lastContact) < n.config.ElectionTimeout)
+	if leaderAlive && args.CandidateID != n.leaderID {
+		return &RequestVoteReply{Term: n.currentTerm}
+	}
+
+	reply := &RequestVoteReply{Term: n.currentTerm}
+	if args.Term > n.currentTerm {
+		if err := n.becomeFollower(args.Term); err != nil {
+			return reply
+		}
+		reply.Term = n.currentTerm
+	}
+	if args.Term < n.currentTerm {
+		return reply
+	}
+
+	upToDate := args.LastLogTerm > n.lastTerm() ||
+		(args.LastLogTerm == n.lastTerm() && args.LastLogIndex >= n.lastIndex())
+	if !upToDate || (n.votedFor != "" && n.votedFor != args.CandidateID) {
+		return reply
+	}
+
+	if err := n.save(n.currentTerm, args.CandidateID, n.log); err != nil {
+		return reply
+	}
+	n.votedFor = args.CandidateID
+	n.resetElectionTimer()
+	reply.VoteGranted = true
+	return reply
+}
+
+// HandleAppendEntries processes an AppendEntries RPC.
+func (n *Node) HandleAppendEntries(args *AppendEntriesArgs) *AppendEntriesReply {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	reply := &AppendEntriesReply{Term: n.currentTerm}
+	if args.Term < n.currentTerm {
+		return reply
+	}
+	if args.Term > n.currentTerm || n.state != Follower {
+		if err := n.becomeFollower(args.Term); err != nil {
+			return reply
+		}
+	}
+	reply.Term = n.currentTerm
+	n.leaderID = args.LeaderID
+	n.resetElectionTimer()
+
+	if args.PrevLogIndex > n.lastIndex() {
+		reply.ConflictIndex = n.lastIndex() + 1
+		return reply
+	}
+	if t, ok := n.termAt(args.PrevLogIndex); ok && t != args.PrevLogTerm {
+		reply.ConflictTerm = t
+		i := args.PrevLogIndex
+		for i-1 > n.log[0].Index {
+			if pt, _ := n.termAt(i - 1); pt != t {
+				break
+			}
+			i--
+		}
+		reply.ConflictIndex = i
+		return reply
+	}
+
+	// Only truncate on a real conflict: a stale, reordered RPC must not
+	// discard entries that a newer RPC already appended. The new log is
+	// built in a copy and only replaces n.log once it is persisted.
+	base := n.log[0].Index
+	var log []LogEntry
+	for i, e := range args.Entries {
+		if e.Index <= base {
+			continue
+		}
+		if e.Index > n.lastIndex() {
+			log = append(n.log[:len(n.log):len(n.log)], args.Entries[i:]...)
+			break
+		}
+		if t, _ := n.termAt(e.Index); t != e.Term {
+			if e.Index <= n.commitIndex {
+				// Never happens with a correct leader; refuse rather than lose committed data.
+				return reply
+			}
+			keep := e.Index - base
+			log = append(n.log[:keep:keep], args.Entries[i:]...)
+			break
+		}
+	}
+	if log != nil {
+		if err := n.save(n.currentTerm, n.votedFor, log); err != nil {
+			return reply
+		}
+		n.log = log
+		n.refreshMembers()
+	}
+
+	if args.LeaderCommit > n.commitIndex {
+		lastNew := args.PrevLogIndex + len(args.Entries)
+		if args.LeaderCommit < lastNew {
+			lastNew = args.LeaderCommit
+		}
+		n.setCommitIndex(lastNew)
+	}
+
+	reply.Success = true
+	return reply
+}
+
+// HandleInstallSnapshot processes an InstallSnapshot RPC.
+func (n *Node) HandleInstallSnapshot(args *InstallSnapshotArgs) *InstallSnapshotReply {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	reply := &InstallSnapshotReply{Term: n.currentTerm}
+	if args.Term < n.currentTerm {
+		return reply
+	}
+	if args.Term > n.currentTerm || n.state != Follower {
+		if err := n.becomeFollower(args.Term); err != nil {
+			return reply
+		}
+	}
+	reply.Term = n.currentTerm
+	n.leaderID = args.LeaderID
+	n.resetElectionTimer()
+
+	if args.LastIncludedIndex <= n.commitIndex {
+		reply.Success = true
+		return reply
+	}
+
+	snap := &Snapshot{
+		Index:   args.LastIncludedIndex,
+		Term:    args.LastIncludedTerm,
+		Members: append([]string(nil), args.Members...),
+		Data:    args.Data,
+	}
+	if err := n.store.SaveSnapshot(snap); err != nil {
+		return reply
+	}
+	log := n.compactedLog(snap.Index, snap.Term)
+	if err := n.save(n.currentTerm, n.votedFor, log); err != nil {
+		return reply
+	}
+	n.snapshot = snap
+	n.log = log
+	n.refreshMembers()
+
+	n.pendingSnapshot = snap
+	n.setCommitIndex(snap.Index)
+	reply.Success = true
+	return reply
+}
@@ -0,0 +1,115 @@
+package raft
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrInvalidSnapshot is returned by Snapshot for an index that is already
+// compacted or has not been applied yet.
+var ErrInvalidSnapshot = errors.New("raft: snapshot index out of range")
+
+// Snapshot is a point-in-time image of the state machine. It replaces every
+// log entry up to and including Index.
+type Snapshot struct {
+	Index   int
+	Term    int
+	Members []string // Cluster configuration as of Index
+	Data    []byte
+}
+
+// Snapshot records the state machine image data, taken after applying the
+// entry at index, and discards the log up to that index. Applications call it
+// from their apply loop, typically once the log grows past a threshold.
+func (n *Node) Snapshot(index int, data []byte) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if index <= n.log[0].Index || index > n.lastApplied {
+		return ErrInvalidSnapshot
+	}
+
+	term, _ := n.termAt(index)
+	snap := &Snapshot{
+		Index:   index,
+		Term:    term,
+		Members: n.membersAt(index),
+		Data:    data,
+	}
+	if err := n.store.SaveSnapshot(snap); err != nil {
+		return err
+	}
+	log := n.compactedLog(index, term)
+	if err := n.save(n.currentTerm, n.votedFor, log); err != nil {
+		return err
+	}
+	n.snapshot = snap
+	n.log = log
+	return nil
+}
+
+// LogSize returns the number of entries retained in the log since the last snapshot.
+func (n *Node) LogSize() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.log) - 1
+}
+
+// compactedLog returns the log without the entries up to index, keeping any
+// suffix that follows it. If the log does not contain a matching entry at
+// index the whole log is discarded. Caller must hold n.mu.
+func (n *Node) compactedLog(index, term int) []LogEntry {
+	base := n.log[0].Index
+	var rest []LogEntry
+	if t, ok := n.termAt(index); ok && t == term {
+		rest = n.log[index-base+1:]
+	}
+	return append([]LogEntry{{Index: index, Term: term}}, rest...)
+}
+
+func (n *Node) sendSnapshot(peer string, term int) {
+	n.mu.Lock()
+	if n.state != Leader || n.currentTerm != term || n.snapshot == nil {
+		n.mu.Unlock()
+		return
+	}
+	snap := n.snapshot
+	args := &InstallSnapshotArgs{
+		Term:              term,
+		LeaderID:          n.id,
+		LastIncludedIndex: snap.Index,
+		LastIncludedTerm:  snap.Term,
+		Members:           snap.Members,
+		Data:              snap.Data,
+	}
+	n.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), n.config.ElectionTimeout)
+	defer cancel()
+
+	reply, err := n.transport.InstallSnapshot(ctx, peer, args)
+	if err != nil {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if reply.Term > n.currentTerm {
+		_ = n.becomeFollower(reply.Term)
+		return
+	}
+	if n.state != Leader || n.currentTerm != term || !reply.Success {
+		return
+	}
+	if args.LastIncludedIndex > n.matchIndex[peer] {
+		n.matchIndex[peer] = args.LastIncludedIndex
+	}
+	if args.LastIncludedIndex+1 > n.nextIndex[peer] {
+		n.nextIndex[peer] = args.LastIncludedIndex + 1
+	}
+	n.advanceCommitIndex()
+	if n.nextIndex[peer] <= n.lastIndex() {
+		go n.replicateTo(peer, term)
+	}
+}
@@ -0,0 +1,188 @@
+package raft
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// PersistentState is the state a node must keep across restarts.
+type PersistentState struct {
+	Term     int
+	VotedFor string
+
+	// Log[0] is a sentinel holding the index and term that precede the first
+	// stored entry. An empty Log means a fresh node.
+	Log []LogEntry
+}
+
+// Store persists a node's term, vote, log and latest snapshot. Writes must be
+// durable before they return, because the node acknowledges votes and entries
+// right after. The node always saves a snapshot before trimming the log.
+type Store interface {
+	Save(state PersistentState) error
+	Load() (PersistentState, error)
+
+	SaveSnapshot(snap *Snapshot) error
+	// LoadSnapshot returns nil if no snapshot has been saved.
+	LoadSnapshot() (*Snapshot, error)
+}
+
+// MemoryStore keeps state in memory. It survives Node restarts within the same
+// process, which is enough for tests and simulations.
+type MemoryStore struct {
+	state    PersistentState
+	snapshot *Snapshot
+	mu       sync.Mutex
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// Save stores a copy of state.
+func (s *MemoryStore) Save(state PersistentState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state.Log = append([]LogEntry(nil), state.Log...)
+	s.state = state
+	return nil
+}
+
+// Load returns a copy of the last saved state.
+func (s *MemoryStore) Load() (PersistentState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := s.state
+	st.Log = append([]LogEntry(nil), st.Log...)
+	return st, nil
+}
+
+// SaveSnapshot replaces the stored snapshot.
+func (s *MemoryStore) SaveSnapshot(snap *Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cp := *snap
+	s.snapshot = &cp
+	return nil
+}
+
+// LoadSnapshot returns the stored snapshot, or nil.
+func (s *MemoryStore) LoadSnapshot() (*Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.snapshot == nil {
+		return nil, nil
+	}
+	cp := *s.snapshot
+	return &cp, nil
+}
+
+// FileStore persists state and snapshot as JSON files, each replaced
+// atomically on write. It rewrites the whole log on every Save, so the log
+// should be kept short by taking snapshots.
+type FileStore struct {
+	path         string
+	snapshotPath string
+	mu           sync.Mutex
+}
+
+// NewFileStore creates a FileStore that writes to dir/raft-state.json and
+// dir/raft-snapshot.json.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileStore{
+		path:         filepath.Join(dir, "raft-state.json"),
+		snapshotPath: filepath.Join(dir, "raft-snapshot.json"),
+	}, nil
+}
+
+// Save writes state to a temporary file, syncs it and renames it into place.
+func (s *FileStore) Save(state PersistentState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, data)
+}
+
+// Load reads the last saved state. A missing file yields an empty state.
+func (s *FileStore) Load() (PersistentState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var st PersistentState
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return st, err
+	}
+	if err := json.Unmarshal(data, &st); err != nil {
+		return st, err
+	}
+	return st, nil
+}
+
+// SaveSnapshot writes snap to the snapshot file.
+func (s *FileStore) SaveSnapshot(snap *Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.snapshotPath, data)
+}
+
+// LoadSnapshot reads the snapshot file, returning nil if it does not exist.
+func (s *FileStore) LoadSnapshot() (*Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.snapshotPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, err
+	}
+	return &snap, nil
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,583 @@
+package raft_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/algorithms/consensus/raft"
+)
+
+type cluster struct {
+	t         *testing.T
+	transport *raft.MemoryTransport
+	ids       []string
+	nodes     map[string]*raft.Node
+	stores    map[string]raft.Store
+
+	mu          sync.Mutex
+	applied     map[string][]string
+	lastApplied map[string]int
+}
+
+func newCluster(t *testing.T, size int) *cluster {
+	c := &cluster{
+		t:           t,
+		transport:   raft.NewMemoryTransport(),
+		nodes:       make(map[string]*raft.Node),
+		stores:      make(map[string]raft.Store),
+		applied:     make(map[string][]string),
+		lastApplied: make(map[string]int),
+	}
+	for i := 0; i < size; i++ {
+		id := fmt.Sprintf("n%d", i)
+		c.ids = append(c.ids, id)
+		c.stores[id] = raft.NewMemoryStore()
+	}
+	for _, id := range c.ids {
+		c.start(id)
+	}
+	t.Cleanup(c.stopAll)
+	return c
+}
+
+func (c *cluster) start(id string) {
+	var peers []string
+	for _, p := range c.ids {
+		if p != id {
+			peers = append(peers, p)
+		}
+	}
+	c.startWithConfig(raft.Config{ID: id, Peers: peers})
+}
+
+// join starts a node that is not yet part of the cluster configuration.
+func (c *cluster) join(id string) *raft.Node {
+	c.ids = append(c.ids, id)
+	c.stores[id] = raft.NewMemoryStore()
+	c.startWithConfig(raft.Config{ID: id, Join: true})
+	return c.nodes[id]
+}
+
+func (c *cluster) startWithConfig(cfg raft.Config) {
+	id := cfg.ID
+	cfg.ElectionTimeout = 50 * time.Millisecond
+	cfg.HeartbeatInterval = 10 * time.Millisecond
+	cfg.Store = c.stores[id]
+
+	applyCh := make(chan raft.ApplyMsg, 128)
+	node, err := raft.NewWithConfig(cfg, c.transport, applyCh)
+	if err != nil {
+		c.t.Fatalf("NewWithConfig(%s): %v", id, err)
+	}
+
+	c.mu.Lock()
+	c.applied[id] = nil
+	c.mu.Unlock()
+
+	go func() {
+		for msg := range applyCh {
+			c.mu.Lock()
+			if msg.SnapshotValid {
+				var state []string
+				_ = json.Unmarshal(msg.Snapshot, &state)
+				c.applied[id] = state
+			} else {
+				c.applied[id] = append(c.applied[id], string(msg.Command))
+			}
+			c.lastApplied[id] = msg.Index
+			c.mu.Unlock()
+		}
+	}()
+
+	c.nodes[id] = node
+	c.transport.Register(id, node)
+	node.Start()
+}
+
+func (c *cluster) stopAll() {
+	for _, n := range c.nodes {
+		n.Stop()
+	}
+}
+
+func (c *cluster) leader(exclude ...string) *raft.Node {
+	c.t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, id := range c.ids {
+			if contains(exclude, id) {
+				continue
+			}
+			if st, _ := c.nodes[id].State(); st == raft.Leader {
+				return c.nodes[id]
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.t.Fatal("no leader elected")
+	return nil
+}
+
+func (c *cluster) waitApplied(id string, want []string) {
+	c.t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		got := append([]string(nil), c.applied[id]...)
+		c.mu.Unlock()
+		if equal(got, want) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t.Fatalf("node %s applied %v, want %v", id, c.applied[id], want)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func propose(t *testing.T, n *raft.Node, cmd string) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := n.Propose(ctx, []byte(cmd)); err != nil {
+		t.Fatalf("Propose(%q): %v", cmd, err)
+	}
+}
+
+func TestLeaderElection(t *testing.T) {
+	c := newCluster(t, 3)
+	leader := c.leader()
+	_, term := leader.State()
+
+	// Heartbeats must keep the same leader in place.
+	time.Sleep(300 * time.Millisecond)
+	if st, newTerm := leader.State(); st != raft.Leader || newTerm != term {
+		t.Errorf("leader changed without failures: state=%v term=%d->%d", st, term, newTerm)
+	}
+
+	leaders := 0
+	for _, n := range c.nodes {
+		if st, _ := n.State(); st == raft.Leader {
+			leaders++
+		}
+	}
+	if leaders != 1 {
+		t.Errorf("expected 1 leader, got %d", leaders)
+	}
+}
+
+func TestReplicationAndApply(t *testing.T) {
+	c := newCluster(t, 3)
+	leader := c.leader()
+
+	want := []string{"a", "b", "c"}
+	for _, cmd := range want {
+		propose(t, leader, cmd)
+	}
+	for _, id := range c.ids {
+		c.waitApplied(id, want)
+	}
+}
+
+func TestProposeOnFollower(t *testing.T) {
+	c := newCluster(t, 3)
+	leader := c.leader()
+
+	for _, n := range c.nodes {
+		if n == leader {
+			continue
+		}
+		if _, err := n.Propose(context.Background(), []byte("x")); err != raft.ErrNotLeader {
+			t.Errorf("expected ErrNotLeader, got %v", err)
+		}
+		if n.Leader() != leader.ID() {
+			t.Errorf("follower %s reports leader %q, want %q", n.ID(), n.Leader(), leader.ID())
+		}
+	}
+}
+
+func TestLeaderFailover(t *testing.T) {
+	c := newCluster(t, 3)
+	old := c.leader()
+	propose(t, old, "before")
+
+	c.transport.Disconnect(old.ID())
+
+	// The isolated leader cannot commit.
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := old.Propose(ctx, []byte("lost")); err == nil {
+		t.Fatal("isolated leader committed an entry")
+	}
+
+	leader := c.leader(old.ID())
+	propose(t, leader, "after")
+
+	c.transport.Connect(old.ID())
+
+	// The old leader steps down and its uncommitted entry is overwritten.
+	want := []string{"before", "after"}
+	for _, id := range c.ids {
+		c.waitApplied(id, want)
+	}
+	if st, _ := old.State(); st == raft.Leader && old != c.leader() {
+		t.Error("old leader did not step down")
+	}
+}
+
+func TestMinorityPartitionCannotCommit(t *testing.T) {
+	c := newCluster(t, 5)
+	leader := c.leader()
+
+	var minority, majority []string
+	minority = append(minority, leader.ID())
+	for _, id := range c.ids {
+		if id == leader.ID() {
+			continue
+		}
+		if len(minority) < 2 {
+			minority = append(minority, id)
+		} else {
+			majority = append(majority, id)
+		}
+	}
+	c.transport.Partition(minority, majority)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := leader.Propose(ctx, []byte("minority")); err == nil {
+		t.Fatal("minority leader committed an entry")
+	}
+
+	newLeader := c.leader(minority...)
+	propose(t, newLeader, "majority")
+
+	c.transport.Heal()
+	for _, id := range c.ids {
+		c.waitApplied(id, []string{"majority"})
+	}
+}
+
+func TestMessageLoss(t *testing.T) {
+	c := newCluster(t, 3)
+	c.transport.SetDropRate(0.2, 42)
+
+	var want []string
+	for i := 0; i < 10; i++ {
+		cmd := fmt.Sprintf("cmd-%d", i)
+		for {
+			leader := c.leader()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			_, err := leader.Propose(ctx, []byte(cmd))
+			cancel()
+			if err == nil {
+				break
+			}
+		}
+		want = append(want, cmd)
+	}
+
+	// Retried proposals may commit twice; every command must appear in order.
+	c.transport.SetDropRate(0, 0)
+	for _, id := range c.ids {
+		waitContainsInOrder(t, c, id, want)
+	}
+}
+
+func waitContainsInOrder(t *testing.T, c *cluster, id string, want []string) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		got := append([]string(nil), c.applied[id]...)
+		c.mu.Unlock()
+		j := 0
+		for _, g := range got {
+			if j < len(want) && g == want[j] {
+				j++
+			}
+		}
+		if j == len(want) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("node %s did not apply %v in order", id, want)
+}
+
+func TestRestartFromStore(t *testing.T) {
+	c := newCluster(t, 3)
+	leader := c.leader()
+	propose(t, leader, "one")
+	propose(t, leader, "two")
+
+	var follower string
+	for _, id := range c.ids {
+		if id != leader.ID() {
+			follower = id
+			break
+		}
+	}
+	c.waitApplied(follower, []string{"one", "two"})
+
+	_, termBefore := c.nodes[follower].State()
+	c.nodes[follower].Stop()
+	c.start(follower)
+
+	// The restarted node keeps its term and replays its log once the leader
+	// tells it the commit index.
+	if _, term := c.nodes[follower].State(); term < termBefore {
+		t.Errorf("term went backwards after restart: %d -> %d", termBefore, term)
+	}
+	c.waitApplied(follower, []string{"one", "two"})
+}
+
+// failingStore is a MemoryStore whose writes fail while failing is set.
+type failingStore struct {
+	*raft.MemoryStore
+	failing atomic.Bool
+}
+
+func (s *failingStore) Save(state raft.PersistentState) error {
+	if s.failing.Load() {
+		return fmt.Errorf("disk full")
+	}
+	return s.MemoryStore.Save(state)
+}
+
+func TestFailedPersistLeavesStateUnchanged(t *testing.T) {
+	store := &failingStore{MemoryStore: raft.NewMemoryStore()}
+	store.failing.Store(true)
+	node, err := raft.NewWithConfig(raft.Config{
+		ID:                "n0",
+		ElectionTimeout:   20 * time.Millisecond,
+		HeartbeatInterval: 5 * time.Millisecond,
+		Store:             store,
+	}, raft.NewMemoryTransport(), make(chan raft.ApplyMsg, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Neither the leader's term nor its entries are adopted unless they are
+	// persisted.
+	reply := node.HandleAppendEntries(&raft.AppendEntriesArgs{
+		Term:     1,
+		LeaderID: "n1",
+		Entries:  []raft.LogEntry{{Index: 1, Term: 1, Command: []byte("x")}},
+	})
+	if reply.Success || node.LogSize() != 0 {
+		t.Errorf("entries applied without being persisted: success=%v log=%d", reply.Success, node.LogSize())
+	}
+	if vote := node.HandleRequestVote(&raft.RequestVoteArgs{Term: 2, CandidateID: "n1"}); vote.VoteGranted {
+		t.Error("vote granted without being persisted")
+	}
+	if snap := node.HandleInstallSnapshot(&raft.InstallSnapshotArgs{Term: 3, LeaderID: "n1", LastIncludedIndex: 5, LastIncludedTerm: 3}); snap.Success {
+		t.Error("snapshot acknowledged without being persisted")
+	}
+	if _, term := node.State(); term != 0 {
+		t.Errorf("adopted term %d without persisting it", term)
+	}
+
+	// A node that cannot persist its vote does not start a new term.
+	node.Start()
+	defer node.Stop()
+	time.Sleep(100 * time.Millisecond)
+	if st, term := node.State(); st != raft.Follower || term != 0 {
+		t.Errorf("campaigned without a durable vote: state=%v term=%d", st, term)
+	}
+
+	store.failing.Store(false)
+	deadline := time.Now().Add(time.Second)
+	for st, _ := node.State(); st != raft.Leader; st, _ = node.State() {
+		if time.Now().After(deadline) {
+			t.Fatal("no leader after the store recovered")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	state, _ := store.Load()
+	if _, term := node.State(); state.Term != term || state.VotedFor != "n0" {
+		t.Errorf("persisted term %d (vote %q) does not match term %d", state.Term, state.VotedFor, term)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	store, err := raft.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	empty, err := store.Load()
+	if err != nil || empty.Term != 0 || len(empty.Log) != 0 {
+		t.Fatalf("expected empty state, got %+v, %v", empty, err)
+	}
+
+	state := raft.PersistentState{
+		Term:     3,
+		VotedFor: "n1",
+		Log: []raft.LogEntry{
+			{Index: 0, Term: 0},
+			{Index: 1, Term: 2, Command: []byte("x")},
+		},
+	}
+	if err := store.Save(state); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Term != 3 || got.VotedFor != "n1" || len(got.Log) != 2 || string(got.Log[1].Command) != "x" {
+		t.Errorf("unexpected state after reload: %+v", got)
+	}
+}
+
+// snapshot makes node id compact its log up to everything it has applied.
+func (c *cluster) snapshot(id string) {
+	c.t.Helper()
+	c.mu.Lock()
+	data, _ := json.Marshal(c.applied[id])
+	index := c.lastApplied[id]
+	c.mu.Unlock()
+
+	if err := c.nodes[id].Snapshot(index, data); err != nil {
+		c.t.Fatalf("Snapshot(%s, %d): %v", id, index, err)
+	}
+}
+
+func TestSnapshotCompactsLog(t *testing.T) {
+	c := newCluster(t, 3)
+	leader := c.leader()
+
+	want := []string{"a", "b", "c", "d"}
+	for _, cmd := range want {
+		propose(t, leader, cmd)
+	}
+	c.waitApplied(leader.ID(), want)
+
+	c.snapshot(leader.ID())
+	if size := leader.LogSize(); size != 0 {
+		t.Errorf("expected empty log after snapshot, got %d entries", size)
+	}
+	if err := leader.Snapshot(1, nil); err != raft.ErrInvalidSnapshot {
+		t.Errorf("expected ErrInvalidSnapshot for compacted index, got %v", err)
+	}
+}
+
+func TestLaggingFollowerReceivesSnapshot(t *testing.T) {
+	c := newCluster(t, 3)
+	leader := c.leader()
+
+	var lagging string
+	for _, id := range c.ids {
+		if id != leader.ID() {
+			lagging = id
+			break
+		}
+	}
+	c.transport.Disconnect(lagging)
+
+	want := []string{"a", "b", "c", "d", "e"}
+	for _, cmd := range want {
+		propose(t, leader, cmd)
+	}
+	c.waitApplied(leader.ID(), want)
+	c.snapshot(leader.ID())
+
+	c.transport.Connect(lagging)
+	c.waitApplied(lagging, want)
+
+	// Replication continues normally after the snapshot.
+	propose(t, c.leader(), "f")
+	c.waitApplied(lagging, append(want, "f"))
+}
+
+func TestRestartFromSnapshot(t *testing.T) {
+	c := newCluster(t, 3)
+	leader := c.leader()
+
+	var follower string
+	for _, id := range c.ids {
+		if id != leader.ID() {
+			follower = id
+			break
+		}
+	}
+
+	want := []string{"a", "b", "c"}
+	for _, cmd := range want {
+		propose(t, leader, cmd)
+	}
+	c.waitApplied(follower, want)
+	c.snapshot(follower)
+
+	c.nodes[follower].Stop()
+	c.start(follower)
+	c.waitApplied(follower, want)
+}
+
+func TestAddAndRemovePeer(t *testing.T) {
+	c := newCluster(t, 3)
+	leader := c.leader()
+	propose(t, leader, "a")
+
+	c.join("n3")
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := leader.AddPeer(ctx, "n3"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	c.waitApplied("n3", []string{"a"})
+	if members := leader.Members(); len(members) != 4 {
+		t.Errorf("expected 4 members, got %v", members)
+	}
+
+	// Removing the leader makes it step down; the rest elect a new leader.
+	if err := leader.RemovePeer(ctx, leader.ID()); err != nil {
+		t.Fatalf("RemovePeer: %v", err)
+	}
+	if st, _ := leader.State(); st == raft.Leader {
+		t.Error("removed leader did not step down")
+	}
+
+	newLeader := c.leader(leader.ID())
+	if members := newLeader.Members(); len(members) != 3 {
+		t.Errorf("expected 3 members after removal, got %v", members)
+	}
+	propose(t, newLeader, "b")
+	for _, id := range newLeader.Members() {
+		c.waitApplied(id, []string{"a", "b"})
+	}
+
+	// The removed node stays passive.
+	time.Sleep(200 * time.Millisecond)
+	if st, _ := leader.State(); st != raft.Follower {
+		t.Errorf("removed node is %v, want follower", st)
+	}
+}
@@ -0,0 +1,175 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+)
+
+// ErrUnreachable is returned by MemoryTransport when a message is dropped.
+var ErrUnreachable = errors.New("raft: peer unreachable")
+
+// MemoryTransport connects nodes in the same process. It can simulate
+// disconnected nodes, network partitions, one-way link failures and random
+// message loss, which makes failure scenarios reproducible in tests.
+type MemoryTransport struct {
+	handlers     map[string]Handler
+	disconnected map[string]bool
+	blocked      map[[2]string]bool
+	group        map[string]int // partition group per node; nil when healed
+	dropRate     float64
+	rng          *rand.Rand
+	mu           sync.Mutex
+}
+
+// NewMemoryTransport creates a fully connected MemoryTransport.
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{
+		handlers:     make(map[string]Handler),
+		disconnected: make(map[string]bool),
+		blocked:      make(map[[2]string]bool),
+		rng:          rand.New(rand.NewSource(1)),
+	}
+}
+
+// Register makes h reachable as id.
+func (t *MemoryTransport) Register(id string, h Handler) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.handlers[id] = h
+}
+
+// Disconnect isolates id from every other node in both directions.
+func (t *MemoryTransport) Disconnect(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.disconnected[id] = true
+}
+
+// Connect reverses Disconnect.
+func (t *MemoryTransport) Connect(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.disconnected, id)
+}
+
+// Block drops all messages sent from one node to another (one direction only).
+func (t *MemoryTransport) Block(from, to string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.blocked[[2]string{from, to}] = true
+}
+
+// Unblock reverses Block.
+func (t *MemoryTransport) Unblock(from, to string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.blocked, [2]string{from, to})
+}
+
+// Partition splits the cluster so that nodes can only reach nodes in the same
+// group. Nodes not listed in any group are isolated.
+func (t *MemoryTransport) Partition(groups ...[]string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.group = make(map[string]int)
+	for i, g := range groups {
+		for _, id := range g {
+			t.group[id] = i
+		}
+	}
+}
+
+// Heal removes any partition created by Partition.
+func (t *MemoryTransport) Heal() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.group = nil
+}
+
+// SetDropRate drops each message with the given probability, using a
+// deterministic random source seeded with seed.
+func (t *MemoryTransport) SetDropRate(rate float64, seed int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.dropRate = rate
+	t.rng = rand.New(rand.NewSource(seed))
+}
+
+// RequestVote implements Transport.
+func (t *MemoryTransport) RequestVote(ctx context.Context, peer string, args *RequestVoteArgs) (*RequestVoteReply, error) {
+	h, err := t.route(ctx, args.CandidateID, peer)
+	if err != nil {
+		return nil, err
+	}
+	reply := h.HandleRequestVote(args)
+	if !t.reachable(peer, args.CandidateID) {
+		return nil, ErrUnreachable
+	}
+	return reply, nil
+}
+
+// AppendEntries implements Transport.
+func (t *MemoryTransport) AppendEntries(ctx context.Context, peer string, args *AppendEntriesArgs) (*AppendEntriesReply, error) {
+	h, err := t.route(ctx, args.LeaderID, peer)
+	if err != nil {
+		return nil, err
+	}
+	reply := h.HandleAppendEntries(args)
+	if !t.reachable(peer, args.LeaderID) {
+		return nil, ErrUnreachable
+	}
+	return reply, nil
+}
+
+// InstallSnapshot implements Transport.
+func (t *MemoryTransport) InstallSnapshot(ctx context.Context, peer string, args *InstallSnapshotArgs) (*InstallSnapshotReply, error) {
+	h, err := t.route(ctx, args.LeaderID, peer)
+	if err != nil {
+		return nil, err
+	}
+	reply := h.HandleInstallSnapshot(args)
+	if !t.reachable(peer, args.LeaderID) {
+		return nil, ErrUnreachable
+	}
+	return reply, nil
+}
+
+func (t *MemoryTransport) route(ctx context.Context, from, to string) (Handler, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if !t.reachable(from, to) {
+		return nil, ErrUnreachable
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h, ok := t.handlers[to]
+	if !ok {
+		return nil, ErrUnreachable
+	}
+	return h, nil
+}
+
+// reachable reports whether a single message from -> to is delivered.
+func (t *MemoryTransport) reachable(from, to string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.disconnected[from] || t.disconnected[to] || t.blocked[[2]string{from, to}] {
+		return false
+	}
+	if t.group != nil {
+		gf, okf := t.group[from]
+		gt, okt := t.group[to]
+		if !okf || !okt || gf != gt {
+			return false
+		}
+	}
+	if t.dropRate > 0 && t.rng.Float64() < t.dropRate {
+		return false
+	}
+	return true
+}
@@ -4,7 +4,7 @@ import (
 	"context"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
-	"go.opentelemetry.io/otel"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
@@ -20,7 +20,7 @@ type InstrumentedTracker struct {
 func NewInstrumentedTracker(next Tracker) *InstrumentedTracker {
 	return &InstrumentedTracker{
 		next:   next,
-		tracer: otel.Tracer("pkg/analytics"),
+		tracer: instrument.NewTracer("pkg/analytics"),
 	}
 }
 
@@ -5,7 +5,7 @@ import (
 	"time"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
-	"go.opentelemetry.io/otel"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -19,7 +19,7 @@ type InstrumentedServer struct {
 func NewInstrumentedServer(next Server) *InstrumentedServer {
 	return &InstrumentedServer{
 		next:   next,
-		tracer: otel.Tracer("pkg/api"),
+		tracer: instrument.NewTracer("pkg/api"),
 	}
 }
 
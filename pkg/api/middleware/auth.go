@@ -4,6 +4,9 @@ import (
 	"context"
 	"net/http"
 	"strings"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/api/rbac"
+	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
 )
 
 type contextKey string
@@ -50,6 +53,55 @@ func AuthMiddleware(verifier Verifier) func(http.Handler) http.Handler {
 	}
 }
 
+// ResourceFunc names the resource a request acts on, e.g. "documents:42".
+type ResourceFunc func(r *http.Request) string
+
+// StaticResource names the same resource for every request.
+func StaticResource(resource string) ResourceFunc {
+	return func(*http.Request) string { return resource }
+}
+
+// PathResource names the resource resourceType:id, taking the id from the
+// named path wildcard of the route.
+func PathResource(resourceType, wildcard string) ResourceFunc {
+	return func(r *http.Request) string { return resourceType + ":" + r.PathValue(wildcard) }
+}
+
+// Authorize checks, per route, that the subject authenticated by
+// AuthMiddleware may perform action on the request's resource. Enforcers
+// implementing rbac.SubjectEnforcer decide on the subject as well as its role.
+func Authorize(enforcer rbac.Enforcer, action string, resource ResourceFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			sub, role := GetSubject(ctx), GetRole(ctx)
+			if sub == "" && role == "" {
+				http.Error(w, "unauthenticated", http.StatusUnauthorized)
+				return
+			}
+
+			var allowed bool
+			var err error
+			if se, ok := enforcer.(rbac.SubjectEnforcer); ok {
+				allowed, err = se.EnforceSubject(ctx, sub, role, resource(r), action)
+			} else {
+				allowed, err = enforcer.Enforce(ctx, role, resource(r), action)
+			}
+			if err != nil {
+				logger.L().ErrorContext(ctx, "authorization failed", "subject", sub, "action", action, "error", err)
+				http.Error(w, "authorization failed", http.StatusInternalServerError)
+				return
+			}
+			if !allowed {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // Helpers to get data from context
 func GetSubject(ctx context.Context) string {
 	s, _ := ctx.Value(ContextKeySubject).(string)
@@ -0,0 +1,59 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/api/rbac/policy"
+	"github.com/chris-alexander-pop/system-design-library/pkg/concurrency"
+)
+
+// Store implements policy.TupleStore in memory.
+type Store struct {
+	tuples map[policy.Tuple]struct{}
+	mu     *concurrency.SmartRWMutex
+}
+
+var _ policy.TupleStore = (*Store)(nil)
+
+// New creates an empty Store.
+func New() *Store {
+	return &Store{
+		tuples: make(map[policy.Tuple]struct{}),
+		mu: concurrency.NewSmartRWMutex(concurrency.MutexConfig{
+			Name: "memory-policy-tuples",
+		}),
+	}
+}
+
+func (s *Store) Write(ctx context.Context, tuples ...policy.Tuple) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range tuples {
+		s.tuples[t] = struct{}{}
+	}
+	return nil
+}
+
+func (s *Store) Delete(ctx context.Context, tuples ...policy.Tuple) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range tuples {
+		delete(s.tuples, t)
+	}
+	return nil
+}
+
+func (s *Store) Read(ctx context.Context, filter policy.TupleFilter) ([]policy.Tuple, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var out []policy.Tuple
+	for t := range s.tuples {
+		if filter.Matches(t) {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,80 @@
+package policy
+
+import (
+	"encoding/json"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/datastructures/lru"
+)
+
+// decisionCache caches decisions for a TTL. Clearing it bumps a generation
+// so that decisions evaluated against the previous rules are not stored.
+type decisionCache struct {
+	ttl     time.Duration
+	size    int
+	gen     atomic.Uint64
+	entries atomic.Pointer[lru.Cache[string, cachedDecision]]
+}
+
+type cachedDecision struct {
+	decision Decision
+	expires  time.Time
+}
+
+func newDecisionCache(size int, ttl time.Duration) *decisionCache {
+	c := &decisionCache{ttl: ttl, size: size}
+	c.entries.Store(lru.New[string, cachedDecision](size))
+	return c
+}
+
+func (c *decisionCache) get(key string) (*Decision, bool) {
+	if c.ttl <= 0 {
+		return nil, false
+	}
+	entry, ok := c.entries.Load().Get(key)
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	d := entry.decision
+	d.Trace = slices.Clone(d.Trace)
+	d.Cached = true
+	return &d, true
+}
+
+// set stores a decision evaluated at generation gen, unless the cache has
+// been cleared since.
+func (c *decisionCache) set(key string, gen uint64, d *Decision) {
+	if c.ttl <= 0 {
+		return
+	}
+	// Load the entries before checking the generation: clear bumps the
+	// generation before replacing them.
+	entries := c.entries.Load()
+	if c.gen.Load() != gen {
+		return
+	}
+	entry := cachedDecision{decision: *d, expires: time.Now().Add(c.ttl)}
+	entry.decision.Trace = slices.Clone(d.Trace)
+	entries.Set(key, entry)
+}
+
+func (c *decisionCache) generation() uint64 {
+	return c.gen.Load()
+}
+
+func (c *decisionCache) clear() {
+	c.gen.Add(1)
+	c.entries.Store(lru.New[string, cachedDecision](c.size))
+}
+
+// cacheKey identifies a request. Requests whose attributes cannot be
+// encoded are not cached.
+func cacheKey(req Request) (string, bool) {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
@@ -0,0 +1,78 @@
+package policy
+
+import (
+	"maps"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/google/cel-go/cel"
+)
+
+func newCELEnv() (*cel.Env, error) {
+	attrs := cel.MapType(cel.StringType, cel.DynType)
+	return cel.NewEnv(
+		cel.Variable("subject", attrs),
+		cel.Variable("resource", attrs),
+		cel.Variable("action", cel.StringType),
+		cel.Variable("env", attrs),
+	)
+}
+
+// compileCondition compiles a CEL condition, which must evaluate to a bool.
+func compileCondition(env *cel.Env, expr string) (cel.Program, error) {
+	ast, iss := env.Compile(expr)
+	if iss.Err() != nil {
+		return nil, errors.InvalidArgument("invalid condition: "+iss.Err().Error(), iss.Err())
+	}
+	if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+		return nil, errors.InvalidArgument("condition must evaluate to a bool: "+expr, nil)
+	}
+	prg, err := env.Program(ast)
+	if err != nil {
+		return nil, errors.InvalidArgument("invalid condition: "+expr, err)
+	}
+	return prg, nil
+}
+
+func evalCondition(prg cel.Program, vars map[string]any) (bool, error) {
+	out, _, err := prg.Eval(vars)
+	if err != nil {
+		return false, err
+	}
+	ok, isBool := out.Value().(bool)
+	if !isBool {
+		return false, errors.InvalidArgument("condition did not evaluate to a bool", nil)
+	}
+	return ok, nil
+}
+
+// conditionVars builds the activation conditions are evaluated against.
+func conditionVars(req Request, roles []string) map[string]any {
+	subject := maps.Clone(req.Subject.Attributes)
+	if subject == nil {
+		subject = make(map[string]any)
+	}
+	subject["id"] = req.Subject.ID
+	subject["roles"] = roles
+
+	resource := maps.Clone(req.Resource.Attributes)
+	if resource == nil {
+		resource = make(map[string]any)
+	}
+	resource["type"] = req.Resource.Type
+	resource["id"] = req.Resource.ID
+
+	env := maps.Clone(req.Environment)
+	if env == nil {
+		env = make(map[string]any)
+	}
+	if _, ok := env["time"]; !ok {
+		env["time"] = time.Now()
+	}
+	return map[string]any{
+		"subject":  subject,
+		"resource": resource,
+		"action":   req.Action,
+		"env":      env,
+	}
+}
@@ -0,0 +1,16 @@
+/*
+Package policy provides a policy-based authorization engine combining
+role-based, attribute-based and relationship-based access control.
+
+Rules match roles (with inheritance), resource and action wildcards, CEL
+conditions over subject, resource and environment attributes, and
+Zanzibar-style relationship tuples. Engine implements rbac.Enforcer, so it
+can replace rbac.SimpleEnforcer and be used per route with
+middleware.Authorize.
+
+	engine, _ := policy.New(policy.Config{Tuples: memory.New(), Schema: schema})
+	engine.AddRole("editor", "viewer")
+	engine.AddRule(policy.Rule{Roles: []string{"viewer"}, Resources: []string{"documents:*"}, Actions: []string{"read"}})
+	engine.AddRule(policy.Rule{Effect: policy.EffectDeny, Condition: `resource.classified && !("cleared" in subject.roles)`})
+*/
+package policy
@@ -0,0 +1,501 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/api/rbac"
+	"github.com/chris-alexander-pop/system-design-library/pkg/concurrency"
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/google/cel-go/cel"
+)
+
+// Effect is the outcome a rule produces when it matches.
+type Effect string
+
+const (
+	EffectAllow Effect = "allow"
+	EffectDeny  Effect = "deny"
+)
+
+// Wildcard matches any role, resource or action.
+const Wildcard = "*"
+
+// Config configures an Engine.
+type Config struct {
+	// CacheSize is the number of decisions kept in the decision cache.
+	CacheSize int `env:"POLICY_CACHE_SIZE" env-default:"10000"`
+
+	// CacheTTL bounds how long a decision is cached. Zero disables caching.
+	CacheTTL time.Duration `env:"POLICY_CACHE_TTL" env-default:"1m"`
+
+	// MaxDepth bounds the recursion of relationship checks.
+	MaxDepth int `env:"POLICY_MAX_DEPTH" env-default:"25"`
+
+	// Schema declares how relations are derived from one another.
+	Schema Schema
+
+	// Tuples stores relationship tuples. Required for rules with a Relation
+	// and for Check, Expand and ListObjects.
+	Tuples TupleStore
+
+	// Attributes, if set, supplies subject and resource attributes to
+	// Enforce and EnforceSubject.
+	Attributes AttributeSource
+}
+
+// AttributeSource loads the attributes conditions are evaluated against.
+type AttributeSource interface {
+	SubjectAttributes(ctx context.Context, subject string) (map[string]any, error)
+	ResourceAttributes(ctx context.Context, resource Resource) (map[string]any, error)
+}
+
+// Subject is the principal a request is made by.
+type Subject struct {
+	ID         string
+	Roles      []string
+	Attributes map[string]any
+}
+
+// Resource is the object a request acts on, written as "type:id".
+type Resource struct {
+	Type       string
+	ID         string
+	Attributes map[string]any
+}
+
+// ParseResource splits a "type:id" resource. A resource without a colon is
+// a type with no ID.
+func ParseResource(s string) Resource {
+	typ, id, _ := strings.Cut(s, ":")
+	return Resource{Type: typ, ID: id}
+}
+
+func (r Resource) String() string {
+	if r.ID == "" {
+		return r.Type
+	}
+	return r.Type + ":" + r.ID
+}
+
+// Request is an authorization question: may Subject perform Action on
+// Resource, given Environment.
+type Request struct {
+	Subject     Subject
+	Resource    Resource
+	Action      string
+	Environment map[string]any
+}
+
+// Rule grants or denies actions on resources.
+//
+// A rule matches a request when the subject holds one of Roles (directly or
+// by inheritance), the resource matches one of Resources, the action matches
+// one of Actions, the subject holds Relation on the resource and Condition
+// evaluates to true. Empty fields match anything. Resources and Actions may
+// contain "*" wildcards, e.g. "documents:*".
+//
+// Condition is a CEL expression over subject, resource, action and env.
+// subject and resource are maps of their attributes together with "id" and
+// "roles", or "type" and "id"; env holds the request environment and
+// "time", the evaluation time. A condition that fails to evaluate, e.g. on a
+// missing attribute, fails closed: a deny rule matches and an allow rule
+// does not.
+type Rule struct {
+	ID        string
+	Effect    Effect
+	Roles     []string
+	Resources []string
+	Actions   []string
+	Relation  string
+	Condition string
+}
+
+// Decision is the result of evaluating a request.
+type Decision struct {
+	Allowed bool
+
+	// Rule is the ID of the deciding rule, empty if no rule matched.
+	Rule   string
+	Reason string
+
+	// Trace records how every rule was evaluated.
+	Trace []TraceStep
+
+	// Cached reports whether the decision came from the decision cache.
+	Cached bool
+}
+
+// TraceStep explains the evaluation of one rule.
+type TraceStep struct {
+	Rule    string
+	Effect  Effect
+	Matched bool
+	Reason  string
+}
+
+func (d *Decision) String() string {
+	var b strings.Builder
+	if d.Allowed {
+		b.WriteString("allowed")
+	} else {
+		b.WriteString("denied")
+	}
+	fmt.Fprintf(&b, ": %s", d.Reason)
+	for _, step := range d.Trace {
+		mark := " "
+		if step.Matched {
+			mark = "*"
+		}
+		fmt.Fprintf(&b, "\n %s %s (%s): %s", mark, step.Rule, step.Effect, step.Reason)
+	}
+	return b.String()
+}
+
+// Engine evaluates requests against rules with role inheritance, attribute
+// conditions and relationship tuples. Deny rules override allow rules and
+// requests no rule allows are denied.
+//
+// Decisions are cached for CacheTTL. Changing rules, roles or tuples through
+// the Engine clears the cache; tuples written to the store directly, and
+// conditions on env.time, may be stale for up to CacheTTL.
+type Engine struct {
+	cfg   Config
+	env   *cel.Env
+	mu    *concurrency.SmartRWMutex
+	rules []*compiledRule
+	roles map[string][]string
+	cache *decisionCache
+	seq   int
+}
+
+var _ rbac.SubjectEnforcer = (*Engine)(nil)
+
+type compiledRule struct {
+	Rule
+	program cel.Program
+}
+
+// New creates an Engine with no rules.
+func New(cfg Config) (*Engine, error) {
+	if cfg.CacheSize <= 0 {
+		cfg.CacheSize = 10000
+	}
+	if cfg.MaxDepth <= 0 {
+		cfg.MaxDepth = 25
+	}
+	env, err := newCELEnv()
+	if err != nil {
+		return nil, errors.Internal("failed to create condition environment", err)
+	}
+	return &Engine{
+		cfg:   cfg,
+		env:   env,
+		mu:    concurrency.NewSmartRWMutex(concurrency.MutexConfig{Name: "policy-engine"}),
+		roles: make(map[string][]string),
+		cache: newDecisionCache(cfg.CacheSize, cfg.CacheTTL),
+	}, nil
+}
+
+// AddRule adds a rule, compiling its condition. Rules without an ID are
+// given one.
+func (e *Engine) AddRule(rule Rule) error {
+	switch rule.Effect {
+	case "":
+		rule.Effect = EffectAllow
+	case EffectAllow, EffectDeny:
+	default:
+		return errors.InvalidArgument("unknown effect: "+string(rule.Effect), nil)
+	}
+	compiled := &compiledRule{Rule: rule}
+	if rule.Condition != "" {
+		prg, err := compileCondition(e.env, rule.Condition)
+		if err != nil {
+			return err
+		}
+		compiled.program = prg
+	}
+	compiled.Roles = slices.Clone(rule.Roles)
+	compiled.Resources = slices.Clone(rule.Resources)
+	compiled.Actions = slices.Clone(rule.Actions)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.seq++
+	if compiled.ID == "" {
+		compiled.ID = fmt.Sprintf("rule-%d", e.seq)
+	}
+	for _, r := range e.rules {
+		if r.ID == compiled.ID {
+			return errors.Conflict("rule already exists: "+compiled.ID, nil)
+		}
+	}
+	e.rules = append(e.rules, compiled)
+	e.cache.clear()
+	return nil
+}
+
+// RemoveRule removes the rule with the given ID.
+func (e *Engine) RemoveRule(id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	i := slices.IndexFunc(e.rules, func(r *compiledRule) bool { return r.ID == id })
+	if i < 0 {
+		return errors.NotFound("rule not found: "+id, nil)
+	}
+	e.rules = slices.Delete(e.rules, i, i+1)
+	e.cache.clear()
+	return nil
+}
+
+// Rules returns the engine's rules in evaluation order.
+func (e *Engine) Rules() []Rule {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	rules := make([]Rule, len(e.rules))
+	for i, r := range e.rules {
+		rules[i] = r.Rule
+	}
+	return rules
+}
+
+// AddRole declares that role inherits the permissions of the given roles.
+func (e *Engine) AddRole(role string, inherits ...string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, parent := range inherits {
+		if !slices.Contains(e.roles[role], parent) {
+			e.roles[role] = append(e.roles[role], parent)
+		}
+	}
+	e.cache.clear()
+}
+
+// EffectiveRoles returns the given roles and every role they inherit.
+func (e *Engine) EffectiveRoles(roles ...string) []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.effectiveRoles(roles)
+}
+
+func (e *Engine) effectiveRoles(roles []string) []string {
+	var out []string
+	queue := slices.Clone(roles)
+	for len(queue) > 0 {
+		role := queue[0]
+		queue = queue[1:]
+		if role == "" || slices.Contains(out, role) {
+			continue
+		}
+		out = append(out, role)
+		queue = append(queue, e.roles[role]...)
+	}
+	return out
+}
+
+// AddPolicy implements rbac.Enforcer by allowing role to perform action on
+// resource.
+func (e *Engine) AddPolicy(role string, resource string, action string) {
+	// Without a condition AddRule only fails on duplicate IDs, which
+	// generated IDs never are.
+	_ = e.AddRule(Rule{Roles: []string{role}, Resources: []string{resource}, Actions: []string{action}})
+}
+
+// Enforce implements rbac.Enforcer for an anonymous subject holding role.
+func (e *Engine) Enforce(ctx context.Context, role string, resource string, action string) (bool, error) {
+	return e.EnforceSubject(ctx, "", role, resource, action)
+}
+
+// EnforceSubject implements rbac.SubjectEnforcer. Attributes are loaded from
+// the configured AttributeSource and the environment from the context.
+func (e *Engine) EnforceSubject(ctx context.Context, subject string, role string, resource string, action string) (bool, error) {
+	req := Request{
+		Subject:     Subject{ID: subject},
+		Resource:    ParseResource(resource),
+		Action:      action,
+		Environment: EnvironmentFrom(ctx),
+	}
+	if role != "" {
+		req.Subject.Roles = []string{role}
+	}
+	if e.cfg.Attributes != nil {
+		var err error
+		if subject != "" {
+			if req.Subject.Attributes, err = e.cfg.Attributes.SubjectAttributes(ctx, subject); err != nil {
+				return false, errors.Wrap(err, "failed to load subject attributes")
+			}
+		}
+		if req.Resource.Attributes, err = e.cfg.Attributes.ResourceAttributes(ctx, req.Resource); err != nil {
+			return false, errors.Wrap(err, "failed to load resource attributes")
+		}
+	}
+	d, err := e.Evaluate(ctx, req)
+	if err != nil {
+		return false, err
+	}
+	return d.Allowed, nil
+}
+
+// Evaluate decides a request, serving it from the decision cache when
+// possible.
+func (e *Engine) Evaluate(ctx context.Context, req Request) (*Decision, error) {
+	key, cacheable := cacheKey(req)
+	if cacheable {
+		if d, ok := e.cache.get(key); ok {
+			return d, nil
+		}
+	}
+	e.mu.RLock()
+	gen := e.cache.generation()
+	rules := slices.Clone(e.rules)
+	roles := e.effectiveRoles(req.Subject.Roles)
+	e.mu.RUnlock()
+
+	d, err := e.evaluate(ctx, rules, roles, req)
+	if err != nil {
+		return nil, err
+	}
+	if cacheable {
+		e.cache.set(key, gen, d)
+	}
+	return d, nil
+}
+
+// Explain evaluates a request bypassing the decision cache, so that the
+// returned trace reflects the current rules and tuples.
+func (e *Engine) Explain(ctx context.Context, req Request) (*Decision, error) {
+	e.mu.RLock()
+	rules := slices.Clone(e.rules)
+	roles := e.effectiveRoles(req.Subject.Roles)
+	e.mu.RUnlock()
+	return e.evaluate(ctx, rules, roles, req)
+}
+
+func (e *Engine) evaluate(ctx context.Context, rules []*compiledRule, roles []string, req Request) (*Decision, error) {
+	d := &Decision{Reason: "no rule allows " + req.Action + " on " + req.Resource.String()}
+	resource := req.Resource.String()
+	var vars map[string]any
+
+	for _, rule := range rules {
+		step := TraceStep{Rule: rule.ID, Effect: rule.Effect}
+		matched, reason, err := e.match(ctx, rule, roles, resource, req, &vars)
+		if err != nil {
+			return nil, err
+		}
+		step.Matched, step.Reason = matched, reason
+		d.Trace = append(d.Trace, step)
+		if !matched {
+			continue
+		}
+		if rule.Effect == EffectDeny {
+			d.Allowed, d.Rule = false, rule.ID
+			d.Reason = "denied by " + rule.ID + ": " + reason
+			return d, nil
+		}
+		if !d.Allowed {
+			d.Allowed, d.Rule = true, rule.ID
+			d.Reason = "allowed by " + rule.ID + ": " + reason
+		}
+	}
+	return d, nil
+}
+
+// match reports whether rule applies to the request and why.
+func (e *Engine) match(ctx context.Context, rule *compiledRule, roles []string, resource string, req Request, vars *map[string]any) (bool, string, error) {
+	var reasons []string
+
+	if len(rule.Roles) > 0 {
+		i := slices.IndexFunc(rule.Roles, func(r string) bool { return r == Wildcard || slices.Contains(roles, r) })
+		if i < 0 {
+			return false, "subject holds none of roles " + strings.Join(rule.Roles, ", "), nil
+		}
+		reasons = append(reasons, "role "+rule.Roles[i])
+	}
+	if len(rule.Resources) > 0 && !matchAny(rule.Resources, resource) {
+		return false, "resource " + resource + " does not match " + strings.Join(rule.Resources, ", "), nil
+	}
+	if len(rule.Actions) > 0 && !matchAny(rule.Actions, req.Action) {
+		return false, "action " + req.Action + " does not match " + strings.Join(rule.Actions, ", "), nil
+	}
+	if rule.Relation != "" {
+		if req.Subject.ID == "" {
+			return false, "relation " + rule.Relation + " requires a subject", nil
+		}
+		object := ObjectRef{Type: req.Resource.Type, ID: req.Resource.ID}
+		path, err := e.check(ctx, object, rule.Relation, SubjectRef{Object: subjectObject(req.Subject.ID)}, 0, nil)
+		if err != nil {
+			return false, "", err
+		}
+		if path == nil {
+			return false, "subject is not " + rule.Relation + " of " + object.String(), nil
+		}
+		reasons = append(reasons, "subject is "+rule.Relation+" of "+object.String()+" via "+strings.Join(path, " -> "))
+	}
+	if rule.program != nil {
+		if *vars == nil {
+			*vars = conditionVars(req, roles)
+		}
+		ok, err := evalCondition(rule.program, *vars)
+		if err != nil {
+			// Fail closed: an erroring deny condition must not let an allow rule win.
+			return rule.Effect == EffectDeny, "condition error: " + err.Error(), nil
+		}
+		if !ok {
+			return false, "condition " + rule.Condition + " is false", nil
+		}
+		reasons = append(reasons, "condition "+rule.Condition)
+	}
+	if len(reasons) == 0 {
+		return true, "rule matches every request", nil
+	}
+	return true, strings.Join(reasons, "; "), nil
+}
+
+// matchAny reports whether s matches any of the "*" wildcard patterns.
+func matchAny(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if matchGlob(p, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob matches s against pattern, where "*" matches any sequence of
+// characters.
+func matchGlob(pattern, s string) bool {
+	if !strings.Contains(pattern, Wildcard) {
+		return pattern == s
+	}
+	parts := strings.Split(pattern, Wildcard)
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return len(s) >= len(last) && strings.HasSuffix(s, last)
+}
+
+type envKey struct{}
+
+// WithEnvironment returns a context carrying environment attributes for
+// Enforce and EnforceSubject.
+func WithEnvironment(ctx context.Context, env map[string]any) context.Context {
+	return context.WithValue(ctx, envKey{}, env)
+}
+
+// EnvironmentFrom returns the environment attributes carried by ctx.
+func EnvironmentFrom(ctx context.Context) map[string]any {
+	env, _ := ctx.Value(envKey{}).(map[string]any)
+	return env
+}
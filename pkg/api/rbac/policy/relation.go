@@ -0,0 +1,360 @@
+package policy
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+)
+
+// ObjectRef identifies an object, written as "type:id".
+type ObjectRef struct {
+	Type string
+	ID   string
+}
+
+func (o ObjectRef) String() string {
+	return o.Type + ":" + o.ID
+}
+
+// SubjectRef is the subject of a relationship tuple: an object such as
+// "user:alice", every object of a type ("user:*"), or a userset, the
+// subjects holding a relation on an object ("group:eng#member").
+type SubjectRef struct {
+	Object   ObjectRef
+	Relation string
+}
+
+func (s SubjectRef) String() string {
+	if s.Relation == "" {
+		return s.Object.String()
+	}
+	return s.Object.String() + "#" + s.Relation
+}
+
+// Tuple states that Subject holds Relation on Object, written as
+// "document:readme#viewer@user:alice".
+type Tuple struct {
+	Object   ObjectRef
+	Relation string
+	Subject  SubjectRef
+}
+
+func (t Tuple) String() string {
+	return t.Object.String() + "#" + t.Relation + "@" + t.Subject.String()
+}
+
+// ParseTuple parses a tuple in "type:id#relation@type:id[#relation]" form.
+func ParseTuple(s string) (Tuple, error) {
+	objRel, subject, ok := strings.Cut(s, "@")
+	if !ok {
+		return Tuple{}, errors.InvalidArgument("tuple has no subject: "+s, nil)
+	}
+	obj, rel, ok := strings.Cut(objRel, "#")
+	if !ok || rel == "" {
+		return Tuple{}, errors.InvalidArgument("tuple has no relation: "+s, nil)
+	}
+	object, err := parseObject(obj)
+	if err != nil {
+		return Tuple{}, err
+	}
+	subj, subjRel, _ := strings.Cut(subject, "#")
+	subjObject, err := parseObject(subj)
+	if err != nil {
+		return Tuple{}, err
+	}
+	return Tuple{Object: object, Relation: rel, Subject: SubjectRef{Object: subjObject, Relation: subjRel}}, nil
+}
+
+func parseObject(s string) (ObjectRef, error) {
+	typ, id, ok := strings.Cut(s, ":")
+	if !ok || typ == "" || id == "" {
+		return ObjectRef{}, errors.InvalidArgument("object must be type:id: "+s, nil)
+	}
+	return ObjectRef{Type: typ, ID: id}, nil
+}
+
+// subjectObject interprets a request subject as an object, defaulting to
+// the "user" type.
+func subjectObject(id string) ObjectRef {
+	if typ, oid, ok := strings.Cut(id, ":"); ok {
+		return ObjectRef{Type: typ, ID: oid}
+	}
+	return ObjectRef{Type: "user", ID: id}
+}
+
+// TupleFilter selects tuples. Empty fields match anything.
+type TupleFilter struct {
+	ObjectType      string
+	ObjectID        string
+	Relation        string
+	SubjectType     string
+	SubjectID       string
+	SubjectRelation string
+}
+
+// Matches reports whether t is selected by the filter.
+func (f TupleFilter) Matches(t Tuple) bool {
+	return (f.ObjectType == "" || f.ObjectType == t.Object.Type) &&
+		(f.ObjectID == "" || f.ObjectID == t.Object.ID) &&
+		(f.Relation == "" || f.Relation == t.Relation) &&
+		(f.SubjectType == "" || f.SubjectType == t.Subject.Object.Type) &&
+		(f.SubjectID == "" || f.SubjectID == t.Subject.Object.ID) &&
+		(f.SubjectRelation == "" || f.SubjectRelation == t.Subject.Relation)
+}
+
+// TupleStore persists relationship tuples.
+type TupleStore interface {
+	// Write stores tuples. Writing an existing tuple is not an error.
+	Write(ctx context.Context, tuples ...Tuple) error
+
+	// Delete removes tuples. Deleting a missing tuple is not an error.
+	Delete(ctx context.Context, tuples ...Tuple) error
+
+	// Read returns the tuples selected by filter.
+	Read(ctx context.Context, filter TupleFilter) ([]Tuple, error)
+}
+
+// Schema declares derived relations by object type and relation name.
+// Relations not in the schema hold only through their tuples.
+type Schema map[string]map[string]Relation
+
+// Relation declares the ways a relation holds besides its own tuples.
+type Relation struct {
+	// Implied lists relations on the same object that imply this one,
+	// e.g. "editor" for "viewer".
+	Implied []string
+
+	// Inherited lists relations held on related objects that imply this
+	// one, e.g. "viewer" of the "parent" folder for a document's viewer.
+	Inherited []Inherit
+}
+
+// Inherit names a relation held through the objects related by Via.
+type Inherit struct {
+	Via      string
+	Relation string
+}
+
+// WriteTuples writes tuples to the store and clears the decision cache.
+func (e *Engine) WriteTuples(ctx context.Context, tuples ...Tuple) error {
+	if e.cfg.Tuples == nil {
+		return errNoTupleStore
+	}
+	defer e.cache.clear()
+	return e.cfg.Tuples.Write(ctx, tuples...)
+}
+
+// DeleteTuples deletes tuples from the store and clears the decision cache.
+func (e *Engine) DeleteTuples(ctx context.Context, tuples ...Tuple) error {
+	if e.cfg.Tuples == nil {
+		return errNoTupleStore
+	}
+	defer e.cache.clear()
+	return e.cfg.Tuples.Delete(ctx, tuples...)
+}
+
+var errNoTupleStore = errors.InvalidArgument("no tuple store configured", nil)
+
+// Check reports whether subject holds relation on object, directly,
+// through a userset or as declared by the schema.
+func (e *Engine) Check(ctx context.Context, object ObjectRef, relation string, subject SubjectRef) (bool, error) {
+	path, err := e.check(ctx, object, relation, subject, 0, nil)
+	return path != nil, err
+}
+
+// check returns the tuples through which subject holds relation on object,
+// or nil if it does not.
+func (e *Engine) check(ctx context.Context, object ObjectRef, relation string, subject SubjectRef, depth int, visiting []string) ([]string, error) {
+	if e.cfg.Tuples == nil {
+		return nil, errNoTupleStore
+	}
+	if depth > e.cfg.MaxDepth {
+		return nil, errors.InvalidArgument("relationship check exceeded max depth", nil)
+	}
+	node := object.String() + "#" + relation
+	if slices.Contains(visiting, node) {
+		return nil, nil
+	}
+	visiting = append(visiting, node)
+
+	// The subject may be the userset itself, as in a check of group
+	// membership on behalf of another userset.
+	if subject.Relation == relation && subject.Object == object {
+		return []string{node}, nil
+	}
+
+	tuples, err := e.cfg.Tuples.Read(ctx, TupleFilter{ObjectType: object.Type, ObjectID: object.ID, Relation: relation})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read tuples")
+	}
+	for _, t := range tuples {
+		if t.Subject == subject || (t.Subject.Relation == "" && subject.Relation == "" &&
+			t.Subject.Object.Type == subject.Object.Type && t.Subject.Object.ID == Wildcard) {
+			return []string{t.String()}, nil
+		}
+	}
+	for _, t := range tuples {
+		if t.Subject.Relation == "" {
+			continue
+		}
+		path, err := e.check(ctx, t.Subject.Object, t.Subject.Relation, subject, depth+1, visiting)
+		if err != nil {
+			return nil, err
+		}
+		if path != nil {
+			return append([]string{t.String()}, path...), nil
+		}
+	}
+
+	rel := e.cfg.Schema[object.Type][relation]
+	for _, implied := range rel.Implied {
+		path, err := e.check(ctx, object, implied, subject, depth+1, visiting)
+		if err != nil {
+			return nil, err
+		}
+		if path != nil {
+			return path, nil
+		}
+	}
+	for _, inherit := range rel.Inherited {
+		related, err := e.cfg.Tuples.Read(ctx, TupleFilter{ObjectType: object.Type, ObjectID: object.ID, Relation: inherit.Via})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read tuples")
+		}
+		for _, t := range related {
+			path, err := e.check(ctx, t.Subject.Object, inherit.Relation, subject, depth+1, visiting)
+			if err != nil {
+				return nil, err
+			}
+			if path != nil {
+				return append([]string{t.String()}, path...), nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// UsersetTree is the expansion of a relation on an object.
+type UsersetTree struct {
+	Object   ObjectRef
+	Relation string
+
+	// Subjects are the subjects of the relation's own tuples, including
+	// usersets.
+	Subjects []SubjectRef
+
+	// Children expand the usersets among Subjects and the relations the
+	// schema derives this one from.
+	Children []*UsersetTree
+}
+
+// Leaves returns the distinct non-userset subjects in the tree.
+func (t *UsersetTree) Leaves() []SubjectRef {
+	var out []SubjectRef
+	var walk func(*UsersetTree)
+	walk = func(n *UsersetTree) {
+		for _, s := range n.Subjects {
+			if s.Relation == "" && !slices.Contains(out, s) {
+				out = append(out, s)
+			}
+		}
+		for _, c := range n.Children {
+			walk(c)
+		}
+	}
+	walk(t)
+	return out
+}
+
+// Expand returns the tree of subjects holding relation on object.
+func (e *Engine) Expand(ctx context.Context, object ObjectRef, relation string) (*UsersetTree, error) {
+	return e.expand(ctx, object, relation, 0, nil)
+}
+
+func (e *Engine) expand(ctx context.Context, object ObjectRef, relation string, depth int, visiting []string) (*UsersetTree, error) {
+	if e.cfg.Tuples == nil {
+		return nil, errNoTupleStore
+	}
+	if depth > e.cfg.MaxDepth {
+		return nil, errors.InvalidArgument("relationship expansion exceeded max depth", nil)
+	}
+	tree := &UsersetTree{Object: object, Relation: relation}
+	node := object.String() + "#" + relation
+	if slices.Contains(visiting, node) {
+		return tree, nil
+	}
+	visiting = append(visiting, node)
+
+	tuples, err := e.cfg.Tuples.Read(ctx, TupleFilter{ObjectType: object.Type, ObjectID: object.ID, Relation: relation})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read tuples")
+	}
+	var children []ObjectRef
+	var relations []string
+	for _, t := range tuples {
+		tree.Subjects = append(tree.Subjects, t.Subject)
+		if t.Subject.Relation != "" {
+			children = append(children, t.Subject.Object)
+			relations = append(relations, t.Subject.Relation)
+		}
+	}
+	rel := e.cfg.Schema[object.Type][relation]
+	for _, implied := range rel.Implied {
+		children = append(children, object)
+		relations = append(relations, implied)
+	}
+	for _, inherit := range rel.Inherited {
+		related, err := e.cfg.Tuples.Read(ctx, TupleFilter{ObjectType: object.Type, ObjectID: object.ID, Relation: inherit.Via})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read tuples")
+		}
+		for _, t := range related {
+			children = append(children, t.Subject.Object)
+			relations = append(relations, inherit.Relation)
+		}
+	}
+	for i, child := range children {
+		sub, err := e.expand(ctx, child, relations[i], depth+1, visiting)
+		if err != nil {
+			return nil, err
+		}
+		tree.Children = append(tree.Children, sub)
+	}
+	return tree, nil
+}
+
+// ListObjects returns the IDs of the objects of objectType on which subject
+// holds relation. Every object of the type with at least one tuple is
+// checked, so the cost grows with the number of such objects.
+func (e *Engine) ListObjects(ctx context.Context, objectType string, relation string, subject SubjectRef) ([]string, error) {
+	if e.cfg.Tuples == nil {
+		return nil, errNoTupleStore
+	}
+	tuples, err := e.cfg.Tuples.Read(ctx, TupleFilter{ObjectType: objectType})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read tuples")
+	}
+	seen := make(map[string]bool)
+	var candidates []string
+	for _, t := range tuples {
+		if !seen[t.Object.ID] {
+			seen[t.Object.ID] = true
+			candidates = append(candidates, t.Object.ID)
+		}
+	}
+	slices.Sort(candidates)
+
+	var ids []string
+	for _, id := range candidates {
+		path, err := e.check(ctx, ObjectRef{Type: objectType, ID: id}, relation, subject, 0, nil)
+		if err != nil {
+			return nil, err
+		}
+		if path != nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,345 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/api/middleware"
+	"github.com/chris-alexander-pop/system-design-library/pkg/api/rbac/policy"
+	"github.com/chris-alexander-pop/system-design-library/pkg/api/rbac/policy/adapters/memory"
+)
+
+var schema = policy.Schema{
+	"document": {
+		"viewer": {
+			Implied:   []string{"editor"},
+			Inherited: []policy.Inherit{{Via: "parent", Relation: "viewer"}},
+		},
+		"editor": {Implied: []string{"owner"}},
+	},
+	"folder": {
+		"viewer": {Implied: []string{"editor"}},
+	},
+}
+
+func newEngine(t *testing.T, tuples ...string) *policy.Engine {
+	t.Helper()
+	e, err := policy.New(policy.Config{CacheTTL: time.Minute, Schema: schema, Tuples: memory.New()})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	for _, s := range tuples {
+		tuple, err := policy.ParseTuple(s)
+		if err != nil {
+			t.Fatalf("ParseTuple(%q) failed: %v", s, err)
+		}
+		if err := e.WriteTuples(context.Background(), tuple); err != nil {
+			t.Fatalf("WriteTuples failed: %v", err)
+		}
+	}
+	return e
+}
+
+func addRule(t *testing.T, e *policy.Engine, rule policy.Rule) {
+	t.Helper()
+	if err := e.AddRule(rule); err != nil {
+		t.Fatalf("AddRule failed: %v", err)
+	}
+}
+
+func evaluate(t *testing.T, e *policy.Engine, req policy.Request) *policy.Decision {
+	t.Helper()
+	d, err := e.Evaluate(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+	return d
+}
+
+func user(id string) policy.SubjectRef {
+	return policy.SubjectRef{Object: policy.ObjectRef{Type: "user", ID: id}}
+}
+
+func TestRoleInheritanceAndWildcards(t *testing.T) {
+	e := newEngine(t)
+	e.AddRole("admin", "editor")
+	e.AddRole("editor", "viewer")
+	e.AddPolicy("viewer", "documents:*", "read")
+	e.AddPolicy("editor", "documents:*", "write")
+	e.AddPolicy("admin", "*", "*")
+
+	ctx := context.Background()
+	cases := []struct {
+		role, resource, action string
+		want                   bool
+	}{
+		{"viewer", "documents:1", "read", true},
+		{"viewer", "documents:1", "write", false},
+		{"editor", "documents:1", "read", true},
+		{"editor", "documents:1", "write", true},
+		{"editor", "users:1", "read", false},
+		{"admin", "users:1", "delete", true},
+		{"guest", "documents:1", "read", false},
+	}
+	for _, c := range cases {
+		got, err := e.Enforce(ctx, c.role, c.resource, c.action)
+		if err != nil {
+			t.Fatalf("Enforce failed: %v", err)
+		}
+		if got != c.want {
+			t.Errorf("Enforce(%s, %s, %s) = %v, want %v", c.role, c.resource, c.action, got, c.want)
+		}
+	}
+
+	if roles := e.EffectiveRoles("admin"); !slices.Equal(roles, []string{"admin", "editor", "viewer"}) {
+		t.Errorf("EffectiveRoles(admin) = %v", roles)
+	}
+}
+
+func TestRoleCycle(t *testing.T) {
+	e := newEngine(t)
+	e.AddRole("a", "b")
+	e.AddRole("b", "a")
+	if roles := e.EffectiveRoles("a"); len(roles) != 2 {
+		t.Errorf("EffectiveRoles(a) = %v", roles)
+	}
+}
+
+func TestConditionsAndDenyOverrides(t *testing.T) {
+	e := newEngine(t)
+	addRule(t, e, policy.Rule{
+		ID:        "same-department",
+		Resources: []string{"reports:*"},
+		Actions:   []string{"read"},
+		Condition: `subject.department == resource.department`,
+	})
+	addRule(t, e, policy.Rule{
+		ID:        "office-hours",
+		Effect:    policy.EffectDeny,
+		Resources: []string{"reports:*"},
+		Condition: `env.time.getHours("UTC") < 9 || env.time.getHours("UTC") >= 17`,
+	})
+
+	noon := time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC)
+	req := policy.Request{
+		Subject:     policy.Subject{ID: "alice", Attributes: map[string]any{"department": "finance"}},
+		Resource:    policy.Resource{Type: "reports", ID: "q1", Attributes: map[string]any{"department": "finance"}},
+		Action:      "read",
+		Environment: map[string]any{"time": noon},
+	}
+	d := evaluate(t, e, req)
+	if !d.Allowed || d.Rule != "same-department" {
+		t.Fatalf("expected allow by same-department, got %s", d)
+	}
+
+	req.Environment = map[string]any{"time": noon.Add(8 * time.Hour)}
+	d = evaluate(t, e, req)
+	if d.Allowed || d.Rule != "office-hours" {
+		t.Fatalf("expected deny by office-hours, got %s", d)
+	}
+
+	req.Environment = map[string]any{"time": noon}
+	req.Resource.Attributes = map[string]any{"department": "legal"}
+	d = evaluate(t, e, req)
+	if d.Allowed || d.Rule != "" {
+		t.Fatalf("expected default deny, got %s", d)
+	}
+	if len(d.Trace) != 2 || d.Trace[0].Matched || !strings.Contains(d.Trace[0].Reason, "is false") {
+		t.Errorf("unexpected trace: %s", d)
+	}
+}
+
+func TestConditionErrorOnDenyRuleDenies(t *testing.T) {
+	e := newEngine(t)
+	addRule(t, e, policy.Rule{ID: "readers", Resources: []string{"documents:*"}, Actions: []string{"read"}})
+	addRule(t, e, policy.Rule{
+		ID:        "classified",
+		Effect:    policy.EffectDeny,
+		Condition: `resource.classified && !("cleared" in subject.roles)`,
+	})
+	addRule(t, e, policy.Rule{ID: "broken-allow", Condition: `resource.public`})
+
+	req := policy.Request{
+		Subject:  policy.Subject{ID: "alice"},
+		Resource: policy.Resource{Type: "documents", ID: "d1"},
+		Action:   "read",
+	}
+	d := evaluate(t, e, req)
+	if d.Allowed || d.Rule != "classified" || !strings.Contains(d.Reason, "condition error") {
+		t.Fatalf("expected deny by the erroring condition, got %s", d)
+	}
+
+	// An erroring allow condition does not grant access.
+	req.Action = "write"
+	d = evaluate(t, e, req)
+	if d.Allowed {
+		t.Fatalf("expected default deny, got %s", d)
+	}
+
+	req.Action = "read"
+	req.Resource.Attributes = map[string]any{"classified": false}
+	if d := evaluate(t, e, req); !d.Allowed {
+		t.Fatalf("expected allow once the attribute is present, got %s", d)
+	}
+}
+
+func TestInvalidCondition(t *testing.T) {
+	e := newEngine(t)
+	if err := e.AddRule(policy.Rule{Condition: "subject.id +"}); err == nil {
+		t.Error("expected error for malformed condition")
+	}
+	if err := e.AddRule(policy.Rule{Condition: "action"}); err == nil {
+		t.Error("expected error for non-bool condition")
+	}
+	if err := e.AddRule(policy.Rule{Effect: "maybe"}); err == nil {
+		t.Error("expected error for unknown effect")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	e := newEngine(t,
+		"group:eng#member@user:alice",
+		"group:staff#member@group:eng#member",
+		"folder:plans#viewer@group:staff#member",
+		"document:roadmap#parent@folder:plans",
+		"document:readme#owner@user:bob",
+		"document:public#viewer@user:*",
+	)
+	ctx := context.Background()
+	doc := func(id string) policy.ObjectRef { return policy.ObjectRef{Type: "document", ID: id} }
+	cases := []struct {
+		object   policy.ObjectRef
+		relation string
+		subject  policy.SubjectRef
+		want     bool
+	}{
+		{doc("roadmap"), "viewer", user("alice"), true},
+		{doc("roadmap"), "editor", user("alice"), false},
+		{doc("roadmap"), "viewer", user("bob"), false},
+		{doc("readme"), "viewer", user("bob"), true},
+		{doc("readme"), "editor", user("bob"), true},
+		{doc("readme"), "viewer", user("alice"), false},
+		{doc("public"), "viewer", user("carol"), true},
+		{policy.ObjectRef{Type: "group", ID: "staff"}, "member", user("alice"), true},
+	}
+	for _, c := range cases {
+		got, err := e.Check(ctx, c.object, c.relation, c.subject)
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+		if got != c.want {
+			t.Errorf("Check(%s#%s@%s) = %v, want %v", c.object, c.relation, c.subject, got, c.want)
+		}
+	}
+
+	ids, err := e.ListObjects(ctx, "document", "viewer", user("alice"))
+	if err != nil {
+		t.Fatalf("ListObjects failed: %v", err)
+	}
+	if !slices.Equal(ids, []string{"public", "roadmap"}) {
+		t.Errorf("ListObjects = %v", ids)
+	}
+
+	tree, err := e.Expand(ctx, doc("roadmap"), "viewer")
+	if err != nil {
+		t.Fatalf("Expand failed: %v", err)
+	}
+	if leaves := tree.Leaves(); !slices.Equal(leaves, []policy.SubjectRef{user("alice")}) {
+		t.Errorf("Expand leaves = %v", leaves)
+	}
+}
+
+func TestCheckCycle(t *testing.T) {
+	e := newEngine(t,
+		"group:a#member@group:b#member",
+		"group:b#member@group:a#member",
+	)
+	ok, err := e.Check(context.Background(), policy.ObjectRef{Type: "group", ID: "a"}, "member", user("alice"))
+	if err != nil || ok {
+		t.Errorf("Check = %v, %v; want false, nil", ok, err)
+	}
+}
+
+func TestRelationRuleAndExplain(t *testing.T) {
+	e := newEngine(t, "document:readme#owner@user:bob")
+	addRule(t, e, policy.Rule{ID: "viewers-read", Resources: []string{"document:*"}, Actions: []string{"read"}, Relation: "viewer"})
+
+	req := policy.Request{Subject: policy.Subject{ID: "bob"}, Resource: policy.ParseResource("document:readme"), Action: "read"}
+	d, err := e.Explain(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Explain failed: %v", err)
+	}
+	if !d.Allowed || !strings.Contains(d.Reason, "document:readme#owner@user:bob") {
+		t.Errorf("expected allow explained by the owner tuple, got %s", d)
+	}
+
+	req.Subject.ID = "alice"
+	d = evaluate(t, e, req)
+	if d.Allowed || !strings.Contains(d.Trace[0].Reason, "not viewer") {
+		t.Errorf("expected deny, got %s", d)
+	}
+}
+
+func TestDecisionCache(t *testing.T) {
+	e := newEngine(t)
+	addRule(t, e, policy.Rule{Relation: "viewer"})
+	req := policy.Request{Subject: policy.Subject{ID: "alice"}, Resource: policy.ParseResource("document:readme"), Action: "read"}
+
+	if d := evaluate(t, e, req); d.Allowed || d.Cached {
+		t.Fatalf("expected fresh deny, got %+v", d)
+	}
+	if d := evaluate(t, e, req); d.Allowed || !d.Cached {
+		t.Fatalf("expected cached deny, got %+v", d)
+	}
+
+	tuple, _ := policy.ParseTuple("document:readme#viewer@user:alice")
+	if err := e.WriteTuples(context.Background(), tuple); err != nil {
+		t.Fatalf("WriteTuples failed: %v", err)
+	}
+	if d := evaluate(t, e, req); !d.Allowed || d.Cached {
+		t.Fatalf("expected fresh allow after writing a tuple, got %+v", d)
+	}
+}
+
+func TestAuthorizeMiddleware(t *testing.T) {
+	e := newEngine(t, "document:readme#viewer@user:alice")
+	addRule(t, e, policy.Rule{Actions: []string{"read"}, Relation: "viewer"})
+
+	mux := http.NewServeMux()
+	handler := middleware.Authorize(e, "read", middleware.PathResource("document", "id"))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }))
+	mux.Handle("GET /documents/{id}", middleware.AuthMiddleware(verifier{})(handler))
+
+	cases := []struct {
+		token, path string
+		want        int
+	}{
+		{"alice", "/documents/readme", http.StatusNoContent},
+		{"bob", "/documents/readme", http.StatusForbidden},
+		{"alice", "/documents/other", http.StatusForbidden},
+		{"", "/documents/readme", http.StatusUnauthorized},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, c.path, nil)
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != c.want {
+			t.Errorf("%s as %q: status %d, want %d", c.path, c.token, rec.Code, c.want)
+		}
+	}
+}
+
+// verifier accepts any token as the subject's name.
+type verifier struct{}
+
+func (verifier) Verify(ctx context.Context, token string) (string, string, error) {
+	return token, "user", nil
+}
@@ -19,6 +19,15 @@ type Enforcer interface {
 	AddPolicy(role string, resource string, action string)
 }
 
+// SubjectEnforcer is implemented by enforcers that decide on the subject
+// itself as well as its role, such as attribute or relationship based ones.
+type SubjectEnforcer interface {
+	Enforcer
+
+	// EnforceSubject checks if the subject, holding role, has permission to perform action on resource
+	EnforceSubject(ctx context.Context, subject string, role string, resource string, action string) (bool, error)
+}
+
 // SimpleEnforcer in-memory implementation
 type SimpleEnforcer struct {
 	policies map[string]map[Permission]bool // role -> permission -> true
@@ -3,7 +3,7 @@ package audit
 import (
 	"context"
 
-	"go.opentelemetry.io/otel"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -18,7 +18,7 @@ type InstrumentedAuditor struct {
 func NewInstrumentedAuditor(next Auditor) *InstrumentedAuditor {
 	return &InstrumentedAuditor{
 		next:   next,
-		tracer: otel.Tracer("pkg/audit"),
+		tracer: instrument.NewTracer("pkg/audit"),
 	}
 }
 
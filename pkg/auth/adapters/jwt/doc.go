@@ -1,4 +1,28 @@
-// Package jwt provides functionality for jwt.
+// Package jwt provides JSON Web Token signing and verification.
 //
-// TODO: Add detailed documentation.
+// Adapter signs and verifies tokens either with an HMAC secret (New) or
+// with an asymmetric KeySet (NewWithKeySet). A KeySet holds RS256, ES256
+// or EdDSA keys identified by kid headers, rotates them on a schedule
+// while keeping retired keys published for an overlap window, persists
+// them through a KeyStore such as SecretStore (a secrets.SecretManager
+// with optional KMS encryption), and serves them as a JWKS. Instances
+// sharing a store serialise rotations through a distlock.Locker and
+// reload the store when a token names a key they have not seen.
+//
+// RemoteVerifier verifies tokens against a remote JWKS, caching the keys
+// and refetching them when a token names an unknown key, so downstream
+// services can verify without sharing secrets.
+//
+// Usage:
+//
+//	keys, err := jwt.NewKeySet(ctx, jwt.KeySetConfig{
+//		Algorithm: jwt.AlgES256,
+//		Store:     jwt.NewSecretStore(jwt.SecretStoreConfig{Secrets: sm, KMS: km}),
+//		Locker:    locker,
+//	})
+//	go keys.Run(ctx)
+//	mux.Handle(jwt.JWKSPath, keys.Handler())
+//	issuer := jwt.NewWithKeySet(cfg, keys)
+//
+//	verifier := jwt.NewRemoteVerifier(jwt.RemoteConfig{JWKSURL: "https://auth.example.com" + jwt.JWKSPath})
 package jwt
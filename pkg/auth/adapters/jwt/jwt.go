@@ -11,21 +11,43 @@ import (
 )
 
 type Config struct {
-	Secret     string        `env:"JWT_SECRET" env-required:"true"`
+	// Secret is the HMAC key. It is required unless the adapter signs with
+	// a KeySet.
+	Secret     string        `env:"JWT_SECRET"`
 	Expiration time.Duration `env:"JWT_EXPIRATION" env-default:"24h"`
 	Issuer     string        `env:"JWT_ISSUER" env-default:"system-design-library"`
 }
 
 type Adapter struct {
-	cfg Config
+	cfg  Config
+	keys *KeySet
 }
 
+// New creates an adapter signing with the HMAC secret.
 func New(cfg Config) *Adapter {
 	return &Adapter{cfg: cfg}
 }
 
+// NewWithKeySet creates an adapter signing with the current key of keys and
+// verifying against every key it publishes.
+func NewWithKeySet(cfg Config, keys *KeySet) *Adapter {
+	return &Adapter{cfg: cfg, keys: keys}
+}
+
 // Verify implements auth.Verifier
 func (a *Adapter) Verify(ctx context.Context, tokenString string) (*auth.Claims, error) {
+	if a.keys == nil && a.cfg.Secret == "" {
+		return nil, errors.InvalidArgument("jwt secret is not configured", nil)
+	}
+
+	if a.keys != nil {
+		claims := jwt.MapClaims{}
+		if err := a.keys.Parse(ctx, tokenString, claims); err != nil {
+			return nil, err
+		}
+		return mapClaims(claims), nil
+	}
+
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, errors.InvalidArgument(fmt.Sprintf("unexpected signing method: %v", token.Header["alg"]), nil)
@@ -38,22 +60,7 @@ func (a *Adapter) Verify(ctx context.Context, tokenString string) (*auth.Claims,
 	}
 
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		// Map standard claims
-		c := &auth.Claims{}
-		if sub, ok := claims["sub"].(string); ok {
-			c.Subject = sub
-		}
-		if iss, ok := claims["iss"].(string); ok {
-			c.Issuer = iss
-		}
-		if role, ok := claims["role"].(string); ok {
-			c.Role = role
-		} else if roles, ok := claims["roles"].([]interface{}); ok && len(roles) > 0 {
-			// quick hack for array roles -> single role
-			c.Role = fmt.Sprintf("%v", roles[0])
-		}
-
-		return c, nil
+		return mapClaims(claims), nil
 	}
 
 	return nil, errors.New(errors.CodeUnauthenticated, "invalid token claims", nil)
@@ -68,6 +75,53 @@ func (a *Adapter) Generate(userID string, role string) (string, error) {
 		"exp":  time.Now().Add(a.cfg.Expiration).Unix(),
 		"iat":  time.Now().Unix(),
 	}
+
+	if a.keys != nil {
+		return a.keys.Sign(claims)
+	}
+
+	if a.cfg.Secret == "" {
+		return "", errors.InvalidArgument("jwt secret is not configured", nil)
+	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(a.cfg.Secret))
 }
+
+// verificationKey returns pub if the token is signed with alg, so a token
+// cannot pick a weaker algorithm than its key was published for.
+func verificationKey(token *jwt.Token, alg string, pub any) (any, error) {
+	if token.Method.Alg() != alg {
+		return nil, errors.InvalidArgument(fmt.Sprintf("unexpected signing method: %v", token.Header["alg"]), nil)
+	}
+	return pub, nil
+}
+
+// mapClaims maps standard claims.
+func mapClaims(claims jwt.MapClaims) *auth.Claims {
+	c := &auth.Claims{}
+	if sub, ok := claims["sub"].(string); ok {
+		c.Subject = sub
+	}
+	if iss, ok := claims["iss"].(string); ok {
+		c.Issuer = iss
+	}
+	if aud, err := claims.GetAudience(); err == nil {
+		c.Audience = aud
+	}
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		c.ExpiresAt = exp.Unix()
+	}
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		c.IssuedAt = iat.Unix()
+	}
+	if email, ok := claims["email"].(string); ok {
+		c.Email = email
+	}
+	if role, ok := claims["role"].(string); ok {
+		c.Role = role
+	} else if roles, ok := claims["roles"].([]interface{}); ok && len(roles) > 0 {
+		// quick hack for array roles -> single role
+		c.Role = fmt.Sprintf("%v", roles[0])
+	}
+	return c
+}
@@ -0,0 +1,209 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Asymmetric signing algorithms.
+const (
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+)
+
+// Key is an asymmetric signing key.
+type Key struct {
+	// ID is the RFC 7638 thumbprint of the public key, sent as the kid
+	// header of signed tokens.
+	ID        string
+	Algorithm string
+	Private   crypto.Signer
+	Created   time.Time
+
+	// Retired is when the key stopped signing. Retired keys stay in the
+	// JWKS for the overlap window so that tokens they signed still verify.
+	Retired time.Time
+}
+
+// GenerateKey creates a key for alg.
+func GenerateKey(alg string) (*Key, error) {
+	var priv crypto.Signer
+	var err error
+	switch alg {
+	case AlgRS256:
+		priv, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgES256:
+		priv, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, priv, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, errors.InvalidArgument("unsupported signing algorithm: "+alg, nil)
+	}
+	if err != nil {
+		return nil, errors.Internal("failed to generate signing key", err)
+	}
+	return NewKey(alg, priv, time.Now())
+}
+
+// NewKey wraps an existing private key. The key type must match alg.
+func NewKey(alg string, priv crypto.Signer, created time.Time) (*Key, error) {
+	jwk, err := publicJWK(alg, priv.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &Key{ID: jwk.Kid, Algorithm: alg, Private: priv, Created: created}, nil
+}
+
+// JWK returns the public half of the key.
+func (k *Key) JWK() JWK {
+	jwk, _ := publicJWK(k.Algorithm, k.Private.Public())
+	return jwk
+}
+
+// JWK is a public JSON Web Key (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// EC and OKP
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet is a JSON Web Key Set document.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+var b64 = base64.RawURLEncoding
+
+// publicJWK encodes pub as a JWK whose kid is its thumbprint.
+func publicJWK(alg string, pub crypto.PublicKey) (JWK, error) {
+	jwk := JWK{Use: "sig", Alg: alg}
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		if alg != AlgRS256 {
+			break
+		}
+		jwk.Kty = "RSA"
+		jwk.N = b64.EncodeToString(pub.N.Bytes())
+		jwk.E = b64.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		if alg != AlgES256 || pub.Curve != elliptic.P256() {
+			break
+		}
+		raw, err := pub.Bytes()
+		if err != nil {
+			return JWK{}, errors.InvalidArgument("invalid EC public key", err)
+		}
+		jwk.Kty, jwk.Crv = "EC", "P-256"
+		jwk.X = b64.EncodeToString(raw[1:33])
+		jwk.Y = b64.EncodeToString(raw[33:])
+	case ed25519.PublicKey:
+		if alg != AlgEdDSA {
+			break
+		}
+		jwk.Kty, jwk.Crv = "OKP", "Ed25519"
+		jwk.X = b64.EncodeToString(pub)
+	}
+	if jwk.Kty == "" {
+		return JWK{}, errors.InvalidArgument("key type does not match algorithm "+alg, nil)
+	}
+	jwk.Kid = thumbprint(jwk)
+	return jwk, nil
+}
+
+// thumbprint computes the RFC 7638 thumbprint of a JWK: the hash of its
+// required members in lexical order.
+func thumbprint(jwk JWK) string {
+	var members any
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+	raw, _ := json.Marshal(members)
+	sum := sha256.Sum256(raw)
+	return b64.EncodeToString(sum[:])
+}
+
+// PublicKey decodes the key for use in verification.
+func (j JWK) PublicKey() (crypto.PublicKey, error) {
+	invalid := errors.InvalidArgument("invalid JWK "+j.Kid, nil)
+	switch j.Kty {
+	case "RSA":
+		n, err1 := b64.DecodeString(j.N)
+		e, err2 := b64.DecodeString(j.E)
+		if err1 != nil || err2 != nil || len(e) == 0 || len(e) > 4 {
+			return nil, invalid
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		x, err1 := b64.DecodeString(j.X)
+		y, err2 := b64.DecodeString(j.Y)
+		if err1 != nil || err2 != nil || j.Crv != "P-256" || len(x) != 32 || len(y) != 32 {
+			return nil, invalid
+		}
+		pub, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), append(append([]byte{4}, x...), y...))
+		if err != nil {
+			return nil, invalid
+		}
+		return pub, nil
+	case "OKP":
+		x, err := b64.DecodeString(j.X)
+		if err != nil || j.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, invalid
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, invalid
+}
+
+// signingMethod returns the jwt signing method of an algorithm.
+func signingMethod(alg string) jwt.SigningMethod {
+	switch alg {
+	case AlgRS256:
+		return jwt.SigningMethodRS256
+	case AlgES256:
+		return jwt.SigningMethodES256
+	case AlgEdDSA:
+		return jwt.SigningMethodEdDSA
+	}
+	return nil
+}
@@ -0,0 +1,367 @@
+package jwt
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/concurrency/distlock"
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/sync/singleflight"
+)
+
+// JWKSPath is where the JWKS is conventionally published.
+const JWKSPath = "/.well-known/jwks.json"
+
+// JWKSMaxAge is how long clients may cache the published JWKS.
+const JWKSMaxAge = 5 * time.Minute
+
+// rotationLock is the distlock key serialising rotations.
+const rotationLock = "jwt-signing-keys/rotation"
+
+// rotationLockTTL bounds how long a crashed instance blocks rotations.
+const rotationLockTTL = 30 * time.Second
+
+// KeySetConfig configures a KeySet.
+type KeySetConfig struct {
+	// Algorithm is used for new keys: RS256, ES256 or EdDSA.
+	Algorithm string `env:"JWT_ALGORITHM" env-default:"RS256"`
+
+	// RotationInterval is how long a key signs before Run replaces it.
+	RotationInterval time.Duration `env:"JWT_ROTATION_INTERVAL" env-default:"720h"`
+
+	// Overlap is how long a retired key stays published. It should exceed
+	// the token lifetime plus JWKSMaxAge.
+	Overlap time.Duration `env:"JWT_KEY_OVERLAP" env-default:"48h"`
+
+	// RefreshInterval is how often Run reloads the stored keys to pick up
+	// rotations made by other instances.
+	RefreshInterval time.Duration `env:"JWT_KEY_REFRESH_INTERVAL" env-default:"5m"`
+
+	// MinRefreshInterval limits reloads for tokens with unknown key IDs.
+	MinRefreshInterval time.Duration `env:"JWT_KEY_MIN_REFRESH_INTERVAL" env-default:"1m"`
+
+	// Store persists the keys. Without it they live in memory only.
+	Store KeyStore
+
+	// Locker serialises rotations between instances sharing Store. Without
+	// it, instances rotating at the same time can overwrite each other's
+	// keys.
+	Locker distlock.Locker
+}
+
+// KeySet holds the signing key and the retired keys still accepted for
+// verification.
+type KeySet struct {
+	cfg   KeySetConfig
+	group singleflight.Group
+
+	mu        sync.RWMutex
+	keys      []*Key // oldest first; the last unretired key signs
+	refreshed time.Time
+}
+
+// NewKeySet loads the stored keys, generating a signing key if there is
+// none.
+func NewKeySet(ctx context.Context, cfg KeySetConfig) (*KeySet, error) {
+	if cfg.Algorithm == "" {
+		cfg.Algorithm = AlgRS256
+	}
+	if signingMethod(cfg.Algorithm) == nil {
+		return nil, errors.InvalidArgument("unsupported signing algorithm: "+cfg.Algorithm, nil)
+	}
+	if cfg.RotationInterval <= 0 {
+		cfg.RotationInterval = 30 * 24 * time.Hour
+	}
+	if cfg.Overlap <= 0 {
+		cfg.Overlap = 48 * time.Hour
+	}
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = 5 * time.Minute
+	}
+	if cfg.MinRefreshInterval <= 0 {
+		cfg.MinRefreshInterval = time.Minute
+	}
+
+	ks := &KeySet{cfg: cfg}
+	if err := ks.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	if ks.Current() == nil {
+		if _, err := ks.Rotate(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return ks, nil
+}
+
+// Current returns the signing key.
+func (ks *KeySet) Current() *Key {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return current(ks.keys)
+}
+
+// Key returns a published key by ID, reloading the stored keys if it is
+// unknown, at most once per MinRefreshInterval, in case another instance
+// has just rotated.
+func (ks *KeySet) Key(ctx context.Context, kid string) (*Key, bool) {
+	if k, ok := ks.find(kid); ok {
+		return k, true
+	}
+	if ks.cfg.Store == nil {
+		return nil, false
+	}
+	ks.mu.RLock()
+	age := time.Since(ks.refreshed)
+	ks.mu.RUnlock()
+	if age < ks.cfg.MinRefreshInterval {
+		return nil, false
+	}
+	if err := ks.Refresh(ctx); err != nil {
+		logger.L().WarnContext(ctx, "failed to refresh jwt signing keys", "error", err)
+		return nil, false
+	}
+	return ks.find(kid)
+}
+
+func (ks *KeySet) find(kid string) (*Key, bool) {
+	for _, k := range ks.Keys() {
+		if k.ID == kid {
+			return k, true
+		}
+	}
+	return nil, false
+}
+
+// Keys returns the published keys: the signing key and the keys retired
+// within the overlap window.
+func (ks *KeySet) Keys() []*Key {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.live(time.Now())
+}
+
+func (ks *KeySet) live(now time.Time) []*Key {
+	keys := make([]*Key, 0, len(ks.keys))
+	for _, k := range ks.keys {
+		if k.Retired.IsZero() || now.Before(k.Retired.Add(ks.cfg.Overlap)) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func current(keys []*Key) *Key {
+	for i := len(keys) - 1; i >= 0; i-- {
+		if keys[i].Retired.IsZero() {
+			return keys[i]
+		}
+	}
+	return nil
+}
+
+// Refresh reloads the keys from the store. Concurrent calls share one
+// load.
+func (ks *KeySet) Refresh(ctx context.Context) error {
+	_, err, _ := ks.group.Do("", func() (any, error) {
+		return nil, ks.load(ctx)
+	})
+	return err
+}
+
+func (ks *KeySet) load(ctx context.Context) error {
+	if ks.cfg.Store == nil {
+		return nil
+	}
+	ks.mu.Lock()
+	ks.refreshed = time.Now()
+	ks.mu.Unlock()
+
+	keys, err := ks.cfg.Store.Load(ctx)
+	if err != nil {
+		return err
+	}
+	slices.SortFunc(keys, func(a, b *Key) int { return a.Created.Compare(b.Created) })
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if len(keys) > 0 {
+		ks.keys = keys
+	}
+	return nil
+}
+
+// Rotate retires the signing key and replaces it with a new one.
+func (ks *KeySet) Rotate(ctx context.Context) (*Key, error) {
+	return ks.rotate(ctx, false)
+}
+
+// rotate replaces the signing key. When due is set it only does so if the
+// key is older than RotationInterval. The keys are reloaded under the
+// rotation lock before the check, so an instance that waited on another's
+// rotation builds on it rather than replacing it.
+func (ks *KeySet) rotate(ctx context.Context, due bool) (*Key, error) {
+	if err := ks.load(ctx); err != nil {
+		return nil, err
+	}
+	if due && !ks.due(time.Now()) {
+		return ks.Current(), nil
+	}
+
+	if ks.cfg.Locker != nil {
+		lock, err := ks.lock(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err := lock.Release(context.WithoutCancel(ctx)); err != nil {
+				logger.L().WarnContext(ctx, "failed to release jwt rotation lock", "error", err)
+			}
+		}()
+		if err := ks.load(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	now := time.Now()
+	cur := current(ks.keys)
+	if due && cur != nil && now.Before(cur.Created.Add(ks.cfg.RotationInterval)) {
+		return cur, nil
+	}
+
+	next, err := GenerateKey(ks.cfg.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	keys := ks.live(now)
+	for i, k := range keys {
+		if k.Retired.IsZero() {
+			retired := *k
+			retired.Retired = now
+			keys[i] = &retired
+		}
+	}
+	keys = append(keys, next)
+
+	if ks.cfg.Store != nil {
+		if err := ks.cfg.Store.Save(ctx, keys); err != nil {
+			return nil, err
+		}
+	}
+	ks.keys = keys
+	logger.L().InfoContext(ctx, "rotated jwt signing key", "kid", next.ID, "alg", next.Algorithm)
+	return next, nil
+}
+
+func (ks *KeySet) due(now time.Time) bool {
+	cur := ks.Current()
+	return cur == nil || !now.Before(cur.Created.Add(ks.cfg.RotationInterval))
+}
+
+// lock waits for the rotation lock.
+func (ks *KeySet) lock(ctx context.Context) (distlock.Lock, error) {
+	lock := ks.cfg.Locker.NewLock(rotationLock, rotationLockTTL)
+	for {
+		ok, err := lock.Acquire(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to acquire jwt rotation lock")
+		}
+		if ok {
+			return lock, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+// Run rotates the signing key every RotationInterval and reloads keys
+// rotated by other instances until ctx is cancelled. Failures are logged
+// and retried on the next tick.
+func (ks *KeySet) Run(ctx context.Context) error {
+	ticker := time.NewTicker(min(ks.cfg.RefreshInterval, ks.cfg.RotationInterval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if _, err := ks.rotate(ctx, true); err != nil {
+				logger.L().ErrorContext(ctx, "failed to rotate jwt signing key", "error", err)
+			}
+		}
+	}
+}
+
+// Sign signs claims with the current key, naming it in the kid header.
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	key := ks.Current()
+	token := jwt.NewWithClaims(signingMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+	signed, err := token.SignedString(key.Private)
+	if err != nil {
+		return "", errors.Internal("failed to sign token", err)
+	}
+	return signed, nil
+}
+
+// Parse verifies a token signed by one of the published keys, decoding
+// its claims into claims.
+func (ks *KeySet) Parse(ctx context.Context, tokenString string, claims jwt.Claims, opts ...jwt.ParserOption) error {
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := ks.Key(ctx, kid)
+		if !ok {
+			return nil, errors.Unauthorized("unknown signing key", nil)
+		}
+		return verificationKey(token, key.Algorithm, key.Private.Public())
+	}, opts...)
+	if err != nil {
+		return errors.Unauthorized("invalid token", err)
+	}
+	if !token.Valid {
+		return errors.New(errors.CodeUnauthenticated, "invalid token claims", nil)
+	}
+	return nil
+}
+
+// JWKS returns the public keys as a JSON Web Key Set.
+func (ks *KeySet) JWKS() JWKSet {
+	keys := ks.Keys()
+	set := JWKSet{Keys: make([]JWK, 0, len(keys))}
+	for _, k := range keys {
+		set.Keys = append(set.Keys, k.JWK())
+	}
+	return set
+}
+
+// Handler serves the JWKS, conventionally at JWKSPath.
+func (ks *KeySet) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := json.Marshal(ks.JWKS())
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/jwk-set+json")
+		w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(JWKSMaxAge.Seconds())))
+		_, _ = w.Write(body)
+	})
+}
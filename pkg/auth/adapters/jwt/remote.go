@@ -0,0 +1,200 @@
+package jwt
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/auth"
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/sync/singleflight"
+)
+
+// maxJWKSSize bounds the JWKS documents a RemoteVerifier reads.
+const maxJWKSSize = 1 << 20
+
+// RemoteConfig configures a RemoteVerifier.
+type RemoteConfig struct {
+	// JWKSURL is the issuer's JWKS, e.g. https://auth.example.com/.well-known/jwks.json.
+	JWKSURL string `env:"JWT_JWKS_URL" env-required:"true"`
+
+	// Issuer and Audience, if set, must match the token's iss and aud.
+	Issuer   string `env:"JWT_EXPECTED_ISSUER"`
+	Audience string `env:"JWT_EXPECTED_AUDIENCE"`
+
+	// RefreshInterval is how long fetched keys are used before refetching.
+	RefreshInterval time.Duration `env:"JWT_JWKS_REFRESH_INTERVAL" env-default:"1h"`
+
+	// MinRefreshInterval limits refetches for tokens with unknown key IDs.
+	MinRefreshInterval time.Duration `env:"JWT_JWKS_MIN_REFRESH_INTERVAL" env-default:"1m"`
+
+	// Leeway tolerates clock skew when checking exp, nbf and iat.
+	Leeway time.Duration `env:"JWT_LEEWAY" env-default:"30s"`
+
+	// Client fetches the JWKS. Defaults to a client with a 10s timeout.
+	Client *http.Client
+}
+
+// publicKey is a verification key fetched from a JWKS.
+type publicKey struct {
+	alg string
+	key any
+}
+
+// RemoteVerifier verifies tokens signed by keys published in a remote
+// JWKS, so services can verify without holding signing secrets. Keys are
+// cached and refetched when they expire or a token names an unknown key.
+type RemoteVerifier struct {
+	cfg   RemoteConfig
+	group singleflight.Group
+
+	mu      sync.RWMutex
+	keys    map[string]publicKey
+	fetched time.Time
+}
+
+var _ auth.Verifier = (*RemoteVerifier)(nil)
+
+// NewRemoteVerifier creates a RemoteVerifier. Keys are fetched on first use.
+func NewRemoteVerifier(cfg RemoteConfig) *RemoteVerifier {
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = time.Hour
+	}
+	if cfg.MinRefreshInterval <= 0 {
+		cfg.MinRefreshInterval = time.Minute
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &RemoteVerifier{cfg: cfg}
+}
+
+// Verify implements auth.Verifier
+func (v *RemoteVerifier) Verify(ctx context.Context, tokenString string) (*auth.Claims, error) {
+	opts := []jwt.ParserOption{jwt.WithLeeway(v.cfg.Leeway), jwt.WithExpirationRequired()}
+	if v.cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(v.cfg.Issuer))
+	}
+	if v.cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(v.cfg.Audience))
+	}
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := v.key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		return verificationKey(token, key.alg, key.key)
+	}, opts...)
+	if err != nil {
+		return nil, errors.Unauthorized("invalid token", err)
+	}
+
+	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+		return mapClaims(claims), nil
+	}
+	return nil, errors.New(errors.CodeUnauthenticated, "invalid token claims", nil)
+}
+
+// key returns the key kid, refetching the JWKS if the cached keys have
+// expired or do not include it.
+func (v *RemoteVerifier) key(ctx context.Context, kid string) (publicKey, error) {
+	v.mu.RLock()
+	key, ok := v.keys[kid]
+	age := time.Since(v.fetched)
+	stale := v.keys == nil || age >= v.cfg.RefreshInterval
+	v.mu.RUnlock()
+
+	if stale || (!ok && age >= v.cfg.MinRefreshInterval) {
+		if err := v.Refresh(ctx); err != nil {
+			if !ok {
+				return publicKey{}, err
+			}
+			// Keep verifying with the cached key while the issuer is down.
+			logger.L().WarnContext(ctx, "failed to refresh jwks", "error", err)
+		}
+		v.mu.RLock()
+		key, ok = v.keys[kid]
+		v.mu.RUnlock()
+	}
+	if !ok {
+		return publicKey{}, errors.Unauthorized("unknown signing key", nil)
+	}
+	return key, nil
+}
+
+// Refresh fetches the JWKS. Concurrent calls share one request.
+func (v *RemoteVerifier) Refresh(ctx context.Context) error {
+	_, err, _ := v.group.Do("", func() (any, error) {
+		keys, err := v.fetch(ctx)
+		if err != nil {
+			return nil, err
+		}
+		v.mu.Lock()
+		v.keys = keys
+		v.fetched = time.Now()
+		v.mu.Unlock()
+		return nil, nil
+	})
+	return err
+}
+
+func (v *RemoteVerifier) fetch(ctx context.Context) (map[string]publicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.cfg.JWKSURL, nil)
+	if err != nil {
+		return nil, errors.InvalidArgument("invalid jwks url", err)
+	}
+	resp, err := v.cfg.Client.Do(req)
+	if err != nil {
+		return nil, errors.Internal("failed to fetch jwks", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Internal("failed to fetch jwks: "+resp.Status, nil)
+	}
+
+	var set JWKSet
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxJWKSSize)).Decode(&set); err != nil {
+		return nil, errors.Internal("invalid jwks", err)
+	}
+
+	keys := make(map[string]publicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		alg := jwk.Alg
+		if alg == "" {
+			alg = defaultAlg(jwk)
+		}
+		if signingMethod(alg) == nil {
+			continue
+		}
+		pub, err := jwk.PublicKey()
+		if err != nil {
+			logger.L().WarnContext(ctx, "skipping invalid jwk", "kid", jwk.Kid, "error", err)
+			continue
+		}
+		keys[jwk.Kid] = publicKey{alg: alg, key: pub}
+	}
+	return keys, nil
+}
+
+// defaultAlg infers the algorithm of a JWK published without one.
+func defaultAlg(jwk JWK) string {
+	switch {
+	case jwk.Kty == "RSA":
+		return AlgRS256
+	case jwk.Kty == "EC" && jwk.Crv == "P-256":
+		return AlgES256
+	case jwk.Kty == "OKP" && jwk.Crv == "Ed25519":
+		return AlgEdDSA
+	}
+	return ""
+}
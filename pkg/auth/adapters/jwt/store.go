@@ -0,0 +1,132 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/chris-alexander-pop/system-design-library/pkg/security/crypto/kms"
+	"github.com/chris-alexander-pop/system-design-library/pkg/security/secrets"
+)
+
+// KeyStore persists a key set so that every instance signs and publishes
+// the same keys.
+type KeyStore interface {
+	// Load returns the stored keys, or none if nothing is stored yet.
+	Load(ctx context.Context) ([]*Key, error)
+	Save(ctx context.Context, keys []*Key) error
+}
+
+// SecretStoreConfig configures a SecretStore.
+type SecretStoreConfig struct {
+	// Name is the secret holding the key set.
+	Name string `env:"JWT_KEYS_SECRET" env-default:"jwt-signing-keys"`
+
+	// KMSKeyID is the KMS key that encrypts the private keys.
+	KMSKeyID string `env:"JWT_KMS_KEY_ID"`
+
+	// Secrets stores the key set.
+	Secrets secrets.SecretManager
+
+	// KMS, if set, encrypts the private keys before they are stored.
+	KMS kms.KeyManager
+}
+
+// SecretStore is a KeyStore keeping the key set as a JSON secret, with
+// the private keys optionally encrypted by a KMS.
+type SecretStore struct {
+	cfg SecretStoreConfig
+}
+
+var _ KeyStore = (*SecretStore)(nil)
+
+// NewSecretStore creates a SecretStore.
+func NewSecretStore(cfg SecretStoreConfig) *SecretStore {
+	if cfg.Name == "" {
+		cfg.Name = "jwt-signing-keys"
+	}
+	return &SecretStore{cfg: cfg}
+}
+
+// storedKey is the stored form of a Key.
+type storedKey struct {
+	ID        string    `json:"kid"`
+	Algorithm string    `json:"alg"`
+	Private   []byte    `json:"key"` // PKCS #8, KMS encrypted if configured
+	Created   time.Time `json:"created"`
+	Retired   time.Time `json:"retired,omitzero"`
+}
+
+func (s *SecretStore) Load(ctx context.Context) ([]*Key, error) {
+	raw, err := s.cfg.Secrets.Get(ctx, s.cfg.Name)
+	if err != nil {
+		var appErr *errors.AppError
+		if errors.As(err, &appErr) && appErr.Code == errors.CodeNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to read signing keys")
+	}
+
+	var stored []storedKey
+	if err := json.Unmarshal([]byte(raw), &stored); err != nil {
+		return nil, errors.Internal("invalid stored signing keys", err)
+	}
+	keys := make([]*Key, 0, len(stored))
+	for _, sk := range stored {
+		der := sk.Private
+		if s.cfg.KMS != nil {
+			if der, err = s.cfg.KMS.Decrypt(ctx, s.cfg.KMSKeyID, der); err != nil {
+				return nil, errors.Wrap(err, "failed to decrypt signing key "+sk.ID)
+			}
+		}
+		priv, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			return nil, errors.Internal("invalid stored signing key "+sk.ID, err)
+		}
+		signer, ok := priv.(crypto.Signer)
+		if !ok {
+			return nil, errors.Internal("invalid stored signing key "+sk.ID, nil)
+		}
+		key, err := NewKey(sk.Algorithm, signer, sk.Created)
+		if err != nil {
+			return nil, err
+		}
+		key.Retired = sk.Retired
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (s *SecretStore) Save(ctx context.Context, keys []*Key) error {
+	stored := make([]storedKey, 0, len(keys))
+	for _, k := range keys {
+		der, err := x509.MarshalPKCS8PrivateKey(k.Private)
+		if err != nil {
+			return errors.Internal("failed to encode signing key "+k.ID, err)
+		}
+		if s.cfg.KMS != nil {
+			if der, err = s.cfg.KMS.Encrypt(ctx, s.cfg.KMSKeyID, der); err != nil {
+				return errors.Wrap(err, "failed to encrypt signing key "+k.ID)
+			}
+		}
+		stored = append(stored, storedKey{
+			ID:        k.ID,
+			Algorithm: k.Algorithm,
+			Private:   der,
+			Created:   k.Created,
+			Retired:   k.Retired,
+		})
+	}
+
+	raw, err := json.Marshal(stored)
+	if err != nil {
+		return errors.Internal("failed to encode signing keys", err)
+	}
+	if err := s.cfg.Secrets.Set(ctx, s.cfg.Name, string(raw)); err != nil {
+		return errors.Wrap(err, "failed to store signing keys")
+	}
+	return nil
+}
@@ -0,0 +1,342 @@
+package jwt_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/auth/adapters/jwt"
+	distlockmemory "github.com/chris-alexander-pop/system-design-library/pkg/concurrency/distlock/adapters/memory"
+	kmsmemory "github.com/chris-alexander-pop/system-design-library/pkg/security/crypto/kms/adapters/memory"
+	secretsmemory "github.com/chris-alexander-pop/system-design-library/pkg/security/secrets/adapters/memory"
+	gojwt "github.com/golang-jwt/jwt/v5"
+)
+
+var cfg = jwt.Config{Expiration: time.Hour, Issuer: "test-issuer"}
+
+func header(t *testing.T, token string) map[string]any {
+	t.Helper()
+	parts := strings.Split(token, ".")
+	raw, err := gojwt.NewParser().DecodeSegment(parts[0])
+	if err != nil {
+		t.Fatalf("DecodeSegment failed: %v", err)
+	}
+	var h map[string]any
+	if err := json.Unmarshal(raw, &h); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	return h
+}
+
+func TestKeySetAlgorithms(t *testing.T) {
+	ctx := context.Background()
+	for _, alg := range []string{jwt.AlgRS256, jwt.AlgES256, jwt.AlgEdDSA} {
+		keys, err := jwt.NewKeySet(ctx, jwt.KeySetConfig{Algorithm: alg})
+		if err != nil {
+			t.Fatalf("%s: NewKeySet failed: %v", alg, err)
+		}
+		adapter := jwt.NewWithKeySet(cfg, keys)
+
+		token, err := adapter.Generate("user-123", "admin")
+		if err != nil {
+			t.Fatalf("%s: Generate failed: %v", alg, err)
+		}
+		h := header(t, token)
+		if h["alg"] != alg || h["kid"] != keys.Current().ID {
+			t.Errorf("%s: header = %v", alg, h)
+		}
+
+		claims, err := adapter.Verify(ctx, token)
+		if err != nil {
+			t.Fatalf("%s: Verify failed: %v", alg, err)
+		}
+		if claims.Subject != "user-123" || claims.Role != "admin" || claims.Issuer != "test-issuer" || claims.ExpiresAt == 0 {
+			t.Errorf("%s: claims = %+v", alg, claims)
+		}
+
+		// An HMAC token cannot pass for one signed by the key set.
+		hmac, _ := jwt.New(jwt.Config{Secret: "secret", Expiration: time.Hour}).Generate("user-123", "admin")
+		if _, err := adapter.Verify(ctx, hmac); err == nil {
+			t.Errorf("%s: HMAC token accepted", alg)
+		}
+	}
+
+	if _, err := jwt.NewKeySet(ctx, jwt.KeySetConfig{Algorithm: "HS256"}); err == nil {
+		t.Error("NewKeySet accepted HS256")
+	}
+	if _, err := jwt.New(jwt.Config{}).Generate("user-123", "admin"); err == nil {
+		t.Error("Generate signed without a secret")
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	ctx := context.Background()
+	keys, err := jwt.NewKeySet(ctx, jwt.KeySetConfig{Algorithm: jwt.AlgES256, Overlap: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewKeySet failed: %v", err)
+	}
+	adapter := jwt.NewWithKeySet(cfg, keys)
+	old, _ := adapter.Generate("user-123", "admin")
+	oldKey := keys.Current()
+
+	next, err := keys.Rotate(ctx)
+	if err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if next.ID == oldKey.ID || keys.Current().ID != next.ID {
+		t.Fatal("Rotate did not replace the signing key")
+	}
+	if set := keys.JWKS(); len(set.Keys) != 2 {
+		t.Errorf("JWKS has %d keys during overlap, want 2", len(set.Keys))
+	}
+	if _, err := adapter.Verify(ctx, old); err != nil {
+		t.Errorf("token from retired key rejected during overlap: %v", err)
+	}
+	fresh, _ := adapter.Generate("user-123", "admin")
+	if header(t, fresh)["kid"] != next.ID {
+		t.Error("new token not signed with the new key")
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if set := keys.JWKS(); len(set.Keys) != 1 || set.Keys[0].Kid != next.ID {
+		t.Errorf("JWKS after overlap = %+v", set)
+	}
+	if _, err := adapter.Verify(ctx, old); err == nil {
+		t.Error("token from expired key accepted")
+	}
+}
+
+func TestKeySetSecretStore(t *testing.T) {
+	ctx := context.Background()
+	km, err := kmsmemory.New("")
+	if err != nil {
+		t.Fatalf("kms New failed: %v", err)
+	}
+	sm := secretsmemory.New()
+	store := jwt.NewSecretStore(jwt.SecretStoreConfig{Secrets: sm, KMS: km, KMSKeyID: "jwt"})
+
+	a, err := jwt.NewKeySet(ctx, jwt.KeySetConfig{Algorithm: jwt.AlgRS256, Store: store})
+	if err != nil {
+		t.Fatalf("NewKeySet failed: %v", err)
+	}
+	b, err := jwt.NewKeySet(ctx, jwt.KeySetConfig{Algorithm: jwt.AlgRS256, Store: store})
+	if err != nil {
+		t.Fatalf("NewKeySet failed: %v", err)
+	}
+	if a.Current().ID != b.Current().ID {
+		t.Fatal("instances sharing a store sign with different keys")
+	}
+
+	raw, _ := sm.Get(ctx, "jwt-signing-keys")
+	if strings.Contains(raw, "PRIVATE KEY") || !strings.Contains(raw, a.Current().ID) {
+		t.Errorf("unexpected stored key set: %s", raw)
+	}
+
+	token, _ := jwt.NewWithKeySet(cfg, a).Generate("user-123", "admin")
+	if _, err := a.Rotate(ctx); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if err := b.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if a.Current().ID != b.Current().ID {
+		t.Error("Refresh did not pick up the rotated key")
+	}
+	if _, err := jwt.NewWithKeySet(cfg, b).Verify(ctx, token); err != nil {
+		t.Errorf("token from retired key rejected by another instance: %v", err)
+	}
+}
+
+// slowStore counts loads from the wrapped store and delays saves, so
+// concurrent rotations overlap.
+type slowStore struct {
+	jwt.KeyStore
+	loads atomic.Int32
+}
+
+func (s *slowStore) Load(ctx context.Context) ([]*jwt.Key, error) {
+	s.loads.Add(1)
+	return s.KeyStore.Load(ctx)
+}
+
+func (s *slowStore) Save(ctx context.Context, keys []*jwt.Key) error {
+	time.Sleep(10 * time.Millisecond)
+	return s.KeyStore.Save(ctx, keys)
+}
+
+func TestKeySetConcurrentRotations(t *testing.T) {
+	ctx := context.Background()
+	store := &slowStore{KeyStore: jwt.NewSecretStore(jwt.SecretStoreConfig{Secrets: secretsmemory.New()})}
+	locker := distlockmemory.New()
+
+	instances := make([]*jwt.KeySet, 4)
+	for i := range instances {
+		ks, err := jwt.NewKeySet(ctx, jwt.KeySetConfig{Algorithm: jwt.AlgES256, Store: store, Locker: locker})
+		if err != nil {
+			t.Fatalf("NewKeySet failed: %v", err)
+		}
+		instances[i] = ks
+	}
+
+	var wg sync.WaitGroup
+	for _, ks := range instances {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := ks.Rotate(ctx); err != nil {
+				t.Errorf("Rotate failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := instances[0].Refresh(ctx); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if n := len(instances[0].JWKS().Keys); n != len(instances)+1 {
+		t.Errorf("JWKS has %d keys after %d rotations, want %d", n, len(instances), len(instances)+1)
+	}
+}
+
+func TestKeySetReloadsUnknownKeys(t *testing.T) {
+	ctx := context.Background()
+	store := &slowStore{KeyStore: jwt.NewSecretStore(jwt.SecretStoreConfig{Secrets: secretsmemory.New()})}
+	a, err := jwt.NewKeySet(ctx, jwt.KeySetConfig{Algorithm: jwt.AlgES256, Store: store})
+	if err != nil {
+		t.Fatalf("NewKeySet failed: %v", err)
+	}
+	b, err := jwt.NewKeySet(ctx, jwt.KeySetConfig{Algorithm: jwt.AlgES256, Store: store, MinRefreshInterval: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewKeySet failed: %v", err)
+	}
+
+	// A token signed right after another instance rotates verifies without
+	// waiting for the next scheduled refresh.
+	time.Sleep(60 * time.Millisecond)
+	if _, err := a.Rotate(ctx); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	token, _ := jwt.NewWithKeySet(cfg, a).Generate("user-123", "admin")
+	if _, err := jwt.NewWithKeySet(cfg, b).Verify(ctx, token); err != nil {
+		t.Fatalf("token from rotated key rejected: %v", err)
+	}
+
+	// Unknown key IDs do not reload more often than MinRefreshInterval.
+	loads := store.loads.Load()
+	other, _ := jwt.NewKeySet(ctx, jwt.KeySetConfig{Algorithm: jwt.AlgES256})
+	forged, _ := jwt.NewWithKeySet(cfg, other).Generate("user-123", "admin")
+	for range 5 {
+		if _, err := jwt.NewWithKeySet(cfg, b).Verify(ctx, forged); err == nil {
+			t.Fatal("token from unpublished key accepted")
+		}
+	}
+	if n := store.loads.Load() - loads; n != 0 {
+		t.Errorf("%d loads for unknown keys, want 0", n)
+	}
+}
+
+func TestJWKSHandler(t *testing.T) {
+	keys, err := jwt.NewKeySet(context.Background(), jwt.KeySetConfig{Algorithm: jwt.AlgEdDSA})
+	if err != nil {
+		t.Fatalf("NewKeySet failed: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	keys.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, jwt.JWKSPath, nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/jwk-set+json" || rec.Header().Get("Cache-Control") == "" {
+		t.Fatalf("response = %d %v", rec.Code, rec.Header())
+	}
+	var set jwt.JWKSet
+	if err := json.Unmarshal(rec.Body.Bytes(), &set); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if len(set.Keys) != 1 {
+		t.Fatalf("JWKS = %+v", set)
+	}
+	k := set.Keys[0]
+	if k.Kid != keys.Current().ID || k.Kty != "OKP" || k.Crv != "Ed25519" || k.Alg != jwt.AlgEdDSA || k.Use != "sig" || k.X == "" {
+		t.Errorf("JWK = %+v", k)
+	}
+	if strings.Contains(rec.Body.String(), `"d"`) {
+		t.Error("JWKS exposes private key material")
+	}
+
+	rec = httptest.NewRecorder()
+	keys.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, jwt.JWKSPath, nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST = %d", rec.Code)
+	}
+}
+
+func TestRemoteVerifier(t *testing.T) {
+	ctx := context.Background()
+	keys, err := jwt.NewKeySet(ctx, jwt.KeySetConfig{Algorithm: jwt.AlgES256})
+	if err != nil {
+		t.Fatalf("NewKeySet failed: %v", err)
+	}
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		keys.Handler().ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	issuer := jwt.NewWithKeySet(cfg, keys)
+	verifier := jwt.NewRemoteVerifier(jwt.RemoteConfig{
+		JWKSURL:            srv.URL + jwt.JWKSPath,
+		Issuer:             "test-issuer",
+		MinRefreshInterval: 50 * time.Millisecond,
+	})
+
+	token, _ := issuer.Generate("user-123", "admin")
+	claims, err := verifier.Verify(ctx, token)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if claims.Subject != "user-123" || claims.Role != "admin" {
+		t.Errorf("claims = %+v", claims)
+	}
+	if _, err := verifier.Verify(ctx, token); err != nil || fetches.Load() != 1 {
+		t.Errorf("second Verify: err %v, %d fetches", err, fetches.Load())
+	}
+
+	// A token from a key published after the last fetch triggers a refetch.
+	time.Sleep(60 * time.Millisecond)
+	if _, err := keys.Rotate(ctx); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	rotated, _ := issuer.Generate("user-123", "admin")
+	if _, err := verifier.Verify(ctx, rotated); err != nil {
+		t.Fatalf("Verify after rotation failed: %v", err)
+	}
+	if fetches.Load() != 2 {
+		t.Errorf("%d fetches after rotation, want 2", fetches.Load())
+	}
+
+	// Unknown key IDs do not refetch more often than MinRefreshInterval.
+	other, _ := jwt.NewKeySet(ctx, jwt.KeySetConfig{Algorithm: jwt.AlgES256})
+	forged, _ := jwt.NewWithKeySet(cfg, other).Generate("user-123", "admin")
+	for range 5 {
+		if _, err := verifier.Verify(ctx, forged); err == nil {
+			t.Fatal("token from unpublished key accepted")
+		}
+	}
+	if fetches.Load() != 2 {
+		t.Errorf("%d fetches for unknown keys, want 2", fetches.Load())
+	}
+
+	wrongIssuer, _ := jwt.NewWithKeySet(jwt.Config{Expiration: time.Hour, Issuer: "other"}, keys).Generate("user-123", "admin")
+	if _, err := verifier.Verify(ctx, wrongIssuer); err == nil {
+		t.Error("token from another issuer accepted")
+	}
+	expired, _ := jwt.NewWithKeySet(jwt.Config{Expiration: -time.Hour, Issuer: "test-issuer"}, keys).Generate("user-123", "admin")
+	if _, err := verifier.Verify(ctx, expired); err == nil {
+		t.Error("expired token accepted")
+	}
+}
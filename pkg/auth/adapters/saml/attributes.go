@@ -0,0 +1,120 @@
+package saml
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/auth"
+	crewjam "github.com/crewjam/saml"
+)
+
+// Attribute names commonly used by IdPs.
+const (
+	AttributeMail                 = "urn:oid:0.9.2342.19200300.100.1.3"
+	AttributeEduPersonAffiliation = "urn:oid:1.3.6.1.4.1.5923.1.1.1.1"
+	AttributeClaimsEmail          = "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress"
+	AttributeClaimsRole           = "http://schemas.microsoft.com/ws/2008/06/identity/claims/role"
+	AttributeClaimsGroups         = "http://schemas.microsoft.com/ws/2008/06/identity/claims/groups"
+)
+
+// AttributeMapping maps assertion attributes to claims. Attributes are
+// matched by Name or FriendlyName; the first candidate present wins.
+type AttributeMapping struct {
+	// Email lists candidate attributes for Claims.Email. If none is
+	// present, an email-address NameID is used.
+	Email []string
+
+	// Role lists candidate attributes for Claims.Role. A multi-valued
+	// attribute yields its first value as the role; all values are kept
+	// under the "roles" metadata key.
+	Role []string
+
+	// Metadata maps attribute names to Claims.Metadata keys. Single values
+	// are stored as strings, multiple values as []string.
+	Metadata map[string]string
+}
+
+func (m AttributeMapping) withDefaults() AttributeMapping {
+	if len(m.Email) == 0 {
+		m.Email = []string{AttributeMail, AttributeClaimsEmail, "email", "mail"}
+	}
+	if len(m.Role) == 0 {
+		m.Role = []string{AttributeClaimsRole, "role", "roles", AttributeClaimsGroups, "groups", AttributeEduPersonAffiliation}
+	}
+	return m
+}
+
+// claims maps a validated assertion to claims for the tenant.
+func (t *tenant) claims(a *crewjam.Assertion) (*auth.Claims, *sessionData) {
+	attrs := make(map[string][]string)
+	for _, stmt := range a.AttributeStatements {
+		for _, attr := range stmt.Attributes {
+			var values []string
+			for _, v := range attr.Values {
+				if v := strings.TrimSpace(v.Value); v != "" {
+					values = append(values, v)
+				}
+			}
+			for _, name := range []string{attr.Name, attr.FriendlyName} {
+				if name != "" {
+					attrs[name] = append(attrs[name], values...)
+				}
+			}
+		}
+	}
+	lookup := func(names []string) []string {
+		for _, name := range names {
+			if values := attrs[name]; len(values) > 0 {
+				return values
+			}
+		}
+		return nil
+	}
+
+	data := &sessionData{Tenant: t.ID, Metadata: map[string]interface{}{"tenant": t.ID}}
+	if a.Subject != nil && a.Subject.NameID != nil {
+		data.NameID = a.Subject.NameID.Value
+		data.NameIDFormat = a.Subject.NameID.Format
+	}
+	for _, stmt := range a.AuthnStatements {
+		if stmt.SessionIndex != "" {
+			data.SessionIndex = stmt.SessionIndex
+			data.Metadata["session_index"] = stmt.SessionIndex
+			break
+		}
+	}
+
+	claims := &auth.Claims{
+		Subject:  data.NameID,
+		Issuer:   a.Issuer.Value,
+		Audience: []string{t.EntityID},
+		IssuedAt: a.IssueInstant.Unix(),
+	}
+	for _, stmt := range a.AuthnStatements {
+		// The assertion's own conditions bound only its delivery; the IdP
+		// bounds the login with SessionNotOnOrAfter.
+		if stmt.SessionNotOnOrAfter != nil {
+			claims.ExpiresAt = stmt.SessionNotOnOrAfter.Unix()
+		}
+	}
+	if email := lookup(t.Attributes.Email); len(email) > 0 {
+		claims.Email = email[0]
+	} else if data.NameIDFormat == string(crewjam.EmailAddressNameIDFormat) {
+		claims.Email = data.NameID
+	}
+	if roles := lookup(t.Attributes.Role); len(roles) > 0 {
+		claims.Role = roles[0]
+		data.Metadata["roles"] = slices.Clone(roles)
+	}
+	for name, key := range t.Attributes.Metadata {
+		switch values := attrs[name]; len(values) {
+		case 0:
+		case 1:
+			data.Metadata[key] = values[0]
+		default:
+			data.Metadata[key] = slices.Clone(values)
+		}
+	}
+	data.Claims = *claims
+	return claims, data
+}
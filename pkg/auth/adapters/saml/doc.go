@@ -0,0 +1,26 @@
+// Package saml provides a multi-tenant SAML 2.0 service provider for
+// enterprise single sign-on.
+//
+// Each tenant signs in through its own identity provider, registered from
+// its metadata with AddTenant. The SP publishes per-tenant metadata, sends
+// AuthnRequests over the HTTP-Redirect or HTTP-POST binding, validates the
+// signatures, audience, timing and InResponseTo of the assertions it
+// receives, and maps their attributes to auth.Claims. Signed-in users get a
+// session from a session.Manager, and single logout is supported in both
+// directions.
+//
+// Usage:
+//
+//	sp, err := saml.New(saml.Config{
+//		BaseURL:     "https://app.example.com/saml",
+//		Key:         key,
+//		Certificate: cert,
+//		Sessions:    sessions,
+//	})
+//	err = sp.AddTenant(ctx, saml.Tenant{ID: "acme", MetadataURL: "https://idp.acme.com/metadata"})
+//	mux.Handle("/saml/", http.StripPrefix("/saml", sp.Handler()))
+//
+// Users sign in at /saml/acme/login?return_to=/dashboard, and handlers
+// read their claims with sp.Claims(r). The samltest package provides an
+// in-process IdP for testing.
+package saml
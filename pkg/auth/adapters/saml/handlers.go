@@ -0,0 +1,284 @@
+package saml
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/auth/session"
+	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+	crewjam "github.com/crewjam/saml"
+)
+
+// trackingCookiePrefix prefixes the cookies tracking pending AuthnRequests,
+// one per relay state, so that concurrent logins do not clobber each other.
+const trackingCookiePrefix = "saml_"
+
+// trackedRequest is an AuthnRequest awaiting its response.
+type trackedRequest struct {
+	ID       string    `json:"id"`
+	Tenant   string    `json:"tenant"`
+	ReturnTo string    `json:"return_to"`
+	Expires  time.Time `json:"exp"`
+}
+
+// handleMetadata serves the SP metadata for a tenant's IdP.
+func (s *SP) handleMetadata(w http.ResponseWriter, r *http.Request) {
+	md, err := s.Metadata(r.PathValue("tenant"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	_, _ = w.Write(md)
+}
+
+// handleLogin sends the user to the tenant's IdP with an AuthnRequest,
+// remembering the request and return path in a tracking cookie.
+func (s *SP) handleLogin(w http.ResponseWriter, r *http.Request) {
+	t, ok := s.requestTenant(w, r)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+
+	binding, location := t.ssoLocation(s.cfg.RequestBinding)
+	if location == "" {
+		logger.L().ErrorContext(ctx, "IdP has no single sign-on endpoint", "tenant", t.ID)
+		http.Error(w, "Identity provider does not support sign-on.", http.StatusBadGateway)
+		return
+	}
+	req, err := t.sp.MakeAuthenticationRequest(location, binding, crewjam.HTTPPostBinding)
+	if err != nil {
+		logger.L().ErrorContext(ctx, "failed to create authentication request", "tenant", t.ID, "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	relayState := randomToken()
+	s.setTrackingCookie(w, relayState, trackedRequest{
+		ID:       req.ID,
+		Tenant:   t.ID,
+		ReturnTo: s.returnPath(r.URL.Query().Get("return_to")),
+		Expires:  time.Now().Add(s.cfg.RequestTTL),
+	})
+
+	if binding == crewjam.HTTPPostBinding {
+		writePostForm(w, req.Post(relayState))
+		return
+	}
+	u, err := req.Redirect(relayState, t.sp)
+	if err != nil {
+		logger.L().ErrorContext(ctx, "failed to sign authentication request", "tenant", t.ID, "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+// handleACS consumes a response from the IdP: it validates the assertion,
+// signs the user in with a new session and returns them where they
+// started.
+func (s *SP) handleACS(w http.ResponseWriter, r *http.Request) {
+	t, ok := s.requestTenant(w, r)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Malformed request.", http.StatusBadRequest)
+		return
+	}
+
+	var requestIDs []string
+	returnTo := s.cfg.DefaultRedirect
+	relayState := r.PostForm.Get("RelayState")
+	if tracked, ok := s.trackingCookie(r, relayState); ok && tracked.Tenant == t.ID {
+		requestIDs = []string{tracked.ID}
+		returnTo = tracked.ReturnTo
+		s.clearCookie(w, trackingCookiePrefix+relayState, s.cookiePath())
+	}
+
+	assertion, err := t.sp.ParseResponse(r, requestIDs)
+	if err != nil {
+		detail := err
+		if invalid, ok := err.(*crewjam.InvalidResponseError); ok && invalid.PrivateErr != nil {
+			detail = invalid.PrivateErr
+		}
+		logger.L().WarnContext(ctx, "rejected SAML response", "tenant", t.ID, "error", detail)
+		http.Error(w, "Sign-in failed.", http.StatusForbidden)
+		return
+	}
+
+	now := time.Now()
+	expires := now.Add(crewjam.MaxIssueDelay + crewjam.MaxClockSkew)
+	if assertion.Conditions != nil && !assertion.Conditions.NotOnOrAfter.IsZero() {
+		expires = assertion.Conditions.NotOnOrAfter.Add(crewjam.MaxClockSkew)
+	}
+	if !s.replay.add(assertion.ID, expires, now) {
+		logger.L().WarnContext(ctx, "replayed SAML assertion", "tenant", t.ID, "assertion_id", assertion.ID)
+		http.Error(w, "Sign-in failed.", http.StatusForbidden)
+		return
+	}
+
+	_, data := t.claims(assertion)
+	if data.NameID == "" {
+		logger.L().WarnContext(ctx, "SAML assertion has no NameID", "tenant", t.ID)
+		http.Error(w, "Sign-in failed.", http.StatusForbidden)
+		return
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		logger.L().ErrorContext(ctx, "failed to encode SAML session", "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	sess, err := s.cfg.Sessions.Create(session.WithClient(ctx, session.ClientFromRequest(r)),
+		SessionUserID(t.ID, data.NameID), map[string]interface{}{sessionKey: string(raw)})
+	if err != nil {
+		logger.L().ErrorContext(ctx, "failed to create session", "tenant", t.ID, "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.cfg.SessionCookie,
+		Value:    sess.ID,
+		Path:     "/",
+		Expires:  sess.ExpiresAt,
+		HttpOnly: true,
+		Secure:   s.secure(),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, returnTo, http.StatusSeeOther)
+}
+
+// requestTenant returns the tenant named by the request path, responding
+// 404 if there is none.
+func (s *SP) requestTenant(w http.ResponseWriter, r *http.Request) (*tenant, bool) {
+	t, err := s.tenant(r.PathValue("tenant"))
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	return t, true
+}
+
+// ssoLocation returns the IdP's sign-on endpoint for the preferred binding,
+// falling back to the other one.
+func (t *tenant) ssoLocation(preferred string) (string, string) {
+	bindings := []string{crewjam.HTTPRedirectBinding, crewjam.HTTPPostBinding}
+	if preferred == BindingPOST {
+		bindings[0], bindings[1] = bindings[1], bindings[0]
+	}
+	for _, binding := range bindings {
+		if location := t.sp.GetSSOBindingLocation(binding); location != "" {
+			return binding, location
+		}
+	}
+	return "", ""
+}
+
+// returnPath accepts only local paths as return destinations, so the SP
+// cannot be used as an open redirect.
+func (s *SP) returnPath(p string) string {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.HasPrefix(p, "/\\") {
+		return s.cfg.DefaultRedirect
+	}
+	return p
+}
+
+func (s *SP) setTrackingCookie(w http.ResponseWriter, relayState string, req trackedRequest) {
+	payload, _ := json.Marshal(req)
+	value := base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(s.sign(payload))
+	sameSite := http.SameSiteLaxMode
+	if s.secure() {
+		// The response is posted cross-site from the IdP.
+		sameSite = http.SameSiteNoneMode
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     trackingCookiePrefix + relayState,
+		Value:    value,
+		Path:     s.cookiePath(),
+		MaxAge:   int(s.cfg.RequestTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   s.secure(),
+		SameSite: sameSite,
+	})
+}
+
+// trackingCookie returns the unexpired request tracked for relayState.
+func (s *SP) trackingCookie(r *http.Request, relayState string) (*trackedRequest, bool) {
+	if relayState == "" {
+		return nil, false
+	}
+	cookie, err := r.Cookie(trackingCookiePrefix + relayState)
+	if err != nil {
+		return nil, false
+	}
+	encoded, mac, ok := strings.Cut(cookie.Value, ".")
+	if !ok {
+		return nil, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(mac)
+	if err != nil || !hmac.Equal(sig, s.sign(payload)) {
+		return nil, false
+	}
+	var req trackedRequest
+	if err := json.Unmarshal(payload, &req); err != nil || time.Now().After(req.Expires) {
+		return nil, false
+	}
+	return &req, true
+}
+
+func (s *SP) sign(payload []byte) []byte {
+	h := hmac.New(sha256.New, s.mac)
+	h.Write(payload)
+	return h.Sum(nil)
+}
+
+func (s *SP) clearCookie(w http.ResponseWriter, name, path string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Path:     path,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   s.secure(),
+	})
+}
+
+func (s *SP) cookiePath() string {
+	if s.base.Path == "" {
+		return "/"
+	}
+	return s.base.Path
+}
+
+func (s *SP) secure() bool {
+	return s.base.Scheme == "https"
+}
+
+// randomToken returns a URL-safe random string, used as relay state.
+func randomToken() string {
+	b := make([]byte, 24)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// writePostForm serves an auto-submitting HTTP-POST binding form.
+func writePostForm(w http.ResponseWriter, form []byte) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write([]byte("<!DOCTYPE html><html><body>"))
+	_, _ = w.Write(form)
+	_, _ = w.Write([]byte("</body></html>"))
+}
@@ -0,0 +1,424 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/chris-alexander-pop/system-design-library/pkg/auth/session"
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+	crewjam "github.com/crewjam/saml"
+	xrv "github.com/mattermost/xml-roundtrip-validator"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// maxMessageSize bounds inflated redirect-binding messages.
+const maxMessageSize = 1 << 20
+
+// handleLogout signs the user out locally and, if they signed in through
+// the tenant's IdP, sends the IdP a LogoutRequest to end their other
+// sessions there.
+func (s *SP) handleLogout(w http.ResponseWriter, r *http.Request) {
+	t, ok := s.requestTenant(w, r)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	returnTo := s.returnPath(r.FormValue("return_to"))
+
+	var data *sessionData
+	if cookie, err := r.Cookie(s.cfg.SessionCookie); err == nil {
+		if sess, err := s.cfg.Sessions.Get(session.WithClient(ctx, session.ClientFromRequest(r)), cookie.Value); err == nil {
+			data, _ = decodeSession(sess)
+		}
+		if err := s.cfg.Sessions.Delete(ctx, cookie.Value); err != nil {
+			logger.L().ErrorContext(ctx, "failed to delete session", "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		s.clearCookie(w, s.cfg.SessionCookie, "/")
+	}
+
+	binding, location := t.sloLocation(false)
+	if data == nil || data.Tenant != t.ID || location == "" {
+		http.Redirect(w, r, returnTo, http.StatusSeeOther)
+		return
+	}
+	req := &crewjam.LogoutRequest{
+		ID:           newID(),
+		Version:      "2.0",
+		IssueInstant: crewjam.TimeNow(),
+		Destination:  location,
+		Issuer:       t.issuer(),
+		NameID:       &crewjam.NameID{Format: data.NameIDFormat, Value: data.NameID},
+	}
+	if data.SessionIndex != "" {
+		req.SessionIndex = &crewjam.SessionIndex{Value: data.SessionIndex}
+	}
+	s.send(w, r, t, binding, "SAMLRequest", req.Element(), returnTo, func() ([]byte, error) {
+		if err := t.sp.SignLogoutRequest(req); err != nil {
+			return nil, err
+		}
+		return req.Post(returnTo), nil
+	})
+}
+
+// handleSLO receives the IdP's single logout messages: responses to
+// logouts started here, and requests to end sessions started at another
+// SP.
+func (s *SP) handleSLO(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	t, ok := s.requestTenant(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Malformed request.", http.StatusBadRequest)
+		return
+	}
+	switch {
+	case r.Form.Has("SAMLResponse"):
+		s.handleLogoutResponse(w, r, t)
+	case r.Form.Has("SAMLRequest"):
+		s.handleLogoutRequest(w, r, t)
+	default:
+		http.Error(w, "Missing SAML message.", http.StatusBadRequest)
+	}
+}
+
+// handleLogoutResponse completes an SP-initiated logout. The local session
+// is already gone, so a failed logout at the IdP is only logged.
+func (s *SP) handleLogoutResponse(w http.ResponseWriter, r *http.Request, t *tenant) {
+	ctx := r.Context()
+	var resp crewjam.LogoutResponse
+	if err := t.readMessage(r, "SAMLResponse", &resp); err != nil {
+		logger.L().WarnContext(ctx, "rejected SAML logout response", "tenant", t.ID, "error", err)
+		http.Error(w, "Invalid logout response.", http.StatusBadRequest)
+		return
+	}
+	if err := t.checkMessage(resp.Issuer, resp.Destination, resp.IssueInstant); err != nil {
+		logger.L().WarnContext(ctx, "rejected SAML logout response", "tenant", t.ID, "error", err)
+		http.Error(w, "Invalid logout response.", http.StatusBadRequest)
+		return
+	}
+	if status := resp.Status.StatusCode.Value; status != crewjam.StatusSuccess {
+		logger.L().WarnContext(ctx, "IdP logout failed", "tenant", t.ID, "status", status)
+	}
+	http.Redirect(w, r, s.returnPath(r.Form.Get("RelayState")), http.StatusSeeOther)
+}
+
+// handleLogoutRequest ends the sessions named by an IdP-initiated logout:
+// those with its session indexes, or all of the user's if it names none.
+func (s *SP) handleLogoutRequest(w http.ResponseWriter, r *http.Request, t *tenant) {
+	ctx := r.Context()
+	var req crewjam.LogoutRequest
+	err := t.readMessage(r, "SAMLRequest", &req)
+	if err == nil {
+		err = t.checkMessage(req.Issuer, req.Destination, req.IssueInstant)
+	}
+	if err == nil && req.NotOnOrAfter != nil && req.NotOnOrAfter.Add(crewjam.MaxClockSkew).Before(time.Now()) {
+		err = errors.InvalidArgument("logout request expired", nil)
+	}
+	if err == nil && (req.NameID == nil || req.NameID.Value == "") {
+		err = errors.InvalidArgument("logout request has no NameID", nil)
+	}
+	if err != nil {
+		logger.L().WarnContext(ctx, "rejected SAML logout request", "tenant", t.ID, "error", err)
+		http.Error(w, "Invalid logout request.", http.StatusBadRequest)
+		return
+	}
+
+	status := crewjam.StatusSuccess
+	if err := s.endSessions(r, t, &req); err != nil {
+		logger.L().ErrorContext(ctx, "failed to end sessions", "tenant", t.ID, "error", err)
+		status = crewjam.StatusResponder
+	}
+
+	binding, location := t.sloLocation(true)
+	if location == "" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	relayState := r.Form.Get("RelayState")
+	resp := &crewjam.LogoutResponse{
+		ID:           newID(),
+		InResponseTo: req.ID,
+		Version:      "2.0",
+		IssueInstant: crewjam.TimeNow(),
+		Destination:  location,
+		Issuer:       t.issuer(),
+		Status:       crewjam.Status{StatusCode: crewjam.StatusCode{Value: status}},
+	}
+	s.send(w, r, t, binding, "SAMLResponse", resp.Element(), relayState, func() ([]byte, error) {
+		if err := t.sp.SignLogoutResponse(resp); err != nil {
+			return nil, err
+		}
+		return resp.Post(relayState), nil
+	})
+}
+
+// endSessions deletes the sessions a LogoutRequest names.
+func (s *SP) endSessions(r *http.Request, t *tenant, req *crewjam.LogoutRequest) error {
+	ctx := r.Context()
+	userID := SessionUserID(t.ID, req.NameID.Value)
+	if req.SessionIndex == nil || req.SessionIndex.Value == "" {
+		return s.cfg.Sessions.DeleteAll(ctx, userID)
+	}
+	sessions, err := s.cfg.Sessions.List(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, sess := range sessions {
+		data, err := decodeSession(sess)
+		if err != nil || data.SessionIndex != req.SessionIndex.Value {
+			continue
+		}
+		if err := s.cfg.Sessions.Delete(ctx, sess.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send delivers a message to the IdP. Redirect-binding messages are
+// signed over the query string; post builds a form with an enveloped
+// signature.
+func (s *SP) send(w http.ResponseWriter, r *http.Request, t *tenant, binding, param string, el *etree.Element, relayState string, post func() ([]byte, error)) {
+	ctx := r.Context()
+	if binding == crewjam.HTTPPostBinding {
+		form, err := post()
+		if err != nil {
+			logger.L().ErrorContext(ctx, "failed to sign logout message", "tenant", t.ID, "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		writePostForm(w, form)
+		return
+	}
+	u, err := s.redirectURL(el.Copy(), param, relayState)
+	if err != nil {
+		logger.L().ErrorContext(ctx, "failed to sign logout message", "tenant", t.ID, "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, u, http.StatusFound)
+}
+
+// redirectURL encodes a message for the HTTP-Redirect binding and signs
+// the query string with the SP key.
+func (s *SP) redirectURL(el *etree.Element, param, relayState string) (string, error) {
+	doc := etree.NewDocument()
+	doc.SetRoot(el)
+	var buf bytes.Buffer
+	fw, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := doc.WriteTo(fw); err != nil {
+		return "", err
+	}
+	if err := fw.Close(); err != nil {
+		return "", err
+	}
+
+	query := param + "=" + url.QueryEscape(base64.StdEncoding.EncodeToString(buf.Bytes()))
+	if relayState != "" {
+		query += "&RelayState=" + url.QueryEscape(relayState)
+	}
+	query += "&SigAlg=" + url.QueryEscape(dsig.RSASHA256SignatureMethod)
+	digest := sha256.Sum256([]byte(query))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.cfg.Key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	query += "&Signature=" + url.QueryEscape(base64.StdEncoding.EncodeToString(sig))
+
+	u, err := url.Parse(el.SelectAttrValue("Destination", ""))
+	if err != nil {
+		return "", err
+	}
+	if u.RawQuery != "" {
+		query = u.RawQuery + "&" + query
+	}
+	u.RawQuery = query
+	return u.String(), nil
+}
+
+// readMessage decodes a message received at the SLO endpoint, verifies
+// that the IdP signed it and unmarshals it into v.
+func (t *tenant) readMessage(r *http.Request, param string, v any) error {
+	redirect := r.Method == http.MethodGet
+	value := r.PostForm.Get(param)
+	if redirect {
+		value = r.URL.Query().Get(param)
+	}
+	raw, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return errors.InvalidArgument("message is not base64", err)
+	}
+	if redirect {
+		inflated, err := io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(raw)), maxMessageSize+1))
+		if err != nil {
+			return errors.InvalidArgument("message is not deflated", err)
+		}
+		if len(inflated) > maxMessageSize {
+			return errors.InvalidArgument("message is too large", nil)
+		}
+		raw = inflated
+	}
+	if err := xrv.Validate(bytes.NewReader(raw)); err != nil {
+		return errors.InvalidArgument("message is not well-formed XML", err)
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(raw); err != nil || doc.Root() == nil {
+		return errors.InvalidArgument("message is not well-formed XML", err)
+	}
+
+	el := doc.Root()
+	if redirect && r.URL.Query().Has("Signature") {
+		if err := t.verifyQuery(r.URL.RawQuery, param); err != nil {
+			return err
+		}
+	} else {
+		// Only the signed element is trusted, so that content wrapped
+		// around it cannot be passed off as signed.
+		if el.FindElement("./Signature") == nil {
+			return errors.Unauthorized("message is not signed", nil)
+		}
+		vc := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{Roots: t.certs})
+		vc.IdAttribute = "ID"
+		if el, err = vc.Validate(el); err != nil {
+			return errors.Unauthorized("invalid message signature", err)
+		}
+	}
+
+	out := etree.NewDocument()
+	out.SetRoot(el)
+	b, err := out.WriteToBytes()
+	if err != nil {
+		return errors.Internal("failed to encode message", err)
+	}
+	if err := xml.Unmarshal(b, v); err != nil {
+		return errors.InvalidArgument("malformed message", err)
+	}
+	return nil
+}
+
+// verifyQuery verifies an HTTP-Redirect binding signature, computed over
+// the parameters as they were encoded by the sender.
+func (t *tenant) verifyQuery(rawQuery, param string) error {
+	raw := make(map[string]string)
+	for _, pair := range strings.Split(rawQuery, "&") {
+		k, v, _ := strings.Cut(pair, "=")
+		if _, ok := raw[k]; !ok {
+			raw[k] = v
+		}
+	}
+	signed := param + "=" + raw[param]
+	if v, ok := raw["RelayState"]; ok {
+		signed += "&RelayState=" + v
+	}
+	signed += "&SigAlg=" + raw["SigAlg"]
+
+	alg, err := url.QueryUnescape(raw["SigAlg"])
+	if err != nil {
+		return errors.InvalidArgument("malformed signature algorithm", err)
+	}
+	var hash crypto.Hash
+	var digest []byte
+	switch alg {
+	case dsig.RSASHA256SignatureMethod:
+		sum := sha256.Sum256([]byte(signed))
+		hash, digest = crypto.SHA256, sum[:]
+	case dsig.RSASHA512SignatureMethod:
+		sum := sha512.Sum512([]byte(signed))
+		hash, digest = crypto.SHA512, sum[:]
+	default:
+		return errors.Unauthorized("unsupported signature algorithm: "+alg, nil)
+	}
+	encoded, err := url.QueryUnescape(raw["Signature"])
+	if err != nil {
+		return errors.InvalidArgument("malformed signature", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return errors.InvalidArgument("malformed signature", err)
+	}
+	for _, cert := range t.certs {
+		if key, ok := cert.PublicKey.(*rsa.PublicKey); ok && rsa.VerifyPKCS1v15(key, hash, digest, sig) == nil {
+			return nil
+		}
+	}
+	return errors.Unauthorized("invalid message signature", nil)
+}
+
+// checkMessage validates the envelope of a logout message from the IdP.
+func (t *tenant) checkMessage(issuer *crewjam.Issuer, destination string, issued time.Time) error {
+	if issuer == nil || issuer.Value != t.sp.IDPMetadata.EntityID {
+		return errors.Unauthorized("message is not from the tenant's IdP", nil)
+	}
+	if destination != "" && destination != t.sp.SloURL.String() {
+		return errors.InvalidArgument("message is for another destination: "+destination, nil)
+	}
+	if issued.Add(crewjam.MaxIssueDelay + crewjam.MaxClockSkew).Before(time.Now()) {
+		return errors.InvalidArgument("message expired", nil)
+	}
+	return nil
+}
+
+// sloLocation returns the IdP's single logout endpoint for requests, or
+// for responses, preferring the redirect binding.
+func (t *tenant) sloLocation(response bool) (string, string) {
+	for _, binding := range []string{crewjam.HTTPRedirectBinding, crewjam.HTTPPostBinding} {
+		for _, idp := range t.sp.IDPMetadata.IDPSSODescriptors {
+			for _, ep := range idp.SingleLogoutServices {
+				if ep.Binding != binding {
+					continue
+				}
+				if response && ep.ResponseLocation != "" {
+					return binding, ep.ResponseLocation
+				}
+				return binding, ep.Location
+			}
+		}
+	}
+	return "", ""
+}
+
+func (t *tenant) issuer() *crewjam.Issuer {
+	return &crewjam.Issuer{Format: "urn:oasis:names:tc:SAML:2.0:nameid-format:entity", Value: t.EntityID}
+}
+
+func newID() string {
+	b := make([]byte, 20)
+	_, _ = rand.Read(b)
+	return "id-" + hex.EncodeToString(b)
+}
+
+// parseCertificate parses a base64 DER certificate from metadata.
+func parseCertificate(data string) (*x509.Certificate, error) {
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(data), ""))
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
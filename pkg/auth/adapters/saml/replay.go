@@ -0,0 +1,38 @@
+package saml
+
+import (
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/concurrency"
+)
+
+// replayCache remembers the IDs of consumed assertions until they expire,
+// so that a captured response cannot be posted twice.
+type replayCache struct {
+	mu   *concurrency.SmartMutex
+	seen map[string]time.Time
+}
+
+func newReplayCache() *replayCache {
+	return &replayCache{
+		mu:   concurrency.NewSmartMutex(concurrency.MutexConfig{Name: "saml-replay-cache"}),
+		seen: make(map[string]time.Time),
+	}
+}
+
+// add records id until expires, reporting false if it was already seen.
+func (c *replayCache) add(id string, expires, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for seen, exp := range c.seen {
+		if !now.Before(exp) {
+			delete(c.seen, seen)
+		}
+	}
+	if _, ok := c.seen[id]; ok {
+		return false
+	}
+	c.seen[id] = expires
+	return true
+}
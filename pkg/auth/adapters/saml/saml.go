@@ -0,0 +1,401 @@
+package saml
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/auth"
+	"github.com/chris-alexander-pop/system-design-library/pkg/auth/session"
+	"github.com/chris-alexander-pop/system-design-library/pkg/concurrency"
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	crewjam "github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// Endpoint paths, relative to BaseURL. {tenant} is the tenant ID.
+const (
+	PathMetadata = "/{tenant}/metadata"
+	PathLogin    = "/{tenant}/login"
+	PathACS      = "/{tenant}/acs"
+	PathLogout   = "/{tenant}/logout"
+	PathSLO      = "/{tenant}/slo"
+)
+
+// Request bindings.
+const (
+	BindingRedirect = "redirect"
+	BindingPOST     = "post"
+)
+
+// Config configures a service provider.
+type Config struct {
+	// BaseURL is the absolute URL the Handler is mounted at, e.g.
+	// https://app.example.com/saml.
+	BaseURL string `env:"SAML_BASE_URL"`
+
+	// RequestBinding is how AuthnRequests are sent to the IdP, "redirect"
+	// or "post". The other binding is used if the IdP lacks it.
+	RequestBinding string `env:"SAML_REQUEST_BINDING" env-default:"redirect"`
+
+	// DefaultRedirect is where users land after signing in or out when no
+	// return path was given.
+	DefaultRedirect string `env:"SAML_DEFAULT_REDIRECT" env-default:"/"`
+
+	// SessionCookie names the cookie holding the session ID.
+	SessionCookie string `env:"SAML_SESSION_COOKIE" env-default:"saml_session"`
+
+	// RequestTTL bounds how long a user may take to sign in at the IdP.
+	RequestTTL time.Duration `env:"SAML_REQUEST_TTL" env-default:"10m"`
+
+	// Key and Certificate sign requests and decrypt assertions.
+	Key         *rsa.PrivateKey
+	Certificate *x509.Certificate
+
+	// Sessions stores the sessions of signed-in users.
+	Sessions session.Manager
+
+	// HTTPClient fetches IdP metadata. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// Tenant is an organisation signing in through its own IdP.
+type Tenant struct {
+	// ID names the tenant in endpoint paths.
+	ID string
+
+	// Metadata is the IdP's metadata document. If empty, it is fetched
+	// from MetadataURL.
+	Metadata    []byte
+	MetadataURL string
+
+	// EntityID is the SP entity ID presented to the IdP. Defaults to the
+	// tenant's metadata URL.
+	EntityID string
+
+	// Attributes maps assertion attributes to claims.
+	Attributes AttributeMapping
+
+	// AllowIDPInitiated accepts unsolicited responses from the IdP.
+	AllowIDPInitiated bool
+}
+
+// SP is a multi-tenant SAML 2.0 service provider. Users signed in through
+// it are given a session whose ID, held in the session cookie, Verify
+// accepts as a token.
+type SP struct {
+	cfg     Config
+	base    *url.URL
+	mac     []byte
+	mu      *concurrency.SmartRWMutex
+	tenants map[string]*tenant
+	replay  *replayCache
+	mux     *http.ServeMux
+}
+
+type tenant struct {
+	Tenant
+	sp    *crewjam.ServiceProvider
+	certs []*x509.Certificate
+}
+
+var _ auth.Verifier = (*SP)(nil)
+
+var tenantIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// New creates a service provider with no tenants.
+func New(cfg Config) (*SP, error) {
+	if cfg.Key == nil || cfg.Certificate == nil {
+		return nil, errors.InvalidArgument("key and certificate are required", nil)
+	}
+	if cfg.Sessions == nil {
+		return nil, errors.InvalidArgument("session manager is required", nil)
+	}
+	base, err := url.Parse(strings.TrimSuffix(cfg.BaseURL, "/"))
+	if err != nil || !base.IsAbs() {
+		return nil, errors.InvalidArgument("base URL must be absolute", err)
+	}
+	switch cfg.RequestBinding {
+	case "":
+		cfg.RequestBinding = BindingRedirect
+	case BindingRedirect, BindingPOST:
+	default:
+		return nil, errors.InvalidArgument("unknown request binding: "+cfg.RequestBinding, nil)
+	}
+	if cfg.DefaultRedirect == "" {
+		cfg.DefaultRedirect = "/"
+	}
+	if cfg.SessionCookie == "" {
+		cfg.SessionCookie = "saml_session"
+	}
+	if cfg.RequestTTL <= 0 {
+		cfg.RequestTTL = 10 * time.Minute
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+
+	// Tracking cookies are authenticated with a key derived from the SP key.
+	mac := sha256.Sum256(x509.MarshalPKCS1PrivateKey(cfg.Key))
+	s := &SP{
+		cfg:     cfg,
+		base:    base,
+		mac:     mac[:],
+		mu:      concurrency.NewSmartRWMutex(concurrency.MutexConfig{Name: "saml-tenants"}),
+		tenants: make(map[string]*tenant),
+		replay:  newReplayCache(),
+		mux:     http.NewServeMux(),
+	}
+	s.mux.HandleFunc("GET "+PathMetadata, s.handleMetadata)
+	s.mux.HandleFunc("GET "+PathLogin, s.handleLogin)
+	s.mux.HandleFunc("POST "+PathACS, s.handleACS)
+	s.mux.HandleFunc("POST "+PathLogout, s.handleLogout)
+	s.mux.HandleFunc(PathSLO, s.handleSLO)
+	return s, nil
+}
+
+// Handler returns the SP endpoints. They are served at their paths
+// relative to BaseURL, so a BaseURL with a path must be mounted with
+// http.StripPrefix.
+func (s *SP) Handler() http.Handler {
+	return s.mux
+}
+
+// AddTenant registers a tenant, or replaces one with the same ID, after
+// loading and validating its IdP metadata.
+func (s *SP) AddTenant(ctx context.Context, t Tenant) error {
+	if !tenantIDPattern.MatchString(t.ID) {
+		return errors.InvalidArgument("tenant ID must be alphanumeric: "+t.ID, nil)
+	}
+	md, err := s.loadMetadata(ctx, t)
+	if err != nil {
+		return err
+	}
+	certs, err := signingCertificates(md)
+	if err != nil {
+		return err
+	}
+	if len(md.IDPSSODescriptors) == 0 || len(certs) == 0 {
+		return errors.InvalidArgument("metadata describes no IdP with a signing certificate", nil)
+	}
+	if !md.ValidUntil.IsZero() && md.ValidUntil.Before(time.Now()) {
+		return errors.InvalidArgument("IdP metadata expired at "+md.ValidUntil.Format(time.RFC3339), nil)
+	}
+
+	t.Attributes = t.Attributes.withDefaults()
+	tenantURL := s.base.JoinPath(t.ID)
+	sp := &crewjam.ServiceProvider{
+		EntityID:          t.EntityID,
+		Key:               s.cfg.Key,
+		Certificate:       s.cfg.Certificate,
+		HTTPClient:        s.cfg.HTTPClient,
+		MetadataURL:       *tenantURL.JoinPath("metadata"),
+		AcsURL:            *tenantURL.JoinPath("acs"),
+		SloURL:            *tenantURL.JoinPath("slo"),
+		IDPMetadata:       md,
+		AllowIDPInitiated: t.AllowIDPInitiated,
+		SignatureMethod:   dsig.RSASHA256SignatureMethod,
+		LogoutBindings:    []string{crewjam.HTTPRedirectBinding, crewjam.HTTPPostBinding},
+	}
+	if t.EntityID == "" {
+		t.EntityID = sp.MetadataURL.String()
+	}
+	sp.EntityID = t.EntityID
+	t.Metadata = nil
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tenants[t.ID] = &tenant{Tenant: t, sp: sp, certs: certs}
+	return nil
+}
+
+// RefreshTenant reloads the IdP metadata of a tenant added with a
+// MetadataURL, e.g. after the IdP rotates its signing certificate.
+func (s *SP) RefreshTenant(ctx context.Context, id string) error {
+	t, err := s.tenant(id)
+	if err != nil {
+		return err
+	}
+	if t.MetadataURL == "" {
+		return errors.InvalidArgument("tenant has no metadata URL: "+id, nil)
+	}
+	return s.AddTenant(ctx, t.Tenant)
+}
+
+// RemoveTenant unregisters a tenant. Its users' sessions are not revoked.
+func (s *SP) RemoveTenant(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tenants, id)
+}
+
+// Metadata returns the SP metadata document presented to a tenant's IdP.
+func (s *SP) Metadata(id string) ([]byte, error) {
+	t, err := s.tenant(id)
+	if err != nil {
+		return nil, err
+	}
+	return marshalMetadata(t.sp.Metadata())
+}
+
+// Verify implements auth.Verifier for the IDs of sessions created by
+// signing in through the SP.
+func (s *SP) Verify(ctx context.Context, token string) (*auth.Claims, error) {
+	sess, err := s.cfg.Sessions.Get(ctx, token)
+	if err != nil {
+		return nil, errors.Unauthorized("invalid session", err)
+	}
+	data, err := decodeSession(sess)
+	if err != nil {
+		return nil, errors.Unauthorized("not a SAML session", err)
+	}
+	claims := data.Claims
+	claims.Metadata = data.Metadata
+	if claims.ExpiresAt != 0 && time.Now().Unix() >= claims.ExpiresAt {
+		return nil, errors.Unauthorized("SAML session expired", nil)
+	}
+	if claims.ExpiresAt == 0 || sess.ExpiresAt.Unix() < claims.ExpiresAt {
+		claims.ExpiresAt = sess.ExpiresAt.Unix()
+	}
+	return &claims, nil
+}
+
+// Claims returns the claims of the user signed in to the request's
+// session.
+func (s *SP) Claims(r *http.Request) (*auth.Claims, error) {
+	cookie, err := r.Cookie(s.cfg.SessionCookie)
+	if err != nil {
+		return nil, errors.Unauthorized("not signed in", nil)
+	}
+	return s.Verify(session.WithClient(r.Context(), session.ClientFromRequest(r)), cookie.Value)
+}
+
+// SessionUserID is the session.Manager user ID of a tenant's user, so that
+// equal NameIDs from different IdPs do not share sessions.
+func SessionUserID(tenantID, nameID string) string {
+	return tenantID + ":" + nameID
+}
+
+func (s *SP) tenant(id string) (*tenant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tenants[id]
+	if !ok {
+		return nil, errors.NotFound("unknown tenant: "+id, nil)
+	}
+	return t, nil
+}
+
+func (s *SP) loadMetadata(ctx context.Context, t Tenant) (*crewjam.EntityDescriptor, error) {
+	if len(t.Metadata) > 0 {
+		md, err := samlsp.ParseMetadata(t.Metadata)
+		if err != nil {
+			return nil, errors.InvalidArgument("invalid IdP metadata", err)
+		}
+		return md, nil
+	}
+	if t.MetadataURL == "" {
+		return nil, errors.InvalidArgument("metadata or metadata URL is required", nil)
+	}
+	u, err := url.Parse(t.MetadataURL)
+	if err != nil {
+		return nil, errors.InvalidArgument("invalid metadata URL", err)
+	}
+	md, err := samlsp.FetchMetadata(ctx, s.cfg.HTTPClient, *u)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch IdP metadata")
+	}
+	return md, nil
+}
+
+// signingCertificates returns the IdP certificates that may sign messages.
+func signingCertificates(md *crewjam.EntityDescriptor) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for _, idp := range md.IDPSSODescriptors {
+		for _, kd := range idp.KeyDescriptors {
+			if kd.Use != "" && kd.Use != "signing" {
+				continue
+			}
+			for _, c := range kd.KeyInfo.X509Data.X509Certificates {
+				cert, err := parseCertificate(c.Data)
+				if err != nil {
+					return nil, errors.InvalidArgument("invalid IdP certificate", err)
+				}
+				certs = append(certs, cert)
+			}
+		}
+	}
+	return certs, nil
+}
+
+// sessionData is the SAML state kept in a session's metadata.
+type sessionData struct {
+	Tenant       string                 `json:"tenant"`
+	NameID       string                 `json:"name_id"`
+	NameIDFormat string                 `json:"name_id_format,omitempty"`
+	SessionIndex string                 `json:"session_index,omitempty"`
+	Claims       auth.Claims            `json:"claims"`
+	Metadata     map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// sessionKey is the session metadata key holding the sessionData.
+const sessionKey = "saml"
+
+func decodeSession(sess *session.Session) (*sessionData, error) {
+	raw, ok := sess.Metadata[sessionKey].(string)
+	if !ok {
+		return nil, errors.InvalidArgument("session has no SAML data", nil)
+	}
+	var data sessionData
+	if err := json.Unmarshal([]byte(raw), &data); err != nil {
+		return nil, errors.InvalidArgument("malformed SAML session data", err)
+	}
+	return &data, nil
+}
+
+func marshalMetadata(md *crewjam.EntityDescriptor) ([]byte, error) {
+	b, err := xml.MarshalIndent(md, "", "  ")
+	if err != nil {
+		return nil, errors.Internal("failed to marshal metadata", err)
+	}
+	return append([]byte(xml.Header), b...), nil
+}
+
+// ParseKeyPair parses a PEM-encoded certificate and RSA private key, in
+// PKCS #1 or PKCS #8 form.
+func ParseKeyPair(certPEM, keyPEM []byte) (*x509.Certificate, *rsa.PrivateKey, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil, nil, errors.InvalidArgument("certificate is not PEM", nil)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, nil, errors.InvalidArgument("invalid certificate", err)
+	}
+	block, _ = pem.Decode(keyPEM)
+	if block == nil {
+		return nil, nil, errors.InvalidArgument("key is not PEM", nil)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return cert, key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil, errors.InvalidArgument("invalid private key", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, nil, errors.InvalidArgument("SAML requires an RSA key", nil)
+	}
+	return cert, key, nil
+}
@@ -0,0 +1,495 @@
+// Package samltest provides an in-process SAML 2.0 identity provider for
+// testing service providers without an external IdP.
+//
+// The IdP signs in a configurable user without prompting, supports single
+// logout in both directions, and records the logout messages it receives.
+package samltest
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	crewjam "github.com/crewjam/saml"
+	"github.com/crewjam/saml/logger"
+	"github.com/crewjam/saml/samlsp"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// User is the user the IdP signs in.
+type User struct {
+	NameID       string
+	NameIDFormat string
+	Email        string
+	Groups       []string
+
+	// Attributes are sent as additional assertion attributes, by name.
+	Attributes map[string][]string
+
+	// SessionTTL, if set, bounds the login with SessionNotOnOrAfter.
+	SessionTTL time.Duration
+}
+
+// Logout is a LogoutRequest the IdP received from a service provider.
+type Logout struct {
+	Issuer       string
+	NameID       string
+	SessionIndex string
+
+	// Signed reports whether the request carried a valid signature by the
+	// service provider's key.
+	Signed bool
+}
+
+// IdP is a test identity provider served by an httptest.Server.
+type IdP struct {
+	Server      *httptest.Server
+	Key         *rsa.PrivateKey
+	Certificate *x509.Certificate
+
+	idp       *crewjam.IdentityProvider
+	mu        sync.Mutex
+	user      User
+	sps       map[string]*crewjam.EntityDescriptor
+	logouts   []Logout
+	responses []string
+}
+
+// New starts an IdP, closed when the test ends. It signs in user until
+// SetUser changes it.
+func New(t testing.TB, user User) *IdP {
+	t.Helper()
+	cert, key, err := GenerateKeyPair("samltest-idp")
+	if err != nil {
+		t.Fatalf("samltest: failed to generate key: %v", err)
+	}
+	p := &IdP{
+		Key:         key,
+		Certificate: cert,
+		user:        user,
+		sps:         make(map[string]*crewjam.EntityDescriptor),
+	}
+	mux := http.NewServeMux()
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Server.Close)
+
+	base, _ := url.Parse(p.Server.URL)
+	p.idp = &crewjam.IdentityProvider{
+		Key:                     key,
+		Logger:                  logger.DefaultLogger,
+		Certificate:             cert,
+		MetadataURL:             *base.JoinPath("metadata"),
+		SSOURL:                  *base.JoinPath("sso"),
+		LogoutURL:               *base.JoinPath("slo"),
+		ServiceProviderProvider: p,
+		SessionProvider:         p,
+		AssertionMaker:          p,
+		SignatureMethod:         dsig.RSASHA256SignatureMethod,
+	}
+	mux.HandleFunc("/metadata", p.serveMetadata)
+	mux.HandleFunc("/sso", p.idp.ServeSSO)
+	mux.HandleFunc("/slo", p.serveSLO)
+	return p
+}
+
+// EntityID returns the IdP's entity ID.
+func (p *IdP) EntityID() string {
+	return p.idp.MetadataURL.String()
+}
+
+// MetadataURL returns the URL of the IdP's metadata.
+func (p *IdP) MetadataURL() string {
+	return p.idp.MetadataURL.String()
+}
+
+// Metadata returns the IdP's metadata document.
+func (p *IdP) Metadata() []byte {
+	b, _ := xml.MarshalIndent(p.metadata(), "", "  ")
+	return b
+}
+
+// SetUser changes the user the IdP signs in.
+func (p *IdP) SetUser(u User) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.user = u
+}
+
+// RegisterServiceProvider trusts the service provider described by
+// metadata.
+func (p *IdP) RegisterServiceProvider(metadata []byte) error {
+	md, err := samlsp.ParseMetadata(metadata)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sps[md.EntityID] = md
+	return nil
+}
+
+// Logouts returns the LogoutRequests received from service providers.
+func (p *IdP) Logouts() []Logout {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Logout(nil), p.logouts...)
+}
+
+// LogoutResponses returns the status codes of the LogoutResponses received
+// from service providers.
+func (p *IdP) LogoutResponses() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.responses...)
+}
+
+// LogoutRequestURL returns an HTTP-Redirect binding URL, signed over the
+// query string, asking a service provider to end the sessions of nameID.
+// An empty sessionIndex asks it to end all of them.
+func (p *IdP) LogoutRequestURL(spEntityID, nameID, sessionIndex string) (string, error) {
+	req, err := p.logoutRequest(spEntityID, nameID, sessionIndex)
+	if err != nil {
+		return "", err
+	}
+	return p.redirectURL(req.Element(), "SAMLRequest", "")
+}
+
+// LogoutRequestForm returns the form fields of an HTTP-POST binding
+// LogoutRequest, with an enveloped signature, and the URL to post it to.
+func (p *IdP) LogoutRequestForm(spEntityID, nameID, sessionIndex string) (string, url.Values, error) {
+	req, err := p.logoutRequest(spEntityID, nameID, sessionIndex)
+	if err != nil {
+		return "", nil, err
+	}
+	el, err := p.signEnveloped(req.Element())
+	if err != nil {
+		return "", nil, err
+	}
+	doc := etree.NewDocument()
+	doc.SetRoot(el)
+	b, err := doc.WriteToBytes()
+	if err != nil {
+		return "", nil, err
+	}
+	return req.Destination, url.Values{"SAMLRequest": {base64.StdEncoding.EncodeToString(b)}}, nil
+}
+
+// GetSession implements crewjam.SessionProvider, signing in the current
+// user without prompting.
+func (p *IdP) GetSession(w http.ResponseWriter, r *http.Request, req *crewjam.IdpAuthnRequest) *crewjam.Session {
+	p.mu.Lock()
+	u := p.user
+	p.mu.Unlock()
+
+	now := crewjam.TimeNow()
+	s := &crewjam.Session{
+		ID:           newID(),
+		CreateTime:   now,
+		ExpireTime:   now.Add(time.Hour),
+		Index:        newID(),
+		NameID:       u.NameID,
+		NameIDFormat: u.NameIDFormat,
+		UserEmail:    u.Email,
+		Groups:       u.Groups,
+	}
+	for name, values := range u.Attributes {
+		attr := crewjam.Attribute{Name: name, NameFormat: "urn:oasis:names:tc:SAML:2.0:attrname-format:basic"}
+		for _, v := range values {
+			attr.Values = append(attr.Values, crewjam.AttributeValue{Type: "xs:string", Value: v})
+		}
+		s.CustomAttributes = append(s.CustomAttributes, attr)
+	}
+	return s
+}
+
+// GetServiceProvider implements crewjam.ServiceProviderProvider.
+func (p *IdP) GetServiceProvider(r *http.Request, serviceProviderID string) (*crewjam.EntityDescriptor, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	md, ok := p.sps[serviceProviderID]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return md, nil
+}
+
+// MakeAssertion implements crewjam.AssertionMaker, bounding the default
+// assertion's login by the user's SessionTTL.
+func (p *IdP) MakeAssertion(req *crewjam.IdpAuthnRequest, s *crewjam.Session) error {
+	if err := (crewjam.DefaultAssertionMaker{}).MakeAssertion(req, s); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	ttl := p.user.SessionTTL
+	p.mu.Unlock()
+	if ttl > 0 {
+		bound := crewjam.TimeNow().Add(ttl)
+		for i := range req.Assertion.AuthnStatements {
+			req.Assertion.AuthnStatements[i].SessionNotOnOrAfter = &bound
+		}
+	}
+	return nil
+}
+
+// metadata is the crewjam metadata with single logout over both bindings.
+func (p *IdP) metadata() *crewjam.EntityDescriptor {
+	md := p.idp.Metadata()
+	slo := p.idp.LogoutURL.String()
+	md.IDPSSODescriptors[0].SingleLogoutServices = []crewjam.Endpoint{
+		{Binding: crewjam.HTTPRedirectBinding, Location: slo, ResponseLocation: slo},
+		{Binding: crewjam.HTTPPostBinding, Location: slo, ResponseLocation: slo},
+	}
+	return md
+}
+
+func (p *IdP) serveMetadata(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	_, _ = w.Write(p.Metadata())
+}
+
+// serveSLO records LogoutRequests from service providers, answering each
+// with a LogoutResponse, and LogoutResponses to IdP-initiated logouts.
+func (p *IdP) serveSLO(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.Form.Has("SAMLResponse") {
+		var resp crewjam.LogoutResponse
+		if _, err := decode(r, "SAMLResponse", &resp); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		p.mu.Lock()
+		p.responses = append(p.responses, resp.Status.StatusCode.Value)
+		p.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var req crewjam.LogoutRequest
+	el, err := decode(r, "SAMLRequest", &req)
+	if err != nil || req.Issuer == nil {
+		http.Error(w, "malformed logout request", http.StatusBadRequest)
+		return
+	}
+	sp, err := p.GetServiceProvider(r, req.Issuer.Value)
+	if err != nil {
+		http.Error(w, "unknown service provider", http.StatusBadRequest)
+		return
+	}
+	logout := Logout{Issuer: req.Issuer.Value, Signed: verify(r, el, spCertificates(sp))}
+	if req.NameID != nil {
+		logout.NameID = req.NameID.Value
+	}
+	if req.SessionIndex != nil {
+		logout.SessionIndex = req.SessionIndex.Value
+	}
+	p.mu.Lock()
+	p.logouts = append(p.logouts, logout)
+	p.mu.Unlock()
+
+	destination := sloLocation(sp)
+	if destination == "" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	resp := &crewjam.LogoutResponse{
+		ID:           newID(),
+		InResponseTo: req.ID,
+		Version:      "2.0",
+		IssueInstant: crewjam.TimeNow(),
+		Destination:  destination,
+		Issuer:       &crewjam.Issuer{Format: "urn:oasis:names:tc:SAML:2.0:nameid-format:entity", Value: p.EntityID()},
+		Status:       crewjam.Status{StatusCode: crewjam.StatusCode{Value: crewjam.StatusSuccess}},
+	}
+	u, err := p.redirectURL(resp.Element(), "SAMLResponse", r.Form.Get("RelayState"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, u, http.StatusFound)
+}
+
+func (p *IdP) logoutRequest(spEntityID, nameID, sessionIndex string) (*crewjam.LogoutRequest, error) {
+	sp, err := p.GetServiceProvider(nil, spEntityID)
+	if err != nil {
+		return nil, err
+	}
+	req := &crewjam.LogoutRequest{
+		ID:           newID(),
+		Version:      "2.0",
+		IssueInstant: crewjam.TimeNow(),
+		Destination:  sloLocation(sp),
+		Issuer:       &crewjam.Issuer{Format: "urn:oasis:names:tc:SAML:2.0:nameid-format:entity", Value: p.EntityID()},
+		NameID:       &crewjam.NameID{Value: nameID},
+	}
+	if sessionIndex != "" {
+		req.SessionIndex = &crewjam.SessionIndex{Value: sessionIndex}
+	}
+	return req, nil
+}
+
+func (p *IdP) signEnveloped(el *etree.Element) (*etree.Element, error) {
+	ctx := dsig.NewDefaultSigningContext(dsig.TLSCertKeyStore(tls.Certificate{
+		Certificate: [][]byte{p.Certificate.Raw},
+		PrivateKey:  p.Key,
+		Leaf:        p.Certificate,
+	}))
+	if err := ctx.SetSignatureMethod(dsig.RSASHA256SignatureMethod); err != nil {
+		return nil, err
+	}
+	return ctx.SignEnveloped(el)
+}
+
+// redirectURL encodes a message for the HTTP-Redirect binding, signed over
+// the query string.
+func (p *IdP) redirectURL(el *etree.Element, param, relayState string) (string, error) {
+	doc := etree.NewDocument()
+	doc.SetRoot(el)
+	var buf bytes.Buffer
+	fw, _ := flate.NewWriter(&buf, flate.BestCompression)
+	if _, err := doc.WriteTo(fw); err != nil {
+		return "", err
+	}
+	if err := fw.Close(); err != nil {
+		return "", err
+	}
+	query := param + "=" + url.QueryEscape(base64.StdEncoding.EncodeToString(buf.Bytes()))
+	if relayState != "" {
+		query += "&RelayState=" + url.QueryEscape(relayState)
+	}
+	query += "&SigAlg=" + url.QueryEscape(dsig.RSASHA256SignatureMethod)
+	digest := sha256.Sum256([]byte(query))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, p.Key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return el.SelectAttrValue("Destination", "") + "?" + query +
+		"&Signature=" + url.QueryEscape(base64.StdEncoding.EncodeToString(sig)), nil
+}
+
+// decode reads a message in either binding into v, returning its element.
+func decode(r *http.Request, param string, v any) (*etree.Element, error) {
+	raw, err := base64.StdEncoding.DecodeString(r.Form.Get(param))
+	if err != nil {
+		return nil, err
+	}
+	if r.Method == http.MethodGet {
+		if raw, err = io.ReadAll(flate.NewReader(bytes.NewReader(raw))); err != nil {
+			return nil, err
+		}
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(raw); err != nil {
+		return nil, err
+	}
+	return doc.Root(), xml.Unmarshal(raw, v)
+}
+
+// verify reports whether a message is signed by one of certs, over the
+// query string or enveloped.
+func verify(r *http.Request, el *etree.Element, certs []*x509.Certificate) bool {
+	if r.Method == http.MethodGet && r.URL.Query().Has("Signature") {
+		var signed []string
+		for _, pair := range strings.Split(r.URL.RawQuery, "&") {
+			if !strings.HasPrefix(pair, "Signature=") {
+				signed = append(signed, pair)
+			}
+		}
+		sig, err := base64.StdEncoding.DecodeString(r.URL.Query().Get("Signature"))
+		if err != nil || r.URL.Query().Get("SigAlg") != dsig.RSASHA256SignatureMethod {
+			return false
+		}
+		digest := sha256.Sum256([]byte(strings.Join(signed, "&")))
+		for _, cert := range certs {
+			if key, ok := cert.PublicKey.(*rsa.PublicKey); ok && rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil {
+				return true
+			}
+		}
+		return false
+	}
+	ctx := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{Roots: certs})
+	ctx.IdAttribute = "ID"
+	_, err := ctx.Validate(el)
+	return err == nil
+}
+
+func spCertificates(md *crewjam.EntityDescriptor) []*x509.Certificate {
+	var certs []*x509.Certificate
+	for _, sp := range md.SPSSODescriptors {
+		for _, kd := range sp.KeyDescriptors {
+			for _, c := range kd.KeyInfo.X509Data.X509Certificates {
+				der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(c.Data), ""))
+				if err != nil {
+					continue
+				}
+				if cert, err := x509.ParseCertificate(der); err == nil {
+					certs = append(certs, cert)
+				}
+			}
+		}
+	}
+	return certs
+}
+
+func sloLocation(md *crewjam.EntityDescriptor) string {
+	for _, sp := range md.SPSSODescriptors {
+		for _, ep := range sp.SingleLogoutServices {
+			if ep.Binding == crewjam.HTTPRedirectBinding {
+				return ep.Location
+			}
+		}
+	}
+	return ""
+}
+
+// GenerateKeyPair returns a self-signed certificate and its RSA key.
+func GenerateKeyPair(commonName string) (*x509.Certificate, *rsa.PrivateKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+func newID() string {
+	b := make([]byte, 20)
+	_, _ = rand.Read(b)
+	return "id-" + hex.EncodeToString(b)
+}
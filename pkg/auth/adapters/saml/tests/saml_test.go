@@ -0,0 +1,451 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/auth/adapters/saml"
+	"github.com/chris-alexander-pop/system-design-library/pkg/auth/adapters/saml/samltest"
+	"github.com/chris-alexander-pop/system-design-library/pkg/auth/session"
+	"github.com/chris-alexander-pop/system-design-library/pkg/auth/session/adapters/memory"
+)
+
+var alice = samltest.User{
+	NameID:       "alice@example.com",
+	NameIDFormat: "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress",
+	Email:        "alice@example.com",
+	Groups:       []string{"admin", "staff"},
+	Attributes:   map[string][]string{"department": {"engineering"}},
+}
+
+// env is an application serving the SP under /saml, signing in through a
+// test IdP as tenant "acme".
+type env struct {
+	sp       *saml.SP
+	idp      *samltest.IdP
+	app      *httptest.Server
+	sessions session.Manager
+}
+
+func newEnv(t *testing.T, cfg saml.Config, tenant saml.Tenant) *env {
+	t.Helper()
+	e := &env{idp: samltest.New(t, alice), sessions: memory.New(session.Config{TTL: time.Hour})}
+
+	mux := http.NewServeMux()
+	e.app = httptest.NewServer(mux)
+	t.Cleanup(e.app.Close)
+
+	cert, key, err := samltest.GenerateKeyPair("sp")
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+	cfg.BaseURL = e.app.URL + "/saml"
+	cfg.Key, cfg.Certificate, cfg.Sessions = key, cert, e.sessions
+	if e.sp, err = saml.New(cfg); err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	mux.Handle("/saml/", http.StripPrefix("/saml", e.sp.Handler()))
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		claims, err := e.sp.Claims(r)
+		if err != nil {
+			http.Error(w, "signed out", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, claims.Subject)
+	})
+
+	if tenant.ID == "" {
+		tenant.ID = "acme"
+	}
+	if tenant.MetadataURL == "" {
+		tenant.Metadata = e.idp.Metadata()
+	}
+	e.addTenant(t, tenant)
+	return e
+}
+
+func (e *env) addTenant(t *testing.T, tenant saml.Tenant) {
+	t.Helper()
+	if err := e.sp.AddTenant(context.Background(), tenant); err != nil {
+		t.Fatalf("AddTenant failed: %v", err)
+	}
+	md, err := e.sp.Metadata(tenant.ID)
+	if err != nil {
+		t.Fatalf("Metadata failed: %v", err)
+	}
+	if err := e.idp.RegisterServiceProvider(md); err != nil {
+		t.Fatalf("RegisterServiceProvider failed: %v", err)
+	}
+}
+
+func newClient(t *testing.T) *http.Client {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatalf("cookiejar.New failed: %v", err)
+	}
+	return &http.Client{Jar: jar}
+}
+
+var (
+	formAction = regexp.MustCompile(`<form method="post" action="([^"]*)"`)
+	formInput  = regexp.MustCompile(`<input type="hidden" name="(\w+)" value="([^"]*)"`)
+)
+
+// parseForm extracts the auto-submitting form of a POST binding page.
+func parseForm(t *testing.T, resp *http.Response) (string, url.Values) {
+	t.Helper()
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	action := formAction.FindSubmatch(body)
+	if action == nil {
+		t.Fatalf("expected a POST binding form, got %d: %s", resp.StatusCode, body)
+	}
+	values := url.Values{}
+	for _, m := range formInput.FindAllSubmatch(body, -1) {
+		values.Set(string(m[1]), html.UnescapeString(string(m[2])))
+	}
+	return html.UnescapeString(string(action[1])), values
+}
+
+func get(t *testing.T, c *http.Client, u string) *http.Response {
+	t.Helper()
+	resp, err := c.Get(u)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", u, err)
+	}
+	return resp
+}
+
+func post(t *testing.T, c *http.Client, u string, values url.Values) *http.Response {
+	t.Helper()
+	resp, err := c.PostForm(u, values)
+	if err != nil {
+		t.Fatalf("POST %s failed: %v", u, err)
+	}
+	return resp
+}
+
+func body(resp *http.Response) string {
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return string(b)
+}
+
+// login signs in through the IdP and returns the final response.
+func (e *env) login(t *testing.T, c *http.Client, returnTo string) *http.Response {
+	t.Helper()
+	resp := get(t, c, e.app.URL+"/saml/acme/login?return_to="+url.QueryEscape(returnTo))
+	action, values := parseForm(t, resp)
+	if strings.HasPrefix(action, e.idp.Server.URL) {
+		// The AuthnRequest was posted; the IdP answers with its own form.
+		action, values = parseForm(t, post(t, c, action, values))
+	}
+	return post(t, c, action, values)
+}
+
+func (e *env) sessionID(t *testing.T, c *http.Client) string {
+	t.Helper()
+	u, _ := url.Parse(e.app.URL)
+	for _, cookie := range c.Jar.Cookies(u) {
+		if cookie.Name == "saml_session" {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+func (e *env) entityID() string {
+	return e.app.URL + "/saml/acme/metadata"
+}
+
+func TestLoginRedirectBinding(t *testing.T) {
+	e := newEnv(t, saml.Config{}, saml.Tenant{
+		Attributes: saml.AttributeMapping{Metadata: map[string]string{"department": "department"}},
+	})
+	c := newClient(t)
+
+	resp := e.login(t, c, "/dashboard")
+	if resp.Request.URL.Path != "/dashboard" || resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected to land on /dashboard, got %d at %s", resp.StatusCode, resp.Request.URL)
+	}
+	if got := body(resp); got != alice.NameID {
+		t.Errorf("app saw subject %q", got)
+	}
+
+	claims, err := e.sp.Verify(context.Background(), e.sessionID(t, c))
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if claims.Subject != alice.NameID || claims.Email != alice.Email || claims.Role != "admin" {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+	if claims.Issuer != e.idp.EntityID() || !slices.Equal(claims.Audience, []string{e.entityID()}) {
+		t.Errorf("unexpected issuer or audience: %s %v", claims.Issuer, claims.Audience)
+	}
+	if claims.Metadata["tenant"] != "acme" || claims.Metadata["department"] != "engineering" || claims.Metadata["session_index"] == "" {
+		t.Errorf("unexpected metadata: %v", claims.Metadata)
+	}
+	if roles, _ := claims.Metadata["roles"].([]interface{}); len(roles) != 2 {
+		t.Errorf("expected both groups as roles, got %v", claims.Metadata["roles"])
+	}
+
+	sessions, err := e.sessions.List(context.Background(), saml.SessionUserID("acme", alice.NameID))
+	if err != nil || len(sessions) != 1 {
+		t.Errorf("expected one session for the tenant's user, got %d (%v)", len(sessions), err)
+	}
+}
+
+func TestLoginPostBinding(t *testing.T) {
+	e := newEnv(t, saml.Config{RequestBinding: saml.BindingPOST}, saml.Tenant{})
+	c := newClient(t)
+
+	resp := get(t, c, e.app.URL+"/saml/acme/login")
+	action, values := parseForm(t, resp)
+	if !strings.HasPrefix(action, e.idp.Server.URL) || values.Get("SAMLRequest") == "" {
+		t.Fatalf("expected the AuthnRequest to be posted to the IdP, got %s %v", action, values)
+	}
+	action, values = parseForm(t, post(t, c, action, values))
+	resp = post(t, c, action, values)
+	if resp.Request.URL.Path != "/" || body(resp) != alice.NameID {
+		t.Fatalf("expected to be signed in at /, got %d at %s", resp.StatusCode, resp.Request.URL)
+	}
+}
+
+func TestSessionBoundByIdP(t *testing.T) {
+	e := newEnv(t, saml.Config{}, saml.Tenant{})
+	user := alice
+	user.SessionTTL = 30 * time.Minute
+	e.idp.SetUser(user)
+	c := newClient(t)
+	e.login(t, c, "/").Body.Close()
+
+	claims, err := e.sp.Verify(context.Background(), e.sessionID(t, c))
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if until := time.Until(time.Unix(claims.ExpiresAt, 0)); until > 30*time.Minute || until < 29*time.Minute {
+		t.Errorf("expected claims to expire with the IdP session, got %s", until)
+	}
+}
+
+func TestUnsolicitedResponseRejected(t *testing.T) {
+	e := newEnv(t, saml.Config{}, saml.Tenant{})
+
+	// Capture a response meant for another browser's login.
+	victim := newClient(t)
+	action, values := parseForm(t, get(t, victim, e.app.URL+"/saml/acme/login"))
+
+	attacker := newClient(t)
+	resp := post(t, attacker, action, values)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for a response without a tracked request, got %d", resp.StatusCode)
+	}
+	resp.Body.Close()
+}
+
+func TestReplayedAssertionRejected(t *testing.T) {
+	e := newEnv(t, saml.Config{}, saml.Tenant{AllowIDPInitiated: true})
+	c := newClient(t)
+
+	action, values := parseForm(t, get(t, c, e.app.URL+"/saml/acme/login"))
+	if resp := post(t, c, action, values); body(resp) != alice.NameID {
+		t.Fatalf("first login failed: %d", resp.StatusCode)
+	}
+	resp := post(t, newClient(t), action, values)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for a replayed assertion, got %d", resp.StatusCode)
+	}
+	resp.Body.Close()
+}
+
+func TestReturnPathMustBeLocal(t *testing.T) {
+	e := newEnv(t, saml.Config{DefaultRedirect: "/home"}, saml.Tenant{})
+	for _, returnTo := range []string{"https://evil.example.com/", "//evil.example.com/", "/\\evil.example.com"} {
+		resp := e.login(t, newClient(t), returnTo)
+		if resp.Request.URL.Host != strings.TrimPrefix(e.app.URL, "http://") || resp.Request.URL.Path != "/home" {
+			t.Errorf("return_to=%s: landed at %s", returnTo, resp.Request.URL)
+		}
+		resp.Body.Close()
+	}
+}
+
+func TestSPInitiatedLogout(t *testing.T) {
+	e := newEnv(t, saml.Config{}, saml.Tenant{})
+	c := newClient(t)
+	e.login(t, c, "/").Body.Close()
+	sessionID := e.sessionID(t, c)
+	claims, err := e.sp.Verify(context.Background(), sessionID)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+
+	resp := post(t, c, e.app.URL+"/saml/acme/logout", url.Values{"return_to": {"/bye"}})
+	if resp.Request.URL.Path != "/bye" || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected to be signed out at /bye, got %d at %s", resp.StatusCode, resp.Request.URL)
+	}
+	resp.Body.Close()
+
+	if _, err := e.sp.Verify(context.Background(), sessionID); err == nil {
+		t.Error("expected the session to be deleted")
+	}
+	logouts := e.idp.Logouts()
+	if len(logouts) != 1 {
+		t.Fatalf("expected the IdP to receive one logout, got %d", len(logouts))
+	}
+	l := logouts[0]
+	if !l.Signed || l.Issuer != e.entityID() || l.NameID != alice.NameID || l.SessionIndex != claims.Metadata["session_index"] {
+		t.Errorf("unexpected logout request: %+v", l)
+	}
+}
+
+func TestIDPInitiatedLogout(t *testing.T) {
+	e := newEnv(t, saml.Config{}, saml.Tenant{})
+	ctx := context.Background()
+	laptop, phone := newClient(t), newClient(t)
+	e.login(t, laptop, "/").Body.Close()
+	e.login(t, phone, "/").Body.Close()
+	laptopClaims, err := e.sp.Verify(ctx, e.sessionID(t, laptop))
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+
+	// Redirect binding, signed over the query, ending one session.
+	u, err := e.idp.LogoutRequestURL(e.entityID(), alice.NameID, laptopClaims.Metadata["session_index"].(string))
+	if err != nil {
+		t.Fatalf("LogoutRequestURL failed: %v", err)
+	}
+	resp := get(t, newClient(t), u)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected the IdP to accept the logout response, got %d", resp.StatusCode)
+	}
+	if got := e.idp.LogoutResponses(); !slices.Equal(got, []string{"urn:oasis:names:tc:SAML:2.0:status:Success"}) {
+		t.Errorf("unexpected logout responses: %v", got)
+	}
+	if _, err := e.sp.Verify(ctx, e.sessionID(t, laptop)); err == nil {
+		t.Error("expected the laptop session to be ended")
+	}
+	if _, err := e.sp.Verify(ctx, e.sessionID(t, phone)); err != nil {
+		t.Errorf("expected the phone session to survive: %v", err)
+	}
+
+	// POST binding, with an enveloped signature, ending every session.
+	action, values, err := e.idp.LogoutRequestForm(e.entityID(), alice.NameID, "")
+	if err != nil {
+		t.Fatalf("LogoutRequestForm failed: %v", err)
+	}
+	post(t, newClient(t), action, values).Body.Close()
+	if _, err := e.sp.Verify(ctx, e.sessionID(t, phone)); err == nil {
+		t.Error("expected the phone session to be ended")
+	}
+}
+
+func TestForgedLogoutRejected(t *testing.T) {
+	e := newEnv(t, saml.Config{}, saml.Tenant{})
+	c := newClient(t)
+	e.login(t, c, "/").Body.Close()
+
+	// Another IdP that knows the SP cannot end the tenant's sessions.
+	other := samltest.New(t, alice)
+	md, _ := e.sp.Metadata("acme")
+	if err := other.RegisterServiceProvider(md); err != nil {
+		t.Fatalf("RegisterServiceProvider failed: %v", err)
+	}
+	u, err := other.LogoutRequestURL(e.entityID(), alice.NameID, "")
+	if err != nil {
+		t.Fatalf("LogoutRequestURL failed: %v", err)
+	}
+	resp := get(t, newClient(t), u)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for a forged logout request, got %d", resp.StatusCode)
+	}
+	resp.Body.Close()
+
+	action, values, _ := other.LogoutRequestForm(e.entityID(), alice.NameID, "")
+	resp = post(t, newClient(t), action, values)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for a forged logout form, got %d", resp.StatusCode)
+	}
+	resp.Body.Close()
+
+	if _, err := e.sp.Verify(context.Background(), e.sessionID(t, c)); err != nil {
+		t.Errorf("expected the session to survive: %v", err)
+	}
+}
+
+func TestTenants(t *testing.T) {
+	e := newEnv(t, saml.Config{}, saml.Tenant{})
+	ctx := context.Background()
+
+	// A second tenant whose IdP metadata is fetched, with its own entity ID.
+	globex := samltest.New(t, samltest.User{NameID: "bob", Groups: []string{"viewer"}})
+	tenant := saml.Tenant{ID: "globex", MetadataURL: globex.MetadataURL(), EntityID: "urn:example:sp"}
+	if err := e.sp.AddTenant(ctx, tenant); err != nil {
+		t.Fatalf("AddTenant failed: %v", err)
+	}
+	md, _ := e.sp.Metadata("globex")
+	if !strings.Contains(string(md), `entityID="urn:example:sp"`) || !strings.Contains(string(md), e.app.URL+"/saml/globex/acs") {
+		t.Errorf("unexpected SP metadata: %s", md)
+	}
+	if err := globex.RegisterServiceProvider(md); err != nil {
+		t.Fatalf("RegisterServiceProvider failed: %v", err)
+	}
+	if err := e.sp.RefreshTenant(ctx, "globex"); err != nil {
+		t.Errorf("RefreshTenant failed: %v", err)
+	}
+
+	c := newClient(t)
+	resp := get(t, c, e.app.URL+"/saml/globex/login")
+	action, values := parseForm(t, resp)
+	resp = post(t, c, action, values)
+	if body(resp) != "bob" {
+		t.Fatalf("expected bob to sign in through globex, got %d", resp.StatusCode)
+	}
+	claims, err := e.sp.Verify(ctx, e.sessionID(t, c))
+	if err != nil || claims.Role != "viewer" || claims.Metadata["tenant"] != "globex" || claims.Email != "" {
+		t.Errorf("unexpected claims: %+v (%v)", claims, err)
+	}
+
+	// A response from one tenant's IdP is not accepted for another.
+	action, values = parseForm(t, get(t, c, e.app.URL+"/saml/acme/login"))
+	resp = post(t, c, strings.Replace(action, "/acme/", "/globex/", 1), values)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for a response posted to another tenant, got %d", resp.StatusCode)
+	}
+	resp.Body.Close()
+
+	e.sp.RemoveTenant("globex")
+	resp = get(t, c, e.app.URL+"/saml/globex/metadata")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for a removed tenant, got %d", resp.StatusCode)
+	}
+	resp.Body.Close()
+}
+
+func TestInvalidTenantMetadata(t *testing.T) {
+	e := newEnv(t, saml.Config{}, saml.Tenant{})
+	ctx := context.Background()
+
+	expired := regexp.MustCompile(`validUntil="[^"]*"`).ReplaceAll(e.idp.Metadata(), []byte(`validUntil="2001-01-01T00:00:00Z"`))
+	cases := map[string]saml.Tenant{
+		"expired":   {ID: "expired", Metadata: expired},
+		"malformed": {ID: "malformed", Metadata: []byte("<EntityDescriptor")},
+		"bad id":    {ID: "../acme", Metadata: e.idp.Metadata()},
+		"no source": {ID: "empty"},
+	}
+	for name, tenant := range cases {
+		if err := e.sp.AddTenant(ctx, tenant); err == nil {
+			t.Errorf("%s: expected AddTenant to fail", name)
+		}
+	}
+}
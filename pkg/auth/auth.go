@@ -1,8 +1,10 @@
 // Package auth provides authentication and authorization primitives.
 //
 // Supported adapters:
-//   - JWT: Local JWT generation and verification
+//   - JWT: Local JWT generation and verification, with HMAC or rotating
+//     asymmetric keys published as a JWKS
 //   - OIDC: OpenID Connect integration
+//   - SAML: Multi-tenant SAML 2.0 service provider for enterprise SSO
 //   - Session: Server-side session management
 //   - PASETO: Secure token generation
 package auth
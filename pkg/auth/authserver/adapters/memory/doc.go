@@ -0,0 +1,3 @@
+// Package memory provides in-memory client, grant and consent stores for
+// the authorization server, for tests and single-instance deployments.
+package memory
@@ -0,0 +1,228 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/auth/authserver"
+	"github.com/chris-alexander-pop/system-design-library/pkg/concurrency"
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+)
+
+// Store implements authserver.ClientStore, authserver.GrantStore and
+// authserver.ConsentStore in memory. Expired entries are dropped as they
+// are encountered.
+type Store struct {
+	clients  map[string]authserver.Client
+	codes    map[string]authserver.AuthorizationCode
+	refresh  map[string]authserver.RefreshToken
+	revoked  map[string]time.Time // jti -> expiry
+	consents map[[2]string]authserver.Consent
+	mu       *concurrency.SmartRWMutex
+}
+
+var (
+	_ authserver.ClientStore  = (*Store)(nil)
+	_ authserver.GrantStore   = (*Store)(nil)
+	_ authserver.ConsentStore = (*Store)(nil)
+)
+
+// New creates an empty Store.
+func New() *Store {
+	return &Store{
+		clients:  make(map[string]authserver.Client),
+		codes:    make(map[string]authserver.AuthorizationCode),
+		refresh:  make(map[string]authserver.RefreshToken),
+		revoked:  make(map[string]time.Time),
+		consents: make(map[[2]string]authserver.Consent),
+		mu: concurrency.NewSmartRWMutex(concurrency.MutexConfig{
+			Name: "memory-authserver-store",
+		}),
+	}
+}
+
+func (s *Store) GetClient(ctx context.Context, id string) (*authserver.Client, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.clients[id]
+	if !ok {
+		return nil, errors.NotFound("client not found", nil)
+	}
+	return cloneClient(c), nil
+}
+
+func (s *Store) SaveClient(ctx context.Context, client *authserver.Client) error {
+	if client.ID == "" {
+		return errors.InvalidArgument("client id is required", nil)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.clients[client.ID] = *cloneClient(*client)
+	return nil
+}
+
+func (s *Store) DeleteClient(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.clients, id)
+	return nil
+}
+
+func (s *Store) SaveCode(ctx context.Context, code *authserver.AuthorizationCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := *code
+	c.Scopes = slices.Clone(code.Scopes)
+	s.codes[code.Code] = c
+	return nil
+}
+
+func (s *Store) UseCode(ctx context.Context, code, clientID string) (*authserver.AuthorizationCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.codes[code]
+	if !ok {
+		return nil, errors.NotFound("authorization code not found", nil)
+	}
+	if time.Now().After(c.ExpiresAt) {
+		delete(s.codes, code)
+		return nil, errors.NotFound("authorization code expired", nil)
+	}
+	prev := c
+	prev.Scopes = slices.Clone(c.Scopes)
+	if c.ClientID == clientID {
+		c.Used = true
+		s.codes[code] = c
+	}
+	return &prev, nil
+}
+
+func (s *Store) SaveRefreshToken(ctx context.Context, token *authserver.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := *token
+	t.Scopes = slices.Clone(token.Scopes)
+	s.refresh[token.Token] = t
+	return nil
+}
+
+func (s *Store) GetRefreshToken(ctx context.Context, token string) (*authserver.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.liveRefreshToken(token)
+	if err != nil {
+		return nil, err
+	}
+	return cloneRefreshToken(t), nil
+}
+
+func (s *Store) UseRefreshToken(ctx context.Context, token string) (*authserver.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.liveRefreshToken(token)
+	if err != nil {
+		return nil, err
+	}
+	prev := cloneRefreshToken(t)
+	t.Used = true
+	s.refresh[token] = t
+	return prev, nil
+}
+
+// liveRefreshToken returns an unexpired token. Callers hold the lock.
+func (s *Store) liveRefreshToken(token string) (authserver.RefreshToken, error) {
+	t, ok := s.refresh[token]
+	if !ok {
+		return t, errors.NotFound("refresh token not found", nil)
+	}
+	if time.Now().After(t.ExpiresAt) {
+		delete(s.refresh, token)
+		return t, errors.NotFound("refresh token expired", nil)
+	}
+	return t, nil
+}
+
+func (s *Store) RevokeFamily(ctx context.Context, family string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, t := range s.refresh {
+		if t.Family == family {
+			delete(s.refresh, k)
+		}
+	}
+	return nil
+}
+
+func (s *Store) RevokeAccessToken(ctx context.Context, id string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for k, exp := range s.revoked {
+		if now.After(exp) {
+			delete(s.revoked, k)
+		}
+	}
+	s.revoked[id] = expiresAt
+	return nil
+}
+
+func (s *Store) IsAccessTokenRevoked(ctx context.Context, id string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.revoked[id]
+	return ok, nil
+}
+
+func (s *Store) GetConsent(ctx context.Context, userID, clientID string) (*authserver.Consent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.consents[[2]string{userID, clientID}]
+	if !ok {
+		return nil, errors.NotFound("consent not found", nil)
+	}
+	c.Scopes = slices.Clone(c.Scopes)
+	return &c, nil
+}
+
+func (s *Store) SaveConsent(ctx context.Context, consent *authserver.Consent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := *consent
+	c.Scopes = slices.Clone(consent.Scopes)
+	s.consents[[2]string{consent.UserID, consent.ClientID}] = c
+	return nil
+}
+
+func (s *Store) RevokeConsent(ctx context.Context, userID, clientID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.consents, [2]string{userID, clientID})
+	return nil
+}
+
+func cloneClient(c authserver.Client) *authserver.Client {
+	c.RedirectURIs = slices.Clone(c.RedirectURIs)
+	c.Scopes = slices.Clone(c.Scopes)
+	c.GrantTypes = slices.Clone(c.GrantTypes)
+	return &c
+}
+
+func cloneRefreshToken(t authserver.RefreshToken) *authserver.RefreshToken {
+	t.Scopes = slices.Clone(t.Scopes)
+	return &t
+}
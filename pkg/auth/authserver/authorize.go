@@ -0,0 +1,427 @@
+package authserver
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/auth/session"
+	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+	"github.com/chris-alexander-pop/system-design-library/pkg/security/iam"
+)
+
+// authRequest is a validated authorization request.
+type authRequest struct {
+	client           *Client
+	redirectURI      string
+	redirectURIGiven bool // false if redirectURI defaulted to the client's only one
+	state            string
+	nonce            string
+	challenge        string
+	prompt           string
+	scopes           []string
+	params           url.Values // the original parameters, carried through the forms
+}
+
+// handleAuthorize runs the authorization code flow: it sends users without
+// a session to the login page and users who have not consented to the
+// consent page, then redirects back to the client with a code.
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.renderError(w, http.StatusBadRequest, "Malformed request.")
+		return
+	}
+	req, ok := s.parseAuthRequest(w, r, r.Form)
+	if !ok {
+		return
+	}
+	s.continueAuthorization(w, r, req)
+}
+
+// parseAuthRequest validates an authorization request. Errors are shown
+// to the user until the redirect URI is known to belong to the client,
+// and redirected to the client after.
+func (s *Server) parseAuthRequest(w http.ResponseWriter, r *http.Request, params url.Values) (*authRequest, bool) {
+	ctx := r.Context()
+	client, err := s.cfg.Clients.GetClient(ctx, params.Get("client_id"))
+	if err != nil {
+		if !isNotFound(err) {
+			logger.L().ErrorContext(ctx, "failed to load client", "error", err)
+		}
+		s.renderError(w, http.StatusBadRequest, "Unknown client.")
+		return nil, false
+	}
+
+	req := &authRequest{
+		client:      client,
+		redirectURI: params.Get("redirect_uri"),
+		state:       params.Get("state"),
+		nonce:       params.Get("nonce"),
+		challenge:   params.Get("code_challenge"),
+		prompt:      params.Get("prompt"),
+		scopes:      parseScopes(params.Get("scope")),
+		params:      params,
+	}
+	req.redirectURIGiven = req.redirectURI != ""
+	if !req.redirectURIGiven && len(client.RedirectURIs) == 1 {
+		req.redirectURI = client.RedirectURIs[0]
+	}
+	if !slices.Contains(client.RedirectURIs, req.redirectURI) {
+		s.renderError(w, http.StatusBadRequest, "Invalid redirect URI.")
+		return nil, false
+	}
+
+	var oerr *oauthError
+	method := params.Get("code_challenge_method")
+	switch {
+	case params.Get("response_type") != "code":
+		oerr = &oauthError{Code: "unsupported_response_type", Description: "only the code response type is supported"}
+	case !client.allows(GrantAuthorizationCode):
+		oerr = unauthorizedClient("client may not use the authorization code grant")
+	case req.challenge == "" && client.Public():
+		oerr = invalidRequest("public clients must use PKCE")
+	case req.challenge != "" && method != "S256":
+		oerr = invalidRequest("code_challenge_method must be S256")
+	default:
+		oerr = checkScopes(client, req.scopes)
+	}
+	if oerr != nil {
+		s.redirectError(w, r, req, oerr.Code, oerr.Description)
+		return nil, false
+	}
+	return req, true
+}
+
+func (s *Server) continueAuthorization(w http.ResponseWriter, r *http.Request, req *authRequest) {
+	ctx := r.Context()
+
+	user, authTime := s.currentUser(r)
+	if user == nil || req.prompt == "login" {
+		if req.prompt == "none" {
+			s.redirectError(w, r, req, "login_required", "")
+			return
+		}
+		s.renderLogin(w, r, req, "")
+		return
+	}
+
+	if !req.client.FirstParty {
+		consent, err := s.cfg.Consents.GetConsent(ctx, user.ID, req.client.ID)
+		if err != nil && !isNotFound(err) {
+			logger.L().ErrorContext(ctx, "failed to load consent", "error", err)
+			s.redirectError(w, r, req, "server_error", "")
+			return
+		}
+		granted := consent != nil && covers(consent.Scopes, req.scopes)
+		if !granted || req.prompt == "consent" {
+			if req.prompt == "none" {
+				s.redirectError(w, r, req, "consent_required", "")
+				return
+			}
+			s.renderConsent(w, r, req)
+			return
+		}
+	}
+
+	code := randomToken()
+	err := s.cfg.Grants.SaveCode(ctx, &AuthorizationCode{
+		Code:             hashToken(code),
+		ClientID:         req.client.ID,
+		User:             *user,
+		RedirectURI:      req.redirectURI,
+		RedirectURIGiven: req.redirectURIGiven,
+		Scopes:           req.scopes,
+		CodeChallenge:    req.challenge,
+		Nonce:            req.nonce,
+		AuthTime:         authTime,
+		ExpiresAt:        time.Now().Add(s.cfg.CodeTTL),
+		Family:           randomToken(),
+	})
+	if err != nil {
+		logger.L().ErrorContext(ctx, "failed to save authorization code", "error", err)
+		s.redirectError(w, r, req, "server_error", "")
+		return
+	}
+	s.redirect(w, r, req, url.Values{"code": {code}})
+}
+
+// handleLogin authenticates the user, starts a session and resumes the
+// authorization request.
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	params, ok := s.parseForm(w, r)
+	if !ok {
+		return
+	}
+	req, ok := s.parseAuthRequest(w, r, params)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	user, err := s.cfg.Identity.Authenticate(ctx, iam.Credentials{
+		Username: r.PostForm.Get("username"),
+		Password: r.PostForm.Get("password"),
+	})
+	if err != nil {
+		logger.L().InfoContext(ctx, "login failed", "username", r.PostForm.Get("username"))
+		s.renderLogin(w, r, req, "Invalid username or password.")
+		return
+	}
+
+	profile, _ := json.Marshal(user)
+	sess, err := s.cfg.Sessions.Create(session.WithClient(ctx, session.ClientFromRequest(r)), user.ID, map[string]interface{}{
+		"user":      string(profile),
+		"auth_time": time.Now().Unix(),
+	})
+	if err != nil {
+		logger.L().ErrorContext(ctx, "failed to create session", "error", err)
+		s.renderError(w, http.StatusInternalServerError, "Could not sign you in. Please try again.")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.cfg.SessionCookie,
+		Value:    sess.ID,
+		Path:     "/",
+		Expires:  sess.ExpiresAt,
+		HttpOnly: true,
+		Secure:   s.secureCookies(),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	// The user just signed in, so prompt=login is satisfied.
+	params.Del("prompt")
+	http.Redirect(w, r, s.cfg.Issuer+PathAuthorize+"?"+params.Encode(), http.StatusSeeOther)
+}
+
+// handleConsent records the user's decision and resumes the authorization
+// request.
+func (s *Server) handleConsent(w http.ResponseWriter, r *http.Request) {
+	params, ok := s.parseForm(w, r)
+	if !ok {
+		return
+	}
+	req, ok := s.parseAuthRequest(w, r, params)
+	if !ok {
+		return
+	}
+	user, _ := s.currentUser(r)
+	if user == nil {
+		s.renderLogin(w, r, req, "")
+		return
+	}
+	if r.PostForm.Get("decision") != "allow" {
+		s.redirectError(w, r, req, "access_denied", "the user denied the request")
+		return
+	}
+
+	ctx := r.Context()
+	err := s.cfg.Consents.SaveConsent(ctx, &Consent{
+		UserID:    user.ID,
+		ClientID:  req.client.ID,
+		Scopes:    req.scopes,
+		GrantedAt: time.Now(),
+	})
+	if err != nil {
+		logger.L().ErrorContext(ctx, "failed to save consent", "error", err)
+		s.redirectError(w, r, req, "server_error", "")
+		return
+	}
+
+	req.prompt = ""
+	req.params.Del("prompt")
+	s.continueAuthorization(w, r, req)
+}
+
+// parseForm parses a login or consent form, checking its CSRF token, and
+// returns the authorization request it carries.
+func (s *Server) parseForm(w http.ResponseWriter, r *http.Request) (url.Values, bool) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return nil, false
+	}
+	if err := r.ParseForm(); err != nil {
+		s.renderError(w, http.StatusBadRequest, "Malformed request.")
+		return nil, false
+	}
+	cookie, err := r.Cookie(csrfCookie)
+	token := r.PostForm.Get("csrf_token")
+	if err != nil || token == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(token)) != 1 {
+		s.renderError(w, http.StatusForbidden, "Your form expired. Please go back and try again.")
+		return nil, false
+	}
+	params, err := url.ParseQuery(r.PostForm.Get("request"))
+	if err != nil {
+		s.renderError(w, http.StatusBadRequest, "Malformed request.")
+		return nil, false
+	}
+	return params, true
+}
+
+// currentUser returns the user signed in to the browser session.
+func (s *Server) currentUser(r *http.Request) (*iam.User, time.Time) {
+	cookie, err := r.Cookie(s.cfg.SessionCookie)
+	if err != nil {
+		return nil, time.Time{}
+	}
+	sess, err := s.cfg.Sessions.Get(session.WithClient(r.Context(), session.ClientFromRequest(r)), cookie.Value)
+	if err != nil {
+		return nil, time.Time{}
+	}
+
+	profile, _ := sess.Metadata["user"].(string)
+	var user iam.User
+	if err := json.Unmarshal([]byte(profile), &user); err != nil || user.ID != sess.UserID {
+		return nil, time.Time{}
+	}
+	authTime := sess.CreatedAt
+	switch t := sess.Metadata["auth_time"].(type) {
+	case int64:
+		authTime = time.Unix(t, 0)
+	case float64: // after a JSON round trip
+		authTime = time.Unix(int64(t), 0)
+	}
+	return &user, authTime
+}
+
+// covers reports whether granted includes every requested scope.
+func covers(granted, requested []string) bool {
+	for _, scope := range requested {
+		if !slices.Contains(granted, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) redirect(w http.ResponseWriter, r *http.Request, req *authRequest, params url.Values) {
+	u, err := url.Parse(req.redirectURI)
+	if err != nil {
+		s.renderError(w, http.StatusBadRequest, "Invalid redirect URI.")
+		return
+	}
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	if req.state != "" {
+		q.Set("state", req.state)
+	}
+	q.Set("iss", s.cfg.Issuer)
+	u.RawQuery = q.Encode()
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+func (s *Server) redirectError(w http.ResponseWriter, r *http.Request, req *authRequest, code, desc string) {
+	params := url.Values{"error": {code}}
+	if desc != "" {
+		params.Set("error_description", desc)
+	}
+	s.redirect(w, r, req, params)
+}
+
+func (s *Server) secureCookies() bool {
+	return strings.HasPrefix(s.cfg.Issuer, "https://")
+}
+
+// csrfToken returns the request's CSRF token, issuing one if needed.
+func (s *Server) csrfToken(w http.ResponseWriter, r *http.Request) string {
+	if c, err := r.Cookie(csrfCookie); err == nil && c.Value != "" {
+		return c.Value
+	}
+	token := randomToken()
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   s.secureCookies(),
+		SameSite: http.SameSiteStrictMode,
+	})
+	return token
+}
+
+var pages = template.Must(template.New("").Parse(`
+{{define "head"}}<!DOCTYPE html><html><head><meta charset="utf-8"><title>{{.}}</title></head><body>{{end}}
+{{define "login"}}{{template "head" "Sign in"}}
+<h1>Sign in to {{.Client}}</h1>
+{{with .Error}}<p role="alert">{{.}}</p>{{end}}
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="csrf_token" value="{{.CSRF}}">
+<input type="hidden" name="request" value="{{.Request}}">
+<label>Username <input name="username" autocomplete="username" required></label>
+<label>Password <input name="password" type="password" autocomplete="current-password" required></label>
+<button type="submit">Sign in</button>
+</form></body></html>{{end}}
+{{define "consent"}}{{template "head" "Authorize"}}
+<h1>{{.Client}} wants to access your account</h1>
+<ul>{{range .Scopes}}<li>{{.}}</li>{{end}}</ul>
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="csrf_token" value="{{.CSRF}}">
+<input type="hidden" name="request" value="{{.Request}}">
+<button type="submit" name="decision" value="allow">Allow</button>
+<button type="submit" name="decision" value="deny">Deny</button>
+</form></body></html>{{end}}
+{{define "error"}}{{template "head" "Error"}}<p>{{.}}</p></body></html>{{end}}
+`))
+
+// page is the data of the login and consent pages.
+type page struct {
+	Client  string
+	Error   string
+	Scopes  []string
+	Action  string
+	CSRF    string
+	Request string
+}
+
+func (s *Server) newPage(w http.ResponseWriter, r *http.Request, req *authRequest, action string) page {
+	name := req.client.Name
+	if name == "" {
+		name = req.client.ID
+	}
+	return page{
+		Client:  name,
+		Scopes:  req.scopes,
+		Action:  s.cfg.Issuer + action,
+		CSRF:    s.csrfToken(w, r),
+		Request: req.params.Encode(),
+	}
+}
+
+func (s *Server) renderLogin(w http.ResponseWriter, r *http.Request, req *authRequest, msg string) {
+	p := s.newPage(w, r, req, PathLogin)
+	p.Error = msg
+	status := http.StatusOK
+	if msg != "" {
+		status = http.StatusUnauthorized
+	}
+	s.render(w, status, "login", p)
+}
+
+func (s *Server) renderConsent(w http.ResponseWriter, r *http.Request, req *authRequest) {
+	s.render(w, http.StatusOK, "consent", s.newPage(w, r, req, PathConsent))
+}
+
+func (s *Server) renderError(w http.ResponseWriter, status int, msg string) {
+	s.render(w, status, "error", msg)
+}
+
+func (s *Server) render(w http.ResponseWriter, status int, name string, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.WriteHeader(status)
+	_ = pages.ExecuteTemplate(w, name, data)
+}
@@ -0,0 +1,197 @@
+package authserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/auth/adapters/jwt"
+	"github.com/chris-alexander-pop/system-design-library/pkg/auth/session"
+	"github.com/chris-alexander-pop/system-design-library/pkg/security/iam"
+	"github.com/chris-alexander-pop/system-design-library/pkg/security/iam/provider"
+)
+
+// Grant types.
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantClientCredentials = "client_credentials"
+	GrantRefreshToken      = "refresh_token"
+)
+
+// Scopes with built-in meaning.
+const (
+	ScopeOpenID        = "openid"
+	ScopeProfile       = "profile"
+	ScopeEmail         = "email"
+	ScopeOfflineAccess = "offline_access"
+)
+
+// Config configures the authorization server.
+type Config struct {
+	// Issuer is the server's URL; endpoints are published relative to it.
+	Issuer string `env:"AUTHSERVER_ISSUER" env-required:"true"`
+
+	AccessTokenTTL  time.Duration `env:"AUTHSERVER_ACCESS_TOKEN_TTL" env-default:"15m"`
+	IDTokenTTL      time.Duration `env:"AUTHSERVER_ID_TOKEN_TTL" env-default:"1h"`
+	RefreshTokenTTL time.Duration `env:"AUTHSERVER_REFRESH_TOKEN_TTL" env-default:"720h"`
+	CodeTTL         time.Duration `env:"AUTHSERVER_CODE_TTL" env-default:"1m"`
+
+	// Audience, if set, is the aud claim of access tokens.
+	Audience string `env:"AUTHSERVER_AUDIENCE"`
+
+	// SessionCookie names the browser session cookie.
+	SessionCookie string `env:"AUTHSERVER_SESSION_COOKIE" env-default:"authserver_session"`
+
+	// Identity authenticates users at the login page.
+	Identity provider.IdentityProvider
+
+	// Sessions keeps users signed in between authorizations.
+	Sessions session.Manager
+
+	// Keys signs access and ID tokens.
+	Keys *jwt.KeySet
+
+	Clients  ClientStore
+	Grants   GrantStore
+	Consents ConsentStore
+}
+
+// Client is a registered OAuth2 client.
+type Client struct {
+	ID   string
+	Name string
+
+	// SecretHash is HashSecret of the client secret. Public clients, such
+	// as browser and mobile apps, have none and must use PKCE.
+	SecretHash string
+
+	// RedirectURIs are the exact redirect URIs the client may use.
+	RedirectURIs []string
+
+	// Scopes are the scopes the client may request.
+	Scopes []string
+
+	// GrantTypes are the grant types the client may use.
+	GrantTypes []string
+
+	// FirstParty clients are trusted and skip the consent page.
+	FirstParty bool
+}
+
+// Public reports whether the client has no secret.
+func (c *Client) Public() bool {
+	return c.SecretHash == ""
+}
+
+// allows reports whether the client may use a grant type.
+func (c *Client) allows(grant string) bool {
+	return slices.Contains(c.GrantTypes, grant)
+}
+
+// HashSecret hashes a client secret for storage. Client secrets are
+// generated with high entropy, so a fast hash suffices.
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// AuthorizationCode is an issued authorization code.
+type AuthorizationCode struct {
+	// Code is the hash of the code handed to the client.
+	Code        string
+	ClientID    string
+	User        iam.User
+	RedirectURI string
+	Scopes      []string
+
+	// RedirectURIGiven records that the authorization request named the
+	// redirect URI rather than defaulting to the client's only one, in
+	// which case the token request must repeat it.
+	RedirectURIGiven bool
+
+	// CodeChallenge is the S256 PKCE challenge.
+	CodeChallenge string
+	Nonce         string
+	AuthTime      time.Time
+	ExpiresAt     time.Time
+
+	// Used is set once the code is exchanged.
+	Used bool
+
+	// Family is the refresh token family the exchange starts. It is
+	// revoked if the code is replayed.
+	Family string
+}
+
+// RefreshToken is an issued refresh token. Each refresh replaces it with a
+// new token of the same family; presenting a replaced token again revokes
+// the whole family.
+type RefreshToken struct {
+	// Token is the hash of the token handed to the client.
+	Token     string
+	Family    string
+	ClientID  string
+	User      iam.User
+	Scopes    []string
+	AuthTime  time.Time
+	ExpiresAt time.Time
+
+	// Used is set once the token is exchanged for a new one.
+	Used bool
+}
+
+// Consent records the scopes a user granted a client.
+type Consent struct {
+	UserID    string
+	ClientID  string
+	Scopes    []string
+	GrantedAt time.Time
+}
+
+// ClientStore stores registered clients.
+type ClientStore interface {
+	// GetClient returns a client, or a NotFound error.
+	GetClient(ctx context.Context, id string) (*Client, error)
+	SaveClient(ctx context.Context, client *Client) error
+	DeleteClient(ctx context.Context, id string) error
+}
+
+// GrantStore stores authorization codes, refresh tokens and revoked
+// access tokens.
+type GrantStore interface {
+	SaveCode(ctx context.Context, code *AuthorizationCode) error
+
+	// UseCode marks a code used and returns it as it was before, so a
+	// replay is seen as Used. A code issued to a client other than
+	// clientID is returned but not marked, so that another client cannot
+	// burn it. It returns a NotFound error for unknown or expired codes.
+	UseCode(ctx context.Context, code, clientID string) (*AuthorizationCode, error)
+
+	SaveRefreshToken(ctx context.Context, token *RefreshToken) error
+
+	// GetRefreshToken returns a token, or a NotFound error for unknown,
+	// expired or revoked tokens.
+	GetRefreshToken(ctx context.Context, token string) (*RefreshToken, error)
+
+	// UseRefreshToken marks a token used and returns it as it was before,
+	// like UseCode.
+	UseRefreshToken(ctx context.Context, token string) (*RefreshToken, error)
+
+	// RevokeFamily revokes every refresh token of a family.
+	RevokeFamily(ctx context.Context, family string) error
+
+	// RevokeAccessToken denies an access token, by its jti, until it
+	// expires.
+	RevokeAccessToken(ctx context.Context, id string, expiresAt time.Time) error
+	IsAccessTokenRevoked(ctx context.Context, id string) (bool, error)
+}
+
+// ConsentStore stores consent records.
+type ConsentStore interface {
+	// GetConsent returns a consent record, or a NotFound error.
+	GetConsent(ctx context.Context, userID, clientID string) (*Consent, error)
+	SaveConsent(ctx context.Context, consent *Consent) error
+	RevokeConsent(ctx context.Context, userID, clientID string) error
+}
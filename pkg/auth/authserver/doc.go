@@ -0,0 +1,29 @@
+// Package authserver provides an OAuth2 authorization server and OpenID
+// Provider for first-party and partner applications.
+//
+// It implements the authorization code grant with PKCE, the client
+// credentials grant and the refresh token grant with rotation and reuse
+// detection, token introspection (RFC 7662) and revocation (RFC 7009),
+// consent records, and the OpenID Connect discovery, JWKS and userinfo
+// endpoints.
+//
+// Users sign in with an iam provider.IdentityProvider and stay signed in
+// through a session.Manager. Access and ID tokens are JWTs signed by a
+// jwt.KeySet. Clients, grants and consents are kept behind the
+// ClientStore, GrantStore and ConsentStore interfaces; adapters/memory
+// implements them in memory.
+//
+// Usage:
+//
+//	store := memory.New()
+//	srv, err := authserver.New(authserver.Config{
+//		Issuer:   "https://auth.example.com",
+//		Identity: idp,
+//		Sessions: sessions,
+//		Keys:     keys,
+//		Clients:  store,
+//		Grants:   store,
+//		Consents: store,
+//	})
+//	http.ListenAndServe(":8080", srv.Handler())
+package authserver
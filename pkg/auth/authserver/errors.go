@@ -0,0 +1,46 @@
+package authserver
+
+import "net/http"
+
+// oauthError is an OAuth2 error response (RFC 6749 section 5.2).
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	status      int
+}
+
+func (e *oauthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func invalidRequest(desc string) *oauthError {
+	return &oauthError{Code: "invalid_request", Description: desc, status: http.StatusBadRequest}
+}
+
+func invalidClient(desc string) *oauthError {
+	return &oauthError{Code: "invalid_client", Description: desc, status: http.StatusUnauthorized}
+}
+
+func invalidGrant(desc string) *oauthError {
+	return &oauthError{Code: "invalid_grant", Description: desc, status: http.StatusBadRequest}
+}
+
+func invalidScope(desc string) *oauthError {
+	return &oauthError{Code: "invalid_scope", Description: desc, status: http.StatusBadRequest}
+}
+
+func unauthorizedClient(desc string) *oauthError {
+	return &oauthError{Code: "unauthorized_client", Description: desc, status: http.StatusBadRequest}
+}
+
+func unsupportedGrantType(desc string) *oauthError {
+	return &oauthError{Code: "unsupported_grant_type", Description: desc, status: http.StatusBadRequest}
+}
+
+func invalidToken(desc string) *oauthError {
+	return &oauthError{Code: "invalid_token", Description: desc, status: http.StatusUnauthorized}
+}
+
+func serverError() *oauthError {
+	return &oauthError{Code: "server_error", status: http.StatusInternalServerError}
+}
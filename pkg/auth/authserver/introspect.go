@@ -0,0 +1,147 @@
+package authserver
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+)
+
+// handleIntrospect reports whether a token is active (RFC 7662). Only
+// confidential clients, such as resource servers, may introspect.
+func (s *Server) handleIntrospect(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	client, oerr := s.authenticateClient(r)
+	if oerr != nil {
+		writeError(w, oerr)
+		return
+	}
+	if client.Public() {
+		writeError(w, unauthorizedClient("public clients may not introspect tokens"))
+		return
+	}
+	token := r.PostForm.Get("token")
+	if token == "" {
+		writeError(w, invalidRequest("token is required"))
+		return
+	}
+
+	ctx := r.Context()
+	if claims, err := s.verifyAccessToken(ctx, token); err == nil {
+		resp := map[string]any{
+			"active":     true,
+			"token_type": "Bearer",
+			"client_id":  claims.ClientID,
+			"sub":        claims.Subject,
+			"scope":      claims.Scope,
+			"iss":        claims.Issuer,
+			"exp":        claims.ExpiresAt.Unix(),
+			"iat":        claims.IssuedAt.Unix(),
+			"jti":        claims.ID,
+		}
+		if len(claims.Audience) > 0 {
+			resp["aud"] = claims.Audience
+		}
+		if claims.Username != "" {
+			resp["username"] = claims.Username
+		}
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	rt, err := s.cfg.Grants.GetRefreshToken(ctx, hashToken(token))
+	if err == nil && !rt.Used {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"active":     true,
+			"token_type": "refresh_token",
+			"client_id":  rt.ClientID,
+			"sub":        rt.User.ID,
+			"scope":      strings.Join(rt.Scopes, " "),
+			"iss":        s.cfg.Issuer,
+			"exp":        rt.ExpiresAt.Unix(),
+		})
+		return
+	}
+	if err != nil && !isNotFound(err) {
+		logger.L().ErrorContext(ctx, "failed to load refresh token", "error", err)
+		writeError(w, serverError())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"active": false})
+}
+
+// handleRevoke revokes a token issued to the calling client (RFC 7009).
+// Revoking a refresh token revokes its whole family. Unknown tokens are
+// not an error.
+func (s *Server) handleRevoke(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	client, oerr := s.authenticateClient(r)
+	if oerr != nil {
+		writeError(w, oerr)
+		return
+	}
+	token := r.PostForm.Get("token")
+	if token == "" {
+		writeError(w, invalidRequest("token is required"))
+		return
+	}
+
+	ctx := r.Context()
+	var err error
+	if rt, lookupErr := s.cfg.Grants.GetRefreshToken(ctx, hashToken(token)); lookupErr == nil {
+		if rt.ClientID == client.ID {
+			err = s.cfg.Grants.RevokeFamily(ctx, rt.Family)
+		}
+	} else if !isNotFound(lookupErr) {
+		err = lookupErr
+	} else if claims, verifyErr := s.verifyAccessToken(ctx, token); verifyErr == nil && claims.ClientID == client.ID {
+		err = s.cfg.Grants.RevokeAccessToken(ctx, claims.ID, claims.ExpiresAt.Time)
+	}
+	if err != nil {
+		logger.L().ErrorContext(ctx, "failed to revoke token", "client_id", client.ID, "error", err)
+		writeError(w, serverError())
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleUserInfo returns the claims of the user an access token with the
+// openid scope was issued for.
+func (s *Server) handleUserInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		writeJSON(w, http.StatusMethodNotAllowed, invalidRequest("method not allowed"))
+		return
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		writeError(w, invalidToken("bearer token required"))
+		return
+	}
+	claims, err := s.verifyAccessToken(r.Context(), token)
+	if err != nil {
+		writeError(w, invalidToken("invalid access token"))
+		return
+	}
+	if !covers(parseScopes(claims.Scope), []string{ScopeOpenID}) {
+		writeJSON(w, http.StatusForbidden, &oauthError{Code: "insufficient_scope", Description: "the openid scope is required"})
+		return
+	}
+
+	info := map[string]any{"sub": claims.Subject}
+	if claims.Email != "" {
+		info["email"] = claims.Email
+	}
+	if claims.Username != "" {
+		info["preferred_username"] = claims.Username
+	}
+	if len(claims.Roles) > 0 {
+		info["roles"] = claims.Roles
+	}
+	writeJSON(w, http.StatusOK, info)
+}
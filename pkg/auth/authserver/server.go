@@ -0,0 +1,244 @@
+package authserver
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/auth"
+	"github.com/chris-alexander-pop/system-design-library/pkg/auth/adapters/jwt"
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+)
+
+// Endpoint paths, relative to the issuer.
+const (
+	PathAuthorize  = "/authorize"
+	PathLogin      = "/login"
+	PathConsent    = "/consent"
+	PathToken      = "/token"
+	PathIntrospect = "/introspect"
+	PathRevoke     = "/revoke"
+	PathUserInfo   = "/userinfo"
+	PathDiscovery  = "/.well-known/openid-configuration"
+	PathMetadata   = "/.well-known/oauth-authorization-server"
+)
+
+// csrfCookie holds the double-submit token of the login and consent forms.
+const csrfCookie = "authserver_csrf"
+
+// Server is an OAuth2 authorization server and OpenID Provider.
+type Server struct {
+	cfg Config
+	mux *http.ServeMux
+}
+
+var _ auth.Verifier = (*Server)(nil)
+
+// New creates a Server.
+func New(cfg Config) (*Server, error) {
+	if cfg.Issuer == "" {
+		return nil, errors.InvalidArgument("issuer is required", nil)
+	}
+	if cfg.Identity == nil || cfg.Sessions == nil || cfg.Keys == nil ||
+		cfg.Clients == nil || cfg.Grants == nil || cfg.Consents == nil {
+		return nil, errors.InvalidArgument("identity provider, session manager, key set and stores are required", nil)
+	}
+	cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+	if cfg.AccessTokenTTL <= 0 {
+		cfg.AccessTokenTTL = 15 * time.Minute
+	}
+	if cfg.IDTokenTTL <= 0 {
+		cfg.IDTokenTTL = time.Hour
+	}
+	if cfg.RefreshTokenTTL <= 0 {
+		cfg.RefreshTokenTTL = 30 * 24 * time.Hour
+	}
+	if cfg.CodeTTL <= 0 {
+		cfg.CodeTTL = time.Minute
+	}
+	if cfg.SessionCookie == "" {
+		cfg.SessionCookie = "authserver_session"
+	}
+
+	s := &Server{cfg: cfg, mux: http.NewServeMux()}
+	s.mux.HandleFunc(PathAuthorize, s.handleAuthorize)
+	s.mux.HandleFunc(PathLogin, s.handleLogin)
+	s.mux.HandleFunc(PathConsent, s.handleConsent)
+	s.mux.HandleFunc(PathToken, s.handleToken)
+	s.mux.HandleFunc(PathIntrospect, s.handleIntrospect)
+	s.mux.HandleFunc(PathRevoke, s.handleRevoke)
+	s.mux.HandleFunc(PathUserInfo, s.handleUserInfo)
+	s.mux.HandleFunc(PathDiscovery, s.handleDiscovery)
+	s.mux.HandleFunc(PathMetadata, s.handleDiscovery)
+	s.mux.Handle(jwt.JWKSPath, cfg.Keys.Handler())
+	return s, nil
+}
+
+// Handler returns the server's endpoints. They are served at their paths
+// relative to the issuer, so an issuer with a path must be mounted with
+// http.StripPrefix.
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// Verify implements auth.Verifier for access tokens issued by the server,
+// rejecting revoked tokens.
+func (s *Server) Verify(ctx context.Context, token string) (*auth.Claims, error) {
+	claims, err := s.verifyAccessToken(ctx, token)
+	if err != nil {
+		return nil, errors.Unauthorized("invalid access token", err)
+	}
+	c := &auth.Claims{
+		Subject: claims.Subject,
+		Issuer:  s.cfg.Issuer,
+		Email:   claims.Email,
+	}
+	if claims.ExpiresAt != nil {
+		c.ExpiresAt = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		c.IssuedAt = claims.IssuedAt.Unix()
+	}
+	if len(claims.Roles) > 0 {
+		c.Role = claims.Roles[0]
+	}
+	c.Audience = claims.Audience
+	c.Metadata = map[string]interface{}{"client_id": claims.ClientID, "scope": claims.Scope}
+	return c, nil
+}
+
+func (s *Server) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	scopes := []string{ScopeOpenID, ScopeProfile, ScopeEmail, ScopeOfflineAccess}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                         s.cfg.Issuer,
+		"authorization_endpoint":                         s.cfg.Issuer + PathAuthorize,
+		"token_endpoint":                                 s.cfg.Issuer + PathToken,
+		"introspection_endpoint":                         s.cfg.Issuer + PathIntrospect,
+		"revocation_endpoint":                            s.cfg.Issuer + PathRevoke,
+		"userinfo_endpoint":                              s.cfg.Issuer + PathUserInfo,
+		"jwks_uri":                                       s.cfg.Issuer + jwt.JWKSPath,
+		"scopes_supported":                               scopes,
+		"response_types_supported":                       []string{"code"},
+		"response_modes_supported":                       []string{"query"},
+		"grant_types_supported":                          []string{GrantAuthorizationCode, GrantClientCredentials, GrantRefreshToken},
+		"subject_types_supported":                        []string{"public"},
+		"id_token_signing_alg_values_supported":          []string{s.cfg.Keys.Current().Algorithm},
+		"token_endpoint_auth_methods_supported":          []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":               []string{"S256"},
+		"claims_supported":                               []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "email", "preferred_username", "roles"},
+		"authorization_response_iss_parameter_supported": true,
+	})
+}
+
+// authenticateClient identifies the client of a token endpoint request
+// from HTTP Basic credentials or the client_id and client_secret form
+// fields. Public clients identify themselves by client_id alone.
+func (s *Server) authenticateClient(r *http.Request) (*Client, *oauthError) {
+	id, secret, basic := r.BasicAuth()
+	if basic {
+		// Basic credentials are form-encoded first (RFC 6749 section 2.3.1).
+		var err1, err2 error
+		id, err1 = url.QueryUnescape(id)
+		secret, err2 = url.QueryUnescape(secret)
+		if err1 != nil || err2 != nil {
+			return nil, invalidClient("malformed client credentials")
+		}
+	} else {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if id == "" {
+		return nil, invalidClient("client authentication required")
+	}
+
+	client, err := s.cfg.Clients.GetClient(r.Context(), id)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, invalidClient("unknown client")
+		}
+		logger.L().ErrorContext(r.Context(), "failed to load client", "client_id", id, "error", err)
+		return nil, serverError()
+	}
+	if client.Public() {
+		if secret != "" {
+			return nil, invalidClient("public clients have no secret")
+		}
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(HashSecret(secret)), []byte(client.SecretHash)) != 1 {
+		return nil, invalidClient("invalid client credentials")
+	}
+	return client, nil
+}
+
+// checkScopes reports whether the client may request every scope.
+func checkScopes(client *Client, scopes []string) *oauthError {
+	for _, scope := range scopes {
+		if !slices.Contains(client.Scopes, scope) {
+			return invalidScope("scope not allowed: " + scope)
+		}
+	}
+	return nil
+}
+
+func parseScopes(scope string) []string {
+	var scopes []string
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, e *oauthError) {
+	if e.status == http.StatusUnauthorized {
+		if e.Code == "invalid_token" {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		} else {
+			w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+		}
+	}
+	writeJSON(w, e.status, e)
+}
+
+// requirePost rejects requests with other methods and parses the form.
+func requirePost(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, invalidRequest("method not allowed"))
+		return false
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, invalidRequest("malformed form body"))
+		return false
+	}
+	return true
+}
+
+// randomToken returns 256 random bits, URL-safe encoded.
+func randomToken() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func isNotFound(err error) bool {
+	var appErr *errors.AppError
+	return errors.As(err, &appErr) && appErr.Code == errors.CodeNotFound
+}
@@ -0,0 +1,590 @@
+package tests
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"html"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/auth/adapters/jwt"
+	"github.com/chris-alexander-pop/system-design-library/pkg/auth/authserver"
+	"github.com/chris-alexander-pop/system-design-library/pkg/auth/authserver/adapters/memory"
+	"github.com/chris-alexander-pop/system-design-library/pkg/auth/session"
+	sessionmemory "github.com/chris-alexander-pop/system-design-library/pkg/auth/session/adapters/memory"
+	"github.com/chris-alexander-pop/system-design-library/pkg/security/iam"
+	idpmemory "github.com/chris-alexander-pop/system-design-library/pkg/security/iam/provider/adapters/memory"
+	gojwt "github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	callback = "https://app.example.com/callback"
+	verifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk-extra-entropy"
+)
+
+type env struct {
+	t       *testing.T
+	srv     *authserver.Server
+	ts      *httptest.Server
+	keys    *jwt.KeySet
+	store   *memory.Store
+	userID  string
+	browser *http.Client
+}
+
+func setup(t *testing.T) *env {
+	t.Helper()
+	ctx := context.Background()
+
+	idp := idpmemory.New()
+	userID, err := idp.CreateUser(ctx, iam.User{Username: "alice", Email: "alice@example.com", Roles: []string{"admin"}}, "password")
+	if err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	keys, err := jwt.NewKeySet(ctx, jwt.KeySetConfig{Algorithm: jwt.AlgES256})
+	if err != nil {
+		t.Fatalf("NewKeySet failed: %v", err)
+	}
+	store := memory.New()
+	clients := []*authserver.Client{
+		{
+			ID:           "web",
+			Name:         "Web App",
+			SecretHash:   authserver.HashSecret("web-secret"),
+			RedirectURIs: []string{callback},
+			Scopes:       []string{"openid", "profile", "email", "offline_access"},
+			GrantTypes:   []string{authserver.GrantAuthorizationCode, authserver.GrantRefreshToken},
+		},
+		{
+			ID:           "spa",
+			RedirectURIs: []string{callback},
+			Scopes:       []string{"openid"},
+			GrantTypes:   []string{authserver.GrantAuthorizationCode},
+			FirstParty:   true,
+		},
+		{
+			ID:         "svc",
+			SecretHash: authserver.HashSecret("svc-secret"),
+			Scopes:     []string{"read", "openid"},
+			GrantTypes: []string{authserver.GrantClientCredentials},
+		},
+	}
+	for _, c := range clients {
+		if err := store.SaveClient(ctx, c); err != nil {
+			t.Fatalf("SaveClient failed: %v", err)
+		}
+	}
+
+	ts := httptest.NewServer(nil)
+	t.Cleanup(ts.Close)
+	srv, err := authserver.New(authserver.Config{
+		Issuer:   ts.URL,
+		Identity: idp,
+		Sessions: sessionmemory.New(session.Config{TTL: time.Hour}),
+		Keys:     keys,
+		Clients:  store,
+		Grants:   store,
+		Consents: store,
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	ts.Config.Handler = srv.Handler()
+
+	jar, _ := cookiejar.New(nil)
+	browser := &http.Client{
+		Jar: jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if req.URL.Host == "app.example.com" {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}
+	return &env{t: t, srv: srv, ts: ts, keys: keys, store: store, userID: userID, browser: browser}
+}
+
+func challenge(v string) string {
+	sum := sha256.Sum256([]byte(v))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+var hiddenField = regexp.MustCompile(`name="(csrf_token|request)" value="([^"]*)"`)
+
+// submit posts the form on an HTML page with extra fields.
+func (e *env) submit(page *http.Response, path string, fields url.Values) *http.Response {
+	e.t.Helper()
+	body := readBody(e.t, page)
+	form := url.Values{}
+	for _, m := range hiddenField.FindAllStringSubmatch(body, -1) {
+		form.Set(m[1], html.UnescapeString(m[2]))
+	}
+	if form.Get("csrf_token") == "" {
+		e.t.Fatalf("no form on page: %s", body)
+	}
+	for k, v := range fields {
+		form[k] = v
+	}
+	resp, err := e.browser.PostForm(e.ts.URL+path, form)
+	if err != nil {
+		e.t.Fatalf("POST %s failed: %v", path, err)
+	}
+	return resp
+}
+
+func (e *env) authorize(params url.Values) *http.Response {
+	e.t.Helper()
+	resp, err := e.browser.Get(e.ts.URL + authserver.PathAuthorize + "?" + params.Encode())
+	if err != nil {
+		e.t.Fatalf("authorize failed: %v", err)
+	}
+	return resp
+}
+
+// callbackParams returns the parameters of a redirect to the client.
+func callbackParams(t *testing.T, resp *http.Response) url.Values {
+	t.Helper()
+	resp.Body.Close()
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if resp.StatusCode != http.StatusFound || err != nil || !strings.HasPrefix(loc.String(), callback) {
+		t.Fatalf("expected redirect to client, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	return loc.Query()
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	t.Helper()
+	defer resp.Body.Close()
+	var b strings.Builder
+	buf := make([]byte, 4096)
+	for {
+		n, err := resp.Body.Read(buf)
+		b.Write(buf[:n])
+		if err != nil {
+			break
+		}
+	}
+	return b.String()
+}
+
+type tokenResult struct {
+	status int
+	body   map[string]any
+}
+
+func (r tokenResult) str(key string) string {
+	s, _ := r.body[key].(string)
+	return s
+}
+
+func (e *env) post(path, clientID, secret string, form url.Values) tokenResult {
+	e.t.Helper()
+	if secret == "" {
+		form.Set("client_id", clientID)
+	}
+	req, _ := http.NewRequest(http.MethodPost, e.ts.URL+path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if secret != "" {
+		req.SetBasicAuth(clientID, secret)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		e.t.Fatalf("POST %s failed: %v", path, err)
+	}
+	defer resp.Body.Close()
+	res := tokenResult{status: resp.StatusCode, body: map[string]any{}}
+	_ = json.NewDecoder(resp.Body).Decode(&res.body)
+	return res
+}
+
+// login signs in through the login page the response shows.
+func (e *env) login(page *http.Response) *http.Response {
+	e.t.Helper()
+	if page.StatusCode != http.StatusOK {
+		e.t.Fatalf("expected login page, got %d", page.StatusCode)
+	}
+	return e.submit(page, authserver.PathLogin, url.Values{"username": {"alice"}, "password": {"password"}})
+}
+
+func webParams() url.Values {
+	return url.Values{
+		"response_type": {"code"},
+		"client_id":     {"web"},
+		"redirect_uri":  {callback},
+		"scope":         {"openid profile email offline_access"},
+		"state":         {"xyz"},
+		"nonce":         {"n-0S6"},
+	}
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	e := setup(t)
+
+	page := e.authorize(webParams())
+	failed := e.submit(page, authserver.PathLogin, url.Values{"username": {"alice"}, "password": {"wrong"}})
+	if failed.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("wrong password: %d", failed.StatusCode)
+	}
+	consent := e.submit(failed, authserver.PathLogin, url.Values{"username": {"alice"}, "password": {"password"}})
+	if consent.StatusCode != http.StatusOK || !strings.Contains(readBodyKeep(t, consent), "Web App wants to access your account") {
+		t.Fatalf("expected consent page, got %d", consent.StatusCode)
+	}
+	params := callbackParams(t, e.submit(consent, authserver.PathConsent, url.Values{"decision": {"allow"}}))
+	if params.Get("state") != "xyz" || params.Get("iss") != e.ts.URL || params.Get("code") == "" {
+		t.Fatalf("callback = %v", params)
+	}
+
+	form := url.Values{"grant_type": {"authorization_code"}, "code": {params.Get("code")}, "redirect_uri": {callback}}
+	tok := e.post(authserver.PathToken, "web", "web-secret", form)
+	if tok.status != http.StatusOK || tok.str("token_type") != "Bearer" || tok.str("refresh_token") == "" || tok.str("id_token") == "" {
+		t.Fatalf("token response = %d %v", tok.status, tok.body)
+	}
+
+	id := gojwt.MapClaims{}
+	if err := e.keys.Parse(context.Background(), tok.str("id_token"), id); err != nil {
+		t.Fatalf("id token invalid: %v", err)
+	}
+	aud, _ := id.GetAudience()
+	if id["sub"] != e.userID || len(aud) != 1 || aud[0] != "web" || id["nonce"] != "n-0S6" || id["email"] != "alice@example.com" || id["iss"] != e.ts.URL {
+		t.Errorf("id token claims = %v", id)
+	}
+
+	claims, err := e.srv.Verify(context.Background(), tok.str("access_token"))
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if claims.Subject != e.userID || claims.Role != "admin" {
+		t.Errorf("access token claims = %+v", claims)
+	}
+	if _, err := e.srv.Verify(context.Background(), tok.str("id_token")); err == nil {
+		t.Error("ID token accepted as an access token")
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, e.ts.URL+authserver.PathUserInfo, nil)
+	req.Header.Set("Authorization", "Bearer "+tok.str("access_token"))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("userinfo failed: %v", err)
+	}
+	var info map[string]any
+	_ = json.NewDecoder(resp.Body).Decode(&info)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || info["sub"] != e.userID || info["email"] != "alice@example.com" || info["preferred_username"] != "alice" {
+		t.Errorf("userinfo = %d %v", resp.StatusCode, info)
+	}
+
+	// The session and consent are remembered.
+	again := callbackParams(t, e.authorize(webParams()))
+	if again.Get("code") == "" {
+		t.Fatalf("second authorization = %v", again)
+	}
+
+	// Replaying a code fails and revokes the tokens it granted.
+	if replay := e.post(authserver.PathToken, "web", "web-secret", form); replay.status != http.StatusBadRequest || replay.str("error") != "invalid_grant" {
+		t.Errorf("replayed code = %d %v", replay.status, replay.body)
+	}
+	refresh := e.post(authserver.PathToken, "web", "web-secret", url.Values{"grant_type": {"refresh_token"}, "refresh_token": {tok.str("refresh_token")}})
+	if refresh.str("error") != "invalid_grant" {
+		t.Errorf("refresh after code replay = %v", refresh.body)
+	}
+}
+
+// readBodyKeep reads a body and puts it back for a later submit.
+func readBodyKeep(t *testing.T, resp *http.Response) string {
+	body := readBody(t, resp)
+	resp.Body = readCloser{strings.NewReader(body)}
+	return body
+}
+
+type readCloser struct{ *strings.Reader }
+
+func (readCloser) Close() error { return nil }
+
+func TestAuthorizeErrors(t *testing.T) {
+	e := setup(t)
+
+	bad := webParams()
+	bad.Set("redirect_uri", "https://evil.example.com/cb")
+	if resp := e.authorize(bad); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unregistered redirect_uri = %d", resp.StatusCode)
+	}
+
+	bad = webParams()
+	bad.Set("scope", "openid admin")
+	if p := callbackParams(t, e.authorize(bad)); p.Get("error") != "invalid_scope" || p.Get("state") != "xyz" {
+		t.Errorf("unknown scope = %v", p)
+	}
+
+	none := webParams()
+	none.Set("prompt", "none")
+	if p := callbackParams(t, e.authorize(none)); p.Get("error") != "login_required" {
+		t.Errorf("prompt=none without session = %v", p)
+	}
+
+	// Public clients must use PKCE with S256.
+	spa := url.Values{"response_type": {"code"}, "client_id": {"spa"}, "scope": {"openid"}}
+	if p := callbackParams(t, e.authorize(spa)); p.Get("error") != "invalid_request" {
+		t.Errorf("public client without PKCE = %v", p)
+	}
+	spa.Set("code_challenge", verifier)
+	spa.Set("code_challenge_method", "plain")
+	if p := callbackParams(t, e.authorize(spa)); p.Get("error") != "invalid_request" {
+		t.Errorf("plain PKCE = %v", p)
+	}
+
+	// Forms without the CSRF cookie are rejected.
+	page := e.authorize(webParams())
+	body := readBody(t, page)
+	form := url.Values{"username": {"alice"}, "password": {"password"}}
+	for _, m := range hiddenField.FindAllStringSubmatch(body, -1) {
+		form.Set(m[1], html.UnescapeString(m[2]))
+	}
+	resp, err := http.PostForm(e.ts.URL+authserver.PathLogin, form)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("login without CSRF cookie = %d", resp.StatusCode)
+	}
+
+	// Denying consent is reported to the client.
+	consent := e.login(e.authorize(webParams()))
+	if p := callbackParams(t, e.submit(consent, authserver.PathConsent, url.Values{"decision": {"deny"}})); p.Get("error") != "access_denied" {
+		t.Errorf("denied consent = %v", p)
+	}
+	none.Set("prompt", "none")
+	if p := callbackParams(t, e.authorize(none)); p.Get("error") != "consent_required" {
+		t.Errorf("prompt=none without consent = %v", p)
+	}
+}
+
+func TestPKCE(t *testing.T) {
+	e := setup(t)
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"spa"},
+		"scope":                 {"openid"},
+		"code_challenge":        {challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	// First-party clients skip consent.
+	code := callbackParams(t, e.login(e.authorize(params))).Get("code")
+
+	exchange := func(code, v string) tokenResult {
+		form := url.Values{"grant_type": {"authorization_code"}, "code": {code}}
+		if v != "" {
+			form.Set("code_verifier", v)
+		}
+		return e.post(authserver.PathToken, "spa", "", form)
+	}
+	if r := exchange(code, ""); r.str("error") != "invalid_grant" {
+		t.Errorf("missing verifier = %v", r.body)
+	}
+	code = callbackParams(t, e.authorize(params)).Get("code")
+	if r := exchange(code, strings.Repeat("x", 43)); r.str("error") != "invalid_grant" {
+		t.Errorf("wrong verifier = %v", r.body)
+	}
+	code = callbackParams(t, e.authorize(params)).Get("code")
+	r := exchange(code, verifier)
+	if r.status != http.StatusOK || r.str("access_token") == "" || r.str("refresh_token") != "" {
+		t.Errorf("valid verifier = %d %v", r.status, r.body)
+	}
+
+	// Public clients cannot authenticate with a secret.
+	if r := e.post(authserver.PathToken, "spa", "guess", url.Values{"grant_type": {"authorization_code"}, "code": {"x"}}); r.status != http.StatusUnauthorized {
+		t.Errorf("public client with secret = %d", r.status)
+	}
+}
+
+func TestCodeExchangeChecks(t *testing.T) {
+	e := setup(t)
+	resp := e.authorize(webParams())
+	code := callbackParams(t, e.submit(e.login(resp), authserver.PathConsent, url.Values{"decision": {"allow"}})).Get("code")
+
+	// A code presented by another client is rejected without using it up.
+	stolen := url.Values{"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {callback}, "code_verifier": {verifier}}
+	if r := e.post(authserver.PathToken, "spa", "", stolen); r.str("error") != "invalid_grant" {
+		t.Errorf("code of another client = %v", r.body)
+	}
+	form := url.Values{"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {callback}}
+	if r := e.post(authserver.PathToken, "web", "web-secret", form); r.status != http.StatusOK {
+		t.Errorf("exchange after another client's attempt = %d %v", r.status, r.body)
+	}
+
+	// redirect_uri must be repeated if the authorization request had it.
+	code = callbackParams(t, e.authorize(webParams())).Get("code")
+	if r := e.post(authserver.PathToken, "web", "web-secret", url.Values{"grant_type": {"authorization_code"}, "code": {code}}); r.str("error") != "invalid_request" {
+		t.Errorf("missing redirect_uri = %v", r.body)
+	}
+
+	// It may be left out if it defaulted to the only registered one.
+	params := webParams()
+	params.Del("redirect_uri")
+	code = callbackParams(t, e.authorize(params)).Get("code")
+	if r := e.post(authserver.PathToken, "web", "web-secret", url.Values{"grant_type": {"authorization_code"}, "code": {code}}); r.status != http.StatusOK {
+		t.Errorf("defaulted redirect_uri = %d %v", r.status, r.body)
+	}
+}
+
+// codeTokens runs the authorization code flow for the web client.
+func (e *env) codeTokens() tokenResult {
+	e.t.Helper()
+	resp := e.authorize(webParams())
+	if resp.Header.Get("Location") == "" {
+		page := e.login(resp)
+		if page.StatusCode == http.StatusOK {
+			resp = e.submit(page, authserver.PathConsent, url.Values{"decision": {"allow"}})
+		} else {
+			resp = page
+		}
+	}
+	code := callbackParams(e.t, resp).Get("code")
+	tok := e.post(authserver.PathToken, "web", "web-secret", url.Values{"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {callback}})
+	if tok.status != http.StatusOK {
+		e.t.Fatalf("token exchange = %d %v", tok.status, tok.body)
+	}
+	return tok
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	e := setup(t)
+	first := e.codeTokens()
+
+	refresh := func(token, scope string) tokenResult {
+		form := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {token}}
+		if scope != "" {
+			form.Set("scope", scope)
+		}
+		return e.post(authserver.PathToken, "web", "web-secret", form)
+	}
+
+	second := refresh(first.str("refresh_token"), "openid email")
+	if second.status != http.StatusOK || second.str("refresh_token") == first.str("refresh_token") || second.str("scope") != "openid email" {
+		t.Fatalf("refresh = %d %v", second.status, second.body)
+	}
+	if r := refresh(second.str("refresh_token"), "openid admin"); r.str("error") != "invalid_scope" {
+		t.Errorf("widened scope = %v", r.body)
+	}
+
+	// Reusing a rotated token revokes the family, including the latest.
+	third := refresh(second.str("refresh_token"), "")
+	if third.status != http.StatusOK {
+		t.Fatalf("refresh = %d %v", third.status, third.body)
+	}
+	if r := refresh(first.str("refresh_token"), ""); r.str("error") != "invalid_grant" {
+		t.Errorf("reused token = %v", r.body)
+	}
+	if r := refresh(third.str("refresh_token"), ""); r.str("error") != "invalid_grant" {
+		t.Errorf("latest token after reuse = %v", r.body)
+	}
+
+	// Another user session's family is unaffected.
+	other := e.codeTokens()
+	if r := refresh(other.str("refresh_token"), ""); r.status != http.StatusOK {
+		t.Errorf("unrelated family = %d %v", r.status, r.body)
+	}
+}
+
+func TestClientCredentials(t *testing.T) {
+	e := setup(t)
+	form := url.Values{"grant_type": {"client_credentials"}, "scope": {"read"}}
+
+	tok := e.post(authserver.PathToken, "svc", "svc-secret", form)
+	if tok.status != http.StatusOK || tok.str("refresh_token") != "" || tok.str("id_token") != "" || tok.str("scope") != "read" {
+		t.Fatalf("client credentials = %d %v", tok.status, tok.body)
+	}
+	claims, err := e.srv.Verify(context.Background(), tok.str("access_token"))
+	if err != nil || claims.Subject != "svc" {
+		t.Errorf("Verify = %+v, %v", claims, err)
+	}
+
+	if r := e.post(authserver.PathToken, "svc", "wrong", form); r.status != http.StatusUnauthorized || r.str("error") != "invalid_client" {
+		t.Errorf("wrong secret = %d %v", r.status, r.body)
+	}
+	if r := e.post(authserver.PathToken, "svc", "svc-secret", url.Values{"grant_type": {"client_credentials"}, "scope": {"openid"}}); r.str("error") != "invalid_scope" {
+		t.Errorf("openid for a client = %v", r.body)
+	}
+	if r := e.post(authserver.PathToken, "web", "web-secret", form); r.str("error") != "unauthorized_client" {
+		t.Errorf("grant not allowed = %v", r.body)
+	}
+	if r := e.post(authserver.PathToken, "svc", "svc-secret", url.Values{"grant_type": {"password"}}); r.str("error") != "unsupported_grant_type" {
+		t.Errorf("password grant = %v", r.body)
+	}
+}
+
+func TestIntrospectionAndRevocation(t *testing.T) {
+	e := setup(t)
+	tok := e.codeTokens()
+
+	introspect := func(token string) tokenResult {
+		return e.post(authserver.PathIntrospect, "svc", "svc-secret", url.Values{"token": {token}})
+	}
+	r := introspect(tok.str("access_token"))
+	if r.body["active"] != true || r.str("client_id") != "web" || r.str("sub") != e.userID {
+		t.Errorf("introspect access token = %v", r.body)
+	}
+	if r := introspect(tok.str("refresh_token")); r.body["active"] != true || r.str("token_type") != "refresh_token" {
+		t.Errorf("introspect refresh token = %v", r.body)
+	}
+	if r := introspect("garbage"); r.body["active"] != false {
+		t.Errorf("introspect garbage = %v", r.body)
+	}
+	if r := e.post(authserver.PathIntrospect, "spa", "", url.Values{"token": {tok.str("access_token")}}); r.str("error") != "unauthorized_client" {
+		t.Errorf("public client introspection = %v", r.body)
+	}
+
+	// Only the client a token was issued to can revoke it.
+	if r := e.post(authserver.PathRevoke, "svc", "svc-secret", url.Values{"token": {tok.str("access_token")}}); r.status != http.StatusOK {
+		t.Errorf("revoke by other client = %d", r.status)
+	}
+	if r := introspect(tok.str("access_token")); r.body["active"] != true {
+		t.Error("token revoked by another client")
+	}
+
+	if r := e.post(authserver.PathRevoke, "web", "web-secret", url.Values{"token": {tok.str("access_token")}}); r.status != http.StatusOK {
+		t.Errorf("revoke access token = %d", r.status)
+	}
+	if r := introspect(tok.str("access_token")); r.body["active"] != false {
+		t.Errorf("revoked access token = %v", r.body)
+	}
+	if _, err := e.srv.Verify(context.Background(), tok.str("access_token")); err == nil {
+		t.Error("revoked access token verified")
+	}
+
+	if r := e.post(authserver.PathRevoke, "web", "web-secret", url.Values{"token": {tok.str("refresh_token")}}); r.status != http.StatusOK {
+		t.Errorf("revoke refresh token = %d", r.status)
+	}
+	if r := introspect(tok.str("refresh_token")); r.body["active"] != false {
+		t.Errorf("revoked refresh token = %v", r.body)
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	e := setup(t)
+
+	resp, err := http.Get(e.ts.URL + authserver.PathDiscovery)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	var doc map[string]any
+	_ = json.NewDecoder(resp.Body).Decode(&doc)
+	resp.Body.Close()
+	if doc["issuer"] != e.ts.URL || doc["token_endpoint"] != e.ts.URL+authserver.PathToken || doc["jwks_uri"] != e.ts.URL+jwt.JWKSPath {
+		t.Errorf("discovery = %v", doc)
+	}
+
+	verifier := jwt.NewRemoteVerifier(jwt.RemoteConfig{JWKSURL: doc["jwks_uri"].(string), Issuer: e.ts.URL})
+	tok := e.post(authserver.PathToken, "svc", "svc-secret", url.Values{"grant_type": {"client_credentials"}})
+	if _, err := verifier.Verify(context.Background(), tok.str("access_token")); err != nil {
+		t.Errorf("access token not verifiable from the JWKS: %v", err)
+	}
+}
@@ -0,0 +1,360 @@
+package authserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+	"github.com/chris-alexander-pop/system-design-library/pkg/security/iam"
+	gojwt "github.com/golang-jwt/jwt/v5"
+)
+
+// accessClaims are the claims of an access token (RFC 9068).
+type accessClaims struct {
+	gojwt.RegisteredClaims
+	ClientID string   `json:"client_id"`
+	Scope    string   `json:"scope,omitempty"`
+	Email    string   `json:"email,omitempty"`
+	Username string   `json:"preferred_username,omitempty"`
+	Roles    []string `json:"roles,omitempty"`
+}
+
+// idClaims are the claims of an ID token.
+type idClaims struct {
+	gojwt.RegisteredClaims
+	AuthTime int64    `json:"auth_time,omitempty"`
+	Nonce    string   `json:"nonce,omitempty"`
+	AZP      string   `json:"azp"`
+	Email    string   `json:"email,omitempty"`
+	Username string   `json:"preferred_username,omitempty"`
+	Roles    []string `json:"roles,omitempty"`
+}
+
+// tokenResponse is a successful token endpoint response.
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// grant is what a token request is granted.
+type grant struct {
+	client   *Client
+	user     *iam.User // nil for client credentials
+	scopes   []string
+	family   string
+	nonce    string
+	authTime time.Time
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	client, oerr := s.authenticateClient(r)
+	if oerr != nil {
+		writeError(w, oerr)
+		return
+	}
+
+	var g *grant
+	switch grantType := r.PostForm.Get("grant_type"); grantType {
+	case GrantAuthorizationCode:
+		g, oerr = s.exchangeCode(r, client)
+	case GrantRefreshToken:
+		g, oerr = s.exchangeRefreshToken(r, client)
+	case GrantClientCredentials:
+		g, oerr = s.clientCredentials(r, client)
+	case "":
+		oerr = invalidRequest("grant_type is required")
+	default:
+		oerr = unsupportedGrantType("unsupported grant type: " + grantType)
+	}
+	if oerr != nil {
+		writeError(w, oerr)
+		return
+	}
+
+	resp, err := s.issue(r.Context(), g)
+	if err != nil {
+		logger.L().ErrorContext(r.Context(), "failed to issue tokens", "client_id", client.ID, "error", err)
+		writeError(w, serverError())
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) exchangeCode(r *http.Request, client *Client) (*grant, *oauthError) {
+	ctx := r.Context()
+	if !client.allows(GrantAuthorizationCode) {
+		return nil, unauthorizedClient("client may not use the authorization code grant")
+	}
+	code := r.PostForm.Get("code")
+	if code == "" {
+		return nil, invalidRequest("code is required")
+	}
+
+	ac, err := s.cfg.Grants.UseCode(ctx, hashToken(code), client.ID)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, invalidGrant("invalid or expired authorization code")
+		}
+		logger.L().ErrorContext(ctx, "failed to load authorization code", "error", err)
+		return nil, serverError()
+	}
+	if ac.ClientID != client.ID {
+		return nil, invalidGrant("authorization code was issued to another client")
+	}
+	if ac.Used {
+		// A replayed code may have been stolen: revoke what it granted.
+		logger.L().WarnContext(ctx, "authorization code reused", "client_id", client.ID, "user_id", ac.User.ID)
+		if err := s.cfg.Grants.RevokeFamily(ctx, ac.Family); err != nil {
+			logger.L().ErrorContext(ctx, "failed to revoke tokens of reused code", "error", err)
+		}
+		return nil, invalidGrant("authorization code already used")
+	}
+	// RFC 6749 section 4.1.3: redirect_uri is required if the
+	// authorization request included it.
+	uri := r.PostForm.Get("redirect_uri")
+	if uri == "" && ac.RedirectURIGiven {
+		return nil, invalidRequest("redirect_uri is required")
+	}
+	if uri != "" && uri != ac.RedirectURI {
+		return nil, invalidGrant("redirect_uri does not match the authorization request")
+	}
+
+	verifier := r.PostForm.Get("code_verifier")
+	switch {
+	case ac.CodeChallenge != "" && verifier == "":
+		return nil, invalidGrant("code_verifier is required")
+	case ac.CodeChallenge == "" && verifier != "":
+		return nil, invalidGrant("code_verifier given without code_challenge")
+	case ac.CodeChallenge != "" && !verifyPKCE(verifier, ac.CodeChallenge):
+		return nil, invalidGrant("code_verifier does not match code_challenge")
+	}
+
+	user := ac.User
+	return &grant{
+		client:   client,
+		user:     &user,
+		scopes:   ac.Scopes,
+		family:   ac.Family,
+		nonce:    ac.Nonce,
+		authTime: ac.AuthTime,
+	}, nil
+}
+
+func (s *Server) exchangeRefreshToken(r *http.Request, client *Client) (*grant, *oauthError) {
+	ctx := r.Context()
+	if !client.allows(GrantRefreshToken) {
+		return nil, unauthorizedClient("client may not use the refresh token grant")
+	}
+	token := r.PostForm.Get("refresh_token")
+	if token == "" {
+		return nil, invalidRequest("refresh_token is required")
+	}
+
+	rt, err := s.cfg.Grants.GetRefreshToken(ctx, hashToken(token))
+	if err != nil {
+		if isNotFound(err) {
+			return nil, invalidGrant("invalid or expired refresh token")
+		}
+		logger.L().ErrorContext(ctx, "failed to load refresh token", "error", err)
+		return nil, serverError()
+	}
+	if rt.ClientID != client.ID {
+		return nil, invalidGrant("refresh token was issued to another client")
+	}
+
+	scopes := rt.Scopes
+	if scope := r.PostForm.Get("scope"); scope != "" {
+		scopes = parseScopes(scope)
+		for _, sc := range scopes {
+			if !slices.Contains(rt.Scopes, sc) {
+				return nil, invalidScope("scope exceeds the original grant: " + sc)
+			}
+		}
+	}
+
+	// Consume the token only once the request is known to be valid.
+	if !rt.Used {
+		if rt, err = s.cfg.Grants.UseRefreshToken(ctx, rt.Token); err != nil {
+			if isNotFound(err) {
+				return nil, invalidGrant("invalid or expired refresh token")
+			}
+			logger.L().ErrorContext(ctx, "failed to use refresh token", "error", err)
+			return nil, serverError()
+		}
+	}
+	if rt.Used {
+		// Only one holder can have the latest token, so either the client
+		// or an attacker is replaying a rotated one: end the family.
+		logger.L().WarnContext(ctx, "refresh token reused", "client_id", client.ID, "user_id", rt.User.ID)
+		if err := s.cfg.Grants.RevokeFamily(ctx, rt.Family); err != nil {
+			logger.L().ErrorContext(ctx, "failed to revoke reused refresh token family", "error", err)
+		}
+		return nil, invalidGrant("refresh token already used")
+	}
+
+	user := rt.User
+	return &grant{
+		client:   client,
+		user:     &user,
+		scopes:   scopes,
+		family:   rt.Family,
+		authTime: rt.AuthTime,
+	}, nil
+}
+
+func (s *Server) clientCredentials(r *http.Request, client *Client) (*grant, *oauthError) {
+	if client.Public() {
+		return nil, unauthorizedClient("public clients may not use the client credentials grant")
+	}
+	if !client.allows(GrantClientCredentials) {
+		return nil, unauthorizedClient("client may not use the client credentials grant")
+	}
+	scopes := parseScopes(r.PostForm.Get("scope"))
+	if oerr := checkScopes(client, scopes); oerr != nil {
+		return nil, oerr
+	}
+	for _, scope := range []string{ScopeOpenID, ScopeOfflineAccess} {
+		if slices.Contains(scopes, scope) {
+			return nil, invalidScope(scope + " requires a user")
+		}
+	}
+	return &grant{client: client, scopes: scopes}, nil
+}
+
+// issue signs the tokens of a grant. Refresh tokens are issued to users
+// of clients allowed the refresh token grant, ID tokens for the openid
+// scope.
+func (s *Server) issue(ctx context.Context, g *grant) (*tokenResponse, error) {
+	now := time.Now()
+	scope := strings.Join(g.scopes, " ")
+
+	at := accessClaims{
+		RegisteredClaims: gojwt.RegisteredClaims{
+			Issuer:    s.cfg.Issuer,
+			Subject:   g.client.ID,
+			IssuedAt:  gojwt.NewNumericDate(now),
+			ExpiresAt: gojwt.NewNumericDate(now.Add(s.cfg.AccessTokenTTL)),
+			ID:        randomToken(),
+		},
+		ClientID: g.client.ID,
+		Scope:    scope,
+	}
+	if s.cfg.Audience != "" {
+		at.Audience = gojwt.ClaimStrings{s.cfg.Audience}
+	}
+	if g.user != nil {
+		at.Subject = g.user.ID
+		at.Email, at.Username, at.Roles = userClaims(g.user, g.scopes)
+	}
+	access, err := s.cfg.Keys.Sign(at)
+	if err != nil {
+		return nil, err
+	}
+	resp := &tokenResponse{
+		AccessToken: access,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(s.cfg.AccessTokenTTL.Seconds()),
+		Scope:       scope,
+	}
+	if g.user == nil {
+		return resp, nil
+	}
+
+	if g.client.allows(GrantRefreshToken) {
+		refresh := randomToken()
+		err := s.cfg.Grants.SaveRefreshToken(ctx, &RefreshToken{
+			Token:     hashToken(refresh),
+			Family:    g.family,
+			ClientID:  g.client.ID,
+			User:      *g.user,
+			Scopes:    g.scopes,
+			AuthTime:  g.authTime,
+			ExpiresAt: now.Add(s.cfg.RefreshTokenTTL),
+		})
+		if err != nil {
+			return nil, err
+		}
+		resp.RefreshToken = refresh
+	}
+
+	if slices.Contains(g.scopes, ScopeOpenID) {
+		id := idClaims{
+			RegisteredClaims: gojwt.RegisteredClaims{
+				Issuer:    s.cfg.Issuer,
+				Subject:   g.user.ID,
+				Audience:  gojwt.ClaimStrings{g.client.ID},
+				IssuedAt:  gojwt.NewNumericDate(now),
+				ExpiresAt: gojwt.NewNumericDate(now.Add(s.cfg.IDTokenTTL)),
+			},
+			AuthTime: g.authTime.Unix(),
+			Nonce:    g.nonce,
+			AZP:      g.client.ID,
+		}
+		id.Email, id.Username, id.Roles = userClaims(g.user, g.scopes)
+		if resp.IDToken, err = s.cfg.Keys.Sign(id); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// userClaims returns the user's claims released by the granted scopes.
+func userClaims(user *iam.User, scopes []string) (email, username string, roles []string) {
+	if slices.Contains(scopes, ScopeEmail) {
+		email = user.Email
+	}
+	if slices.Contains(scopes, ScopeProfile) {
+		username, roles = user.Username, user.Roles
+	}
+	return email, username, roles
+}
+
+// verifyAccessToken verifies an access token issued by the server and not
+// revoked. ID tokens, which carry no client_id, are rejected.
+func (s *Server) verifyAccessToken(ctx context.Context, token string) (*accessClaims, error) {
+	claims := &accessClaims{}
+	if err := s.cfg.Keys.Parse(ctx, token, claims, gojwt.WithIssuer(s.cfg.Issuer), gojwt.WithExpirationRequired()); err != nil {
+		return nil, err
+	}
+	if claims.ClientID == "" || claims.ID == "" {
+		return nil, invalidToken("not an access token")
+	}
+	revoked, err := s.cfg.Grants.IsAccessTokenRevoked(ctx, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, invalidToken("access token revoked")
+	}
+	return claims, nil
+}
+
+// verifyPKCE checks an S256 code verifier (RFC 7636).
+func verifyPKCE(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// hashToken hashes a code or refresh token for storage, so a leaked store
+// does not leak usable tokens.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
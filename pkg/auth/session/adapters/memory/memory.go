@@ -2,29 +2,35 @@ package memory
 
 import (
 	"context"
+	"slices"
 	"time"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/auth/session"
 	"github.com/chris-alexander-pop/system-design-library/pkg/concurrency"
 	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
-	"github.com/google/uuid"
 )
 
 // SessionManager implements session.Manager using in-memory storage.
+// Sessions are indexed by user, and every operation holds the lock for its
+// whole duration, so session limits are enforced atomically.
 type SessionManager struct {
 	sessions map[string]*session.Session
+	byUser   map[string]map[string]struct{}
 	mu       *concurrency.SmartRWMutex
-	ttl      time.Duration
+	cfg      session.Config
 }
 
+var _ session.Manager = (*SessionManager)(nil)
+
 // New creates a new in-memory session manager.
 func New(cfg session.Config) *SessionManager {
 	return &SessionManager{
 		sessions: make(map[string]*session.Session),
+		byUser:   make(map[string]map[string]struct{}),
 		mu: concurrency.NewSmartRWMutex(concurrency.MutexConfig{
 			Name: "memory-session-manager",
 		}),
-		ttl: cfg.TTL,
+		cfg: cfg,
 	}
 }
 
@@ -32,63 +38,141 @@ func (m *SessionManager) Create(ctx context.Context, userID string, metadata map
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	id := uuid.NewString()
-	now := time.Now()
-	s := &session.Session{
-		ID:        id,
-		UserID:    userID,
-		CreatedAt: now,
-		ExpiresAt: now.Add(m.ttl),
-		Metadata:  metadata,
+	s := m.cfg.NewSession(ctx, userID, metadata)
+	if m.cfg.MaxSessions > 0 {
+		active := m.userSessions(userID, s.CreatedAt)
+		if len(active) >= m.cfg.MaxSessions && m.cfg.RejectOverLimit {
+			return nil, errors.Conflict("too many sessions", nil)
+		}
+		for len(active) >= m.cfg.MaxSessions {
+			m.remove(active[0])
+			active = active[1:]
+		}
 	}
 
-	m.sessions[id] = s
-	return s, nil
+	m.sessions[s.ID] = s
+	if m.byUser[userID] == nil {
+		m.byUser[userID] = make(map[string]struct{})
+	}
+	m.byUser[userID][s.ID] = struct{}{}
+	return session.Clone(s), nil
 }
 
 func (m *SessionManager) Get(ctx context.Context, sessionID string) (*session.Session, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	s, ok := m.sessions[sessionID]
-	if !ok {
-		return nil, errors.NotFound("session not found", nil)
+	s, err := m.get(ctx, sessionID, time.Now())
+	if err != nil {
+		return nil, err
 	}
+	return session.Clone(s), nil
+}
 
-	if time.Now().After(s.ExpiresAt) {
-		delete(m.sessions, sessionID)
-		return nil, errors.NotFound("session expired", nil)
+func (m *SessionManager) Delete(ctx context.Context, sessionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s, ok := m.sessions[sessionID]; ok {
+		m.remove(s)
 	}
+	// Idempotent delete
+	return nil
+}
 
-	return s, nil
+func (m *SessionManager) Refresh(ctx context.Context, sessionID string) (*session.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	s, err := m.get(ctx, sessionID, now)
+	if err != nil {
+		return nil, err
+	}
+	m.cfg.Touch(s, now)
+	return session.Clone(s), nil
 }
 
-func (m *SessionManager) Delete(ctx context.Context, sessionID string) error {
+func (m *SessionManager) List(ctx context.Context, userID string) ([]*session.Session, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if _, ok := m.sessions[sessionID]; !ok {
-		// Idempotent delete
-		return nil
+	active := m.userSessions(userID, time.Now())
+	out := make([]*session.Session, len(active))
+	for i, s := range active {
+		out[i] = session.Clone(s)
+	}
+	return out, nil
+}
+
+func (m *SessionManager) DeleteAll(ctx context.Context, userID string, except ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id := range m.byUser[userID] {
+		if !slices.Contains(except, id) {
+			m.remove(m.sessions[id])
+		}
 	}
-	delete(m.sessions, sessionID)
 	return nil
 }
 
-func (m *SessionManager) Refresh(ctx context.Context, sessionID string) (*session.Session, error) {
+func (m *SessionManager) Rotate(ctx context.Context, sessionID string, metadata map[string]interface{}) (*session.Session, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	now := time.Now()
+	s, err := m.get(ctx, sessionID, now)
+	if err != nil {
+		return nil, err
+	}
+	rotated := m.cfg.Rotated(s, metadata, now)
+	m.remove(s)
+	m.sessions[rotated.ID] = rotated
+	if m.byUser[rotated.UserID] == nil {
+		m.byUser[rotated.UserID] = make(map[string]struct{})
+	}
+	m.byUser[rotated.UserID][rotated.ID] = struct{}{}
+	return session.Clone(rotated), nil
+}
+
+// get returns a live session, dropping it if it has expired. The caller
+// must hold the write lock.
+func (m *SessionManager) get(ctx context.Context, sessionID string, now time.Time) (*session.Session, error) {
 	s, ok := m.sessions[sessionID]
 	if !ok {
 		return nil, errors.NotFound("session not found", nil)
 	}
+	if err := m.cfg.Check(ctx, s, now); err != nil {
+		var appErr *errors.AppError
+		if errors.As(err, &appErr) && appErr.Code == errors.CodeNotFound {
+			m.remove(s)
+		}
+		return nil, err
+	}
+	return s, nil
+}
 
-	if time.Now().After(s.ExpiresAt) {
-		delete(m.sessions, sessionID)
-		return nil, errors.NotFound("session expired", nil)
+// userSessions returns the live sessions of a user, oldest first, dropping
+// expired ones. The caller must hold the write lock.
+func (m *SessionManager) userSessions(userID string, now time.Time) []*session.Session {
+	var active []*session.Session
+	for id := range m.byUser[userID] {
+		s := m.sessions[id]
+		if !now.Before(s.ExpiresAt) {
+			m.remove(s)
+			continue
+		}
+		active = append(active, s)
 	}
+	slices.SortFunc(active, func(a, b *session.Session) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return active
+}
 
-	s.ExpiresAt = time.Now().Add(m.ttl)
-	return s, nil
+func (m *SessionManager) remove(s *session.Session) {
+	delete(m.sessions, s.ID)
+	delete(m.byUser[s.UserID], s.ID)
+	if len(m.byUser[s.UserID]) == 0 {
+		delete(m.byUser, s.UserID)
+	}
 }
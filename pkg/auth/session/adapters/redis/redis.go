@@ -4,25 +4,35 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/auth/session"
 	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
-	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 )
 
+// txRetries bounds how often an optimistic transaction is retried when a
+// watched key changes underneath it.
+const txRetries = 5
+
 // SessionManager implements session.Manager using Redis.
+//
+// Each session is stored under its own key, expiring with the session, and
+// indexed in a per-user sorted set scored by creation time. Operations
+// spanning both are WATCH/MULTI transactions on the keys they read.
 type SessionManager struct {
 	client *redis.Client
-	ttl    time.Duration
+	cfg    session.Config
 }
 
+var _ session.Manager = (*SessionManager)(nil)
+
 // New creates a new Redis session manager.
 func New(client *redis.Client, cfg session.Config) *SessionManager {
 	return &SessionManager{
 		client: client,
-		ttl:    cfg.TTL,
+		cfg:    cfg,
 	}
 }
 
@@ -30,103 +40,287 @@ func (m *SessionManager) key(sessionID string) string {
 	return fmt.Sprintf("auth:session:%s", sessionID)
 }
 
-func (m *SessionManager) Create(ctx context.Context, userID string, metadata map[string]interface{}) (*session.Session, error) {
-	id := uuid.NewString()
-	now := time.Now()
-
-	s := &session.Session{
-		ID:        id,
-		UserID:    userID,
-		CreatedAt: now,
-		ExpiresAt: now.Add(m.ttl),
-		Metadata:  metadata,
-	}
+func (m *SessionManager) userKey(userID string) string {
+	return fmt.Sprintf("auth:session:user:%s", userID)
+}
 
+func (m *SessionManager) Create(ctx context.Context, userID string, metadata map[string]interface{}) (*session.Session, error) {
+	s := m.cfg.NewSession(ctx, userID, metadata)
 	data, err := json.Marshal(s)
 	if err != nil {
 		return nil, errors.Internal("failed to marshal session", err)
 	}
 
-	if err := m.client.Set(ctx, m.key(id), data, m.ttl).Err(); err != nil {
-		return nil, errors.Internal("failed to save session to redis", err)
-	}
+	index := m.userKey(userID)
+	err = m.watch(ctx, func(tx *redis.Tx) error {
+		active, stale, err := m.load(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+		var evict []string
+		if m.cfg.MaxSessions > 0 {
+			if len(active) >= m.cfg.MaxSessions && m.cfg.RejectOverLimit {
+				return errors.Conflict("too many sessions", nil)
+			}
+			for len(active) >= m.cfg.MaxSessions {
+				evict = append(evict, active[0].ID)
+				active = active[1:]
+			}
+		}
 
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, id := range evict {
+				pipe.Del(ctx, m.key(id))
+			}
+			if removed := append(stale, evict...); len(removed) > 0 {
+				pipe.ZRem(ctx, index, toMembers(removed)...)
+			}
+			pipe.Set(ctx, m.key(s.ID), data, time.Until(s.ExpiresAt))
+			pipe.ZAdd(ctx, index, redis.Z{Score: float64(s.CreatedAt.UnixMilli()), Member: s.ID})
+			pipe.Expire(ctx, index, m.indexTTL())
+			return nil
+		})
+		return err
+	}, index)
+	if err != nil {
+		return nil, wrap(err, "failed to save session to redis")
+	}
 	return s, nil
 }
 
 func (m *SessionManager) Get(ctx context.Context, sessionID string) (*session.Session, error) {
-	data, err := m.client.Get(ctx, m.key(sessionID)).Bytes()
-	if err == redis.Nil {
-		return nil, errors.NotFound("session not found", nil)
-	}
+	s, err := m.get(ctx, m.client, sessionID)
 	if err != nil {
-		return nil, errors.Internal("failed to get session from redis", err)
+		return nil, err
 	}
-
-	var s session.Session
-	if err := json.Unmarshal(data, &s); err != nil {
-		return nil, errors.Internal("failed to unmarshal session", err)
+	if err := m.cfg.Check(ctx, s, time.Now()); err != nil {
+		return nil, err
 	}
-
-	return &s, nil
+	return s, nil
 }
 
 func (m *SessionManager) Delete(ctx context.Context, sessionID string) error {
-	if err := m.client.Del(ctx, m.key(sessionID)).Err(); err != nil {
-		return errors.Internal("failed to delete session from redis", err)
+	key := m.key(sessionID)
+	err := m.watch(ctx, func(tx *redis.Tx) error {
+		s, err := m.get(ctx, tx, sessionID)
+		if err != nil {
+			if isNotFound(err) {
+				// Idempotent delete
+				return nil
+			}
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key)
+			pipe.ZRem(ctx, m.userKey(s.UserID), sessionID)
+			return nil
+		})
+		return err
+	}, key)
+	if err != nil {
+		return wrap(err, "failed to delete session from redis")
 	}
 	return nil
 }
 
 func (m *SessionManager) Refresh(ctx context.Context, sessionID string) (*session.Session, error) {
-	// Optimistic concurrency could be better, but for sessions usually read-modify-write is okay
-	// or just updating TTL. However, we store ExpiresAt inside the struct, so we must update the struct.
-
-	// Transaction?
 	key := m.key(sessionID)
-
-	// Watch the key
 	var s *session.Session
-	err := m.client.Watch(ctx, func(tx *redis.Tx) error {
-		data, err := tx.Get(ctx, key).Bytes()
-		if err == redis.Nil {
-			return errors.NotFound("session not found", nil)
+	err := m.watch(ctx, func(tx *redis.Tx) error {
+		current, err := m.get(ctx, tx, sessionID)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if err := m.cfg.Check(ctx, current, now); err != nil {
+			return err
 		}
+		m.cfg.Touch(current, now)
+		data, err := json.Marshal(current)
 		if err != nil {
 			return err
 		}
 
-		var current session.Session
-		if err := json.Unmarshal(data, &current); err != nil {
-			return err
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, time.Until(current.ExpiresAt))
+			pipe.Expire(ctx, m.userKey(current.UserID), m.indexTTL())
+			return nil
+		})
+		s = current
+		return err
+	}, key)
+	if err != nil {
+		return nil, wrap(err, "failed to refresh session")
+	}
+	return s, nil
+}
+
+func (m *SessionManager) List(ctx context.Context, userID string) ([]*session.Session, error) {
+	active, stale, err := m.load(ctx, m.client, userID)
+	if err != nil {
+		return nil, wrap(err, "failed to list sessions")
+	}
+	if len(stale) > 0 {
+		// The keys of stale members are gone, so removing them races with
+		// nothing.
+		if err := m.client.ZRem(ctx, m.userKey(userID), toMembers(stale)...).Err(); err != nil {
+			return nil, errors.Internal("failed to prune session index", err)
 		}
+	}
+	return active, nil
+}
 
-		// Update expiration
-		current.ExpiresAt = time.Now().Add(m.ttl)
-		s = &current
+func (m *SessionManager) DeleteAll(ctx context.Context, userID string, except ...string) error {
+	index := m.userKey(userID)
+	err := m.watch(ctx, func(tx *redis.Tx) error {
+		ids, err := tx.ZRange(ctx, index, 0, -1).Result()
+		if err != nil {
+			return err
+		}
+		ids = slices.DeleteFunc(ids, func(id string) bool { return slices.Contains(except, id) })
+		if len(ids) == 0 {
+			return nil
+		}
+		keys := make([]string, len(ids))
+		for i, id := range ids {
+			keys[i] = m.key(id)
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, keys...)
+			pipe.ZRem(ctx, index, toMembers(ids)...)
+			return nil
+		})
+		return err
+	}, index)
+	if err != nil {
+		return wrap(err, "failed to delete sessions from redis")
+	}
+	return nil
+}
 
-		newData, err := json.Marshal(s)
+func (m *SessionManager) Rotate(ctx context.Context, sessionID string, metadata map[string]interface{}) (*session.Session, error) {
+	key := m.key(sessionID)
+	var rotated *session.Session
+	err := m.watch(ctx, func(tx *redis.Tx) error {
+		current, err := m.get(ctx, tx, sessionID)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if err := m.cfg.Check(ctx, current, now); err != nil {
+			return err
+		}
+		rotated = m.cfg.Rotated(current, metadata, now)
+		data, err := json.Marshal(rotated)
 		if err != nil {
 			return err
 		}
 
+		index := m.userKey(current.UserID)
 		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
-			pipe.Set(ctx, key, newData, m.ttl)
+			pipe.Del(ctx, key)
+			pipe.ZRem(ctx, index, sessionID)
+			pipe.Set(ctx, m.key(rotated.ID), data, time.Until(rotated.ExpiresAt))
+			pipe.ZAdd(ctx, index, redis.Z{Score: float64(rotated.CreatedAt.UnixMilli()), Member: rotated.ID})
+			pipe.Expire(ctx, index, m.indexTTL())
 			return nil
 		})
 		return err
 	}, key)
+	if err != nil {
+		return nil, wrap(err, "failed to rotate session")
+	}
+	return rotated, nil
+}
+
+func (m *SessionManager) get(ctx context.Context, c redis.Cmdable, sessionID string) (*session.Session, error) {
+	data, err := c.Get(ctx, m.key(sessionID)).Bytes()
+	if err == redis.Nil {
+		return nil, errors.NotFound("session not found", nil)
+	}
+	if err != nil {
+		return nil, errors.Internal("failed to get session from redis", err)
+	}
 
+	var s session.Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, errors.Internal("failed to unmarshal session", err)
+	}
+	return &s, nil
+}
+
+// load returns the live sessions of a user, oldest first, and the IDs in
+// the user's index whose sessions no longer exist.
+func (m *SessionManager) load(ctx context.Context, c redis.Cmdable, userID string) ([]*session.Session, []string, error) {
+	ids, err := c.ZRange(ctx, m.userKey(userID), 0, -1).Result()
+	if err != nil || len(ids) == 0 {
+		return nil, nil, err
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = m.key(id)
+	}
+	values, err := c.MGet(ctx, keys...).Result()
 	if err != nil {
-		// If watch failed, we could retry, but here we just return error
-		if errors.Is(err, redis.TxFailedErr) {
-			return nil, errors.Conflict("session update conflict", err)
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	var active []*session.Session
+	var stale []string
+	for i, v := range values {
+		data, ok := v.(string)
+		if !ok {
+			stale = append(stale, ids[i])
+			continue
+		}
+		var s session.Session
+		if err := json.Unmarshal([]byte(data), &s); err != nil {
+			return nil, nil, errors.Internal("failed to unmarshal session", err)
+		}
+		if now.Before(s.ExpiresAt) {
+			active = append(active, &s)
+		}
+	}
+	return active, stale, nil
+}
+
+// indexTTL is how long a user's index must outlive a write to it. Every
+// session expires within TTL of its last write, so the index, extended by
+// TTL on each write, outlives them all.
+func (m *SessionManager) indexTTL() time.Duration {
+	return m.cfg.TTL
+}
+
+// watch runs fn in a WATCH transaction on keys, retrying when they change.
+func (m *SessionManager) watch(ctx context.Context, fn func(*redis.Tx) error, keys ...string) error {
+	for range txRetries {
+		err := m.client.Watch(ctx, fn, keys...)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
 		}
-		// Wrap if it's not already wrapped
-		// The error from Watch function might be one we returned (NotFound)
-		// We'll trust the error is meaningful or wrap it if generic
-		return nil, errors.Internal("failed to refresh session", err)
 	}
+	return errors.Conflict("session update conflict", redis.TxFailedErr)
+}
 
-	return s, nil
+// wrap passes application errors through and wraps Redis errors.
+func wrap(err error, msg string) error {
+	var appErr *errors.AppError
+	if errors.As(err, &appErr) {
+		return err
+	}
+	return errors.Internal(msg, err)
+}
+
+func isNotFound(err error) bool {
+	var appErr *errors.AppError
+	return errors.As(err, &appErr) && appErr.Code == errors.CodeNotFound
+}
+
+func toMembers(ids []string) []interface{} {
+	members := make([]interface{}, len(ids))
+	for i, id := range ids {
+		members[i] = id
+	}
+	return members
 }
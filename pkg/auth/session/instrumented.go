@@ -4,7 +4,7 @@ import (
 	"context"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
-	"go.opentelemetry.io/otel"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
@@ -16,11 +16,13 @@ type InstrumentedManager struct {
 	tracer trace.Tracer
 }
 
+var _ Manager = (*InstrumentedManager)(nil)
+
 // NewInstrumentedManager creates a new InstrumentedManager.
 func NewInstrumentedManager(next Manager) *InstrumentedManager {
 	return &InstrumentedManager{
 		next:   next,
-		tracer: otel.Tracer("pkg/auth/session"),
+		tracer: instrument.NewTracer("pkg/auth/session"),
 	}
 }
 
@@ -93,3 +95,55 @@ func (m *InstrumentedManager) Refresh(ctx context.Context, sessionID string) (*S
 	}
 	return s, nil
 }
+
+func (m *InstrumentedManager) List(ctx context.Context, userID string) ([]*Session, error) {
+	ctx, span := m.tracer.Start(ctx, "session.List", trace.WithAttributes(
+		attribute.String("user.id", userID),
+	))
+	defer span.End()
+
+	sessions, err := m.next.List(ctx, userID)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		logger.L().ErrorContext(ctx, "failed to list sessions", "error", err, "user_id", userID)
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("session.count", len(sessions)))
+	return sessions, nil
+}
+
+func (m *InstrumentedManager) DeleteAll(ctx context.Context, userID string, except ...string) error {
+	ctx, span := m.tracer.Start(ctx, "session.DeleteAll", trace.WithAttributes(
+		attribute.String("user.id", userID),
+		attribute.Int("session.kept", len(except)),
+	))
+	defer span.End()
+
+	err := m.next.DeleteAll(ctx, userID, except...)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		logger.L().ErrorContext(ctx, "failed to delete sessions", "error", err, "user_id", userID)
+		return err
+	}
+	logger.L().InfoContext(ctx, "user sessions deleted", "user_id", userID, "kept", len(except))
+	return nil
+}
+
+func (m *InstrumentedManager) Rotate(ctx context.Context, sessionID string, metadata map[string]interface{}) (*Session, error) {
+	ctx, span := m.tracer.Start(ctx, "session.Rotate", trace.WithAttributes(
+		attribute.String("session.id", sessionID),
+	))
+	defer span.End()
+
+	s, err := m.next.Rotate(ctx, sessionID, metadata)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		logger.L().ErrorContext(ctx, "failed to rotate session", "error", err, "session_id", sessionID)
+		return nil, err
+	}
+	span.SetAttributes(attribute.String("session.new_id", s.ID), attribute.String("user.id", s.UserID))
+	return s, nil
+}
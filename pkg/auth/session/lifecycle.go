@@ -0,0 +1,140 @@
+package session
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"maps"
+	"net"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/google/uuid"
+)
+
+// Client describes the client presenting a session.
+type Client struct {
+	IP string
+
+	// Fingerprint identifies the client's device, e.g. a hash of stable
+	// request headers or a device-bound key.
+	Fingerprint string
+}
+
+type clientKey struct{}
+
+// WithClient returns a context carrying the client presenting a session.
+func WithClient(ctx context.Context, c Client) context.Context {
+	return context.WithValue(ctx, clientKey{}, c)
+}
+
+// ClientFrom returns the client carried by ctx.
+func ClientFrom(ctx context.Context) (Client, bool) {
+	c, ok := ctx.Value(clientKey{}).(Client)
+	return c, ok
+}
+
+// ClientFromRequest describes the client of an HTTP request by its remote
+// address and a hash of its User-Agent. Behind a proxy, set IP from a
+// trusted forwarding header instead.
+func ClientFromRequest(r *http.Request) Client {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	sum := sha256.Sum256([]byte(r.UserAgent()))
+	return Client{IP: ip, Fingerprint: hex.EncodeToString(sum[:])}
+}
+
+// NewSession returns a session for userID created now, bound to the client
+// carried by ctx.
+func (c Config) NewSession(ctx context.Context, userID string, metadata map[string]interface{}) *Session {
+	now := time.Now()
+	s := &Session{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		CreatedAt: now,
+		Metadata:  metadata,
+	}
+	if c.AbsoluteTTL > 0 {
+		s.AbsoluteExpiresAt = now.Add(c.AbsoluteTTL)
+	}
+	if client, ok := ClientFrom(ctx); ok {
+		s.IP, s.Device = client.IP, client.Fingerprint
+	}
+	c.Touch(s, now)
+	return s
+}
+
+// Touch records activity on s at now, extending its idle timeout no
+// further than its absolute timeout.
+func (c Config) Touch(s *Session, now time.Time) {
+	s.LastSeenAt = now
+	s.ExpiresAt = now.Add(c.TTL)
+	if !s.AbsoluteExpiresAt.IsZero() && s.AbsoluteExpiresAt.Before(s.ExpiresAt) {
+		s.ExpiresAt = s.AbsoluteExpiresAt
+	}
+}
+
+// Rotated returns a copy of s under a new ID, touched at now.
+func (c Config) Rotated(s *Session, metadata map[string]interface{}, now time.Time) *Session {
+	r := Clone(s)
+	r.ID = uuid.NewString()
+	if metadata != nil {
+		r.Metadata = metadata
+	}
+	c.Touch(r, now)
+	return r
+}
+
+// Check returns a NotFound error if s has expired at now, and an
+// Unauthorized error if binding is enabled and the client carried by ctx
+// is not the one s is bound to.
+func (c Config) Check(ctx context.Context, s *Session, now time.Time) error {
+	if !now.Before(s.ExpiresAt) {
+		return errors.NotFound("session expired", nil)
+	}
+	if !c.BindDevice && !c.BindIP {
+		return nil
+	}
+	client, _ := ClientFrom(ctx)
+	if c.BindDevice && s.Device != "" && client.Fingerprint != s.Device {
+		return errors.Unauthorized("session is bound to another device", nil)
+	}
+	if c.BindIP && s.IP != "" && !c.sameNetwork(s.IP, client.IP) {
+		return errors.Unauthorized("session is bound to another network", nil)
+	}
+	return nil
+}
+
+// sameNetwork reports whether a and b share a network of the configured
+// prefix length.
+func (c Config) sameNetwork(a, b string) bool {
+	ipA, errA := netip.ParseAddr(a)
+	ipB, errB := netip.ParseAddr(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	ipA, ipB = ipA.Unmap(), ipB.Unmap()
+	if ipA.Is4() != ipB.Is4() {
+		return false
+	}
+	bits := c.BindIPv6Prefix
+	if ipA.Is4() {
+		bits = c.BindIPv4Prefix
+	}
+	if bits <= 0 || bits > ipA.BitLen() {
+		bits = ipA.BitLen()
+	}
+	prefix, err := ipA.Prefix(bits)
+	return err == nil && prefix.Contains(ipB)
+}
+
+// Clone returns a copy of s that shares no maps with it.
+func Clone(s *Session) *Session {
+	c := *s
+	c.Metadata = maps.Clone(s.Metadata)
+	return &c
+}
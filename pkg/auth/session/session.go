@@ -13,17 +13,48 @@ type Config struct {
 	// EncryptionKey is the key used to encrypt session data (optional).
 	EncryptionKey string `env:"AUTH_SESSION_ENCRYPTION_KEY"`
 
-	// TTL is the default session duration.
+	// TTL is the idle timeout: a session expires once it has not been
+	// refreshed for TTL.
 	TTL time.Duration `env:"AUTH_SESSION_TTL" env-default:"24h"`
+
+	// AbsoluteTTL bounds a session's lifetime however often it is
+	// refreshed. Zero means no bound.
+	AbsoluteTTL time.Duration `env:"AUTH_SESSION_ABSOLUTE_TTL"`
+
+	// MaxSessions bounds the number of concurrent sessions per user. When a
+	// user reaches it, creating a session revokes their oldest one, or
+	// fails if RejectOverLimit is set. Zero means no bound.
+	MaxSessions     int  `env:"AUTH_SESSION_MAX_SESSIONS"`
+	RejectOverLimit bool `env:"AUTH_SESSION_REJECT_OVER_LIMIT"`
+
+	// BindDevice rejects sessions presented by a client with a different
+	// device fingerprint than the one they were created by.
+	BindDevice bool `env:"AUTH_SESSION_BIND_DEVICE"`
+
+	// BindIP rejects sessions presented from outside the network, of
+	// BindIPv4Prefix or BindIPv6Prefix bits, they were created from.
+	BindIP         bool `env:"AUTH_SESSION_BIND_IP"`
+	BindIPv4Prefix int  `env:"AUTH_SESSION_BIND_IPV4_PREFIX" env-default:"32"`
+	BindIPv6Prefix int  `env:"AUTH_SESSION_BIND_IPV6_PREFIX" env-default:"64"`
 }
 
 // Session represents a user session.
 type Session struct {
-	ID        string                 `json:"id"`
-	UserID    string                 `json:"user_id"`
-	CreatedAt time.Time              `json:"created_at"`
-	ExpiresAt time.Time              `json:"expires_at"`
-	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	ID         string                 `json:"id"`
+	UserID     string                 `json:"user_id"`
+	CreatedAt  time.Time              `json:"created_at"`
+	LastSeenAt time.Time              `json:"last_seen_at"`
+	ExpiresAt  time.Time              `json:"expires_at"`
+	Metadata   map[string]interface{} `json:"metadata,omitempty"`
+
+	// AbsoluteExpiresAt is when the session expires regardless of
+	// activity, zero if it has no absolute timeout.
+	AbsoluteExpiresAt time.Time `json:"absolute_expires_at,omitempty"`
+
+	// IP and Device record the client the session was created by, for
+	// binding.
+	IP     string `json:"ip,omitempty"`
+	Device string `json:"device,omitempty"`
 }
 
 // Manager manages user sessions.
@@ -31,7 +62,8 @@ type Manager interface {
 	// Create creates a new session for a user.
 	Create(ctx context.Context, userID string, metadata map[string]interface{}) (*Session, error)
 
-	// Get retrieves a session by ID.
+	// Get retrieves a session by ID. With binding enabled, the session must
+	// be presented by the client carried by ctx (see WithClient).
 	Get(ctx context.Context, sessionID string) (*Session, error)
 
 	// Delete removes a session.
@@ -39,4 +71,15 @@ type Manager interface {
 
 	// Refresh extends the session expiration.
 	Refresh(ctx context.Context, sessionID string) (*Session, error)
+
+	// List returns the active sessions of a user, oldest first.
+	List(ctx context.Context, userID string) ([]*Session, error)
+
+	// DeleteAll removes every session of a user except the given ones,
+	// logging them out everywhere else.
+	DeleteAll(ctx context.Context, userID string, except ...string) error
+
+	// Rotate replaces a session's ID, as on a privilege change, so that the
+	// old ID stops working. Non-nil metadata replaces the session's.
+	Rotate(ctx context.Context, sessionID string, metadata map[string]interface{}) (*Session, error)
 }
@@ -1,6 +1,8 @@
 package tests
 
 import (
+	"context"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -37,6 +39,160 @@ func (s *SessionTestSuite) TestCreateGetDelete() {
 	s.Error(err)
 }
 
+func (s *SessionTestSuite) TestListAndDeleteAll() {
+	a, err := s.manager.Create(s.Ctx, "alice", nil)
+	s.Require().NoError(err)
+	b, err := s.manager.Create(s.Ctx, "alice", nil)
+	s.Require().NoError(err)
+	_, err = s.manager.Create(s.Ctx, "bob", nil)
+	s.Require().NoError(err)
+
+	list, err := s.manager.List(s.Ctx, "alice")
+	s.Require().NoError(err)
+	s.Require().Len(list, 2)
+	s.Equal(a.ID, list[0].ID)
+	s.Equal(b.ID, list[1].ID)
+
+	s.Require().NoError(s.manager.DeleteAll(s.Ctx, "alice", b.ID))
+	_, err = s.manager.Get(s.Ctx, a.ID)
+	s.Error(err)
+	_, err = s.manager.Get(s.Ctx, b.ID)
+	s.NoError(err)
+
+	s.Require().NoError(s.manager.DeleteAll(s.Ctx, "alice"))
+	list, err = s.manager.List(s.Ctx, "alice")
+	s.NoError(err)
+	s.Empty(list)
+
+	list, err = s.manager.List(s.Ctx, "bob")
+	s.NoError(err)
+	s.Len(list, 1)
+}
+
+func (s *SessionTestSuite) TestMaxSessionsEvictsOldest() {
+	manager := memory.New(session.Config{TTL: time.Hour, MaxSessions: 2})
+	first, err := manager.Create(s.Ctx, "alice", nil)
+	s.Require().NoError(err)
+	_, err = manager.Create(s.Ctx, "alice", nil)
+	s.Require().NoError(err)
+	_, err = manager.Create(s.Ctx, "alice", nil)
+	s.Require().NoError(err)
+
+	list, err := manager.List(s.Ctx, "alice")
+	s.Require().NoError(err)
+	s.Len(list, 2)
+	_, err = manager.Get(s.Ctx, first.ID)
+	s.Error(err)
+}
+
+func (s *SessionTestSuite) TestMaxSessionsRejects() {
+	manager := memory.New(session.Config{TTL: time.Hour, MaxSessions: 1, RejectOverLimit: true})
+	_, err := manager.Create(s.Ctx, "alice", nil)
+	s.Require().NoError(err)
+	_, err = manager.Create(s.Ctx, "alice", nil)
+	s.Error(err)
+	_, err = manager.Create(s.Ctx, "bob", nil)
+	s.NoError(err)
+}
+
+func (s *SessionTestSuite) TestRotate() {
+	sess, err := s.manager.Create(s.Ctx, "alice", map[string]interface{}{"role": "user"})
+	s.Require().NoError(err)
+
+	rotated, err := s.manager.Rotate(s.Ctx, sess.ID, map[string]interface{}{"role": "admin"})
+	s.Require().NoError(err)
+	s.NotEqual(sess.ID, rotated.ID)
+	s.Equal(sess.CreatedAt, rotated.CreatedAt)
+
+	_, err = s.manager.Get(s.Ctx, sess.ID)
+	s.Error(err)
+	got, err := s.manager.Get(s.Ctx, rotated.ID)
+	s.Require().NoError(err)
+	s.Equal("admin", got.Metadata["role"])
+
+	list, err := s.manager.List(s.Ctx, "alice")
+	s.Require().NoError(err)
+	s.Require().Len(list, 1)
+	s.Equal(rotated.ID, list[0].ID)
+}
+
+func (s *SessionTestSuite) TestIdleAndAbsoluteTimeouts() {
+	cfg := session.Config{TTL: 30 * time.Minute, AbsoluteTTL: time.Hour}
+	sess := cfg.NewSession(s.Ctx, "alice", nil)
+	start := sess.CreatedAt
+
+	// Idle for longer than TTL.
+	s.Error(cfg.Check(s.Ctx, sess, start.Add(31*time.Minute)))
+
+	// Refreshed activity keeps the session alive up to the absolute timeout.
+	cfg.Touch(sess, start.Add(20*time.Minute))
+	s.NoError(cfg.Check(s.Ctx, sess, start.Add(45*time.Minute)))
+	cfg.Touch(sess, start.Add(45*time.Minute))
+	s.Equal(start.Add(time.Hour), sess.ExpiresAt)
+	s.Error(cfg.Check(s.Ctx, sess, start.Add(61*time.Minute)))
+}
+
+func (s *SessionTestSuite) TestExpiredSessionIsRemoved() {
+	manager := memory.New(session.Config{TTL: 20 * time.Millisecond})
+	sess, err := manager.Create(s.Ctx, "alice", nil)
+	s.Require().NoError(err)
+	time.Sleep(30 * time.Millisecond)
+
+	_, err = manager.Refresh(s.Ctx, sess.ID)
+	s.Error(err)
+	list, err := manager.List(s.Ctx, "alice")
+	s.NoError(err)
+	s.Empty(list)
+}
+
+func (s *SessionTestSuite) TestDeviceBinding() {
+	manager := memory.New(session.Config{TTL: time.Hour, BindDevice: true})
+	laptop := session.WithClient(s.Ctx, session.Client{IP: "10.0.0.1", Fingerprint: "laptop"})
+	phone := session.WithClient(s.Ctx, session.Client{IP: "10.0.0.1", Fingerprint: "phone"})
+
+	sess, err := manager.Create(laptop, "alice", nil)
+	s.Require().NoError(err)
+	_, err = manager.Get(laptop, sess.ID)
+	s.NoError(err)
+	_, err = manager.Get(phone, sess.ID)
+	s.Error(err)
+	_, err = manager.Get(s.Ctx, sess.ID)
+	s.Error(err)
+
+	// A rejected presentation does not revoke the session.
+	_, err = manager.Refresh(laptop, sess.ID)
+	s.NoError(err)
+}
+
+func (s *SessionTestSuite) TestIPBinding() {
+	cfg := session.Config{TTL: time.Hour, BindIP: true, BindIPv4Prefix: 24, BindIPv6Prefix: 64}
+	from := func(ip string) context.Context {
+		return session.WithClient(s.Ctx, session.Client{IP: ip})
+	}
+
+	v4 := cfg.NewSession(from("192.0.2.10"), "alice", nil)
+	s.NoError(cfg.Check(from("192.0.2.200"), v4, v4.CreatedAt))
+	s.Error(cfg.Check(from("192.0.3.10"), v4, v4.CreatedAt))
+	s.Error(cfg.Check(from("2001:db8::1"), v4, v4.CreatedAt))
+
+	v6 := cfg.NewSession(from("2001:db8:0:1::1"), "alice", nil)
+	s.NoError(cfg.Check(from("2001:db8:0:1:ffff::2"), v6, v6.CreatedAt))
+	s.Error(cfg.Check(from("2001:db8:0:2::1"), v6, v6.CreatedAt))
+}
+
+func (s *SessionTestSuite) TestClientFromRequest() {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "192.0.2.1:54321"
+	r.Header.Set("User-Agent", "test-agent")
+
+	c := session.ClientFromRequest(r)
+	s.Equal("192.0.2.1", c.IP)
+	s.Len(c.Fingerprint, 64)
+
+	r.Header.Set("User-Agent", "other-agent")
+	s.NotEqual(c.Fingerprint, session.ClientFromRequest(r).Fingerprint)
+}
+
 func TestSessionSuite(t *testing.T) {
 	test.Run(t, new(SessionTestSuite))
 }
@@ -2,26 +2,101 @@ package cache
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
 	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 )
 
+// lookups counts the hits and misses of every InstrumentedCache by cache
+// name. They are reported as cache.hits, cache.misses and the
+// cache.hit_ratio gauge.
+var lookups struct {
+	once   sync.Once
+	hits   metric.Int64Counter
+	misses metric.Int64Counter
+
+	mu     sync.Mutex
+	counts map[string]*lookupCounts
+}
+
+// lookupCounts are the hits and misses of the caches with one name.
+type lookupCounts struct {
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// lookupCountsFor returns the counts of the caches named name.
+func lookupCountsFor(name string) *lookupCounts {
+	lookups.mu.Lock()
+	defer lookups.mu.Unlock()
+	counts, ok := lookups.counts[name]
+	if !ok {
+		counts = &lookupCounts{}
+		lookups.counts[name] = counts
+	}
+	return counts
+}
+
+func initLookupMetrics() {
+	lookups.counts = make(map[string]*lookupCounts)
+	meter := otel.Meter("pkg/cache")
+	lookups.hits, _ = meter.Int64Counter("cache.hits",
+		metric.WithDescription("Number of cache lookups that found the key"),
+		metric.WithUnit("{hit}"))
+	lookups.misses, _ = meter.Int64Counter("cache.misses",
+		metric.WithDescription("Number of cache lookups that did not find the key"),
+		metric.WithUnit("{miss}"))
+	_, _ = meter.Float64ObservableGauge("cache.hit_ratio",
+		metric.WithDescription("Fraction of cache lookups that found the key"),
+		metric.WithUnit("1"),
+		metric.WithFloat64Callback(func(_ context.Context, o metric.Float64Observer) error {
+			lookups.mu.Lock()
+			defer lookups.mu.Unlock()
+			for name, counts := range lookups.counts {
+				hits, misses := counts.hits.Load(), counts.misses.Load()
+				if hits+misses > 0 {
+					o.Observe(float64(hits)/float64(hits+misses), metric.WithAttributes(attribute.String("name", name)))
+				}
+			}
+			return nil
+		}))
+}
+
+// isMiss reports whether err means the key is not in the cache.
+func isMiss(err error) bool {
+	if errors.Is(err, ErrKeyNotFound) {
+		return true
+	}
+	var appErr *errors.AppError
+	return errors.As(err, &appErr) && appErr.Code == errors.CodeNotFound
+}
+
 // InstrumentedCache wraps a Cache to add logging and tracing.
 type InstrumentedCache struct {
 	next   Cache
 	tracer trace.Tracer
+	counts *lookupCounts
+	attrs  metric.MeasurementOption
 }
 
-// NewInstrumentedCache creates a new instrumented cache wrapper.
-func NewInstrumentedCache(next Cache) *InstrumentedCache {
+// NewInstrumentedCache creates a new instrumented cache wrapper. Its hit
+// and miss metrics carry name as the name attribute.
+func NewInstrumentedCache(next Cache, name string) *InstrumentedCache {
+	lookups.once.Do(initLookupMetrics)
 	return &InstrumentedCache{
 		next:   next,
-		tracer: otel.Tracer("pkg/cache"),
+		tracer: instrument.NewTracer("pkg/cache"),
+		counts: lookupCountsFor(name),
+		attrs:  metric.WithAttributes(attribute.String("name", name)),
 	}
 }
 
@@ -32,13 +107,24 @@ func (c *InstrumentedCache) Get(ctx context.Context, key string, dest interface{
 	defer span.End()
 
 	err := c.next.Get(ctx, key, dest)
+	if isMiss(err) {
+		// A miss is a normal outcome rather than a failed operation.
+		c.counts.misses.Add(1)
+		lookups.misses.Add(ctx, 1, c.attrs)
+		span.SetAttributes(attribute.Bool("cache.hit", false))
+		logger.L().DebugContext(ctx, "cache miss", "key", key)
+		return err
+	}
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
-		logger.L().DebugContext(ctx, "cache miss", "key", key, "error", err)
+		logger.L().ErrorContext(ctx, "cache get failed", "key", key, "error", err)
 		return err
 	}
 
+	c.counts.hits.Add(1)
+	lookups.hits.Add(ctx, 1, c.attrs)
+	span.SetAttributes(attribute.Bool("cache.hit", true))
 	logger.L().DebugContext(ctx, "cache hit", "key", key)
 	return nil
 }
@@ -36,7 +36,7 @@ func Example() {
 func ExampleCache_withInstrumentation() {
 	// Create a memory cache with instrumentation
 	memCache := memory.New()
-	c := cache.NewInstrumentedCache(memCache)
+	c := cache.NewInstrumentedCache(memCache, "example")
 	defer c.Close()
 
 	ctx := context.Background()
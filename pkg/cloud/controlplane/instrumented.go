@@ -5,7 +5,7 @@ import (
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/cloud"
 	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
-	"go.opentelemetry.io/otel"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
@@ -21,7 +21,7 @@ type InstrumentedControlPlane struct {
 func NewInstrumentedControlPlane(next ControlPlane) *InstrumentedControlPlane {
 	return &InstrumentedControlPlane{
 		next:   next,
-		tracer: otel.Tracer("pkg/cloud/controlplane"),
+		tracer: instrument.NewTracer("pkg/cloud/controlplane"),
 	}
 }
 
@@ -5,7 +5,7 @@ import (
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/cloud"
 	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
-	"go.opentelemetry.io/otel"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
@@ -21,7 +21,7 @@ type InstrumentedHypervisor struct {
 func NewInstrumentedHypervisor(next Hypervisor) *InstrumentedHypervisor {
 	return &InstrumentedHypervisor{
 		next:   next,
-		tracer: otel.Tracer("pkg/cloud/hypervisor"),
+		tracer: instrument.NewTracer("pkg/cloud/hypervisor"),
 	}
 }
 
@@ -5,7 +5,7 @@ import (
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/cloud"
 	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
-	"go.opentelemetry.io/otel"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
@@ -21,7 +21,7 @@ type InstrumentedProvisioner struct {
 func NewInstrumentedProvisioner(next Provisioner) *InstrumentedProvisioner {
 	return &InstrumentedProvisioner{
 		next:   next,
-		tracer: otel.Tracer("pkg/cloud/provisioning"),
+		tracer: instrument.NewTracer("pkg/cloud/provisioning"),
 	}
 }
 
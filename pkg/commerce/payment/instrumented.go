@@ -4,7 +4,7 @@ import (
 	"context"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
-	"go.opentelemetry.io/otel"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
@@ -20,7 +20,7 @@ type InstrumentedProvider struct {
 func NewInstrumentedProvider(next Provider) *InstrumentedProvider {
 	return &InstrumentedProvider{
 		next:   next,
-		tracer: otel.Tracer("pkg/commerce/payment"),
+		tracer: instrument.NewTracer("pkg/commerce/payment"),
 	}
 }
 
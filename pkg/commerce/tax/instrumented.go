@@ -4,7 +4,7 @@ import (
 	"context"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
-	"go.opentelemetry.io/otel"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
@@ -20,7 +20,7 @@ type InstrumentedCalculator struct {
 func NewInstrumentedCalculator(next Calculator) *InstrumentedCalculator {
 	return &InstrumentedCalculator{
 		next:   next,
-		tracer: otel.Tracer("pkg/commerce/tax"),
+		tracer: instrument.NewTracer("pkg/commerce/tax"),
 	}
 }
 
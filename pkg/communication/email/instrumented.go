@@ -3,12 +3,12 @@ package email
 import (
 	"context"
 
-	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
 )
 
 // InstrumentedSender is a wrapper around a Sender that adds observability.
@@ -21,7 +21,7 @@ type InstrumentedSender struct {
 func NewInstrumentedSender(next Sender) *InstrumentedSender {
 	return &InstrumentedSender{
 		next:   next,
-		tracer: otel.Tracer("pkg/communication/email"),
+		tracer: instrument.NewTracer("pkg/communication/email"),
 	}
 }
 
@@ -3,12 +3,12 @@ package template
 import (
 	"context"
 
-	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
 )
 
 // InstrumentedEngine is a wrapper around an Engine that adds observability.
@@ -21,7 +21,7 @@ type InstrumentedEngine struct {
 func NewInstrumentedEngine(next Engine) *InstrumentedEngine {
 	return &InstrumentedEngine{
 		next:   next,
-		tracer: otel.Tracer("pkg/communication/template"),
+		tracer: instrument.NewTracer("pkg/communication/template"),
 	}
 }
 
@@ -6,7 +6,7 @@ import (
 	"time"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
-	"go.opentelemetry.io/otel"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
@@ -22,7 +22,7 @@ type InstrumentedContainerRuntime struct {
 func NewInstrumentedContainerRuntime(next ContainerRuntime) *InstrumentedContainerRuntime {
 	return &InstrumentedContainerRuntime{
 		next:   next,
-		tracer: otel.Tracer("pkg/compute/container"),
+		tracer: instrument.NewTracer("pkg/compute/container"),
 	}
 }
 
@@ -57,3 +57,70 @@ func (r *Reader) Read(v interface{}) error {
 	}
 	return io.EOF
 }
+
+// Codec encodes and decodes single values with a fixed schema, without the
+// OCF container. It is used where the schema travels out of band, such as in
+// a schema registry.
+type Codec struct {
+	schema avro.Schema
+}
+
+// NewCodec parses schemaStr and returns a Codec for it.
+func NewCodec(schemaStr string) (*Codec, error) {
+	schema, err := parse(schemaStr)
+	if err != nil {
+		return nil, err
+	}
+	return &Codec{schema: schema}, nil
+}
+
+// Schema returns the canonical form of the codec's schema.
+func (c *Codec) Schema() string {
+	return c.schema.String()
+}
+
+func (c *Codec) Marshal(v interface{}) ([]byte, error) {
+	return avro.Marshal(c.schema, v)
+}
+
+func (c *Codec) Unmarshal(data []byte, v interface{}) error {
+	return avro.Unmarshal(c.schema, data, v)
+}
+
+// ResolveFrom returns a Codec that decodes data written with the writer
+// schema into values shaped by c's schema, filling defaults for fields the
+// writer lacks. It fails if the schemas are not compatible.
+func (c *Codec) ResolveFrom(writerSchema string) (*Codec, error) {
+	writer, err := parse(writerSchema)
+	if err != nil {
+		return nil, err
+	}
+	if writer.Fingerprint() == c.schema.Fingerprint() {
+		return c, nil
+	}
+	resolved, err := avro.NewSchemaCompatibility().Resolve(c.schema, writer)
+	if err != nil {
+		return nil, err
+	}
+	return &Codec{schema: resolved}, nil
+}
+
+// Compatible returns an error if data written with the writer schema cannot
+// be read with the reader schema.
+func Compatible(readerSchema, writerSchema string) error {
+	reader, err := parse(readerSchema)
+	if err != nil {
+		return err
+	}
+	writer, err := parse(writerSchema)
+	if err != nil {
+		return err
+	}
+	return avro.NewSchemaCompatibility().Compatible(reader, writer)
+}
+
+// parse parses a schema with its own name cache, so that different versions
+// of the same named type do not overwrite each other.
+func parse(schemaStr string) (avro.Schema, error) {
+	return avro.ParseWithCache(schemaStr, "", &avro.SchemaCache{})
+}
@@ -3,7 +3,7 @@ package bigdata
 import (
 	"context"
 
-	"go.opentelemetry.io/otel"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -18,7 +18,7 @@ type InstrumentedClient struct {
 func NewInstrumentedClient(next Client) *InstrumentedClient {
 	return &InstrumentedClient{
 		next:   next,
-		tracer: otel.Tracer("pkg/bigdata"),
+		tracer: instrument.NewTracer("pkg/bigdata"),
 	}
 }
 
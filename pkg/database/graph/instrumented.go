@@ -4,7 +4,7 @@ import (
 	"context"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
-	"go.opentelemetry.io/otel"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
@@ -18,7 +18,7 @@ type InstrumentedGraph struct {
 func NewInstrumented(next Interface) *InstrumentedGraph {
 	return &InstrumentedGraph{
 		next:   next,
-		tracer: otel.Tracer("pkg/database/graph"),
+		tracer: instrument.NewTracer("pkg/database/graph"),
 	}
 }
 
@@ -0,0 +1,109 @@
+package lsm
+
+import (
+	"context"
+	"encoding/binary"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/database/kv"
+	lsmtree "github.com/chris-alexander-pop/system-design-library/pkg/datastructures/tree/lsm"
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+)
+
+// expiryHeaderSize is the size of the expiry timestamp stored in front of
+// every value (Unix nanoseconds, 0 for no expiration).
+const expiryHeaderSize = 8
+
+// Adapter implements kv.KV on top of an embedded LSM tree.
+type Adapter struct {
+	db *lsmtree.DB
+}
+
+// New opens (or creates) an LSM store in cfg.Path.
+func New(cfg kv.Config) (*Adapter, error) {
+	db, err := lsmtree.Open(lsmtree.Options{
+		Dir:        cfg.Path,
+		SyncWrites: cfg.SyncWrites,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open lsm store")
+	}
+	return &Adapter{db: db}, nil
+}
+
+// Get retrieves a value by key.
+func (a *Adapter) Get(ctx context.Context, key string) ([]byte, error) {
+	raw, err := a.db.Get(key)
+	if err != nil {
+		if errors.Is(err, lsmtree.ErrNotFound) {
+			return nil, errors.NotFound("key not found", nil)
+		}
+		return nil, errors.Wrap(err, "failed to get key")
+	}
+
+	value, expired := decode(raw)
+	if expired {
+		return nil, errors.NotFound("key expired", nil)
+	}
+	return value, nil
+}
+
+// Set stores a value with the given TTL.
+func (a *Adapter) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	var expiresAt int64
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl).UnixNano()
+	}
+
+	buf := make([]byte, expiryHeaderSize+len(value))
+	binary.BigEndian.PutUint64(buf, uint64(expiresAt))
+	copy(buf[expiryHeaderSize:], value)
+
+	if err := a.db.Put(key, buf); err != nil {
+		return errors.Wrap(err, "failed to set key")
+	}
+	return nil
+}
+
+// Delete removes a key.
+func (a *Adapter) Delete(ctx context.Context, key string) error {
+	if err := a.db.Delete(key); err != nil {
+		return errors.Wrap(err, "failed to delete key")
+	}
+	return nil
+}
+
+// Exists checks if a key exists.
+func (a *Adapter) Exists(ctx context.Context, key string) (bool, error) {
+	raw, err := a.db.Get(key)
+	if err != nil {
+		if errors.Is(err, lsmtree.ErrNotFound) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "failed to check key")
+	}
+
+	_, expired := decode(raw)
+	return !expired, nil
+}
+
+// Close releases the store. Writes not yet flushed to SSTables are recovered
+// from the write-ahead log on the next open.
+func (a *Adapter) Close() error {
+	return a.db.Close()
+}
+
+// decode strips the expiry header and reports whether the value has expired.
+func decode(raw []byte) ([]byte, bool) {
+	if len(raw) < expiryHeaderSize {
+		return raw, false
+	}
+	expiresAt := int64(binary.BigEndian.Uint64(raw))
+	if expiresAt != 0 && time.Now().UnixNano() > expiresAt {
+		return nil, true
+	}
+	return raw[expiryHeaderSize:], false
+}
+
+// Ensure Adapter implements kv.KV
+var _ kv.KV = (*Adapter)(nil)
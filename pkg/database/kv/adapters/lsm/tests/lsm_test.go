@@ -0,0 +1,52 @@
+package lsm_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/database/kv"
+	"github.com/chris-alexander-pop/system-design-library/pkg/database/kv/adapters/lsm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLSMKV(t *testing.T) {
+	ctx := context.Background()
+	cfg := kv.Config{Path: t.TempDir()}
+
+	store, err := lsm.New(cfg)
+	require.NoError(t, err)
+
+	require.NoError(t, store.Set(ctx, "k1", []byte("v1"), 0))
+	require.NoError(t, store.Set(ctx, "k2", []byte("v2"), time.Millisecond))
+
+	val, err := store.Get(ctx, "k1")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("v1"), val)
+
+	time.Sleep(5 * time.Millisecond)
+	_, err = store.Get(ctx, "k2")
+	assert.Error(t, err, "expired key should not be returned")
+
+	ok, err := store.Exists(ctx, "k2")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, store.Delete(ctx, "k1"))
+	ok, err = store.Exists(ctx, "k1")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// Data survives a reopen.
+	require.NoError(t, store.Set(ctx, "k3", []byte("v3"), 0))
+	require.NoError(t, store.Close())
+
+	store, err = lsm.New(cfg)
+	require.NoError(t, err)
+	defer store.Close()
+
+	val, err = store.Get(ctx, "k3")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("v3"), val)
+}
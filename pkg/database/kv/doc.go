@@ -4,6 +4,7 @@ Package kv provides a unified interface for key-value database access.
 This package supports multiple KV backends through a common interface:
   - Redis: Production-grade in-memory key-value store
   - Cassandra: Distributed wide-column store
+  - LSM: Embedded durable store backed by an on-disk LSM tree
   - Memory: In-memory store for testing
 
 Basic usage:
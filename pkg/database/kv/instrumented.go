@@ -5,7 +5,7 @@ import (
 	"time"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
-	"go.opentelemetry.io/otel"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
@@ -21,7 +21,7 @@ type InstrumentedKV struct {
 func NewInstrumentedKV(next KV) *InstrumentedKV {
 	return &InstrumentedKV{
 		next:   next,
-		tracer: otel.Tracer("pkg/database/kv"),
+		tracer: instrument.NewTracer("pkg/database/kv"),
 	}
 }
 
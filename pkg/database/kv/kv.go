@@ -3,6 +3,7 @@
 // Supported backends:
 //   - Redis: Production-grade in-memory key-value store
 //   - Cassandra: Distributed NoSQL database
+//   - LSM: Embedded durable store backed by an on-disk LSM tree
 //   - Memory: In-memory store for testing
 //
 // Usage:
@@ -20,7 +21,7 @@ import (
 
 // Config holds configuration for a key-value database.
 type Config struct {
-	// Driver specifies the KV backend: "redis", "cassandra", "memory".
+	// Driver specifies the KV backend: "redis", "cassandra", "lsm", "memory".
 	Driver string `env:"KV_DRIVER" env-default:"redis"`
 
 	// Host is the database server hostname.
@@ -41,6 +42,12 @@ type Config struct {
 	// Connection Pooling
 	PoolSize     int `env:"KV_POOL_SIZE" env-default:"10"`
 	MinIdleConns int `env:"KV_MIN_IDLE_CONNS" env-default:"5"`
+
+	// Path is the data directory for embedded backends (lsm).
+	Path string `env:"KV_PATH" env-default:"./data/kv"`
+
+	// SyncWrites fsyncs every write for embedded backends (lsm).
+	SyncWrites bool `env:"KV_SYNC_WRITES" env-default:"false"`
 }
 
 // KV defines the interface for key-value database operations.
@@ -5,7 +5,7 @@ import (
 	"time"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
-	"go.opentelemetry.io/otel"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
@@ -22,7 +22,7 @@ type InstrumentedSQL struct {
 func NewInstrumentedSQL(next SQL) *InstrumentedSQL {
 	return &InstrumentedSQL{
 		next:   next,
-		tracer: otel.Tracer("pkg/database/sql"),
+		tracer: instrument.NewTracer("pkg/database/sql"),
 	}
 }
 
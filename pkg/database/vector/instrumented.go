@@ -5,7 +5,7 @@ import (
 	"time"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
-	"go.opentelemetry.io/otel"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
@@ -21,7 +21,7 @@ type InstrumentedStore struct {
 func NewInstrumentedStore(next Store) *InstrumentedStore {
 	return &InstrumentedStore{
 		next:   next,
-		tracer: otel.Tracer("pkg/database/vector"),
+		tracer: instrument.NewTracer("pkg/database/vector"),
 	}
 }
 
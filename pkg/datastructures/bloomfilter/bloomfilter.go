@@ -11,6 +11,8 @@
 package bloomfilter
 
 import (
+	"encoding/binary"
+	"errors"
 	"hash"
 	"hash/fnv"
 	"math"
@@ -190,5 +192,47 @@ func (bf *BloomFilter) Union(other *BloomFilter) bool {
 	return true
 }
 
+// MarshalBinary encodes the filter so it can be stored alongside the data it indexes.
+func (bf *BloomFilter) MarshalBinary() ([]byte, error) {
+	bf.mu.RLock()
+	defer bf.mu.RUnlock()
+
+	buf := make([]byte, 24+8*len(bf.bits))
+	binary.LittleEndian.PutUint64(buf[0:], uint64(bf.numBits))
+	binary.LittleEndian.PutUint64(buf[8:], uint64(bf.numHash))
+	binary.LittleEndian.PutUint64(buf[16:], bf.count)
+	for i, w := range bf.bits {
+		binary.LittleEndian.PutUint64(buf[24+8*i:], w)
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary restores a filter encoded by MarshalBinary.
+func (bf *BloomFilter) UnmarshalBinary(data []byte) error {
+	if len(data) < 24 {
+		return errors.New("bloomfilter: encoded filter too short")
+	}
+	numBits := uint(binary.LittleEndian.Uint64(data[0:]))
+	numWords := (numBits + 63) / 64
+	if numBits == 0 || uint(len(data)-24) != numWords*8 {
+		return errors.New("bloomfilter: encoded filter has invalid size")
+	}
+
+	if bf.mu == nil {
+		bf.mu = concurrency.NewSmartRWMutex(concurrency.MutexConfig{Name: "BloomFilter"})
+	}
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+
+	bf.numBits = numBits
+	bf.numHash = uint(binary.LittleEndian.Uint64(data[8:]))
+	bf.count = binary.LittleEndian.Uint64(data[16:])
+	bf.bits = make([]uint64, numWords)
+	for i := range bf.bits {
+		bf.bits[i] = binary.LittleEndian.Uint64(data[24+8*i:])
+	}
+	return nil
+}
+
 // Helper for custom hash functions
 type HashFactory func() hash.Hash64
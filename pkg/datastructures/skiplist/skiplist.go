@@ -120,6 +120,18 @@ func (s *SkipList[K, V]) Delete(key K) {
 	}
 }
 
+// Range calls fn for each key/value pair in ascending key order until fn returns false.
+func (s *SkipList[K, V]) Range(fn func(key K, value V) bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for n := s.head.forward[0]; n != nil; n = n.forward[0] {
+		if !fn(n.key, n.value) {
+			return
+		}
+	}
+}
+
 func randomLevel() int {
 	lvl := 0
 	for rand.Float32() < p && lvl < maxLevel-1 {
@@ -0,0 +1,145 @@
+package bplus
+
+import "bytes"
+
+// Cursor iterates over a DiskTree in ascending key order.
+//
+// A cursor keeps the path from the root to its current leaf. If a commit
+// happens between two steps, Next re-seeks from the new root to the first key
+// after the current one, so keys are never repeated or returned out of order.
+type Cursor struct {
+	t     *DiskTree
+	txid  uint64
+	stack []frame
+	key   []byte
+	value []byte
+	valid bool
+	err   error
+}
+
+type frame struct {
+	pg  *page
+	idx int
+}
+
+// Seek returns a cursor positioned at the first key >= key.
+func (t *DiskTree) Seek(key []byte) *Cursor {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	c := &Cursor{t: t}
+	c.seek(key, false)
+	return c
+}
+
+// First returns a cursor positioned at the smallest key.
+func (t *DiskTree) First() *Cursor {
+	return t.Seek(nil)
+}
+
+// Valid reports whether the cursor is positioned at an entry.
+func (c *Cursor) Valid() bool {
+	return c.valid
+}
+
+// Key returns the current key.
+func (c *Cursor) Key() []byte {
+	return c.key
+}
+
+// Value returns the current value.
+func (c *Cursor) Value() []byte {
+	return c.value
+}
+
+// Err returns the I/O error that invalidated the cursor, if any.
+func (c *Cursor) Err() error {
+	return c.err
+}
+
+// Next advances to the next key and reports whether the cursor is still valid.
+func (c *Cursor) Next() bool {
+	if !c.valid {
+		return false
+	}
+
+	c.t.mu.RLock()
+	defer c.t.mu.RUnlock()
+
+	if c.t.closed {
+		c.fail(ErrClosed)
+		return false
+	}
+	if c.txid != c.t.meta.txid {
+		c.seek(c.key, true)
+		return c.valid
+	}
+	c.stack[len(c.stack)-1].idx++
+	c.settle()
+	return c.valid
+}
+
+// seek descends from the current root to the first key >= key, or > key when
+// exclusive is set. The caller holds the read lock.
+func (c *Cursor) seek(key []byte, exclusive bool) {
+	c.txid = c.t.meta.txid
+	c.stack = c.stack[:0]
+	if c.t.closed {
+		c.fail(ErrClosed)
+		return
+	}
+
+	pg, err := c.t.pager.read(c.t.meta.root)
+	for err == nil && !pg.leaf {
+		i := pg.childIndex(key)
+		c.stack = append(c.stack, frame{pg: pg, idx: i})
+		pg, err = c.t.pager.read(pg.children[i])
+	}
+	if err != nil {
+		c.fail(err)
+		return
+	}
+
+	i := pg.search(key)
+	if exclusive && i < len(pg.keys) && bytes.Equal(pg.keys[i], key) {
+		i++
+	}
+	c.stack = append(c.stack, frame{pg: pg, idx: i})
+	c.settle()
+}
+
+// settle moves forward from the top frame until it rests on a leaf entry,
+// climbing to the next subtree whenever a page is exhausted.
+func (c *Cursor) settle() {
+	for {
+		top := &c.stack[len(c.stack)-1]
+		if top.pg.leaf && top.idx < len(top.pg.keys) {
+			// Pages are shared with the buffer pool, so hand out copies.
+			c.key = append([]byte(nil), top.pg.keys[top.idx]...)
+			c.value = append([]byte(nil), top.pg.values[top.idx]...)
+			c.valid = true
+			return
+		}
+		if !top.pg.leaf && top.idx < len(top.pg.children) {
+			pg, err := c.t.pager.read(top.pg.children[top.idx])
+			if err != nil {
+				c.fail(err)
+				return
+			}
+			c.stack = append(c.stack, frame{pg: pg})
+			continue
+		}
+
+		// Page exhausted: pop and move the parent to its next child.
+		c.stack = c.stack[:len(c.stack)-1]
+		if len(c.stack) == 0 {
+			c.valid = false
+			return
+		}
+		c.stack[len(c.stack)-1].idx++
+	}
+}
+
+func (c *Cursor) fail(err error) {
+	c.valid, c.err = false, err
+}
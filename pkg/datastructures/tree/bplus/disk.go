@@ -0,0 +1,259 @@
+package bplus
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"sync"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/datastructures/arc"
+)
+
+var (
+	// ErrEntryTooLarge is returned when a key/value pair cannot fit in a
+	// quarter of a page, which is required to keep splits well-formed.
+	ErrEntryTooLarge = errors.New("bplus: entry too large for page size")
+
+	// ErrEmptyKey is returned when writing an empty key.
+	ErrEmptyKey = errors.New("bplus: key must not be empty")
+
+	// ErrTxClosed is returned when a Tx is used after Update returned.
+	ErrTxClosed = errors.New("bplus: transaction closed")
+
+	// ErrClosed is returned when a DiskTree is used after Close.
+	ErrClosed = errors.New("bplus: tree closed")
+)
+
+// DiskConfig configures a DiskTree.
+type DiskConfig struct {
+	// Path is the database file. It is created if it does not exist.
+	Path string
+
+	// PageSize is the fixed page size in bytes, between 512 and 65536.
+	// It only applies when creating a file. Default 4096.
+	PageSize int
+
+	// CachePages is the number of decoded pages kept in the buffer pool.
+	// Default 1024.
+	CachePages int
+
+	// NoSync skips fsync on commit. A process crash is still safe, but an
+	// operating system crash may roll back recent commits or corrupt the file.
+	NoSync bool
+}
+
+// DiskTree is a persistent B+ tree over byte-slice keys stored in fixed-size
+// pages of a single file.
+//
+// Updates are copy-on-write: a transaction writes modified pages to free
+// locations and then atomically switches to the new root by writing one of
+// two meta pages. A crash at any point leaves the file at the last committed
+// version. Readers run concurrently with each other; writers are serialized.
+type DiskTree struct {
+	pager *pager
+	meta  meta
+
+	closed bool
+	mu     sync.RWMutex
+}
+
+// OpenDisk opens or creates the tree stored at cfg.Path.
+func OpenDisk(cfg DiskConfig) (*DiskTree, error) {
+	if cfg.PageSize == 0 {
+		cfg.PageSize = 4096
+	}
+	if cfg.PageSize < 512 || cfg.PageSize > 65536 {
+		return nil, errors.New("bplus: page size must be between 512 and 65536")
+	}
+	if cfg.CachePages <= 0 {
+		cfg.CachePages = 1024
+	}
+
+	f, err := os.OpenFile(cfg.Path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	// An existing file keeps the page size it was created with.
+	if st.Size() >= metaSize {
+		hdr := make([]byte, metaSize)
+		if _, err := f.ReadAt(hdr, 0); err == nil && binary.LittleEndian.Uint64(hdr) == metaMagic {
+			if ps := int(binary.LittleEndian.Uint32(hdr[8:])); ps >= 512 && ps <= 65536 {
+				cfg.PageSize = ps
+			}
+		}
+	}
+
+	t := &DiskTree{pager: &pager{
+		f:        f,
+		pageSize: cfg.PageSize,
+		cache:    arc.New[uint64, *page](cfg.CachePages),
+		noSync:   cfg.NoSync,
+	}}
+
+	if st.Size() == 0 {
+		err = t.create()
+	} else {
+		err = t.load()
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// create initializes an empty file: an empty root leaf and both meta pages.
+func (t *DiskTree) create() error {
+	p := t.pager
+	p.numPages = firstDataPage
+	root := &page{id: p.alloc(), leaf: true}
+	if err := p.write(root); err != nil {
+		return err
+	}
+	if err := p.sync(); err != nil {
+		return err
+	}
+	t.meta = meta{txid: 1, root: root.id, numPages: p.numPages}
+	for _, txid := range []uint64{0, 1} {
+		m := t.meta
+		m.txid = txid
+		if err := p.writeMeta(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// load reads the current meta and rebuilds the free list by marking every
+// page reachable from the root; all other pages below the high-water mark
+// are free, including pages written by a transaction that never committed.
+func (t *DiskTree) load() error {
+	p := t.pager
+	m, err := p.readMeta()
+	if err != nil {
+		return err
+	}
+	t.meta = m
+	p.numPages = m.numPages
+
+	used := make(map[uint64]bool)
+	var walk func(id uint64) error
+	walk = func(id uint64) error {
+		if id < firstDataPage || id >= m.numPages || used[id] {
+			return errCorruptPage
+		}
+		used[id] = true
+		pg, err := p.read(id)
+		if err != nil {
+			return err
+		}
+		for _, c := range pg.children {
+			if err := walk(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(m.root); err != nil {
+		return err
+	}
+
+	for id := m.numPages - 1; id >= firstDataPage; id-- {
+		if !used[id] {
+			p.free = append(p.free, id)
+		}
+	}
+	return nil
+}
+
+// Get returns the value stored under key.
+func (t *DiskTree) Get(key []byte) ([]byte, bool, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return nil, false, ErrClosed
+	}
+	return get(t.pager.read, t.meta.root, key)
+}
+
+// Put stores value under key in its own transaction.
+func (t *DiskTree) Put(key, value []byte) error {
+	return t.Update(func(tx *Tx) error {
+		return tx.Put(key, value)
+	})
+}
+
+// Delete removes key in its own transaction and reports whether it existed.
+func (t *DiskTree) Delete(key []byte) (bool, error) {
+	var found bool
+	err := t.Update(func(tx *Tx) error {
+		var err error
+		found, err = tx.Delete(key)
+		return err
+	})
+	return found, err
+}
+
+// Update runs fn in a write transaction. If fn returns nil the changes are
+// committed atomically and durably; otherwise they are discarded.
+func (t *DiskTree) Update(fn func(tx *Tx) error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return ErrClosed
+	}
+
+	tx := t.begin()
+	defer func() { tx.t = nil }()
+
+	if err := fn(tx); err != nil {
+		tx.rollback()
+		return err
+	}
+	return tx.commit()
+}
+
+// Len returns the number of keys in the tree.
+func (t *DiskTree) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return int(t.meta.count)
+}
+
+// Close closes the underlying file. All committed data is already on disk.
+func (t *DiskTree) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+	return t.pager.f.Close()
+}
+
+// get descends from root to the leaf covering key.
+func get(read func(uint64) (*page, error), root uint64, key []byte) ([]byte, bool, error) {
+	pg, err := read(root)
+	if err != nil {
+		return nil, false, err
+	}
+	for !pg.leaf {
+		if pg, err = read(pg.children[pg.childIndex(key)]); err != nil {
+			return nil, false, err
+		}
+	}
+	i := pg.search(key)
+	if i < len(pg.keys) && string(pg.keys[i]) == string(key) {
+		return append([]byte(nil), pg.values[i]...), true, nil
+	}
+	return nil, false, nil
+}
@@ -1,4 +1,34 @@
-// Package bplus provides functionality for bplus.
+// Package bplus provides B+ trees: an in-memory generic Tree and a paged,
+// disk-backed DiskTree for byte-slice keys.
 //
-// TODO: Add detailed documentation.
+// Tree keeps all values in leaves linked left to right. It supports Insert,
+// Search and Delete (with borrowing from and merging of siblings) and ordered
+// iteration via Seek/First and Iterator.Next.
+//
+// DiskTree stores nodes in fixed-size pages of a single file and caches
+// decoded pages in an ARC buffer pool (see package arc). Writes are
+// copy-on-write: a transaction writes the modified path to free pages and
+// commits by writing one of two alternating meta pages, so the file always
+// holds a consistent version even after a crash. Pages are split and merged
+// by encoded size, which allows variable-length keys and values up to a
+// quarter of a page.
+//
+// Usage:
+//
+//	t, err := bplus.OpenDisk(bplus.DiskConfig{Path: "index.db"})
+//	if err != nil {
+//		return err
+//	}
+//	defer t.Close()
+//
+//	err = t.Update(func(tx *bplus.Tx) error {
+//		if err := tx.Put([]byte("2024-01-01"), []byte("a")); err != nil {
+//			return err
+//		}
+//		return tx.Put([]byte("2024-01-02"), []byte("b"))
+//	})
+//
+//	for c := t.Seek([]byte("2024-01")); c.Valid(); c.Next() {
+//		fmt.Printf("%s=%s\n", c.Key(), c.Value())
+//	}
 package bplus
@@ -0,0 +1,106 @@
+package bplus
+
+import (
+	"sort"
+
+	"golang.org/x/exp/constraints"
+)
+
+// Iterator walks the tree in ascending key order along the leaf chain.
+//
+// An iterator may be used while the tree is modified: it never returns a key
+// twice or out of order, and after a modification it continues from the first
+// key greater than the current one.
+type Iterator[K constraints.Ordered, V any] struct {
+	t       *Tree[K, V]
+	leaf    *node[K, V]
+	idx     int
+	version uint64
+	key     K
+	value   V
+	valid   bool
+}
+
+// Seek returns an iterator positioned at the first key >= key.
+func (t *Tree[K, V]) Seek(key K) *Iterator[K, V] {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	n := t.findLeaf(key)
+	it := &Iterator[K, V]{t: t, version: t.version}
+	it.position(n, sort.Search(len(n.keys), func(i int) bool { return n.keys[i] >= key }))
+	return it
+}
+
+// First returns an iterator positioned at the smallest key.
+func (t *Tree[K, V]) First() *Iterator[K, V] {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	n := t.root
+	for !n.isLeaf {
+		n = n.children[0]
+	}
+	it := &Iterator[K, V]{t: t, version: t.version}
+	it.position(n, 0)
+	return it
+}
+
+// Valid reports whether the iterator is positioned at an entry.
+func (it *Iterator[K, V]) Valid() bool {
+	return it.valid
+}
+
+// Key returns the current key.
+func (it *Iterator[K, V]) Key() K {
+	return it.key
+}
+
+// Value returns the current value.
+func (it *Iterator[K, V]) Value() V {
+	return it.value
+}
+
+// Next advances to the next key and reports whether the iterator is still valid.
+func (it *Iterator[K, V]) Next() bool {
+	if !it.valid {
+		return false
+	}
+
+	it.t.mu.RLock()
+	defer it.t.mu.RUnlock()
+
+	if it.version == it.t.version {
+		it.position(it.leaf, it.idx+1)
+		return it.valid
+	}
+
+	// The tree changed since the last step: leaves may have been split,
+	// merged or rebalanced, so find the successor from the root.
+	last := it.key
+	n := it.t.findLeaf(last)
+	it.version = it.t.version
+	it.position(n, sort.Search(len(n.keys), func(i int) bool { return n.keys[i] > last }))
+	return it.valid
+}
+
+// position moves to leaf.keys[idx], following the leaf chain past
+// exhausted leaves.
+func (it *Iterator[K, V]) position(leaf *node[K, V], idx int) {
+	for leaf != nil && idx >= len(leaf.keys) {
+		leaf, idx = leaf.next, 0
+	}
+	it.leaf, it.idx, it.valid = leaf, idx, leaf != nil
+	if it.valid {
+		it.key, it.value = leaf.keys[idx], leaf.values[idx]
+	}
+}
+
+// findLeaf returns the leaf whose key range covers key. Callers hold the lock.
+func (t *Tree[K, V]) findLeaf(key K) *node[K, V] {
+	n := t.root
+	for !n.isLeaf {
+		n = n.children[sort.Search(len(n.keys), func(i int) bool { return key < n.keys[i] })]
+	}
+	return n
+}
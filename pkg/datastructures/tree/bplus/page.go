@@ -0,0 +1,172 @@
+package bplus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"sort"
+)
+
+// On-disk page layout (all integers little endian):
+//
+//	[flags uint8][count uint16] entries... [zero padding] [crc32 uint32]
+//
+// Leaf entries are [keyLen uvarint][key][valueLen uvarint][value]. Internal
+// pages store the leftmost child first, [child uint64], followed by count
+// entries of [keyLen uvarint][key][child uint64]; keys[i] separates
+// children[i] (keys < keys[i]) from children[i+1] (keys >= keys[i]).
+const (
+	pageHeaderSize  = 3
+	pageTrailerSize = 4
+	flagLeaf        = 1
+)
+
+var errCorruptPage = errors.New("bplus: corrupt page")
+
+// page is the decoded form of a disk page. Pages read from disk are shared
+// through the buffer pool and must be treated as immutable; a write
+// transaction modifies a private copy (see Tx.writable).
+type page struct {
+	id       uint64
+	leaf     bool
+	keys     [][]byte
+	values   [][]byte // leaves only
+	children []uint64 // internal pages only
+}
+
+func (p *page) clone(id uint64) *page {
+	return &page{
+		id:       id,
+		leaf:     p.leaf,
+		keys:     append([][]byte(nil), p.keys...),
+		values:   append([][]byte(nil), p.values...),
+		children: append([]uint64(nil), p.children...),
+	}
+}
+
+// search returns the index of the first key >= key.
+func (p *page) search(key []byte) int {
+	return sort.Search(len(p.keys), func(i int) bool { return bytes.Compare(p.keys[i], key) >= 0 })
+}
+
+// childIndex returns the index of the child whose range covers key.
+func (p *page) childIndex(key []byte) int {
+	return sort.Search(len(p.keys), func(i int) bool { return bytes.Compare(key, p.keys[i]) < 0 })
+}
+
+// size returns the encoded size of the page in bytes.
+func (p *page) size() int {
+	n := pageHeaderSize + pageTrailerSize
+	if !p.leaf {
+		n += 8
+	}
+	for i, k := range p.keys {
+		if p.leaf {
+			n += leafEntrySize(k, p.values[i])
+		} else {
+			n += internalEntrySize(k)
+		}
+	}
+	return n
+}
+
+func leafEntrySize(key, value []byte) int {
+	return uvarintLen(len(key)) + len(key) + uvarintLen(len(value)) + len(value)
+}
+
+func internalEntrySize(key []byte) int {
+	return uvarintLen(len(key)) + len(key) + 8
+}
+
+func uvarintLen(n int) int {
+	var buf [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(buf[:], uint64(n))
+}
+
+// encode serializes p into a buffer of exactly pageSize bytes.
+func (p *page) encode(pageSize int) []byte {
+	buf := make([]byte, pageHeaderSize, pageSize)
+	if p.leaf {
+		buf[0] = flagLeaf
+	}
+	binary.LittleEndian.PutUint16(buf[1:], uint16(len(p.keys)))
+
+	if p.leaf {
+		for i, k := range p.keys {
+			buf = binary.AppendUvarint(buf, uint64(len(k)))
+			buf = append(buf, k...)
+			buf = binary.AppendUvarint(buf, uint64(len(p.values[i])))
+			buf = append(buf, p.values[i]...)
+		}
+	} else {
+		buf = binary.LittleEndian.AppendUint64(buf, p.children[0])
+		for i, k := range p.keys {
+			buf = binary.AppendUvarint(buf, uint64(len(k)))
+			buf = append(buf, k...)
+			buf = binary.LittleEndian.AppendUint64(buf, p.children[i+1])
+		}
+	}
+
+	buf = buf[:pageSize]
+	binary.LittleEndian.PutUint32(buf[pageSize-pageTrailerSize:], crc32.ChecksumIEEE(buf[:pageSize-pageTrailerSize]))
+	return buf
+}
+
+func decodePage(id uint64, buf []byte) (*page, error) {
+	end := len(buf) - pageTrailerSize
+	if end < pageHeaderSize || crc32.ChecksumIEEE(buf[:end]) != binary.LittleEndian.Uint32(buf[end:]) {
+		return nil, errCorruptPage
+	}
+
+	p := &page{id: id, leaf: buf[0]&flagLeaf != 0}
+	count := int(binary.LittleEndian.Uint16(buf[1:]))
+	data := buf[pageHeaderSize:end]
+
+	readBytes := func() ([]byte, bool) {
+		n, m := binary.Uvarint(data)
+		if m <= 0 || uint64(len(data)-m) < n {
+			return nil, false
+		}
+		b := append([]byte(nil), data[m:m+int(n)]...)
+		data = data[m+int(n):]
+		return b, true
+	}
+	readChild := func() (uint64, bool) {
+		if len(data) < 8 {
+			return 0, false
+		}
+		c := binary.LittleEndian.Uint64(data)
+		data = data[8:]
+		return c, true
+	}
+
+	if !p.leaf {
+		c, ok := readChild()
+		if !ok {
+			return nil, errCorruptPage
+		}
+		p.children = append(p.children, c)
+	}
+	for i := 0; i < count; i++ {
+		k, ok := readBytes()
+		if !ok {
+			return nil, errCorruptPage
+		}
+		p.keys = append(p.keys, k)
+		if p.leaf {
+			v, ok := readBytes()
+			if !ok {
+				return nil, errCorruptPage
+			}
+			p.values = append(p.values, v)
+		} else {
+			c, ok := readChild()
+			if !ok {
+				return nil, errCorruptPage
+			}
+			p.children = append(p.children, c)
+		}
+	}
+	return p, nil
+}
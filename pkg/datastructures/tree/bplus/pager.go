@@ -0,0 +1,138 @@
+package bplus
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/datastructures/arc"
+)
+
+// Pages 0 and 1 hold two copies of the meta record. A commit writes the slot
+// not used by the current version, so a crash while writing it leaves the
+// previous meta intact. Open picks the valid meta with the highest txid.
+const (
+	metaMagic     = uint64(0x42504c5553545245) // "BPLUSTRE"
+	metaSize      = 48
+	firstDataPage = 2
+)
+
+var errNoValidMeta = errors.New("bplus: no valid meta page")
+
+type meta struct {
+	txid     uint64
+	root     uint64
+	numPages uint64 // high-water mark: every page id is < numPages
+	count    uint64
+}
+
+func (m meta) encode(pageSize int) []byte {
+	buf := make([]byte, pageSize)
+	binary.LittleEndian.PutUint64(buf[0:], metaMagic)
+	binary.LittleEndian.PutUint32(buf[8:], uint32(pageSize))
+	binary.LittleEndian.PutUint64(buf[12:], m.txid)
+	binary.LittleEndian.PutUint64(buf[20:], m.root)
+	binary.LittleEndian.PutUint64(buf[28:], m.numPages)
+	binary.LittleEndian.PutUint64(buf[36:], m.count)
+	binary.LittleEndian.PutUint32(buf[44:], crc32.ChecksumIEEE(buf[:44]))
+	return buf
+}
+
+func decodeMeta(buf []byte, pageSize int) (meta, bool) {
+	if len(buf) < metaSize ||
+		binary.LittleEndian.Uint64(buf[0:]) != metaMagic ||
+		binary.LittleEndian.Uint32(buf[8:]) != uint32(pageSize) ||
+		binary.LittleEndian.Uint32(buf[44:]) != crc32.ChecksumIEEE(buf[:44]) {
+		return meta{}, false
+	}
+	return meta{
+		txid:     binary.LittleEndian.Uint64(buf[12:]),
+		root:     binary.LittleEndian.Uint64(buf[20:]),
+		numPages: binary.LittleEndian.Uint64(buf[28:]),
+		count:    binary.LittleEndian.Uint64(buf[36:]),
+	}, true
+}
+
+// pager reads and writes fixed-size pages and caches decoded pages in an ARC
+// buffer pool. Committed pages are never modified in place, so cached pages
+// are always clean and eviction needs no write-back.
+type pager struct {
+	f        *os.File
+	pageSize int
+	cache    *arc.Cache[uint64, *page]
+	noSync   bool
+
+	numPages uint64
+	free     []uint64
+}
+
+func (p *pager) read(id uint64) (*page, error) {
+	if pg, ok := p.cache.Get(id); ok {
+		return pg, nil
+	}
+	buf := make([]byte, p.pageSize)
+	if _, err := p.f.ReadAt(buf, int64(id)*int64(p.pageSize)); err != nil {
+		return nil, err
+	}
+	pg, err := decodePage(id, buf)
+	if err != nil {
+		return nil, err
+	}
+	p.cache.Set(id, pg)
+	return pg, nil
+}
+
+func (p *pager) write(pg *page) error {
+	if _, err := p.f.WriteAt(pg.encode(p.pageSize), int64(pg.id)*int64(p.pageSize)); err != nil {
+		return err
+	}
+	p.cache.Set(pg.id, pg)
+	return nil
+}
+
+func (p *pager) writeMeta(m meta) error {
+	slot := int64(m.txid % 2)
+	if _, err := p.f.WriteAt(m.encode(p.pageSize), slot*int64(p.pageSize)); err != nil {
+		return err
+	}
+	return p.sync()
+}
+
+func (p *pager) readMeta() (meta, error) {
+	var (
+		best  meta
+		found bool
+	)
+	buf := make([]byte, p.pageSize)
+	for slot := int64(0); slot < 2; slot++ {
+		if _, err := p.f.ReadAt(buf, slot*int64(p.pageSize)); err != nil {
+			continue
+		}
+		if m, ok := decodeMeta(buf, p.pageSize); ok && (!found || m.txid > best.txid) {
+			best, found = m, true
+		}
+	}
+	if !found {
+		return meta{}, errNoValidMeta
+	}
+	return best, nil
+}
+
+func (p *pager) alloc() uint64 {
+	if n := len(p.free); n > 0 {
+		id := p.free[n-1]
+		p.free = p.free[:n-1]
+		return id
+	}
+	id := p.numPages
+	p.numPages++
+	return id
+}
+
+func (p *pager) sync() error {
+	if p.noSync {
+		return nil
+	}
+	return p.f.Sync()
+}
@@ -0,0 +1,172 @@
+package bplus_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/datastructures/tree/bplus"
+)
+
+func openDisk(t *testing.T, path string) *bplus.DiskTree {
+	t.Helper()
+	tree, err := bplus.OpenDisk(bplus.DiskConfig{Path: path, PageSize: 512, CachePages: 16, NoSync: true})
+	if err != nil {
+		t.Fatalf("OpenDisk: %v", err)
+	}
+	return tree
+}
+
+func diskKey(i int) []byte {
+	return []byte(fmt.Sprintf("key-%05d", i))
+}
+
+func TestDiskTreeCRUD(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	tree := openDisk(t, path)
+
+	const n = 2000
+	err := tree.Update(func(tx *bplus.Tx) error {
+		for i := 0; i < n; i++ {
+			if err := tx.Put(diskKey(i), []byte(fmt.Sprintf("value-%d", i))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.Len() != n {
+		t.Fatalf("Len = %d, want %d", tree.Len(), n)
+	}
+
+	for i := 0; i < n; i += 3 {
+		if found, err := tree.Delete(diskKey(i)); err != nil || !found {
+			t.Fatalf("Delete(%d) = %v, %v", i, found, err)
+		}
+	}
+	if err := tree.Put(diskKey(1), []byte("updated")); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(tree *bplus.DiskTree) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			v, found, err := tree.Get(diskKey(i))
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case i%3 == 0:
+				if found {
+					t.Fatalf("key %d should be deleted", i)
+				}
+			case i == 1:
+				if string(v) != "updated" {
+					t.Fatalf("key 1 = %q", v)
+				}
+			default:
+				if !found || string(v) != fmt.Sprintf("value-%d", i) {
+					t.Fatalf("key %d = %q, %v", i, v, found)
+				}
+			}
+		}
+
+		var prev []byte
+		count := 0
+		for c := tree.First(); c.Valid(); c.Next() {
+			if prev != nil && bytes.Compare(prev, c.Key()) >= 0 {
+				t.Fatalf("cursor out of order: %s after %s", c.Key(), prev)
+			}
+			prev = c.Key()
+			count++
+		}
+		if count != tree.Len() {
+			t.Fatalf("cursor visited %d keys, Len = %d", count, tree.Len())
+		}
+
+		c := tree.Seek(diskKey(300))
+		if !c.Valid() || !bytes.Equal(c.Key(), diskKey(301)) {
+			t.Fatalf("Seek(300) = %s", c.Key())
+		}
+	}
+	check(tree)
+
+	if err := tree.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tree = openDisk(t, path)
+	defer tree.Close()
+	check(tree)
+}
+
+func TestDiskTreeRollback(t *testing.T) {
+	tree := openDisk(t, filepath.Join(t.TempDir(), "tree.db"))
+	defer tree.Close()
+
+	tree.Put([]byte("a"), []byte("1"))
+	boom := errors.New("boom")
+	err := tree.Update(func(tx *bplus.Tx) error {
+		tx.Put([]byte("b"), []byte("2"))
+		tx.Delete([]byte("a"))
+		if _, found, _ := tx.Get([]byte("b")); !found {
+			t.Error("transaction does not see its own write")
+		}
+		return boom
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("Update = %v", err)
+	}
+	if _, found, _ := tree.Get([]byte("a")); !found {
+		t.Error("rolled back delete is visible")
+	}
+	if _, found, _ := tree.Get([]byte("b")); found {
+		t.Error("rolled back put is visible")
+	}
+
+	if err := tree.Put([]byte("big"), make([]byte, 512)); !errors.Is(err, bplus.ErrEntryTooLarge) {
+		t.Errorf("expected ErrEntryTooLarge, got %v", err)
+	}
+}
+
+func TestDiskTreeTornCommit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	tree := openDisk(t, path)
+	for i := 0; i < 100; i++ {
+		tree.Put(diskKey(i), []byte("v"))
+	}
+	tree.Close()
+
+	// Corrupt the most recently written meta page, as if the machine crashed
+	// while committing; the previous version must still open.
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A new file starts at txid 1, so the 100th commit is txid 101, which
+	// lives in meta slot 101 % 2.
+	const lastSlot = 101 % 2
+	if _, err := f.WriteAt([]byte("garbage"), lastSlot*512+20); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	tree = openDisk(t, path)
+	defer tree.Close()
+	if tree.Len() != 99 {
+		t.Fatalf("Len after torn commit = %d, want 99", tree.Len())
+	}
+	for i := 0; i < 99; i++ {
+		if _, found, err := tree.Get(diskKey(i)); err != nil || !found {
+			t.Fatalf("key %d lost: %v", i, err)
+		}
+	}
+	// The tree stays writable.
+	if err := tree.Put(diskKey(99), []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -28,3 +28,60 @@ func TestBPlusTree(t *testing.T) {
 		t.Error("Update failed")
 	}
 }
+
+func TestBPlusTreeDeleteAndIterate(t *testing.T) {
+	tree := bplus.New[int, int]()
+	for i := 0; i < 200; i++ {
+		tree.Insert(i, i*10)
+	}
+
+	// Delete every even key, forcing borrows and merges.
+	for i := 0; i < 200; i += 2 {
+		if !tree.Delete(i) {
+			t.Fatalf("Delete(%d) returned false", i)
+		}
+	}
+	if tree.Delete(0) {
+		t.Error("Deleted a missing key")
+	}
+	for i := 0; i < 200; i++ {
+		_, found := tree.Search(i)
+		if found != (i%2 == 1) {
+			t.Fatalf("Search(%d) found=%v", i, found)
+		}
+	}
+
+	// Seek lands on the next present key.
+	it := tree.Seek(50)
+	if !it.Valid() || it.Key() != 51 || it.Value() != 510 {
+		t.Fatalf("Seek(50) = %v %v", it.Key(), it.Value())
+	}
+	count := 0
+	prev := -1
+	for it = tree.First(); it.Valid(); it.Next() {
+		if it.Key() <= prev {
+			t.Fatalf("iteration out of order: %d after %d", it.Key(), prev)
+		}
+		prev = it.Key()
+		count++
+	}
+	if count != 100 {
+		t.Errorf("iterated %d keys, want 100", count)
+	}
+
+	// Iteration continues correctly when the tree changes underneath.
+	it = tree.First()
+	for i := 1; i < 200; i += 2 {
+		tree.Delete(i)
+	}
+	tree.Insert(500, 0)
+	if !it.Next() || it.Key() != 500 {
+		t.Errorf("expected iterator to resume at 500, got valid=%v key=%v", it.Valid(), it.Key())
+	}
+
+	// Delete down to empty.
+	tree.Delete(500)
+	if it := tree.First(); it.Valid() {
+		t.Errorf("expected empty tree, found %v", it.Key())
+	}
+}
@@ -12,8 +12,9 @@ const (
 )
 
 type Tree[K constraints.Ordered, V any] struct {
-	root *node[K, V]
-	mu   sync.RWMutex
+	root    *node[K, V]
+	version uint64 // bumped on every modification, see Iterator
+	mu      sync.RWMutex
 }
 
 type node[K constraints.Ordered, V any] struct {
@@ -65,6 +66,7 @@ func (t *Tree[K, V]) Search(key K) (V, bool) {
 func (t *Tree[K, V]) Insert(key K, value V) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
+	t.version++
 
 	root := t.root
 	if len(root.keys) == 2*degree-1 {
@@ -84,6 +86,10 @@ func (t *Tree[K, V]) insertNonFull(n *node[K, V], key K, value V) {
 	if n.isLeaf {
 		// Find position
 		idx := sort.Search(len(n.keys), func(i int) bool { return n.keys[i] >= key })
+		if idx < len(n.keys) && n.keys[idx] == key {
+			n.values[idx] = value
+			return
+		}
 
 		// Insert
 		n.keys = append(n.keys, *new(K))
@@ -164,3 +170,105 @@ func (t *Tree[K, V]) splitChild(parent *node[K, V], index int) {
 		parent.children[index+1] = newChild
 	}
 }
+
+// Delete removes key and reports whether it was present. Nodes that fall
+// below the minimum of degree-1 keys borrow from a sibling or are merged.
+func (t *Tree[K, V]) Delete(key K) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.delete(t.root, key) {
+		return false
+	}
+	t.version++
+	if !t.root.isLeaf && len(t.root.keys) == 0 {
+		t.root = t.root.children[0]
+	}
+	return true
+}
+
+func (t *Tree[K, V]) delete(n *node[K, V], key K) bool {
+	if n.isLeaf {
+		idx := sort.Search(len(n.keys), func(i int) bool { return n.keys[i] >= key })
+		if idx == len(n.keys) || n.keys[idx] != key {
+			return false
+		}
+		n.keys = append(n.keys[:idx], n.keys[idx+1:]...)
+		n.values = append(n.values[:idx], n.values[idx+1:]...)
+		return true
+	}
+
+	// Separator keys are only routing hints, so a deleted key may remain
+	// in an internal node without affecting lookups.
+	idx := sort.Search(len(n.keys), func(i int) bool { return key < n.keys[i] })
+	if !t.delete(n.children[idx], key) {
+		return false
+	}
+	if len(n.children[idx].keys) < degree-1 {
+		t.rebalance(n, idx)
+	}
+	return true
+}
+
+// rebalance restores the minimum occupancy of parent.children[idx].
+func (t *Tree[K, V]) rebalance(parent *node[K, V], idx int) {
+	child := parent.children[idx]
+
+	if idx > 0 {
+		if left := parent.children[idx-1]; len(left.keys) > degree-1 {
+			last := len(left.keys) - 1
+			if child.isLeaf {
+				child.keys = append([]K{left.keys[last]}, child.keys...)
+				child.values = append([]V{left.values[last]}, child.values...)
+				left.keys, left.values = left.keys[:last], left.values[:last]
+				parent.keys[idx-1] = child.keys[0]
+			} else {
+				child.keys = append([]K{parent.keys[idx-1]}, child.keys...)
+				child.children = append([]*node[K, V]{left.children[last+1]}, child.children...)
+				parent.keys[idx-1] = left.keys[last]
+				left.keys, left.children = left.keys[:last], left.children[:last+1]
+			}
+			return
+		}
+	}
+
+	if idx < len(parent.children)-1 {
+		if right := parent.children[idx+1]; len(right.keys) > degree-1 {
+			if child.isLeaf {
+				child.keys = append(child.keys, right.keys[0])
+				child.values = append(child.values, right.values[0])
+				right.keys, right.values = right.keys[1:], right.values[1:]
+				parent.keys[idx] = right.keys[0]
+			} else {
+				child.keys = append(child.keys, parent.keys[idx])
+				child.children = append(child.children, right.children[0])
+				parent.keys[idx] = right.keys[0]
+				right.keys, right.children = right.keys[1:], right.children[1:]
+			}
+			return
+		}
+	}
+
+	if idx > 0 {
+		t.merge(parent, idx-1)
+	} else {
+		t.merge(parent, idx)
+	}
+}
+
+// merge folds parent.children[i+1] into parent.children[i].
+func (t *Tree[K, V]) merge(parent *node[K, V], i int) {
+	left, right := parent.children[i], parent.children[i+1]
+
+	if left.isLeaf {
+		left.keys = append(left.keys, right.keys...)
+		left.values = append(left.values, right.values...)
+		left.next = right.next
+	} else {
+		left.keys = append(append(left.keys, parent.keys[i]), right.keys...)
+		left.children = append(left.children, right.children...)
+	}
+
+	parent.keys = append(parent.keys[:i], parent.keys[i+1:]...)
+	parent.children = append(parent.children[:i+1], parent.children[i+2:]...)
+}
@@ -0,0 +1,323 @@
+package bplus
+
+// Tx is a write transaction on a DiskTree. It is only valid inside the
+// function passed to DiskTree.Update.
+//
+// Every page on the path to a modified leaf is copied to a newly allocated
+// page; the pages it replaces stay intact until the transaction commits, so
+// the previous version remains readable from disk if the commit never
+// completes.
+type Tx struct {
+	t     *DiskTree
+	root  uint64
+	count uint64
+
+	dirty map[uint64]*page // pages allocated by this transaction
+	freed []uint64         // committed pages replaced by this transaction
+
+	// State restored on rollback.
+	savedFree     []uint64
+	savedNumPages uint64
+}
+
+type split struct {
+	key   []byte
+	right uint64
+}
+
+func (t *DiskTree) begin() *Tx {
+	return &Tx{
+		t:             t,
+		root:          t.meta.root,
+		count:         t.meta.count,
+		dirty:         make(map[uint64]*page),
+		savedFree:     append([]uint64(nil), t.pager.free...),
+		savedNumPages: t.pager.numPages,
+	}
+}
+
+// Get returns the value stored under key, including uncommitted changes
+// made by this transaction.
+func (tx *Tx) Get(key []byte) ([]byte, bool, error) {
+	if tx.t == nil {
+		return nil, false, ErrTxClosed
+	}
+	return get(tx.read, tx.root, key)
+}
+
+// Put stores value under key.
+func (tx *Tx) Put(key, value []byte) error {
+	if tx.t == nil {
+		return ErrTxClosed
+	}
+	if len(key) == 0 {
+		return ErrEmptyKey
+	}
+	limit := (tx.t.pager.pageSize - pageHeaderSize - pageTrailerSize - 8) / 4
+	if leafEntrySize(key, value) > limit || internalEntrySize(key) > limit {
+		return ErrEntryTooLarge
+	}
+
+	root, sp, added, err := tx.insert(tx.root, key, value)
+	if err != nil {
+		return err
+	}
+	if sp != nil {
+		r := tx.newPage(false)
+		r.keys = [][]byte{sp.key}
+		r.children = []uint64{root, sp.right}
+		root = r.id
+	}
+	tx.root = root
+	if added {
+		tx.count++
+	}
+	return nil
+}
+
+// Delete removes key and reports whether it existed.
+func (tx *Tx) Delete(key []byte) (bool, error) {
+	if tx.t == nil {
+		return false, ErrTxClosed
+	}
+
+	root, found, err := tx.delete(tx.root, key)
+	if err != nil || !found {
+		return false, err
+	}
+	// Collapse a root that was left with a single child.
+	if r := tx.dirty[root]; r != nil && !r.leaf && len(r.keys) == 0 {
+		root = r.children[0]
+		tx.release(r)
+	}
+	tx.root = root
+	tx.count--
+	return true, nil
+}
+
+func (tx *Tx) insert(id uint64, key, value []byte) (uint64, *split, bool, error) {
+	pg, err := tx.read(id)
+	if err != nil {
+		return 0, nil, false, err
+	}
+	w := tx.writable(pg)
+
+	added := false
+	if w.leaf {
+		i := w.search(key)
+		if i < len(w.keys) && string(w.keys[i]) == string(key) {
+			w.values[i] = append([]byte(nil), value...)
+		} else {
+			w.keys = insertAt(w.keys, i, append([]byte(nil), key...))
+			w.values = insertAt(w.values, i, append([]byte(nil), value...))
+			added = true
+		}
+	} else {
+		i := w.childIndex(key)
+		child, sp, a, err := tx.insert(w.children[i], key, value)
+		if err != nil {
+			return 0, nil, false, err
+		}
+		w.children[i] = child
+		if sp != nil {
+			w.keys = insertAt(w.keys, i, sp.key)
+			w.children = insertAt(w.children, i+1, sp.right)
+		}
+		added = a
+	}
+
+	if w.size() <= tx.t.pager.pageSize {
+		return w.id, nil, added, nil
+	}
+	right := tx.newPage(w.leaf)
+	return w.id, &split{key: splitInto(w, right), right: right.id}, added, nil
+}
+
+func (tx *Tx) delete(id uint64, key []byte) (uint64, bool, error) {
+	pg, err := tx.read(id)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if pg.leaf {
+		i := pg.search(key)
+		if i == len(pg.keys) || string(pg.keys[i]) != string(key) {
+			return id, false, nil
+		}
+		w := tx.writable(pg)
+		w.keys = removeAt(w.keys, i)
+		w.values = removeAt(w.values, i)
+		return w.id, true, nil
+	}
+
+	i := pg.childIndex(key)
+	child, found, err := tx.delete(pg.children[i], key)
+	if err != nil || !found {
+		return id, found, err
+	}
+	w := tx.writable(pg)
+	w.children[i] = child
+	if c := tx.dirty[child]; c != nil && c.size() < tx.t.pager.pageSize/4 && len(w.children) > 1 {
+		if err := tx.rebalance(w, i); err != nil {
+			return 0, false, err
+		}
+	}
+	return w.id, true, nil
+}
+
+// rebalance merges an underfull child of w with a sibling, or evens out the
+// pair when the merged page would not fit.
+func (tx *Tx) rebalance(w *page, i int) error {
+	li := i
+	if li == len(w.children)-1 {
+		li--
+	}
+	left, err := tx.read(w.children[li])
+	if err != nil {
+		return err
+	}
+	right, err := tx.read(w.children[li+1])
+	if err != nil {
+		return err
+	}
+
+	merged := &page{leaf: left.leaf}
+	merged.keys = append(append([][]byte(nil), left.keys...), right.keys...)
+	if left.leaf {
+		merged.values = append(append([][]byte(nil), left.values...), right.values...)
+	} else {
+		merged.keys = append(append(append([][]byte(nil), left.keys...), w.keys[li]), right.keys...)
+		merged.children = append(append([]uint64(nil), left.children...), right.children...)
+	}
+
+	l := tx.writable(left)
+	l.keys, l.values, l.children = merged.keys, merged.values, merged.children
+	w.children[li] = l.id
+
+	if l.size() <= tx.t.pager.pageSize {
+		tx.release(right)
+		w.keys = removeAt(w.keys, li)
+		w.children = removeAt(w.children, li+1)
+		return nil
+	}
+
+	r := tx.writable(right)
+	w.keys[li] = splitInto(l, r)
+	w.children[li+1] = r.id
+	return nil
+}
+
+func (tx *Tx) read(id uint64) (*page, error) {
+	if pg, ok := tx.dirty[id]; ok {
+		return pg, nil
+	}
+	return tx.t.pager.read(id)
+}
+
+// writable returns a modifiable version of pg, copying it to a new page the
+// first time it is touched by this transaction.
+func (tx *Tx) writable(pg *page) *page {
+	if _, ok := tx.dirty[pg.id]; ok {
+		return pg
+	}
+	c := pg.clone(tx.t.pager.alloc())
+	tx.dirty[c.id] = c
+	tx.freed = append(tx.freed, pg.id)
+	return c
+}
+
+func (tx *Tx) newPage(leaf bool) *page {
+	pg := &page{id: tx.t.pager.alloc(), leaf: leaf}
+	tx.dirty[pg.id] = pg
+	return pg
+}
+
+// release frees a page that is no longer referenced. Pages from the
+// committed version may only be reused once this transaction commits.
+func (tx *Tx) release(pg *page) {
+	if _, ok := tx.dirty[pg.id]; ok {
+		delete(tx.dirty, pg.id)
+		tx.t.pager.free = append(tx.t.pager.free, pg.id)
+		return
+	}
+	tx.freed = append(tx.freed, pg.id)
+}
+
+func (tx *Tx) commit() error {
+	t := tx.t
+	if len(tx.dirty) == 0 && len(tx.freed) == 0 {
+		return nil
+	}
+
+	for _, pg := range tx.dirty {
+		if err := t.pager.write(pg); err != nil {
+			tx.rollback()
+			return err
+		}
+	}
+	if err := t.pager.sync(); err != nil {
+		tx.rollback()
+		return err
+	}
+
+	m := meta{txid: t.meta.txid + 1, root: tx.root, numPages: t.pager.numPages, count: tx.count}
+	if err := t.pager.writeMeta(m); err != nil {
+		tx.rollback()
+		return err
+	}
+	t.meta = m
+	t.pager.free = append(t.pager.free, tx.freed...)
+	return nil
+}
+
+func (tx *Tx) rollback() {
+	tx.t.pager.free = tx.savedFree
+	tx.t.pager.numPages = tx.savedNumPages
+}
+
+// splitInto moves the upper half of w, by encoded size, into the empty page
+// right and returns the separator key for the parent.
+func splitInto(w, right *page) []byte {
+	sizes := make([]int, len(w.keys))
+	total := 0
+	for i, k := range w.keys {
+		if w.leaf {
+			sizes[i] = leafEntrySize(k, w.values[i])
+		} else {
+			sizes[i] = internalEntrySize(k)
+		}
+		total += sizes[i]
+	}
+	m, acc := 0, 0
+	for m < len(sizes) && acc < total/2 {
+		acc += sizes[m]
+		m++
+	}
+
+	if w.leaf {
+		m = max(1, min(m, len(w.keys)-1))
+		right.keys = append([][]byte(nil), w.keys[m:]...)
+		right.values = append([][]byte(nil), w.values[m:]...)
+		w.keys, w.values = w.keys[:m:m], w.values[:m:m]
+		return right.keys[0]
+	}
+
+	// The key at m moves up to the parent.
+	m = max(1, min(m, len(w.keys)-2))
+	sep := w.keys[m]
+	right.keys = append([][]byte(nil), w.keys[m+1:]...)
+	right.children = append([]uint64(nil), w.children[m+1:]...)
+	w.keys, w.children = w.keys[:m:m], w.children[:m+1:m+1]
+	return sep
+}
+
+func insertAt[T any](s []T, i int, v T) []T {
+	s = append(s, v)
+	copy(s[i+1:], s[i:])
+	s[i] = v
+	return s
+}
+
+func removeAt[T any](s []T, i int) []T {
+	return append(s[:i], s[i+1:]...)
+}
@@ -0,0 +1,184 @@
+package lsm
+
+import (
+	"sort"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+)
+
+// compaction merges inputs from level into the overlapping tables of level+1
+// (or, for a manual compaction, every table into output).
+type compaction struct {
+	inputs [][]*table // per level, tables being replaced
+	output int
+}
+
+// maybeCompact runs at most one compaction. L0 is compacted when it holds
+// L0CompactionTrigger tables; a deeper level is compacted, one table at a
+// time, when its total size exceeds its budget. The caller holds compactMu.
+func (db *DB) maybeCompact() (bool, error) {
+	c := db.pickCompaction()
+	if c == nil {
+		return false, nil
+	}
+	return true, db.runCompaction(c)
+}
+
+func (db *DB) pickCompaction() *compaction {
+	if len(db.levels[0]) >= db.opts.L0CompactionTrigger {
+		c := &compaction{inputs: make([][]*table, len(db.levels)), output: 1}
+		c.inputs[0] = append([]*table{}, db.levels[0]...)
+		lo, hi := keyRange(c.inputs[0])
+		c.inputs[1] = overlapping(db.levels[1], lo, hi)
+		return c
+	}
+
+	maxBytes := db.opts.BaseLevelSize
+	for lvl := 1; lvl < len(db.levels)-1; lvl++ {
+		if levelBytes(db.levels[lvl]) > maxBytes {
+			// Rotate through the key space so that every table is
+			// eventually pushed down, not just the first one.
+			tables := db.levels[lvl]
+			i := sort.Search(len(tables), func(i int) bool { return tables[i].meta.MinKey > db.compactPointer[lvl] })
+			if i == len(tables) {
+				i = 0
+			}
+			t := tables[i]
+			db.compactPointer[lvl] = t.meta.MaxKey
+
+			c := &compaction{inputs: make([][]*table, len(db.levels)), output: lvl + 1}
+			c.inputs[lvl] = []*table{t}
+			c.inputs[lvl+1] = overlapping(db.levels[lvl+1], t.meta.MinKey, t.meta.MaxKey)
+			return c
+		}
+		maxBytes *= int64(db.opts.LevelSizeMultiplier)
+	}
+	return nil
+}
+
+// compactAll merges every table into the deepest populated level (at least
+// L1). All versions of every key take part, so tombstones are dropped.
+func (db *DB) compactAll() error {
+	c := &compaction{inputs: make([][]*table, len(db.levels)), output: 1}
+	n := 0
+	for lvl, tables := range db.levels {
+		if len(tables) == 0 {
+			continue
+		}
+		c.inputs[lvl] = append([]*table{}, tables...)
+		n += len(tables)
+		if lvl > c.output {
+			c.output = lvl
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+	return db.runCompaction(c)
+}
+
+func (db *DB) runCompaction(c *compaction) error {
+	// Newest data first: L0 by descending file number, then each level in
+	// turn. Tables within a deeper level never overlap, so their relative
+	// order does not matter.
+	var (
+		srcs     []source
+		expected int
+		all      []*table
+	)
+	for lvl, tables := range c.inputs {
+		if lvl == 0 {
+			for i := len(tables) - 1; i >= 0; i-- {
+				srcs = append(srcs, tables[i].iterator(""))
+			}
+		} else {
+			for _, t := range tables {
+				srcs = append(srcs, t.iterator(""))
+			}
+		}
+		for _, t := range tables {
+			expected += t.meta.Entries
+		}
+		all = append(all, tables...)
+	}
+
+	// A tombstone may only be dropped when no deeper level can still hold an
+	// older value for the key.
+	lo, hi := keyRange(all)
+	drop := true
+	for lvl := c.output + 1; lvl < len(db.levels); lvl++ {
+		if len(overlapping(db.levels[lvl], lo, hi)) > 0 {
+			drop = false
+			break
+		}
+	}
+
+	outs, err := db.writeTables(newMergeIterator(srcs), drop, db.opts.TargetFileSize, expected)
+	if err != nil {
+		return errors.Internal("lsm: compaction failed", err)
+	}
+
+	db.mu.Lock()
+	prev := make([][]*table, len(db.levels))
+	copy(prev, db.levels)
+	for lvl, tables := range c.inputs {
+		if len(tables) > 0 {
+			db.levels[lvl] = without(db.levels[lvl], tables)
+		}
+	}
+	out := append(append([]*table{}, db.levels[c.output]...), outs...)
+	sort.Slice(out, func(i, j int) bool { return out[i].meta.MinKey < out[j].meta.MinKey })
+	db.levels[c.output] = out
+	if err := saveManifest(db.opts.Dir, db.manifestLocked()); err != nil {
+		db.levels = prev
+		db.mu.Unlock()
+		removeTables(outs)
+		return errors.Internal("lsm: failed to save manifest", err)
+	}
+	db.mu.Unlock()
+
+	// Readers hold the read lock for the whole lookup, so once the new
+	// version is installed no one can still be using the old tables.
+	removeTables(all)
+	return nil
+}
+
+// keyRange returns the smallest and largest key covered by tables.
+func keyRange(tables []*table) (string, string) {
+	var lo, hi string
+	for i, t := range tables {
+		if i == 0 || t.meta.MinKey < lo {
+			lo = t.meta.MinKey
+		}
+		if i == 0 || t.meta.MaxKey > hi {
+			hi = t.meta.MaxKey
+		}
+	}
+	return lo, hi
+}
+
+// overlapping returns the tables whose key range intersects [lo, hi].
+func overlapping(tables []*table, lo, hi string) []*table {
+	var out []*table
+	for _, t := range tables {
+		if t.meta.MaxKey >= lo && t.meta.MinKey <= hi {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// without returns tables minus the ones in remove.
+func without(tables, remove []*table) []*table {
+	skip := make(map[*table]bool, len(remove))
+	for _, t := range remove {
+		skip[t] = true
+	}
+	out := make([]*table, 0, len(tables))
+	for _, t := range tables {
+		if !skip[t] {
+			out = append(out, t)
+		}
+	}
+	return out
+}
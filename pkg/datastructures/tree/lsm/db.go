@@ -0,0 +1,713 @@
+package lsm
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+)
+
+var (
+	// ErrNotFound is returned by Get when the key does not exist or was deleted.
+	ErrNotFound = errors.NotFound("lsm: key not found", nil)
+
+	// ErrClosed is returned when the DB is used after Close.
+	ErrClosed = errors.New(errors.CodeInternal, "lsm: database closed", nil)
+)
+
+// Options configures a DB. Zero values are replaced by defaults.
+type Options struct {
+	// Dir holds the WAL, SSTables and MANIFEST. Required.
+	Dir string
+
+	// MemTableSize is the approximate size in bytes at which the active
+	// MemTable is frozen and flushed to an L0 SSTable. Default 4MB.
+	MemTableSize int64
+
+	// MaxImmutableMemTables bounds how many frozen MemTables may wait for
+	// flushing before writers block. Default 2.
+	MaxImmutableMemTables int
+
+	// BlockSize is the target size of an SSTable data block. Default 4KB.
+	BlockSize int
+
+	// BloomFalsePositiveRate is the target false positive rate of the
+	// per-table bloom filter. Default 0.01.
+	BloomFalsePositiveRate float64
+
+	// L0CompactionTrigger is the number of L0 tables that triggers a
+	// compaction into L1. Default 4.
+	L0CompactionTrigger int
+
+	// BaseLevelSize is the maximum total size of L1; each deeper level may
+	// hold LevelSizeMultiplier times more. Defaults 10MB and 10.
+	BaseLevelSize       int64
+	LevelSizeMultiplier int
+
+	// MaxLevels is the number of levels including L0. Default 7.
+	MaxLevels int
+
+	// TargetFileSize is the size at which compaction output is split into
+	// a new SSTable. Default 2MB.
+	TargetFileSize int64
+
+	// SyncWrites fsyncs the WAL on every write. Without it a machine crash
+	// can lose the most recent writes, but a process crash cannot.
+	SyncWrites bool
+}
+
+func (o Options) withDefaults() Options {
+	if o.MemTableSize <= 0 {
+		o.MemTableSize = 4 << 20
+	}
+	if o.MaxImmutableMemTables <= 0 {
+		o.MaxImmutableMemTables = 2
+	}
+	if o.BlockSize <= 0 {
+		o.BlockSize = 4 << 10
+	}
+	if o.BloomFalsePositiveRate <= 0 || o.BloomFalsePositiveRate >= 1 {
+		o.BloomFalsePositiveRate = 0.01
+	}
+	if o.L0CompactionTrigger <= 0 {
+		o.L0CompactionTrigger = 4
+	}
+	if o.BaseLevelSize <= 0 {
+		o.BaseLevelSize = 10 << 20
+	}
+	if o.LevelSizeMultiplier <= 1 {
+		o.LevelSizeMultiplier = 10
+	}
+	if o.MaxLevels < 2 {
+		o.MaxLevels = 7
+	}
+	if o.TargetFileSize <= 0 {
+		o.TargetFileSize = 2 << 20
+	}
+	return o
+}
+
+// Stats is a point-in-time view of the DB layout.
+type Stats struct {
+	MemTableBytes      int64
+	ImmutableMemTables int
+	LevelFiles         []int
+	LevelBytes         []int64
+}
+
+// frozenTable is an immutable MemTable waiting to be flushed, with the WAL
+// that must be kept until the flush is durable.
+type frozenTable struct {
+	mem    *MemTable
+	logNum uint64
+}
+
+// DB is a persistent, log-structured merge-tree key-value store.
+//
+// Writes go to a write-ahead log and the active MemTable. Full MemTables are
+// frozen and flushed in the background to L0 SSTables, and leveled
+// compaction merges them into larger, non-overlapping SSTables in L1 and
+// below, discarding overwritten values and tombstones.
+type DB struct {
+	opts Options
+
+	mem    *MemTable
+	log    *wal
+	logNum uint64
+	imm    []*frozenTable // oldest first
+
+	// levels[0] is ordered by file number (oldest first) and may overlap;
+	// deeper levels are ordered by MinKey and never overlap.
+	levels         [][]*table
+	compactPointer []string
+	nextFileNum    uint64
+
+	bgErr  error
+	closed bool
+
+	mu   sync.RWMutex
+	cond *sync.Cond
+
+	// compactMu serializes all changes to levels: background flushes and
+	// compactions, and manual Compact calls.
+	compactMu sync.Mutex
+
+	workCh chan struct{}
+	doneCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// Open opens or creates a DB in opts.Dir, replaying any WAL left by a crash.
+func Open(opts Options) (*DB, error) {
+	opts = opts.withDefaults()
+	if opts.Dir == "" {
+		return nil, errors.InvalidArgument("lsm: Dir is required", nil)
+	}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, errors.Internal("lsm: failed to create directory", err)
+	}
+
+	m, err := loadManifest(opts.Dir)
+	if err != nil {
+		return nil, errors.Internal("lsm: failed to load manifest", err)
+	}
+
+	db := &DB{
+		opts:           opts,
+		levels:         make([][]*table, opts.MaxLevels),
+		compactPointer: make([]string, opts.MaxLevels),
+		nextFileNum:    m.NextFileNum,
+		workCh:         make(chan struct{}, 1),
+		doneCh:         make(chan struct{}),
+	}
+	db.cond = sync.NewCond(&db.mu)
+
+	live := make(map[uint64]bool)
+	for lvl, metas := range m.Levels {
+		for _, meta := range metas {
+			t, err := openTable(tableFileName(opts.Dir, meta.FileNum), meta)
+			if err != nil {
+				db.closeTables()
+				return nil, errors.Internal("lsm: failed to open sstable", err)
+			}
+			db.levels[lvl] = append(db.levels[lvl], t)
+			live[meta.FileNum] = true
+		}
+	}
+
+	logs, err := db.cleanDir(live)
+	if err != nil {
+		db.closeTables()
+		return nil, err
+	}
+	if err := db.recover(logs); err != nil {
+		db.closeTables()
+		return nil, err
+	}
+	if err := db.newMemTableLocked(); err != nil {
+		db.closeTables()
+		return nil, err
+	}
+
+	db.wg.Add(1)
+	go db.background()
+	db.signal()
+	return db, nil
+}
+
+// Put stores value under key.
+func (db *DB) Put(key string, value []byte) error {
+	return db.write(record{key: key, value: append([]byte{}, value...)})
+}
+
+// Get returns the value stored under key, or ErrNotFound.
+func (db *DB) Get(key string) ([]byte, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrClosed
+	}
+
+	if v, tomb, ok := db.mem.Lookup(key); ok {
+		return found(v, tomb)
+	}
+	for i := len(db.imm) - 1; i >= 0; i-- {
+		if v, tomb, ok := db.imm[i].mem.Lookup(key); ok {
+			return found(v, tomb)
+		}
+	}
+	for i := len(db.levels[0]) - 1; i >= 0; i-- {
+		r, ok, err := db.levels[0][i].get(key)
+		if err != nil {
+			return nil, errors.Internal("lsm: read failed", err)
+		}
+		if ok {
+			return found(r.value, r.tombstone)
+		}
+	}
+	for lvl := 1; lvl < len(db.levels); lvl++ {
+		tables := db.levels[lvl]
+		i := sort.Search(len(tables), func(i int) bool { return tables[i].meta.MaxKey >= key })
+		if i == len(tables) || tables[i].meta.MinKey > key {
+			continue
+		}
+		r, ok, err := tables[i].get(key)
+		if err != nil {
+			return nil, errors.Internal("lsm: read failed", err)
+		}
+		if ok {
+			return found(r.value, r.tombstone)
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Delete removes key by writing a tombstone.
+func (db *DB) Delete(key string) error {
+	return db.write(record{key: key, tombstone: true})
+}
+
+// Scan calls fn for each live key in [start, end) in ascending order until fn
+// returns false. An empty end means no upper bound. fn must not write to the DB.
+func (db *DB) Scan(start, end string, fn func(key string, value []byte) bool) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+
+	srcs := []source{memSource(db.mem, start, end)}
+	for i := len(db.imm) - 1; i >= 0; i-- {
+		srcs = append(srcs, memSource(db.imm[i].mem, start, end))
+	}
+	for i := len(db.levels[0]) - 1; i >= 0; i-- {
+		srcs = append(srcs, db.levels[0][i].iterator(start))
+	}
+	for lvl := 1; lvl < len(db.levels); lvl++ {
+		for _, t := range db.levels[lvl] {
+			if t.meta.MaxKey >= start && (end == "" || t.meta.MinKey < end) {
+				srcs = append(srcs, t.iterator(start))
+			}
+		}
+	}
+
+	it := newMergeIterator(srcs)
+	for ; it.valid(); it.next() {
+		r := it.record()
+		if end != "" && r.key >= end {
+			break
+		}
+		if r.tombstone {
+			continue
+		}
+		if !fn(r.key, append([]byte{}, r.value...)) {
+			break
+		}
+	}
+	if err := it.status(); err != nil {
+		return errors.Internal("lsm: read failed", err)
+	}
+	return nil
+}
+
+// Flush freezes the active MemTable and waits until every frozen MemTable
+// has been written to an SSTable.
+func (db *DB) Flush() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+	if db.mem.Size() > 0 {
+		if err := db.rotateLocked(); err != nil {
+			return err
+		}
+	}
+	for len(db.imm) > 0 && db.bgErr == nil && !db.closed {
+		db.cond.Wait()
+	}
+	return db.bgErr
+}
+
+// Compact flushes the MemTable and merges every SSTable into the deepest
+// populated level, dropping overwritten values and tombstones.
+func (db *DB) Compact() error {
+	if err := db.Flush(); err != nil {
+		return err
+	}
+
+	db.compactMu.Lock()
+	defer db.compactMu.Unlock()
+	return db.compactAll()
+}
+
+// Stats returns the current size of each layer.
+func (db *DB) Stats() Stats {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	s := Stats{
+		MemTableBytes:      db.mem.Size(),
+		ImmutableMemTables: len(db.imm),
+		LevelFiles:         make([]int, len(db.levels)),
+		LevelBytes:         make([]int64, len(db.levels)),
+	}
+	for lvl, tables := range db.levels {
+		s.LevelFiles[lvl] = len(tables)
+		s.LevelBytes[lvl] = levelBytes(tables)
+	}
+	return s
+}
+
+func (db *DB) write(r record) error {
+	if r.key == "" {
+		return errors.InvalidArgument("lsm: key must not be empty", nil)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if err := db.makeRoomLocked(int64(len(r.key) + len(r.value))); err != nil {
+		return err
+	}
+	if err := db.log.append(r); err != nil {
+		return errors.Internal("lsm: wal append failed", err)
+	}
+	if r.tombstone {
+		db.mem.PutTombstone(r.key)
+	} else {
+		db.mem.Put(r.key, r.value)
+	}
+	return nil
+}
+
+// makeRoomLocked rotates the MemTable when the write would overflow it, and
+// blocks while too many frozen MemTables are waiting to be flushed.
+func (db *DB) makeRoomLocked(size int64) error {
+	for {
+		if db.closed {
+			return ErrClosed
+		}
+		if db.bgErr != nil {
+			return db.bgErr
+		}
+		if db.mem.Size() == 0 || db.mem.Size()+size <= db.opts.MemTableSize {
+			return nil
+		}
+		if len(db.imm) >= db.opts.MaxImmutableMemTables {
+			db.cond.Wait()
+			continue
+		}
+		if err := db.rotateLocked(); err != nil {
+			return err
+		}
+	}
+}
+
+// rotateLocked freezes the active MemTable and starts a new one with its own WAL.
+func (db *DB) rotateLocked() error {
+	if err := db.log.close(); err != nil {
+		return errors.Internal("lsm: wal close failed", err)
+	}
+	db.imm = append(db.imm, &frozenTable{mem: db.mem, logNum: db.logNum})
+	if err := db.newMemTableLocked(); err != nil {
+		return err
+	}
+	db.signal()
+	return nil
+}
+
+func (db *DB) newMemTableLocked() error {
+	num := db.nextFileNum
+	db.nextFileNum++
+	log, err := openWAL(walFileName(db.opts.Dir, num), db.opts.SyncWrites)
+	if err != nil {
+		return errors.Internal("lsm: failed to create wal", err)
+	}
+	// The DB decides when to rotate, so the MemTable itself is unbounded.
+	db.mem = New(math.MaxInt64)
+	db.log = log
+	db.logNum = num
+	return nil
+}
+
+// cleanDir removes files left behind by interrupted flushes or compactions
+// and returns the WAL file numbers to replay, in order.
+func (db *DB) cleanDir(live map[uint64]bool) ([]uint64, error) {
+	entries, err := os.ReadDir(db.opts.Dir)
+	if err != nil {
+		return nil, errors.Internal("lsm: failed to list directory", err)
+	}
+
+	var logs []uint64
+	for _, e := range entries {
+		name := e.Name()
+		path := filepath.Join(db.opts.Dir, name)
+		if strings.HasSuffix(name, ".tmp") {
+			os.Remove(path)
+			continue
+		}
+		ext := filepath.Ext(name)
+		if ext != ".sst" && ext != ".log" {
+			continue
+		}
+		num, err := strconv.ParseUint(strings.TrimSuffix(name, ext), 10, 64)
+		if err != nil {
+			continue
+		}
+		if num >= db.nextFileNum {
+			db.nextFileNum = num + 1
+		}
+		switch {
+		case ext == ".log":
+			logs = append(logs, num)
+		case !live[num]:
+			os.Remove(path)
+		}
+	}
+	sort.Slice(logs, func(i, j int) bool { return logs[i] < logs[j] })
+	return logs, nil
+}
+
+// recover replays WALs into a MemTable, flushes it to L0 and removes the logs.
+func (db *DB) recover(logs []uint64) error {
+	if len(logs) == 0 {
+		return nil
+	}
+
+	mem := New(math.MaxInt64)
+	for _, num := range logs {
+		err := replayWAL(walFileName(db.opts.Dir, num), func(r record) {
+			if r.tombstone {
+				mem.PutTombstone(r.key)
+			} else {
+				mem.Put(r.key, r.value)
+			}
+		})
+		if err != nil {
+			return errors.Internal("lsm: wal replay failed", err)
+		}
+	}
+
+	src := memSource(mem, "", "")
+	tables, err := db.writeTables(src, false, 0, len(src.recs))
+	if err != nil {
+		return errors.Internal("lsm: recovery flush failed", err)
+	}
+	db.levels[0] = append(db.levels[0], tables...)
+	if err := saveManifest(db.opts.Dir, db.manifestLocked()); err != nil {
+		return errors.Internal("lsm: failed to save manifest", err)
+	}
+	for _, num := range logs {
+		os.Remove(walFileName(db.opts.Dir, num))
+	}
+	return nil
+}
+
+func (db *DB) background() {
+	defer db.wg.Done()
+	for {
+		select {
+		case <-db.doneCh:
+			return
+		case <-db.workCh:
+		}
+		if err := db.doWork(); err != nil {
+			db.mu.Lock()
+			db.bgErr = err
+			db.cond.Broadcast()
+			db.mu.Unlock()
+			return
+		}
+	}
+}
+
+// doWork flushes all frozen MemTables, then compacts until every level is
+// within its size budget.
+func (db *DB) doWork() error {
+	db.compactMu.Lock()
+	defer db.compactMu.Unlock()
+
+	for {
+		select {
+		case <-db.doneCh:
+			return nil
+		default:
+		}
+
+		db.mu.RLock()
+		var ft *frozenTable
+		if len(db.imm) > 0 {
+			ft = db.imm[0]
+		}
+		db.mu.RUnlock()
+
+		if ft != nil {
+			if err := db.flush(ft); err != nil {
+				return err
+			}
+			continue
+		}
+
+		did, err := db.maybeCompact()
+		if err != nil || !did {
+			return err
+		}
+	}
+}
+
+func (db *DB) flush(ft *frozenTable) error {
+	src := memSource(ft.mem, "", "")
+	tables, err := db.writeTables(src, false, 0, len(src.recs))
+	if err != nil {
+		return errors.Internal("lsm: flush failed", err)
+	}
+
+	db.mu.Lock()
+	db.levels[0] = append(db.levels[0], tables...)
+	db.imm = db.imm[1:]
+	if err := saveManifest(db.opts.Dir, db.manifestLocked()); err != nil {
+		db.levels[0] = db.levels[0][:len(db.levels[0])-len(tables)]
+		db.imm = append([]*frozenTable{ft}, db.imm...)
+		db.mu.Unlock()
+		removeTables(tables)
+		return errors.Internal("lsm: failed to save manifest", err)
+	}
+	db.cond.Broadcast()
+	db.mu.Unlock()
+
+	os.Remove(walFileName(db.opts.Dir, ft.logNum))
+	return nil
+}
+
+// writeTables writes the records of src to one or more new SSTables, starting
+// a new table whenever targetSize is reached (0 means never).
+func (db *DB) writeTables(src source, dropTombstones bool, targetSize int64, expectedKeys int) ([]*table, error) {
+	var (
+		out []*table
+		w   *tableWriter
+	)
+	fail := func(err error) ([]*table, error) {
+		if w != nil {
+			w.abort()
+		}
+		removeTables(out)
+		return nil, err
+	}
+	finish := func() error {
+		meta, err := w.finish()
+		path := w.path
+		w = nil
+		if err != nil {
+			return err
+		}
+		t, err := openTable(path, meta)
+		if err != nil {
+			os.Remove(path)
+			return err
+		}
+		out = append(out, t)
+		return nil
+	}
+
+	for ; src.valid(); src.next() {
+		r := src.record()
+		if r.tombstone && dropTombstones {
+			continue
+		}
+		if w == nil {
+			num := db.allocFileNum()
+			var err error
+			w, err = newTableWriter(tableFileName(db.opts.Dir, num), num, expectedKeys, db.opts.BlockSize, db.opts.BloomFalsePositiveRate)
+			if err != nil {
+				return fail(err)
+			}
+		}
+		if err := w.add(r); err != nil {
+			return fail(err)
+		}
+		if targetSize > 0 && w.size() >= targetSize {
+			if err := finish(); err != nil {
+				return fail(err)
+			}
+		}
+	}
+	if err := src.status(); err != nil {
+		return fail(err)
+	}
+	if w != nil {
+		if err := finish(); err != nil {
+			return fail(err)
+		}
+	}
+	return out, nil
+}
+
+func (db *DB) allocFileNum() uint64 {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	num := db.nextFileNum
+	db.nextFileNum++
+	return num
+}
+
+func (db *DB) manifestLocked() *manifest {
+	m := &manifest{NextFileNum: db.nextFileNum, Levels: make([][]tableMeta, len(db.levels))}
+	for lvl, tables := range db.levels {
+		for _, t := range tables {
+			m.Levels[lvl] = append(m.Levels[lvl], t.meta)
+		}
+	}
+	return m
+}
+
+func (db *DB) signal() {
+	select {
+	case db.workCh <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops background work and releases files. Frozen MemTables that were
+// not flushed yet are recovered from their WALs on the next Open.
+func (db *DB) Close() error {
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		return nil
+	}
+	db.closed = true
+	db.cond.Broadcast()
+	db.mu.Unlock()
+
+	close(db.doneCh)
+	db.wg.Wait()
+
+	db.compactMu.Lock()
+	defer db.compactMu.Unlock()
+
+	err := db.log.close()
+	db.closeTables()
+	if err != nil {
+		return errors.Internal("lsm: wal close failed", err)
+	}
+	return nil
+}
+
+func (db *DB) closeTables() {
+	for _, tables := range db.levels {
+		for _, t := range tables {
+			t.close()
+		}
+	}
+}
+
+func found(value []byte, tombstone bool) ([]byte, error) {
+	if tombstone {
+		return nil, ErrNotFound
+	}
+	return append([]byte{}, value...), nil
+}
+
+func removeTables(tables []*table) {
+	for _, t := range tables {
+		t.close()
+		os.Remove(t.path)
+	}
+}
+
+func levelBytes(tables []*table) int64 {
+	var n int64
+	for _, t := range tables {
+		n += t.meta.Size
+	}
+	return n
+}
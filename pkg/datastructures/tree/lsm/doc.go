@@ -1,4 +1,32 @@
-// Package lsm provides functionality for lsm.
+// Package lsm provides a persistent log-structured merge-tree key-value store.
 //
-// TODO: Add detailed documentation.
+// Writes are appended to a write-ahead log and applied to an in-memory,
+// skiplist-backed MemTable. When the MemTable fills up it is frozen and a
+// background goroutine flushes it to an immutable, sorted SSTable in level 0.
+// Each SSTable consists of checksummed data blocks, a block index and a bloom
+// filter, so point lookups that miss a table rarely touch the disk.
+//
+// Leveled compaction keeps read amplification bounded: once L0 holds enough
+// tables they are merged into L1, and whenever a deeper level exceeds its size
+// budget one of its tables is merged into the next level. Levels below L0 never
+// contain overlapping tables. Compaction discards overwritten values and, once
+// no deeper level can hold an older version, deletion tombstones.
+//
+// The set of live tables is recorded in a MANIFEST that is replaced atomically.
+// On Open, WAL files left by a crash are replayed and flushed, and files not
+// referenced by the manifest are removed.
+//
+// Usage:
+//
+//	db, err := lsm.Open(lsm.Options{Dir: "/var/lib/app/kv"})
+//	if err != nil {
+//		return err
+//	}
+//	defer db.Close()
+//
+//	db.Put("user:1", []byte("alice"))
+//	v, err := db.Get("user:1")
+//	db.Scan("user:", "user;", func(k string, v []byte) bool { return true })
+//
+// MemTable can also be used on its own as a size-bounded sorted buffer.
 package lsm
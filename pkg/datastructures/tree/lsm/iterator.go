@@ -0,0 +1,93 @@
+package lsm
+
+// source is a sorted stream of records with unique keys.
+type source interface {
+	valid() bool
+	record() record
+	next()
+	status() error
+}
+
+// sliceSource iterates over records already held in memory.
+type sliceSource struct {
+	recs []record
+	pos  int
+}
+
+func (s *sliceSource) valid() bool    { return s.pos < len(s.recs) }
+func (s *sliceSource) record() record { return s.recs[s.pos] }
+func (s *sliceSource) next()          { s.pos++ }
+func (s *sliceSource) status() error  { return nil }
+
+// memSource snapshots the MemTable entries in [start, end) into a sliceSource.
+// An empty end means no upper bound.
+func memSource(m *MemTable, start, end string) *sliceSource {
+	src := &sliceSource{}
+	m.Range(func(key string, value []byte, tombstone bool) bool {
+		if key < start {
+			return true
+		}
+		if end != "" && key >= end {
+			return false
+		}
+		src.recs = append(src.recs, record{key: key, value: value, tombstone: tombstone})
+		return true
+	})
+	return src
+}
+
+// mergeIterator merges sources into a single sorted stream. Sources are
+// ordered newest first: when several contain the same key, the record from
+// the lowest-indexed source wins and the others are skipped.
+type mergeIterator struct {
+	srcs []source
+	cur  record
+	ok   bool
+}
+
+func newMergeIterator(srcs []source) *mergeIterator {
+	it := &mergeIterator{srcs: srcs}
+	it.next()
+	return it
+}
+
+func (it *mergeIterator) valid() bool {
+	return it.ok
+}
+
+func (it *mergeIterator) record() record {
+	return it.cur
+}
+
+func (it *mergeIterator) next() {
+	best := -1
+	for i, s := range it.srcs {
+		if !s.valid() {
+			continue
+		}
+		if best < 0 || s.record().key < it.srcs[best].record().key {
+			best = i
+		}
+	}
+	if best < 0 {
+		it.ok = false
+		return
+	}
+
+	it.cur = it.srcs[best].record()
+	it.ok = true
+	for _, s := range it.srcs {
+		if s.valid() && s.record().key == it.cur.key {
+			s.next()
+		}
+	}
+}
+
+func (it *mergeIterator) status() error {
+	for _, s := range it.srcs {
+		if err := s.status(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
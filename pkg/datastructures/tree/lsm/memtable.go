@@ -6,10 +6,16 @@ import (
 	"github.com/chris-alexander-pop/system-design-library/pkg/datastructures/skiplist"
 )
 
+// memEntry is a value or a tombstone stored in the MemTable.
+type memEntry struct {
+	value     []byte
+	tombstone bool
+}
+
 // MemTable is an in-memory table sorted by key (using a SkipList).
-// In a real LSM, this would flush to SSTables on disk when full.
+// When full, the DB freezes it and flushes it to an SSTable on disk.
 type MemTable struct {
-	sl   *skiplist.SkipList[string, []byte]
+	sl   *skiplist.SkipList[string, memEntry]
 	size int64
 	cap  int64
 	mu   sync.RWMutex
@@ -17,7 +23,7 @@ type MemTable struct {
 
 func New(capacityBytes int64) *MemTable {
 	return &MemTable{
-		sl:  skiplist.New[string, []byte](),
+		sl:  skiplist.New[string, memEntry](),
 		cap: capacityBytes,
 	}
 }
@@ -31,26 +37,60 @@ func (m *MemTable) Put(key string, value []byte) bool {
 		return false // Full, trigger flush
 	}
 
-	m.sl.Set(key, value)
+	m.sl.Set(key, memEntry{value: value})
 	m.size += estimatedSize
 	return true
 }
 
 func (m *MemTable) Get(key string) ([]byte, bool) {
+	value, tombstone, found := m.Lookup(key)
+	if !found || tombstone {
+		return nil, false
+	}
+	return value, true
+}
+
+// Lookup is like Get but distinguishes a deleted key (tombstone) from a key
+// the table knows nothing about, so that readers stop before older tables.
+func (m *MemTable) Lookup(key string) (value []byte, tombstone bool, found bool) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	return m.sl.Get(key)
+
+	e, ok := m.sl.Get(key)
+	if !ok {
+		return nil, false, false
+	}
+	return e.value, e.tombstone, true
 }
 
 func (m *MemTable) Delete(key string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	// In LSM, delete is a Tombstone insert.
-	// For MemTable, we can just Set(key, tombstone) or delete if we only model one layer.
-	// Let's model simple deletion for this interface.
+	// In LSM, delete is a Tombstone insert (see PutTombstone).
+	// This models a single layer, so the key is simply removed.
 	m.sl.Delete(key)
 }
 
+// PutTombstone records that key was deleted. Unlike Delete, the tombstone
+// stays in the table, counts towards its size and is visited by Range, so
+// that it shadows older values in SSTables until compaction discards both.
+func (m *MemTable) PutTombstone(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sl.Set(key, memEntry{tombstone: true})
+	m.size += int64(len(key))
+}
+
+// Range calls fn for each entry in key order until fn returns false.
+func (m *MemTable) Range(fn func(key string, value []byte, tombstone bool) bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	m.sl.Range(func(key string, e memEntry) bool {
+		return fn(key, e.value, e.tombstone)
+	})
+}
+
 func (m *MemTable) Size() int64 {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -60,6 +100,6 @@ func (m *MemTable) Size() int64 {
 func (m *MemTable) Reset() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.sl = skiplist.New[string, []byte]()
+	m.sl = skiplist.New[string, memEntry]()
 	m.size = 0
 }
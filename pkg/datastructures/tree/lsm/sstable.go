@@ -0,0 +1,349 @@
+package lsm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"sort"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/datastructures/bloomfilter"
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+)
+
+// SSTable layout:
+//
+//	[data block 0] ... [data block N-1] [index block] [bloom block] [footer]
+//
+// A data block is a run of encoded records followed by a crc32 of the block.
+// The index holds the first key, offset and length of every data block. The
+// bloom block is a serialized bloomfilter.BloomFilter over all keys, and the
+// fixed-size footer locates the index and bloom blocks.
+const (
+	tableMagic = uint64(0x4c534d5441424c45) // "LSMTABLE"
+	footerSize = 48
+)
+
+// tableMeta describes an SSTable in the manifest.
+type tableMeta struct {
+	FileNum uint64 `json:"file_num"`
+	MinKey  string `json:"min_key"`
+	MaxKey  string `json:"max_key"`
+	Size    int64  `json:"size"`
+	Entries int    `json:"entries"`
+}
+
+type blockHandle struct {
+	firstKey string
+	offset   uint64
+	length   uint64
+}
+
+type tableWriter struct {
+	f         *os.File
+	w         *bufio.Writer
+	path      string
+	blockSize int
+
+	offset   uint64
+	block    []byte
+	first    string
+	index    []blockHandle
+	bloom    *bloomfilter.BloomFilter
+	meta     tableMeta
+	hasEntry bool
+}
+
+func newTableWriter(path string, fileNum uint64, expectedKeys int, blockSize int, fpr float64) (*tableWriter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &tableWriter{
+		f:         f,
+		w:         bufio.NewWriter(f),
+		path:      path,
+		blockSize: blockSize,
+		bloom:     bloomfilter.New(uint(expectedKeys), fpr),
+		meta:      tableMeta{FileNum: fileNum},
+	}, nil
+}
+
+// add appends r. Records must be added in strictly increasing key order.
+func (t *tableWriter) add(r record) error {
+	if !t.hasEntry {
+		t.meta.MinKey = r.key
+		t.hasEntry = true
+	}
+	t.meta.MaxKey = r.key
+	t.meta.Entries++
+	t.bloom.AddString(r.key)
+
+	if len(t.block) == 0 {
+		t.first = r.key
+	}
+	t.block = encodeRecord(t.block, r)
+	if len(t.block) >= t.blockSize {
+		return t.flushBlock()
+	}
+	return nil
+}
+
+// size returns the number of bytes written so far, including the pending block.
+func (t *tableWriter) size() int64 {
+	return int64(t.offset) + int64(len(t.block))
+}
+
+func (t *tableWriter) flushBlock() error {
+	if len(t.block) == 0 {
+		return nil
+	}
+	t.block = binary.LittleEndian.AppendUint32(t.block, crc32.ChecksumIEEE(t.block))
+	if _, err := t.w.Write(t.block); err != nil {
+		return err
+	}
+	t.index = append(t.index, blockHandle{firstKey: t.first, offset: t.offset, length: uint64(len(t.block))})
+	t.offset += uint64(len(t.block))
+	t.block = t.block[:0]
+	return nil
+}
+
+// finish writes the index, bloom filter and footer and syncs the file.
+func (t *tableWriter) finish() (tableMeta, error) {
+	if err := t.flushBlock(); err != nil {
+		t.abort()
+		return tableMeta{}, err
+	}
+
+	var index []byte
+	for _, h := range t.index {
+		index = binary.AppendUvarint(index, uint64(len(h.firstKey)))
+		index = append(index, h.firstKey...)
+		index = binary.AppendUvarint(index, h.offset)
+		index = binary.AppendUvarint(index, h.length)
+	}
+	bloom, err := t.bloom.MarshalBinary()
+	if err != nil {
+		t.abort()
+		return tableMeta{}, err
+	}
+
+	indexOff := t.offset
+	bloomOff := indexOff + uint64(len(index))
+	footer := make([]byte, 0, footerSize)
+	footer = binary.LittleEndian.AppendUint64(footer, indexOff)
+	footer = binary.LittleEndian.AppendUint64(footer, uint64(len(index)))
+	footer = binary.LittleEndian.AppendUint64(footer, bloomOff)
+	footer = binary.LittleEndian.AppendUint64(footer, uint64(len(bloom)))
+	footer = binary.LittleEndian.AppendUint64(footer, uint64(t.meta.Entries))
+	footer = binary.LittleEndian.AppendUint64(footer, tableMagic)
+
+	for _, b := range [][]byte{index, bloom, footer} {
+		if _, err := t.w.Write(b); err != nil {
+			t.abort()
+			return tableMeta{}, err
+		}
+	}
+	if err := t.w.Flush(); err != nil {
+		t.abort()
+		return tableMeta{}, err
+	}
+	if err := t.f.Sync(); err != nil {
+		t.abort()
+		return tableMeta{}, err
+	}
+	if err := t.f.Close(); err != nil {
+		os.Remove(t.path)
+		return tableMeta{}, err
+	}
+
+	t.meta.Size = int64(bloomOff) + int64(len(bloom)) + footerSize
+	return t.meta, nil
+}
+
+func (t *tableWriter) abort() {
+	t.f.Close()
+	os.Remove(t.path)
+}
+
+// table is an open, immutable SSTable. The index and bloom filter are kept in
+// memory; data blocks are read on demand.
+type table struct {
+	meta  tableMeta
+	path  string
+	f     *os.File
+	index []blockHandle
+	bloom *bloomfilter.BloomFilter
+}
+
+func openTable(path string, meta tableMeta) (*table, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	t := &table{meta: meta, path: path, f: f}
+	if err := t.load(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *table) load() error {
+	st, err := t.f.Stat()
+	if err != nil {
+		return err
+	}
+	if st.Size() < footerSize {
+		return errors.Internal("lsm: sstable too small: "+t.path, nil)
+	}
+
+	footer := make([]byte, footerSize)
+	if _, err := t.f.ReadAt(footer, st.Size()-footerSize); err != nil {
+		return err
+	}
+	if binary.LittleEndian.Uint64(footer[40:]) != tableMagic {
+		return errors.Internal("lsm: bad sstable magic: "+t.path, nil)
+	}
+	indexOff := binary.LittleEndian.Uint64(footer[0:])
+	indexLen := binary.LittleEndian.Uint64(footer[8:])
+	bloomOff := binary.LittleEndian.Uint64(footer[16:])
+	bloomLen := binary.LittleEndian.Uint64(footer[24:])
+
+	index := make([]byte, indexLen)
+	if _, err := t.f.ReadAt(index, int64(indexOff)); err != nil {
+		return err
+	}
+	for len(index) > 0 {
+		klen, n := binary.Uvarint(index)
+		if n <= 0 || uint64(len(index)-n) < klen {
+			return errors.Internal("lsm: corrupt sstable index: "+t.path, nil)
+		}
+		h := blockHandle{firstKey: string(index[n : n+int(klen)])}
+		index = index[n+int(klen):]
+		if h.offset, n = binary.Uvarint(index); n <= 0 {
+			return errors.Internal("lsm: corrupt sstable index: "+t.path, nil)
+		}
+		index = index[n:]
+		if h.length, n = binary.Uvarint(index); n <= 0 {
+			return errors.Internal("lsm: corrupt sstable index: "+t.path, nil)
+		}
+		index = index[n:]
+		t.index = append(t.index, h)
+	}
+
+	bloom := make([]byte, bloomLen)
+	if _, err := t.f.ReadAt(bloom, int64(bloomOff)); err != nil {
+		return err
+	}
+	t.bloom = &bloomfilter.BloomFilter{}
+	return t.bloom.UnmarshalBinary(bloom)
+}
+
+// get looks up key, consulting the bloom filter before touching disk.
+func (t *table) get(key string) (record, bool, error) {
+	if key < t.meta.MinKey || key > t.meta.MaxKey || !t.bloom.ContainsString(key) {
+		return record{}, false, nil
+	}
+
+	i := sort.Search(len(t.index), func(i int) bool { return t.index[i].firstKey > key }) - 1
+	if i < 0 {
+		return record{}, false, nil
+	}
+	recs, err := t.readBlock(i)
+	if err != nil {
+		return record{}, false, err
+	}
+	j := sort.Search(len(recs), func(j int) bool { return recs[j].key >= key })
+	if j < len(recs) && recs[j].key == key {
+		return recs[j], true, nil
+	}
+	return record{}, false, nil
+}
+
+func (t *table) readBlock(i int) ([]record, error) {
+	h := t.index[i]
+	buf := make([]byte, h.length)
+	if _, err := t.f.ReadAt(buf, int64(h.offset)); err != nil {
+		return nil, err
+	}
+	if len(buf) < 4 {
+		return nil, errors.Internal("lsm: corrupt sstable block: "+t.path, nil)
+	}
+	data := buf[:len(buf)-4]
+	if crc32.ChecksumIEEE(data) != binary.LittleEndian.Uint32(buf[len(buf)-4:]) {
+		return nil, errors.Internal("lsm: sstable block checksum mismatch: "+t.path, nil)
+	}
+
+	var recs []record
+	for len(data) > 0 {
+		r, n, err := decodeRecord(data)
+		if err != nil {
+			return nil, errors.Internal("lsm: corrupt sstable block: "+t.path, err)
+		}
+		recs = append(recs, r)
+		data = data[n:]
+	}
+	return recs, nil
+}
+
+func (t *table) close() error {
+	return t.f.Close()
+}
+
+// tableIterator walks a table in key order, one block at a time.
+type tableIterator struct {
+	t     *table
+	block int
+	recs  []record
+	pos   int
+	err   error
+}
+
+func (it *tableIterator) status() error {
+	return it.err
+}
+
+func (t *table) iterator(start string) *tableIterator {
+	it := &tableIterator{t: t}
+	// Begin at the block that may contain start.
+	it.block = sort.Search(len(t.index), func(i int) bool { return t.index[i].firstKey > start }) - 1
+	if it.block < 0 {
+		it.block = 0
+	}
+	it.load()
+	for it.valid() && it.recs[it.pos].key < start {
+		it.next()
+	}
+	return it
+}
+
+func (it *tableIterator) load() {
+	it.recs, it.pos = nil, 0
+	for it.block < len(it.t.index) && len(it.recs) == 0 {
+		it.recs, it.err = it.t.readBlock(it.block)
+		if it.err != nil {
+			it.recs = nil
+			return
+		}
+		if len(it.recs) == 0 {
+			it.block++
+		}
+	}
+}
+
+func (it *tableIterator) valid() bool {
+	return it.err == nil && it.pos < len(it.recs)
+}
+
+func (it *tableIterator) record() record {
+	return it.recs[it.pos]
+}
+
+func (it *tableIterator) next() {
+	it.pos++
+	if it.pos >= len(it.recs) {
+		it.block++
+		it.load()
+	}
+}
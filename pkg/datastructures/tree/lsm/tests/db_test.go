@@ -0,0 +1,242 @@
+package lsm_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/datastructures/tree/lsm"
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+)
+
+func openDB(t *testing.T, dir string) *lsm.DB {
+	t.Helper()
+	db, err := lsm.Open(lsm.Options{
+		Dir:                 dir,
+		MemTableSize:        4 << 10,
+		BlockSize:           512,
+		L0CompactionTrigger: 2,
+		BaseLevelSize:       16 << 10,
+		TargetFileSize:      8 << 10,
+	})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	return db
+}
+
+func key(i int) string {
+	return fmt.Sprintf("key-%05d", i)
+}
+
+func TestDBPutGetDelete(t *testing.T) {
+	db := openDB(t, t.TempDir())
+	defer db.Close()
+
+	if err := db.Put("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := db.Get("a"); err != nil || string(v) != "1" {
+		t.Fatalf("get a = %q, %v", v, err)
+	}
+	if err := db.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get("a"); !errors.Is(err, lsm.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if err := db.Put("", []byte("x")); err == nil {
+		t.Fatal("expected error for empty key")
+	}
+}
+
+func TestDBFlushAndCompaction(t *testing.T) {
+	db := openDB(t, t.TempDir())
+	defer db.Close()
+
+	const n = 3000
+	for i := 0; i < n; i++ {
+		if err := db.Put(key(i), []byte(fmt.Sprintf("v%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Overwrite and delete some keys so that they live in several tables.
+	for i := 0; i < n; i += 3 {
+		if err := db.Put(key(i), []byte("updated")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 1; i < n; i += 3 {
+		if err := db.Delete(key(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func() {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			v, err := db.Get(key(i))
+			switch i % 3 {
+			case 0:
+				if err != nil || string(v) != "updated" {
+					t.Fatalf("get %s = %q, %v", key(i), v, err)
+				}
+			case 1:
+				if !errors.Is(err, lsm.ErrNotFound) {
+					t.Fatalf("get %s: expected ErrNotFound, got %q, %v", key(i), v, err)
+				}
+			default:
+				if err != nil || string(v) != fmt.Sprintf("v%d", i) {
+					t.Fatalf("get %s = %q, %v", key(i), v, err)
+				}
+			}
+		}
+	}
+	check()
+
+	stats := db.Stats()
+	deeper := 0
+	for _, files := range stats.LevelFiles[1:] {
+		deeper += files
+	}
+	if deeper == 0 {
+		t.Fatalf("expected background compaction into L1+, got %v", stats.LevelFiles)
+	}
+
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := db.Stats(); stats.LevelFiles[0] != 0 {
+		t.Fatalf("expected empty L0 after Compact, got %v", stats.LevelFiles)
+	}
+	check()
+}
+
+func TestDBScan(t *testing.T) {
+	db := openDB(t, t.TempDir())
+	defer db.Close()
+
+	for i := 0; i < 500; i++ {
+		db.Put(key(i), []byte(key(i)))
+	}
+	db.Flush()
+	for i := 100; i < 200; i++ {
+		db.Delete(key(i))
+	}
+	db.Put(key(250), []byte("new"))
+
+	var got []string
+	err := db.Scan(key(90), key(260), func(k string, v []byte) bool {
+		got = append(got, k)
+		if k == key(250) && string(v) != "new" {
+			t.Errorf("scan %s = %q, want newest value", k, v)
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 90..99 and 200..259
+	if len(got) != 10+60 {
+		t.Fatalf("scan returned %d keys", len(got))
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i-1] >= got[i] {
+			t.Fatalf("scan not ordered: %s >= %s", got[i-1], got[i])
+		}
+	}
+
+	count := 0
+	db.Scan("", "", func(string, []byte) bool {
+		count++
+		return count < 5
+	})
+	if count != 5 {
+		t.Fatalf("scan did not stop early, visited %d", count)
+	}
+}
+
+func TestDBReopen(t *testing.T) {
+	dir := t.TempDir()
+	db := openDB(t, dir)
+	for i := 0; i < 1000; i++ {
+		db.Put(key(i), []byte("v"))
+	}
+	db.Delete(key(5))
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db = openDB(t, dir)
+	defer db.Close()
+	for i := 0; i < 1000; i++ {
+		_, err := db.Get(key(i))
+		if i == 5 {
+			if !errors.Is(err, lsm.ErrNotFound) {
+				t.Fatalf("deleted key resurrected: %v", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("get %s after reopen: %v", key(i), err)
+		}
+	}
+}
+
+func TestDBRecoverTornWAL(t *testing.T) {
+	dir := t.TempDir()
+	db := openDB(t, dir)
+	db.Put("a", []byte("1"))
+	db.Put("b", []byte("2"))
+	db.Close()
+
+	// Simulate a crash in the middle of a write by appending half a frame.
+	logs, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	if len(logs) == 0 {
+		t.Fatal("expected a wal file")
+	}
+	f, err := os.OpenFile(logs[len(logs)-1], os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{1, 2, 3, 4, 50, 0})
+	f.Close()
+
+	db = openDB(t, dir)
+	defer db.Close()
+	for k, want := range map[string]string{"a": "1", "b": "2"} {
+		if v, err := db.Get(k); err != nil || string(v) != want {
+			t.Fatalf("get %s = %q, %v", k, v, err)
+		}
+	}
+}
+
+func TestDBConcurrent(t *testing.T) {
+	db := openDB(t, t.TempDir())
+	defer db.Close()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				k := fmt.Sprintf("w%d-%05d", w, i)
+				if err := db.Put(k, []byte(k)); err != nil {
+					t.Error(err)
+					return
+				}
+				if v, err := db.Get(k); err != nil || string(v) != k {
+					t.Errorf("get %s = %q, %v", k, v, err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+}
@@ -31,3 +31,35 @@ func TestMemTable(t *testing.T) {
 		t.Error("Expected put to fail due to capacity")
 	}
 }
+
+func TestMemTableTombstones(t *testing.T) {
+	mt := lsm.New(1024)
+	mt.Put("a", []byte("1"))
+	mt.Put("b", []byte("2"))
+
+	mt.Delete("a")
+	if _, _, found := mt.Lookup("a"); found {
+		t.Error("Expected Delete to remove a")
+	}
+
+	size := mt.Size()
+	mt.PutTombstone("b")
+	if _, found := mt.Get("b"); found {
+		t.Error("Expected b to be deleted")
+	}
+	if _, tombstone, found := mt.Lookup("b"); !found || !tombstone {
+		t.Error("Expected a tombstone for b")
+	}
+	if mt.Size() <= size {
+		t.Error("Expected the tombstone to count towards the size")
+	}
+
+	var keys []string
+	mt.Range(func(key string, value []byte, tombstone bool) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if len(keys) != 1 || keys[0] != "b" {
+		t.Errorf("Expected only the tombstone in Range, got %v", keys)
+	}
+}
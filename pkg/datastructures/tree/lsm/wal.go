@@ -0,0 +1,132 @@
+package lsm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// record is a single key version: a value or a tombstone.
+type record struct {
+	key       string
+	value     []byte
+	tombstone bool
+}
+
+// wal is an append-only write-ahead log for one MemTable. Each record is
+// framed as [crc32 uint32][length uint32][payload] so that a torn write at
+// the tail can be detected and discarded on replay.
+type wal struct {
+	f    *os.File
+	w    *bufio.Writer
+	sync bool
+}
+
+func openWAL(path string, sync bool) (*wal, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &wal{f: f, w: bufio.NewWriter(f), sync: sync}, nil
+}
+
+func (l *wal) append(r record) error {
+	payload := encodeRecord(nil, r)
+
+	var header [8]byte
+	binary.LittleEndian.PutUint32(header[0:], crc32.ChecksumIEEE(payload))
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(payload)))
+	if _, err := l.w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := l.w.Write(payload); err != nil {
+		return err
+	}
+	if err := l.w.Flush(); err != nil {
+		return err
+	}
+	if l.sync {
+		return l.f.Sync()
+	}
+	return nil
+}
+
+func (l *wal) close() error {
+	if err := l.w.Flush(); err != nil {
+		l.f.Close()
+		return err
+	}
+	if err := l.f.Sync(); err != nil {
+		l.f.Close()
+		return err
+	}
+	return l.f.Close()
+}
+
+// replayWAL calls fn for every intact record in the log, stopping silently at
+// the first truncated or corrupt frame.
+func replayWAL(path string, fn func(record)) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	for len(data) >= 8 {
+		sum := binary.LittleEndian.Uint32(data[0:])
+		n := int(binary.LittleEndian.Uint32(data[4:]))
+		if len(data)-8 < n {
+			return nil
+		}
+		payload := data[8 : 8+n]
+		if crc32.ChecksumIEEE(payload) != sum {
+			return nil
+		}
+		r, _, err := decodeRecord(payload)
+		if err != nil {
+			return nil
+		}
+		fn(r)
+		data = data[8+n:]
+	}
+	return nil
+}
+
+// encodeRecord appends [keyLen uvarint][key][flags byte][valueLen uvarint][value] to dst.
+func encodeRecord(dst []byte, r record) []byte {
+	dst = binary.AppendUvarint(dst, uint64(len(r.key)))
+	dst = append(dst, r.key...)
+	var flags byte
+	if r.tombstone {
+		flags = 1
+	}
+	dst = append(dst, flags)
+	dst = binary.AppendUvarint(dst, uint64(len(r.value)))
+	return append(dst, r.value...)
+}
+
+// decodeRecord decodes one record and returns the number of bytes consumed.
+func decodeRecord(src []byte) (record, int, error) {
+	var r record
+	klen, n := binary.Uvarint(src)
+	if n <= 0 || uint64(len(src)-n) < klen+1 {
+		return r, 0, io.ErrUnexpectedEOF
+	}
+	pos := n
+	r.key = string(src[pos : pos+int(klen)])
+	pos += int(klen)
+	r.tombstone = src[pos] == 1
+	pos++
+
+	vlen, n := binary.Uvarint(src[pos:])
+	if n <= 0 || uint64(len(src)-pos-n) < vlen {
+		return r, 0, io.ErrUnexpectedEOF
+	}
+	pos += n
+	if !r.tombstone {
+		r.value = append([]byte{}, src[pos:pos+int(vlen)]...)
+	}
+	pos += int(vlen)
+	return r, pos, nil
+}
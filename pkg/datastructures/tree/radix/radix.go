@@ -142,3 +142,30 @@ func (t *RadixTree[V]) get(n *node[V], path string) (V, bool) {
 	var zero V
 	return zero, false
 }
+
+// WalkPrefixes calls fn for every stored path that is a prefix of path,
+// shortest first, until fn returns false. It is the building block for
+// longest-prefix matching. fn must not modify the tree.
+func (t *RadixTree[V]) WalkPrefixes(path string, fn func(prefix string, value V) bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	n, consumed := t.root, 0
+	for {
+		if n.isTerm && !fn(path[:consumed], n.value) {
+			return
+		}
+
+		var next *node[V]
+		for _, child := range n.children {
+			if strings.HasPrefix(path[consumed:], child.path) {
+				next = child
+				break
+			}
+		}
+		if next == nil {
+			return
+		}
+		n, consumed = next, consumed+len(next.path)
+	}
+}
@@ -47,4 +47,30 @@ func TestRadixTree(t *testing.T) {
 			t.Error("Lost watch")
 		}
 	})
+
+	t.Run("WalkPrefixes", func(t *testing.T) {
+		rt := radix.New[int]()
+		rt.Insert("10", 1)
+		rt.Insert("1010", 2)
+		rt.Insert("101011", 3)
+		rt.Insert("11", 4)
+
+		var got []string
+		rt.WalkPrefixes("1010110", func(prefix string, value int) bool {
+			got = append(got, prefix)
+			return true
+		})
+		if len(got) != 3 || got[0] != "10" || got[1] != "1010" || got[2] != "101011" {
+			t.Errorf("Expected prefixes [10 1010 101011], got %v", got)
+		}
+
+		var first string
+		rt.WalkPrefixes("1010110", func(prefix string, value int) bool {
+			first = prefix
+			return false
+		})
+		if first != "10" {
+			t.Errorf("Expected walk to stop at 10, got %q", first)
+		}
+	})
 }
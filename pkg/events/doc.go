@@ -4,6 +4,10 @@ Package events provides an in-process event bus for decoupling components via do
 It defines a standard Event structure and a Bus interface for Publish/Subscribe patterns.
 This package is intended for local process constraints. For distributed messaging, see pkg/messaging.
 
+InstrumentedBus propagates the publisher's trace context in the event's
+Extensions, so handlers run as part of the publisher's trace even when the bus
+calls them with a detached context.
+
 Usage:
 
 	bus := memory.New()
@@ -26,6 +26,10 @@ type Event struct {
 	Source    string      `json:"source"` // e.g. "user-service"
 	Timestamp time.Time   `json:"timestamp"`
 	Payload   interface{} `json:"payload"`
+
+	// Extensions are CloudEvents extension attributes, such as the
+	// traceparent and tracestate set by InstrumentedBus.
+	Extensions map[string]string `json:"extensions,omitempty"`
 }
 
 // Handler handles an incoming event
@@ -4,7 +4,7 @@ import (
 	"context"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
-	"go.opentelemetry.io/otel"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
@@ -19,18 +19,20 @@ type InstrumentedBus struct {
 func NewInstrumentedBus(next Bus) *InstrumentedBus {
 	return &InstrumentedBus{
 		next:   next,
-		tracer: otel.Tracer("pkg/events"),
+		tracer: instrument.NewTracer("pkg/events"),
 	}
 }
 
 func (b *InstrumentedBus) Publish(ctx context.Context, topic string, event Event) error {
-	ctx, span := b.tracer.Start(ctx, "events.Publish", trace.WithAttributes(
+	ctx, span := b.tracer.Start(ctx, "events.Publish", trace.WithSpanKind(trace.SpanKindProducer), trace.WithAttributes(
 		attribute.String("event.topic", topic),
 		attribute.String("event.type", event.Type),
 		attribute.String("event.id", event.ID),
 	))
 	defer span.End()
 
+	event.Extensions = instrument.InjectHeaders(ctx, event.Extensions)
+
 	logger.L().InfoContext(ctx, "publishing event", "topic", topic, "type", event.Type, "id", event.ID)
 
 	err := b.next.Publish(ctx, topic, event)
@@ -51,9 +53,9 @@ func (b *InstrumentedBus) Subscribe(ctx context.Context, topic string, handler H
 
 	logger.L().InfoContext(ctx, "subscribing to topic", "topic", topic)
 
-	// Wrap the handler to trace processing
+	// Wrap the handler to trace processing as part of the publisher's trace
 	instrumentedHandler := func(ctx context.Context, event Event) error {
-		ctx, span := b.tracer.Start(ctx, "events.Handle", trace.WithAttributes(
+		ctx, span := instrument.StartConsumerSpan(ctx, b.tracer, "events.Handle", event.Extensions, trace.WithAttributes(
 			attribute.String("event.topic", topic),
 			attribute.String("event.type", event.Type),
 			attribute.String("event.id", event.ID),
@@ -0,0 +1,53 @@
+package events_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/events"
+	"github.com/chris-alexander-pop/system-design-library/pkg/events/adapters/memory"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestInstrumentedBusContinuesPublisherTrace(t *testing.T) {
+	tp := sdktrace.NewTracerProvider()
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+		_ = tp.Shutdown(context.Background())
+	})
+
+	bus := events.NewInstrumentedBus(memory.New())
+	defer bus.Close()
+	ctx := context.Background()
+
+	received := make(chan context.Context, 1)
+	if err := bus.Subscribe(ctx, "users", func(ctx context.Context, e events.Event) error {
+		received <- ctx
+		return nil
+	}); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	// The memory bus runs handlers with a detached context, so only the
+	// propagated extensions can connect them to the publisher.
+	pubCtx, span := tp.Tracer("test").Start(ctx, "signup")
+	defer span.End()
+	if err := bus.Publish(pubCtx, "users", events.Event{Type: "user.created"}); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	select {
+	case got := <-received:
+		if trace.SpanContextFromContext(got).TraceID() != span.SpanContext().TraceID() {
+			t.Error("handler did not continue the publisher's trace")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("event not handled")
+	}
+}
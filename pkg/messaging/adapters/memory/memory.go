@@ -3,6 +3,14 @@
 // This adapter uses Go channels to simulate a message broker, making it ideal
 // for unit tests and local development without external dependencies.
 //
+// By default every consumer gets its own buffer, which is discarded when the
+// consumer closes, and messages published to a topic without consumers are
+// dropped. With DurableGroups, consumers in the same named group share one
+// buffer, which keeps filling while no consumer of the group is running, and
+// messages published to a topic that has no groups yet are kept until the
+// first group subscribes. Each buffer holds up to BufferSize messages; further
+// messages are dropped.
+//
 // # Usage
 //
 //	broker := memory.New(memory.Config{BufferSize: 100})
@@ -27,6 +35,11 @@ type Config struct {
 	// BufferSize is the channel buffer size for each topic.
 	// Larger values allow more messages to be buffered before blocking.
 	BufferSize int `env:"MEMORY_BUFFER_SIZE" env-default:"1000"`
+
+	// DurableGroups keeps the buffer of a named consumer group after its
+	// consumers close, and holds messages published before the first
+	// consumer subscribed, like a broker with persistent subscriptions.
+	DurableGroups bool `env:"MEMORY_DURABLE_GROUPS" env-default:"false"`
 }
 
 // Broker is an in-memory message broker implementation.
@@ -41,6 +54,7 @@ type topic struct {
 	mu          *concurrency.SmartRWMutex
 	name        string
 	subscribers map[string]chan *messaging.Message // group -> channel
+	backlog     []*messaging.Message               // published before any group subscribed, if durable
 }
 
 // New creates a new in-memory broker.
@@ -97,23 +111,32 @@ func (b *Broker) Consumer(topicName string, group string) (messaging.Consumer, e
 	}
 	b.mu.RUnlock()
 
-	if group == "" {
+	anonymous := group == ""
+	if anonymous {
 		group = uuid.New().String() // Unique group for broadcast
 	}
 
 	t := b.getOrCreateTopic(topicName)
 
 	t.mu.Lock()
-	ch := make(chan *messaging.Message, b.config.BufferSize)
-	t.subscribers[group] = ch
+	ch, ok := t.subscribers[group]
+	if !ok || !b.config.DurableGroups {
+		ch = make(chan *messaging.Message, b.config.BufferSize)
+		for _, msg := range t.backlog {
+			ch <- msg
+		}
+		t.backlog = nil
+		t.subscribers[group] = ch
+	}
 	t.mu.Unlock()
 
 	return &consumer{
-		broker: b,
-		topic:  t,
-		group:  group,
-		ch:     ch,
-		mu:     concurrency.NewSmartMutex(concurrency.MutexConfig{Name: "MemoryConsumer-" + group}),
+		broker:    b,
+		topic:     t,
+		group:     group,
+		anonymous: anonymous,
+		ch:        ch,
+		mu:        concurrency.NewSmartMutex(concurrency.MutexConfig{Name: "MemoryConsumer-" + group}),
 	}, nil
 }
 
@@ -162,8 +185,22 @@ func (p *producer) Publish(ctx context.Context, msg *messaging.Message) error {
 		msg.Topic = p.topic.name
 	}
 
-	p.topic.mu.RLock()
-	defer p.topic.mu.RUnlock()
+	// Holding the broker lock keeps Close from closing channels mid-publish.
+	p.broker.mu.RLock()
+	defer p.broker.mu.RUnlock()
+	if p.broker.closed {
+		return messaging.ErrClosed(nil)
+	}
+
+	p.topic.mu.Lock()
+	defer p.topic.mu.Unlock()
+
+	if len(p.topic.subscribers) == 0 && p.broker.config.DurableGroups {
+		if len(p.topic.backlog) < p.broker.config.BufferSize {
+			p.topic.backlog = append(p.topic.backlog, msg)
+		}
+		return nil
+	}
 
 	// Fan-out to all subscribers
 	for _, ch := range p.topic.subscribers {
@@ -188,18 +225,30 @@ func (p *producer) PublishBatch(ctx context.Context, msgs []*messaging.Message)
 	return nil
 }
 
+// PublishDelayed publishes msg after delay.
+func (p *producer) PublishDelayed(ctx context.Context, msg *messaging.Message, delay time.Duration) error {
+	if delay <= 0 {
+		return p.Publish(ctx, msg)
+	}
+	time.AfterFunc(delay, func() {
+		p.Publish(context.Background(), msg)
+	})
+	return nil
+}
+
 func (p *producer) Close() error {
 	return nil
 }
 
 // consumer is an in-memory message consumer.
 type consumer struct {
-	broker *Broker
-	topic  *topic
-	group  string
-	ch     chan *messaging.Message
-	closed bool
-	mu     *concurrency.SmartMutex
+	broker    *Broker
+	topic     *topic
+	group     string
+	anonymous bool
+	ch        chan *messaging.Message
+	closed    bool
+	mu        *concurrency.SmartMutex
 }
 
 func (c *consumer) Consume(ctx context.Context, handler messaging.MessageHandler) error {
@@ -229,9 +278,12 @@ func (c *consumer) Close() error {
 	}
 	c.closed = true
 
-	c.topic.mu.Lock()
-	delete(c.topic.subscribers, c.group)
-	c.topic.mu.Unlock()
+	// Durable named groups keep their buffer for the next consumer of the group.
+	if c.anonymous || !c.broker.config.DurableGroups {
+		c.topic.mu.Lock()
+		delete(c.topic.subscribers, c.group)
+		c.topic.mu.Unlock()
+	}
 
 	return nil
 }
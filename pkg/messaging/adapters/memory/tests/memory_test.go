@@ -1,8 +1,11 @@
 package messaging_test
 
 import (
+	"context"
 	"testing"
+	"time"
 
+	"github.com/chris-alexander-pop/system-design-library/pkg/messaging"
 	"github.com/chris-alexander-pop/system-design-library/pkg/messaging/adapters/memory"
 	"github.com/chris-alexander-pop/system-design-library/pkg/messaging/testsuite"
 )
@@ -14,3 +17,68 @@ func TestMemoryBroker(t *testing.T) {
 
 	testsuite.RunBrokerTests(t, broker)
 }
+
+// received returns the IDs a consumer reads within a short window.
+func received(t *testing.T, c messaging.Consumer) []string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	var ids []string
+	if err := c.Consume(ctx, func(ctx context.Context, msg *messaging.Message) error {
+		ids = append(ids, msg.ID)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func TestGroupsAreNotDurableByDefault(t *testing.T) {
+	ctx := context.Background()
+	broker := memory.New(memory.Config{BufferSize: 10})
+	defer broker.Close()
+
+	p, _ := broker.Producer("orders")
+	_ = p.Publish(ctx, &messaging.Message{ID: "before"})
+
+	c, _ := broker.Consumer("orders", "billing")
+	_ = p.Publish(ctx, &messaging.Message{ID: "buffered"})
+	_ = c.Close()
+	_ = p.Publish(ctx, &messaging.Message{ID: "after"})
+
+	c, _ = broker.Consumer("orders", "billing")
+	defer c.Close()
+	if ids := received(t, c); len(ids) != 0 {
+		t.Errorf("expected no messages for a new consumer, got %v", ids)
+	}
+}
+
+func TestDurableGroups(t *testing.T) {
+	ctx := context.Background()
+	broker := memory.New(memory.Config{BufferSize: 10, DurableGroups: true})
+	defer broker.Close()
+
+	p, _ := broker.Producer("orders")
+	_ = p.Publish(ctx, &messaging.Message{ID: "before"})
+
+	c, _ := broker.Consumer("orders", "billing")
+	_ = p.Publish(ctx, &messaging.Message{ID: "buffered"})
+	_ = c.Close()
+	_ = p.Publish(ctx, &messaging.Message{ID: "after"})
+
+	c, _ = broker.Consumer("orders", "billing")
+	defer c.Close()
+	ids := received(t, c)
+	if len(ids) != 3 || ids[0] != "before" || ids[1] != "buffered" || ids[2] != "after" {
+		t.Errorf("expected the group's messages in order, got %v", ids)
+	}
+
+	// Anonymous consumers are never durable.
+	anon, _ := broker.Consumer("orders", "")
+	_ = anon.Close()
+	_ = p.Publish(ctx, &messaging.Message{ID: "late"})
+	if ids := received(t, c); len(ids) != 1 || ids[0] != "late" {
+		t.Errorf("expected only the late message, got %v", ids)
+	}
+}
@@ -198,7 +198,21 @@ type producer struct {
 	broker *Broker
 }
 
+// maxDelay is the longest per-message delay SQS supports.
+const maxDelay = 15 * time.Minute
+
 func (p *producer) Publish(ctx context.Context, msg *messaging.Message) error {
+	return p.send(ctx, msg, 0)
+}
+
+// PublishDelayed sends msg with a per-message delay of at most 15 minutes;
+// longer delays are capped. FIFO queues do not support per-message delays,
+// so the message is sent immediately.
+func (p *producer) PublishDelayed(ctx context.Context, msg *messaging.Message, delay time.Duration) error {
+	return p.send(ctx, msg, min(delay, maxDelay))
+}
+
+func (p *producer) send(ctx context.Context, msg *messaging.Message, delay time.Duration) error {
 	if msg.ID == "" {
 		msg.ID = uuid.New().String()
 	}
@@ -238,6 +252,8 @@ func (p *producer) Publish(ctx context.Context, msg *messaging.Message) error {
 			input.MessageGroupId = aws.String("default")
 		}
 		input.MessageDeduplicationId = aws.String(msg.ID)
+	} else if delay > 0 {
+		input.DelaySeconds = int32(delay / time.Second)
 	}
 
 	result, err := p.broker.client.SendMessage(ctx, input)
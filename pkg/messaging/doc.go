@@ -32,5 +32,45 @@ The package follows the adapter pattern with decoupled dependencies:
 	    Topic:   "my-topic",
 	    Payload: []byte(`{"event": "user.created"}`),
 	})
+
+# Retries and dead letters
+
+RetryingConsumer wraps a topic and consumer group so that failed messages are
+republished to per-attempt retry topics (topic.group.retry.N) with exponential
+backoff and, once MaxAttempts is reached, to a dead-letter topic
+(topic.group.dlq) with the failure reason in its headers. Producers that
+implement DelayedProducer (memory, SQS) hold retries back at the broker. On
+other brokers (Kafka, NATS, RabbitMQ, or any broker wrapped by
+InstrumentedBroker or ResilientBroker) each retry topic is a delay queue:
+its consumer waits until the message at its head is due, while the main
+topic keeps flowing. Attempts, backoff and dead-lettering are the same
+either way:
+
+	rc, err := messaging.NewRetryingConsumer(broker, "orders", "billing", messaging.RetryTopicConfig{})
+	go rc.Consume(ctx, handler)
+
+	// Later, once the cause is fixed:
+	n, err := messaging.ReplayDeadLetters(ctx, broker, "orders", "billing", messaging.ReplayOptions{})
+
+# Tracing
+
+InstrumentedBroker carries the W3C trace context (traceparent, tracestate and
+baggage) in message headers: producers inject the context of the publishing
+span, and consumers start each handler span as a child of it, linked to the
+consume loop's own span. Every adapter transports headers, so a trace runs
+from an HTTP request through Kafka, NATS, SQS or any other broker into the
+worker that handles the message. The outbox stores the context of the
+enqueuing transaction for the same purpose.
+
+# Schemas
+
+Package schema (pkg/messaging/schema) provides a schema registry with
+compatibility checks and typed Producer[T]/Consumer[T] wrappers that encode
+payloads as Avro, JSON Schema or Protobuf in the Confluent wire format.
+
+# Transactional outbox
+
+Package outbox (pkg/messaging/outbox) stores messages in the caller's database
+transaction and relays them to any Broker once the transaction commits.
 */
 package messaging
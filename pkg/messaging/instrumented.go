@@ -2,25 +2,33 @@ package messaging
 
 import (
 	"context"
+	"time"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 )
 
-// InstrumentedBroker wraps a Broker with logging and tracing.
+// InstrumentedBroker wraps a Broker with logging, tracing and metrics.
 type InstrumentedBroker struct {
 	next   Broker
 	tracer trace.Tracer
+	lag    metric.Float64Histogram
 }
 
 // NewInstrumentedBroker creates a new InstrumentedBroker wrapping the given broker.
 func NewInstrumentedBroker(next Broker) *InstrumentedBroker {
+	lag, _ := otel.Meter("pkg/messaging").Float64Histogram("messaging.consumer.lag",
+		metric.WithDescription("Time between a message being created and its handler starting"),
+		metric.WithUnit("s"))
 	return &InstrumentedBroker{
 		next:   next,
-		tracer: otel.Tracer("pkg/messaging"),
+		tracer: instrument.NewTracer("pkg/messaging"),
+		lag:    lag,
 	}
 }
 
@@ -48,6 +56,7 @@ func (b *InstrumentedBroker) Consumer(topic string, group string) (Consumer, err
 		topic:  topic,
 		group:  group,
 		tracer: b.tracer,
+		lag:    b.lag,
 	}, nil
 }
 
@@ -68,12 +77,14 @@ type InstrumentedProducer struct {
 }
 
 func (p *InstrumentedProducer) Publish(ctx context.Context, msg *Message) error {
-	ctx, span := p.tracer.Start(ctx, "messaging.Publish", trace.WithAttributes(
+	ctx, span := p.tracer.Start(ctx, "messaging.Publish", trace.WithSpanKind(trace.SpanKindProducer), trace.WithAttributes(
 		attribute.String("messaging.topic", p.topic),
 		attribute.String("messaging.message_id", msg.ID),
 	))
 	defer span.End()
 
+	msg.Headers = instrument.InjectHeaders(ctx, msg.Headers)
+
 	logger.L().InfoContext(ctx, "publishing message", "topic", p.topic, "message_id", msg.ID)
 
 	err := p.next.Publish(ctx, msg)
@@ -89,12 +100,16 @@ func (p *InstrumentedProducer) Publish(ctx context.Context, msg *Message) error
 }
 
 func (p *InstrumentedProducer) PublishBatch(ctx context.Context, msgs []*Message) error {
-	ctx, span := p.tracer.Start(ctx, "messaging.PublishBatch", trace.WithAttributes(
+	ctx, span := p.tracer.Start(ctx, "messaging.PublishBatch", trace.WithSpanKind(trace.SpanKindProducer), trace.WithAttributes(
 		attribute.String("messaging.topic", p.topic),
 		attribute.Int("messaging.batch_size", len(msgs)),
 	))
 	defer span.End()
 
+	for _, msg := range msgs {
+		msg.Headers = instrument.InjectHeaders(ctx, msg.Headers)
+	}
+
 	logger.L().InfoContext(ctx, "publishing message batch", "topic", p.topic, "batch_size", len(msgs))
 
 	err := p.next.PublishBatch(ctx, msgs)
@@ -114,26 +129,35 @@ func (p *InstrumentedProducer) Close() error {
 	return p.next.Close()
 }
 
-// InstrumentedConsumer wraps a Consumer with logging and tracing.
+// InstrumentedConsumer wraps a Consumer with logging, tracing and metrics.
 type InstrumentedConsumer struct {
 	next   Consumer
 	topic  string
 	group  string
 	tracer trace.Tracer
+	lag    metric.Float64Histogram
 }
 
 func (c *InstrumentedConsumer) Consume(ctx context.Context, handler MessageHandler) error {
 	logger.L().InfoContext(ctx, "starting consumer", "topic", c.topic, "group", c.group)
 
-	// Wrap the handler to trace each message processing
+	// Wrap the handler to trace each message processing, continuing the
+	// trace propagated by the producer.
 	instrumentedHandler := func(ctx context.Context, msg *Message) error {
-		ctx, span := c.tracer.Start(ctx, "messaging.HandleMessage", trace.WithAttributes(
+		ctx, span := instrument.StartConsumerSpan(ctx, c.tracer, "messaging.HandleMessage", msg.Headers, trace.WithAttributes(
 			attribute.String("messaging.topic", c.topic),
 			attribute.String("messaging.group", c.group),
 			attribute.String("messaging.message_id", msg.ID),
 		))
 		defer span.End()
 
+		if !msg.Timestamp.IsZero() {
+			c.lag.Record(ctx, time.Since(msg.Timestamp).Seconds(), metric.WithAttributes(
+				attribute.String("messaging.topic", c.topic),
+				attribute.String("messaging.group", c.group),
+			))
+		}
+
 		logger.L().InfoContext(ctx, "processing message", "topic", c.topic, "message_id", msg.ID)
 
 		err := handler(ctx, msg)
@@ -103,6 +103,17 @@ type Producer interface {
 	Close() error
 }
 
+// DelayedProducer is implemented by producers whose broker can hold a message
+// back before delivering it (e.g., SQS delay, in-memory timers).
+type DelayedProducer interface {
+	Producer
+
+	// PublishDelayed sends a message that becomes visible to consumers after
+	// delay. Brokers may cap the delay, so consumers that need an exact
+	// delivery time must still check it.
+	PublishDelayed(ctx context.Context, msg *Message, delay time.Duration) error
+}
+
 // Consumer receives messages from a topic/queue.
 type Consumer interface {
 	// Consume starts consuming messages and calls the handler for each one.
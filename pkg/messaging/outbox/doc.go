@@ -0,0 +1,40 @@
+/*
+Package outbox implements the transactional outbox pattern for pkg/messaging.
+
+Writing a database row and publishing a message cannot be made atomic across
+two systems. Instead, Enqueue inserts the message into an outbox table inside
+the same GORM transaction as the business change, and a Relay publishes the
+committed rows through any messaging.Broker afterwards.
+
+Messages are spread over partitions by key. Each partition is leased through
+a distlock.Locker so that exactly one relay instance drains it, in insertion
+order; a failing message is retried with exponential backoff and holds back
+later messages with the same key. Delivered rows are deleted, or kept for
+Retention and then cleaned up. On Postgres, setting NotifyChannel makes the
+relay react to LISTEN/NOTIFY instead of waiting for the next poll.
+
+Usage:
+
+	import "github.com/chris-alexander-pop/system-design-library/pkg/messaging/outbox"
+
+	ob := outbox.New(db, outbox.Config{})
+	if err := ob.Migrate(ctx); err != nil {
+		return err
+	}
+
+	err := db.Get(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&order).Error; err != nil {
+			return err
+		}
+		return ob.Enqueue(tx, &messaging.Message{
+			Topic:   "orders",
+			Key:     []byte(order.CustomerID),
+			Payload: payload,
+		})
+	})
+
+	// In a background worker on every instance:
+	relay := outbox.NewRelay(ob, broker, locker)
+	go relay.Run(ctx)
+*/
+package outbox
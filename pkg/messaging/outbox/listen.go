@@ -0,0 +1,72 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// listen signals wake for every notification on the configured Postgres
+// channel, reconnecting after errors until ctx is cancelled. Notifications
+// only shorten the wait; polling continues, so a missed one costs at most one
+// PollInterval.
+func (r *Relay) listen(ctx context.Context, wake chan<- struct{}) {
+	for ctx.Err() == nil {
+		err := r.waitForNotifications(ctx, wake)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.L().WarnContext(ctx, "outbox listener failed", "channel", r.cfg.NotifyChannel, "error", err)
+
+		t := time.NewTimer(r.cfg.PollInterval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// waitForNotifications holds one pooled connection in LISTEN mode until an
+// error occurs.
+func (r *Relay) waitForNotifications(ctx context.Context, wake chan<- struct{}) error {
+	db, err := r.outbox.db.Get(ctx).DB()
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		c, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return errors.New(errors.CodeUnimplemented, "outbox notifications require the pgx driver", nil)
+		}
+		pc := c.Conn()
+
+		channel := pgx.Identifier{r.cfg.NotifyChannel}.Sanitize()
+		if _, err := pc.Exec(ctx, "LISTEN "+channel); err != nil {
+			return err
+		}
+		// Leave the connection clean if it survives and returns to the pool.
+		defer pc.Exec(context.WithoutCancel(ctx), "UNLISTEN "+channel)
+
+		for {
+			if _, err := pc.WaitForNotification(ctx); err != nil {
+				return err
+			}
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+		}
+	})
+}
@@ -0,0 +1,207 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/database/sql"
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/chris-alexander-pop/system-design-library/pkg/messaging"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Config configures an Outbox and its Relay.
+type Config struct {
+	// Table is the outbox table name.
+	Table string `env:"OUTBOX_TABLE" env-default:"messaging_outbox"`
+
+	// Partitions is the number of partitions messages are spread over by key.
+	// A partition is drained by one relay at a time, which keeps messages with
+	// the same key in order. It must not change while the table holds
+	// undelivered messages.
+	Partitions int `env:"OUTBOX_PARTITIONS" env-default:"16"`
+
+	// BatchSize is the number of rows a relay reads from a partition at once.
+	BatchSize int `env:"OUTBOX_BATCH_SIZE" env-default:"100"`
+
+	// PollInterval is how often a relay checks for new messages.
+	PollInterval time.Duration `env:"OUTBOX_POLL_INTERVAL" env-default:"1s"`
+
+	// LeaseTTL is how long a partition lease lasts without renewal. Leases
+	// are renewed, and free partitions claimed, every LeaseTTL/3.
+	LeaseTTL time.Duration `env:"OUTBOX_LEASE_TTL" env-default:"30s"`
+
+	// MaxAttempts is how often a message is published before it is marked
+	// failed and skipped. Failed rows are kept for inspection.
+	MaxAttempts int `env:"OUTBOX_MAX_ATTEMPTS" env-default:"10"`
+
+	// RetryBackoff is the delay after the first failed attempt; it doubles
+	// with every further attempt up to MaxBackoff.
+	RetryBackoff time.Duration `env:"OUTBOX_RETRY_BACKOFF" env-default:"1s"`
+
+	// MaxBackoff caps the retry delay.
+	MaxBackoff time.Duration `env:"OUTBOX_MAX_BACKOFF" env-default:"5m"`
+
+	// Retention is how long delivered rows are kept. 0 deletes them as soon
+	// as they are published.
+	Retention time.Duration `env:"OUTBOX_RETENTION" env-default:"0s"`
+
+	// NotifyChannel enables LISTEN/NOTIFY on Postgres: Enqueue notifies the
+	// channel and relays wake up immediately instead of waiting for the next
+	// poll. It is ignored on other databases.
+	NotifyChannel string `env:"OUTBOX_NOTIFY_CHANNEL"`
+}
+
+func (c Config) withDefaults() Config {
+	if c.Table == "" {
+		c.Table = "messaging_outbox"
+	}
+	if c.Partitions <= 0 {
+		c.Partitions = 16
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 100
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = time.Second
+	}
+	if c.LeaseTTL <= 0 {
+		c.LeaseTTL = 30 * time.Second
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 10
+	}
+	if c.RetryBackoff <= 0 {
+		c.RetryBackoff = time.Second
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = 5 * time.Minute
+	}
+	return c
+}
+
+// Record is a row of the outbox table.
+type Record struct {
+	ID            uint64 `gorm:"primaryKey;autoIncrement"`
+	MessageID     string `gorm:"size:64;not null"`
+	Topic         string `gorm:"size:255;not null"`
+	Key           []byte
+	Payload       []byte
+	Headers       []byte
+	Partition     int        `gorm:"column:partition_no;not null;index"`
+	Attempts      int        `gorm:"not null;default:0"`
+	LastError     string     `gorm:"size:1024"`
+	NextAttemptAt time.Time  `gorm:"not null"`
+	CreatedAt     time.Time  `gorm:"not null"`
+	DeliveredAt   *time.Time `gorm:"index"`
+	FailedAt      *time.Time
+}
+
+// Outbox stores messages in a database table so that they are published if
+// and only if the surrounding transaction commits.
+type Outbox struct {
+	db  sql.SQL
+	cfg Config
+}
+
+// New creates an Outbox on db. Zero config values get defaults.
+func New(db sql.SQL, cfg Config) *Outbox {
+	return &Outbox{db: db, cfg: cfg.withDefaults()}
+}
+
+// Migrate creates or updates the outbox table.
+func (o *Outbox) Migrate(ctx context.Context) error {
+	if err := o.db.Get(ctx).Table(o.cfg.Table).AutoMigrate(&Record{}); err != nil {
+		return errors.Wrap(err, "failed to migrate outbox table")
+	}
+	return nil
+}
+
+// Enqueue inserts msgs into the outbox using tx, which should be the caller's
+// transaction. Messages without an ID or timestamp get one. The trace context
+// of the transaction's context is stored in the message headers, so the trace
+// continues when the relay publishes the message.
+func (o *Outbox) Enqueue(tx *gorm.DB, msgs ...*messaging.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	records := make([]Record, len(msgs))
+	for i, msg := range msgs {
+		if msg.Topic == "" {
+			return errors.InvalidArgument("outbox message has no topic", nil)
+		}
+		if msg.ID == "" {
+			msg.ID = uuid.New().String()
+		}
+		if msg.Timestamp.IsZero() {
+			msg.Timestamp = now
+		}
+		if tx.Statement != nil && tx.Statement.Context != nil {
+			msg.Headers = instrument.InjectHeaders(tx.Statement.Context, msg.Headers)
+		}
+
+		var headers []byte
+		if len(msg.Headers) > 0 {
+			var err error
+			if headers, err = json.Marshal(msg.Headers); err != nil {
+				return messaging.ErrSerializationFailed(err)
+			}
+		}
+
+		records[i] = Record{
+			MessageID:     msg.ID,
+			Topic:         msg.Topic,
+			Key:           msg.Key,
+			Payload:       msg.Payload,
+			Headers:       headers,
+			Partition:     o.partition(msg),
+			NextAttemptAt: now,
+			CreatedAt:     msg.Timestamp,
+		}
+	}
+
+	if err := tx.Table(o.cfg.Table).Create(&records).Error; err != nil {
+		return errors.Wrap(err, "failed to insert outbox messages")
+	}
+	if o.cfg.NotifyChannel != "" && tx.Dialector.Name() == "postgres" {
+		// Delivered by Postgres only when the transaction commits.
+		if err := tx.Exec("SELECT pg_notify(?, '')", o.cfg.NotifyChannel).Error; err != nil {
+			return errors.Wrap(err, "failed to notify outbox relay")
+		}
+	}
+	return nil
+}
+
+// partition maps a message to a partition by key. Messages without a key
+// need no ordering and are spread by ID.
+func (o *Outbox) partition(msg *messaging.Message) int {
+	h := fnv.New32a()
+	if len(msg.Key) > 0 {
+		h.Write(msg.Key)
+	} else {
+		h.Write([]byte(msg.ID))
+	}
+	return int(h.Sum32() % uint32(o.cfg.Partitions))
+}
+
+func (r *Record) message() (*messaging.Message, error) {
+	msg := &messaging.Message{
+		ID:        r.MessageID,
+		Topic:     r.Topic,
+		Key:       r.Key,
+		Payload:   r.Payload,
+		Timestamp: r.CreatedAt,
+	}
+	if len(r.Headers) > 0 {
+		if err := json.Unmarshal(r.Headers, &msg.Headers); err != nil {
+			return nil, messaging.ErrSerializationFailed(err)
+		}
+	}
+	return msg, nil
+}
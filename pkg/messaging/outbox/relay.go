@@ -0,0 +1,313 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/concurrency/distlock"
+	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+	"github.com/chris-alexander-pop/system-design-library/pkg/messaging"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
+	"gorm.io/gorm"
+)
+
+// Relay publishes outbox messages through a messaging.Broker.
+//
+// Every partition is leased through a distlock.Locker, so only one relay
+// instance drains it at a time. Within a partition, rows are published in
+// insertion order; a message that fails is retried with backoff and holds
+// back later messages with the same key until it is delivered or has
+// exhausted MaxAttempts. Delivery is at-least-once: a relay that loses its
+// lease mid-batch may publish a message the next owner publishes again.
+type Relay struct {
+	outbox *Outbox
+	broker messaging.Broker
+	locker distlock.Locker
+	cfg    Config
+
+	producers map[string]messaging.Producer
+
+	mu    sync.Mutex
+	owned map[int]distlock.Lock
+}
+
+// NewRelay creates a Relay for the messages of o.
+func NewRelay(o *Outbox, broker messaging.Broker, locker distlock.Locker) *Relay {
+	return &Relay{
+		outbox:    o,
+		broker:    broker,
+		locker:    locker,
+		cfg:       o.cfg,
+		producers: make(map[string]messaging.Producer),
+		owned:     make(map[int]distlock.Lock),
+	}
+}
+
+// Run leases partitions and publishes their messages until ctx is cancelled,
+// then releases the leases and closes its producers.
+func (r *Relay) Run(ctx context.Context) error {
+	defer r.closeProducers()
+	defer r.releaseAll(context.WithoutCancel(ctx))
+
+	wake := make(chan struct{}, 1)
+	if r.cfg.NotifyChannel != "" && r.outbox.db.Get(ctx).Dialector.Name() == "postgres" {
+		go r.listen(ctx, wake)
+	}
+
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+
+	var balanced time.Time
+	for {
+		if time.Since(balanced) >= r.cfg.LeaseTTL/3 {
+			r.balance(ctx)
+			r.cleanup(ctx)
+			balanced = time.Now()
+		}
+		for _, p := range r.Partitions() {
+			r.drain(ctx, p)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-wake:
+		}
+	}
+}
+
+// Partitions returns the partitions currently leased by this relay.
+func (r *Relay) Partitions() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ps := make([]int, 0, len(r.owned))
+	for p := range r.owned {
+		ps = append(ps, p)
+	}
+	sort.Ints(ps)
+	return ps
+}
+
+// balance renews held leases and tries to lease partitions nobody holds.
+func (r *Relay) balance(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for p, lease := range r.owned {
+		if err := lease.Extend(ctx, r.cfg.LeaseTTL); err != nil || !lease.IsHeld() {
+			logger.L().WarnContext(ctx, "lost outbox partition lease", "table", r.cfg.Table, "partition", p, "error", err)
+			delete(r.owned, p)
+		}
+	}
+
+	for p := 0; p < r.cfg.Partitions; p++ {
+		if r.owned[p] != nil {
+			continue
+		}
+		lease := r.locker.NewLock(r.leaseKey(p), r.cfg.LeaseTTL)
+		ok, err := lease.Acquire(ctx)
+		if err != nil {
+			logger.L().ErrorContext(ctx, "failed to acquire outbox partition lease", "partition", p, "error", err)
+			continue
+		}
+		if ok {
+			r.owned[p] = lease
+		}
+	}
+}
+
+// drain publishes the due messages of one partition. It pages through the
+// due rows by ID, so keys held back by a failed message do not stall the
+// other keys behind them.
+func (r *Relay) drain(ctx context.Context, partition int) {
+	now := time.Now()
+	blocked, err := r.backedOff(ctx, partition, now)
+	if err != nil {
+		logger.L().ErrorContext(ctx, "failed to read outbox", "partition", partition, "error", err)
+		return
+	}
+
+	var lastSeen uint64
+	for ctx.Err() == nil && r.holds(partition) {
+		var rows []Record
+		err := r.table(ctx).
+			Where("partition_no = ? AND delivered_at IS NULL AND failed_at IS NULL", partition).
+			Where("next_attempt_at IS NULL OR next_attempt_at <= ?", now).
+			Where("id > ?", lastSeen).
+			Order("id").
+			Limit(r.cfg.BatchSize).
+			Find(&rows).Error
+		if err != nil {
+			logger.L().ErrorContext(ctx, "failed to read outbox", "partition", partition, "error", err)
+			return
+		}
+
+		for i := range rows {
+			row := &rows[i]
+			lastSeen = row.ID
+			key := string(row.Key)
+			ordered := len(row.Key) > 0
+			if ordered && blocked[key] {
+				continue
+			}
+
+			if err := r.publish(ctx, row); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				if !r.fail(ctx, row, err) {
+					blocked[key] = ordered
+				}
+				continue
+			}
+			r.delivered(ctx, row)
+		}
+
+		if len(rows) < r.cfg.BatchSize {
+			return
+		}
+	}
+}
+
+// backedOff returns the keys of a partition whose oldest pending message is
+// waiting out a retry backoff. Later messages with those keys must wait too.
+func (r *Relay) backedOff(ctx context.Context, partition int, now time.Time) (map[string]bool, error) {
+	var keys [][]byte
+	err := r.table(ctx).
+		Where("partition_no = ? AND delivered_at IS NULL AND failed_at IS NULL AND next_attempt_at > ?", partition, now).
+		Distinct().
+		Pluck("key", &keys).Error
+	if err != nil {
+		return nil, err
+	}
+	blocked := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		if len(k) > 0 {
+			blocked[string(k)] = true
+		}
+	}
+	return blocked, nil
+}
+
+func (r *Relay) publish(ctx context.Context, row *Record) error {
+	msg, err := row.message()
+	if err != nil {
+		return err
+	}
+	producer, ok := r.producers[row.Topic]
+	if !ok {
+		if producer, err = r.broker.Producer(row.Topic); err != nil {
+			return err
+		}
+		r.producers[row.Topic] = producer
+	}
+	// Publish within the trace of the transaction that enqueued the message.
+	return producer.Publish(instrument.ExtractHeaders(ctx, msg.Headers), msg)
+}
+
+// fail records a failed attempt and reports whether the message was given up.
+func (r *Relay) fail(ctx context.Context, row *Record, cause error) bool {
+	attempts := row.Attempts + 1
+	updates := map[string]interface{}{
+		"attempts":   attempts,
+		"last_error": truncate(cause.Error(), 1024),
+	}
+
+	givenUp := attempts >= r.cfg.MaxAttempts
+	if givenUp {
+		logger.L().ErrorContext(ctx, "giving up on outbox message", "id", row.MessageID, "topic", row.Topic, "attempts", attempts, "error", cause)
+		updates["failed_at"] = time.Now()
+	} else {
+		logger.L().WarnContext(ctx, "failed to publish outbox message", "id", row.MessageID, "topic", row.Topic, "attempt", attempts, "error", cause)
+		updates["next_attempt_at"] = time.Now().Add(r.backoff(attempts))
+	}
+
+	if err := r.table(ctx).Where("id = ?", row.ID).Updates(updates).Error; err != nil {
+		logger.L().ErrorContext(ctx, "failed to update outbox message", "id", row.MessageID, "error", err)
+	}
+	return givenUp
+}
+
+func (r *Relay) delivered(ctx context.Context, row *Record) {
+	var err error
+	if r.cfg.Retention == 0 {
+		err = r.table(ctx).Where("id = ?", row.ID).Delete(&Record{}).Error
+	} else {
+		err = r.table(ctx).Where("id = ?", row.ID).Update("delivered_at", time.Now()).Error
+	}
+	if err != nil {
+		// The message will be published again on the next pass.
+		logger.L().ErrorContext(ctx, "failed to mark outbox message delivered", "id", row.MessageID, "error", err)
+	}
+}
+
+// cleanup deletes delivered rows older than Retention from the partitions
+// this relay holds.
+func (r *Relay) cleanup(ctx context.Context) {
+	if r.cfg.Retention == 0 {
+		return
+	}
+	partitions := r.Partitions()
+	if len(partitions) == 0 {
+		return
+	}
+	err := r.table(ctx).
+		Where("partition_no IN ? AND delivered_at < ?", partitions, time.Now().Add(-r.cfg.Retention)).
+		Delete(&Record{}).Error
+	if err != nil {
+		logger.L().ErrorContext(ctx, "failed to clean up outbox", "error", err)
+	}
+}
+
+func (r *Relay) backoff(attempts int) time.Duration {
+	d := r.cfg.RetryBackoff
+	for i := 1; i < attempts && d < r.cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, r.cfg.MaxBackoff)
+}
+
+func (r *Relay) holds(partition int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.owned[partition] != nil
+}
+
+func (r *Relay) releaseAll(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for p, lease := range r.owned {
+		if err := lease.Release(ctx); err != nil {
+			logger.L().WarnContext(ctx, "failed to release outbox partition lease", "partition", p, "error", err)
+		}
+		delete(r.owned, p)
+	}
+}
+
+func (r *Relay) closeProducers() {
+	for topic, p := range r.producers {
+		p.Close()
+		delete(r.producers, topic)
+	}
+}
+
+func (r *Relay) table(ctx context.Context) *gorm.DB {
+	return r.outbox.db.Get(ctx).Table(r.cfg.Table)
+}
+
+func (r *Relay) leaseKey(partition int) string {
+	return fmt.Sprintf("messaging:outbox:%s/%d", r.cfg.Table, partition)
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
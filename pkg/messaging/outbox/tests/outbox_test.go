@@ -0,0 +1,295 @@
+package outbox_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	distlockmemory "github.com/chris-alexander-pop/system-design-library/pkg/concurrency/distlock/adapters/memory"
+	"github.com/chris-alexander-pop/system-design-library/pkg/database/sql"
+	sqlmemory "github.com/chris-alexander-pop/system-design-library/pkg/database/sql/adapters/memory"
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/chris-alexander-pop/system-design-library/pkg/messaging"
+	"github.com/chris-alexander-pop/system-design-library/pkg/messaging/outbox"
+	"gorm.io/gorm"
+)
+
+// recordingBroker records published messages and fails every message whose
+// ID is in failures as often as its count says.
+type recordingBroker struct {
+	mu        sync.Mutex
+	published []*messaging.Message
+	failures  map[string]int
+}
+
+func (b *recordingBroker) Producer(topic string) (messaging.Producer, error) {
+	return &recordingProducer{b: b}, nil
+}
+
+func (b *recordingBroker) Consumer(topic, group string) (messaging.Consumer, error) {
+	return nil, errors.New(errors.CodeUnimplemented, "not supported", nil)
+}
+
+func (b *recordingBroker) Close() error                     { return nil }
+func (b *recordingBroker) Healthy(ctx context.Context) bool { return true }
+
+func (b *recordingBroker) ids() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ids := make([]string, len(b.published))
+	for i, m := range b.published {
+		ids[i] = m.ID
+	}
+	return ids
+}
+
+type recordingProducer struct{ b *recordingBroker }
+
+func (p *recordingProducer) Publish(ctx context.Context, msg *messaging.Message) error {
+	p.b.mu.Lock()
+	defer p.b.mu.Unlock()
+	if p.b.failures[msg.ID] > 0 {
+		p.b.failures[msg.ID]--
+		return messaging.ErrPublishFailed(nil)
+	}
+	p.b.published = append(p.b.published, msg)
+	return nil
+}
+
+func (p *recordingProducer) PublishBatch(ctx context.Context, msgs []*messaging.Message) error {
+	for _, m := range msgs {
+		if err := p.Publish(ctx, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *recordingProducer) Close() error { return nil }
+
+func newOutbox(t *testing.T, cfg outbox.Config) (*sqlmemory.Adapter, *outbox.Outbox) {
+	t.Helper()
+	db, err := sqlmemory.NewWithConfig(sql.Config{Name: t.Name()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	// Shared-cache SQLite fails concurrent statements with "table is locked"
+	// instead of waiting, so relays and writers share a single connection.
+	sqlDB, err := db.Get(context.Background()).DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	ob := outbox.New(db, cfg)
+	if err := ob.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return db, ob
+}
+
+func pending(t *testing.T, db *sqlmemory.Adapter) int64 {
+	t.Helper()
+	var n int64
+	if err := db.Get(context.Background()).Table("messaging_outbox").Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestEnqueueIsTransactional(t *testing.T) {
+	ctx := context.Background()
+	db, ob := newOutbox(t, outbox.Config{PollInterval: 5 * time.Millisecond})
+
+	err := db.Get(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := ob.Enqueue(tx, &messaging.Message{ID: "rolled-back", Topic: "orders"}); err != nil {
+			return err
+		}
+		return fmt.Errorf("abort")
+	})
+	if err == nil {
+		t.Fatal("expected the transaction to fail")
+	}
+	err = db.Get(ctx).Transaction(func(tx *gorm.DB) error {
+		return ob.Enqueue(tx,
+			&messaging.Message{ID: "m1", Topic: "orders", Key: []byte("k"), Headers: map[string]string{"a": "b"}},
+			&messaging.Message{ID: "m2", Topic: "orders", Key: []byte("k")},
+		)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ob.Enqueue(db.Get(ctx), &messaging.Message{ID: "no-topic"}); err == nil {
+		t.Error("expected an error for a message without topic")
+	}
+
+	broker := &recordingBroker{}
+	relay := outbox.NewRelay(ob, broker, distlockmemory.New())
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go relay.Run(runCtx)
+
+	waitFor(t, func() bool { return len(broker.ids()) == 2 })
+	waitFor(t, func() bool { return pending(t, db) == 0 })
+
+	ids := broker.ids()
+	if ids[0] != "m1" || ids[1] != "m2" {
+		t.Errorf("unexpected delivery %v", ids)
+	}
+	broker.mu.Lock()
+	if broker.published[0].Headers["a"] != "b" {
+		t.Errorf("headers not preserved: %v", broker.published[0].Headers)
+	}
+	broker.mu.Unlock()
+}
+
+func TestRelayRetriesInKeyOrder(t *testing.T) {
+	ctx := context.Background()
+	db, ob := newOutbox(t, outbox.Config{
+		Partitions:   1,
+		PollInterval: 5 * time.Millisecond,
+		RetryBackoff: 20 * time.Millisecond,
+		MaxAttempts:  3,
+	})
+
+	err := ob.Enqueue(db.Get(ctx),
+		&messaging.Message{ID: "a1", Topic: "t", Key: []byte("a")},
+		&messaging.Message{ID: "b1", Topic: "t", Key: []byte("b")},
+		&messaging.Message{ID: "a2", Topic: "t", Key: []byte("a")},
+		&messaging.Message{ID: "c1", Topic: "t", Key: []byte("c")},
+		&messaging.Message{ID: "c2", Topic: "t", Key: []byte("c")},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a1 fails once and must still precede a2; c1 always fails, is given up
+	// after MaxAttempts and no longer holds back c2.
+	broker := &recordingBroker{failures: map[string]int{"a1": 1, "c1": 100}}
+	relay := outbox.NewRelay(ob, broker, distlockmemory.New())
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go relay.Run(runCtx)
+
+	waitFor(t, func() bool { return len(broker.ids()) == 4 })
+
+	pos := map[string]int{}
+	for i, id := range broker.ids() {
+		pos[id] = i
+	}
+	if pos["a1"] > pos["a2"] {
+		t.Errorf("a2 delivered before a1: %v", broker.ids())
+	}
+	if _, ok := pos["c1"]; ok {
+		t.Errorf("c1 should have been given up: %v", broker.ids())
+	}
+
+	var failed outbox.Record
+	waitFor(t, func() bool {
+		err := db.Get(ctx).Table("messaging_outbox").Where("message_id = ?", "c1").First(&failed).Error
+		return err == nil && failed.FailedAt != nil
+	})
+	if failed.Attempts != 3 || failed.LastError == "" {
+		t.Errorf("unexpected failed row: attempts=%d error=%q", failed.Attempts, failed.LastError)
+	}
+}
+
+func TestBackedOffKeyDoesNotBlockOtherKeys(t *testing.T) {
+	ctx := context.Background()
+	db, ob := newOutbox(t, outbox.Config{
+		Partitions:   1,
+		BatchSize:    2,
+		PollInterval: 5 * time.Millisecond,
+		RetryBackoff: time.Hour,
+	})
+
+	// p1 fails and backs off for an hour, holding back p2..p4, which fill
+	// more than a batch ahead of o1.
+	var msgs []*messaging.Message
+	for i := 1; i <= 4; i++ {
+		msgs = append(msgs, &messaging.Message{ID: fmt.Sprintf("p%d", i), Topic: "t", Key: []byte("poison")})
+	}
+	msgs = append(msgs, &messaging.Message{ID: "o1", Topic: "t", Key: []byte("other")})
+	if err := ob.Enqueue(db.Get(ctx), msgs...); err != nil {
+		t.Fatal(err)
+	}
+
+	broker := &recordingBroker{failures: map[string]int{"p1": 1}}
+	relay := outbox.NewRelay(ob, broker, distlockmemory.New())
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go relay.Run(runCtx)
+
+	waitFor(t, func() bool { return len(broker.ids()) == 1 })
+	time.Sleep(50 * time.Millisecond)
+	if ids := broker.ids(); len(ids) != 1 || ids[0] != "o1" {
+		t.Errorf("expected only o1 to be delivered while p1 backs off, got %v", ids)
+	}
+}
+
+func TestRelaysSharePartitions(t *testing.T) {
+	ctx := context.Background()
+	db, ob := newOutbox(t, outbox.Config{
+		Partitions:   4,
+		PollInterval: 5 * time.Millisecond,
+		LeaseTTL:     60 * time.Millisecond,
+		Retention:    time.Hour,
+	})
+
+	broker := &recordingBroker{}
+	locker := distlockmemory.New()
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	relays := []*outbox.Relay{
+		outbox.NewRelay(ob, broker, locker),
+		outbox.NewRelay(ob, broker, locker),
+	}
+	for _, r := range relays {
+		go r.Run(runCtx)
+	}
+	waitFor(t, func() bool {
+		return len(relays[0].Partitions())+len(relays[1].Partitions()) == 4
+	})
+
+	for i := 0; i < 50; i++ {
+		msg := &messaging.Message{ID: fmt.Sprintf("m%d", i), Topic: "t", Key: []byte(fmt.Sprintf("k%d", i))}
+		if err := ob.Enqueue(db.Get(ctx), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, func() bool { return len(broker.ids()) == 50 })
+
+	seen := map[string]bool{}
+	for _, id := range broker.ids() {
+		if seen[id] {
+			t.Errorf("%s published twice", id)
+		}
+		seen[id] = true
+	}
+
+	// With a retention period delivered rows are kept, but marked.
+	var undelivered int64
+	waitFor(t, func() bool {
+		db.Get(ctx).Table("messaging_outbox").Where("delivered_at IS NULL").Count(&undelivered)
+		return undelivered == 0
+	})
+	if n := pending(t, db); n != 50 {
+		t.Errorf("expected 50 retained rows, got %d", n)
+	}
+}
@@ -0,0 +1,455 @@
+package messaging
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+)
+
+// Headers set on messages routed to retry topics and dead-letter queues.
+const (
+	// HeaderRetryAttempt is the number of failed handler attempts so far.
+	HeaderRetryAttempt = "x-retry-attempt"
+
+	// HeaderRetryAt is when the next attempt is due, in Unix milliseconds.
+	HeaderRetryAt = "x-retry-at"
+
+	// HeaderRetryError is the error returned by the last attempt.
+	HeaderRetryError = "x-retry-error"
+
+	// HeaderOriginalTopic is the topic the message was first published to.
+	HeaderOriginalTopic = "x-original-topic"
+
+	// HeaderDeadLetterReason is the error that sent the message to the DLQ.
+	HeaderDeadLetterReason = "x-dlq-reason"
+
+	// HeaderDeadLetterGroup is the consumer group that gave up on the message.
+	HeaderDeadLetterGroup = "x-dlq-group"
+
+	// HeaderDeadLetterAt is when the message was dead-lettered, in RFC 3339.
+	HeaderDeadLetterAt = "x-dlq-failed-at"
+
+	// HeaderReplayCount is how often the message was replayed from a DLQ.
+	HeaderReplayCount = "x-replay-count"
+)
+
+// maxErrorHeader caps the length of error headers.
+const maxErrorHeader = 1024
+
+// RetryTopicConfig configures a RetryingConsumer.
+type RetryTopicConfig struct {
+	// MaxAttempts is the total number of handler attempts, including the
+	// first delivery, before a message is dead-lettered.
+	MaxAttempts int `env:"MSG_RETRY_TOPIC_MAX_ATTEMPTS" env-default:"5"`
+
+	// InitialBackoff is the delay before the first retry.
+	InitialBackoff time.Duration `env:"MSG_RETRY_TOPIC_INITIAL_BACKOFF" env-default:"1s"`
+
+	// MaxBackoff caps the delay between attempts.
+	MaxBackoff time.Duration `env:"MSG_RETRY_TOPIC_MAX_BACKOFF" env-default:"1h"`
+
+	// Multiplier grows the delay after every attempt.
+	Multiplier float64 `env:"MSG_RETRY_TOPIC_MULTIPLIER" env-default:"2"`
+
+	// RetryBroker hosts the retry topics. Defaults to the consumed broker.
+	// Brokers bound to a single queue (SQS) need a separate broker per queue.
+	RetryBroker Broker
+
+	// DeadLetterBroker hosts the dead-letter topic. Defaults to the consumed broker.
+	DeadLetterBroker Broker
+}
+
+// RetryTopicName returns the topic holding messages of topic that failed
+// attempt times in group.
+func RetryTopicName(topic, group string, attempt int) string {
+	return topic + "." + group + ".retry." + strconv.Itoa(attempt)
+}
+
+// DeadLetterTopicName returns the dead-letter topic for topic and group.
+func DeadLetterTopicName(topic, group string) string {
+	return topic + "." + group + ".dlq"
+}
+
+// RetryingConsumer applies a uniform poison-message policy on top of any
+// Broker. When the handler fails, the message is acknowledged and published
+// to a retry topic for its attempt with the time the next attempt is due; the
+// retry topics are consumed alongside the main topic and every message is
+// handed to the handler once it is due. After MaxAttempts the message goes to
+// the group's dead-letter topic with the failure reason in its headers.
+//
+// Delays use DelayedProducer when the retry broker's producers implement it
+// (memory, SQS), and a message delivered early is re-published with the
+// remaining delay. On other brokers a retry topic acts as a delay queue: its
+// consumer holds the head message until it is due. Every retry topic carries
+// a single backoff step, so its messages become due in publish order and the
+// wait never delays a message that is already due. Only retry topic
+// consumers wait; the main topic and the handler are never held back. Retry
+// and dead-letter topics are scoped to the consumer group, so other groups
+// on the topic are unaffected.
+// Topics are named by RetryTopicName and DeadLetterTopicName and must exist
+// on brokers that do not create topics on demand.
+type RetryingConsumer struct {
+	topic string
+	group string
+	cfg   RetryTopicConfig
+
+	consumers []Consumer // main topic first, then retry topics by attempt
+	retries   []Producer // indexed by attempt-1
+	dlq       Producer
+}
+
+// NewRetryingConsumer creates a RetryingConsumer for topic and group. Zero
+// config values get defaults.
+func NewRetryingConsumer(broker Broker, topic, group string, cfg RetryTopicConfig) (*RetryingConsumer, error) {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = time.Second
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = time.Hour
+	}
+	if cfg.Multiplier < 1 {
+		cfg.Multiplier = 2
+	}
+	if cfg.RetryBroker == nil {
+		cfg.RetryBroker = broker
+	}
+	if cfg.DeadLetterBroker == nil {
+		cfg.DeadLetterBroker = broker
+	}
+
+	rc := &RetryingConsumer{topic: topic, group: group, cfg: cfg}
+
+	main, err := broker.Consumer(topic, group)
+	if err != nil {
+		return nil, err
+	}
+	rc.consumers = append(rc.consumers, main)
+
+	for attempt := 1; attempt < cfg.MaxAttempts; attempt++ {
+		name := RetryTopicName(topic, group, attempt)
+		p, err := cfg.RetryBroker.Producer(name)
+		if err != nil {
+			rc.Close()
+			return nil, err
+		}
+		rc.retries = append(rc.retries, p)
+
+		c, err := cfg.RetryBroker.Consumer(name, group)
+		if err != nil {
+			rc.Close()
+			return nil, err
+		}
+		rc.consumers = append(rc.consumers, c)
+	}
+
+	if rc.dlq, err = cfg.DeadLetterBroker.Producer(DeadLetterTopicName(topic, group)); err != nil {
+		rc.Close()
+		return nil, err
+	}
+	return rc, nil
+}
+
+// Consume consumes the main topic and all retry topics until ctx is
+// cancelled or one of the underlying consumers fails.
+func (rc *RetryingConsumer) Consume(ctx context.Context, handler MessageHandler) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	for _, c := range rc.consumers {
+		wg.Add(1)
+		go func(c Consumer) {
+			defer wg.Done()
+			err := c.Consume(ctx, func(ctx context.Context, msg *Message) error {
+				return rc.process(ctx, msg, handler)
+			})
+			if err != nil && ctx.Err() == nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(c)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// Close closes all consumers and producers.
+func (rc *RetryingConsumer) Close() error {
+	var firstErr error
+	keep := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	for _, c := range rc.consumers {
+		keep(c.Close())
+	}
+	for _, p := range rc.retries {
+		keep(p.Close())
+	}
+	if rc.dlq != nil {
+		keep(rc.dlq.Close())
+	}
+	return firstErr
+}
+
+// process runs the handler once msg is due and routes failures. It returns
+// an error only if a message could not be re-published, leaving it to the
+// broker's own redelivery.
+func (rc *RetryingConsumer) process(ctx context.Context, msg *Message, handler MessageHandler) error {
+	attempt := headerInt(msg, HeaderRetryAttempt)
+
+	if due, _ := strconv.ParseInt(msg.Headers[HeaderRetryAt], 10, 64); due > 0 && attempt >= 1 && attempt <= len(rc.retries) {
+		if wait := time.Until(time.UnixMilli(due)); wait > 0 {
+			if handled, err := rc.delay(ctx, msg, attempt, wait); handled || err != nil {
+				return err
+			}
+		}
+	}
+
+	herr := handler(ctx, msg)
+	if herr == nil {
+		return nil
+	}
+
+	next := attempt + 1
+	if next >= rc.cfg.MaxAttempts {
+		return rc.deadLetter(ctx, msg, next, herr)
+	}
+	return rc.retry(ctx, msg, next, herr)
+}
+
+// delay holds back msg, read from the retry topic for attempt, for wait. A
+// delayed producer re-publishes it and reports it handled; otherwise the
+// retry topic is a delay queue and delay waits for the message to be due.
+func (rc *RetryingConsumer) delay(ctx context.Context, msg *Message, attempt int, wait time.Duration) (bool, error) {
+	if dp, ok := rc.retries[attempt-1].(DelayedProducer); ok {
+		// Delivered early, e.g. because the broker caps delays.
+		return true, dp.PublishDelayed(ctx, rc.copy(msg), wait)
+	}
+
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	case <-t.C:
+		return false, nil
+	}
+}
+
+func (rc *RetryingConsumer) retry(ctx context.Context, msg *Message, attempt int, cause error) error {
+	backoff := rc.backoff(attempt)
+	out := rc.copy(msg)
+	out.Headers[HeaderRetryAttempt] = strconv.Itoa(attempt)
+	out.Headers[HeaderRetryAt] = strconv.FormatInt(time.Now().Add(backoff).UnixMilli(), 10)
+	out.Headers[HeaderRetryError] = truncateHeader(cause.Error())
+
+	logger.L().WarnContext(ctx, "message handler failed, scheduling retry",
+		"topic", rc.topic, "group", rc.group, "message_id", msg.ID, "attempt", attempt, "backoff", backoff, "error", cause)
+
+	p := rc.retries[attempt-1]
+	if dp, ok := p.(DelayedProducer); ok {
+		return dp.PublishDelayed(ctx, out, backoff)
+	}
+	return p.Publish(ctx, out)
+}
+
+func (rc *RetryingConsumer) deadLetter(ctx context.Context, msg *Message, attempts int, cause error) error {
+	out := rc.copy(msg)
+	delete(out.Headers, HeaderRetryAt)
+	delete(out.Headers, HeaderRetryError)
+	out.Headers[HeaderRetryAttempt] = strconv.Itoa(attempts)
+	out.Headers[HeaderDeadLetterReason] = truncateHeader(cause.Error())
+	out.Headers[HeaderDeadLetterGroup] = rc.group
+	out.Headers[HeaderDeadLetterAt] = time.Now().UTC().Format(time.RFC3339)
+
+	logger.L().ErrorContext(ctx, "message handler failed, moving message to dead-letter topic",
+		"topic", rc.topic, "group", rc.group, "message_id", msg.ID, "attempts", attempts, "error", cause)
+
+	return rc.dlq.Publish(ctx, out)
+}
+
+// copy returns a message to re-publish. Brokers may share the received
+// message between groups, so it is never modified in place.
+func (rc *RetryingConsumer) copy(msg *Message) *Message {
+	out := &Message{
+		ID:        msg.ID,
+		Key:       msg.Key,
+		Payload:   msg.Payload,
+		Timestamp: msg.Timestamp,
+		Headers:   make(map[string]string, len(msg.Headers)+4),
+	}
+	for k, v := range msg.Headers {
+		out.Headers[k] = v
+	}
+	if out.Headers[HeaderOriginalTopic] == "" {
+		out.Headers[HeaderOriginalTopic] = rc.topic
+	}
+	return out
+}
+
+func (rc *RetryingConsumer) backoff(attempt int) time.Duration {
+	d := float64(rc.cfg.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		d *= rc.cfg.Multiplier
+		if d >= float64(rc.cfg.MaxBackoff) {
+			return rc.cfg.MaxBackoff
+		}
+	}
+	return time.Duration(d)
+}
+
+// ReplayOptions configures ReplayDeadLetters.
+type ReplayOptions struct {
+	// Limit is the maximum number of messages to replay. 0 replays all.
+	Limit int
+
+	// IdleTimeout ends the replay once no message arrived for this long.
+	IdleTimeout time.Duration
+
+	// Group is the consumer group used to read the dead-letter topic.
+	Group string
+
+	// Target is the topic to publish to. Defaults to the original topic
+	// recorded on each message.
+	Target string
+
+	// TargetBroker is the broker to publish to. Defaults to the broker the
+	// dead-letter topic is read from.
+	TargetBroker Broker
+}
+
+// ReplayDeadLetters moves messages from the dead-letter topic of topic and
+// group back to their original topic, resetting their retry state, and
+// returns how many were moved. It stops when ctx is cancelled, Limit is
+// reached or the topic has been idle for IdleTimeout.
+func ReplayDeadLetters(ctx context.Context, broker Broker, topic, group string, opts ReplayOptions) (int, error) {
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = 5 * time.Second
+	}
+	if opts.Group == "" {
+		opts.Group = "dlq-replay"
+	}
+	if opts.TargetBroker == nil {
+		opts.TargetBroker = broker
+	}
+
+	dlqTopic := DeadLetterTopicName(topic, group)
+	consumer, err := broker.Consumer(dlqTopic, opts.Group)
+	if err != nil {
+		return 0, err
+	}
+	defer consumer.Close()
+
+	// Messages read after the limit is reached go back to the DLQ.
+	requeue, err := broker.Producer(dlqTopic)
+	if err != nil {
+		return 0, err
+	}
+	defer requeue.Close()
+
+	producers := make(map[string]Producer)
+	defer func() {
+		for _, p := range producers {
+			p.Close()
+		}
+	}()
+
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	idle := time.AfterFunc(opts.IdleTimeout, cancel)
+	defer idle.Stop()
+
+	var (
+		mu    sync.Mutex
+		moved int
+	)
+	err = consumer.Consume(ctx, func(ctx context.Context, msg *Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		idle.Reset(opts.IdleTimeout)
+
+		if opts.Limit > 0 && moved >= opts.Limit {
+			cancel()
+			return requeue.Publish(context.WithoutCancel(ctx), msg)
+		}
+
+		target := opts.Target
+		if target == "" {
+			target = msg.Headers[HeaderOriginalTopic]
+		}
+		if target == "" {
+			target = topic
+		}
+		p, ok := producers[target]
+		if !ok {
+			var err error
+			if p, err = opts.TargetBroker.Producer(target); err != nil {
+				return err
+			}
+			producers[target] = p
+		}
+
+		out := &Message{
+			ID:        msg.ID,
+			Topic:     target,
+			Key:       msg.Key,
+			Payload:   msg.Payload,
+			Timestamp: msg.Timestamp,
+			Headers:   make(map[string]string, len(msg.Headers)),
+		}
+		for k, v := range msg.Headers {
+			switch k {
+			case HeaderRetryAttempt, HeaderRetryAt, HeaderRetryError, HeaderOriginalTopic,
+				HeaderDeadLetterReason, HeaderDeadLetterGroup, HeaderDeadLetterAt:
+			default:
+				out.Headers[k] = v
+			}
+		}
+		out.Headers[HeaderReplayCount] = strconv.Itoa(headerInt(msg, HeaderReplayCount) + 1)
+
+		if err := p.Publish(context.WithoutCancel(ctx), out); err != nil {
+			return err
+		}
+		moved++
+		if opts.Limit > 0 && moved >= opts.Limit {
+			cancel()
+		}
+		return nil
+	})
+
+	if err != nil && ctx.Err() != nil {
+		// Stopped by the limit or idle timeout rather than a failure.
+		err = parent.Err()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return moved, err
+}
+
+func headerInt(msg *Message, key string) int {
+	n, _ := strconv.Atoi(msg.Headers[key])
+	return n
+}
+
+func truncateHeader(s string) string {
+	if len(s) > maxErrorHeader {
+		return s[:maxErrorHeader]
+	}
+	return s
+}
@@ -0,0 +1,125 @@
+// Package file provides a schema registry persisted to a JSON file.
+//
+// The registry is loaded from the file when it is opened and rewritten
+// atomically after every change, so schemas survive restarts without running
+// a registry service. The file must not be shared by several processes.
+//
+// # Usage
+//
+//	registry, err := file.New(file.Config{Path: "schemas.json"})
+//	defer registry.Close()
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/chris-alexander-pop/system-design-library/pkg/messaging/schema"
+	"github.com/chris-alexander-pop/system-design-library/pkg/messaging/schema/adapters/memory"
+)
+
+// Config holds configuration for the file registry.
+type Config struct {
+	// Path is the file the registry is stored in. It is created on the first
+	// change if it does not exist.
+	Path string `env:"SCHEMA_REGISTRY_FILE" env-default:"schemas.json"`
+
+	// DefaultCompatibility applies to subjects without a rule of their own.
+	DefaultCompatibility schema.Compatibility `env:"SCHEMA_REGISTRY_COMPATIBILITY" env-default:"BACKWARD"`
+}
+
+// Registry is a file-backed schema registry.
+type Registry struct {
+	*memory.Registry
+
+	path string
+
+	// mu serializes changes with the writes that persist them.
+	mu sync.Mutex
+}
+
+// New opens the registry stored at cfg.Path.
+func New(cfg Config) (*Registry, error) {
+	if cfg.Path == "" {
+		cfg.Path = "schemas.json"
+	}
+
+	var snap memory.Snapshot
+	data, err := os.ReadFile(cfg.Path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, errors.Internal("failed to read schema registry file", err)
+	default:
+		if err := json.Unmarshal(data, &snap); err != nil {
+			return nil, errors.Internal("failed to parse schema registry file", err)
+		}
+	}
+
+	mem, err := memory.NewFromSnapshot(memory.Config{DefaultCompatibility: cfg.DefaultCompatibility}, snap)
+	if err != nil {
+		return nil, errors.Internal("invalid schema registry file", err)
+	}
+	return &Registry{Registry: mem, path: cfg.Path}, nil
+}
+
+func (r *Registry) Register(ctx context.Context, subject string, format schema.Format, definition string) (*schema.Schema, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, err := r.Registry.Register(ctx, subject, format, definition)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.save(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (r *Registry) SetCompatibility(ctx context.Context, subject string, level schema.Compatibility) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.Registry.SetCompatibility(ctx, subject, level); err != nil {
+		return err
+	}
+	return r.save()
+}
+
+// save writes the registry to a temporary file and renames it over the
+// previous one, so a crash never leaves a partial file behind.
+func (r *Registry) save() error {
+	data, err := json.MarshalIndent(r.Snapshot(), "", "  ")
+	if err != nil {
+		return errors.Internal("failed to encode schema registry", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), filepath.Base(r.path)+".tmp-*")
+	if err != nil {
+		return errors.Internal("failed to write schema registry file", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Internal("failed to write schema registry file", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return errors.Internal("failed to write schema registry file", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Internal("failed to write schema registry file", err)
+	}
+	if err := os.Rename(tmp.Name(), r.path); err != nil {
+		return errors.Internal("failed to write schema registry file", err)
+	}
+	return nil
+}
+
+var _ schema.Registry = (*Registry)(nil)
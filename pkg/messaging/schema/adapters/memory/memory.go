@@ -0,0 +1,256 @@
+// Package memory provides an in-memory schema registry.
+//
+// It implements the subject, version and compatibility semantics of the
+// Confluent Schema Registry and is suitable for tests, local development and
+// as the base of the file-backed registry.
+//
+// # Usage
+//
+//	registry := memory.New(memory.Config{})
+//	s, err := registry.Register(ctx, "orders-value", schema.FormatAvro, definition)
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/concurrency"
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/chris-alexander-pop/system-design-library/pkg/messaging/schema"
+)
+
+// Config holds configuration for the memory registry.
+type Config struct {
+	// DefaultCompatibility applies to subjects without a rule of their own.
+	DefaultCompatibility schema.Compatibility `env:"SCHEMA_REGISTRY_COMPATIBILITY" env-default:"BACKWARD"`
+}
+
+// Snapshot is the complete state of a registry, used to persist it.
+type Snapshot struct {
+	Schemas       []schema.Schema                 `json:"schemas"`
+	Compatibility map[string]schema.Compatibility `json:"compatibility,omitempty"`
+}
+
+// Registry is an in-memory schema registry.
+type Registry struct {
+	config   Config
+	mu       *concurrency.SmartRWMutex
+	subjects map[string][]*schema.Schema
+	byID     map[int]*schema.Schema
+	ids      map[string]int // format and definition -> ID
+	levels   map[string]schema.Compatibility
+	nextID   int
+}
+
+// New creates an empty registry.
+func New(cfg Config) *Registry {
+	if cfg.DefaultCompatibility == "" {
+		cfg.DefaultCompatibility = schema.CompatibilityBackward
+	}
+	return &Registry{
+		config:   cfg,
+		mu:       concurrency.NewSmartRWMutex(concurrency.MutexConfig{Name: "MemorySchemaRegistry"}),
+		subjects: make(map[string][]*schema.Schema),
+		byID:     make(map[int]*schema.Schema),
+		ids:      make(map[string]int),
+		levels:   make(map[string]schema.Compatibility),
+		nextID:   1,
+	}
+}
+
+// NewFromSnapshot creates a registry holding the state of snap.
+func NewFromSnapshot(cfg Config, snap Snapshot) (*Registry, error) {
+	r := New(cfg)
+	for i := range snap.Schemas {
+		s := snap.Schemas[i]
+		versions := r.subjects[s.Subject]
+		if s.Version != len(versions)+1 {
+			return nil, fmt.Errorf("subject %s: version %d out of order", s.Subject, s.Version)
+		}
+		r.subjects[s.Subject] = append(versions, &s)
+		if _, ok := r.byID[s.ID]; !ok {
+			r.byID[s.ID] = &s
+		}
+		r.ids[identity(s.Format, s.Definition)] = s.ID
+		r.nextID = max(r.nextID, s.ID+1)
+	}
+	for subject, level := range snap.Compatibility {
+		r.levels[subject] = level
+	}
+	return r, nil
+}
+
+// Snapshot returns the state of the registry.
+func (r *Registry) Snapshot() Snapshot {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	snap := Snapshot{Compatibility: make(map[string]schema.Compatibility, len(r.levels))}
+	for _, subject := range r.sortedSubjects() {
+		for _, s := range r.subjects[subject] {
+			snap.Schemas = append(snap.Schemas, *s)
+		}
+	}
+	for subject, level := range r.levels {
+		snap.Compatibility[subject] = level
+	}
+	return snap
+}
+
+func (r *Registry) Register(ctx context.Context, subject string, format schema.Format, definition string) (*schema.Schema, error) {
+	if err := schema.Validate(format, definition); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	versions := r.subjects[subject]
+	if s := find(versions, format, definition); s != nil {
+		return copyOf(s), nil
+	}
+	if err := schema.CheckCompatibility(r.level(subject), format, definition, versions); err != nil {
+		return nil, schema.ErrIncompatible(subject, err)
+	}
+
+	id, ok := r.ids[identity(format, definition)]
+	if !ok {
+		id = r.nextID
+		r.nextID++
+	}
+	s := &schema.Schema{
+		ID:         id,
+		Subject:    subject,
+		Version:    len(versions) + 1,
+		Format:     format,
+		Definition: definition,
+	}
+	r.subjects[subject] = append(versions, s)
+	if !ok {
+		r.ids[identity(format, definition)] = id
+		r.byID[id] = s
+	}
+	return copyOf(s), nil
+}
+
+func (r *Registry) Lookup(ctx context.Context, subject string, format schema.Format, definition string) (*schema.Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if s := find(r.subjects[subject], format, definition); s != nil {
+		return copyOf(s), nil
+	}
+	return nil, schema.ErrNotFound("definition in subject "+subject, nil)
+}
+
+func (r *Registry) GetByID(ctx context.Context, id int) (*schema.Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s, ok := r.byID[id]
+	if !ok {
+		return nil, schema.ErrNotFound(fmt.Sprintf("id %d", id), nil)
+	}
+	return copyOf(s), nil
+}
+
+func (r *Registry) GetLatest(ctx context.Context, subject string) (*schema.Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	versions := r.subjects[subject]
+	if len(versions) == 0 {
+		return nil, schema.ErrNotFound("subject "+subject, nil)
+	}
+	return copyOf(versions[len(versions)-1]), nil
+}
+
+func (r *Registry) GetVersion(ctx context.Context, subject string, version int) (*schema.Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	versions := r.subjects[subject]
+	if version < 1 || version > len(versions) {
+		return nil, schema.ErrNotFound(fmt.Sprintf("subject %s version %d", subject, version), nil)
+	}
+	return copyOf(versions[version-1]), nil
+}
+
+func (r *Registry) Subjects(ctx context.Context) ([]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.sortedSubjects(), nil
+}
+
+func (r *Registry) Versions(ctx context.Context, subject string) ([]int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	versions := r.subjects[subject]
+	if len(versions) == 0 {
+		return nil, schema.ErrNotFound("subject "+subject, nil)
+	}
+	out := make([]int, len(versions))
+	for i, s := range versions {
+		out[i] = s.Version
+	}
+	return out, nil
+}
+
+func (r *Registry) SetCompatibility(ctx context.Context, subject string, level schema.Compatibility) error {
+	if !level.Valid() {
+		return errors.InvalidArgument("unknown compatibility level "+string(level), nil)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.levels[subject] = level
+	return nil
+}
+
+func (r *Registry) GetCompatibility(ctx context.Context, subject string) (schema.Compatibility, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.level(subject), nil
+}
+
+func (r *Registry) Close() error {
+	return nil
+}
+
+func (r *Registry) level(subject string) schema.Compatibility {
+	if level, ok := r.levels[subject]; ok {
+		return level
+	}
+	return r.config.DefaultCompatibility
+}
+
+func (r *Registry) sortedSubjects() []string {
+	subjects := make([]string, 0, len(r.subjects))
+	for subject := range r.subjects {
+		subjects = append(subjects, subject)
+	}
+	sort.Strings(subjects)
+	return subjects
+}
+
+func find(versions []*schema.Schema, format schema.Format, definition string) *schema.Schema {
+	for _, s := range versions {
+		if s.Format == format && s.Definition == definition {
+			return s
+		}
+	}
+	return nil
+}
+
+func identity(format schema.Format, definition string) string {
+	return string(format) + "\x00" + definition
+}
+
+func copyOf(s *schema.Schema) *schema.Schema {
+	c := *s
+	return &c
+}
+
+var _ schema.Registry = (*Registry)(nil)
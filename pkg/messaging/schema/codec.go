@@ -0,0 +1,138 @@
+package schema
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/data/bigdata/formats/avro"
+)
+
+// Codec converts values of type T to and from payloads written with its
+// schema.
+type Codec[T any] interface {
+	// Format returns the language of the codec's schema.
+	Format() Format
+
+	// Definition returns the schema values are written with.
+	Definition() string
+
+	// Marshal encodes v.
+	Marshal(v T) ([]byte, error)
+
+	// Unmarshal decodes data that was written with the writer schema into v.
+	Unmarshal(data []byte, writer *Schema, v *T) error
+}
+
+// JSONCodec encodes values as JSON validated against a JSON Schema, both
+// when they are written and when they are read.
+type JSONCodec[T any] struct {
+	definition string
+	schema     *jsonSchema
+}
+
+// NewJSONCodec returns a codec for the JSON Schema definition.
+func NewJSONCodec[T any](definition string) (*JSONCodec[T], error) {
+	s, err := parseJSONSchema(definition)
+	if err != nil {
+		return nil, ErrInvalid(err)
+	}
+	return &JSONCodec[T]{definition: definition, schema: s}, nil
+}
+
+func (c *JSONCodec[T]) Format() Format     { return FormatJSON }
+func (c *JSONCodec[T]) Definition() string { return c.definition }
+
+func (c *JSONCodec[T]) Marshal(v T) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, ErrInvalidPayload(err)
+	}
+	if err := c.validate(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (c *JSONCodec[T]) Unmarshal(data []byte, writer *Schema, v *T) error {
+	if err := c.validate(data); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return ErrInvalidPayload(err)
+	}
+	return nil
+}
+
+func (c *JSONCodec[T]) validate(data []byte) error {
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return ErrInvalidPayload(err)
+	}
+	if err := c.schema.validate(doc, ""); err != nil {
+		return ErrInvalidPayload(err)
+	}
+	return nil
+}
+
+// AvroCodec encodes values as Avro binary. Payloads written with an older or
+// newer version of the schema are resolved against the codec's schema.
+type AvroCodec[T any] struct {
+	definition string
+	codec      *avro.Codec
+
+	mu       sync.Mutex
+	resolved map[string]*avro.Codec
+}
+
+// NewAvroCodec returns a codec for the Avro schema definition.
+func NewAvroCodec[T any](definition string) (*AvroCodec[T], error) {
+	codec, err := avro.NewCodec(definition)
+	if err != nil {
+		return nil, ErrInvalid(err)
+	}
+	return &AvroCodec[T]{
+		definition: definition,
+		codec:      codec,
+		resolved:   make(map[string]*avro.Codec),
+	}, nil
+}
+
+func (c *AvroCodec[T]) Format() Format     { return FormatAvro }
+func (c *AvroCodec[T]) Definition() string { return c.definition }
+
+func (c *AvroCodec[T]) Marshal(v T) ([]byte, error) {
+	data, err := c.codec.Marshal(v)
+	if err != nil {
+		return nil, ErrInvalidPayload(err)
+	}
+	return data, nil
+}
+
+func (c *AvroCodec[T]) Unmarshal(data []byte, writer *Schema, v *T) error {
+	codec := c.codec
+	if writer != nil && writer.Definition != c.definition {
+		var err error
+		if codec, err = c.resolve(writer.Definition); err != nil {
+			return err
+		}
+	}
+	if err := codec.Unmarshal(data, v); err != nil {
+		return ErrInvalidPayload(err)
+	}
+	return nil
+}
+
+func (c *AvroCodec[T]) resolve(writer string) (*avro.Codec, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if codec, ok := c.resolved[writer]; ok {
+		return codec, nil
+	}
+	codec, err := c.codec.ResolveFrom(writer)
+	if err != nil {
+		return nil, ErrInvalidPayload(err)
+	}
+	c.resolved[writer] = codec
+	return codec, nil
+}
@@ -0,0 +1,105 @@
+package schema
+
+import (
+	"fmt"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/data/bigdata/formats/avro"
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+)
+
+// Validate returns an error if definition is not a valid schema of format.
+func Validate(format Format, definition string) error {
+	var err error
+	switch format {
+	case FormatAvro:
+		_, err = avro.NewCodec(definition)
+	case FormatJSON:
+		_, err = parseJSONSchema(definition)
+	case FormatProtobuf:
+		_, err = parseProtobufSchema(definition)
+	default:
+		return errors.InvalidArgument("unknown schema format "+string(format), nil)
+	}
+	if err != nil {
+		return ErrInvalid(err)
+	}
+	return nil
+}
+
+// CheckCompatibility returns an error if a new definition violates level
+// against previous, the versions already registered under a subject, ordered
+// oldest first. The non-transitive levels only check the newest version.
+func CheckCompatibility(level Compatibility, format Format, definition string, previous []*Schema) error {
+	var backward, forward, transitive bool
+	switch level {
+	case CompatibilityNone:
+		return nil
+	case CompatibilityBackward:
+		backward = true
+	case CompatibilityBackwardTransitive:
+		backward, transitive = true, true
+	case CompatibilityForward:
+		forward = true
+	case CompatibilityForwardTransitive:
+		forward, transitive = true, true
+	case CompatibilityFull:
+		backward, forward = true, true
+	case CompatibilityFullTransitive:
+		backward, forward, transitive = true, true, true
+	default:
+		return errors.InvalidArgument("unknown compatibility level "+string(level), nil)
+	}
+
+	against := previous
+	if !transitive && len(previous) > 0 {
+		against = previous[len(previous)-1:]
+	}
+	for i := len(against) - 1; i >= 0; i-- {
+		old := against[i]
+		if old.Format != format {
+			return fmt.Errorf("version %d is %s, not %s", old.Version, old.Format, format)
+		}
+		if backward {
+			if err := readable(format, definition, old.Definition); err != nil {
+				return fmt.Errorf("cannot read data written with version %d: %w", old.Version, err)
+			}
+		}
+		if forward {
+			if err := readable(format, old.Definition, definition); err != nil {
+				return fmt.Errorf("version %d cannot read data written with the new schema: %w", old.Version, err)
+			}
+		}
+	}
+	return nil
+}
+
+// readable returns an error if data written with the writer schema cannot be
+// read with the reader schema.
+func readable(format Format, reader, writer string) error {
+	switch format {
+	case FormatAvro:
+		return avro.Compatible(reader, writer)
+	case FormatJSON:
+		r, err := parseJSONSchema(reader)
+		if err != nil {
+			return err
+		}
+		w, err := parseJSONSchema(writer)
+		if err != nil {
+			return err
+		}
+		return jsonCompatible(r, w, "")
+	case FormatProtobuf:
+		r, err := parseProtobufSchema(reader)
+		if err != nil {
+			return err
+		}
+		w, err := parseProtobufSchema(writer)
+		if err != nil {
+			return err
+		}
+		return protobufCompatible(r, w)
+	default:
+		return errors.InvalidArgument("unknown schema format "+string(format), nil)
+	}
+}
@@ -0,0 +1,35 @@
+/*
+Package schema adds registered schemas and typed payloads to messaging.
+
+A Registry stores schema versions by subject and rejects a new version that
+breaks the subject's Compatibility rule, so a producer cannot silently change
+its payloads in a way downstream consumers cannot read. Schemas are written in
+Avro, JSON Schema or Protobuf.
+
+Producer[T] registers its codec's schema on creation and publishes values in
+the Confluent wire format: a zero byte, the 4-byte schema ID, then the
+encoded value. The ID is also set in the x-schema-id header. Consumer[T]
+looks up the schema each payload was written with and decodes it, resolving
+Avro payloads written with other versions of the schema.
+
+# Registries
+
+  - adapters/memory: in-process, for tests and local development
+  - adapters/file: persisted to a JSON file
+
+# Usage
+
+	registry := memory.New(memory.Config{})
+
+	codec, err := schema.NewAvroCodec[Order](orderSchema)
+	producer, err := broker.Producer("orders")
+	orders, err := schema.NewProducer(ctx, producer, registry, "orders", codec, schema.ProducerConfig{})
+	err = orders.Publish(ctx, []byte(order.ID), order)
+
+	consumer, err := broker.Consumer("orders", "billing")
+	err = schema.NewConsumer(consumer, registry, codec).Consume(ctx,
+		func(ctx context.Context, msg *messaging.Message, order Order) error {
+			return bill(ctx, order)
+		})
+*/
+package schema
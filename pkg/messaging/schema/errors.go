@@ -0,0 +1,33 @@
+package schema
+
+import "github.com/chris-alexander-pop/system-design-library/pkg/errors"
+
+// Error codes for schema operations.
+const (
+	CodeNotFound       = "SCHEMA_NOT_FOUND"
+	CodeInvalid        = "SCHEMA_INVALID"
+	CodeIncompatible   = "SCHEMA_INCOMPATIBLE"
+	CodeInvalidPayload = "SCHEMA_INVALID_PAYLOAD"
+)
+
+// ErrNotFound creates an error for a missing subject, version or schema ID.
+func ErrNotFound(what string, err error) *errors.AppError {
+	return errors.New(CodeNotFound, "schema not found: "+what, err)
+}
+
+// ErrInvalid creates an error for a schema that cannot be parsed.
+func ErrInvalid(err error) *errors.AppError {
+	return errors.New(CodeInvalid, "invalid schema", err)
+}
+
+// ErrIncompatible creates an error for a schema that violates the
+// compatibility rule of its subject.
+func ErrIncompatible(subject string, err error) *errors.AppError {
+	return errors.New(CodeIncompatible, "schema is incompatible with subject "+subject, err)
+}
+
+// ErrInvalidPayload creates an error for a payload that does not match its
+// schema or the wire format.
+func ErrInvalidPayload(err error) *errors.AppError {
+	return errors.New(CodeInvalidPayload, "payload does not match schema", err)
+}
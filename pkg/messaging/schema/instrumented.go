@@ -0,0 +1,130 @@
+package schema
+
+import (
+	"context"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentedRegistry wraps a Registry with logging and tracing.
+type InstrumentedRegistry struct {
+	next   Registry
+	tracer trace.Tracer
+}
+
+// NewInstrumentedRegistry creates a new InstrumentedRegistry wrapping the given registry.
+func NewInstrumentedRegistry(next Registry) *InstrumentedRegistry {
+	return &InstrumentedRegistry{
+		next:   next,
+		tracer: instrument.NewTracer("pkg/messaging/schema"),
+	}
+}
+
+func (r *InstrumentedRegistry) Register(ctx context.Context, subject string, format Format, definition string) (*Schema, error) {
+	ctx, span := r.tracer.Start(ctx, "schema.Register", trace.WithAttributes(
+		attribute.String("schema.subject", subject),
+		attribute.String("schema.format", string(format)),
+	))
+	defer span.End()
+
+	s, err := r.next.Register(ctx, subject, format, definition)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		logger.L().ErrorContext(ctx, "failed to register schema", "subject", subject, "error", err)
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("schema.id", s.ID), attribute.Int("schema.version", s.Version))
+	span.SetStatus(codes.Ok, "schema registered")
+	return s, nil
+}
+
+func (r *InstrumentedRegistry) Lookup(ctx context.Context, subject string, format Format, definition string) (*Schema, error) {
+	ctx, span := r.tracer.Start(ctx, "schema.Lookup", trace.WithAttributes(
+		attribute.String("schema.subject", subject),
+	))
+	defer span.End()
+
+	s, err := r.next.Lookup(ctx, subject, format, definition)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	return s, nil
+}
+
+func (r *InstrumentedRegistry) GetByID(ctx context.Context, id int) (*Schema, error) {
+	ctx, span := r.tracer.Start(ctx, "schema.GetByID", trace.WithAttributes(
+		attribute.Int("schema.id", id),
+	))
+	defer span.End()
+
+	s, err := r.next.GetByID(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	return s, nil
+}
+
+func (r *InstrumentedRegistry) GetLatest(ctx context.Context, subject string) (*Schema, error) {
+	ctx, span := r.tracer.Start(ctx, "schema.GetLatest", trace.WithAttributes(
+		attribute.String("schema.subject", subject),
+	))
+	defer span.End()
+
+	s, err := r.next.GetLatest(ctx, subject)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	return s, nil
+}
+
+func (r *InstrumentedRegistry) GetVersion(ctx context.Context, subject string, version int) (*Schema, error) {
+	ctx, span := r.tracer.Start(ctx, "schema.GetVersion", trace.WithAttributes(
+		attribute.String("schema.subject", subject),
+		attribute.Int("schema.version", version),
+	))
+	defer span.End()
+
+	s, err := r.next.GetVersion(ctx, subject, version)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	return s, nil
+}
+
+func (r *InstrumentedRegistry) Subjects(ctx context.Context) ([]string, error) {
+	return r.next.Subjects(ctx)
+}
+
+func (r *InstrumentedRegistry) Versions(ctx context.Context, subject string) ([]int, error) {
+	return r.next.Versions(ctx, subject)
+}
+
+func (r *InstrumentedRegistry) SetCompatibility(ctx context.Context, subject string, level Compatibility) error {
+	logger.L().InfoContext(ctx, "setting schema compatibility", "subject", subject, "level", level)
+	return r.next.SetCompatibility(ctx, subject, level)
+}
+
+func (r *InstrumentedRegistry) GetCompatibility(ctx context.Context, subject string) (Compatibility, error) {
+	return r.next.GetCompatibility(ctx, subject)
+}
+
+func (r *InstrumentedRegistry) Close() error {
+	logger.L().Info("closing schema registry")
+	return r.next.Close()
+}
+
+var _ Registry = (*InstrumentedRegistry)(nil)
@@ -0,0 +1,279 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"unicode/utf8"
+)
+
+// jsonSchema is the subset of JSON Schema (draft-07) that is validated and
+// compared: type, enum, properties, required, additionalProperties, items,
+// minimum, maximum, minLength and maxLength. Other keywords are ignored.
+type jsonSchema struct {
+	Type                 jsonTypes              `json:"type,omitempty"`
+	Enum                 []interface{}          `json:"enum,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *jsonSchema            `json:"additionalProperties,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Maximum              *float64               `json:"maximum,omitempty"`
+	MinLength            *float64               `json:"minLength,omitempty"`
+	MaxLength            *float64               `json:"maxLength,omitempty"`
+
+	// never is set for the boolean schema false, which accepts no value.
+	never bool
+}
+
+func (s *jsonSchema) UnmarshalJSON(data []byte) error {
+	switch string(bytes.TrimSpace(data)) {
+	case "true":
+		*s = jsonSchema{}
+		return nil
+	case "false":
+		*s = jsonSchema{never: true}
+		return nil
+	}
+	type plain jsonSchema
+	return json.Unmarshal(data, (*plain)(s))
+}
+
+// jsonTypes is the type keyword, which is either a name or a list of names.
+type jsonTypes []string
+
+func (t *jsonTypes) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*t = jsonTypes{name}
+		return nil
+	}
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return fmt.Errorf("type must be a string or an array of strings")
+	}
+	*t = names
+	return nil
+}
+
+// allows reports whether values of type name are allowed. An integer is
+// also a number.
+func (t jsonTypes) allows(name string) bool {
+	if len(t) == 0 {
+		return true
+	}
+	return slices.Contains(t, name) || (name == "integer" && slices.Contains(t, "number"))
+}
+
+func parseJSONSchema(definition string) (*jsonSchema, error) {
+	var s jsonSchema
+	if err := json.Unmarshal([]byte(definition), &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// validate returns an error if v, as decoded by encoding/json into an
+// interface{}, does not match the schema.
+func (s *jsonSchema) validate(v interface{}, path string) error {
+	if s.never {
+		return fmt.Errorf("%s: no value is allowed", pathName(path))
+	}
+	name := jsonTypeOf(v)
+	if !s.Type.allows(name) {
+		return fmt.Errorf("%s: expected %v, got %s", pathName(path), []string(s.Type), name)
+	}
+	if s.Enum != nil && !slices.ContainsFunc(s.Enum, func(e interface{}) bool { return reflect.DeepEqual(e, v) }) {
+		return fmt.Errorf("%s: value is not one of %v", pathName(path), s.Enum)
+	}
+
+	switch v := v.(type) {
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			return fmt.Errorf("%s: %v is less than %v", pathName(path), v, *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			return fmt.Errorf("%s: %v is greater than %v", pathName(path), v, *s.Maximum)
+		}
+	case string:
+		n := float64(utf8.RuneCountInString(v))
+		if s.MinLength != nil && n < *s.MinLength {
+			return fmt.Errorf("%s: shorter than %v characters", pathName(path), *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			return fmt.Errorf("%s: longer than %v characters", pathName(path), *s.MaxLength)
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				return fmt.Errorf("%s: missing required property %q", pathName(path), name)
+			}
+		}
+		for name, value := range v {
+			prop := s.Properties[name]
+			if prop == nil {
+				prop = s.AdditionalProperties
+			}
+			if prop == nil {
+				continue
+			}
+			if err := prop.validate(value, path+"/"+name); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				if err := s.Items.validate(item, fmt.Sprintf("%s/%d", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// jsonCompatible returns an error if a value valid under writer may be
+// invalid under reader. Properties an open writer schema does not declare are
+// assumed not to clash with properties the reader declares, so adding an
+// optional property is compatible in both directions.
+func jsonCompatible(reader, writer *jsonSchema, path string) error {
+	if writer.never || unconstrained(reader) {
+		return nil
+	}
+	if reader.never {
+		return fmt.Errorf("%s: the reader accepts no value", pathName(path))
+	}
+
+	if len(reader.Type) > 0 {
+		if len(writer.Type) == 0 {
+			return fmt.Errorf("%s: the writer allows any type, the reader only %v", pathName(path), []string(reader.Type))
+		}
+		for _, name := range writer.Type {
+			if !reader.Type.allows(name) {
+				return fmt.Errorf("%s: type %s is not allowed by the reader", pathName(path), name)
+			}
+		}
+	}
+	if reader.Enum != nil {
+		if writer.Enum == nil {
+			return fmt.Errorf("%s: the reader restricts values to %v", pathName(path), reader.Enum)
+		}
+		for _, e := range writer.Enum {
+			if !slices.ContainsFunc(reader.Enum, func(r interface{}) bool { return reflect.DeepEqual(r, e) }) {
+				return fmt.Errorf("%s: value %v is not allowed by the reader", pathName(path), e)
+			}
+		}
+	}
+
+	if writer.Type.allows("integer") {
+		if err := boundCompatible(path, "minimum", reader.Minimum, writer.Minimum, false); err != nil {
+			return err
+		}
+		if err := boundCompatible(path, "maximum", reader.Maximum, writer.Maximum, true); err != nil {
+			return err
+		}
+	}
+	if writer.Type.allows("string") {
+		if err := boundCompatible(path, "minLength", reader.MinLength, writer.MinLength, false); err != nil {
+			return err
+		}
+		if err := boundCompatible(path, "maxLength", reader.MaxLength, writer.MaxLength, true); err != nil {
+			return err
+		}
+	}
+
+	if writer.Type.allows("object") {
+		for _, name := range reader.Required {
+			if !slices.Contains(writer.Required, name) {
+				return fmt.Errorf("%s: property %q is required by the reader but optional for the writer", pathName(path), name)
+			}
+		}
+		for name, rp := range reader.Properties {
+			wp := writer.Properties[name]
+			if wp == nil {
+				wp = writer.AdditionalProperties
+			}
+			if wp == nil {
+				continue
+			}
+			if err := jsonCompatible(rp, wp, path+"/"+name); err != nil {
+				return err
+			}
+		}
+		for name, wp := range writer.Properties {
+			if reader.Properties[name] != nil || unconstrained(reader.AdditionalProperties) {
+				continue
+			}
+			if err := jsonCompatible(reader.AdditionalProperties, wp, path+"/"+name); err != nil {
+				return err
+			}
+		}
+		if !unconstrained(reader.AdditionalProperties) {
+			if writer.AdditionalProperties == nil {
+				return fmt.Errorf("%s: the writer allows additional properties the reader restricts", pathName(path))
+			}
+			if err := jsonCompatible(reader.AdditionalProperties, writer.AdditionalProperties, path); err != nil {
+				return err
+			}
+		}
+	}
+
+	if writer.Type.allows("array") && reader.Items != nil {
+		if writer.Items == nil {
+			return fmt.Errorf("%s: the writer allows any items, the reader restricts them", pathName(path))
+		}
+		if err := jsonCompatible(reader.Items, writer.Items, path+"/items"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// boundCompatible checks that the writer's bound is at least as tight as the
+// reader's. upper selects whether the bound is a maximum.
+func boundCompatible(path, keyword string, reader, writer *float64, upper bool) error {
+	if reader == nil {
+		return nil
+	}
+	if writer == nil || (upper && *writer > *reader) || (!upper && *writer < *reader) {
+		return fmt.Errorf("%s: the reader narrows %s to %v", pathName(path), keyword, *reader)
+	}
+	return nil
+}
+
+// unconstrained reports whether s accepts every value, like an absent schema
+// or the boolean schema true.
+func unconstrained(s *jsonSchema) bool {
+	return s == nil || reflect.DeepEqual(*s, jsonSchema{})
+}
+
+func jsonTypeOf(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func pathName(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return path
+}
@@ -0,0 +1,179 @@
+package schema
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Protobuf schemas are the base64 encoding of a serialized
+// FileDescriptorProto, a form the Confluent registry also accepts in place of
+// .proto source.
+
+// ProtobufDefinition returns the schema definition of the file declaring
+// desc.
+func ProtobufDefinition(desc protoreflect.MessageDescriptor) (string, error) {
+	fd := protodesc.ToFileDescriptorProto(desc.ParentFile())
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(fd)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+func parseProtobufSchema(definition string) (*descriptorpb.FileDescriptorProto, error) {
+	data, err := base64.StdEncoding.DecodeString(definition)
+	if err != nil {
+		return nil, fmt.Errorf("protobuf schema is not base64: %w", err)
+	}
+	var fd descriptorpb.FileDescriptorProto
+	if err := proto.Unmarshal(data, &fd); err != nil {
+		return nil, err
+	}
+	return &fd, nil
+}
+
+// ProtobufCodec encodes protobuf messages of type T. Payloads start with the
+// Confluent message index list that locates T in its file.
+type ProtobufCodec[T proto.Message] struct {
+	definition string
+	indexes    []int
+}
+
+// NewProtobufCodec returns a codec for the generated message type T.
+func NewProtobufCodec[T proto.Message]() (*ProtobufCodec[T], error) {
+	var zero T
+	desc := zero.ProtoReflect().Descriptor()
+	definition, err := ProtobufDefinition(desc)
+	if err != nil {
+		return nil, ErrInvalid(err)
+	}
+	return &ProtobufCodec[T]{definition: definition, indexes: messageIndexes(desc)}, nil
+}
+
+func (c *ProtobufCodec[T]) Format() Format     { return FormatProtobuf }
+func (c *ProtobufCodec[T]) Definition() string { return c.definition }
+
+func (c *ProtobufCodec[T]) Marshal(v T) ([]byte, error) {
+	var out []byte
+	if len(c.indexes) == 1 && c.indexes[0] == 0 {
+		// The common case of the first message in the file is a single zero.
+		out = []byte{0}
+	} else {
+		out = protowire.AppendVarint(nil, protowire.EncodeZigZag(int64(len(c.indexes))))
+		for _, i := range c.indexes {
+			out = protowire.AppendVarint(out, protowire.EncodeZigZag(int64(i)))
+		}
+	}
+	return proto.MarshalOptions{}.MarshalAppend(out, v)
+}
+
+func (c *ProtobufCodec[T]) Unmarshal(data []byte, writer *Schema, v *T) error {
+	count, n := protowire.ConsumeVarint(data)
+	if n < 0 {
+		return ErrInvalidPayload(protowire.ParseError(n))
+	}
+	data = data[n:]
+	for i := int64(0); i < protowire.DecodeZigZag(count); i++ {
+		if _, n = protowire.ConsumeVarint(data); n < 0 {
+			return ErrInvalidPayload(protowire.ParseError(n))
+		}
+		data = data[n:]
+	}
+
+	var zero T
+	msg := zero.ProtoReflect().Type().New().Interface().(T)
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return ErrInvalidPayload(err)
+	}
+	*v = msg
+	return nil
+}
+
+// messageIndexes returns the path of desc through the messages of its file.
+func messageIndexes(desc protoreflect.MessageDescriptor) []int {
+	var indexes []int
+	for d := protoreflect.Descriptor(desc); ; d = d.Parent() {
+		if _, ok := d.(protoreflect.FileDescriptor); ok {
+			break
+		}
+		indexes = append([]int{d.Index()}, indexes...)
+	}
+	return indexes
+}
+
+// protobufCompatible returns an error if messages written with the writer
+// file cannot be read with the reader file. Every message of the writer must
+// still exist, and fields with the same number must keep a wire-compatible
+// type and cardinality. Added and removed fields are compatible.
+func protobufCompatible(reader, writer *descriptorpb.FileDescriptorProto) error {
+	readerMessages := protobufMessages(reader)
+	for name, wm := range protobufMessages(writer) {
+		rm, ok := readerMessages[name]
+		if !ok {
+			return fmt.Errorf("message %s was removed", name)
+		}
+		readerFields := make(map[int32]*descriptorpb.FieldDescriptorProto, len(rm.GetField()))
+		for _, f := range rm.GetField() {
+			readerFields[f.GetNumber()] = f
+		}
+		for _, wf := range wm.GetField() {
+			rf, ok := readerFields[wf.GetNumber()]
+			if !ok {
+				continue
+			}
+			if (rf.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED) != (wf.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED) {
+				return fmt.Errorf("field %d of %s changed between singular and repeated", wf.GetNumber(), name)
+			}
+			if wireGroup(rf.GetType()) != wireGroup(wf.GetType()) || rf.GetTypeName() != wf.GetTypeName() {
+				return fmt.Errorf("field %d of %s changed type from %s to %s", wf.GetNumber(), name, wf.GetType(), rf.GetType())
+			}
+		}
+	}
+	return nil
+}
+
+// protobufMessages indexes the messages of a file, including nested ones, by
+// their fully qualified name.
+func protobufMessages(fd *descriptorpb.FileDescriptorProto) map[string]*descriptorpb.DescriptorProto {
+	messages := make(map[string]*descriptorpb.DescriptorProto)
+	var walk func(prefix string, ms []*descriptorpb.DescriptorProto)
+	walk = func(prefix string, ms []*descriptorpb.DescriptorProto) {
+		for _, m := range ms {
+			name := prefix + "." + m.GetName()
+			messages[name] = m
+			walk(name, m.GetNestedType())
+		}
+	}
+	prefix := ""
+	if fd.GetPackage() != "" {
+		prefix = "." + fd.GetPackage()
+	}
+	walk(prefix, fd.GetMessageType())
+	return messages
+}
+
+// wireGroup groups the field types that share an encoding and may replace one
+// another.
+func wireGroup(t descriptorpb.FieldDescriptorProto_Type) descriptorpb.FieldDescriptorProto_Type {
+	switch t {
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64, descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_UINT64, descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		return descriptorpb.FieldDescriptorProto_TYPE_INT32
+	case descriptorpb.FieldDescriptorProto_TYPE_SINT64:
+		return descriptorpb.FieldDescriptorProto_TYPE_SINT32
+	case descriptorpb.FieldDescriptorProto_TYPE_SFIXED32:
+		return descriptorpb.FieldDescriptorProto_TYPE_FIXED32
+	case descriptorpb.FieldDescriptorProto_TYPE_SFIXED64:
+		return descriptorpb.FieldDescriptorProto_TYPE_FIXED64
+	case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		return descriptorpb.FieldDescriptorProto_TYPE_STRING
+	default:
+		return t
+	}
+}
@@ -0,0 +1,121 @@
+package schema
+
+import (
+	"context"
+)
+
+// Format identifies the language a schema is written in. The values match the
+// schemaType field of the Confluent Schema Registry API.
+type Format string
+
+const (
+	FormatAvro     Format = "AVRO"
+	FormatJSON     Format = "JSON"
+	FormatProtobuf Format = "PROTOBUF"
+)
+
+// Compatibility is the rule a new schema version must satisfy against the
+// versions already registered under its subject.
+type Compatibility string
+
+const (
+	// CompatibilityNone accepts every schema.
+	CompatibilityNone Compatibility = "NONE"
+
+	// CompatibilityBackward requires that consumers using the new schema can
+	// read data written with the latest registered one.
+	CompatibilityBackward Compatibility = "BACKWARD"
+
+	// CompatibilityBackwardTransitive is Backward against every registered
+	// version.
+	CompatibilityBackwardTransitive Compatibility = "BACKWARD_TRANSITIVE"
+
+	// CompatibilityForward requires that consumers using the latest
+	// registered schema can read data written with the new one.
+	CompatibilityForward Compatibility = "FORWARD"
+
+	// CompatibilityForwardTransitive is Forward against every registered
+	// version.
+	CompatibilityForwardTransitive Compatibility = "FORWARD_TRANSITIVE"
+
+	// CompatibilityFull is both Backward and Forward.
+	CompatibilityFull Compatibility = "FULL"
+
+	// CompatibilityFullTransitive is both Backward and Forward against every
+	// registered version.
+	CompatibilityFullTransitive Compatibility = "FULL_TRANSITIVE"
+)
+
+// Valid reports whether c is one of the defined levels.
+func (c Compatibility) Valid() bool {
+	switch c {
+	case CompatibilityNone, CompatibilityBackward, CompatibilityBackwardTransitive,
+		CompatibilityForward, CompatibilityForwardTransitive,
+		CompatibilityFull, CompatibilityFullTransitive:
+		return true
+	}
+	return false
+}
+
+// Schema is a registered schema version.
+type Schema struct {
+	// ID identifies the schema across all subjects. Identical definitions
+	// registered under different subjects share an ID.
+	ID int `json:"id"`
+
+	// Subject is the name the schema is registered under.
+	Subject string `json:"subject"`
+
+	// Version is the 1-based version of the schema within its subject.
+	Version int `json:"version"`
+
+	// Format is the schema language.
+	Format Format `json:"schemaType"`
+
+	// Definition is the schema itself.
+	Definition string `json:"schema"`
+}
+
+// Registry stores schemas by subject and enforces compatibility between the
+// versions of a subject.
+type Registry interface {
+	// Register adds definition as the next version of subject and returns it.
+	// Registering a definition the subject already has returns the existing
+	// version. It fails with CodeIncompatible if the definition breaks the
+	// subject's compatibility rule.
+	Register(ctx context.Context, subject string, format Format, definition string) (*Schema, error)
+
+	// Lookup returns the version of subject with the given definition.
+	Lookup(ctx context.Context, subject string, format Format, definition string) (*Schema, error)
+
+	// GetByID returns a schema by its global ID.
+	GetByID(ctx context.Context, id int) (*Schema, error)
+
+	// GetLatest returns the newest version of subject.
+	GetLatest(ctx context.Context, subject string) (*Schema, error)
+
+	// GetVersion returns a specific version of subject.
+	GetVersion(ctx context.Context, subject string, version int) (*Schema, error)
+
+	// Subjects lists all subjects.
+	Subjects(ctx context.Context) ([]string, error)
+
+	// Versions lists the versions of subject in ascending order.
+	Versions(ctx context.Context, subject string) ([]int, error)
+
+	// SetCompatibility sets the compatibility rule of subject.
+	SetCompatibility(ctx context.Context, subject string, level Compatibility) error
+
+	// GetCompatibility returns the compatibility rule of subject, falling back
+	// to the registry default.
+	GetCompatibility(ctx context.Context, subject string) (Compatibility, error)
+
+	// Close releases the registry's resources.
+	Close() error
+}
+
+// SubjectName returns the subject for the values of topic, following the
+// Confluent TopicNameStrategy.
+func SubjectName(topic string) string {
+	return topic + "-value"
+}
@@ -0,0 +1,341 @@
+package schema_test
+
+import (
+	"context"
+	"encoding/base64"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/chris-alexander-pop/system-design-library/pkg/messaging"
+	brokermemory "github.com/chris-alexander-pop/system-design-library/pkg/messaging/adapters/memory"
+	"github.com/chris-alexander-pop/system-design-library/pkg/messaging/schema"
+	"github.com/chris-alexander-pop/system-design-library/pkg/messaging/schema/adapters/file"
+	"github.com/chris-alexander-pop/system-design-library/pkg/messaging/schema/adapters/memory"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const orderV1 = `{
+	"type": "record", "name": "Order",
+	"fields": [
+		{"name": "id", "type": "string"},
+		{"name": "amount", "type": "long"}
+	]
+}`
+
+const orderV2 = `{
+	"type": "record", "name": "Order",
+	"fields": [
+		{"name": "id", "type": "string"},
+		{"name": "amount", "type": "long"},
+		{"name": "currency", "type": "string", "default": "EUR"}
+	]
+}`
+
+const orderV3 = `{
+	"type": "record", "name": "Order",
+	"fields": [
+		{"name": "id", "type": "string"},
+		{"name": "amount", "type": "long"},
+		{"name": "customer", "type": "string"}
+	]
+}`
+
+type OrderV1 struct {
+	ID     string `avro:"id" json:"id"`
+	Amount int64  `avro:"amount" json:"amount"`
+}
+
+type OrderV2 struct {
+	ID       string `avro:"id"`
+	Amount   int64  `avro:"amount"`
+	Currency string `avro:"currency"`
+}
+
+func code(err error) string {
+	if appErr, ok := err.(*errors.AppError); ok {
+		return appErr.Code
+	}
+	return ""
+}
+
+func TestRegistryEnforcesCompatibility(t *testing.T) {
+	ctx := context.Background()
+	registry := memory.New(memory.Config{})
+
+	v1, err := registry.Register(ctx, "orders-value", schema.FormatAvro, orderV1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := registry.Register(ctx, "orders-value", schema.FormatAvro, orderV1)
+	if err != nil || again.ID != v1.ID || again.Version != 1 {
+		t.Fatalf("re-registering should return version 1, got %+v (%v)", again, err)
+	}
+
+	v2, err := registry.Register(ctx, "orders-value", schema.FormatAvro, orderV2)
+	if err != nil {
+		t.Fatalf("adding a field with a default is backward compatible: %v", err)
+	}
+	if v2.Version != 2 || v2.ID == v1.ID {
+		t.Errorf("unexpected version %+v", v2)
+	}
+
+	_, err = registry.Register(ctx, "orders-value", schema.FormatAvro, orderV3)
+	if code(err) != schema.CodeIncompatible {
+		t.Fatalf("adding a field without a default must be rejected, got %v", err)
+	}
+
+	if err := registry.SetCompatibility(ctx, "orders-value", schema.CompatibilityNone); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.Register(ctx, "orders-value", schema.FormatAvro, orderV3); err != nil {
+		t.Errorf("NONE accepts any schema: %v", err)
+	}
+
+	// The same definition under another subject shares its ID.
+	other, err := registry.Register(ctx, "archive-value", schema.FormatAvro, orderV1)
+	if err != nil || other.ID != v1.ID {
+		t.Errorf("expected shared ID %d, got %+v (%v)", v1.ID, other, err)
+	}
+
+	if _, err := registry.Register(ctx, "bad", schema.FormatAvro, `{"type": "nope"}`); code(err) != schema.CodeInvalid {
+		t.Errorf("expected an invalid schema error, got %v", err)
+	}
+}
+
+func TestJSONSchemaCompatibility(t *testing.T) {
+	v1 := `{"type": "object", "properties": {"id": {"type": "string"}, "amount": {"type": "integer"}}, "required": ["id"]}`
+	tests := []struct {
+		name     string
+		level    schema.Compatibility
+		next     string
+		accepted bool
+	}{
+		{"optional property added", schema.CompatibilityFull,
+			`{"type": "object", "properties": {"id": {"type": "string"}, "amount": {"type": "integer"}, "note": {"type": "string"}}, "required": ["id"]}`, true},
+		{"required property added", schema.CompatibilityBackward,
+			`{"type": "object", "properties": {"id": {"type": "string"}, "amount": {"type": "integer"}, "note": {"type": "string"}}, "required": ["id", "note"]}`, false},
+		{"type widened", schema.CompatibilityBackward,
+			`{"type": "object", "properties": {"id": {"type": "string"}, "amount": {"type": "number"}}, "required": ["id"]}`, true},
+		{"type widened read by old consumers", schema.CompatibilityForward,
+			`{"type": "object", "properties": {"id": {"type": "string"}, "amount": {"type": "number"}}, "required": ["id"]}`, false},
+		{"closed content model", schema.CompatibilityBackward,
+			`{"type": "object", "properties": {"id": {"type": "string"}}, "required": ["id"], "additionalProperties": false}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			registry := memory.New(memory.Config{DefaultCompatibility: tt.level})
+			if _, err := registry.Register(ctx, "s", schema.FormatJSON, v1); err != nil {
+				t.Fatal(err)
+			}
+			_, err := registry.Register(ctx, "s", schema.FormatJSON, tt.next)
+			if tt.accepted && err != nil {
+				t.Errorf("expected the schema to be accepted: %v", err)
+			}
+			if !tt.accepted && code(err) != schema.CodeIncompatible {
+				t.Errorf("expected the schema to be rejected, got %v", err)
+			}
+		})
+	}
+}
+
+func TestProtobufCompatibility(t *testing.T) {
+	file := func(fieldType descriptorpb.FieldDescriptorProto_Type) string {
+		fd := &descriptorpb.FileDescriptorProto{
+			Name:    proto.String("order.proto"),
+			Package: proto.String("shop"),
+			MessageType: []*descriptorpb.DescriptorProto{{
+				Name: proto.String("Order"),
+				Field: []*descriptorpb.FieldDescriptorProto{{
+					Name:   proto.String("amount"),
+					Number: proto.Int32(1),
+					Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type:   fieldType.Enum(),
+				}},
+			}},
+		}
+		data, _ := proto.Marshal(fd)
+		return base64.StdEncoding.EncodeToString(data)
+	}
+
+	ctx := context.Background()
+	registry := memory.New(memory.Config{DefaultCompatibility: schema.CompatibilityFull})
+	if _, err := registry.Register(ctx, "s", schema.FormatProtobuf, file(descriptorpb.FieldDescriptorProto_TYPE_INT32)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.Register(ctx, "s", schema.FormatProtobuf, file(descriptorpb.FieldDescriptorProto_TYPE_INT64)); err != nil {
+		t.Errorf("int32 to int64 keeps the wire type: %v", err)
+	}
+	if _, err := registry.Register(ctx, "s", schema.FormatProtobuf, file(descriptorpb.FieldDescriptorProto_TYPE_STRING)); code(err) != schema.CodeIncompatible {
+		t.Errorf("int64 to string must be rejected, got %v", err)
+	}
+}
+
+func TestTypedProducerAndConsumer(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	broker := brokermemory.New(brokermemory.Config{})
+	defer broker.Close()
+	registry := memory.New(memory.Config{})
+
+	// The consumer already uses v2 while the producer still writes v1.
+	writerCodec, err := schema.NewAvroCodec[OrderV1](orderV1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readerCodec, err := schema.NewAvroCodec[OrderV2](orderV2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := broker.Producer("orders")
+	producer, err := schema.NewProducer(ctx, p, registry, "orders", writerCodec, schema.ProducerConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer producer.Close()
+	if _, err := registry.Register(ctx, schema.SubjectName("orders"), schema.FormatAvro, orderV2); err != nil {
+		t.Fatal(err)
+	}
+
+	// A producer with a breaking schema never starts.
+	breakingCodec, _ := schema.NewAvroCodec[OrderV1](orderV3)
+	if _, err := schema.NewProducer(ctx, p, registry, "orders", breakingCodec, schema.ProducerConfig{}); code(err) != schema.CodeIncompatible {
+		t.Fatalf("expected an incompatible schema error, got %v", err)
+	}
+
+	c, _ := broker.Consumer("orders", "billing")
+	consumer := schema.NewConsumer(c, registry, readerCodec)
+	defer consumer.Close()
+
+	got := make(chan OrderV2, 1)
+	var header string
+	go consumer.Consume(ctx, func(ctx context.Context, msg *messaging.Message, order OrderV2) error {
+		header = msg.Headers[schema.HeaderSchemaID]
+		got <- order
+		return nil
+	})
+
+	if err := producer.Publish(ctx, []byte("o-1"), OrderV1{ID: "o-1", Amount: 42}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case order := <-got:
+		if order.ID != "o-1" || order.Amount != 42 || order.Currency != "EUR" {
+			t.Errorf("unexpected order %+v", order)
+		}
+		if header == "" {
+			t.Error("expected the schema ID header")
+		}
+	case <-ctx.Done():
+		t.Fatal("message not consumed")
+	}
+}
+
+func TestJSONCodecValidates(t *testing.T) {
+	codec, err := schema.NewJSONCodec[OrderV1](`{
+		"type": "object",
+		"properties": {"id": {"type": "string", "minLength": 1}, "amount": {"type": "integer", "minimum": 0}},
+		"required": ["id", "amount"]
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := codec.Marshal(OrderV1{ID: "", Amount: 1}); code(err) != schema.CodeInvalidPayload {
+		t.Errorf("expected a validation error for an empty id, got %v", err)
+	}
+	data, err := codec.Marshal(OrderV1{ID: "o-1", Amount: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order OrderV1
+	if err := codec.Unmarshal(data, nil, &order); err != nil || order.Amount != 3 {
+		t.Errorf("round trip failed: %+v (%v)", order, err)
+	}
+	if err := codec.Unmarshal([]byte(`{"id": "o-1", "amount": -1}`), nil, &order); code(err) != schema.CodeInvalidPayload {
+		t.Errorf("expected a validation error when reading, got %v", err)
+	}
+}
+
+func TestProtobufCodecRoundTrip(t *testing.T) {
+	codec, err := schema.NewProtobufCodec[*wrapperspb.StringValue]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := schema.Validate(schema.FormatProtobuf, codec.Definition()); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := codec.Marshal(wrapperspb.String("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// StringValue is the eighth message of wrappers.proto: one index, 7.
+	if data[0] != 2 || data[1] != 14 {
+		t.Errorf("unexpected message indexes % x", data[:2])
+	}
+
+	var v *wrapperspb.StringValue
+	if err := codec.Unmarshal(data, nil, &v); err != nil || v.GetValue() != "hello" {
+		t.Errorf("round trip failed: %v (%v)", v, err)
+	}
+}
+
+func TestWireFormat(t *testing.T) {
+	data := schema.EncodeWire(258, []byte("x"))
+	if len(data) != 6 || data[0] != 0 || data[3] != 1 || data[4] != 2 {
+		t.Fatalf("unexpected encoding % x", data)
+	}
+	id, payload, err := schema.DecodeWire(data)
+	if err != nil || id != 258 || string(payload) != "x" {
+		t.Errorf("decode failed: %d %q %v", id, payload, err)
+	}
+	if _, _, err := schema.DecodeWire([]byte{1, 0, 0, 0, 1}); code(err) != schema.CodeInvalidPayload {
+		t.Errorf("expected an error for a wrong magic byte, got %v", err)
+	}
+}
+
+func TestFileRegistryPersists(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "schemas.json")
+
+	registry, err := file.New(file.Config{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1, _ := registry.Register(ctx, "orders-value", schema.FormatAvro, orderV1)
+	v2, err := registry.Register(ctx, "orders-value", schema.FormatAvro, orderV2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.SetCompatibility(ctx, "orders-value", schema.CompatibilityFull); err != nil {
+		t.Fatal(err)
+	}
+	registry.Close()
+
+	reopened, err := file.New(file.Config{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest, err := reopened.GetLatest(ctx, "orders-value")
+	if err != nil || latest.ID != v2.ID || latest.Version != 2 {
+		t.Fatalf("unexpected latest %+v (%v)", latest, err)
+	}
+	if s, err := reopened.GetByID(ctx, v1.ID); err != nil || s.Definition != orderV1 {
+		t.Errorf("schema %d not restored: %v", v1.ID, err)
+	}
+	if level, _ := reopened.GetCompatibility(ctx, "orders-value"); level != schema.CompatibilityFull {
+		t.Errorf("compatibility not restored: %s", level)
+	}
+	if _, err := reopened.Register(ctx, "orders-value", schema.FormatAvro, orderV3); code(err) != schema.CodeIncompatible {
+		t.Errorf("expected the restored rule to apply, got %v", err)
+	}
+	fresh, err := reopened.Register(ctx, "other-value", schema.FormatJSON, `{"type": "string"}`)
+	if err != nil || fresh.ID <= v2.ID {
+		t.Errorf("IDs must not be reused after reopening: %+v (%v)", fresh, err)
+	}
+}
@@ -0,0 +1,176 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+	"github.com/chris-alexander-pop/system-design-library/pkg/messaging"
+)
+
+// HeaderSchemaID carries the ID of the schema a payload was written with, for
+// consumers that do not parse the wire format.
+const HeaderSchemaID = "x-schema-id"
+
+// ProducerConfig configures a typed Producer.
+type ProducerConfig struct {
+	// Subject is the subject the schema is registered under. Defaults to
+	// SubjectName(topic).
+	Subject string
+
+	// LookupOnly makes the producer use a version that is already registered
+	// instead of registering its schema, for registries managed out of band.
+	LookupOnly bool
+}
+
+// Producer publishes values of type T with a registered schema. Payloads use
+// the Confluent wire format and the schema ID is also set in HeaderSchemaID.
+type Producer[T any] struct {
+	next   messaging.Producer
+	codec  Codec[T]
+	topic  string
+	schema *Schema
+}
+
+// NewProducer registers the codec's schema for topic and returns a Producer
+// that publishes through next. It fails if the schema breaks the
+// compatibility rule of its subject, so an incompatible producer never
+// starts.
+func NewProducer[T any](ctx context.Context, next messaging.Producer, registry Registry, topic string, codec Codec[T], cfg ProducerConfig) (*Producer[T], error) {
+	subject := cfg.Subject
+	if subject == "" {
+		subject = SubjectName(topic)
+	}
+
+	var (
+		s   *Schema
+		err error
+	)
+	if cfg.LookupOnly {
+		s, err = registry.Lookup(ctx, subject, codec.Format(), codec.Definition())
+	} else {
+		s, err = registry.Register(ctx, subject, codec.Format(), codec.Definition())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Producer[T]{next: next, codec: codec, topic: topic, schema: s}, nil
+}
+
+// Schema returns the schema version values are published with.
+func (p *Producer[T]) Schema() *Schema {
+	return p.schema
+}
+
+// Encode returns a message carrying v, for callers that publish through
+// another path such as an outbox.
+func (p *Producer[T]) Encode(v T) (*messaging.Message, error) {
+	data, err := p.codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return &messaging.Message{
+		Topic:   p.topic,
+		Payload: EncodeWire(p.schema.ID, data),
+		Headers: map[string]string{HeaderSchemaID: strconv.Itoa(p.schema.ID)},
+	}, nil
+}
+
+// Publish publishes v with the given partition key.
+func (p *Producer[T]) Publish(ctx context.Context, key []byte, v T) error {
+	msg, err := p.Encode(v)
+	if err != nil {
+		return err
+	}
+	msg.Key = key
+	return p.next.Publish(ctx, msg)
+}
+
+// Close closes the underlying producer.
+func (p *Producer[T]) Close() error {
+	return p.next.Close()
+}
+
+// Handler processes a decoded value together with the message it came in.
+type Handler[T any] func(ctx context.Context, msg *messaging.Message, v T) error
+
+// Consumer decodes messages written by a Producer into values of type T,
+// looking up the schema each payload was written with.
+type Consumer[T any] struct {
+	next     messaging.Consumer
+	registry Registry
+	codec    Codec[T]
+
+	mu      sync.RWMutex
+	schemas map[int]*Schema
+}
+
+// NewConsumer returns a Consumer reading from next, which may itself be a
+// wrapper such as a messaging.RetryingConsumer.
+func NewConsumer[T any](next messaging.Consumer, registry Registry, codec Codec[T]) *Consumer[T] {
+	return &Consumer[T]{
+		next:     next,
+		registry: registry,
+		codec:    codec,
+		schemas:  make(map[int]*Schema),
+	}
+}
+
+// Consume decodes every message and passes it to handler. A message that
+// cannot be decoded fails like a handler error, so the broker's redelivery or
+// dead-lettering applies to it.
+func (c *Consumer[T]) Consume(ctx context.Context, handler Handler[T]) error {
+	return c.next.Consume(ctx, func(ctx context.Context, msg *messaging.Message) error {
+		v, err := c.Decode(ctx, msg)
+		if err != nil {
+			logger.L().WarnContext(ctx, "failed to decode message", "topic", msg.Topic, "message_id", msg.ID, "error", err)
+			return err
+		}
+		return handler(ctx, msg, v)
+	})
+}
+
+// Decode returns the value carried by msg.
+func (c *Consumer[T]) Decode(ctx context.Context, msg *messaging.Message) (T, error) {
+	var v T
+	id, data, err := DecodeWire(msg.Payload)
+	if err != nil {
+		return v, err
+	}
+	writer, err := c.writerSchema(ctx, id)
+	if err != nil {
+		return v, err
+	}
+	if writer.Format != c.codec.Format() {
+		return v, ErrInvalidPayload(fmt.Errorf("payload is %s, the consumer expects %s", writer.Format, c.codec.Format()))
+	}
+	err = c.codec.Unmarshal(data, writer, &v)
+	return v, err
+}
+
+// Close closes the underlying consumer.
+func (c *Consumer[T]) Close() error {
+	return c.next.Close()
+}
+
+// writerSchema returns a schema by ID. Schemas are immutable, so they are
+// cached for the life of the consumer.
+func (c *Consumer[T]) writerSchema(ctx context.Context, id int) (*Schema, error) {
+	c.mu.RLock()
+	s, ok := c.schemas[id]
+	c.mu.RUnlock()
+	if ok {
+		return s, nil
+	}
+
+	s, err := c.registry.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.schemas[id] = s
+	c.mu.Unlock()
+	return s, nil
+}
@@ -0,0 +1,34 @@
+package schema
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// magicByte starts every payload in the Confluent wire format.
+const magicByte = 0
+
+// wireHeaderSize is the magic byte followed by the big-endian schema ID.
+const wireHeaderSize = 5
+
+// EncodeWire frames payload in the Confluent wire format: a zero magic byte,
+// the schema ID as a 4-byte big-endian integer, then the encoded value.
+func EncodeWire(id int, payload []byte) []byte {
+	out := make([]byte, wireHeaderSize+len(payload))
+	out[0] = magicByte
+	binary.BigEndian.PutUint32(out[1:wireHeaderSize], uint32(id))
+	copy(out[wireHeaderSize:], payload)
+	return out
+}
+
+// DecodeWire splits a Confluent wire format payload into the schema ID and
+// the encoded value.
+func DecodeWire(data []byte) (int, []byte, error) {
+	if len(data) < wireHeaderSize {
+		return 0, nil, ErrInvalidPayload(fmt.Errorf("payload of %d bytes is too short for the wire format", len(data)))
+	}
+	if data[0] != magicByte {
+		return 0, nil, ErrInvalidPayload(fmt.Errorf("unknown magic byte %d", data[0]))
+	}
+	return int(binary.BigEndian.Uint32(data[1:wireHeaderSize])), data[wireHeaderSize:], nil
+}
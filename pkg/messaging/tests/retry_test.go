@@ -0,0 +1,290 @@
+package messaging_test
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/messaging"
+	"github.com/chris-alexander-pop/system-design-library/pkg/messaging/adapters/memory"
+)
+
+type attempts struct {
+	mu      sync.Mutex
+	calls   map[string]int
+	headers []map[string]string
+}
+
+func (a *attempts) record(msg *messaging.Message) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.calls[msg.ID]++
+	a.headers = append(a.headers, msg.Headers)
+	return a.calls[msg.ID]
+}
+
+func (a *attempts) count(id string) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.calls[id]
+}
+
+func waitUntil(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRetryingConsumerRetriesWithBackoff(t *testing.T) {
+	brokers := map[string]func() messaging.Broker{
+		// Retry delays through memory's DelayedProducer.
+		"delayed": func() messaging.Broker { return memory.New(memory.Config{}) },
+		// The instrumented wrapper hides PublishDelayed, so retry topics act
+		// as delay queues.
+		"delay-queue": func() messaging.Broker {
+			return messaging.NewInstrumentedBroker(memory.New(memory.Config{}))
+		},
+	}
+	for name, newBroker := range brokers {
+		t.Run(name, func(t *testing.T) {
+			broker := newBroker()
+			defer broker.Close()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			rc, err := messaging.NewRetryingConsumer(broker, "orders", "billing", messaging.RetryTopicConfig{
+				MaxAttempts:    5,
+				InitialBackoff: 20 * time.Millisecond,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rc.Close()
+
+			a := &attempts{calls: map[string]int{}}
+			var delivered time.Time
+			go rc.Consume(ctx, func(ctx context.Context, msg *messaging.Message) error {
+				if a.record(msg) < 3 {
+					return fmt.Errorf("transient failure")
+				}
+				a.mu.Lock()
+				delivered = time.Now()
+				a.mu.Unlock()
+				return nil
+			})
+
+			p, _ := broker.Producer("orders")
+			start := time.Now()
+			if err := p.Publish(ctx, &messaging.Message{ID: "o-1", Payload: []byte("x")}); err != nil {
+				t.Fatal(err)
+			}
+
+			waitUntil(t, func() bool { return a.count("o-1") == 3 })
+			time.Sleep(20 * time.Millisecond)
+			if a.count("o-1") != 3 {
+				t.Errorf("expected 3 attempts, got %d", a.count("o-1"))
+			}
+
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			// Backoff of 20ms then 40ms, measured from the failures.
+			if elapsed := delivered.Sub(start); elapsed < 55*time.Millisecond {
+				t.Errorf("retries were not delayed: %v", elapsed)
+			}
+			last := a.headers[2]
+			if last[messaging.HeaderRetryAttempt] != "2" || last[messaging.HeaderOriginalTopic] != "orders" {
+				t.Errorf("unexpected retry headers: %v", last)
+			}
+		})
+	}
+}
+
+func TestDelayQueueDoesNotHoldBackMainTopic(t *testing.T) {
+	broker := messaging.NewInstrumentedBroker(memory.New(memory.Config{}))
+	defer broker.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rc, err := messaging.NewRetryingConsumer(broker, "orders", "billing", messaging.RetryTopicConfig{
+		InitialBackoff: 300 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	a := &attempts{calls: map[string]int{}}
+	go rc.Consume(ctx, func(ctx context.Context, msg *messaging.Message) error {
+		if a.record(msg) == 1 && msg.ID == "poison" {
+			return fmt.Errorf("transient failure")
+		}
+		return nil
+	})
+
+	p, _ := broker.Producer("orders")
+	_ = p.Publish(ctx, &messaging.Message{ID: "poison"})
+	waitUntil(t, func() bool { return a.count("poison") == 1 })
+	_ = p.Publish(ctx, &messaging.Message{ID: "next"})
+
+	// The retry waits in its own topic while the main topic keeps flowing.
+	waitUntil(t, func() bool { return a.count("next") == 1 })
+	if a.count("poison") != 1 {
+		t.Error("retry delivered before its backoff")
+	}
+	waitUntil(t, func() bool { return a.count("poison") == 2 })
+}
+
+func TestRetryingConsumerRequeuesEarlyMessages(t *testing.T) {
+	broker := memory.New(memory.Config{})
+	defer broker.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rc, err := messaging.NewRetryingConsumer(broker, "orders", "billing", messaging.RetryTopicConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	var (
+		mu    sync.Mutex
+		order []string
+	)
+	go rc.Consume(ctx, func(ctx context.Context, msg *messaging.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, msg.ID)
+		return nil
+	})
+
+	// A message delivered before it is due must not hold back the ones
+	// behind it on the retry topic.
+	p, _ := broker.Producer(messaging.RetryTopicName("orders", "billing", 1))
+	due := func(d time.Duration) map[string]string {
+		return map[string]string{
+			messaging.HeaderRetryAttempt: "1",
+			messaging.HeaderRetryAt:      strconv.FormatInt(time.Now().Add(d).UnixMilli(), 10),
+		}
+	}
+	_ = p.Publish(ctx, &messaging.Message{ID: "early", Headers: due(200 * time.Millisecond)})
+	_ = p.Publish(ctx, &messaging.Message{ID: "due", Headers: due(0)})
+
+	waitUntil(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(order) == 2
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	if order[0] != "due" || order[1] != "early" {
+		t.Errorf("expected the due message first, got %v", order)
+	}
+}
+
+func TestRetryingConsumerDeadLettersAndReplays(t *testing.T) {
+	// Durable groups keep dead letters published before the DLQ is read.
+	broker := memory.New(memory.Config{DurableGroups: true})
+	defer broker.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rc, err := messaging.NewRetryingConsumer(broker, "orders", "billing", messaging.RetryTopicConfig{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	var (
+		mu      sync.Mutex
+		healthy bool
+		got     []*messaging.Message
+	)
+	a := &attempts{calls: map[string]int{}}
+	go rc.Consume(ctx, func(ctx context.Context, msg *messaging.Message) error {
+		a.record(msg)
+		mu.Lock()
+		defer mu.Unlock()
+		if !healthy {
+			return fmt.Errorf("downstream unavailable")
+		}
+		got = append(got, msg)
+		return nil
+	})
+
+	p, _ := broker.Producer("orders")
+	for i := 0; i < 3; i++ {
+		p.Publish(ctx, &messaging.Message{ID: fmt.Sprintf("o-%d", i), Payload: []byte("x")})
+	}
+	waitUntil(t, func() bool { return a.count("o-0")+a.count("o-1")+a.count("o-2") == 9 })
+
+	// Inspect one dead letter, putting back everything the consumer reads.
+	dlqTopic := messaging.DeadLetterTopicName("orders", "billing")
+	dp, _ := broker.Producer(dlqTopic)
+	dlq, _ := broker.Consumer(dlqTopic, "dlq-replay")
+	inspectCtx, stop := context.WithCancel(ctx)
+	var (
+		inspected sync.Mutex
+		dead      *messaging.Message
+	)
+	go dlq.Consume(inspectCtx, func(ctx context.Context, msg *messaging.Message) error {
+		inspected.Lock()
+		defer inspected.Unlock()
+		if dead == nil {
+			dead = msg
+			stop()
+		}
+		return dp.Publish(context.Background(), msg)
+	})
+	<-inspectCtx.Done()
+	dlq.Close()
+
+	inspected.Lock()
+	if dead.Headers[messaging.HeaderDeadLetterReason] != "downstream unavailable" ||
+		dead.Headers[messaging.HeaderRetryAttempt] != "3" ||
+		dead.Headers[messaging.HeaderDeadLetterGroup] != "billing" {
+		t.Errorf("unexpected dead-letter headers: %v", dead.Headers)
+	}
+	inspected.Unlock()
+
+	mu.Lock()
+	healthy = true
+	mu.Unlock()
+
+	n, err := messaging.ReplayDeadLetters(ctx, broker, "orders", "billing", messaging.ReplayOptions{
+		Limit:       2,
+		IdleTimeout: 50 * time.Millisecond,
+	})
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 replayed messages, got %d (%v)", n, err)
+	}
+	n, err = messaging.ReplayDeadLetters(ctx, broker, "orders", "billing", messaging.ReplayOptions{
+		IdleTimeout: 50 * time.Millisecond,
+	})
+	if err != nil || n != 1 {
+		t.Fatalf("expected 1 remaining message, got %d (%v)", n, err)
+	}
+
+	waitUntil(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(got) == 3
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	for _, msg := range got {
+		if msg.Headers[messaging.HeaderReplayCount] != "1" || msg.Headers[messaging.HeaderRetryAttempt] != "" {
+			t.Errorf("replayed message should start with fresh retry state: %v", msg.Headers)
+		}
+	}
+}
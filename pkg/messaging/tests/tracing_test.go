@@ -0,0 +1,90 @@
+package messaging_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/messaging"
+	"github.com/chris-alexander-pop/system-design-library/pkg/messaging/adapters/memory"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestInstrumentedBrokerPropagatesTraceContext(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	t.Cleanup(func() {
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+		_ = tp.Shutdown(context.Background())
+	})
+
+	broker := messaging.NewInstrumentedBroker(memory.New(memory.Config{}))
+	defer broker.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	consumer, err := broker.Consumer("orders", "billing")
+	if err != nil {
+		t.Fatalf("Consumer failed: %v", err)
+	}
+	received := make(chan context.Context, 1)
+	go consumer.Consume(ctx, func(ctx context.Context, msg *messaging.Message) error {
+		received <- ctx
+		return nil
+	})
+
+	producer, err := broker.Producer("orders")
+	if err != nil {
+		t.Fatalf("Producer failed: %v", err)
+	}
+	member, _ := baggage.NewMember("tenant", "acme")
+	bag, _ := baggage.New(member)
+	reqCtx, request := tp.Tracer("test").Start(baggage.ContextWithBaggage(ctx, bag), "http.request")
+	msg := &messaging.Message{Payload: []byte("order")}
+	if err := producer.Publish(reqCtx, msg); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	request.End()
+
+	if msg.Headers["traceparent"] == "" {
+		t.Fatalf("traceparent not injected: %v", msg.Headers)
+	}
+
+	var handlerCtx context.Context
+	select {
+	case handlerCtx = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not consumed")
+	}
+
+	if got, want := trace.SpanContextFromContext(handlerCtx).TraceID(), request.SpanContext().TraceID(); got != want {
+		t.Errorf("handler trace = %s, want %s", got, want)
+	}
+	if got := baggage.FromContext(handlerCtx).Member("tenant").Value(); got != "acme" {
+		t.Errorf("baggage tenant = %q, want acme", got)
+	}
+
+	// The handler span is a child of the publish span.
+	waitUntil(t, func() bool { return len(recorder.Ended()) >= 3 })
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range recorder.Ended() {
+		spans[s.Name()] = s
+	}
+	publish, handle := spans["messaging.Publish"], spans["messaging.HandleMessage"]
+	if publish == nil || handle == nil {
+		t.Fatalf("missing spans: %v", spans)
+	}
+	if handle.Parent().SpanID() != publish.SpanContext().SpanID() {
+		t.Errorf("handle parent = %s, want publish span %s", handle.Parent().SpanID(), publish.SpanContext().SpanID())
+	}
+	if handle.SpanKind() != trace.SpanKindConsumer {
+		t.Errorf("handle kind = %s, want consumer", handle.SpanKind())
+	}
+}
@@ -4,6 +4,8 @@ package memory
 import (
 	"context"
 	"fmt"
+	"maps"
+	"slices"
 	"sync"
 	"time"
 
@@ -59,7 +61,7 @@ func (m *Manager) GetAPI(ctx context.Context, id string) (*apigateway.API, error
 	if !ok {
 		return nil, errors.NotFound("API not found", nil)
 	}
-	return api, nil
+	return copyAPI(api), nil
 }
 
 func (m *Manager) ListAPIs(ctx context.Context) ([]*apigateway.API, error) {
@@ -68,7 +70,7 @@ func (m *Manager) ListAPIs(ctx context.Context) ([]*apigateway.API, error) {
 
 	result := make([]*apigateway.API, 0, len(m.apis))
 	for _, api := range m.apis {
-		result = append(result, api)
+		result = append(result, copyAPI(api))
 	}
 	return result, nil
 }
@@ -125,11 +127,16 @@ func (m *Manager) Deploy(ctx context.Context, apiID, stageName string) (*apigate
 		return nil, errors.NotFound("API not found", nil)
 	}
 
+	// Deploying snapshots the current routes into the stage.
+	routes := slices.Clone(api.Routes)
+
 	// Check if stage exists, update it
 	for i, s := range api.Stages {
 		if s.Name == stageName {
+			api.Stages[i].Routes = routes
 			api.Stages[i].DeployedAt = time.Now()
-			return &api.Stages[i], nil
+			stage := api.Stages[i]
+			return &stage, nil
 		}
 	}
 
@@ -137,6 +144,7 @@ func (m *Manager) Deploy(ctx context.Context, apiID, stageName string) (*apigate
 	stage := apigateway.Stage{
 		Name:       stageName,
 		Variables:  make(map[string]string),
+		Routes:     routes,
 		DeployedAt: time.Now(),
 	}
 	api.Stages = append(api.Stages, stage)
@@ -159,3 +167,30 @@ func (m *Manager) GetStage(ctx context.Context, apiID, stageName string) (*apiga
 	}
 	return nil, errors.NotFound("stage not found", nil)
 }
+
+// SetStageVariables replaces the variables of a deployed stage.
+func (m *Manager) SetStageVariables(ctx context.Context, apiID, stageName string, vars map[string]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	api, ok := m.apis[apiID]
+	if !ok {
+		return errors.NotFound("API not found", nil)
+	}
+
+	for i, s := range api.Stages {
+		if s.Name == stageName {
+			api.Stages[i].Variables = maps.Clone(vars)
+			return nil
+		}
+	}
+	return errors.NotFound("stage not found", nil)
+}
+
+// copyAPI keeps callers from racing with later route and stage changes.
+func copyAPI(api *apigateway.API) *apigateway.API {
+	out := *api
+	out.Routes = slices.Clone(api.Routes)
+	out.Stages = slices.Clone(api.Stages)
+	return &out
+}
@@ -13,6 +13,8 @@
 //
 //	gw := memory.New()
 //	api, err := gw.CreateAPI(ctx, apigateway.CreateAPIOptions{Name: "my-api"})
+//
+// pkg/network/apigateway/gateway serves the deployed stages of an API.
 package apigateway
 
 import (
@@ -109,6 +111,67 @@ type Route struct {
 
 	// AuthorizerID is the authorizer ID.
 	AuthorizerID string
+
+	// RateLimit limits requests to the route; nil means unlimited.
+	RateLimit *RateLimit
+
+	// RequestHeaders transforms the headers sent to the integration.
+	RequestHeaders *HeaderTransform
+
+	// ResponseHeaders transforms the headers returned to the client.
+	ResponseHeaders *HeaderTransform
+}
+
+// Route paths are literal segments and "{name}" parameters; the last
+// segment may be a greedy "{name+}" parameter. RouteDefault matches any
+// request no other route does.
+const RouteDefault = "$default"
+
+// Authorization types.
+const (
+	AuthorizationNone = "NONE"
+
+	// AuthorizationJWT requires a bearer token accepted by the authorizer
+	// named by AuthorizerID.
+	AuthorizationJWT = "JWT"
+)
+
+// Integration types.
+const (
+	// IntegrationHTTPProxy forwards the request to URI and returns the
+	// backend's response unchanged.
+	IntegrationHTTPProxy = "HTTP_PROXY"
+
+	// IntegrationMock answers with MockResponse without a backend.
+	IntegrationMock = "MOCK"
+)
+
+// RateLimit configures per-route rate limiting.
+type RateLimit struct {
+	// Limit is the number of requests allowed per Period.
+	Limit int64
+
+	// Period is the rate limit window.
+	Period time.Duration
+
+	// Key selects what is limited: "ip" (the default) limits each client
+	// address, "subject" each authenticated principal and "route" the
+	// route as a whole.
+	Key string
+}
+
+// HeaderTransform rewrites HTTP headers. Values may reference
+// ${request.path.<name>}, ${stageVariables.<name>} and
+// ${context.authorizer.<claim>} (sub, email or role).
+type HeaderTransform struct {
+	// Set replaces headers.
+	Set map[string]string
+
+	// Add appends header values.
+	Add map[string]string
+
+	// Remove deletes headers.
+	Remove []string
 }
 
 // Integration represents a backend integration.
@@ -124,6 +187,21 @@ type Integration struct {
 
 	// TimeoutMs is the timeout in milliseconds.
 	TimeoutMs int
+
+	// MockResponse is the response of MOCK integrations.
+	MockResponse *MockResponse
+}
+
+// MockResponse is a fixed integration response.
+type MockResponse struct {
+	// StatusCode defaults to 200.
+	StatusCode int
+
+	// Headers are the response headers.
+	Headers map[string]string
+
+	// Body is the response body.
+	Body string
 }
 
 // Stage represents a deployment stage.
@@ -137,6 +215,10 @@ type Stage struct {
 	// Variables are stage variables.
 	Variables map[string]string
 
+	// Routes are the API's routes as of the deployment; later route
+	// changes take effect on the next Deploy.
+	Routes []Route
+
 	// DeployedAt is when the stage was deployed.
 	DeployedAt time.Time
 }
@@ -0,0 +1,34 @@
+/*
+Package gateway serves the deployed stages of an apigateway API over HTTP,
+as a local stand-in for a managed API gateway or a small edge.
+
+Requests to /{stage}/{path} are matched against the routes the stage was
+deployed with. The most specific route wins: literal segments beat "{name}"
+parameters, which beat a greedy "{name+}", and a route for the request's
+method beats an ANY route; the $default route catches everything else.
+For each match the gateway:
+
+  - verifies the bearer token of JWT routes with the auth.Verifier
+    registered for the route's AuthorizerID,
+  - enforces the route's rate limit with a pkg/api/ratelimit limiter,
+  - applies the request header transform and calls the integration, an
+    HTTP_PROXY backend or a MOCK response,
+  - applies the response header transform.
+
+Integration URIs and header values may reference path parameters,
+${stageVariables.<name>} and ${context.authorizer.<claim>}.
+
+Deploy snapshots the API's routes into the stage. The gateway picks up
+deployments every ReloadInterval, or immediately on Reload.
+
+Usage:
+
+	import "github.com/chris-alexander-pop/system-design-library/pkg/network/apigateway/gateway"
+
+	gw := gateway.New(gateway.Config{
+		Addr:        ":8080",
+		Authorizers: map[string]auth.Verifier{"users": verifier},
+	}, manager, api.ID)
+	err := gw.ListenAndServe(ctx)
+*/
+package gateway
@@ -0,0 +1,301 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/api/ratelimit"
+	"github.com/chris-alexander-pop/system-design-library/pkg/auth"
+	"github.com/chris-alexander-pop/system-design-library/pkg/cache/adapters/memory"
+	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/apigateway"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Config holds configuration for the gateway.
+type Config struct {
+	// Addr is the address ListenAndServe serves on.
+	Addr string `env:"APIGATEWAY_ADDR" env-default:":8080"`
+
+	// ReloadInterval is how often deployments are re-read from the manager.
+	// Reload applies them immediately.
+	ReloadInterval time.Duration `env:"APIGATEWAY_RELOAD_INTERVAL" env-default:"1s"`
+
+	// IntegrationTimeout applies to integrations without TimeoutMs.
+	IntegrationTimeout time.Duration `env:"APIGATEWAY_INTEGRATION_TIMEOUT" env-default:"29s"`
+
+	// Authorizers verify the bearer tokens of JWT routes, by AuthorizerID.
+	Authorizers map[string]auth.Verifier
+
+	// Limiter enforces route rate limits. It defaults to a sliding window
+	// over an in-memory cache, which only limits this gateway instance.
+	Limiter ratelimit.Limiter
+}
+
+// Gateway serves the deployed stages of an API. Requests to
+// /{stage}/{path} are matched against the routes the stage was deployed
+// with.
+type Gateway struct {
+	cfg     Config
+	manager apigateway.APIGatewayManager
+	apiID   string
+	tracer  trace.Tracer
+	proxy   *httputil.ReverseProxy
+
+	reloadMu sync.Mutex
+	stages   atomic.Pointer[map[string]*stage]
+}
+
+// stage is a deployed stage ready to serve.
+type stage struct {
+	name       string
+	deployedAt time.Time
+	variables  map[string]string
+	router     *router
+}
+
+// New creates a gateway for the API apiID of manager. Nothing is served
+// until Reload or ListenAndServe has loaded the deployments.
+func New(cfg Config, manager apigateway.APIGatewayManager, apiID string) *Gateway {
+	if cfg.Addr == "" {
+		cfg.Addr = ":8080"
+	}
+	if cfg.ReloadInterval <= 0 {
+		cfg.ReloadInterval = time.Second
+	}
+	if cfg.IntegrationTimeout <= 0 {
+		cfg.IntegrationTimeout = 29 * time.Second
+	}
+	if cfg.Limiter == nil {
+		cfg.Limiter = ratelimit.New(memory.New(), ratelimit.StrategySlidingWindow)
+	}
+
+	g := &Gateway{
+		cfg:     cfg,
+		manager: manager,
+		apiID:   apiID,
+		tracer:  instrument.NewTracer("pkg/network/apigateway/gateway"),
+	}
+	g.proxy = g.newReverseProxy()
+	g.stages.Store(&map[string]*stage{})
+	return g
+}
+
+// ListenAndServe serves the API on cfg.Addr until ctx is cancelled,
+// picking up deployments every ReloadInterval.
+func (g *Gateway) ListenAndServe(ctx context.Context) error {
+	if err := g.Reload(ctx); err != nil {
+		return err
+	}
+
+	srv := &http.Server{Addr: g.cfg.Addr, Handler: g, ReadHeaderTimeout: 30 * time.Second}
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.ListenAndServe() }()
+	logger.L().InfoContext(ctx, "started api gateway", "api", g.apiID, "addr", g.cfg.Addr)
+
+	ticker := time.NewTicker(g.cfg.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-errCh:
+			return err
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), g.cfg.IntegrationTimeout)
+			defer cancel()
+			return srv.Shutdown(shutdownCtx)
+		case <-ticker.C:
+			if err := g.Reload(ctx); err != nil {
+				logger.L().ErrorContext(ctx, "failed to reload api gateway", "api", g.apiID, "error", err)
+			}
+		}
+	}
+}
+
+// Reload loads the API's deployed stages. A stage that was redeployed, or
+// whose variables changed, serves its new routes from the next request.
+func (g *Gateway) Reload(ctx context.Context) error {
+	g.reloadMu.Lock()
+	defer g.reloadMu.Unlock()
+
+	api, err := g.manager.GetAPI(ctx, g.apiID)
+	if err != nil {
+		return err
+	}
+
+	current := *g.stages.Load()
+	next := make(map[string]*stage, len(api.Stages))
+	for _, s := range api.Stages {
+		if cur, ok := current[s.Name]; ok && cur.deployedAt.Equal(s.DeployedAt) && maps.Equal(cur.variables, s.Variables) {
+			next[s.Name] = cur
+			continue
+		}
+		next[s.Name] = &stage{
+			name:       s.Name,
+			deployedAt: s.DeployedAt,
+			variables:  maps.Clone(s.Variables),
+			router:     newRouter(s.Routes),
+		}
+		logger.L().InfoContext(ctx, "loaded api gateway stage", "api", g.apiID, "stage", s.Name, "routes", len(s.Routes), "deployed_at", s.DeployedAt)
+	}
+	g.stages.Store(&next)
+	return nil
+}
+
+// ServeHTTP serves a request to /{stage}/{path}.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	stageName, path, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	path = "/" + path
+
+	ctx, span := g.tracer.Start(r.Context(), "apigateway.Request", trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+		attribute.String("apigateway.api.id", g.apiID),
+		attribute.String("apigateway.stage", stageName),
+		attribute.String("http.request.method", r.Method),
+	))
+	defer span.End()
+	r = r.WithContext(ctx)
+
+	fail := func(code int, msg string) {
+		span.SetStatus(codes.Error, msg)
+		writeError(w, code, msg)
+	}
+
+	st := (*g.stages.Load())[stageName]
+	if st == nil {
+		fail(http.StatusNotFound, "Not Found")
+		return
+	}
+	route, params := st.router.match(r.Method, path)
+	if route == nil {
+		fail(http.StatusNotFound, "Not Found")
+		return
+	}
+	span.SetAttributes(attribute.String("apigateway.route", route.route.Method+" "+route.route.Path))
+
+	vars := make(map[string]string)
+	for k, v := range st.variables {
+		vars["stageVariables."+k] = v
+	}
+	for k, v := range params {
+		vars["request.path."+k] = v
+	}
+
+	claims, ok := g.authorize(w, r, route.route, span)
+	if !ok {
+		return
+	}
+	subject := ""
+	if claims != nil {
+		subject = claims.Subject
+		vars["context.authorizer.sub"] = claims.Subject
+		vars["context.authorizer.email"] = claims.Email
+		vars["context.authorizer.role"] = claims.Role
+	}
+
+	if !g.allow(w, r, st, route.route, subject) {
+		span.SetStatus(codes.Error, "rate limited")
+		return
+	}
+
+	call := &integrationCall{route: route.route, params: params, vars: vars, path: path}
+	switch strings.ToUpper(route.route.Integration.Type) {
+	case apigateway.IntegrationMock:
+		g.serveMock(w, call)
+	case apigateway.IntegrationHTTPProxy, "HTTP", "":
+		g.serveProxy(w, r, call)
+	default:
+		logger.L().ErrorContext(ctx, "unsupported api gateway integration", "type", route.route.Integration.Type, "route", route.route.ID)
+		fail(http.StatusInternalServerError, "Internal Server Error")
+	}
+}
+
+// authorize checks the bearer token of routes that require one, writing
+// the error response when it fails.
+func (g *Gateway) authorize(w http.ResponseWriter, r *http.Request, route apigateway.Route, span trace.Span) (*auth.Claims, bool) {
+	kind := strings.ToUpper(route.Authorization)
+	if kind == "" || kind == apigateway.AuthorizationNone {
+		return nil, true
+	}
+
+	verifier := g.cfg.Authorizers[route.AuthorizerID]
+	if kind != apigateway.AuthorizationJWT || verifier == nil {
+		// Misconfigured routes fail closed.
+		logger.L().ErrorContext(r.Context(), "api gateway route has no usable authorizer", "route", route.ID, "authorization", route.Authorization, "authorizer", route.AuthorizerID)
+		span.SetStatus(codes.Error, "authorizer not configured")
+		writeError(w, http.StatusInternalServerError, "Internal Server Error")
+		return nil, false
+	}
+
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || token == "" {
+		span.SetStatus(codes.Error, "missing token")
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return nil, false
+	}
+	claims, err := verifier.Verify(r.Context(), token)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "invalid token")
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return nil, false
+	}
+	return claims, true
+}
+
+// allow enforces the route's rate limit, writing the 429 response when the
+// request is over it. Limiter failures let the request through.
+func (g *Gateway) allow(w http.ResponseWriter, r *http.Request, st *stage, route apigateway.Route, subject string) bool {
+	rl := route.RateLimit
+	if rl == nil || rl.Limit <= 0 {
+		return true
+	}
+
+	key := "apigateway:" + g.apiID + ":" + st.name + ":" + route.ID
+	switch rl.Key {
+	case "route":
+	case "subject":
+		if subject != "" {
+			key += ":sub:" + subject
+			break
+		}
+		fallthrough
+	default:
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		key += ":ip:" + host
+	}
+
+	period := rl.Period
+	if period <= 0 {
+		period = time.Second
+	}
+	res, err := g.cfg.Limiter.Allow(r.Context(), key, rl.Limit, period)
+	if err != nil {
+		logger.L().ErrorContext(r.Context(), "rate limit check failed", "route", route.ID, "error", err)
+		return true
+	}
+	if !res.Allowed {
+		w.Header().Set("Retry-After", formatSeconds(res.Reset))
+		writeError(w, http.StatusTooManyRequests, "Too Many Requests")
+		return false
+	}
+	return true
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]string{"message": msg})
+}
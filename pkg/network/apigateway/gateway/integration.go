@@ -0,0 +1,198 @@
+package gateway
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/apigateway"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// integrationCall is a matched request on its way to the integration.
+type integrationCall struct {
+	route  apigateway.Route
+	params map[string]string
+	vars   map[string]string
+	path   string // the request path within the stage
+	target *url.URL
+}
+
+type callKey struct{}
+
+func (g *Gateway) newReverseProxy() *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			call := pr.In.Context().Value(callKey{}).(*integrationCall)
+			pr.Out.URL = call.target
+			pr.Out.Host = call.target.Host
+			if m := strings.ToUpper(call.route.Integration.Method); m != "" && m != "ANY" {
+				pr.Out.Method = m
+			}
+			pr.SetXForwarded()
+			applyTransform(pr.Out.Header, call.route.RequestHeaders, call.vars)
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			call := resp.Request.Context().Value(callKey{}).(*integrationCall)
+			applyTransform(resp.Header, call.route.ResponseHeaders, call.vars)
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			trace.SpanFromContext(r.Context()).RecordError(err)
+			logger.L().WarnContext(r.Context(), "api gateway integration failed", "error", err)
+			if r.Context().Err() == context.DeadlineExceeded {
+				writeError(w, http.StatusGatewayTimeout, "Endpoint request timed out")
+				return
+			}
+			writeError(w, http.StatusBadGateway, "Bad Gateway")
+		},
+	}
+}
+
+// serveProxy forwards the request to the integration URI. Path parameters
+// in the URI ("{id}", "{proxy+}") and ${...} variables are substituted; a
+// URI without a path receives the request's path within the stage. The
+// request's query string is passed on.
+//
+// Parameter values are escaped segment by segment, so they cannot add a
+// query or fragment, and "." and ".." segments are rejected, so the request
+// stays below the static part of the URI's path.
+func (g *Gateway) serveProxy(w http.ResponseWriter, r *http.Request, call *integrationCall) {
+	uri := expand(call.route.Integration.URI, call.vars)
+	prefix := uri
+	if i := strings.IndexByte(prefix, '{'); i >= 0 {
+		prefix = prefix[:i]
+	}
+	for name, value := range call.params {
+		greedy, ok := escapePath(value)
+		if !ok {
+			writeError(w, http.StatusBadRequest, "Bad Request")
+			return
+		}
+		uri = strings.ReplaceAll(uri, "{"+name+"+}", greedy)
+		uri = strings.ReplaceAll(uri, "{"+name+"}", url.PathEscape(value))
+	}
+	target, err := url.Parse(uri)
+	if err != nil || target.Host == "" {
+		logger.L().ErrorContext(r.Context(), "invalid api gateway integration uri", "route", call.route.ID, "uri", call.route.Integration.URI)
+		writeError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+	if target.Path == "" {
+		if _, ok := escapePath(call.path); !ok {
+			writeError(w, http.StatusBadRequest, "Bad Request")
+			return
+		}
+		target.Path = call.path
+	}
+	if base, err := url.Parse(prefix); err == nil && !underPath(target.Path, base.Path) {
+		writeError(w, http.StatusBadRequest, "Bad Request")
+		return
+	}
+	if r.URL.RawQuery != "" {
+		if target.RawQuery != "" {
+			target.RawQuery += "&" + r.URL.RawQuery
+		} else {
+			target.RawQuery = r.URL.RawQuery
+		}
+	}
+	call.target = target
+
+	timeout := g.cfg.IntegrationTimeout
+	if ms := call.route.Integration.TimeoutMs; ms > 0 {
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	g.proxy.ServeHTTP(w, r.WithContext(context.WithValue(ctx, callKey{}, call)))
+}
+
+// escapePath escapes each "/"-separated segment of p. It reports false if p
+// contains a "." or ".." segment.
+func escapePath(p string) (string, bool) {
+	segments := strings.Split(p, "/")
+	for i, seg := range segments {
+		if seg == "." || seg == ".." {
+			return "", false
+		}
+		segments[i] = url.PathEscape(seg)
+	}
+	return strings.Join(segments, "/"), true
+}
+
+// underPath reports whether the cleaned path p is prefix or lies below it.
+func underPath(p, prefix string) bool {
+	prefix = strings.TrimSuffix(path.Clean("/"+prefix), "/")
+	p = path.Clean("/" + p)
+	return prefix == "" || p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+// serveMock answers with the integration's fixed response.
+func (g *Gateway) serveMock(w http.ResponseWriter, call *integrationCall) {
+	mock := call.route.Integration.MockResponse
+	if mock == nil {
+		mock = &apigateway.MockResponse{}
+	}
+	for k, v := range mock.Headers {
+		w.Header().Set(k, expand(v, call.vars))
+	}
+	applyTransform(w.Header(), call.route.ResponseHeaders, call.vars)
+
+	status := mock.StatusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	_, _ = io.WriteString(w, expand(mock.Body, call.vars))
+}
+
+func applyTransform(h http.Header, t *apigateway.HeaderTransform, vars map[string]string) {
+	if t == nil {
+		return
+	}
+	for _, k := range t.Remove {
+		h.Del(k)
+	}
+	for k, v := range t.Set {
+		h.Set(k, expand(v, vars))
+	}
+	for k, v := range t.Add {
+		h.Add(k, expand(v, vars))
+	}
+}
+
+// expand substitutes ${name} references; unknown names become empty.
+func expand(s string, vars map[string]string) string {
+	if !strings.Contains(s, "${") {
+		return s
+	}
+	var b strings.Builder
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(s[start:], '}')
+		if end < 0 {
+			break
+		}
+		b.WriteString(s[:start])
+		b.WriteString(vars[s[start+2:start+end]])
+		s = s[start+end+1:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,134 @@
+package gateway
+
+import (
+	"strings"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/apigateway"
+)
+
+// segmentKind orders path segments by specificity.
+type segmentKind int
+
+const (
+	segmentGreedy segmentKind = iota
+	segmentParam
+	segmentLiteral
+)
+
+type segment struct {
+	kind  segmentKind
+	value string // the literal, or the parameter name
+}
+
+// compiledRoute is a route with its path parsed for matching.
+type compiledRoute struct {
+	route    apigateway.Route
+	method   string // empty for ANY
+	segments []segment
+	fallback bool // RouteDefault
+}
+
+// router matches requests to the routes of one deployed stage.
+type router struct {
+	routes []*compiledRoute
+}
+
+func newRouter(routes []apigateway.Route) *router {
+	r := &router{}
+	for _, route := range routes {
+		c := &compiledRoute{route: route}
+		if m := strings.ToUpper(route.Method); m != "" && m != "ANY" {
+			c.method = m
+		}
+		if route.Path == apigateway.RouteDefault {
+			c.fallback = true
+		} else {
+			for _, part := range splitPath(route.Path) {
+				switch {
+				case strings.HasPrefix(part, "{") && strings.HasSuffix(part, "+}"):
+					c.segments = append(c.segments, segment{kind: segmentGreedy, value: part[1 : len(part)-2]})
+				case strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}"):
+					c.segments = append(c.segments, segment{kind: segmentParam, value: part[1 : len(part)-1]})
+				default:
+					c.segments = append(c.segments, segment{kind: segmentLiteral, value: part})
+				}
+			}
+		}
+		r.routes = append(r.routes, c)
+	}
+	return r
+}
+
+// match returns the most specific route for method and path with its path
+// parameters. Literal segments beat parameters, which beat greedy
+// parameters, and a route for the method beats an ANY route.
+func (r *router) match(method, path string) (*compiledRoute, map[string]string) {
+	parts := splitPath(path)
+
+	var best, fallback *compiledRoute
+	var bestParams map[string]string
+	for _, c := range r.routes {
+		if c.method != "" && c.method != method {
+			continue
+		}
+		if c.fallback {
+			if fallback == nil || (fallback.method == "" && c.method != "") {
+				fallback = c
+			}
+			continue
+		}
+		params, ok := c.matchPath(parts)
+		if ok && (best == nil || c.moreSpecific(best)) {
+			best, bestParams = c, params
+		}
+	}
+	if best == nil && fallback != nil {
+		return fallback, map[string]string{}
+	}
+	return best, bestParams
+}
+
+func (c *compiledRoute) matchPath(parts []string) (map[string]string, bool) {
+	params := make(map[string]string)
+	for i, s := range c.segments {
+		if s.kind == segmentGreedy {
+			if i >= len(parts) {
+				return nil, false
+			}
+			params[s.value] = strings.Join(parts[i:], "/")
+			return params, true
+		}
+		if i >= len(parts) {
+			return nil, false
+		}
+		switch s.kind {
+		case segmentLiteral:
+			if s.value != parts[i] {
+				return nil, false
+			}
+		case segmentParam:
+			params[s.value] = parts[i]
+		}
+	}
+	return params, len(parts) == len(c.segments)
+}
+
+func (c *compiledRoute) moreSpecific(other *compiledRoute) bool {
+	for i := 0; i < len(c.segments) && i < len(other.segments); i++ {
+		if c.segments[i].kind != other.segments[i].kind {
+			return c.segments[i].kind > other.segments[i].kind
+		}
+	}
+	if len(c.segments) != len(other.segments) {
+		return len(c.segments) > len(other.segments)
+	}
+	return c.method != "" && other.method == ""
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
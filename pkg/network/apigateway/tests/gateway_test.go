@@ -0,0 +1,232 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/auth"
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/apigateway"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/apigateway/adapters/memory"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/apigateway/gateway"
+	"github.com/stretchr/testify/suite"
+)
+
+// staticVerifier accepts tokens of the form "valid-<subject>".
+type staticVerifier struct{}
+
+func (staticVerifier) Verify(ctx context.Context, token string) (*auth.Claims, error) {
+	subject, ok := strings.CutPrefix(token, "valid-")
+	if !ok {
+		return nil, errors.Unauthorized("invalid token", nil)
+	}
+	return &auth.Claims{Subject: subject, Role: "admin"}, nil
+}
+
+// GatewaySuite tests the gateway data plane against a backend that echoes
+// the request line.
+type GatewaySuite struct {
+	suite.Suite
+	manager *memory.Manager
+	api     *apigateway.API
+	gw      *gateway.Gateway
+	server  *httptest.Server
+	backend *httptest.Server
+	ctx     context.Context
+}
+
+// SetupTest creates an API and serves a gateway for it.
+func (s *GatewaySuite) SetupTest() {
+	s.ctx = context.Background()
+	s.manager = memory.New()
+	api, err := s.manager.CreateAPI(s.ctx, apigateway.CreateAPIOptions{Name: "orders"})
+	s.Require().NoError(err)
+	s.api = api
+
+	s.backend = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+			}
+		}
+		w.Header().Set("Server", "backend")
+		w.Header().Set("X-Backend-User", r.Header.Get("X-User"))
+		_, _ = io.WriteString(w, r.Method+" "+r.URL.RequestURI())
+	}))
+
+	s.gw = gateway.New(gateway.Config{
+		ReloadInterval: time.Hour,
+		Authorizers:    map[string]auth.Verifier{"users": staticVerifier{}},
+	}, s.manager, api.ID)
+	s.server = httptest.NewServer(s.gw)
+}
+
+// TearDownTest stops the gateway and the backend.
+func (s *GatewaySuite) TearDownTest() {
+	s.server.Close()
+	s.backend.Close()
+}
+
+func (s *GatewaySuite) route(r apigateway.Route) *apigateway.Route {
+	route, err := s.manager.AddRoute(s.ctx, s.api.ID, r)
+	s.Require().NoError(err)
+	return route
+}
+
+func (s *GatewaySuite) deploy(stage string) {
+	_, err := s.manager.Deploy(s.ctx, s.api.ID, stage)
+	s.Require().NoError(err)
+	s.Require().NoError(s.gw.Reload(s.ctx))
+}
+
+func (s *GatewaySuite) do(method, path, token string) (*http.Response, string) {
+	req, _ := http.NewRequest(method, s.server.URL+path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err, "%s %s", method, path)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+func (s *GatewaySuite) TestRoutesToIntegrations() {
+	s.route(apigateway.Route{Method: "GET", Path: "/users/{id}", Integration: apigateway.Integration{Type: apigateway.IntegrationHTTPProxy, URI: s.backend.URL + "/v1/users/{id}"}})
+	s.route(apigateway.Route{Method: "GET", Path: "/users/me", Integration: apigateway.Integration{Type: apigateway.IntegrationMock, MockResponse: &apigateway.MockResponse{Body: "me"}}})
+	s.route(apigateway.Route{Method: "ANY", Path: "/files/{proxy+}", Integration: apigateway.Integration{Type: apigateway.IntegrationHTTPProxy, URI: s.backend.URL + "/static/{proxy+}"}})
+	s.route(apigateway.Route{Method: "ANY", Path: "/orders", Integration: apigateway.Integration{Type: apigateway.IntegrationHTTPProxy, URI: s.backend.URL}})
+	s.route(apigateway.Route{Path: apigateway.RouteDefault, Integration: apigateway.Integration{Type: apigateway.IntegrationMock, MockResponse: &apigateway.MockResponse{StatusCode: http.StatusTeapot, Body: "default"}}})
+	s.deploy("prod")
+
+	tests := []struct {
+		method, path string
+		code         int
+		body         string
+	}{
+		{"GET", "/prod/users/42?expand=true", 200, "GET /v1/users/42?expand=true"},
+		{"GET", "/prod/users/me", 200, "me"},
+		{"DELETE", "/prod/files/a/b.txt", 200, "DELETE /static/a/b.txt"},
+		{"POST", "/prod/orders", 200, "POST /orders"},
+		{"POST", "/prod/users/42", http.StatusTeapot, "default"},
+		{"GET", "/staging/users/42", 404, `{"message":"Not Found"}`},
+	}
+	for _, tt := range tests {
+		resp, body := s.do(tt.method, tt.path, "")
+		s.Equal(tt.code, resp.StatusCode, "%s %s", tt.method, tt.path)
+		s.Equal(tt.body, strings.TrimSpace(body), "%s %s", tt.method, tt.path)
+	}
+}
+
+func (s *GatewaySuite) TestEscapesPathParameters() {
+	s.route(apigateway.Route{Method: "GET", Path: "/users/{id}", Integration: apigateway.Integration{Type: apigateway.IntegrationHTTPProxy, URI: s.backend.URL + "/v1/users/{id}"}})
+	s.route(apigateway.Route{Method: "GET", Path: "/files/{proxy+}", Integration: apigateway.Integration{Type: apigateway.IntegrationHTTPProxy, URI: s.backend.URL + "/static/{proxy+}"}})
+	s.deploy("prod")
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/prod/files/a%3Fadmin=1", 200, "GET /static/a%3Fadmin=1"},
+		{"/prod/files/a%23frag/b", 200, "GET /static/a%23frag/b"},
+		{"/prod/files/a%252e%252e/b", 200, "GET /static/a%252e%252e/b"},
+		{"/prod/files/%2e%2e/%2e%2e/admin", 400, `{"message":"Bad Request"}`},
+		{"/prod/files/a/%2E/b", 400, `{"message":"Bad Request"}`},
+		{"/prod/users/%2e%2e", 400, `{"message":"Bad Request"}`},
+		{"/prod/users/1%3Fx=1", 200, "GET /v1/users/1%3Fx=1"},
+	}
+	for _, tt := range tests {
+		resp, body := s.do("GET", tt.path, "")
+		s.Equal(tt.code, resp.StatusCode, tt.path)
+		s.Equal(tt.body, strings.TrimSpace(body), tt.path)
+	}
+}
+
+func (s *GatewaySuite) TestServesDeployedSnapshot() {
+	s.route(apigateway.Route{Method: "GET", Path: "/v1", Integration: apigateway.Integration{Type: apigateway.IntegrationMock, MockResponse: &apigateway.MockResponse{Body: "v1"}}})
+	s.deploy("prod")
+
+	s.route(apigateway.Route{Method: "GET", Path: "/v2", Integration: apigateway.Integration{Type: apigateway.IntegrationMock, MockResponse: &apigateway.MockResponse{Body: "v2"}}})
+	s.Require().NoError(s.gw.Reload(s.ctx))
+	resp, _ := s.do("GET", "/prod/v2", "")
+	s.Require().Equal(http.StatusNotFound, resp.StatusCode, "undeployed route")
+
+	s.deploy("prod")
+	_, body := s.do("GET", "/prod/v2", "")
+	s.Equal("v2", body, "after redeploy")
+
+	s.Require().NoError(s.manager.SetStageVariables(s.ctx, s.api.ID, "prod", map[string]string{"env": "production"}))
+	s.route(apigateway.Route{Method: "GET", Path: "/env", Integration: apigateway.Integration{Type: apigateway.IntegrationMock, MockResponse: &apigateway.MockResponse{Body: "${stageVariables.env}"}}})
+	s.deploy("prod")
+	_, body = s.do("GET", "/prod/env", "")
+	s.Equal("production", body, "the stage variable")
+}
+
+func (s *GatewaySuite) TestAuthorizesAndTransformsHeaders() {
+	s.route(apigateway.Route{
+		Method:        "GET",
+		Path:          "/profile",
+		Authorization: apigateway.AuthorizationJWT,
+		AuthorizerID:  "users",
+		Integration:   apigateway.Integration{Type: apigateway.IntegrationHTTPProxy, URI: s.backend.URL},
+		RequestHeaders: &apigateway.HeaderTransform{
+			Set:    map[string]string{"X-User": "${context.authorizer.sub}"},
+			Remove: []string{"Authorization"},
+		},
+		ResponseHeaders: &apigateway.HeaderTransform{
+			Set:    map[string]string{"X-Stage-Route": "profile"},
+			Remove: []string{"Server"},
+		},
+	})
+	s.route(apigateway.Route{Method: "GET", Path: "/admin", Authorization: apigateway.AuthorizationJWT, AuthorizerID: "missing", Integration: apigateway.Integration{Type: apigateway.IntegrationMock}})
+	s.deploy("prod")
+
+	resp, _ := s.do("GET", "/prod/profile", "")
+	s.Equal(http.StatusUnauthorized, resp.StatusCode, "without token")
+	resp, _ = s.do("GET", "/prod/profile", "forged")
+	s.Equal(http.StatusUnauthorized, resp.StatusCode, "invalid token")
+
+	resp, body := s.do("GET", "/prod/profile", "valid-alice")
+	s.Require().Equal(http.StatusOK, resp.StatusCode)
+	s.Require().Equal("GET /profile", body)
+	s.Equal("alice", resp.Header.Get("X-Backend-User"), "X-User seen by the backend")
+	s.Empty(resp.Header.Get("Server"), "removed response header")
+	s.Equal("profile", resp.Header.Get("X-Stage-Route"), "set response header")
+
+	resp, _ = s.do("GET", "/prod/admin", "valid-alice")
+	s.Equal(http.StatusInternalServerError, resp.StatusCode, "unknown authorizer")
+}
+
+func (s *GatewaySuite) TestRateLimitsAndTimesOut() {
+	s.route(apigateway.Route{
+		Method:      "GET",
+		Path:        "/limited",
+		RateLimit:   &apigateway.RateLimit{Limit: 2, Period: time.Minute},
+		Integration: apigateway.Integration{Type: apigateway.IntegrationMock},
+	})
+	s.route(apigateway.Route{Method: "GET", Path: "/slow", Integration: apigateway.Integration{Type: apigateway.IntegrationHTTPProxy, URI: s.backend.URL, TimeoutMs: 50}})
+	s.deploy("prod")
+
+	for i := range 2 {
+		resp, _ := s.do("GET", "/prod/limited", "")
+		s.Require().Equal(http.StatusOK, resp.StatusCode, "request %d", i+1)
+	}
+	resp, _ := s.do("GET", "/prod/limited", "")
+	s.Equal(http.StatusTooManyRequests, resp.StatusCode, "over limit")
+	s.NotEmpty(resp.Header.Get("Retry-After"))
+
+	resp, _ = s.do("GET", "/prod/slow", "")
+	s.Equal(http.StatusGatewayTimeout, resp.StatusCode, "slow integration")
+}
+
+// TestGatewaySuite runs the test suite.
+func TestGatewaySuite(t *testing.T) {
+	suite.Run(t, new(GatewaySuite))
+}
@@ -43,20 +43,24 @@ func (m *Manager) CreateDistribution(ctx context.Context, opts cdn.CreateDistrib
 			HTTPPort:   80,
 			HTTPSPort:  443,
 		}},
-		CacheBehaviors:    []cdn.CacheBehavior{},
+		CacheBehaviors:    append([]cdn.CacheBehavior{}, opts.CacheBehaviors...),
 		Enabled:           opts.Enabled,
 		SSLCertificateARN: opts.SSLCertificateARN,
 		PriceClass:        opts.PriceClass,
 		CreatedAt:         time.Now(),
 		LastModified:      time.Now(),
+		DefaultTTL:        opts.DefaultTTL,
 	}
 
+	if len(opts.Origins) > 0 {
+		dist.Origins = append([]cdn.Origin(nil), opts.Origins...)
+	}
 	if dist.PriceClass == "" {
 		dist.PriceClass = "PriceClass_All"
 	}
 
 	m.distributions[id] = dist
-	return dist, nil
+	return clone(dist), nil
 }
 
 func (m *Manager) GetDistribution(ctx context.Context, id string) (*cdn.Distribution, error) {
@@ -67,7 +71,7 @@ func (m *Manager) GetDistribution(ctx context.Context, id string) (*cdn.Distribu
 	if !ok {
 		return nil, errors.NotFound("distribution not found", nil)
 	}
-	return dist, nil
+	return clone(dist), nil
 }
 
 func (m *Manager) ListDistributions(ctx context.Context) ([]*cdn.Distribution, error) {
@@ -76,7 +80,7 @@ func (m *Manager) ListDistributions(ctx context.Context) ([]*cdn.Distribution, e
 
 	result := make([]*cdn.Distribution, 0, len(m.distributions))
 	for _, dist := range m.distributions {
-		result = append(result, dist)
+		result = append(result, clone(dist))
 	}
 	return result, nil
 }
@@ -90,16 +94,24 @@ func (m *Manager) UpdateDistribution(ctx context.Context, id string, opts cdn.Cr
 		return nil, errors.NotFound("distribution not found", nil)
 	}
 
-	if opts.OriginDomain != "" {
+	if len(opts.Origins) > 0 {
+		dist.Origins = append([]cdn.Origin(nil), opts.Origins...)
+	} else if opts.OriginDomain != "" {
 		dist.Origins[0].DomainName = opts.OriginDomain
 	}
+	if opts.CacheBehaviors != nil {
+		dist.CacheBehaviors = append([]cdn.CacheBehavior{}, opts.CacheBehaviors...)
+	}
+	if opts.DefaultTTL > 0 {
+		dist.DefaultTTL = opts.DefaultTTL
+	}
 	if opts.SSLCertificateARN != "" {
 		dist.SSLCertificateARN = opts.SSLCertificateARN
 	}
 	dist.Enabled = opts.Enabled
 	dist.LastModified = time.Now()
 
-	return dist, nil
+	return clone(dist), nil
 }
 
 func (m *Manager) DeleteDistribution(ctx context.Context, id string) error {
@@ -177,3 +189,11 @@ func (m *Manager) GetInvalidation(ctx context.Context, distributionID, invalidat
 	}
 	return nil, errors.NotFound("invalidation not found", nil)
 }
+
+// clone copies a distribution so callers cannot race with updates.
+func clone(dist *cdn.Distribution) *cdn.Distribution {
+	cp := *dist
+	cp.Origins = append([]cdn.Origin(nil), dist.Origins...)
+	cp.CacheBehaviors = append([]cdn.CacheBehavior{}, dist.CacheBehaviors...)
+	return &cp
+}
@@ -87,6 +87,10 @@ type Distribution struct {
 
 	// LastModified is when the distribution was last modified.
 	LastModified time.Time
+
+	// DefaultTTL is the cache TTL in seconds of requests matching no cache
+	// behavior.
+	DefaultTTL int
 }
 
 // Origin represents an origin server.
@@ -112,13 +116,15 @@ type Origin struct {
 
 // CacheBehavior defines caching rules.
 type CacheBehavior struct {
-	// PathPattern is the URL pattern.
+	// PathPattern is the URL path pattern, such as "/images/*.jpg". "*"
+	// matches any characters, including "/", and "?" one character.
 	PathPattern string
 
 	// OriginID is the target origin.
 	OriginID string
 
-	// TTL is the cache TTL in seconds.
+	// TTL is the cache TTL in seconds for responses without Cache-Control
+	// or Expires; 0 uses the distribution's DefaultTTL.
 	TTL int
 
 	// AllowedMethods are allowed HTTP methods.
@@ -136,13 +142,20 @@ type CreateDistributionOptions struct {
 	// OriginDomain is the origin server domain.
 	OriginDomain string
 
+	// Origins replaces the single OriginDomain origin when set.
+	Origins []Origin
+
+	// CacheBehaviors are matched in order; requests matching none use the
+	// first origin with DefaultTTL.
+	CacheBehaviors []CacheBehavior
+
 	// Aliases are alternate domain names (CNAMEs).
 	Aliases []string
 
 	// SSLCertificateARN is the SSL certificate.
 	SSLCertificateARN string
 
-	// DefaultTTL is the default cache TTL.
+	// DefaultTTL is the default cache TTL in seconds.
 	DefaultTTL int
 
 	// PriceClass is the pricing tier.
@@ -193,7 +206,8 @@ type Invalidation struct {
 	// DistributionID is the target distribution.
 	DistributionID string
 
-	// Paths are the paths to invalidate.
+	// Paths are the paths to invalidate, such as "/index.html" or
+	// "/images/*".
 	Paths []string
 
 	// Status is the invalidation status.
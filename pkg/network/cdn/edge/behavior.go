@@ -0,0 +1,142 @@
+package edge
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/cdn"
+)
+
+// Viewer protocol policies.
+const (
+	PolicyAllowAll        = "allow-all"
+	PolicyHTTPSOnly       = "https-only"
+	PolicyRedirectToHTTPS = "redirect-to-https"
+)
+
+type originKey struct{}
+
+// originURL is where a request is sent at an origin.
+type originURL struct {
+	base   *url.URL
+	prefix string // the origin's OriginPath
+}
+
+func (o *originURL) path(p string) string {
+	return strings.TrimSuffix(o.prefix, "/") + p
+}
+
+// behavior is the cache behavior applying to a request, resolved against
+// the distribution.
+type behavior struct {
+	cdn.CacheBehavior
+	origin *originURL
+	ttl    time.Duration
+}
+
+// selectBehavior returns the first cache behavior whose pattern matches
+// the request path, or a default behavior using the first origin.
+func (e *Edge) selectBehavior(d *cdn.Distribution, r *http.Request) (*behavior, bool) {
+	b := &behavior{CacheBehavior: cdn.CacheBehavior{PathPattern: "*"}}
+	for _, cb := range d.CacheBehaviors {
+		if matchPath(cb.PathPattern, r.URL.Path) {
+			b.CacheBehavior = cb
+			break
+		}
+	}
+
+	var origin *cdn.Origin
+	for i := range d.Origins {
+		if b.OriginID == "" || d.Origins[i].ID == b.OriginID {
+			origin = &d.Origins[i]
+			break
+		}
+	}
+	if origin == nil {
+		return nil, false
+	}
+	b.origin = resolveOrigin(origin, r)
+
+	switch {
+	case b.TTL > 0:
+		b.ttl = time.Duration(b.TTL) * time.Second
+	case d.DefaultTTL > 0:
+		b.ttl = time.Duration(d.DefaultTTL) * time.Second
+	default:
+		b.ttl = e.cfg.DefaultTTL
+	}
+	return b, true
+}
+
+// allows reports whether the behavior accepts the request method. Without
+// AllowedMethods only GET and HEAD are accepted.
+func (b *behavior) allows(method string) bool {
+	if len(b.AllowedMethods) == 0 {
+		return method == http.MethodGet || method == http.MethodHead
+	}
+	return slices.ContainsFunc(b.AllowedMethods, func(m string) bool { return strings.EqualFold(m, method) })
+}
+
+func resolveOrigin(o *cdn.Origin, r *http.Request) *originURL {
+	scheme := strings.ToLower(o.Protocol)
+	switch scheme {
+	case "http", "https":
+	case "match-viewer":
+		scheme = "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+	default:
+		scheme = "https"
+	}
+
+	host := o.DomainName
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		port := o.HTTPSPort
+		if scheme == "http" {
+			port = o.HTTPPort
+		}
+		if port != 0 && !(scheme == "http" && port == 80) && !(scheme == "https" && port == 443) {
+			host = net.JoinHostPort(host, strconv.Itoa(port))
+		}
+	}
+	return &originURL{base: &url.URL{Scheme: scheme, Host: host}, prefix: o.OriginPath}
+}
+
+// matchPath matches a path against a CloudFront style pattern: "*"
+// matches any run of characters, including "/", and "?" any one
+// character. Patterns without a leading "/" are rooted.
+func matchPath(pattern, path string) bool {
+	if pattern != "" && pattern[0] != '/' && pattern[0] != '*' {
+		pattern = "/" + pattern
+	}
+
+	// Iterative glob matching with backtracking to the last star.
+	p, s := 0, 0
+	star, mark := -1, 0
+	for s < len(path) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == path[s]):
+			p++
+			s++
+		case p < len(pattern) && pattern[p] == '*':
+			star, mark = p, s
+			p++
+		case star >= 0:
+			p = star + 1
+			mark++
+			s = mark
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
@@ -0,0 +1,34 @@
+/*
+Package edge serves CDN distributions as an embeddable HTTP edge cache.
+
+An Edge serves the distributions of a cdn.CDNManager, routing by Host to
+the distribution with that DomainName, or serving one distribution through
+Handler. Each request takes the first cache behavior whose PathPattern
+matches, which picks the origin, the allowed methods, the viewer protocol
+policy and the TTL used when the origin sends no freshness information.
+
+Origin responses to anonymous GET and HEAD requests are stored in any
+cache.Cache, following HTTP caching rules for a shared cache:
+
+  - Freshness comes from s-maxage, max-age or Expires, falling back to the
+    behavior's TTL; no-store, private and Vary: * responses are not stored.
+  - Vary selects between stored variants of a path.
+  - Expired objects with an ETag or Last-Modified are revalidated with a
+    conditional request, and stale-while-revalidate serves them while they
+    are refreshed in the background.
+  - Concurrent misses for an object are coalesced into one origin request.
+  - Viewer If-None-Match and If-Modified-Since are answered from the cache.
+
+Responses carry X-Cache (HIT, MISS, STALE, REVALIDATED or BYPASS) and Age.
+
+Edge also wraps the manager: Invalidate purges the matching objects the
+edge cached, and responses fetched before an invalidation are not stored.
+
+Usage:
+
+	import "github.com/chris-alexander-pop/system-design-library/pkg/network/cdn/edge"
+
+	e := edge.New(edge.Config{}, manager, cache)
+	err := e.ListenAndServe(ctx)
+*/
+package edge
@@ -0,0 +1,294 @@
+package edge
+
+import (
+	"context"
+	stderrors "errors"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/cache"
+	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/cdn"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+)
+
+// Config holds configuration for the edge server.
+type Config struct {
+	// Addr is the address ListenAndServe binds.
+	Addr string `env:"CDN_EDGE_ADDR" env-default:":8080"`
+
+	// DefaultTTL applies to responses without Cache-Control or Expires
+	// when neither the cache behavior nor the distribution sets a TTL.
+	DefaultTTL time.Duration `env:"CDN_EDGE_DEFAULT_TTL" env-default:"24h"`
+
+	// StaleRetention is how long expired objects with an ETag or
+	// Last-Modified are kept for conditional revalidation.
+	StaleRetention time.Duration `env:"CDN_EDGE_STALE_RETENTION" env-default:"1h"`
+
+	// MaxObjectSize is the largest response body cached, in bytes. Larger
+	// responses are streamed from the origin.
+	MaxObjectSize int64 `env:"CDN_EDGE_MAX_OBJECT_SIZE" env-default:"10485760"`
+
+	// OriginTimeout bounds a request to an origin, including its body.
+	OriginTimeout time.Duration `env:"CDN_EDGE_ORIGIN_TIMEOUT" env-default:"30s"`
+
+	// KeyPrefix namespaces the edge's keys in the cache.
+	KeyPrefix string `env:"CDN_EDGE_KEY_PREFIX" env-default:"cdn:"`
+
+	// Transport sends requests to origins; it defaults to
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
+// Cache statuses, reported in the X-Cache response header.
+const (
+	StatusHit         = "HIT"
+	StatusMiss        = "MISS"
+	StatusStale       = "STALE"
+	StatusRevalidated = "REVALIDATED"
+	StatusBypass      = "BYPASS"
+)
+
+// Edge serves CDN distributions over HTTP, caching origin responses in a
+// cache.Cache.
+//
+// Edge wraps a CDNManager: invalidations created through it purge the
+// objects this edge cached. All other calls pass through.
+type Edge struct {
+	cdn.CDNManager
+
+	cfg    Config
+	store  cache.Cache
+	tracer trace.Tracer
+	client *http.Client
+	proxy  *httputil.ReverseProxy
+	flight singleflight.Group
+
+	mu sync.Mutex
+	// keys are the cache keys written per distribution and path, for
+	// purging, with when they expire from the cache.
+	keys map[string]map[string]map[string]time.Time
+	// swept is when expired keys were last dropped.
+	swept time.Time
+	// purged is when each distribution was last invalidated. Responses
+	// fetched before then are not stored.
+	purged map[string]time.Time
+}
+
+// New creates an edge serving the distributions of manager from store.
+func New(cfg Config, manager cdn.CDNManager, store cache.Cache) *Edge {
+	if cfg.Addr == "" {
+		cfg.Addr = ":8080"
+	}
+	if cfg.DefaultTTL <= 0 {
+		cfg.DefaultTTL = 24 * time.Hour
+	}
+	if cfg.StaleRetention <= 0 {
+		cfg.StaleRetention = time.Hour
+	}
+	if cfg.MaxObjectSize <= 0 {
+		cfg.MaxObjectSize = 10 << 20
+	}
+	if cfg.OriginTimeout <= 0 {
+		cfg.OriginTimeout = 30 * time.Second
+	}
+	if cfg.KeyPrefix == "" {
+		cfg.KeyPrefix = "cdn:"
+	}
+	if cfg.Transport == nil {
+		cfg.Transport = http.DefaultTransport
+	}
+
+	e := &Edge{
+		CDNManager: manager,
+		cfg:        cfg,
+		store:      store,
+		tracer:     instrument.NewTracer("pkg/network/cdn/edge"),
+		client: &http.Client{
+			Transport: cfg.Transport,
+			Timeout:   cfg.OriginTimeout,
+			// Redirects are cached and returned to viewers as they are.
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		keys:   make(map[string]map[string]map[string]time.Time),
+		purged: make(map[string]time.Time),
+	}
+	e.proxy = &httputil.ReverseProxy{
+		Transport: cfg.Transport,
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			o := pr.In.Context().Value(originKey{}).(*originURL)
+			pr.SetURL(o.base)
+			pr.SetXForwarded()
+			pr.Out.URL.Path = o.path(pr.In.URL.Path)
+			pr.Out.URL.RawPath = ""
+			pr.Out.Header.Del("X-Cache")
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			resp.Header.Set("X-Cache", StatusBypass)
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			trace.SpanFromContext(r.Context()).RecordError(err)
+			logger.L().WarnContext(r.Context(), "cdn origin request failed", "error", err)
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+	return e
+}
+
+// ListenAndServe serves all enabled distributions on cfg.Addr, routing
+// requests by Host to the distribution with that DomainName, until ctx is
+// cancelled.
+func (e *Edge) ListenAndServe(ctx context.Context) error {
+	srv := &http.Server{
+		Addr:              e.cfg.Addr,
+		Handler:           e,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+	if err := srv.ListenAndServe(); err != nil && !stderrors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// ServeHTTP serves the distribution whose DomainName is the request host.
+func (e *Edge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	dists, err := e.ListDistributions(r.Context())
+	if err != nil {
+		http.Error(w, "distribution lookup failed", http.StatusBadGateway)
+		return
+	}
+	for _, d := range dists {
+		if strings.EqualFold(d.DomainName, host) {
+			e.serve(w, r, d)
+			return
+		}
+	}
+	http.Error(w, "unknown distribution", http.StatusNotFound)
+}
+
+// Handler serves one distribution regardless of the request host.
+func (e *Edge) Handler(distributionID string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d, err := e.GetDistribution(r.Context(), distributionID)
+		if err != nil {
+			http.Error(w, "unknown distribution", http.StatusNotFound)
+			return
+		}
+		e.serve(w, r, d)
+	})
+}
+
+// Invalidate creates the invalidation with the manager, then deletes the
+// cached objects whose paths match. Only objects cached by this edge are
+// known to it; edges sharing a cache should all be invalidated.
+func (e *Edge) Invalidate(ctx context.Context, distributionID string, paths []string) (*cdn.Invalidation, error) {
+	inv, err := e.CDNManager.Invalidate(ctx, distributionID, paths)
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	e.purged[distributionID] = time.Now()
+	var keys []string
+	for path, pathKeys := range e.keys[distributionID] {
+		if !matchAny(paths, path) {
+			continue
+		}
+		for key := range pathKeys {
+			keys = append(keys, key)
+		}
+		delete(e.keys[distributionID], path)
+	}
+	if len(e.keys[distributionID]) == 0 {
+		delete(e.keys, distributionID)
+	}
+	e.mu.Unlock()
+
+	for _, key := range keys {
+		if err := e.store.Delete(ctx, key); err != nil {
+			logger.L().WarnContext(ctx, "failed to purge cdn object", "key", key, "error", err)
+		}
+	}
+	logger.L().InfoContext(ctx, "cdn invalidation purged objects", "distribution", distributionID, "paths", paths, "objects", len(keys))
+	return inv, nil
+}
+
+// sweepInterval is how often remember drops the keys that have expired
+// from the cache.
+const sweepInterval = time.Minute
+
+// remember records keys written for path, expiring from the cache at
+// expires, so invalidations can purge them. It reports false, and records
+// nothing, if the distribution was invalidated after fetched, in which
+// case the response must not be stored.
+func (e *Edge) remember(distributionID, path string, fetched, expires time.Time, keys ...string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if fetched.Before(e.purged[distributionID]) {
+		return false
+	}
+	if now := time.Now(); now.Sub(e.swept) >= sweepInterval {
+		e.sweep(now)
+	}
+	paths, ok := e.keys[distributionID]
+	if !ok {
+		paths = make(map[string]map[string]time.Time)
+		e.keys[distributionID] = paths
+	}
+	if paths[path] == nil {
+		paths[path] = make(map[string]time.Time)
+	}
+	for _, key := range keys {
+		paths[path][key] = later(paths[path][key], expires)
+	}
+	return true
+}
+
+// sweep drops the keys that have expired from the cache, so the index
+// does not outgrow it.
+func (e *Edge) sweep(now time.Time) {
+	e.swept = now
+	for distributionID, paths := range e.keys {
+		for path, pathKeys := range paths {
+			for key, expires := range pathKeys {
+				if now.After(expires) {
+					delete(pathKeys, key)
+				}
+			}
+			if len(pathKeys) == 0 {
+				delete(paths, path)
+			}
+		}
+		if len(paths) == 0 {
+			delete(e.keys, distributionID)
+		}
+	}
+}
+
+func matchAny(patterns []string, path string) bool {
+	for _, p := range patterns {
+		if matchPath(p, path) {
+			return true
+		}
+	}
+	return false
+}
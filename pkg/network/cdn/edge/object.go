@@ -0,0 +1,201 @@
+package edge
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// object is a cached response.
+type object struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+
+	// Received is when the response was generated, adjusted for the Age
+	// the origin reported, and is the base of the Age header.
+	Received time.Time `json:"received"`
+	// FreshUntil is when the object must be revalidated; StaleUntil ends
+	// the stale-while-revalidate window.
+	FreshUntil time.Time `json:"fresh_until"`
+	StaleUntil time.Time `json:"stale_until"`
+}
+
+// variants records the request headers a cached path varies on.
+type variants struct {
+	Vary []string `json:"vary"`
+}
+
+func (o *object) fresh(now time.Time) bool {
+	return now.Before(o.FreshUntil)
+}
+
+func (o *object) serveStale(now time.Time) bool {
+	return now.Before(o.StaleUntil)
+}
+
+func (o *object) validators() bool {
+	return o.Header.Get("ETag") != "" || o.Header.Get("Last-Modified") != ""
+}
+
+// cacheable statuses are those RFC 9110 makes heuristically cacheable.
+var cacheable = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+// cacheControl parses Cache-Control directives, lowercasing names.
+func cacheControl(h http.Header) map[string]string {
+	cc := make(map[string]string)
+	for _, v := range h.Values("Cache-Control") {
+		for _, d := range strings.Split(v, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(d), "=")
+			if name == "" {
+				continue
+			}
+			cc[strings.ToLower(name)] = strings.Trim(value, `"`)
+		}
+	}
+	return cc
+}
+
+func seconds(v string) (time.Duration, bool) {
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// newObject builds the cache entry for an origin response received at
+// now, or returns nil if it may not be stored. Freshness comes from
+// s-maxage, max-age, then Expires, falling back to ttl.
+func newObject(status int, h http.Header, body []byte, now time.Time, ttl time.Duration) *object {
+	if !cacheable[status] {
+		return nil
+	}
+	cc := cacheControl(h)
+	if _, ok := cc["no-store"]; ok {
+		return nil
+	}
+	if _, ok := cc["private"]; ok {
+		return nil
+	}
+	if h.Get("Set-Cookie") != "" {
+		if _, ok := cc["public"]; !ok {
+			return nil
+		}
+	}
+	if slices.Contains(varyHeaders(h), "*") {
+		return nil
+	}
+
+	var age time.Duration
+	if a, ok := seconds(h.Get("Age")); ok {
+		age = a
+	}
+
+	lifetime := ttl
+	if v, ok := seconds(cc["s-maxage"]); ok {
+		lifetime = v
+	} else if v, ok := seconds(cc["max-age"]); ok {
+		lifetime = v
+	} else if v := h.Get("Expires"); v != "" {
+		lifetime = 0
+		if exp, err := http.ParseTime(v); err == nil {
+			date := now
+			if d, err := http.ParseTime(h.Get("Date")); err == nil {
+				date = d
+			}
+			lifetime = max(exp.Sub(date), 0)
+		}
+	}
+	if _, ok := cc["no-cache"]; ok {
+		lifetime = 0
+	}
+
+	o := &object{
+		Status:   status,
+		Header:   h.Clone(),
+		Body:     body,
+		Received: now.Add(-age),
+	}
+	// Age is computed from Received when serving.
+	o.Header.Del("Age")
+	o.FreshUntil = o.Received.Add(lifetime)
+	o.StaleUntil = o.FreshUntil
+	if v, ok := seconds(cc["stale-while-revalidate"]); ok {
+		o.StaleUntil = o.FreshUntil.Add(v)
+	}
+	if !o.fresh(now) && !o.serveStale(now) && !o.validators() {
+		return nil
+	}
+	return o
+}
+
+// retention is how long the object is kept in the cache.
+func (o *object) retention(now time.Time, staleRetention time.Duration) time.Duration {
+	until := o.StaleUntil
+	if o.validators() {
+		until = later(until, o.FreshUntil.Add(staleRetention))
+	}
+	return max(until.Sub(now), time.Second)
+}
+
+// revalidated refreshes the object from a 304 response, whose headers
+// replace the stored ones.
+func (o *object) revalidated(h http.Header, now time.Time, ttl time.Duration) *object {
+	merged := o.Header.Clone()
+	for name, values := range h {
+		if name != "Content-Length" {
+			merged[name] = values
+		}
+	}
+	return newObject(o.Status, merged, o.Body, now, ttl)
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// varyHeaders returns the canonical request header names in Vary.
+func varyHeaders(h http.Header) []string {
+	var names []string
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// variantKey derives the cache key of the request's variant.
+func variantKey(base string, vary []string, r *http.Request) string {
+	if len(vary) == 0 {
+		return base + "#"
+	}
+	sum := sha256.New()
+	for _, name := range vary {
+		sum.Write([]byte(name + ":" + strings.Join(r.Header.Values(name), ",") + "\n"))
+	}
+	return base + "#" + hex.EncodeToString(sum.Sum(nil)[:16])
+}
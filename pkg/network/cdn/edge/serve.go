@@ -0,0 +1,330 @@
+package edge
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/cdn"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// hopHeaders are not forwarded between viewer, edge and origin.
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Connection", "Proxy-Authenticate",
+	"Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// conditionalHeaders are the viewer's conditions, answered by the edge
+// rather than passed to the origin.
+var conditionalHeaders = []string{
+	"If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since", "If-Range",
+}
+
+// errTooLarge means an origin response exceeded MaxObjectSize.
+var errTooLarge = errors.Internal("origin response too large to cache", nil)
+
+// fetched is an origin response, shared by the coalesced requests.
+type fetched struct {
+	obj    *object
+	status string
+	stored bool
+	// key is the variant key the object was stored under.
+	key string
+}
+
+func (e *Edge) serve(w http.ResponseWriter, r *http.Request, d *cdn.Distribution) {
+	ctx, span := e.tracer.Start(r.Context(), "cdn.EdgeRequest", trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+		attribute.String("cdn.distribution.id", d.ID),
+		attribute.String("http.request.method", r.Method),
+		attribute.String("url.path", r.URL.Path),
+	))
+	defer span.End()
+	r = r.WithContext(ctx)
+
+	if !d.Enabled {
+		http.Error(w, "distribution disabled", http.StatusServiceUnavailable)
+		return
+	}
+	b, ok := e.selectBehavior(d, r)
+	if !ok {
+		span.SetStatus(codes.Error, "no origin")
+		http.Error(w, "no origin", http.StatusBadGateway)
+		return
+	}
+	span.SetAttributes(attribute.String("cdn.behavior", b.PathPattern))
+
+	if r.TLS == nil {
+		switch b.ViewerProtocolPolicy {
+		case PolicyHTTPSOnly:
+			http.Error(w, "https required", http.StatusForbidden)
+			return
+		case PolicyRedirectToHTTPS:
+			http.Redirect(w, r, "https://"+r.Host+r.URL.RequestURI(), http.StatusMovedPermanently)
+			return
+		}
+	}
+	if !b.allows(r.Method) {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Only anonymous, whole GET and HEAD requests are cached.
+	status := StatusBypass
+	if (r.Method == http.MethodGet || r.Method == http.MethodHead) &&
+		r.Header.Get("Authorization") == "" && r.Header.Get("Range") == "" {
+		status = e.serveCached(w, r, d.ID, b)
+	} else {
+		e.proxy.ServeHTTP(w, r.WithContext(context.WithValue(ctx, originKey{}, b.origin)))
+	}
+	span.SetAttributes(attribute.String("cdn.cache.status", status))
+}
+
+// serveCached answers from the cache, or fetches from the origin with
+// concurrent misses for the same object coalesced into one request.
+func (e *Edge) serveCached(w http.ResponseWriter, r *http.Request, distributionID string, b *behavior) string {
+	ctx := r.Context()
+	base := e.cfg.KeyPrefix + distributionID + ":" + r.URL.Path + "?" + r.URL.RawQuery
+	key := base + "#"
+
+	var stale *object
+	var vary variants
+	if err := e.store.Get(ctx, base, &vary); err == nil {
+		key = variantKey(base, vary.Vary, r)
+		var obj object
+		if err := e.store.Get(ctx, key, &obj); err == nil {
+			now := time.Now()
+			switch {
+			case obj.fresh(now):
+				e.respond(w, r, &obj, StatusHit)
+				return StatusHit
+			case obj.serveStale(now):
+				e.refresh(r, distributionID, b, base, key, &obj)
+				e.respond(w, r, &obj, StatusStale)
+				return StatusStale
+			case obj.validators():
+				stale = &obj
+			}
+		}
+	}
+
+	// The fetch outlives the viewer that started it, since others may be
+	// waiting on it.
+	fetchCtx := context.WithoutCancel(ctx)
+	fetch := func() (any, error) {
+		return e.fetch(fetchCtx, r, distributionID, b, base, stale)
+	}
+	v, err, shared := e.flight.Do(key, fetch)
+	if err == nil && shared {
+		// Until the Vary of a path is known, its misses coalesce on the
+		// key of no variant; a viewer differing from the one that fetched
+		// in a varied header needs its own variant.
+		f := v.(*fetched)
+		if variant := variantKey(base, varyHeaders(f.obj.Header), r); f.stored && variant != f.key {
+			v, err, shared = e.flight.Do(variant, fetch)
+		}
+	}
+	if err == nil && shared && !v.(*fetched).stored {
+		// Responses that may not be cached may not be shared either.
+		v, err = e.fetch(fetchCtx, r, distributionID, b, base, stale)
+	}
+	if errors.Is(err, errTooLarge) {
+		e.proxy.ServeHTTP(w, r.WithContext(context.WithValue(ctx, originKey{}, b.origin)))
+		return StatusBypass
+	}
+	if err != nil {
+		span := trace.SpanFromContext(ctx)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		logger.L().WarnContext(ctx, "cdn origin request failed", "distribution", distributionID, "path", r.URL.Path, "error", err)
+		http.Error(w, "origin unreachable", http.StatusBadGateway)
+		return StatusMiss
+	}
+
+	f := v.(*fetched)
+	e.respond(w, r, f.obj, f.status)
+	return f.status
+}
+
+// refresh revalidates a stale object in the background.
+func (e *Edge) refresh(r *http.Request, distributionID string, b *behavior, base, key string, stale *object) {
+	ctx := context.WithoutCancel(r.Context())
+	r = r.Clone(ctx)
+	go func() {
+		_, err, _ := e.flight.Do(key, func() (any, error) {
+			return e.fetch(ctx, r, distributionID, b, base, stale)
+		})
+		if err != nil && !errors.Is(err, errTooLarge) {
+			logger.L().WarnContext(ctx, "cdn background revalidation failed", "distribution", distributionID, "path", r.URL.Path, "error", err)
+		}
+	}()
+}
+
+// fetch requests an object from the origin, conditionally if a stale copy
+// with validators is cached, and stores the response if it may be.
+func (e *Edge) fetch(ctx context.Context, r *http.Request, distributionID string, b *behavior, base string, stale *object) (*fetched, error) {
+	req, err := e.originRequest(ctx, r, b)
+	if err != nil {
+		return nil, err
+	}
+	if stale != nil {
+		if etag := stale.Header.Get("ETag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if lm := stale.Header.Get("Last-Modified"); lm != "" {
+			req.Header.Set("If-Modified-Since", lm)
+		}
+	}
+
+	started := time.Now()
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	removeHeaders(resp.Header, hopHeaders)
+
+	if resp.StatusCode == http.StatusNotModified && stale != nil {
+		obj := stale.revalidated(resp.Header, time.Now(), b.ttl)
+		if obj == nil {
+			// The origin no longer allows caching; serve the body once.
+			obj = &object{Status: stale.Status, Header: stale.Header, Body: stale.Body}
+			return &fetched{obj: obj, status: StatusRevalidated}, nil
+		}
+		key, stored := e.put(ctx, r, distributionID, base, varyHeaders(obj.Header), obj, started)
+		return &fetched{obj: obj, status: StatusRevalidated, stored: stored, key: key}, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, e.cfg.MaxObjectSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > e.cfg.MaxObjectSize {
+		return nil, errTooLarge
+	}
+
+	obj := newObject(resp.StatusCode, resp.Header, body, time.Now(), b.ttl)
+	if obj == nil {
+		obj = &object{Status: resp.StatusCode, Header: resp.Header, Body: body}
+		return &fetched{obj: obj, status: StatusMiss}, nil
+	}
+	key, stored := e.put(ctx, r, distributionID, base, varyHeaders(resp.Header), obj, started)
+	return &fetched{obj: obj, status: StatusMiss, stored: stored, key: key}, nil
+}
+
+// put stores an object and the Vary of its path, returning the object's
+// key.
+func (e *Edge) put(ctx context.Context, r *http.Request, distributionID, base string, vary []string, obj *object, started time.Time) (string, bool) {
+	key := variantKey(base, vary, r)
+	now := time.Now()
+	ttl := obj.retention(now, e.cfg.StaleRetention)
+	if !e.remember(distributionID, r.URL.Path, started, now.Add(ttl), base, key) {
+		return key, false
+	}
+	if err := e.store.Set(ctx, base, variants{Vary: vary}, ttl); err != nil {
+		logger.L().WarnContext(ctx, "failed to cache cdn object", "key", base, "error", err)
+		return key, false
+	}
+	if err := e.store.Set(ctx, key, obj, ttl); err != nil {
+		logger.L().WarnContext(ctx, "failed to cache cdn object", "key", key, "error", err)
+		return key, false
+	}
+	return key, true
+}
+
+// originRequest builds the GET sent to the origin for a viewer request.
+func (e *Edge) originRequest(ctx context.Context, r *http.Request, b *behavior) (*http.Request, error) {
+	u := *b.origin.base
+	u.Path = b.origin.path(r.URL.Path)
+	u.RawQuery = r.URL.RawQuery
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = r.Header.Clone()
+	removeHeaders(req.Header, hopHeaders)
+	removeHeaders(req.Header, conditionalHeaders)
+	req.Header.Del("X-Cache")
+
+	if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		if prior := req.Header.Get("X-Forwarded-For"); prior != "" {
+			ip = prior + ", " + ip
+		}
+		req.Header.Set("X-Forwarded-For", ip)
+	}
+	req.Header.Set("X-Forwarded-Host", r.Host)
+	proto := "http"
+	if r.TLS != nil {
+		proto = "https"
+	}
+	req.Header.Set("X-Forwarded-Proto", proto)
+	return req, nil
+}
+
+// respond writes an object to the viewer, answering conditional requests
+// from it.
+func (e *Edge) respond(w http.ResponseWriter, r *http.Request, obj *object, status string) {
+	h := w.Header()
+	for name, values := range obj.Header {
+		h[name] = values
+	}
+	h.Set("X-Cache", status)
+	if !obj.Received.IsZero() {
+		age := max(time.Since(obj.Received), 0)
+		h.Set("Age", strconv.FormatInt(int64(age/time.Second), 10))
+	}
+
+	if obj.Status == http.StatusOK && notModified(r, obj) {
+		h.Del("Content-Length")
+		h.Del("Content-Type")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if obj.Status != http.StatusNoContent {
+		h.Set("Content-Length", strconv.Itoa(len(obj.Body)))
+	}
+	w.WriteHeader(obj.Status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(obj.Body)
+	}
+}
+
+// notModified evaluates If-None-Match, or failing that If-Modified-Since,
+// against an object.
+func notModified(r *http.Request, obj *object) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		etag := strings.TrimPrefix(obj.Header.Get("ETag"), "W/")
+		if etag == "" {
+			return false
+		}
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lm, err := http.ParseTime(obj.Header.Get("Last-Modified"))
+	return err == nil && !lm.After(ims)
+}
+
+func removeHeaders(h http.Header, names []string) {
+	for _, name := range names {
+		h.Del(name)
+	}
+}
@@ -0,0 +1,411 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cachememory "github.com/chris-alexander-pop/system-design-library/pkg/cache/adapters/memory"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/cdn"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/cdn/adapters/memory"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/cdn/edge"
+	"github.com/stretchr/testify/suite"
+)
+
+// origin is a test origin server counting the requests it receives.
+type origin struct {
+	*httptest.Server
+	hits    atomic.Int64
+	mu      sync.Mutex
+	handler http.HandlerFunc
+	last    http.Header
+}
+
+func (o *origin) set(handler http.HandlerFunc) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.handler = handler
+}
+
+func (o *origin) lastHeader() http.Header {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.last
+}
+
+func (o *origin) host() string {
+	return strings.TrimPrefix(o.URL, "http://")
+}
+
+func originOpts(origins ...*origin) cdn.CreateDistributionOptions {
+	var opts cdn.CreateDistributionOptions
+	for i, o := range origins {
+		opts.Origins = append(opts.Origins, cdn.Origin{ID: fmt.Sprintf("origin-%d", i+1), DomainName: o.host(), Protocol: "http"})
+	}
+	return opts
+}
+
+// EdgeSuite tests the CDN edge against origins on the loopback interface.
+type EdgeSuite struct {
+	suite.Suite
+	edge    *edge.Edge
+	dist    *cdn.Distribution
+	srv     *httptest.Server
+	servers []*httptest.Server
+	ctx     context.Context
+}
+
+// SetupTest creates an edge with an empty cache.
+func (s *EdgeSuite) SetupTest() {
+	s.ctx = context.Background()
+	s.edge = edge.New(edge.Config{}, memory.New(), cachememory.New())
+	s.servers = nil
+}
+
+// TearDownTest stops the edge and origin servers of the test.
+func (s *EdgeSuite) TearDownTest() {
+	for _, srv := range s.servers {
+		srv.Close()
+	}
+}
+
+// origin starts an origin server.
+func (s *EdgeSuite) origin(handler http.HandlerFunc) *origin {
+	o := &origin{handler: handler}
+	o.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		o.hits.Add(1)
+		o.mu.Lock()
+		o.last = r.Header.Clone()
+		h := o.handler
+		o.mu.Unlock()
+		h(w, r)
+	}))
+	s.servers = append(s.servers, o.Server)
+	return o
+}
+
+// serve creates an enabled distribution and serves it.
+func (s *EdgeSuite) serve(opts cdn.CreateDistributionOptions) {
+	opts.Enabled = true
+	dist, err := s.edge.CreateDistribution(s.ctx, opts)
+	s.Require().NoError(err)
+	s.dist = dist
+	s.srv = httptest.NewServer(s.edge.Handler(dist.ID))
+	s.servers = append(s.servers, s.srv)
+}
+
+func (s *EdgeSuite) get(path string, header ...string) (*http.Response, string) {
+	return s.do(http.MethodGet, path, header...)
+}
+
+func (s *EdgeSuite) do(method, path string, header ...string) (*http.Response, string) {
+	req, err := http.NewRequestWithContext(s.ctx, method, s.srv.URL+path, nil)
+	s.Require().NoError(err)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err, "%s %s", method, path)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+// get fetches url outside the suite's assertions, for use in goroutines
+// and polls.
+func get(url string) (*http.Response, string, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	return resp, string(b), err
+}
+
+func (s *EdgeSuite) expect(path, status, body string, header ...string) *http.Response {
+	resp, got := s.get(path, header...)
+	s.Require().Equal(status, resp.Header.Get("X-Cache"), "GET %s", path)
+	s.Require().Equal(body, got, "GET %s", path)
+	return resp
+}
+
+func (s *EdgeSuite) TestCachesByCacheControl() {
+	o := s.origin(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/static.css":
+			w.Header().Set("Cache-Control", "public, max-age=300")
+		case "/private":
+			w.Header().Set("Cache-Control", "private, max-age=300")
+		case "/nostore":
+			w.Header().Set("Cache-Control", "no-store")
+		case "/expires":
+			w.Header().Set("Expires", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+		case "/expired":
+			w.Header().Set("Expires", "0")
+		}
+		fmt.Fprint(w, r.URL.Path)
+	})
+	s.serve(originOpts(o))
+
+	s.expect("/static.css", edge.StatusMiss, "/static.css")
+	resp := s.expect("/static.css", edge.StatusHit, "/static.css")
+	s.NotEmpty(resp.Header.Get("Age"))
+	s.Equal("public, max-age=300", resp.Header.Get("Cache-Control"))
+	s.expect("/static.css?v=2", edge.StatusMiss, "/static.css")
+	s.expect("/expires", edge.StatusMiss, "/expires")
+	s.expect("/expires", edge.StatusHit, "/expires")
+	// Without freshness information the default TTL applies.
+	s.expect("/plain", edge.StatusMiss, "/plain")
+	s.expect("/plain", edge.StatusHit, "/plain")
+	s.Equal(int64(4), o.hits.Load(), "origin hits")
+
+	for _, path := range []string{"/private", "/nostore", "/expired"} {
+		s.expect(path, edge.StatusMiss, path)
+		s.expect(path, edge.StatusMiss, path)
+	}
+
+	// Authorized requests are never served from the cache.
+	s.expect("/static.css", edge.StatusBypass, "/static.css", "Authorization", "Bearer x")
+}
+
+func (s *EdgeSuite) TestRevalidatesWithValidators() {
+	var version atomic.Int64
+	version.Store(1)
+	o := s.origin(func(w http.ResponseWriter, r *http.Request) {
+		etag := fmt.Sprintf(`"v%d"`, version.Load())
+		w.Header().Set("Cache-Control", "max-age=1")
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fmt.Fprintf(w, "version %d", version.Load())
+	})
+	s.serve(originOpts(o))
+
+	s.expect("/doc", edge.StatusMiss, "version 1")
+	time.Sleep(1100 * time.Millisecond)
+	s.expect("/doc", edge.StatusRevalidated, "version 1")
+	s.Equal(`"v1"`, o.lastHeader().Get("If-None-Match"), "origin If-None-Match")
+	s.expect("/doc", edge.StatusHit, "version 1")
+
+	version.Store(2)
+	time.Sleep(1100 * time.Millisecond)
+	s.expect("/doc", edge.StatusMiss, "version 2")
+
+	// Viewer validators are answered by the edge.
+	resp, _ := s.get("/doc", "If-None-Match", `"v2"`)
+	s.Equal(http.StatusNotModified, resp.StatusCode, "conditional GET")
+	s.Equal(edge.StatusHit, resp.Header.Get("X-Cache"), "conditional GET")
+	s.Equal(int64(3), o.hits.Load(), "origin hits")
+}
+
+func (s *EdgeSuite) TestStaleWhileRevalidate() {
+	var version atomic.Int64
+	version.Store(1)
+	o := s.origin(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=1, stale-while-revalidate=60")
+		fmt.Fprintf(w, "version %d", version.Load())
+	})
+	s.serve(originOpts(o))
+
+	s.expect("/feed", edge.StatusMiss, "version 1")
+	version.Store(2)
+	time.Sleep(1100 * time.Millisecond)
+	s.expect("/feed", edge.StatusStale, "version 1")
+
+	s.Eventually(func() bool {
+		resp, body, err := get(s.srv.URL + "/feed")
+		return err == nil && resp.Header.Get("X-Cache") == edge.StatusHit && body == "version 2"
+	}, 2*time.Second, 20*time.Millisecond, "background refresh stored")
+}
+
+func (s *EdgeSuite) TestVary() {
+	o := s.origin(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=300")
+		w.Header().Set("Vary", "Accept-Language")
+		fmt.Fprintf(w, "hello in %s", r.Header.Get("Accept-Language"))
+	})
+	s.serve(originOpts(o))
+
+	s.expect("/", edge.StatusMiss, "hello in en", "Accept-Language", "en")
+	s.expect("/", edge.StatusMiss, "hello in fr", "Accept-Language", "fr")
+	s.expect("/", edge.StatusHit, "hello in en", "Accept-Language", "en")
+	s.expect("/", edge.StatusHit, "hello in fr", "Accept-Language", "fr")
+	s.Equal(int64(2), o.hits.Load(), "origin hits")
+}
+
+func (s *EdgeSuite) TestCoalescesMisses() {
+	release := make(chan struct{})
+	o := s.origin(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Header().Set("Cache-Control", "max-age=300")
+		fmt.Fprint(w, "popular")
+	})
+	s.serve(originOpts(o))
+
+	const viewers = 10
+	var wg sync.WaitGroup
+	bodies := make(chan string, viewers)
+	for i := 0; i < viewers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, body, err := get(s.srv.URL + "/popular")
+			if err != nil {
+				body = err.Error()
+			}
+			bodies <- body
+		}()
+	}
+	// Let the requests reach the edge before the origin answers.
+	time.Sleep(200 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(bodies)
+
+	for b := range bodies {
+		s.Equal("popular", b)
+	}
+	s.Equal(int64(1), o.hits.Load(), "origin hits")
+}
+
+func (s *EdgeSuite) TestCoalescedMissesKeepVariants() {
+	release := make(chan struct{})
+	o := s.origin(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Header().Set("Cache-Control", "max-age=300")
+		w.Header().Set("Vary", "Accept-Language")
+		fmt.Fprintf(w, "hello in %s", r.Header.Get("Accept-Language"))
+	})
+	s.serve(originOpts(o))
+
+	langs := []string{"en", "fr", "en", "fr"}
+	var wg sync.WaitGroup
+	bodies := make([]string, len(langs))
+	for i, lang := range langs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest(http.MethodGet, s.srv.URL+"/", nil)
+			req.Header.Set("Accept-Language", lang)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				bodies[i] = err.Error()
+				return
+			}
+			defer resp.Body.Close()
+			b, _ := io.ReadAll(resp.Body)
+			bodies[i] = string(b)
+		}()
+	}
+	// Let the requests reach the edge before the origin answers.
+	time.Sleep(200 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for i, lang := range langs {
+		s.Equal("hello in "+lang, bodies[i], "viewer %d", i)
+	}
+	s.expect("/", edge.StatusHit, "hello in en", "Accept-Language", "en")
+	s.expect("/", edge.StatusHit, "hello in fr", "Accept-Language", "fr")
+}
+
+func (s *EdgeSuite) TestInvalidationPurges() {
+	var version atomic.Int64
+	version.Store(1)
+	o := s.origin(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=300")
+		fmt.Fprintf(w, "%s v%d", r.URL.Path, version.Load())
+	})
+	s.serve(originOpts(o))
+
+	for _, path := range []string{"/img/a.png", "/img/b.png", "/index.html"} {
+		s.expect(path, edge.StatusMiss, path+" v1")
+	}
+	version.Store(2)
+
+	inv, err := s.edge.Invalidate(s.ctx, s.dist.ID, []string{"/img/*"})
+	s.Require().NoError(err)
+	_, err = s.edge.GetInvalidation(s.ctx, s.dist.ID, inv.ID)
+	s.NoError(err, "invalidation recorded")
+
+	s.expect("/img/a.png", edge.StatusMiss, "/img/a.png v2")
+	s.expect("/img/b.png", edge.StatusMiss, "/img/b.png v2")
+	s.expect("/index.html", edge.StatusHit, "/index.html v1")
+}
+
+func (s *EdgeSuite) TestCacheBehaviors() {
+	web := s.origin(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "web %s %s", r.Method, r.URL.Path)
+	})
+	api := s.origin(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache")
+		fmt.Fprintf(w, "api %s %s", r.Method, r.URL.Path)
+	})
+	opts := originOpts(web, api)
+	opts.Origins[1].OriginPath = "/v1"
+	opts.CacheBehaviors = []cdn.CacheBehavior{
+		{PathPattern: "/api/*", OriginID: "origin-2", AllowedMethods: []string{"GET", "HEAD", "POST"}},
+		{PathPattern: "*.jpg", OriginID: "origin-1", TTL: 1},
+		{PathPattern: "/secure/*", OriginID: "origin-1", ViewerProtocolPolicy: edge.PolicyRedirectToHTTPS},
+	}
+	s.serve(opts)
+
+	s.expect("/api/users", edge.StatusMiss, "api GET /v1/api/users")
+	s.expect("/api/users", edge.StatusMiss, "api GET /v1/api/users")
+	resp, body := s.do(http.MethodPost, "/api/users")
+	s.Equal(edge.StatusBypass, resp.Header.Get("X-Cache"), "POST")
+	s.Equal("api POST /v1/api/users", body)
+	resp, _ = s.do(http.MethodDelete, "/api/users")
+	s.Equal(http.StatusMethodNotAllowed, resp.StatusCode, "DELETE")
+	resp, _ = s.do(http.MethodPost, "/index.html")
+	s.Equal(http.StatusMethodNotAllowed, resp.StatusCode, "POST to the default behavior")
+
+	// The behavior TTL applies to responses without Cache-Control.
+	s.expect("/photos/cat.jpg", edge.StatusMiss, "web GET /photos/cat.jpg")
+	s.expect("/photos/cat.jpg", edge.StatusHit, "web GET /photos/cat.jpg")
+	time.Sleep(1100 * time.Millisecond)
+	s.expect("/photos/cat.jpg", edge.StatusMiss, "web GET /photos/cat.jpg")
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(s.srv.URL + "/secure/page")
+	s.Require().NoError(err)
+	resp.Body.Close()
+	s.Equal(http.StatusMovedPermanently, resp.StatusCode, "redirect")
+	s.True(strings.HasPrefix(resp.Header.Get("Location"), "https://"), "redirect to %s", resp.Header.Get("Location"))
+}
+
+func (s *EdgeSuite) TestRoutesByHost() {
+	o := s.origin(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	})
+	s.serve(originOpts(o))
+
+	rec := httptest.NewRecorder()
+	s.edge.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://"+s.dist.DomainName+"/", nil))
+	s.Equal(http.StatusOK, rec.Code, "known host")
+	s.Equal("ok", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	s.edge.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://unknown.example/", nil))
+	s.Equal(http.StatusNotFound, rec.Code, "unknown host")
+
+	s.Require().NoError(s.edge.DisableDistribution(s.ctx, s.dist.ID))
+	rec = httptest.NewRecorder()
+	s.edge.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://"+s.dist.DomainName+"/", nil))
+	s.Equal(http.StatusServiceUnavailable, rec.Code, "disabled")
+}
+
+// TestEdgeSuite runs the test suite.
+func TestEdgeSuite(t *testing.T) {
+	suite.Run(t, new(EdgeSuite))
+}
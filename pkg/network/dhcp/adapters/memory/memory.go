@@ -2,24 +2,32 @@ package memory
 
 import (
 	"context"
-	"fmt"
+	"net/netip"
 	"time"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/concurrency"
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
 	"github.com/chris-alexander-pop/system-design-library/pkg/network/dhcp"
 	"github.com/google/uuid"
 )
 
 // MemoryIPAM is an in-memory implementation of IPAM.
 type MemoryIPAM struct {
+	pools       map[string]*pool
 	allocations map[string]*dhcp.IPAllocation
-	// Map poolID -> []Allocations for simpler lookup (not fully implemented in this stub)
-	mu *concurrency.SmartRWMutex
+	mu          *concurrency.SmartRWMutex
+}
+
+// pool is an inclusive address range and the addresses allocated from it.
+type pool struct {
+	first, last netip.Addr
+	allocated   map[netip.Addr]string // ip -> allocation ID
 }
 
 // New creates a new MemoryIPAM.
 func New() *MemoryIPAM {
 	return &MemoryIPAM{
+		pools:       make(map[string]*pool),
 		allocations: make(map[string]*dhcp.IPAllocation),
 		mu: concurrency.NewSmartRWMutex(concurrency.MutexConfig{
 			Name: "memory-ipam",
@@ -27,59 +35,101 @@ func New() *MemoryIPAM {
 	}
 }
 
-func (m *MemoryIPAM) AllocateIP(ctx context.Context, poolID string) (*dhcp.IPAllocation, error) {
+// AddPool defines a pool of the addresses from first to last inclusive.
+// Redefining a pool keeps its allocations.
+func (m *MemoryIPAM) AddPool(poolID string, first, last string) error {
+	from, err := netip.ParseAddr(first)
+	if err != nil {
+		return errors.InvalidArgument("invalid first address", err)
+	}
+	to, err := netip.ParseAddr(last)
+	if err != nil {
+		return errors.InvalidArgument("invalid last address", err)
+	}
+	from, to = from.Unmap(), to.Unmap()
+	if from.BitLen() != to.BitLen() || to.Less(from) {
+		return errors.InvalidArgument("invalid address range", nil)
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// Dumb allocator: just picks a random fake IP
-	// Real implementation would look at available ranges in the pool
-	id := uuid.NewString()
-	ip := fmt.Sprintf("192.168.1.%d", len(m.allocations)+1)
+	allocated := make(map[netip.Addr]string)
+	if p, ok := m.pools[poolID]; ok {
+		allocated = p.allocated
+	}
+	m.pools[poolID] = &pool{first: from, last: to, allocated: allocated}
+	return nil
+}
 
-	alloc := &dhcp.IPAllocation{
-		ID:          id,
-		PoolID:      poolID,
-		IP:          ip,
-		AllocatedAt: time.Now(),
+// AllocateIP allocates the lowest free address of the pool.
+func (m *MemoryIPAM) AllocateIP(ctx context.Context, poolID string) (*dhcp.IPAllocation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.pools[poolID]
+	if !ok {
+		return nil, dhcp.ErrPoolNotFound
 	}
 
-	m.allocations[id] = alloc
-	return alloc, nil
+	for ip := p.first; ip.IsValid() && !p.last.Less(ip); ip = ip.Next() {
+		if _, taken := p.allocated[ip]; !taken {
+			return m.allocate(poolID, p, ip), nil
+		}
+	}
+	return nil, dhcp.ErrIPExhausted
 }
 
-func (m *MemoryIPAM) ReserveIP(ctx context.Context, poolID string, ip string) error {
+func (m *MemoryIPAM) ReserveIP(ctx context.Context, poolID string, ip string) (*dhcp.IPAllocation, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil, errors.InvalidArgument("invalid ip address", err)
+	}
+	addr = addr.Unmap()
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// Check if already allocated
-	for _, a := range m.allocations {
-		if a.IP == ip && a.PoolID == poolID {
-			return dhcp.ErrIPAlreadyAllocated
-		}
+	p, ok := m.pools[poolID]
+	if !ok {
+		return nil, dhcp.ErrPoolNotFound
+	}
+	if addr.BitLen() != p.first.BitLen() || addr.Less(p.first) || p.last.Less(addr) {
+		return nil, dhcp.ErrIPNotInPool
+	}
+	if _, taken := p.allocated[addr]; taken {
+		return nil, dhcp.ErrIPAlreadyAllocated
 	}
+	return m.allocate(poolID, p, addr), nil
+}
 
-	id := uuid.NewString()
+func (m *MemoryIPAM) allocate(poolID string, p *pool, ip netip.Addr) *dhcp.IPAllocation {
 	alloc := &dhcp.IPAllocation{
-		ID:          id,
+		ID:          uuid.NewString(),
 		PoolID:      poolID,
-		IP:          ip,
+		IP:          ip.String(),
 		AllocatedAt: time.Now(),
 	}
+	p.allocated[ip] = alloc.ID
+	m.allocations[alloc.ID] = alloc
 
-	m.allocations[id] = alloc
-	return nil
+	cp := *alloc
+	return &cp
 }
 
 func (m *MemoryIPAM) ReleaseIP(ctx context.Context, allocationID string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if _, ok := m.allocations[allocationID]; !ok {
-		// Idempotent or error? Let's say idempotent success if not found usually,
-		// but matching interface spec we might return error if stricter.
+	alloc, ok := m.allocations[allocationID]
+	if !ok {
+		// Releasing is idempotent.
 		return nil
 	}
 
 	delete(m.allocations, allocationID)
+	if p, ok := m.pools[alloc.PoolID]; ok {
+		delete(p.allocated, netip.MustParseAddr(alloc.IP))
+	}
 	return nil
 }
@@ -10,8 +10,9 @@ type IPAM interface {
 	// AllocateIP allocates an available IP from the given subnet/pool.
 	AllocateIP(ctx context.Context, poolID string) (*IPAllocation, error)
 
-	// ReserveIP reserves a specific IP address.
-	ReserveIP(ctx context.Context, poolID string, ip string) error
+	// ReserveIP reserves a specific IP address. The returned allocation
+	// releases it.
+	ReserveIP(ctx context.Context, poolID string, ip string) (*IPAllocation, error)
 
 	// ReleaseIP releases an allocated IP back to the pool.
 	ReleaseIP(ctx context.Context, allocationID string) error
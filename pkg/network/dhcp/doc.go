@@ -1,4 +1,5 @@
 // Package dhcp provides IP Address Management (IPAM) and DHCP services.
 //
 // It handles IP allocation, reservation, and lifecycle management within defined pools.
+// The server subpackage serves DHCPv4 on top of an IPAM pool.
 package dhcp
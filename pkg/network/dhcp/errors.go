@@ -11,4 +11,7 @@ var (
 
 	// ErrIPAlreadyAllocated is returned when attempting to reserve an IP that is already in use.
 	ErrIPAlreadyAllocated = errors.Conflict("ip already allocated", nil)
+
+	// ErrIPNotInPool is returned when attempting to reserve an IP outside the pool's range.
+	ErrIPNotInPool = errors.InvalidArgument("ip not in pool", nil)
 )
@@ -4,7 +4,7 @@ import (
 	"context"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
-	"go.opentelemetry.io/otel"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
@@ -20,7 +20,7 @@ type InstrumentedIPAM struct {
 func NewInstrumentedIPAM(next IPAM) *InstrumentedIPAM {
 	return &InstrumentedIPAM{
 		next:   next,
-		tracer: otel.Tracer("pkg/network/dhcp"),
+		tracer: instrument.NewTracer("pkg/network/dhcp"),
 	}
 }
 
@@ -45,7 +45,7 @@ func (i *InstrumentedIPAM) AllocateIP(ctx context.Context, poolID string) (*IPAl
 	return alloc, nil
 }
 
-func (i *InstrumentedIPAM) ReserveIP(ctx context.Context, poolID string, ip string) error {
+func (i *InstrumentedIPAM) ReserveIP(ctx context.Context, poolID string, ip string) (*IPAllocation, error) {
 	ctx, span := i.tracer.Start(ctx, "dhcp.ReserveIP", trace.WithAttributes(
 		attribute.String("pool.id", poolID),
 		attribute.String("ip.address", ip),
@@ -54,16 +54,17 @@ func (i *InstrumentedIPAM) ReserveIP(ctx context.Context, poolID string, ip stri
 
 	logger.L().InfoContext(ctx, "reserving ip", "pool_id", poolID, "ip", ip)
 
-	err := i.next.ReserveIP(ctx, poolID, ip)
+	alloc, err := i.next.ReserveIP(ctx, poolID, ip)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
 		logger.L().ErrorContext(ctx, "failed to reserve ip", "pool_id", poolID, "ip", ip, "error", err)
-		return err
+		return nil, err
 	}
 
-	logger.L().InfoContext(ctx, "ip reserved", "ip", ip)
-	return nil
+	span.SetAttributes(attribute.String("alloc.id", alloc.ID))
+	logger.L().InfoContext(ctx, "ip reserved", "ip", ip, "id", alloc.ID)
+	return alloc, nil
 }
 
 func (i *InstrumentedIPAM) ReleaseIP(ctx context.Context, allocationID string) error {
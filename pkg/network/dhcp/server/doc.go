@@ -0,0 +1,29 @@
+// Package server implements a DHCPv4 server (RFC 2131) on top of the
+// dhcp.IPAM allocator.
+//
+// The server answers DISCOVER with an OFFER, binds the address on REQUEST
+// with an ACK (or refuses with a NAK), and handles RELEASE, DECLINE and
+// INFORM. Clients renew and rebind their leases with REQUEST; leases that
+// are not renewed expire and their addresses return to the IPAM pool.
+// Clients with a static reservation always get their reserved address.
+// Replies carry the subnet mask, broadcast address, router, DNS servers,
+// domain name and MTU configured. Relayed requests are answered through
+// the relay agent.
+//
+// Leases are kept in memory and, with a LeaseStore, persisted so they
+// survive restarts.
+//
+// Usage:
+//
+//	ipam := memory.New()
+//	_ = ipam.AddPool("lab", "10.0.0.100", "10.0.0.200")
+//	srv, err := server.New(server.Config{
+//		PoolID:     "lab",
+//		ServerIP:   "10.0.0.1",
+//		Subnet:     "10.0.0.0/24",
+//		Router:     "10.0.0.1",
+//		DNSServers: []string{"10.0.0.1"},
+//		Leases:     server.NewKVLeaseStore(store, "dhcp:lab"),
+//	}, ipam)
+//	err = srv.ListenAndServe(ctx)
+package server
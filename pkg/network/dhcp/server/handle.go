@@ -0,0 +1,414 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/dhcp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Respond handles a DHCP message and returns the reply with the address to
+// send it to, or a nil reply when the message needs none.
+func (s *Server) Respond(ctx context.Context, packet []byte) ([]byte, *net.UDPAddr, error) {
+	req, err := ParseMessage(packet)
+	if err != nil {
+		return nil, nil, err
+	}
+	if req.Op != opRequest || req.Type() == 0 {
+		return nil, nil, nil
+	}
+	if relayed(req) && !s.subnet.Contains(req.GIAddr) {
+		// Relayed from a network this server does not serve.
+		return nil, nil, nil
+	}
+
+	ctx, span := s.tracer.Start(ctx, "dhcp.Respond", trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+		attribute.String("dhcp.message_type", req.Type().String()),
+		attribute.String("dhcp.client_id", req.ClientID()),
+	))
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(ctx); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, nil, err
+	}
+	s.sweep(ctx)
+
+	var resp *Message
+	switch req.Type() {
+	case Discover:
+		resp, err = s.discover(ctx, req)
+	case Request:
+		resp, err = s.request(ctx, req)
+	case Decline:
+		s.decline(ctx, req)
+	case Release:
+		s.release(ctx, req)
+	case Inform:
+		resp = s.reply(req, ACK, nil)
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, nil, err
+	}
+	if resp == nil {
+		return nil, nil, nil
+	}
+
+	span.SetAttributes(attribute.String("dhcp.reply_type", resp.Type().String()))
+	if resp.YIAddr.IsValid() && !resp.YIAddr.IsUnspecified() {
+		span.SetAttributes(attribute.String("dhcp.address", resp.YIAddr.String()))
+	}
+	return resp.Marshal(), s.destination(req, resp), nil
+}
+
+// discover offers the client an address: its reservation, its current
+// lease, the address it asks for if that is free, or a new one.
+func (s *Server) discover(ctx context.Context, req *Message) (*Message, error) {
+	lease, err := s.choose(ctx, req)
+	if err != nil {
+		if errors.Is(err, dhcp.ErrIPExhausted) {
+			logger.L().WarnContext(ctx, "dhcp pool exhausted", "pool", s.cfg.PoolID, "client", req.ClientID())
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if lease.State != LeaseBound {
+		lease.State = LeaseOffered
+		lease.Expires = time.Now().Add(s.cfg.OfferTimeout)
+	}
+	s.save(ctx)
+	return s.reply(req, Offer, lease), nil
+}
+
+func (s *Server) choose(ctx context.Context, req *Message) (*Lease, error) {
+	client := req.ClientID()
+	if addr, ok := s.static[req.CHAddr.String()]; ok {
+		if held := s.leases[addr]; held != nil && held.ClientID == client {
+			return held, nil
+		}
+		s.dropClient(ctx, client)
+		s.evict(ctx, addr)
+		return s.put(&Lease{ClientID: client, MAC: req.CHAddr.String(), IP: addr.String(), Static: true}), nil
+	}
+
+	if addr, ok := s.clients[client]; ok {
+		return s.leases[addr], nil
+	}
+
+	if addr, ok := req.Options.Addr(OptionRequestedIP); ok && s.subnet.Contains(addr) && s.leases[addr] == nil && !s.isStatic(addr) {
+		if alloc, err := s.ipam.ReserveIP(ctx, s.cfg.PoolID, addr.String()); err == nil {
+			return s.put(&Lease{ClientID: client, MAC: req.CHAddr.String(), IP: alloc.IP, AllocationID: alloc.ID}), nil
+		}
+	}
+
+	alloc, err := s.ipam.AllocateIP(ctx, s.cfg.PoolID)
+	if err != nil {
+		return nil, err
+	}
+	addr, err := netip.ParseAddr(alloc.IP)
+	if err != nil || !s.subnet.Contains(addr) {
+		_ = s.ipam.ReleaseIP(ctx, alloc.ID)
+		return nil, errors.Internal("ipam pool "+s.cfg.PoolID+" allocated "+alloc.IP+" outside the dhcp subnet", err)
+	}
+	return s.put(&Lease{ClientID: client, MAC: req.CHAddr.String(), IP: alloc.IP, AllocationID: alloc.ID}), nil
+}
+
+// request handles the three kinds of DHCPREQUEST: selecting an offer
+// (with a server identifier), confirming an address after a reboot (with a
+// requested address) and renewing or rebinding a lease (with ciaddr).
+func (s *Server) request(ctx context.Context, req *Message) (*Message, error) {
+	client := req.ClientID()
+	requested, hasRequested := req.Options.Addr(OptionRequestedIP)
+
+	if serverID, ok := req.Options.Addr(OptionServerID); ok {
+		lease := s.lease(client)
+		if serverID != s.serverID {
+			// The client took another server's offer.
+			if lease != nil && lease.State == LeaseOffered {
+				s.drop(ctx, lease)
+				s.save(ctx)
+			}
+			return nil, nil
+		}
+		if lease == nil || !hasRequested || lease.IP != requested.String() {
+			return s.nak(req, "address not offered"), nil
+		}
+		return s.bind(ctx, req, lease), nil
+	}
+
+	addr := req.CIAddr
+	if hasRequested {
+		addr = requested
+	}
+	if !addr.IsValid() || addr.IsUnspecified() {
+		return nil, nil
+	}
+	if !s.subnet.Contains(addr) {
+		return s.nak(req, "wrong network"), nil
+	}
+
+	if lease := s.lease(client); lease != nil {
+		if lease.IP == addr.String() {
+			return s.bind(ctx, req, lease), nil
+		}
+		return s.nak(req, "address not leased to client"), nil
+	}
+
+	// The client has no lease, typically after a server restart without
+	// persistence. Grant the address if it is the client's reservation or
+	// free.
+	lease := &Lease{ClientID: client, MAC: req.CHAddr.String(), IP: addr.String()}
+	if static, ok := s.static[req.CHAddr.String()]; ok {
+		if static != addr {
+			return s.nak(req, "client has a reservation"), nil
+		}
+		s.evict(ctx, addr)
+		lease.Static = true
+		return s.bind(ctx, req, s.put(lease)), nil
+	}
+	if s.leases[addr] != nil || s.isStatic(addr) {
+		return s.nak(req, "address in use"), nil
+	}
+	alloc, err := s.ipam.ReserveIP(ctx, s.cfg.PoolID, addr.String())
+	if err != nil {
+		return s.nak(req, "address unavailable"), nil
+	}
+	lease.AllocationID = alloc.ID
+	return s.bind(ctx, req, s.put(lease)), nil
+}
+
+// bind acknowledges a lease, starting or extending it.
+func (s *Server) bind(ctx context.Context, req *Message, lease *Lease) *Message {
+	lease.State = LeaseBound
+	lease.MAC = req.CHAddr.String()
+	lease.Expires = time.Now().Add(s.leaseTime(req))
+	if name := req.Options[OptionHostname]; len(name) > 0 {
+		lease.Hostname = string(name)
+	}
+	s.save(ctx)
+	logger.L().InfoContext(ctx, "dhcp lease bound", "ip", lease.IP, "mac", lease.MAC, "expires", lease.Expires)
+	return s.reply(req, ACK, lease)
+}
+
+// decline quarantines an address the client found in use.
+func (s *Server) decline(ctx context.Context, req *Message) {
+	if serverID, ok := req.Options.Addr(OptionServerID); ok && serverID != s.serverID {
+		return
+	}
+	addr, ok := req.Options.Addr(OptionRequestedIP)
+	lease := s.lease(req.ClientID())
+	if !ok || lease == nil || lease.IP != addr.String() {
+		return
+	}
+
+	logger.L().WarnContext(ctx, "dhcp client declined address in use", "ip", lease.IP, "mac", lease.MAC, "static", lease.Static)
+	delete(s.clients, lease.ClientID)
+	if lease.Static {
+		delete(s.leases, addr)
+	} else {
+		lease.ClientID, lease.MAC, lease.Hostname = "", "", ""
+		lease.State = LeaseDeclined
+		lease.Expires = time.Now().Add(s.cfg.DeclineTimeout)
+	}
+	s.save(ctx)
+}
+
+// release ends the client's lease early.
+func (s *Server) release(ctx context.Context, req *Message) {
+	lease := s.lease(req.ClientID())
+	if lease == nil || lease.IP != req.CIAddr.String() {
+		return
+	}
+	s.drop(ctx, lease)
+	s.save(ctx)
+	logger.L().InfoContext(ctx, "dhcp lease released", "ip", lease.IP, "mac", lease.MAC)
+}
+
+// reply builds a reply to req. With a lease it carries the address and
+// lease times; without one (DHCPINFORM) only the configuration options.
+func (s *Server) reply(req *Message, t MessageType, lease *Lease) *Message {
+	resp := &Message{
+		Op:      opReply,
+		HType:   req.HType,
+		HLen:    req.HLen,
+		XID:     req.XID,
+		Flags:   req.Flags,
+		GIAddr:  req.GIAddr,
+		CHAddr:  req.CHAddr,
+		Options: Options{OptionMessageType: {byte(t)}},
+	}
+	resp.Options.setAddrs(OptionServerID, s.serverID)
+
+	if lease != nil {
+		resp.YIAddr = netip.MustParseAddr(lease.IP)
+		if t == ACK {
+			resp.CIAddr = req.CIAddr
+		}
+		d := s.leaseTime(req)
+		if lease.State == LeaseBound && t == Offer {
+			d = max(time.Until(lease.Expires), 0)
+		}
+		secs := uint32(d / time.Second)
+		resp.Options.setUint32(OptionLeaseTime, secs)
+		resp.Options.setUint32(OptionRenewalTime, secs/2)
+		resp.Options.setUint32(OptionRebindingTime, secs/8*7)
+	} else {
+		resp.CIAddr = req.CIAddr
+	}
+
+	mask := net.CIDRMask(s.subnet.Bits(), 32)
+	resp.Options[OptionSubnetMask] = []byte(mask)
+	resp.Options.setAddrs(OptionBroadcastAddress, broadcast(s.subnet))
+	if s.router.IsValid() {
+		resp.Options.setAddrs(OptionRouter, s.router)
+	}
+	if len(s.dns) > 0 {
+		resp.Options.setAddrs(OptionDNSServers, s.dns...)
+	}
+	if s.cfg.Domain != "" {
+		resp.Options[OptionDomainName] = []byte(s.cfg.Domain)
+	}
+	if s.cfg.MTU > 0 {
+		resp.Options[OptionMTU] = []byte{byte(s.cfg.MTU >> 8), byte(s.cfg.MTU)}
+	}
+	return resp
+}
+
+func (s *Server) nak(req *Message, reason string) *Message {
+	return &Message{
+		Op:     opReply,
+		HType:  req.HType,
+		HLen:   req.HLen,
+		XID:    req.XID,
+		Flags:  req.Flags,
+		GIAddr: req.GIAddr,
+		CHAddr: req.CHAddr,
+		Options: Options{
+			OptionMessageType: {byte(NAK)},
+			OptionServerID:    s.serverID.AsSlice(),
+			OptionMessage:     []byte(reason),
+		},
+	}
+}
+
+// destination picks where a reply goes (RFC 2131 4.1): to the relay
+// agent, to the client's own address, or broadcast when the client has
+// none yet.
+func (s *Server) destination(req, resp *Message) *net.UDPAddr {
+	switch {
+	case relayed(req):
+		return &net.UDPAddr{IP: req.GIAddr.AsSlice(), Port: serverPort}
+	case resp.Type() != NAK && req.CIAddr.IsValid() && !req.CIAddr.IsUnspecified():
+		return &net.UDPAddr{IP: req.CIAddr.AsSlice(), Port: clientPort}
+	default:
+		return &net.UDPAddr{IP: net.IPv4bcast, Port: clientPort}
+	}
+}
+
+// leaseTime is the lease the client asked for, capped at LeaseTime.
+func (s *Server) leaseTime(req *Message) time.Duration {
+	if secs, ok := req.Options.Uint32(OptionLeaseTime); ok && secs > 0 {
+		if d := time.Duration(secs) * time.Second; d < s.cfg.LeaseTime {
+			return d
+		}
+	}
+	return s.cfg.LeaseTime
+}
+
+func (s *Server) lease(client string) *Lease {
+	if addr, ok := s.clients[client]; ok {
+		return s.leases[addr]
+	}
+	return nil
+}
+
+func (s *Server) put(l *Lease) *Lease {
+	addr := netip.MustParseAddr(l.IP)
+	s.leases[addr] = l
+	if l.ClientID != "" {
+		s.clients[l.ClientID] = addr
+	}
+	return l
+}
+
+// drop removes a lease, returning a dynamic address to the pool.
+func (s *Server) drop(ctx context.Context, l *Lease) {
+	addr := netip.MustParseAddr(l.IP)
+	if s.leases[addr] == l {
+		delete(s.leases, addr)
+	}
+	if l.ClientID != "" && s.clients[l.ClientID] == addr {
+		delete(s.clients, l.ClientID)
+	}
+	if !l.Static && !s.isStatic(addr) && l.AllocationID != "" {
+		if err := s.ipam.ReleaseIP(ctx, l.AllocationID); err != nil {
+			logger.L().ErrorContext(ctx, "failed to release dhcp address", "ip", l.IP, "error", err)
+		}
+	}
+}
+
+// dropClient removes the client's current lease, if any.
+func (s *Server) dropClient(ctx context.Context, client string) {
+	if l := s.lease(client); l != nil {
+		s.drop(ctx, l)
+	}
+}
+
+// evict removes another holder of a reserved address, such as a lease
+// saved before the reservation was configured.
+func (s *Server) evict(ctx context.Context, addr netip.Addr) {
+	if l := s.leases[addr]; l != nil {
+		s.drop(ctx, l)
+	}
+}
+
+// sweep reclaims expired leases.
+func (s *Server) sweep(ctx context.Context) {
+	now := time.Now()
+	changed := false
+	for _, l := range s.leases {
+		if now.After(l.Expires) {
+			s.drop(ctx, l)
+			changed = true
+		}
+	}
+	if changed {
+		s.save(ctx)
+	}
+}
+
+func (s *Server) isStatic(addr netip.Addr) bool {
+	for _, a := range s.static {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
+
+func relayed(req *Message) bool {
+	return req.GIAddr.IsValid() && !req.GIAddr.IsUnspecified()
+}
+
+func broadcast(p netip.Prefix) netip.Addr {
+	a := p.Addr().As4()
+	mask := net.CIDRMask(p.Bits(), 32)
+	for i := range a {
+		a[i] |= ^mask[i]
+	}
+	return netip.AddrFrom4(a)
+}
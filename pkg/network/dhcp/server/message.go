@@ -0,0 +1,258 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"net/netip"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+)
+
+// BOOTP operations.
+const (
+	opRequest = 1
+	opReply   = 2
+)
+
+// MessageType is the DHCP message type option.
+type MessageType byte
+
+// DHCP message types (RFC 2132 9.6).
+const (
+	Discover MessageType = 1
+	Offer    MessageType = 2
+	Request  MessageType = 3
+	Decline  MessageType = 4
+	ACK      MessageType = 5
+	NAK      MessageType = 6
+	Release  MessageType = 7
+	Inform   MessageType = 8
+)
+
+func (t MessageType) String() string {
+	switch t {
+	case Discover:
+		return "DHCPDISCOVER"
+	case Offer:
+		return "DHCPOFFER"
+	case Request:
+		return "DHCPREQUEST"
+	case Decline:
+		return "DHCPDECLINE"
+	case ACK:
+		return "DHCPACK"
+	case NAK:
+		return "DHCPNAK"
+	case Release:
+		return "DHCPRELEASE"
+	case Inform:
+		return "DHCPINFORM"
+	}
+	return "DHCP(unknown)"
+}
+
+// Option codes (RFC 2132).
+const (
+	OptionPad              = 0
+	OptionSubnetMask       = 1
+	OptionRouter           = 3
+	OptionDNSServers       = 6
+	OptionHostname         = 12
+	OptionDomainName       = 15
+	OptionMTU              = 26
+	OptionBroadcastAddress = 28
+	OptionRequestedIP      = 50
+	OptionLeaseTime        = 51
+	OptionMessageType      = 53
+	OptionServerID         = 54
+	OptionParameterList    = 55
+	OptionMessage          = 56
+	OptionMaxMessageSize   = 57
+	OptionRenewalTime      = 58
+	OptionRebindingTime    = 59
+	OptionClientID         = 61
+	OptionEnd              = 255
+)
+
+const (
+	// headerSize is the fixed BOOTP header, up to the magic cookie.
+	headerSize = 236
+
+	// minPacketSize is the smallest BOOTP message; replies are padded to
+	// it for old relays and clients.
+	minPacketSize = 300
+
+	// flagBroadcast asks for replies to be broadcast.
+	flagBroadcast = 0x8000
+)
+
+var magicCookie = []byte{99, 130, 83, 99}
+
+// Message is a DHCPv4 message.
+type Message struct {
+	Op      byte
+	HType   byte
+	HLen    byte
+	Hops    byte
+	XID     uint32
+	Secs    uint16
+	Flags   uint16
+	CIAddr  netip.Addr // client address, when it has one
+	YIAddr  netip.Addr // "your" address, assigned by the server
+	SIAddr  netip.Addr // next server
+	GIAddr  netip.Addr // relay agent
+	CHAddr  net.HardwareAddr
+	Options Options
+}
+
+// Options maps option codes to their raw values.
+type Options map[byte][]byte
+
+// ParseMessage decodes a DHCPv4 message.
+func ParseMessage(b []byte) (*Message, error) {
+	if len(b) < headerSize+len(magicCookie) || !bytes.Equal(b[headerSize:headerSize+4], magicCookie) {
+		return nil, errors.InvalidArgument("not a dhcp message", nil)
+	}
+
+	m := &Message{
+		Op:     b[0],
+		HType:  b[1],
+		HLen:   b[2],
+		Hops:   b[3],
+		XID:    binary.BigEndian.Uint32(b[4:8]),
+		Secs:   binary.BigEndian.Uint16(b[8:10]),
+		Flags:  binary.BigEndian.Uint16(b[10:12]),
+		CIAddr: netip.AddrFrom4([4]byte(b[12:16])),
+		YIAddr: netip.AddrFrom4([4]byte(b[16:20])),
+		SIAddr: netip.AddrFrom4([4]byte(b[20:24])),
+		GIAddr: netip.AddrFrom4([4]byte(b[24:28])),
+	}
+	if m.HLen > 16 {
+		return nil, errors.InvalidArgument("invalid hardware address length", nil)
+	}
+	m.CHAddr = net.HardwareAddr(bytes.Clone(b[28 : 28+int(m.HLen)]))
+
+	opts, err := parseOptions(b[headerSize+4:])
+	if err != nil {
+		return nil, err
+	}
+	m.Options = opts
+	return m, nil
+}
+
+func parseOptions(b []byte) (Options, error) {
+	opts := make(Options)
+	for len(b) > 0 {
+		code := b[0]
+		if code == OptionEnd {
+			break
+		}
+		if code == OptionPad {
+			b = b[1:]
+			continue
+		}
+		if len(b) < 2 || len(b) < 2+int(b[1]) {
+			return nil, errors.InvalidArgument("truncated dhcp option", nil)
+		}
+		// Options that appear more than once are concatenated (RFC 3396).
+		opts[code] = append(opts[code], b[2:2+int(b[1])]...)
+		b = b[2+int(b[1]):]
+	}
+	return opts, nil
+}
+
+// Marshal encodes the message, padding it to the minimum BOOTP size.
+func (m *Message) Marshal() []byte {
+	b := make([]byte, headerSize, minPacketSize)
+	b[0], b[1], b[2], b[3] = m.Op, m.HType, m.HLen, m.Hops
+	binary.BigEndian.PutUint32(b[4:8], m.XID)
+	binary.BigEndian.PutUint16(b[8:10], m.Secs)
+	binary.BigEndian.PutUint16(b[10:12], m.Flags)
+	for off, addr := range map[int]netip.Addr{12: m.CIAddr, 16: m.YIAddr, 20: m.SIAddr, 24: m.GIAddr} {
+		if addr.Is4() {
+			a := addr.As4()
+			copy(b[off:off+4], a[:])
+		}
+	}
+	copy(b[28:44], m.CHAddr)
+	b = append(b, magicCookie...)
+
+	// Message type first, as some clients expect, then the rest in code
+	// order.
+	if t, ok := m.Options[OptionMessageType]; ok {
+		b = appendOption(b, OptionMessageType, t)
+	}
+	for code := 1; code < OptionEnd; code++ {
+		if v, ok := m.Options[byte(code)]; ok && code != OptionMessageType {
+			b = appendOption(b, byte(code), v)
+		}
+	}
+	b = append(b, OptionEnd)
+	for len(b) < minPacketSize {
+		b = append(b, OptionPad)
+	}
+	return b
+}
+
+// appendOption writes an option, splitting values longer than 255 bytes.
+func appendOption(b []byte, code byte, v []byte) []byte {
+	for {
+		n := min(len(v), 255)
+		b = append(b, code, byte(n))
+		b = append(b, v[:n]...)
+		v = v[n:]
+		if len(v) == 0 {
+			return b
+		}
+	}
+}
+
+// Type returns the message type option, or 0 for BOOTP messages.
+func (m *Message) Type() MessageType {
+	if v := m.Options[OptionMessageType]; len(v) == 1 {
+		return MessageType(v[0])
+	}
+	return 0
+}
+
+// ClientID identifies the client: the client identifier option if present,
+// otherwise the hardware address.
+func (m *Message) ClientID() string {
+	if v := m.Options[OptionClientID]; len(v) > 0 {
+		return "id:" + hex.EncodeToString(v)
+	}
+	return m.CHAddr.String()
+}
+
+// Addr returns an option holding a single IPv4 address.
+func (o Options) Addr(code byte) (netip.Addr, bool) {
+	v := o[code]
+	if len(v) != 4 {
+		return netip.Addr{}, false
+	}
+	return netip.AddrFrom4([4]byte(v)), true
+}
+
+// Uint32 returns a four-byte integer option.
+func (o Options) Uint32(code byte) (uint32, bool) {
+	v := o[code]
+	if len(v) != 4 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(v), true
+}
+
+func (o Options) setAddrs(code byte, addrs ...netip.Addr) {
+	var v []byte
+	for _, a := range addrs {
+		a4 := a.As4()
+		v = append(v, a4[:]...)
+	}
+	o[code] = v
+}
+
+func (o Options) setUint32(code byte, n uint32) {
+	o[code] = binary.BigEndian.AppendUint32(nil, n)
+}
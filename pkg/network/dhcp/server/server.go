@@ -0,0 +1,276 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/dhcp"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	serverPort = 67
+	clientPort = 68
+
+	// sweepInterval is how often expired leases are reclaimed while
+	// serving. Expired leases are also reclaimed before each message.
+	sweepInterval = 30 * time.Second
+)
+
+// Config holds configuration for the DHCP server.
+type Config struct {
+	// Addr is the UDP address to serve on.
+	Addr string `env:"DHCP_SERVER_ADDR" env-default:":67"`
+
+	// PoolID is the IPAM pool dynamic addresses are allocated from.
+	PoolID string `env:"DHCP_POOL_ID"`
+
+	// ServerIP identifies the server to clients. It must be an address
+	// clients can reach the server at.
+	ServerIP string `env:"DHCP_SERVER_IP"`
+
+	// Subnet is the network served, such as "10.0.0.0/24". Addresses the
+	// pool allocates outside it are not handed out.
+	Subnet string `env:"DHCP_SUBNET"`
+
+	// Router, DNSServers, Domain and MTU are sent to clients as options
+	// when set.
+	Router     string   `env:"DHCP_ROUTER"`
+	DNSServers []string `env:"DHCP_DNS_SERVERS"`
+	Domain     string   `env:"DHCP_DOMAIN"`
+	MTU        int      `env:"DHCP_MTU"`
+
+	// LeaseTime is the longest lease granted. Clients may ask for less.
+	LeaseTime time.Duration `env:"DHCP_LEASE_TIME" env-default:"12h"`
+
+	// OfferTimeout is how long an offered address is held for the client
+	// to request it.
+	OfferTimeout time.Duration `env:"DHCP_OFFER_TIMEOUT" env-default:"1m"`
+
+	// DeclineTimeout is how long an address a client declined is kept out
+	// of allocation.
+	DeclineTimeout time.Duration `env:"DHCP_DECLINE_TIMEOUT" env-default:"10m"`
+
+	// Reservations are static addresses by client MAC address. They may
+	// lie outside the pool but must be in the subnet.
+	Reservations map[string]string
+
+	// Leases persists leases across restarts; leases are kept in memory
+	// only if it is nil.
+	Leases LeaseStore
+}
+
+// Server is a DHCPv4 server handing out addresses from an IPAM pool.
+type Server struct {
+	cfg      Config
+	ipam     dhcp.IPAM
+	tracer   trace.Tracer
+	serverID netip.Addr
+	subnet   netip.Prefix
+	router   netip.Addr
+	dns      []netip.Addr
+	static   map[string]netip.Addr // MAC -> reserved address
+
+	mu      sync.Mutex
+	loaded  bool
+	leases  map[netip.Addr]*Lease
+	clients map[string]netip.Addr // client ID -> leased address
+}
+
+// New creates a server allocating addresses from ipam.
+func New(cfg Config, ipam dhcp.IPAM) (*Server, error) {
+	if cfg.Addr == "" {
+		cfg.Addr = ":67"
+	}
+	if cfg.LeaseTime <= 0 {
+		cfg.LeaseTime = 12 * time.Hour
+	}
+	if cfg.OfferTimeout <= 0 {
+		cfg.OfferTimeout = time.Minute
+	}
+	if cfg.DeclineTimeout <= 0 {
+		cfg.DeclineTimeout = 10 * time.Minute
+	}
+	if cfg.PoolID == "" {
+		return nil, errors.InvalidArgument("dhcp pool id is required", nil)
+	}
+
+	s := &Server{
+		cfg:     cfg,
+		ipam:    ipam,
+		tracer:  instrument.NewTracer("pkg/network/dhcp/server"),
+		static:  make(map[string]netip.Addr),
+		leases:  make(map[netip.Addr]*Lease),
+		clients: make(map[string]netip.Addr),
+	}
+
+	var err error
+	if s.serverID, err = netip.ParseAddr(cfg.ServerIP); err != nil || !s.serverID.Is4() {
+		return nil, errors.InvalidArgument("dhcp server ip must be an ipv4 address", err)
+	}
+	if s.subnet, err = netip.ParsePrefix(cfg.Subnet); err != nil || !s.subnet.Addr().Is4() {
+		return nil, errors.InvalidArgument("dhcp subnet must be an ipv4 prefix", err)
+	}
+	s.subnet = s.subnet.Masked()
+	if cfg.Router != "" {
+		if s.router, err = netip.ParseAddr(cfg.Router); err != nil || !s.router.Is4() {
+			return nil, errors.InvalidArgument("dhcp router must be an ipv4 address", err)
+		}
+	}
+	for _, d := range cfg.DNSServers {
+		addr, err := netip.ParseAddr(d)
+		if err != nil || !addr.Is4() {
+			return nil, errors.InvalidArgument("dhcp dns server must be an ipv4 address", err)
+		}
+		s.dns = append(s.dns, addr)
+	}
+	for mac, ip := range cfg.Reservations {
+		hw, err := net.ParseMAC(mac)
+		if err != nil {
+			return nil, errors.InvalidArgument("invalid reservation mac "+mac, err)
+		}
+		addr, err := netip.ParseAddr(ip)
+		if err != nil || !s.subnet.Contains(addr) {
+			return nil, errors.InvalidArgument("reservation address "+ip+" is not in the subnet", err)
+		}
+		s.static[hw.String()] = addr
+	}
+	return s, nil
+}
+
+// ListenAndServe serves DHCP on cfg.Addr until ctx is cancelled. Replies
+// to clients without an address are broadcast.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	if err := s.Load(ctx); err != nil {
+		return err
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+
+	var udp *network.UDPServer
+	udp = network.NewUDPServer(network.Config{Addr: s.cfg.Addr}, func(addr net.Addr, packet []byte) {
+		resp, dst, err := s.Respond(ctx, packet)
+		if err != nil || resp == nil {
+			return
+		}
+		if _, err := udp.WriteTo(resp, dst); err != nil {
+			logger.L().WarnContext(ctx, "failed to send dhcp reply", "addr", dst, "error", err)
+		}
+	})
+	udp.ListenConfig.Control = setBroadcast
+	g.Go(func() error { return udp.ListenAndServe(ctx) })
+
+	g.Go(func() error {
+		ticker := time.NewTicker(sweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+				s.mu.Lock()
+				s.sweep(ctx)
+				s.mu.Unlock()
+			}
+		}
+	})
+
+	return g.Wait()
+}
+
+// Load restores saved leases and reserves the static addresses in the
+// pool. It runs once, before the first message is handled.
+func (s *Server) Load(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load(ctx)
+}
+
+func (s *Server) load(ctx context.Context) error {
+	if s.loaded {
+		return nil
+	}
+
+	if s.cfg.Leases != nil {
+		saved, err := s.cfg.Leases.LoadLeases(ctx)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		for _, l := range saved {
+			addr, err := netip.ParseAddr(l.IP)
+			if err != nil || !s.subnet.Contains(addr) || !now.Before(l.Expires) || l.Static {
+				continue
+			}
+			// Claim the address again in case the IPAM forgot it; if it
+			// is still allocated, the saved allocation is ours.
+			if alloc, err := s.ipam.ReserveIP(ctx, s.cfg.PoolID, l.IP); err == nil {
+				l.AllocationID = alloc.ID
+			} else if !errors.Is(err, dhcp.ErrIPAlreadyAllocated) {
+				logger.L().WarnContext(ctx, "dropping saved dhcp lease", "ip", l.IP, "error", err)
+				continue
+			}
+			s.put(&l)
+		}
+	}
+
+	// Keep the server's own addresses and the static reservations out of
+	// dynamic allocation. Addresses outside the pool need no reservation.
+	reserved := []netip.Addr{s.serverID}
+	if s.router.IsValid() {
+		reserved = append(reserved, s.router)
+	}
+	for _, addr := range s.static {
+		reserved = append(reserved, addr)
+	}
+	for _, addr := range reserved {
+		if _, err := s.ipam.ReserveIP(ctx, s.cfg.PoolID, addr.String()); err != nil &&
+			!errors.Is(err, dhcp.ErrIPAlreadyAllocated) && !errors.Is(err, dhcp.ErrIPNotInPool) {
+			return err
+		}
+	}
+
+	s.loaded = true
+	return nil
+}
+
+// Leases returns the current leases, ordered by address.
+func (s *Server) Leases() []Lease {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshot()
+}
+
+func (s *Server) snapshot() []Lease {
+	addrs := make([]netip.Addr, 0, len(s.leases))
+	for addr := range s.leases {
+		addrs = append(addrs, addr)
+	}
+	slices.SortFunc(addrs, netip.Addr.Compare)
+
+	leases := make([]Lease, 0, len(addrs))
+	for _, addr := range addrs {
+		leases = append(leases, *s.leases[addr])
+	}
+	return leases
+}
+
+// save persists the leases. Failures are logged rather than failing the
+// message being handled.
+func (s *Server) save(ctx context.Context) {
+	if s.cfg.Leases == nil {
+		return
+	}
+	if err := s.cfg.Leases.SaveLeases(ctx, s.snapshot()); err != nil {
+		logger.L().ErrorContext(ctx, "failed to save dhcp leases", "error", err)
+	}
+}
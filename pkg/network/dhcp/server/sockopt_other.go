@@ -0,0 +1,11 @@
+//go:build !unix
+
+package server
+
+import "syscall"
+
+// setBroadcast is a no-op where SO_BROADCAST cannot be set portably;
+// broadcast replies may fail there.
+func setBroadcast(network, address string, c syscall.RawConn) error {
+	return nil
+}
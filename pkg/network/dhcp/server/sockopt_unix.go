@@ -0,0 +1,18 @@
+//go:build unix
+
+package server
+
+import "syscall"
+
+// setBroadcast enables SO_BROADCAST so that replies can be sent to clients
+// that have no address yet.
+func setBroadcast(network, address string, c syscall.RawConn) error {
+	var opErr error
+	err := c.Control(func(fd uintptr) {
+		opErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_BROADCAST, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return opErr
+}
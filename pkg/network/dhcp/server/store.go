@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/database/kv"
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+)
+
+// Lease states.
+const (
+	// LeaseOffered is an address offered to a client that has not yet
+	// requested it.
+	LeaseOffered = "offered"
+	// LeaseBound is an address acknowledged to a client.
+	LeaseBound = "bound"
+	// LeaseDeclined is an address a client found in use. It is held back
+	// from allocation until the lease expires.
+	LeaseDeclined = "declined"
+)
+
+// Lease is an address handed out by the server.
+type Lease struct {
+	ClientID     string    `json:"client_id"`
+	MAC          string    `json:"mac"`
+	IP           string    `json:"ip"`
+	Hostname     string    `json:"hostname,omitempty"`
+	State        string    `json:"state"`
+	Expires      time.Time `json:"expires"`
+	AllocationID string    `json:"allocation_id,omitempty"`
+	Static       bool      `json:"static,omitempty"`
+}
+
+// LeaseStore persists the server's leases so they survive restarts.
+type LeaseStore interface {
+	// LoadLeases returns the saved leases, or none if nothing was saved.
+	LoadLeases(ctx context.Context) ([]Lease, error)
+
+	// SaveLeases replaces the saved leases.
+	SaveLeases(ctx context.Context, leases []Lease) error
+}
+
+// KVLeaseStore implements LeaseStore on top of a kv.KV, keeping all the
+// leases of a server under one key.
+type KVLeaseStore struct {
+	store kv.KV
+	key   string
+}
+
+// NewKVLeaseStore creates a lease store that saves leases under key.
+func NewKVLeaseStore(store kv.KV, key string) *KVLeaseStore {
+	if key == "" {
+		key = "dhcp:leases"
+	}
+	return &KVLeaseStore{store: store, key: key}
+}
+
+// LoadLeases returns the saved leases.
+func (s *KVLeaseStore) LoadLeases(ctx context.Context) ([]Lease, error) {
+	data, err := s.store.Get(ctx, s.key)
+	if err != nil {
+		var appErr *errors.AppError
+		if errors.As(err, &appErr) && appErr.Code == errors.CodeNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to load leases")
+	}
+
+	var leases []Lease
+	if err := json.Unmarshal(data, &leases); err != nil {
+		return nil, errors.Wrap(err, "failed to decode leases")
+	}
+	return leases, nil
+}
+
+// SaveLeases stores the leases without expiry.
+func (s *KVLeaseStore) SaveLeases(ctx context.Context, leases []Lease) error {
+	data, err := json.Marshal(leases)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode leases")
+	}
+	if err := s.store.Set(ctx, s.key, data, 0); err != nil {
+		return errors.Wrap(err, "failed to store leases")
+	}
+	return nil
+}
@@ -0,0 +1,316 @@
+package tests
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/database/kv"
+	kvmemory "github.com/chris-alexander-pop/system-design-library/pkg/database/kv/adapters/memory"
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/dhcp"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/dhcp/adapters/memory"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/dhcp/server"
+)
+
+var serverID = netip.MustParseAddr("10.0.0.1")
+
+func newServer(t *testing.T, cfg server.Config) *server.Server {
+	t.Helper()
+	ipam := memory.New()
+	if err := ipam.AddPool("lab", "10.0.0.100", "10.0.0.102"); err != nil {
+		t.Fatalf("AddPool failed: %v", err)
+	}
+	cfg.PoolID = "lab"
+	cfg.ServerIP = serverID.String()
+	cfg.Subnet = "10.0.0.0/24"
+	srv, err := server.New(cfg, ipam)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return srv
+}
+
+// client drives the server's state machine like a DHCP client would.
+type client struct {
+	t   *testing.T
+	srv *server.Server
+	mac net.HardwareAddr
+	xid uint32
+}
+
+func newClient(t *testing.T, srv *server.Server, mac string) *client {
+	hw, _ := net.ParseMAC(mac)
+	return &client{t: t, srv: srv, mac: hw}
+}
+
+func (c *client) send(t server.MessageType, ciaddr netip.Addr, opts server.Options) (*server.Message, *net.UDPAddr) {
+	c.t.Helper()
+	c.xid++
+	if opts == nil {
+		opts = server.Options{}
+	}
+	opts[server.OptionMessageType] = []byte{byte(t)}
+	if !ciaddr.IsValid() {
+		ciaddr = netip.IPv4Unspecified()
+	}
+	req := &server.Message{Op: 1, HType: 1, HLen: 6, XID: c.xid, CIAddr: ciaddr, CHAddr: c.mac, Options: opts}
+
+	packet, dst, err := c.srv.Respond(context.Background(), req.Marshal())
+	if err != nil {
+		c.t.Fatalf("Respond(%s) failed: %v", t, err)
+	}
+	if packet == nil {
+		return nil, nil
+	}
+	resp, err := server.ParseMessage(packet)
+	if err != nil {
+		c.t.Fatalf("reply does not parse: %v", err)
+	}
+	if resp.XID != c.xid {
+		c.t.Errorf("reply xid = %d, want %d", resp.XID, c.xid)
+	}
+	return resp, dst
+}
+
+// lease runs DISCOVER/OFFER/REQUEST/ACK and returns the bound address.
+func (c *client) lease() netip.Addr {
+	c.t.Helper()
+	offer, _ := c.send(server.Discover, netip.Addr{}, nil)
+	if offer == nil || offer.Type() != server.Offer {
+		c.t.Fatalf("DISCOVER got %v, want an offer", offer)
+	}
+	ack, _ := c.send(server.Request, netip.Addr{}, server.Options{
+		server.OptionServerID:    serverID.AsSlice(),
+		server.OptionRequestedIP: offer.YIAddr.AsSlice(),
+	})
+	if ack == nil || ack.Type() != server.ACK || ack.YIAddr != offer.YIAddr {
+		c.t.Fatalf("REQUEST got %v, want an ack for %s", ack, offer.YIAddr)
+	}
+	return ack.YIAddr
+}
+
+func TestServerLeasesAddresses(t *testing.T) {
+	srv := newServer(t, server.Config{
+		Router:     "10.0.0.1",
+		DNSServers: []string{"10.0.0.53", "10.0.0.54"},
+		Domain:     "lab.internal",
+		MTU:        9000,
+		LeaseTime:  time.Hour,
+	})
+	c := newClient(t, srv, "52:54:00:00:00:01")
+
+	offer, dst := c.send(server.Discover, netip.Addr{}, nil)
+	if offer == nil || offer.Type() != server.Offer || offer.YIAddr != netip.MustParseAddr("10.0.0.100") {
+		t.Fatalf("offer = %+v, want 10.0.0.100", offer)
+	}
+	if dst.String() != "255.255.255.255:68" {
+		t.Errorf("offer sent to %s, want broadcast", dst)
+	}
+	if id, _ := offer.Options.Addr(server.OptionServerID); id != serverID {
+		t.Errorf("server id = %s", id)
+	}
+	if mask := net.IPMask(offer.Options[server.OptionSubnetMask]).String(); mask != "ffffff00" {
+		t.Errorf("subnet mask = %s", mask)
+	}
+	if dns := offer.Options[server.OptionDNSServers]; len(dns) != 8 {
+		t.Errorf("dns servers option = %v", dns)
+	}
+	if domain := string(offer.Options[server.OptionDomainName]); domain != "lab.internal" {
+		t.Errorf("domain = %q", domain)
+	}
+	if mtu := offer.Options[server.OptionMTU]; len(mtu) != 2 || int(mtu[0])<<8|int(mtu[1]) != 9000 {
+		t.Errorf("mtu option = %v", mtu)
+	}
+
+	ack, _ := c.send(server.Request, netip.Addr{}, server.Options{
+		server.OptionServerID:    serverID.AsSlice(),
+		server.OptionRequestedIP: offer.YIAddr.AsSlice(),
+		server.OptionHostname:    []byte("vm-1"),
+	})
+	if ack == nil || ack.Type() != server.ACK {
+		t.Fatalf("ack = %+v, want ACK", ack)
+	}
+	if secs, _ := ack.Options.Uint32(server.OptionLeaseTime); secs != 3600 {
+		t.Errorf("lease time = %d, want 3600", secs)
+	}
+	if t1, _ := ack.Options.Uint32(server.OptionRenewalTime); t1 != 1800 {
+		t.Errorf("renewal time = %d, want 1800", t1)
+	}
+
+	leases := srv.Leases()
+	if len(leases) != 1 || leases[0].State != server.LeaseBound || leases[0].Hostname != "vm-1" || leases[0].MAC != c.mac.String() {
+		t.Fatalf("leases = %+v", leases)
+	}
+
+	// Renewing is unicast to the client, and a shorter requested lease is
+	// honoured.
+	renew, dst := c.send(server.Request, ack.YIAddr, server.Options{server.OptionLeaseTime: {0, 0, 0, 60}})
+	if renew == nil || renew.Type() != server.ACK || dst.String() != "10.0.0.100:68" {
+		t.Fatalf("renew = %+v to %s, want an ACK to the client", renew, dst)
+	}
+	if secs, _ := renew.Options.Uint32(server.OptionLeaseTime); secs != 60 {
+		t.Errorf("renewed lease time = %d, want 60", secs)
+	}
+
+	// A rediscovering client is offered its own address.
+	if again, _ := c.send(server.Discover, netip.Addr{}, nil); again.YIAddr != ack.YIAddr {
+		t.Errorf("rediscover offered %s, want %s", again.YIAddr, ack.YIAddr)
+	}
+
+	// INFORM returns configuration without an address.
+	inform, _ := c.send(server.Inform, netip.MustParseAddr("10.0.0.77"), nil)
+	if inform == nil || inform.Type() != server.ACK || !inform.YIAddr.IsUnspecified() {
+		t.Errorf("inform = %+v, want an ACK without an address", inform)
+	}
+	if _, ok := inform.Options.Uint32(server.OptionLeaseTime); ok {
+		t.Error("inform reply carries a lease time")
+	}
+}
+
+func TestServerRefusesAndReclaims(t *testing.T) {
+	srv := newServer(t, server.Config{OfferTimeout: 50 * time.Millisecond})
+	a := newClient(t, srv, "52:54:00:00:00:0a")
+	b := newClient(t, srv, "52:54:00:00:00:0b")
+	c := newClient(t, srv, "52:54:00:00:00:0c")
+
+	addrA := a.lease()
+
+	// Asking for an address held by another client, or for the wrong
+	// network, is refused.
+	nak, dst := b.send(server.Request, netip.Addr{}, server.Options{server.OptionRequestedIP: addrA.AsSlice()})
+	if nak == nil || nak.Type() != server.NAK || dst.String() != "255.255.255.255:68" {
+		t.Errorf("request for a taken address = %+v to %s, want a broadcast NAK", nak, dst)
+	}
+	if nak, _ := b.send(server.Request, netip.Addr{}, server.Options{server.OptionRequestedIP: {192, 168, 0, 9}}); nak == nil || nak.Type() != server.NAK {
+		t.Errorf("request for another network = %+v, want NAK", nak)
+	}
+
+	// A client taking another server's offer frees ours.
+	offer, _ := b.send(server.Discover, netip.Addr{}, nil)
+	if resp, _ := b.send(server.Request, netip.Addr{}, server.Options{
+		server.OptionServerID:    {10, 0, 0, 2},
+		server.OptionRequestedIP: offer.YIAddr.AsSlice(),
+	}); resp != nil {
+		t.Errorf("request to another server got %+v, want no reply", resp)
+	}
+	if got := c.lease(); got != offer.YIAddr {
+		t.Errorf("freed offer not reused: got %s, want %s", got, offer.YIAddr)
+	}
+
+	// The pool holds three addresses; a declined one is kept out of use.
+	addrB := b.lease()
+	b.send(server.Decline, netip.Addr{}, server.Options{
+		server.OptionServerID:    serverID.AsSlice(),
+		server.OptionRequestedIP: addrB.AsSlice(),
+	})
+	d := newClient(t, srv, "52:54:00:00:00:0d")
+	if offer, _ := d.send(server.Discover, netip.Addr{}, nil); offer != nil {
+		t.Errorf("offered %s from an exhausted pool", offer.YIAddr)
+	}
+
+	// Releasing returns an address to the pool.
+	a.send(server.Release, addrA, server.Options{server.OptionServerID: serverID.AsSlice()})
+	if got := d.lease(); got != addrA {
+		t.Errorf("released address not reused: got %s, want %s", got, addrA)
+	}
+
+	// Offers that are not requested expire.
+	e := newClient(t, srv, "52:54:00:00:00:0e")
+	d.send(server.Release, addrA, nil)
+	offer, _ = e.send(server.Discover, netip.Addr{}, nil)
+	time.Sleep(100 * time.Millisecond)
+	if got := a.lease(); got != offer.YIAddr {
+		t.Errorf("expired offer not reused: got %s, want %s", got, offer.YIAddr)
+	}
+}
+
+func TestServerReservationsAndRelays(t *testing.T) {
+	srv := newServer(t, server.Config{Reservations: map[string]string{"52:54:00:AA:BB:CC": "10.0.0.50"}})
+	reserved := newClient(t, srv, "52:54:00:aa:bb:cc")
+	if got := reserved.lease(); got != netip.MustParseAddr("10.0.0.50") {
+		t.Errorf("reserved client got %s, want 10.0.0.50", got)
+	}
+	if nak, _ := reserved.send(server.Request, netip.Addr{}, server.Options{server.OptionRequestedIP: {10, 0, 0, 101}}); nak == nil || nak.Type() != server.NAK {
+		t.Errorf("reserved client asking for another address = %+v, want NAK", nak)
+	}
+
+	other := newClient(t, srv, "52:54:00:00:00:01")
+	if nak, _ := other.send(server.Request, netip.Addr{}, server.Options{server.OptionRequestedIP: {10, 0, 0, 50}}); nak == nil || nak.Type() != server.NAK {
+		t.Errorf("another client asking for the reservation = %+v, want NAK", nak)
+	}
+
+	// Relayed requests are answered through the relay agent.
+	req := &server.Message{Op: 1, HType: 1, HLen: 6, XID: 7, GIAddr: netip.MustParseAddr("10.0.0.254"), CIAddr: netip.IPv4Unspecified(), CHAddr: other.mac,
+		Options: server.Options{server.OptionMessageType: {byte(server.Discover)}}}
+	resp, dst, err := srv.Respond(context.Background(), req.Marshal())
+	if err != nil || resp == nil || dst.String() != "10.0.0.254:67" {
+		t.Errorf("relayed discover sent to %v (err %v), want the relay", dst, err)
+	}
+	req.GIAddr = netip.MustParseAddr("172.16.0.1")
+	if resp, _, _ := srv.Respond(context.Background(), req.Marshal()); resp != nil {
+		t.Error("answered a relay from another network")
+	}
+}
+
+func TestServerPersistsLeases(t *testing.T) {
+	var store kv.KV = kvmemory.New()
+	cfg := server.Config{Leases: server.NewKVLeaseStore(store, "dhcp:lab")}
+
+	c := newClient(t, newServer(t, cfg), "52:54:00:00:00:01")
+	addr := c.lease()
+
+	// After a restart with a fresh IPAM, the lease is restored: the client
+	// can confirm it and nobody else is offered it.
+	restarted := newServer(t, cfg)
+	if err := restarted.Load(context.Background()); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if leases := restarted.Leases(); len(leases) != 1 || leases[0].IP != addr.String() {
+		t.Fatalf("restored leases = %+v", leases)
+	}
+	other := newClient(t, restarted, "52:54:00:00:00:02")
+	if got := other.lease(); got == addr {
+		t.Errorf("restored address %s offered to another client", addr)
+	}
+	c.srv = restarted
+	if ack, _ := c.send(server.Request, netip.Addr{}, server.Options{server.OptionRequestedIP: addr.AsSlice()}); ack == nil || ack.Type() != server.ACK {
+		t.Errorf("confirming a restored lease = %+v, want ACK", ack)
+	}
+}
+
+func TestMemoryIPAMPools(t *testing.T) {
+	ctx := context.Background()
+	ipam := memory.New()
+	if _, err := ipam.AllocateIP(ctx, "missing"); !errors.Is(err, dhcp.ErrPoolNotFound) {
+		t.Errorf("allocating from an unknown pool = %v, want ErrPoolNotFound", err)
+	}
+	if err := ipam.AddPool("p", "10.1.0.1", "10.1.0.2"); err != nil {
+		t.Fatalf("AddPool failed: %v", err)
+	}
+
+	reserved, err := ipam.ReserveIP(ctx, "p", "10.1.0.1")
+	if err != nil {
+		t.Fatalf("ReserveIP failed: %v", err)
+	}
+	if _, err := ipam.ReserveIP(ctx, "p", "10.1.0.1"); !errors.Is(err, dhcp.ErrIPAlreadyAllocated) {
+		t.Errorf("reserving twice = %v, want ErrIPAlreadyAllocated", err)
+	}
+	if _, err := ipam.ReserveIP(ctx, "p", "10.1.0.3"); !errors.Is(err, dhcp.ErrIPNotInPool) {
+		t.Errorf("reserving outside the pool = %v, want ErrIPNotInPool", err)
+	}
+	if alloc, err := ipam.AllocateIP(ctx, "p"); err != nil || alloc.IP != "10.1.0.2" {
+		t.Errorf("AllocateIP = %+v, %v; want 10.1.0.2", alloc, err)
+	}
+	if _, err := ipam.AllocateIP(ctx, "p"); !errors.Is(err, dhcp.ErrIPExhausted) {
+		t.Errorf("allocating from a full pool = %v, want ErrIPExhausted", err)
+	}
+	if err := ipam.ReleaseIP(ctx, reserved.ID); err != nil {
+		t.Fatalf("ReleaseIP failed: %v", err)
+	}
+	if alloc, err := ipam.AllocateIP(ctx, "p"); err != nil || alloc.IP != "10.1.0.1" {
+		t.Errorf("AllocateIP after release = %+v, %v; want 10.1.0.1", alloc, err)
+	}
+}
@@ -129,6 +129,8 @@ func (m *Manager) CreateRecord(ctx context.Context, opts dns.CreateRecordOptions
 		Proxied:   opts.Proxied,
 		CreatedAt: now,
 		UpdatedAt: now,
+
+		TargetPoolID: opts.TargetPoolID,
 	}
 
 	if record.Values == nil && record.Value != "" {
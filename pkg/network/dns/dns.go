@@ -13,6 +13,9 @@
 //
 //	manager := memory.New()
 //	err := manager.CreateRecord(ctx, dns.Record{Name: "api.example.com", Type: dns.TypeA, Value: "10.0.0.1"})
+//
+// The zones of any manager can be served authoritatively with
+// pkg/network/dns/server.
 package dns
 
 import (
@@ -129,6 +132,11 @@ type Record struct {
 	// Proxied indicates if the record is proxied (Cloudflare).
 	Proxied bool
 
+	// TargetPoolID ties an A or AAAA record to a load balancer target
+	// pool. The DNS server answers with the pool's healthy targets instead of
+	// Values; cloud providers ignore it.
+	TargetPoolID string
+
 	// CreatedAt is when the record was created.
 	CreatedAt time.Time
 
@@ -176,6 +184,9 @@ type CreateRecordOptions struct {
 
 	// Proxied for Cloudflare.
 	Proxied bool
+
+	// TargetPoolID ties the record to a load balancer target pool.
+	TargetPoolID string
 }
 
 // UpdateRecordOptions configures record updates.
@@ -6,7 +6,7 @@ import (
 	"time"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
-	"go.opentelemetry.io/otel"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
@@ -24,7 +24,7 @@ func NewInstrumentedManager(manager DNSManager, name string) *InstrumentedManage
 	return &InstrumentedManager{
 		next:   manager,
 		name:   name,
-		tracer: otel.Tracer("pkg/network/dns"),
+		tracer: instrument.NewTracer("pkg/network/dns"),
 	}
 }
 
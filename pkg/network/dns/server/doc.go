@@ -0,0 +1,27 @@
+/*
+Package server provides an authoritative DNS server for the zones of any
+dns.DNSManager, built on network.UDPServer and network.TCPServer.
+
+The server answers A, AAAA, CNAME, MX, TXT, SRV, NS, SOA, PTR and CAA
+questions for every zone the manager holds and refuses names outside them.
+It distinguishes NXDOMAIN from NODATA, returning the zone's SOA for negative
+caching, expands wildcard records ("*.example.com") and follows CNAME chains
+within its zones. UDP responses larger than the client accepts (512 bytes,
+or the EDNS buffer size) are truncated so that the client retries over TCP.
+Zones without SOA or NS records get them synthesized from the zone.
+Zones and their records are cached for Config.ZoneCacheTTL, so record
+changes are served once the cache expires.
+
+A and AAAA records with a TargetPoolID are answered from the load balancer
+target pool instead of their values: healthy targets of the record's
+address family in weighted random order, with a short TTL. If no target is
+healthy every target is returned.
+
+Usage:
+
+	import "github.com/chris-alexander-pop/system-design-library/pkg/network/dns/server"
+
+	srv := server.New(server.Config{Addr: ":53"}, dnsManager, lbManager)
+	err := srv.ListenAndServe(ctx)
+*/
+package server
@@ -0,0 +1,268 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/dns"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/loadbalancer"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// defaultTTL is the TTL of records stored without one.
+const defaultTTL = 300
+
+// maxTXTString is the longest character-string a TXT record can hold.
+const maxTXTString = 255
+
+// resources converts a record to resource records owned by owner. Values
+// that do not parse as the record's type are skipped.
+func (s *Server) resources(ctx context.Context, owner dnsmessage.Name, r *dns.Record) ([]dnsmessage.Resource, error) {
+	if r.TargetPoolID != "" && (r.Type == dns.TypeA || r.Type == dns.TypeAAAA) {
+		return s.poolResources(ctx, owner, r)
+	}
+	if r.Type == dns.TypeSOA {
+		rr, err := soaResource(owner, r)
+		if err != nil {
+			return nil, nil
+		}
+		return []dnsmessage.Resource{rr}, nil
+	}
+
+	var out []dnsmessage.Resource
+	for _, v := range recordValues(r) {
+		body, err := resourceBody(r, v)
+		if err != nil {
+			continue
+		}
+		out = append(out, newResource(owner, recordTTL(r), body))
+	}
+	return out, nil
+}
+
+func resourceBody(r *dns.Record, v string) (dnsmessage.ResourceBody, error) {
+	switch r.Type {
+	case dns.TypeA:
+		addr, err := netip.ParseAddr(v)
+		if err != nil || !addr.Is4() {
+			return nil, errors.InvalidArgument("invalid A record value", err)
+		}
+		return &dnsmessage.AResource{A: addr.As4()}, nil
+
+	case dns.TypeAAAA:
+		addr, err := netip.ParseAddr(v)
+		if err != nil || !addr.Is6() || addr.Is4In6() {
+			return nil, errors.InvalidArgument("invalid AAAA record value", err)
+		}
+		return &dnsmessage.AAAAResource{AAAA: addr.As16()}, nil
+
+	case dns.TypeCNAME:
+		name, err := absoluteName(v)
+		return &dnsmessage.CNAMEResource{CNAME: name}, err
+
+	case dns.TypeNS:
+		name, err := absoluteName(v)
+		return &dnsmessage.NSResource{NS: name}, err
+
+	case dns.TypePTR:
+		name, err := absoluteName(v)
+		return &dnsmessage.PTRResource{PTR: name}, err
+
+	case dns.TypeMX:
+		// Either "mail.example.com" with Priority, or "10 mail.example.com".
+		pref, host := r.Priority, v
+		if fields := strings.Fields(v); len(fields) == 2 {
+			p, err := strconv.ParseUint(fields[0], 10, 16)
+			if err != nil {
+				return nil, errors.InvalidArgument("invalid MX preference", err)
+			}
+			pref, host = int(p), fields[1]
+		}
+		name, err := absoluteName(host)
+		return &dnsmessage.MXResource{Pref: uint16(pref), MX: name}, err
+
+	case dns.TypeSRV:
+		// Either "svc.example.com" with Priority, Weight and Port, or
+		// "priority weight port svc.example.com".
+		prio, weight, port, target := r.Priority, r.Weight, r.Port, v
+		if fields := strings.Fields(v); len(fields) == 4 {
+			nums := make([]int, 3)
+			for i := range nums {
+				n, err := strconv.ParseUint(fields[i], 10, 16)
+				if err != nil {
+					return nil, errors.InvalidArgument("invalid SRV record value", err)
+				}
+				nums[i] = int(n)
+			}
+			prio, weight, port, target = nums[0], nums[1], nums[2], fields[3]
+		}
+		name, err := absoluteName(target)
+		return &dnsmessage.SRVResource{Priority: uint16(prio), Weight: uint16(weight), Port: uint16(port), Target: name}, err
+
+	case dns.TypeTXT:
+		var txt []string
+		for len(v) > maxTXTString {
+			txt, v = append(txt, v[:maxTXTString]), v[maxTXTString:]
+		}
+		return &dnsmessage.TXTResource{TXT: append(txt, v)}, nil
+
+	case dns.TypeCAA:
+		// "flags tag value", e.g. `0 issue "letsencrypt.org"`.
+		fields := strings.SplitN(v, " ", 3)
+		if len(fields) != 3 {
+			return nil, errors.InvalidArgument("invalid CAA record value", nil)
+		}
+		flags, err := strconv.ParseUint(fields[0], 10, 8)
+		if err != nil || fields[1] == "" || len(fields[1]) > 255 {
+			return nil, errors.InvalidArgument("invalid CAA record value", err)
+		}
+		data := []byte{byte(flags), byte(len(fields[1]))}
+		data = append(data, fields[1]...)
+		data = append(data, strings.Trim(fields[2], `"`)...)
+		return &dnsmessage.UnknownResource{Type: typeCAA, Data: data}, nil
+	}
+	return nil, errors.InvalidArgument(fmt.Sprintf("unsupported record type %q", r.Type), nil)
+}
+
+// soaResource parses an SOA record value of the form
+// "mname rname serial refresh retry expire minimum".
+func soaResource(owner dnsmessage.Name, r *dns.Record) (dnsmessage.Resource, error) {
+	fields := strings.Fields(r.Value)
+	if len(fields) != 7 {
+		return dnsmessage.Resource{}, errors.InvalidArgument("invalid SOA record value", nil)
+	}
+	mname, err := absoluteName(fields[0])
+	if err != nil {
+		return dnsmessage.Resource{}, err
+	}
+	rname, err := absoluteName(fields[1])
+	if err != nil {
+		return dnsmessage.Resource{}, err
+	}
+	nums := make([]uint32, 5)
+	for i := range nums {
+		n, err := strconv.ParseUint(fields[i+2], 10, 32)
+		if err != nil {
+			return dnsmessage.Resource{}, errors.InvalidArgument("invalid SOA record value", err)
+		}
+		nums[i] = uint32(n)
+	}
+
+	return newResource(owner, recordTTL(r), &dnsmessage.SOAResource{
+		NS:      mname,
+		MBox:    rname,
+		Serial:  nums[0],
+		Refresh: nums[1],
+		Retry:   nums[2],
+		Expire:  nums[3],
+		MinTTL:  nums[4],
+	}), nil
+}
+
+func soaValue(mname, rname string, serial, minimum uint32) string {
+	return fmt.Sprintf("%s %s %d 3600 600 86400 %d", mname, rname, serial, minimum)
+}
+
+// poolResources answers a pool record with the addresses of the pool's
+// healthy targets of the record's family, in weighted random order. If no
+// target is healthy every target is returned, since answering with
+// addresses that might work beats answering with none.
+func (s *Server) poolResources(ctx context.Context, owner dnsmessage.Name, r *dns.Record) ([]dnsmessage.Resource, error) {
+	if s.pools == nil {
+		return nil, errors.Internal("record has a target pool but the server has no load balancer manager", nil)
+	}
+	targets, err := s.pools.GetTargetHealth(ctx, r.TargetPoolID)
+	if err != nil {
+		return nil, err
+	}
+
+	type candidate struct {
+		addr    netip.Addr
+		key     float64
+		healthy bool
+	}
+	var candidates []candidate
+	healthy := 0
+	for _, t := range targets {
+		addr, err := netip.ParseAddr(t.Address)
+		addr = addr.Unmap()
+		if err != nil || addr.Is4() != (r.Type == dns.TypeA) {
+			continue
+		}
+		weight := max(t.Weight, 1)
+		c := candidate{
+			addr: addr,
+			// Efraimidis-Spirakis: ordering by u^(1/w) is a weighted random
+			// permutation.
+			key:     math.Pow(rand.Float64(), 1/float64(weight)),
+			healthy: t.Status == loadbalancer.TargetStatusHealthy,
+		}
+		if c.healthy {
+			healthy++
+		}
+		candidates = append(candidates, c)
+	}
+	if healthy > 0 {
+		candidates = slices.DeleteFunc(candidates, func(c candidate) bool { return !c.healthy })
+	}
+	slices.SortFunc(candidates, func(a, b candidate) int { return cmp.Compare(b.key, a.key) })
+	if s.cfg.MaxPoolAnswers > 0 && len(candidates) > s.cfg.MaxPoolAnswers {
+		candidates = candidates[:s.cfg.MaxPoolAnswers]
+	}
+
+	ttl := uint32(s.cfg.PoolTTL.Seconds())
+	out := make([]dnsmessage.Resource, 0, len(candidates))
+	for _, c := range candidates {
+		var body dnsmessage.ResourceBody
+		if c.addr.Is4() {
+			body = &dnsmessage.AResource{A: c.addr.As4()}
+		} else {
+			body = &dnsmessage.AAAAResource{AAAA: c.addr.As16()}
+		}
+		out = append(out, newResource(owner, ttl, body))
+	}
+	return out, nil
+}
+
+func newResource(owner dnsmessage.Name, ttl uint32, body dnsmessage.ResourceBody) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: owner, Class: dnsmessage.ClassINET, TTL: ttl},
+		Body:   body,
+	}
+}
+
+func recordValues(r *dns.Record) []string {
+	if len(r.Values) > 0 {
+		return r.Values
+	}
+	if r.Value != "" {
+		return []string{r.Value}
+	}
+	return nil
+}
+
+func recordTTL(r *dns.Record) uint32 {
+	if r.TTL <= 0 {
+		return defaultTTL
+	}
+	return uint32(r.TTL)
+}
+
+func absoluteName(name string) (dnsmessage.Name, error) {
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	n, err := dnsmessage.NewName(name)
+	if err != nil {
+		return dnsmessage.Name{}, errors.InvalidArgument("invalid domain name", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,340 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/concurrency"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/dns"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// maxCNAMEChain bounds how many CNAMEs are followed within served zones.
+const maxCNAMEChain = 8
+
+// typeCAA is the CAA record type, which dnsmessage has no constant for.
+const typeCAA dnsmessage.Type = 257
+
+var recordTypes = map[dns.RecordType]dnsmessage.Type{
+	dns.TypeA:     dnsmessage.TypeA,
+	dns.TypeAAAA:  dnsmessage.TypeAAAA,
+	dns.TypeCNAME: dnsmessage.TypeCNAME,
+	dns.TypeMX:    dnsmessage.TypeMX,
+	dns.TypeTXT:   dnsmessage.TypeTXT,
+	dns.TypeNS:    dnsmessage.TypeNS,
+	dns.TypeSOA:   dnsmessage.TypeSOA,
+	dns.TypeSRV:   dnsmessage.TypeSRV,
+	dns.TypeCAA:   typeCAA,
+	dns.TypePTR:   dnsmessage.TypePTR,
+}
+
+// result is the outcome of resolving a question.
+type result struct {
+	rcode         dnsmessage.RCode
+	authoritative bool
+	answers       []dnsmessage.Resource
+	authorities   []dnsmessage.Resource
+	additionals   []dnsmessage.Resource
+}
+
+// zoneData is a snapshot of a zone's records indexed by canonical owner name.
+type zoneData struct {
+	name  string
+	names map[string][]*dns.Record
+	soa   *dns.Record
+}
+
+// zoneCache holds the served zones and their indexed records for
+// ZoneCacheTTL, so that answering a question does not list every zone and
+// record.
+type zoneCache struct {
+	mu      *concurrency.SmartMutex
+	zones   []*dns.Zone
+	data    map[string]*zoneData // by zone ID
+	expires time.Time
+}
+
+func newZoneCache() *zoneCache {
+	return &zoneCache{
+		mu:   concurrency.NewSmartMutex(concurrency.MutexConfig{Name: "dns-server-zone-cache"}),
+		data: make(map[string]*zoneData),
+	}
+}
+
+// resolve answers q from the served zones. A name in no served zone is
+// refused; CNAMEs are followed while their targets stay in served zones.
+func (s *Server) resolve(ctx context.Context, q dnsmessage.Question) (*result, error) {
+	res := &result{}
+	name := canonical(q.Name.String())
+	owner := q.Name
+
+	for hop := 0; hop < maxCNAMEChain; hop++ {
+		z, err := s.loadZone(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if z == nil {
+			if hop == 0 {
+				res.rcode = dnsmessage.RCodeRefused
+			}
+			// The chain leaves our zones; the resolver follows it from here.
+			return res, nil
+		}
+		res.authoritative = true
+
+		records, exists := z.lookup(name)
+		if !exists {
+			res.rcode = dnsmessage.RCodeNameError
+			res.authorities = append(res.authorities, s.negativeSOA(z))
+			return res, nil
+		}
+
+		var matched []*dns.Record
+		var cname *dns.Record
+		for _, r := range records {
+			t, ok := recordTypes[r.Type]
+			if !ok {
+				continue
+			}
+			if t == q.Type || q.Type == dnsmessage.TypeALL {
+				matched = append(matched, r)
+			}
+			if t == dnsmessage.TypeCNAME {
+				cname = r
+			}
+		}
+
+		if len(matched) > 0 {
+			for _, r := range matched {
+				rrs, err := s.resources(ctx, owner, r)
+				if err != nil {
+					return nil, err
+				}
+				res.answers = append(res.answers, rrs...)
+			}
+			res.additionals = append(res.additionals, s.glue(ctx, z, res.answers)...)
+			return res, nil
+		}
+
+		if cname == nil {
+			// NODATA: the name exists without records of this type.
+			res.authorities = append(res.authorities, s.negativeSOA(z))
+			return res, nil
+		}
+
+		rrs, err := s.resources(ctx, owner, cname)
+		if err != nil {
+			return nil, err
+		}
+		res.answers = append(res.answers, rrs...)
+		if len(rrs) == 0 {
+			return res, nil
+		}
+		owner = rrs[0].Body.(*dnsmessage.CNAMEResource).CNAME
+		name = canonical(owner.String())
+	}
+	return res, nil
+}
+
+// loadZone returns the served zone that is the closest enclosing zone of
+// name, or nil if none is. Zones are read through the cache, which is
+// refreshed as a whole once it expires.
+func (s *Server) loadZone(ctx context.Context, name string) (*zoneData, error) {
+	c := s.cache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now := time.Now(); now.After(c.expires) {
+		zones, err := s.zones.ListZones(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.zones = zones
+		clear(c.data)
+		c.expires = now.Add(s.cfg.ZoneCacheTTL)
+	}
+
+	var best *dns.Zone
+	for _, z := range c.zones {
+		zn := canonical(z.Name)
+		if inZone(name, zn) && (best == nil || len(zn) > len(canonical(best.Name))) {
+			best = z
+		}
+	}
+	if best == nil {
+		return nil, nil
+	}
+
+	if z, ok := c.data[best.ID]; ok {
+		return z, nil
+	}
+	z, err := s.indexZone(ctx, best)
+	if err != nil {
+		return nil, err
+	}
+	c.data[best.ID] = z
+	return z, nil
+}
+
+// indexZone reads the records of zone and indexes them by owner name.
+func (s *Server) indexZone(ctx context.Context, zone *dns.Zone) (*zoneData, error) {
+	list, err := s.zones.ListRecords(ctx, zone.ID, dns.ListRecordsOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	z := &zoneData{name: canonical(zone.Name), names: make(map[string][]*dns.Record)}
+	var serial time.Time
+	hasNS := false
+	for _, r := range list.Records {
+		owner := ownerName(r.Name, z.name)
+		z.names[owner] = append(z.names[owner], r)
+		if r.UpdatedAt.After(serial) {
+			serial = r.UpdatedAt
+		}
+		if owner == z.name && r.Type == dns.TypeSOA {
+			if _, err := soaResource(dnsmessage.Name{}, r); err == nil {
+				z.soa = r
+			}
+		}
+		if owner == z.name && r.Type == dns.TypeNS {
+			hasNS = true
+		}
+	}
+
+	// Zones managed through the API rarely carry SOA and NS records of
+	// their own; synthesize them from the zone.
+	if !hasNS {
+		for _, ns := range zone.NameServers {
+			z.names[z.name] = append(z.names[z.name], &dns.Record{Name: z.name, Type: dns.TypeNS, Values: []string{ns}})
+		}
+	}
+	if z.soa == nil {
+		mname := "ns1." + z.name
+		if len(zone.NameServers) > 0 {
+			mname = zone.NameServers[0]
+		}
+		if serial.IsZero() {
+			serial = zone.CreatedAt
+		}
+		z.soa = &dns.Record{
+			Name:  z.name,
+			Type:  dns.TypeSOA,
+			Value: soaValue(mname, "hostmaster."+z.name, uint32(serial.Unix()), uint32(s.cfg.NegativeTTL.Seconds())),
+			TTL:   int(s.cfg.NegativeTTL.Seconds()),
+		}
+		z.names[z.name] = append(z.names[z.name], z.soa)
+	}
+	return z, nil
+}
+
+// lookup returns the records owned by name, falling back to the wildcard of
+// its closest encloser (RFC 4592). exists is false for NXDOMAIN; a name that
+// only has descendants exists without records.
+func (z *zoneData) lookup(name string) (records []*dns.Record, exists bool) {
+	if records := z.names[name]; len(records) > 0 {
+		return records, true
+	}
+	if z.hasDescendants(name) {
+		return nil, true
+	}
+
+	for encloser := parent(name); inZone(encloser, z.name); encloser = parent(encloser) {
+		if len(z.names[encloser]) == 0 && !z.hasDescendants(encloser) {
+			continue
+		}
+		if wildcard := z.names["*."+encloser]; len(wildcard) > 0 {
+			return wildcard, true
+		}
+		return nil, false
+	}
+	return nil, false
+}
+
+func (z *zoneData) hasDescendants(name string) bool {
+	suffix := "." + name
+	for owner := range z.names {
+		if strings.HasSuffix(owner, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// negativeSOA returns the zone's SOA for the authority section of a
+// negative answer, with the TTL resolvers cache the answer for.
+func (s *Server) negativeSOA(z *zoneData) dnsmessage.Resource {
+	owner, _ := absoluteName(z.name)
+	rr, _ := soaResource(owner, z.soa)
+	if soa, ok := rr.Body.(*dnsmessage.SOAResource); ok {
+		rr.Header.TTL = min(rr.Header.TTL, soa.MinTTL)
+	}
+	return rr
+}
+
+// glue returns the addresses of in-zone names that MX, NS and SRV answers
+// point to.
+func (s *Server) glue(ctx context.Context, z *zoneData, answers []dnsmessage.Resource) []dnsmessage.Resource {
+	var out []dnsmessage.Resource
+	seen := make(map[string]bool)
+	for _, a := range answers {
+		var target dnsmessage.Name
+		switch body := a.Body.(type) {
+		case *dnsmessage.MXResource:
+			target = body.MX
+		case *dnsmessage.NSResource:
+			target = body.NS
+		case *dnsmessage.SRVResource:
+			target = body.Target
+		default:
+			continue
+		}
+		name := canonical(target.String())
+		if seen[name] || !inZone(name, z.name) {
+			continue
+		}
+		seen[name] = true
+		for _, r := range z.names[name] {
+			if r.Type != dns.TypeA && r.Type != dns.TypeAAAA {
+				continue
+			}
+			rrs, err := s.resources(ctx, target, r)
+			if err != nil {
+				continue
+			}
+			out = append(out, rrs...)
+		}
+	}
+	return out
+}
+
+// canonical lowercases name and strips its trailing dot.
+func canonical(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// ownerName returns the canonical owner of a record name, which may be
+// absolute ("api.example.com"), relative ("api") or "@" for the apex.
+func ownerName(name, zone string) string {
+	name = canonical(name)
+	switch {
+	case name == "" || name == "@":
+		return zone
+	case inZone(name, zone):
+		return name
+	default:
+		return name + "." + zone
+	}
+}
+
+func inZone(name, zone string) bool {
+	return name == zone || strings.HasSuffix(name, "."+zone)
+}
+
+func parent(name string) string {
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		return name[i+1:]
+	}
+	return ""
+}
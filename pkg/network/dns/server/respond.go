@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Respond answers a wire-format query with a response of at most maxSize
+// bytes. A response that does not fit is truncated to its header and
+// question with the TC bit set, so the client retries over TCP. Respond
+// returns nil for input too malformed to answer.
+func (s *Server) Respond(ctx context.Context, query []byte, maxSize int) ([]byte, error) {
+	var p dnsmessage.Parser
+	hdr, err := p.Start(query)
+	if err != nil || hdr.Response {
+		return nil, nil
+	}
+
+	resp := dnsmessage.Message{Header: dnsmessage.Header{
+		ID:               hdr.ID,
+		Response:         true,
+		OpCode:           hdr.OpCode,
+		RecursionDesired: hdr.RecursionDesired,
+	}}
+
+	questions, err := p.AllQuestions()
+	if err != nil || len(questions) != 1 {
+		resp.Header.RCode = dnsmessage.RCodeFormatError
+		return resp.Pack()
+	}
+	q := questions[0]
+	resp.Questions = questions
+
+	// EDNS: echo an OPT record to clients that sent one.
+	var edns []dnsmessage.Resource
+	_ = p.SkipAllAnswers()
+	_ = p.SkipAllAuthorities()
+	if _, ok := findOPT(&p); ok {
+		rr := dnsmessage.Resource{Body: &dnsmessage.OPTResource{}}
+		if err := rr.Header.SetEDNS0(maxUDPSize, dnsmessage.RCodeSuccess, false); err == nil {
+			edns = append(edns, rr)
+		}
+	}
+	resp.Additionals = edns
+
+	ctx, span := s.tracer.Start(ctx, "dns.Query", trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+		attribute.String("dns.question.name", q.Name.String()),
+		attribute.String("dns.question.type", q.Type.String()),
+	))
+	defer span.End()
+
+	switch {
+	case hdr.OpCode != 0:
+		resp.Header.RCode = dnsmessage.RCodeNotImplemented
+	case q.Class != dnsmessage.ClassINET && q.Class != dnsmessage.ClassANY:
+		resp.Header.RCode = dnsmessage.RCodeRefused
+	default:
+		res, err := s.resolve(ctx, q)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			logger.L().ErrorContext(ctx, "failed to resolve dns query", "name", q.Name.String(), "type", q.Type.String(), "error", err)
+			resp.Header.RCode = dnsmessage.RCodeServerFailure
+			break
+		}
+		resp.Header.RCode = res.rcode
+		resp.Header.Authoritative = res.authoritative
+		resp.Answers = res.answers
+		resp.Authorities = res.authorities
+		resp.Additionals = append(res.additionals, edns...)
+	}
+	span.SetAttributes(attribute.String("dns.response.code", resp.Header.RCode.String()))
+
+	out, err := resp.Pack()
+	if err != nil {
+		return nil, errors.Internal("failed to pack dns response", err)
+	}
+	if len(out) <= maxSize {
+		return out, nil
+	}
+
+	span.SetAttributes(attribute.Bool("dns.truncated", true))
+	resp.Header.Truncated = true
+	resp.Answers, resp.Authorities, resp.Additionals = nil, nil, edns
+	return resp.Pack()
+}
+
+// udpSize returns the largest UDP response the sender of query accepts.
+func udpSize(query []byte) int {
+	var p dnsmessage.Parser
+	if _, err := p.Start(query); err != nil {
+		return minUDPSize
+	}
+	_ = p.SkipAllQuestions()
+	_ = p.SkipAllAnswers()
+	_ = p.SkipAllAuthorities()
+	opt, ok := findOPT(&p)
+	if !ok {
+		return minUDPSize
+	}
+	return min(max(int(opt.Class), minUDPSize), maxUDPSize)
+}
+
+// findOPT returns the header of the OPT record in the additional section.
+func findOPT(p *dnsmessage.Parser) (dnsmessage.ResourceHeader, bool) {
+	for {
+		h, err := p.AdditionalHeader()
+		if err != nil {
+			return dnsmessage.ResourceHeader{}, false
+		}
+		if h.Type == dnsmessage.TypeOPT {
+			return h, true
+		}
+		if err := p.SkipAdditional(); err != nil {
+			return dnsmessage.ResourceHeader{}, false
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/dns"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/loadbalancer"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// minUDPSize is the largest UDP response a client without EDNS accepts.
+	minUDPSize = 512
+
+	// maxUDPSize is the largest UDP response the server sends, matching the
+	// receive buffer of network.UDPServer.
+	maxUDPSize = 4096
+
+	// maxTCPSize is the largest message that fits the TCP length prefix.
+	maxTCPSize = 65535
+)
+
+// Config holds configuration for the DNS server.
+type Config struct {
+	// Addr is the address to serve on, over both UDP and TCP.
+	Addr string `env:"DNS_SERVER_ADDR" env-default:":53"`
+
+	// ReadTimeout bounds how long a TCP connection may wait for its next
+	// query.
+	ReadTimeout time.Duration `env:"DNS_SERVER_READ_TIMEOUT" env-default:"5s"`
+
+	// WriteTimeout bounds writing a TCP response.
+	WriteTimeout time.Duration `env:"DNS_SERVER_WRITE_TIMEOUT" env-default:"5s"`
+
+	// NegativeTTL is the SOA minimum of zones without an SOA record, which
+	// resolvers use to cache NXDOMAIN and NODATA answers.
+	NegativeTTL time.Duration `env:"DNS_SERVER_NEGATIVE_TTL" env-default:"60s"`
+
+	// PoolTTL is the TTL of answers built from load balancer target pools.
+	// It is short so that clients notice health changes quickly.
+	PoolTTL time.Duration `env:"DNS_SERVER_POOL_TTL" env-default:"5s"`
+
+	// ZoneCacheTTL is how long zones and their records are cached between
+	// reads from the DNS manager. Record changes take up to this long to be
+	// served; answers from target pools are always current.
+	ZoneCacheTTL time.Duration `env:"DNS_SERVER_ZONE_CACHE_TTL" env-default:"5s"`
+
+	// MaxPoolAnswers limits the targets returned for a pool record; 0
+	// returns every healthy target, ordered by weighted random choice.
+	MaxPoolAnswers int `env:"DNS_SERVER_MAX_POOL_ANSWERS"`
+}
+
+// Server is an authoritative DNS server for the zones of a dns.DNSManager.
+type Server struct {
+	cfg    Config
+	zones  dns.DNSManager
+	pools  loadbalancer.LoadBalancerManager
+	tracer trace.Tracer
+	cache  *zoneCache
+}
+
+// New creates a server answering for every zone of zones. pools resolves
+// records tied to load balancer target pools; it may be nil if no record
+// has a TargetPoolID.
+func New(cfg Config, zones dns.DNSManager, pools loadbalancer.LoadBalancerManager) *Server {
+	if cfg.Addr == "" {
+		cfg.Addr = ":53"
+	}
+	if cfg.ReadTimeout <= 0 {
+		cfg.ReadTimeout = 5 * time.Second
+	}
+	if cfg.WriteTimeout <= 0 {
+		cfg.WriteTimeout = 5 * time.Second
+	}
+	if cfg.NegativeTTL <= 0 {
+		cfg.NegativeTTL = 60 * time.Second
+	}
+	if cfg.PoolTTL <= 0 {
+		cfg.PoolTTL = 5 * time.Second
+	}
+	if cfg.ZoneCacheTTL <= 0 {
+		cfg.ZoneCacheTTL = 5 * time.Second
+	}
+
+	return &Server{
+		cfg:    cfg,
+		zones:  zones,
+		pools:  pools,
+		tracer: instrument.NewTracer("pkg/network/dns/server"),
+		cache:  newZoneCache(),
+	}
+}
+
+// ListenAndServe serves DNS over UDP and TCP on cfg.Addr until ctx is
+// cancelled or either listener fails.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	netCfg := network.Config{Addr: s.cfg.Addr, ReadTimeout: s.cfg.ReadTimeout, WriteTimeout: s.cfg.WriteTimeout}
+
+	g, ctx := errgroup.WithContext(ctx)
+
+	var udp *network.UDPServer
+	udp = network.NewUDPServer(netCfg, func(addr net.Addr, query []byte) {
+		resp, err := s.Respond(ctx, query, udpSize(query))
+		if err != nil || resp == nil {
+			return
+		}
+		if _, err := udp.WriteTo(resp, addr); err != nil {
+			logger.L().DebugContext(ctx, "failed to send dns response", "addr", addr, "error", err)
+		}
+	})
+	udp.BufferSize = maxUDPSize
+	g.Go(func() error { return udp.ListenAndServe(ctx) })
+
+	tcp := network.NewTCPServer(netCfg, func(conn net.Conn) { s.serveTCP(ctx, conn) })
+	g.Go(func() error { return tcp.ListenAndServe(ctx) })
+
+	return g.Wait()
+}
+
+// serveTCP answers length-prefixed queries on conn until the client closes
+// it or stays idle for ReadTimeout.
+func (s *Server) serveTCP(ctx context.Context, conn net.Conn) {
+	var prefix [2]byte
+	for ctx.Err() == nil {
+		_ = conn.SetReadDeadline(time.Now().Add(s.cfg.ReadTimeout))
+		if _, err := io.ReadFull(conn, prefix[:]); err != nil {
+			return
+		}
+		query := make([]byte, binary.BigEndian.Uint16(prefix[:]))
+		if _, err := io.ReadFull(conn, query); err != nil {
+			return
+		}
+
+		resp, err := s.Respond(ctx, query, maxTCPSize)
+		if err != nil || resp == nil {
+			return
+		}
+		_ = conn.SetWriteDeadline(time.Now().Add(s.cfg.WriteTimeout))
+		if _, err := conn.Write(binary.BigEndian.AppendUint16(nil, uint16(len(resp)))); err != nil {
+			return
+		}
+		if _, err := conn.Write(resp); err != nil {
+			return
+		}
+	}
+}
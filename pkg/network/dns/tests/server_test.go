@@ -0,0 +1,280 @@
+package tests
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/dns"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/dns/adapters/memory"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/dns/server"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/loadbalancer"
+	lbmemory "github.com/chris-alexander-pop/system-design-library/pkg/network/loadbalancer/adapters/memory"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DNSServerSuite tests the authoritative DNS server against a memory zone.
+type DNSServerSuite struct {
+	suite.Suite
+	srv   *server.Server
+	zones *memory.Manager
+	pools *lbmemory.Manager
+	zone  *dns.Zone
+	ctx   context.Context
+}
+
+// SetupTest creates example.com with a record of each kind and a server
+// with the default configuration.
+func (s *DNSServerSuite) SetupTest() {
+	s.ctx = context.Background()
+	s.zones = memory.New()
+	s.pools = lbmemory.New()
+
+	zone, err := s.zones.CreateZone(s.ctx, dns.CreateZoneOptions{Name: "example.com"})
+	s.Require().NoError(err)
+	s.zone = zone
+
+	s.record(dns.CreateRecordOptions{Name: "www", Type: dns.TypeA, Values: []string{"192.0.2.1", "192.0.2.2"}, TTL: 120})
+	s.record(dns.CreateRecordOptions{Name: "www.example.com", Type: dns.TypeAAAA, Value: "2001:db8::1"})
+	s.record(dns.CreateRecordOptions{Name: "alias", Type: dns.TypeCNAME, Value: "www.example.com"})
+	s.record(dns.CreateRecordOptions{Name: "@", Type: dns.TypeMX, Value: "mail.example.com", Priority: 10})
+	s.record(dns.CreateRecordOptions{Name: "mail", Type: dns.TypeA, Value: "192.0.2.25"})
+	s.record(dns.CreateRecordOptions{Name: "host.internal", Type: dns.TypeA, Value: "10.0.0.1"})
+	s.record(dns.CreateRecordOptions{Name: "*.apps", Type: dns.TypeA, Value: "192.0.2.80"})
+	s.record(dns.CreateRecordOptions{Name: "_sip._tcp", Type: dns.TypeSRV, Value: "mail.example.com", Priority: 1, Weight: 5, Port: 5060})
+
+	s.srv = server.New(server.Config{}, s.zones, s.pools)
+}
+
+func (s *DNSServerSuite) record(opts dns.CreateRecordOptions) {
+	opts.ZoneID = s.zone.ID
+	_, err := s.zones.CreateRecord(s.ctx, opts)
+	s.Require().NoError(err, "CreateRecord %s %s", opts.Name, opts.Type)
+}
+
+func (s *DNSServerSuite) query(name string, qtype dnsmessage.Type) dnsmessage.Message {
+	resp, err := s.srv.Respond(s.ctx, s.packQuery(name, qtype, 0), 4096)
+	s.Require().NoError(err)
+	return s.unpack(resp)
+}
+
+func (s *DNSServerSuite) packQuery(name string, qtype dnsmessage.Type, udpSize uint16) []byte {
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: 42, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: dnsmessage.MustNewName(name), Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	if udpSize > 0 {
+		opt := dnsmessage.Resource{Body: &dnsmessage.OPTResource{}}
+		s.Require().NoError(opt.Header.SetEDNS0(int(udpSize), dnsmessage.RCodeSuccess, false))
+		msg.Additionals = append(msg.Additionals, opt)
+	}
+	out, err := msg.Pack()
+	s.Require().NoError(err)
+	return out
+}
+
+func (s *DNSServerSuite) unpack(data []byte) dnsmessage.Message {
+	var msg dnsmessage.Message
+	s.Require().NoError(msg.Unpack(data))
+	return msg
+}
+
+func addresses(msg dnsmessage.Message) []string {
+	var out []string
+	for _, rr := range msg.Answers {
+		switch body := rr.Body.(type) {
+		case *dnsmessage.AResource:
+			out = append(out, net.IP(body.A[:]).String())
+		case *dnsmessage.AAAAResource:
+			out = append(out, net.IP(body.AAAA[:]).String())
+		}
+	}
+	return out
+}
+
+func (s *DNSServerSuite) TestAnswersRecords() {
+	msg := s.query("WWW.example.com.", dnsmessage.TypeA)
+	s.Require().Equal(dnsmessage.RCodeSuccess, msg.RCode)
+	s.True(msg.Authoritative)
+	s.Equal(uint16(42), msg.ID)
+	s.Equal([]string{"192.0.2.1", "192.0.2.2"}, addresses(msg))
+	s.Equal(uint32(120), msg.Answers[0].Header.TTL)
+
+	msg = s.query("www.example.com.", dnsmessage.TypeAAAA)
+	s.Equal([]string{"2001:db8::1"}, addresses(msg))
+
+	msg = s.query("example.com.", dnsmessage.TypeMX)
+	s.Require().Len(msg.Answers, 1)
+	mx := msg.Answers[0].Body.(*dnsmessage.MXResource)
+	s.Equal(uint16(10), mx.Pref)
+	s.Equal("mail.example.com.", mx.MX.String())
+	s.Require().Len(msg.Additionals, 1, "MX glue")
+	s.Equal("mail.example.com.", msg.Additionals[0].Header.Name.String())
+
+	msg = s.query("_sip._tcp.example.com.", dnsmessage.TypeSRV)
+	s.Require().Len(msg.Answers, 1)
+	srv := msg.Answers[0].Body.(*dnsmessage.SRVResource)
+	s.Equal(uint16(5060), srv.Port)
+	s.Equal(uint16(5), srv.Weight)
+	s.Equal("mail.example.com.", srv.Target.String())
+
+	msg = s.query("example.com.", dnsmessage.TypeSOA)
+	s.Require().Len(msg.Answers, 1)
+	soa := msg.Answers[0].Body.(*dnsmessage.SOAResource)
+	s.Equal(uint32(60), soa.MinTTL)
+	s.Equal("hostmaster.example.com.", soa.MBox.String())
+
+	msg = s.query("example.com.", dnsmessage.TypeNS)
+	s.Len(msg.Answers, len(s.zone.NameServers))
+}
+
+func (s *DNSServerSuite) TestNegativeAnswers() {
+	tests := []struct {
+		name  string
+		qname string
+		qtype dnsmessage.Type
+		rcode dnsmessage.RCode
+	}{
+		{"nxdomain", "missing.example.com.", dnsmessage.TypeA, dnsmessage.RCodeNameError},
+		{"nodata", "mail.example.com.", dnsmessage.TypeAAAA, dnsmessage.RCodeSuccess},
+		{"empty non-terminal", "internal.example.com.", dnsmessage.TypeA, dnsmessage.RCodeSuccess},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			msg := s.query(tt.qname, tt.qtype)
+			s.Equal(tt.rcode, msg.RCode)
+			s.Empty(msg.Answers)
+			s.Require().Len(msg.Authorities, 1)
+			s.Equal(dnsmessage.TypeSOA, msg.Authorities[0].Header.Type)
+			s.Equal(uint32(60), msg.Authorities[0].Header.TTL, "negative TTL")
+		})
+	}
+
+	msg := s.query("example.org.", dnsmessage.TypeA)
+	s.Equal(dnsmessage.RCodeRefused, msg.RCode)
+	s.False(msg.Authoritative)
+}
+
+func (s *DNSServerSuite) TestWildcardAndCNAME() {
+	msg := s.query("billing.apps.example.com.", dnsmessage.TypeA)
+	s.Require().Equal([]string{"192.0.2.80"}, addresses(msg))
+	s.Equal("billing.apps.example.com.", msg.Answers[0].Header.Name.String(), "wildcard owner")
+
+	// The wildcard does not cover names below an existing name.
+	msg = s.query("x.host.internal.example.com.", dnsmessage.TypeA)
+	s.Equal(dnsmessage.RCodeNameError, msg.RCode)
+
+	msg = s.query("alias.example.com.", dnsmessage.TypeA)
+	s.Require().Len(msg.Answers, 3, "CNAME and two A records")
+	s.Equal("www.example.com.", msg.Answers[0].Body.(*dnsmessage.CNAMEResource).CNAME.String())
+	s.Equal("www.example.com.", msg.Answers[1].Header.Name.String(), "A owner")
+}
+
+func (s *DNSServerSuite) TestPoolRecords() {
+	pool, err := s.pools.CreateTargetPool(s.ctx, loadbalancer.CreateTargetPoolOptions{Name: "web", Port: 80})
+	s.Require().NoError(err)
+	for _, target := range []loadbalancer.Target{
+		{Address: "10.0.0.1", Port: 80, Weight: 90},
+		{Address: "10.0.0.2", Port: 80, Weight: 10},
+		{Address: "2001:db8::10", Port: 80},
+	} {
+		s.Require().NoError(s.pools.AddTarget(s.ctx, pool.ID, target))
+	}
+	s.record(dns.CreateRecordOptions{Name: "lb", Type: dns.TypeA, TargetPoolID: pool.ID})
+
+	first := make(map[string]int)
+	for range 500 {
+		msg := s.query("lb.example.com.", dnsmessage.TypeA)
+		got := addresses(msg)
+		s.Require().Len(got, 2, "both IPv4 targets")
+		s.Require().Equal(uint32(5), msg.Answers[0].Header.TTL, "pool TTL")
+		first[got[0]]++
+	}
+	s.GreaterOrEqual(first["10.0.0.1"], 350, "first answers weighted toward 10.0.0.1: %v", first)
+	s.GreaterOrEqual(first["10.0.0.2"], 10, "first answers: %v", first)
+
+	targets, err := s.pools.GetTargetHealth(s.ctx, pool.ID)
+	s.Require().NoError(err)
+	for _, target := range targets {
+		if target.Address == "10.0.0.1" {
+			s.Require().NoError(s.pools.SetTargetHealth(s.ctx, pool.ID, target.ID, loadbalancer.TargetStatusUnhealthy, "timeout"))
+		}
+	}
+	s.Equal([]string{"10.0.0.2"}, addresses(s.query("lb.example.com.", dnsmessage.TypeA)), "only the healthy target")
+}
+
+func (s *DNSServerSuite) TestCachesZones() {
+	s.srv = server.New(server.Config{ZoneCacheTTL: 50 * time.Millisecond}, s.zones, s.pools)
+
+	s.Require().Equal(dnsmessage.RCodeNameError, s.query("late.example.com.", dnsmessage.TypeA).RCode)
+	s.record(dns.CreateRecordOptions{Name: "late", Type: dns.TypeA, Value: "192.0.2.9"})
+	s.Equal(dnsmessage.RCodeNameError, s.query("late.example.com.", dnsmessage.TypeA).RCode, "cached NXDOMAIN")
+
+	s.Eventually(func() bool {
+		got := addresses(s.query("late.example.com.", dnsmessage.TypeA))
+		return len(got) == 1 && got[0] == "192.0.2.9"
+	}, time.Second, 10*time.Millisecond, "new record served after expiry")
+}
+
+func (s *DNSServerSuite) TestTruncatesOverUDP() {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	s.Require().NoError(err)
+	addr := l.Addr().String()
+	l.Close()
+
+	s.srv = server.New(server.Config{Addr: addr}, s.zones, s.pools)
+	long := strings.Repeat("v=spf1 include:_spf.example.com ", 10)
+	s.record(dns.CreateRecordOptions{Name: "big", Type: dns.TypeTXT, Values: []string{long, long, long}})
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+	go func() { _ = s.srv.ListenAndServe(ctx) }()
+
+	var tcp net.Conn
+	s.Require().Eventually(func() bool {
+		tcp, err = net.Dial("tcp", addr)
+		return err == nil
+	}, time.Second, 20*time.Millisecond, "server did not start")
+	defer tcp.Close()
+
+	udp, err := net.Dial("udp", addr)
+	s.Require().NoError(err)
+	defer udp.Close()
+	_ = udp.SetDeadline(time.Now().Add(2 * time.Second))
+	_, err = udp.Write(s.packQuery("big.example.com.", dnsmessage.TypeTXT, 0))
+	s.Require().NoError(err)
+	buf := make([]byte, 4096)
+	n, err := udp.Read(buf)
+	s.Require().NoError(err)
+	s.LessOrEqual(n, 512, "udp response size")
+	msg := s.unpack(buf[:n])
+	s.Require().True(msg.Truncated)
+	s.Require().Empty(msg.Answers)
+
+	query := s.packQuery("big.example.com.", dnsmessage.TypeTXT, 0)
+	_ = tcp.SetDeadline(time.Now().Add(2 * time.Second))
+	_, err = tcp.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(query))), query...))
+	s.Require().NoError(err)
+	var prefix [2]byte
+	_, err = io.ReadFull(tcp, prefix[:])
+	s.Require().NoError(err)
+	resp := make([]byte, binary.BigEndian.Uint16(prefix[:]))
+	_, err = io.ReadFull(tcp, resp)
+	s.Require().NoError(err)
+	msg = s.unpack(resp)
+	s.False(msg.Truncated)
+	s.Require().Len(msg.Answers, 3)
+	txt := msg.Answers[0].Body.(*dnsmessage.TXTResource)
+	s.Len(txt.TXT, 2, "TXT split into two strings")
+	s.Equal(long, strings.Join(txt.TXT, ""))
+}
+
+// TestDNSServerSuite runs the test suite.
+func TestDNSServerSuite(t *testing.T) {
+	suite.Run(t, new(DNSServerSuite))
+}
@@ -2,6 +2,8 @@ package memory
 
 import (
 	"context"
+	"maps"
+	"slices"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/concurrency"
 	"github.com/chris-alexander-pop/system-design-library/pkg/network/firewall"
@@ -42,6 +44,23 @@ func (m *MemoryFirewallManager) CreateSecurityGroup(ctx context.Context, spec fi
 	return id, nil
 }
 
+func (m *MemoryFirewallManager) GetSecurityGroup(ctx context.Context, groupID string) (*firewall.SecurityGroup, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	group, ok := m.groups[groupID]
+	if !ok {
+		return nil, firewall.ErrSecurityGroupNotFound
+	}
+
+	// Return a copy so callers can read it while rules change.
+	cp := *group
+	cp.Inbound = slices.Clone(group.Inbound)
+	cp.Outbound = slices.Clone(group.Outbound)
+	cp.Tags = maps.Clone(group.Tags)
+	return &cp, nil
+}
+
 func (m *MemoryFirewallManager) DeleteSecurityGroup(ctx context.Context, groupID string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -63,7 +82,11 @@ func (m *MemoryFirewallManager) AddRule(ctx context.Context, groupID string, rul
 		return firewall.ErrSecurityGroupNotFound
 	}
 
-	if rule.Direction == "inbound" {
+	if rule.ID == "" {
+		rule.ID = uuid.NewString()
+	}
+
+	if rule.Direction == firewall.DirectionInbound {
 		group.Inbound = append(group.Inbound, rule)
 	} else {
 		group.Outbound = append(group.Outbound, rule)
@@ -1,4 +1,5 @@
 // Package firewall provides distributed firewall and security group management.
 //
-// It allows defining ingress/egress rules for isolating workloads.
+// It allows defining ingress/egress rules for isolating workloads. The
+// engine subpackage evaluates flows against security groups.
 package firewall
@@ -0,0 +1,113 @@
+package engine
+
+import (
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/firewall"
+)
+
+// connKey identifies a connection of an endpoint. It is the same for both
+// directions of the connection, so a tracked flow admits its return
+// traffic.
+type connKey struct {
+	endpoint string
+	protocol string
+	local    netip.AddrPort
+	remote   netip.AddrPort
+}
+
+func newConnKey(endpointID string, flow Flow) connKey {
+	src := netip.AddrPortFrom(flow.SrcIP, uint16(flow.SrcPort))
+	dst := netip.AddrPortFrom(flow.DstIP, uint16(flow.DstPort))
+	if flow.Direction == firewall.DirectionInbound {
+		return connKey{endpoint: endpointID, protocol: flow.Protocol, local: dst, remote: src}
+	}
+	return connKey{endpoint: endpointID, protocol: flow.Protocol, local: src, remote: dst}
+}
+
+// conntrack is the table of tracked connections. Entries expire after
+// being idle for the protocol's timeout.
+type conntrack struct {
+	cfg Config
+
+	mu      sync.Mutex
+	entries map[connKey]time.Time // expiry
+}
+
+func newConntrack(cfg Config) *conntrack {
+	return &conntrack{cfg: cfg, entries: make(map[connKey]time.Time)}
+}
+
+func (c *conntrack) timeout(protocol string) time.Duration {
+	if protocol == firewall.ProtocolTCP {
+		return c.cfg.TCPTimeout
+	}
+	return c.cfg.UDPTimeout
+}
+
+// lookup reports whether the connection is tracked, extending its expiry
+// if it is.
+func (c *conntrack) lookup(key connKey) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	expiry, ok := c.entries[key]
+	if !ok {
+		return false
+	}
+	if now.After(expiry) {
+		delete(c.entries, key)
+		return false
+	}
+	c.entries[key] = now.Add(c.timeout(key.protocol))
+	return true
+}
+
+// peek reports whether the connection is tracked without touching it.
+func (c *conntrack) peek(key connKey) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiry, ok := c.entries[key]
+	return ok && !time.Now().After(expiry)
+}
+
+// track adds a connection. When the table is full, expired entries are
+// swept; if it is still full the connection is not tracked.
+func (c *conntrack) track(key connKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.cfg.MaxConnections {
+		for k, expiry := range c.entries {
+			if now.After(expiry) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= c.cfg.MaxConnections {
+			return
+		}
+	}
+	c.entries[key] = now.Add(c.timeout(key.protocol))
+}
+
+func (c *conntrack) forget(key connKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// flush forgets all the connections of an endpoint.
+func (c *conntrack) flush(endpointID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k := range c.entries {
+		if k.endpoint == endpointID {
+			delete(c.entries, k)
+		}
+	}
+}
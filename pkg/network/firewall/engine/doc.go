@@ -0,0 +1,24 @@
+// Package engine evaluates firewall security groups against network
+// flows.
+//
+// An Engine wraps a firewall.FirewallManager. Endpoints are attached to
+// security groups, and Evaluate decides whether a flow to or from an
+// endpoint is allowed by any rule of its groups. Anything no rule allows
+// is denied. Connections are tracked, so the return traffic of an allowed
+// flow is allowed whatever the rules in the other direction say. CIDR
+// rules are indexed in a radix tree, so the cost of a lookup depends on
+// the prefix length rather than on the number of rules.
+//
+// Explain reports every rule that allows a flow without tracking it, for
+// debugging rule sets. Listener enforces an endpoint's inbound rules on
+// the connections a net.Listener accepts.
+//
+// Usage:
+//
+//	e := engine.New(engine.Config{}, memory.New())
+//	groupID, _ := e.CreateSecurityGroup(ctx, firewall.SecurityGroupSpec{Name: "web"})
+//	_ = e.AddRule(ctx, groupID, firewall.Rule{Direction: firewall.DirectionInbound, Protocol: firewall.ProtocolTCP, PortStart: 443, CIDR: "0.0.0.0/0"})
+//	_ = e.Attach(ctx, engine.Endpoint{ID: "web-1", Addrs: addrs, GroupIDs: []string{groupID}})
+//	ln, _ := net.Listen("tcp", ":443")
+//	ln = e.Listener(ln, "web-1")
+package engine
@@ -0,0 +1,400 @@
+package engine
+
+import (
+	"context"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/firewall"
+)
+
+// ErrEndpointNotFound is returned when a flow is evaluated for an endpoint
+// that is not attached.
+var ErrEndpointNotFound = errors.NotFound("endpoint not found", nil)
+
+// Config holds configuration for the engine.
+type Config struct {
+	// TCPTimeout is how long an idle TCP connection stays tracked.
+	TCPTimeout time.Duration `env:"FIREWALL_CONNTRACK_TCP_TIMEOUT" env-default:"5m"`
+
+	// UDPTimeout is how long an idle UDP or ICMP flow stays tracked.
+	UDPTimeout time.Duration `env:"FIREWALL_CONNTRACK_UDP_TIMEOUT" env-default:"30s"`
+
+	// MaxConnections bounds the connection tracking table. New flows are
+	// still evaluated when it is full, but their return traffic is only
+	// allowed if the rules allow it.
+	MaxConnections int `env:"FIREWALL_CONNTRACK_MAX" env-default:"65536"`
+}
+
+// Endpoint is a network interface that security groups are attached to.
+type Endpoint struct {
+	ID       string
+	Addrs    []netip.Addr
+	GroupIDs []string
+}
+
+// Flow is traffic seen from an endpoint. Inbound flows are addressed to
+// the endpoint, outbound flows come from it.
+type Flow struct {
+	Direction string // firewall.DirectionInbound or firewall.DirectionOutbound
+	Protocol  string // firewall.ProtocolTCP, ProtocolUDP or ProtocolICMP
+	SrcIP     netip.Addr
+	SrcPort   int
+	DstIP     netip.Addr
+	DstPort   int
+}
+
+// Reasons for a decision.
+const (
+	// ReasonRule means a rule of an attached group allows the flow.
+	ReasonRule = "rule"
+	// ReasonEstablished means the flow belongs to a tracked connection.
+	ReasonEstablished = "established"
+	// ReasonNoMatch means no rule allows the flow.
+	ReasonNoMatch = "no-match"
+)
+
+// Decision is the verdict for a flow.
+type Decision struct {
+	Allowed bool
+	Reason  string
+
+	// GroupID and Rule identify the allowing rule when Reason is
+	// ReasonRule.
+	GroupID string
+	Rule    *firewall.Rule
+}
+
+// Match is a rule that allows a flow.
+type Match struct {
+	GroupID string
+	Rule    firewall.Rule
+}
+
+// Explanation details how a flow was evaluated.
+type Explanation struct {
+	Decision
+
+	// Tracked reports whether the flow belongs to a tracked connection.
+	Tracked bool
+
+	// Groups are the groups evaluated, in attachment order.
+	Groups []string
+
+	// Matches are all the rules that allow the flow, in group attachment
+	// order and rule order.
+	Matches []Match
+}
+
+// Engine evaluates flows against the security groups of a
+// firewall.FirewallManager. It implements FirewallManager itself, and
+// rule changes made through it apply to the next evaluation; changes made
+// to the underlying manager directly apply after Reload.
+type Engine struct {
+	next firewall.FirewallManager
+	ct   *conntrack
+
+	mu        sync.RWMutex
+	groups    map[string]*compiledGroup
+	endpoints map[string]*Endpoint
+	addrs     map[netip.Addr][]*Endpoint
+}
+
+// New creates an engine evaluating the security groups of next.
+func New(cfg Config, next firewall.FirewallManager) *Engine {
+	if cfg.TCPTimeout <= 0 {
+		cfg.TCPTimeout = 5 * time.Minute
+	}
+	if cfg.UDPTimeout <= 0 {
+		cfg.UDPTimeout = 30 * time.Second
+	}
+	if cfg.MaxConnections <= 0 {
+		cfg.MaxConnections = 65536
+	}
+
+	return &Engine{
+		next:      next,
+		ct:        newConntrack(cfg),
+		groups:    make(map[string]*compiledGroup),
+		endpoints: make(map[string]*Endpoint),
+		addrs:     make(map[netip.Addr][]*Endpoint),
+	}
+}
+
+func (e *Engine) CreateSecurityGroup(ctx context.Context, spec firewall.SecurityGroupSpec) (string, error) {
+	return e.next.CreateSecurityGroup(ctx, spec)
+}
+
+func (e *Engine) GetSecurityGroup(ctx context.Context, groupID string) (*firewall.SecurityGroup, error) {
+	return e.next.GetSecurityGroup(ctx, groupID)
+}
+
+// DeleteSecurityGroup removes a security group. Endpoints it was attached
+// to lose its rules.
+func (e *Engine) DeleteSecurityGroup(ctx context.Context, groupID string) error {
+	if err := e.next.DeleteSecurityGroup(ctx, groupID); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	delete(e.groups, groupID)
+	e.mu.Unlock()
+	return nil
+}
+
+// AddRule validates and adds a rule to a security group.
+func (e *Engine) AddRule(ctx context.Context, groupID string, rule firewall.Rule) error {
+	if _, err := compileRule(rule, 0); err != nil {
+		return err
+	}
+	if err := e.next.AddRule(ctx, groupID, rule); err != nil {
+		return err
+	}
+	return e.refresh(ctx, groupID)
+}
+
+func (e *Engine) RemoveRule(ctx context.Context, groupID string, ruleID string) error {
+	if err := e.next.RemoveRule(ctx, groupID, ruleID); err != nil {
+		return err
+	}
+	return e.refresh(ctx, groupID)
+}
+
+// Attach attaches an endpoint to its security groups, replacing any
+// endpoint with the same ID. All the groups must exist.
+func (e *Engine) Attach(ctx context.Context, ep Endpoint) error {
+	if ep.ID == "" {
+		return errors.InvalidArgument("endpoint id is required", nil)
+	}
+
+	compiled := make(map[string]*compiledGroup, len(ep.GroupIDs))
+	for _, id := range ep.GroupIDs {
+		g, err := e.load(ctx, id)
+		if err != nil {
+			return err
+		}
+		compiled[id] = g
+	}
+
+	ep.Addrs = slices.Clone(ep.Addrs)
+	ep.GroupIDs = slices.Clone(ep.GroupIDs)
+	for i, addr := range ep.Addrs {
+		ep.Addrs[i] = addr.Unmap()
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for id, g := range compiled {
+		e.groups[id] = g
+	}
+	if old, ok := e.endpoints[ep.ID]; ok {
+		e.unindex(old)
+	}
+	e.endpoints[ep.ID] = &ep
+	for _, addr := range ep.Addrs {
+		e.addrs[addr] = append(e.addrs[addr], &ep)
+	}
+	return nil
+}
+
+// Detach removes an endpoint and forgets its tracked connections.
+func (e *Engine) Detach(endpointID string) {
+	e.mu.Lock()
+	if ep, ok := e.endpoints[endpointID]; ok {
+		e.unindex(ep)
+		delete(e.endpoints, endpointID)
+	}
+	e.mu.Unlock()
+
+	e.ct.flush(endpointID)
+}
+
+func (e *Engine) unindex(ep *Endpoint) {
+	for _, addr := range ep.Addrs {
+		eps := slices.DeleteFunc(e.addrs[addr], func(other *Endpoint) bool { return other == ep })
+		if len(eps) == 0 {
+			delete(e.addrs, addr)
+		} else {
+			e.addrs[addr] = eps
+		}
+	}
+}
+
+// Reload re-reads the attached security groups from the underlying
+// manager. Groups that no longer exist stop allowing anything.
+func (e *Engine) Reload(ctx context.Context) error {
+	e.mu.RLock()
+	ids := make(map[string]struct{})
+	for _, ep := range e.endpoints {
+		for _, id := range ep.GroupIDs {
+			ids[id] = struct{}{}
+		}
+	}
+	e.mu.RUnlock()
+
+	groups := make(map[string]*compiledGroup, len(ids))
+	for id := range ids {
+		g, err := e.load(ctx, id)
+		if errors.Is(err, firewall.ErrSecurityGroupNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		groups[id] = g
+	}
+
+	e.mu.Lock()
+	e.groups = groups
+	e.mu.Unlock()
+	return nil
+}
+
+// refresh recompiles a group that endpoints are attached to.
+func (e *Engine) refresh(ctx context.Context, groupID string) error {
+	e.mu.RLock()
+	_, attached := e.groups[groupID]
+	e.mu.RUnlock()
+	if !attached {
+		return nil
+	}
+
+	g, err := e.load(ctx, groupID)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.groups[groupID] = g
+	e.mu.Unlock()
+	return nil
+}
+
+func (e *Engine) load(ctx context.Context, groupID string) (*compiledGroup, error) {
+	group, err := e.next.GetSecurityGroup(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	g, skipped := compileGroup(group)
+	for _, s := range skipped {
+		logger.L().WarnContext(ctx, "skipping invalid firewall rule", "group_id", groupID, "rule_id", s.rule.ID, "error", s.err)
+	}
+	return g, nil
+}
+
+// Evaluate decides whether the endpoint's security groups allow a flow.
+// Allowed flows are tracked, so their return traffic is allowed too.
+func (e *Engine) Evaluate(ctx context.Context, endpointID string, flow Flow) (Decision, error) {
+	flow, err := normalize(flow)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	key := newConnKey(endpointID, flow)
+	if e.ct.lookup(key) {
+		return Decision{Allowed: true, Reason: ReasonEstablished}, nil
+	}
+
+	x, err := e.evaluate(endpointID, flow, false)
+	if err != nil {
+		return Decision{}, err
+	}
+	if x.Allowed {
+		e.ct.track(key)
+	}
+	return x.Decision, nil
+}
+
+// Explain evaluates a flow like Evaluate, reporting every rule that allows
+// it. The flow is not tracked.
+func (e *Engine) Explain(ctx context.Context, endpointID string, flow Flow) (*Explanation, error) {
+	flow, err := normalize(flow)
+	if err != nil {
+		return nil, err
+	}
+
+	x, err := e.evaluate(endpointID, flow, true)
+	if err != nil {
+		return nil, err
+	}
+	if e.ct.peek(newConnKey(endpointID, flow)) {
+		x.Tracked = true
+		x.Decision = Decision{Allowed: true, Reason: ReasonEstablished}
+	}
+	return x, nil
+}
+
+// evaluate matches a flow against the endpoint's groups, stopping at the
+// first allowing rule unless all is set.
+func (e *Engine) evaluate(endpointID string, flow Flow, all bool) (*Explanation, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	ep, ok := e.endpoints[endpointID]
+	if !ok {
+		return nil, ErrEndpointNotFound
+	}
+
+	peer := flow.SrcIP
+	if flow.Direction == firewall.DirectionOutbound {
+		peer = flow.DstIP
+	}
+
+	x := &Explanation{Decision: Decision{Reason: ReasonNoMatch}}
+	for _, id := range ep.GroupIDs {
+		x.Groups = append(x.Groups, id)
+		g := e.groups[id]
+		if g == nil {
+			continue
+		}
+		rules := g.inbound
+		if flow.Direction == firewall.DirectionOutbound {
+			rules = g.outbound
+		}
+		for _, r := range rules.match(flow, peer, e.peerInGroup) {
+			x.Matches = append(x.Matches, Match{GroupID: id, Rule: r.rule})
+			if !x.Allowed {
+				rule := r.rule
+				x.Decision = Decision{Allowed: true, Reason: ReasonRule, GroupID: id, Rule: &rule}
+			}
+			if !all {
+				return x, nil
+			}
+		}
+	}
+	return x, nil
+}
+
+// peerInGroup reports whether addr belongs to an endpoint attached to the
+// group. The caller holds e.mu.
+func (e *Engine) peerInGroup(addr netip.Addr, groupID string) bool {
+	for _, ep := range e.addrs[addr] {
+		if slices.Contains(ep.GroupIDs, groupID) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalize(flow Flow) (Flow, error) {
+	flow.Direction = strings.ToLower(flow.Direction)
+	if flow.Direction != firewall.DirectionInbound && flow.Direction != firewall.DirectionOutbound {
+		return flow, errors.InvalidArgument("flow direction must be inbound or outbound", nil)
+	}
+	flow.Protocol = strings.ToLower(flow.Protocol)
+	if flow.Protocol == "" || flow.Protocol == firewall.ProtocolAny {
+		return flow, errors.InvalidArgument("flow protocol is required", nil)
+	}
+	if !flow.SrcIP.IsValid() || !flow.DstIP.IsValid() {
+		return flow, errors.InvalidArgument("flow addresses are required", nil)
+	}
+	flow.SrcIP, flow.DstIP = flow.SrcIP.Unmap(), flow.DstIP.Unmap()
+	if flow.Protocol == firewall.ProtocolICMP {
+		flow.SrcPort, flow.DstPort = 0, 0
+	}
+	return flow, nil
+}
@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/firewall"
+)
+
+// Listener wraps ln so that Accept only returns connections the inbound
+// rules of the endpoint allow; others are closed as soon as they are
+// accepted. Connections that cannot be evaluated, such as those on
+// non-IP networks or for an endpoint that is not attached, are closed
+// too. Accepted connections stay tracked until they are closed.
+func (e *Engine) Listener(ln net.Listener, endpointID string) net.Listener {
+	return &listener{Listener: ln, engine: e, endpointID: endpointID}
+}
+
+type listener struct {
+	net.Listener
+	engine     *Engine
+	endpointID string
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		ctx := context.Background()
+		flow, ok := connFlow(conn)
+		if !ok {
+			logger.L().WarnContext(ctx, "firewall dropped connection without ip addresses", "endpoint", l.endpointID, "remote", conn.RemoteAddr().String())
+			_ = conn.Close()
+			continue
+		}
+
+		decision, err := l.engine.Evaluate(ctx, l.endpointID, flow)
+		if err != nil {
+			logger.L().WarnContext(ctx, "firewall failed to evaluate connection", "endpoint", l.endpointID, "remote", conn.RemoteAddr().String(), "error", err)
+			_ = conn.Close()
+			continue
+		}
+		if !decision.Allowed {
+			logger.L().DebugContext(ctx, "firewall dropped connection", "endpoint", l.endpointID, "remote", conn.RemoteAddr().String(), "port", flow.DstPort)
+			_ = conn.Close()
+			continue
+		}
+
+		return &trackedConn{Conn: conn, ct: l.engine.ct, key: newConnKey(l.endpointID, flow)}, nil
+	}
+}
+
+// trackedConn forgets its connection tracking entry when closed.
+type trackedConn struct {
+	net.Conn
+	ct   *conntrack
+	key  connKey
+	once sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(func() { c.ct.forget(c.key) })
+	return c.Conn.Close()
+}
+
+// connFlow describes an accepted connection as an inbound flow.
+func connFlow(conn net.Conn) (Flow, bool) {
+	remote, ok := addrPort(conn.RemoteAddr())
+	if !ok {
+		return Flow{}, false
+	}
+	local, ok := addrPort(conn.LocalAddr())
+	if !ok {
+		return Flow{}, false
+	}
+
+	protocol := firewall.ProtocolTCP
+	if strings.HasPrefix(conn.LocalAddr().Network(), "udp") {
+		protocol = firewall.ProtocolUDP
+	}
+	return Flow{
+		Direction: firewall.DirectionInbound,
+		Protocol:  protocol,
+		SrcIP:     remote.Addr(),
+		SrcPort:   int(remote.Port()),
+		DstIP:     local.Addr(),
+		DstPort:   int(local.Port()),
+	}, true
+}
+
+func addrPort(addr net.Addr) (netip.AddrPort, bool) {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.AddrPort(), true
+	case *net.UDPAddr:
+		return a.AddrPort(), true
+	}
+	ap, err := netip.ParseAddrPort(addr.String())
+	return ap, err == nil
+}
@@ -0,0 +1,186 @@
+package engine
+
+import (
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/datastructures/tree/radix"
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/firewall"
+)
+
+// compiledGroup is a security group indexed for evaluation.
+type compiledGroup struct {
+	inbound  *ruleSet
+	outbound *ruleSet
+}
+
+// ruleSet holds the rules of one direction. CIDR rules are stored in a
+// radix tree keyed by the bits of their prefix, so the rules covering an
+// address are found by walking the prefixes of its own key.
+type ruleSet struct {
+	cidrs   *radix.RadixTree[[]*compiledRule]
+	sources []*compiledRule // rules referencing a source group
+}
+
+type compiledRule struct {
+	rule     firewall.Rule
+	index    int // position in the group, for reporting matches in order
+	protocol string
+	lo, hi   int
+	prefixes []netip.Prefix
+}
+
+type skippedRule struct {
+	rule firewall.Rule
+	err  error
+}
+
+// anyPrefixes cover every address of both families.
+var anyPrefixes = []netip.Prefix{
+	netip.PrefixFrom(netip.IPv4Unspecified(), 0),
+	netip.PrefixFrom(netip.IPv6Unspecified(), 0),
+}
+
+// compileGroup indexes a group's rules, returning the ones it could not
+// compile.
+func compileGroup(group *firewall.SecurityGroup) (*compiledGroup, []skippedRule) {
+	var skipped []skippedRule
+	build := func(rules []firewall.Rule) *ruleSet {
+		set := &ruleSet{cidrs: radix.New[[]*compiledRule]()}
+		byKey := make(map[string][]*compiledRule)
+		for i, rule := range rules {
+			r, err := compileRule(rule, i)
+			if err != nil {
+				skipped = append(skipped, skippedRule{rule: rule, err: err})
+				continue
+			}
+			if rule.SourceGroup != "" {
+				set.sources = append(set.sources, r)
+				continue
+			}
+			for _, p := range r.prefixes {
+				key := prefixKey(p)
+				byKey[key] = append(byKey[key], r)
+			}
+		}
+		for key, rs := range byKey {
+			set.cidrs.Insert(key, rs)
+		}
+		return set
+	}
+
+	return &compiledGroup{
+		inbound:  build(group.Inbound),
+		outbound: build(group.Outbound),
+	}, skipped
+}
+
+// compileRule validates a rule and normalizes it for matching.
+func compileRule(rule firewall.Rule, index int) (*compiledRule, error) {
+	if d := strings.ToLower(rule.Direction); d != firewall.DirectionInbound && d != firewall.DirectionOutbound {
+		return nil, errors.InvalidArgument("rule direction must be inbound or outbound", nil)
+	}
+
+	r := &compiledRule{rule: rule, index: index, protocol: strings.ToLower(rule.Protocol)}
+	switch r.protocol {
+	case "", "-1", "all":
+		r.protocol = firewall.ProtocolAny
+	case firewall.ProtocolAny, firewall.ProtocolTCP, firewall.ProtocolUDP, firewall.ProtocolICMP:
+	default:
+		return nil, errors.InvalidArgument("unsupported rule protocol "+rule.Protocol, nil)
+	}
+
+	r.lo, r.hi = rule.PortStart, rule.PortEnd
+	if r.hi == 0 {
+		r.hi = r.lo
+	}
+	if r.lo == 0 && r.hi == 0 {
+		r.hi = 65535
+	}
+	if r.lo < 0 || r.hi > 65535 || r.lo > r.hi {
+		return nil, errors.InvalidArgument("invalid rule port range", nil)
+	}
+
+	switch {
+	case rule.CIDR != "" && rule.SourceGroup != "":
+		return nil, errors.InvalidArgument("rule cannot have both a cidr and a source group", nil)
+	case rule.CIDR != "":
+		p, err := netip.ParsePrefix(rule.CIDR)
+		if err != nil {
+			return nil, errors.InvalidArgument("invalid rule cidr "+rule.CIDR, err)
+		}
+		if p.Addr().Is4In6() && p.Bits() >= 96 {
+			p = netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
+		}
+		r.prefixes = []netip.Prefix{p.Masked()}
+	case rule.SourceGroup == "":
+		r.prefixes = anyPrefixes
+	}
+	return r, nil
+}
+
+// match returns the rules allowing a flow with the given peer address, in
+// rule order.
+func (s *ruleSet) match(flow Flow, peer netip.Addr, inGroup func(netip.Addr, string) bool) []*compiledRule {
+	var matched []*compiledRule
+	s.cidrs.WalkPrefixes(addrKey(peer), func(_ string, rules []*compiledRule) bool {
+		for _, r := range rules {
+			if r.allows(flow) {
+				matched = append(matched, r)
+			}
+		}
+		return true
+	})
+	for _, r := range s.sources {
+		if r.allows(flow) && inGroup(peer, r.rule.SourceGroup) {
+			matched = append(matched, r)
+		}
+	}
+
+	slices.SortFunc(matched, func(a, b *compiledRule) int { return a.index - b.index })
+	return matched
+}
+
+// allows checks the protocol and destination port of a flow. For inbound
+// flows that is the endpoint's port, for outbound flows the peer's.
+func (r *compiledRule) allows(flow Flow) bool {
+	if r.protocol != firewall.ProtocolAny && r.protocol != flow.Protocol {
+		return false
+	}
+	if flow.Protocol == firewall.ProtocolICMP {
+		return true
+	}
+	return flow.DstPort >= r.lo && flow.DstPort <= r.hi
+}
+
+// prefixKey encodes a prefix as its address family followed by its
+// significant bits, one character per bit.
+func prefixKey(p netip.Prefix) string {
+	return bitString(p.Addr(), p.Bits())
+}
+
+// addrKey encodes an address like a prefix of full length.
+func addrKey(addr netip.Addr) string {
+	return bitString(addr, addr.BitLen())
+}
+
+func bitString(addr netip.Addr, bits int) string {
+	var b strings.Builder
+	b.Grow(bits + 1)
+	if addr.Is4() {
+		b.WriteByte('4')
+	} else {
+		b.WriteByte('6')
+	}
+	raw := addr.AsSlice()
+	for i := range bits {
+		if raw[i/8]&(0x80>>(i%8)) != 0 {
+			b.WriteByte('1')
+		} else {
+			b.WriteByte('0')
+		}
+	}
+	return b.String()
+}
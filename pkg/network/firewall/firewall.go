@@ -9,6 +9,9 @@ type FirewallManager interface {
 	// CreateSecurityGroup creates a new group of firewall rules.
 	CreateSecurityGroup(ctx context.Context, spec SecurityGroupSpec) (string, error)
 
+	// GetSecurityGroup returns a security group with its rules.
+	GetSecurityGroup(ctx context.Context, groupID string) (*SecurityGroup, error)
+
 	// DeleteSecurityGroup removes a security group.
 	DeleteSecurityGroup(ctx context.Context, groupID string) error
 
@@ -19,6 +22,20 @@ type FirewallManager interface {
 	RemoveRule(ctx context.Context, groupID string, ruleID string) error
 }
 
+// Rule directions.
+const (
+	DirectionInbound  = "inbound"
+	DirectionOutbound = "outbound"
+)
+
+// Rule protocols.
+const (
+	ProtocolTCP  = "tcp"
+	ProtocolUDP  = "udp"
+	ProtocolICMP = "icmp"
+	ProtocolAny  = "any"
+)
+
 // SecurityGroupSpec defines a new security group.
 type SecurityGroupSpec struct {
 	Name        string            `json:"name"`
@@ -37,7 +54,10 @@ type SecurityGroup struct {
 	Tags     map[string]string `json:"tags,omitempty"`
 }
 
-// Rule defines a single firewall permission.
+// Rule defines a single firewall permission. Rules only allow traffic;
+// anything no rule allows is denied. A port range of 0-0 covers all ports
+// and a PortEnd of 0 means PortStart alone. A rule with neither CIDR nor
+// SourceGroup matches any peer.
 type Rule struct {
 	ID          string `json:"id"`
 	Direction   string `json:"direction"` // "inbound" or "outbound"
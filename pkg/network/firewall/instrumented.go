@@ -4,7 +4,7 @@ import (
 	"context"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
-	"go.opentelemetry.io/otel"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
@@ -20,7 +20,7 @@ type InstrumentedFirewallManager struct {
 func NewInstrumentedFirewallManager(next FirewallManager) *InstrumentedFirewallManager {
 	return &InstrumentedFirewallManager{
 		next:   next,
-		tracer: otel.Tracer("pkg/network/firewall"),
+		tracer: instrument.NewTracer("pkg/network/firewall"),
 	}
 }
 
@@ -46,6 +46,22 @@ func (f *InstrumentedFirewallManager) CreateSecurityGroup(ctx context.Context, s
 	return id, nil
 }
 
+func (f *InstrumentedFirewallManager) GetSecurityGroup(ctx context.Context, groupID string) (*SecurityGroup, error) {
+	ctx, span := f.tracer.Start(ctx, "firewall.GetSecurityGroup", trace.WithAttributes(
+		attribute.String("group.id", groupID),
+	))
+	defer span.End()
+
+	group, err := f.next.GetSecurityGroup(ctx, groupID)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return group, nil
+}
+
 func (f *InstrumentedFirewallManager) DeleteSecurityGroup(ctx context.Context, groupID string) error {
 	ctx, span := f.tracer.Start(ctx, "firewall.DeleteSecurityGroup", trace.WithAttributes(
 		attribute.String("group.id", groupID),
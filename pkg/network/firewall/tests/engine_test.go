@@ -0,0 +1,219 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/firewall"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/firewall/adapters/memory"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/firewall/engine"
+	"github.com/stretchr/testify/suite"
+)
+
+// EngineSuite tests the security group evaluation engine.
+type EngineSuite struct {
+	suite.Suite
+	manager *memory.MemoryFirewallManager
+	e       *engine.Engine
+	ctx     context.Context
+}
+
+// SetupTest creates an engine with the default configuration.
+func (s *EngineSuite) SetupTest() {
+	s.ctx = context.Background()
+	s.manager = memory.New()
+	s.e = engine.New(engine.Config{}, s.manager)
+}
+
+func (s *EngineSuite) group(name string, rules ...firewall.Rule) string {
+	id, err := s.e.CreateSecurityGroup(s.ctx, firewall.SecurityGroupSpec{Name: name})
+	s.Require().NoError(err)
+	for _, r := range rules {
+		s.Require().NoError(s.e.AddRule(s.ctx, id, r))
+	}
+	return id
+}
+
+func (s *EngineSuite) attach(id, addr string, groups ...string) {
+	ep := engine.Endpoint{ID: id, Addrs: []netip.Addr{netip.MustParseAddr(addr)}, GroupIDs: groups}
+	s.Require().NoError(s.e.Attach(s.ctx, ep))
+}
+
+func (s *EngineSuite) evaluate(endpointID string, flow engine.Flow) engine.Decision {
+	d, err := s.e.Evaluate(s.ctx, endpointID, flow)
+	s.Require().NoError(err)
+	return d
+}
+
+func inbound(protocol, src string, srcPort int, dst string, dstPort int) engine.Flow {
+	return engine.Flow{
+		Direction: firewall.DirectionInbound,
+		Protocol:  protocol,
+		SrcIP:     netip.MustParseAddr(src),
+		SrcPort:   srcPort,
+		DstIP:     netip.MustParseAddr(dst),
+		DstPort:   dstPort,
+	}
+}
+
+func outbound(protocol, src string, srcPort int, dst string, dstPort int) engine.Flow {
+	flow := inbound(protocol, src, srcPort, dst, dstPort)
+	flow.Direction = firewall.DirectionOutbound
+	return flow
+}
+
+func (s *EngineSuite) TestMatchesRules() {
+	web := s.group("web",
+		firewall.Rule{Direction: firewall.DirectionInbound, Protocol: firewall.ProtocolTCP, PortStart: 443, CIDR: "0.0.0.0/0"},
+		firewall.Rule{Direction: firewall.DirectionInbound, Protocol: firewall.ProtocolTCP, PortStart: 8000, PortEnd: 8080, CIDR: "10.0.0.0/8"},
+		firewall.Rule{Direction: firewall.DirectionInbound, Protocol: firewall.ProtocolICMP, CIDR: "2001:db8::/32"},
+	)
+	ssh := s.group("ssh", firewall.Rule{Direction: firewall.DirectionInbound, Protocol: firewall.ProtocolTCP, PortStart: 22, CIDR: "192.168.1.0/24"})
+	s.attach("web-1", "10.1.0.5", web, ssh)
+
+	tests := []struct {
+		name string
+		flow engine.Flow
+		want bool
+	}{
+		{"https from anywhere", inbound("tcp", "203.0.113.9", 50000, "10.1.0.5", 443), true},
+		{"udp on the https port", inbound("udp", "203.0.113.9", 50000, "10.1.0.5", 443), false},
+		{"port range from the vpc", inbound("tcp", "10.200.3.4", 50000, "10.1.0.5", 8080), true},
+		{"port range from outside", inbound("tcp", "11.0.0.1", 50000, "10.1.0.5", 8080), false},
+		{"above the port range", inbound("tcp", "10.200.3.4", 50000, "10.1.0.5", 8081), false},
+		{"ssh from the office", inbound("tcp", "192.168.1.77", 50000, "10.1.0.5", 22), true},
+		{"ssh from elsewhere", inbound("tcp", "192.168.2.77", 50000, "10.1.0.5", 22), false},
+		{"icmpv6 from the prefix", inbound("icmp", "2001:db8::1", 0, "10.1.0.5", 0), true},
+		{"no outbound rules", outbound("tcp", "10.1.0.5", 50000, "203.0.113.9", 443), false},
+	}
+	for _, tt := range tests {
+		s.Equal(tt.want, s.evaluate("web-1", tt.flow).Allowed, tt.name)
+	}
+
+	d := s.evaluate("web-1", inbound("tcp", "192.168.1.77", 50001, "10.1.0.5", 22))
+	s.Equal(engine.ReasonRule, d.Reason)
+	s.Equal(ssh, d.GroupID)
+	s.Require().NotNil(d.Rule)
+	s.Equal(22, d.Rule.PortStart)
+
+	_, err := s.e.Evaluate(s.ctx, "missing", inbound("tcp", "10.0.0.1", 1, "10.1.0.5", 443))
+	s.True(errors.Is(err, engine.ErrEndpointNotFound), "unknown endpoint error = %v", err)
+	s.Error(s.e.AddRule(s.ctx, web, firewall.Rule{Direction: firewall.DirectionInbound, CIDR: "10.0.0.0/33"}), "invalid cidr")
+}
+
+func (s *EngineSuite) TestTracksConnections() {
+	s.e = engine.New(engine.Config{UDPTimeout: 50 * time.Millisecond}, s.manager)
+	db := s.group("db", firewall.Rule{Direction: firewall.DirectionInbound, Protocol: firewall.ProtocolAny, PortStart: 5432, CIDR: "10.0.0.0/16"})
+	s.attach("db-1", "10.0.9.9", db)
+
+	// Return traffic of an allowed inbound connection is allowed although
+	// the group has no outbound rules.
+	reply := outbound("tcp", "10.0.9.9", 5432, "10.0.1.1", 41000)
+	s.Require().False(s.evaluate("db-1", reply).Allowed, "reply before the connection")
+	s.Require().True(s.evaluate("db-1", inbound("tcp", "10.0.1.1", 41000, "10.0.9.9", 5432)).Allowed, "connection")
+	d := s.evaluate("db-1", reply)
+	s.True(d.Allowed, "reply")
+	s.Equal(engine.ReasonEstablished, d.Reason)
+	s.False(s.evaluate("db-1", outbound("tcp", "10.0.9.9", 5432, "10.0.1.1", 41001)).Allowed, "reply to another port")
+
+	// Idle flows expire.
+	s.Require().True(s.evaluate("db-1", inbound("udp", "10.0.1.1", 41000, "10.0.9.9", 5432)).Allowed, "udp flow")
+	udpReply := outbound("udp", "10.0.9.9", 5432, "10.0.1.1", 41000)
+	s.Require().True(s.evaluate("db-1", udpReply).Allowed, "udp reply")
+	time.Sleep(100 * time.Millisecond)
+	s.False(s.evaluate("db-1", udpReply).Allowed, "udp reply after the timeout")
+
+	s.e.Detach("db-1")
+	s.attach("db-1", "10.0.9.9", db)
+	s.False(s.evaluate("db-1", reply).Allowed, "reply after detaching")
+}
+
+func (s *EngineSuite) TestSourceGroupsAndReload() {
+	app := s.group("app")
+	db := s.group("db", firewall.Rule{ID: "from-app", Direction: firewall.DirectionInbound, Protocol: firewall.ProtocolTCP, PortStart: 5432, SourceGroup: app})
+	s.attach("db-1", "10.0.9.9", db)
+	s.attach("app-1", "10.0.1.1", app)
+
+	fromApp := inbound("tcp", "10.0.1.1", 41000, "10.0.9.9", 5432)
+	x, err := s.e.Explain(s.ctx, "db-1", fromApp)
+	s.Require().NoError(err)
+	s.True(x.Allowed)
+	s.False(x.Tracked)
+	s.Require().Len(x.Matches, 1)
+	s.Equal("from-app", x.Matches[0].Rule.ID)
+
+	x, _ = s.e.Explain(s.ctx, "db-1", inbound("tcp", "10.0.2.2", 41000, "10.0.9.9", 5432))
+	s.False(x.Allowed, "stranger")
+	s.Equal(engine.ReasonNoMatch, x.Reason)
+
+	// Changes made to the manager directly apply after a reload, and
+	// removing a rule through the engine applies at once.
+	s.Require().NoError(s.manager.AddRule(s.ctx, db, firewall.Rule{ID: "all", Direction: firewall.DirectionInbound, CIDR: "10.0.0.0/8"}))
+	s.Require().NoError(s.e.Reload(s.ctx))
+	x, _ = s.e.Explain(s.ctx, "db-1", fromApp)
+	s.Len(x.Matches, 2, "matches after reload")
+
+	s.Require().NoError(s.e.RemoveRule(s.ctx, db, "from-app"))
+	x, _ = s.e.Explain(s.ctx, "db-1", fromApp)
+	s.Require().Len(x.Matches, 1, "matches after remove")
+	s.Equal("all", x.Rule.ID)
+}
+
+func (s *EngineSuite) TestLargeRuleSet() {
+	rules := make([]firewall.Rule, 0, 4096)
+	for i := range 4096 {
+		rules = append(rules, firewall.Rule{Direction: firewall.DirectionInbound, Protocol: firewall.ProtocolTCP, PortStart: 443, CIDR: fmt.Sprintf("10.%d.%d.0/24", i/256, i%256)})
+	}
+	big := s.group("big", rules...)
+	s.attach("web-1", "172.16.0.1", big)
+
+	d := s.evaluate("web-1", inbound("tcp", "10.15.255.7", 1000, "172.16.0.1", 443))
+	s.Require().True(d.Allowed)
+	s.Equal("10.15.255.0/24", d.Rule.CIDR)
+	s.False(s.evaluate("web-1", inbound("tcp", "10.16.0.7", 1000, "172.16.0.1", 443)).Allowed)
+}
+
+func (s *EngineSuite) TestListener() {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	s.Require().NoError(err)
+	port := ln.Addr().(*net.TCPAddr).Port
+	group := s.group("local", firewall.Rule{Direction: firewall.DirectionInbound, Protocol: firewall.ProtocolTCP, PortStart: port, CIDR: "127.0.0.0/8"})
+	s.attach("local", "127.0.0.1")
+
+	ln = s.e.Listener(ln, "local")
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = io.WriteString(conn, "hello")
+			_ = conn.Close()
+		}
+	}()
+
+	read := func() string {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		s.Require().NoError(err)
+		defer conn.Close()
+		_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+		b, _ := io.ReadAll(conn)
+		return string(b)
+	}
+
+	s.Empty(read(), "without the group attached the connection is closed")
+	s.attach("local", "127.0.0.1", group)
+	s.Equal("hello", read(), "with the group attached")
+}
+
+// TestEngineSuite runs the test suite.
+func TestEngineSuite(t *testing.T) {
+	suite.Run(t, new(EngineSuite))
+}
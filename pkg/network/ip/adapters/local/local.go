@@ -0,0 +1,396 @@
+// Package local provides an offline implementation of ip.IPIntelligence
+// backed by local MaxMind DB or CSV geolocation databases and threat feeds.
+package local
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/datastructures/tree/radix"
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/ip"
+)
+
+// Config holds configuration for the local IP intelligence service.
+type Config struct {
+	// CityDB is a MaxMind DB with geolocation, such as GeoLite2-City or
+	// GeoIP2-Country.
+	CityDB string `env:"IP_LOCAL_CITY_DB"`
+
+	// ASNDB is a MaxMind DB with network owners, such as GeoLite2-ASN or
+	// GeoIP2-ISP.
+	ASNDB string `env:"IP_LOCAL_ASN_DB"`
+
+	// GeoCSV is a CSV geolocation database used for addresses the MaxMind
+	// databases do not cover. Its header row names the columns: network
+	// (a CIDR or address), country, country_name, region, region_name,
+	// city, postal_code, latitude, longitude, timezone, asn, asn_org and
+	// isp. Only network is required.
+	GeoCSV string `env:"IP_LOCAL_GEO_CSV"`
+
+	// Language selects localized names from MaxMind databases; English is
+	// used for names missing in it.
+	Language string `env:"IP_LOCAL_LANGUAGE" env-default:"en"`
+
+	// Feeds are the threat feeds to load.
+	Feeds []Feed
+
+	// BlockThreshold is the ThreatLevel at which IsBlocked reports true.
+	BlockThreshold int `env:"IP_LOCAL_BLOCK_THRESHOLD" env-default:"75"`
+
+	// ReloadInterval is how often Watch checks the files for changes.
+	ReloadInterval time.Duration `env:"IP_LOCAL_RELOAD_INTERVAL" env-default:"1m"`
+}
+
+// Feed is a threat feed file: one address or CIDR per line, such as the
+// Spamhaus DROP lists. Text after the address, separated by whitespace,
+// ";" or ",", and lines starting with "#" or ";" are ignored.
+type Feed struct {
+	// Path is the feed file.
+	Path string
+
+	// Category is reported in ThreatInfo.Categories for listed addresses.
+	// The categories "vpn", "proxy", "tor", "bot" and "datacenter" also set
+	// the matching ThreatInfo flag.
+	Category string
+
+	// Level is the ThreatLevel (0-100) of listed addresses. Feeds with
+	// Level 0 are informational, such as VPN or datacenter ranges, and do
+	// not make an address a threat.
+	Level int
+}
+
+// fileStamp identifies a version of a file.
+type fileStamp struct {
+	mod  time.Time
+	size int64
+}
+
+// dataset is an immutable snapshot of the loaded databases.
+type dataset struct {
+	city    *mmdb
+	asn     *mmdb
+	csv     *radix.RadixTree[*ip.GeoLocation]
+	threats *radix.RadixTree[[]int] // prefix -> indexes into cfg.Feeds
+}
+
+// Service is an IP intelligence service answering from local files.
+type Service struct {
+	cfg  Config
+	data atomic.Pointer[dataset]
+
+	mu     sync.Mutex // serializes Reload
+	stamps map[string]fileStamp
+	feeds  [][]netip.Prefix // parsed feeds, by index into cfg.Feeds
+}
+
+var _ ip.IPIntelligence = (*Service)(nil)
+
+// New loads the configured files. It fails if any cannot be loaded.
+func New(cfg Config) (*Service, error) {
+	if cfg.Language == "" {
+		cfg.Language = "en"
+	}
+	if cfg.BlockThreshold <= 0 {
+		cfg.BlockThreshold = 75
+	}
+	if cfg.ReloadInterval <= 0 {
+		cfg.ReloadInterval = time.Minute
+	}
+	for _, f := range cfg.Feeds {
+		if f.Level < 0 || f.Level > 100 {
+			return nil, errors.InvalidArgument("threat feed level must be between 0 and 100", nil)
+		}
+	}
+
+	s := &Service{
+		cfg:    cfg,
+		stamps: make(map[string]fileStamp),
+		feeds:  make([][]netip.Prefix, len(cfg.Feeds)),
+	}
+	if err := s.Reload(context.Background()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload re-reads the files that changed since they were last loaded. If
+// any fails to load, the previous data stays in use.
+func (s *Service) Reload(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev := s.data.Load()
+	next := &dataset{}
+	if prev != nil {
+		*next = *prev
+	}
+	stamps := make(map[string]fileStamp)
+	changed := false
+
+	// load reports whether path changed since it was last loaded.
+	load := func(path string) (bool, error) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return false, errors.InvalidArgument("cannot read "+path, err)
+		}
+		stamp := fileStamp{mod: info.ModTime(), size: info.Size()}
+		stamps[path] = stamp
+		old, ok := s.stamps[path]
+		return prev == nil || !ok || old != stamp, nil
+	}
+
+	if path := s.cfg.CityDB; path != "" {
+		if ok, err := load(path); err != nil {
+			return err
+		} else if ok {
+			if next.city, err = loadMMDB(path); err != nil {
+				return err
+			}
+			changed = true
+		}
+	}
+	if path := s.cfg.ASNDB; path != "" {
+		if ok, err := load(path); err != nil {
+			return err
+		} else if ok {
+			if next.asn, err = loadMMDB(path); err != nil {
+				return err
+			}
+			changed = true
+		}
+	}
+	if path := s.cfg.GeoCSV; path != "" {
+		if ok, err := load(path); err != nil {
+			return err
+		} else if ok {
+			if next.csv, err = loadGeoCSV(path); err != nil {
+				return err
+			}
+			changed = true
+		}
+	}
+
+	feeds := slices.Clone(s.feeds)
+	feedsChanged := prev == nil
+	for i, f := range s.cfg.Feeds {
+		ok, err := load(f.Path)
+		if err != nil {
+			return err
+		}
+		if ok {
+			if feeds[i], err = loadFeed(f.Path); err != nil {
+				return err
+			}
+			feedsChanged = true
+		}
+	}
+	if feedsChanged {
+		next.threats = radix.New[[]int]()
+		for i, prefixes := range feeds {
+			for _, p := range prefixes {
+				key := prefixKey(p)
+				idx, _ := next.threats.Get(key)
+				if !slices.Contains(idx, i) {
+					next.threats.Insert(key, append(idx, i))
+				}
+			}
+		}
+		changed = true
+	}
+
+	s.stamps = stamps
+	s.feeds = feeds
+	if changed {
+		s.data.Store(next)
+		logger.L().InfoContext(ctx, "ip intelligence data loaded", "feeds", len(feeds))
+	}
+	return nil
+}
+
+// Watch reloads changed files every ReloadInterval until ctx is cancelled.
+// Failed reloads are logged and retried on the next tick.
+func (s *Service) Watch(ctx context.Context) error {
+	ticker := time.NewTicker(s.cfg.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := s.Reload(ctx); err != nil {
+				logger.L().ErrorContext(ctx, "failed to reload ip intelligence data", "error", err)
+			}
+		}
+	}
+}
+
+func (s *Service) Lookup(ctx context.Context, ipAddr string) (*ip.GeoLocation, error) {
+	addr, err := parseAddr(ipAddr)
+	if err != nil {
+		return nil, err
+	}
+	data := s.data.Load()
+
+	loc := &ip.GeoLocation{IP: net.IP(addr.AsSlice())}
+	for _, db := range []*mmdb{data.city, data.asn} {
+		if db == nil {
+			continue
+		}
+		rec, err := db.lookup(addr)
+		if err != nil {
+			return nil, err
+		}
+		fillFromRecord(loc, rec, s.cfg.Language)
+	}
+	if data.csv != nil {
+		var row *ip.GeoLocation
+		data.csv.WalkPrefixes(addrKey(addr), func(_ string, v *ip.GeoLocation) bool {
+			row = v // the longest prefix is visited last
+			return true
+		})
+		if row != nil {
+			fillFromRow(loc, row)
+		}
+	}
+
+	if loc.Country == "" {
+		loc.Country, loc.CountryName = "XX", "Unknown"
+	}
+	return loc, nil
+}
+
+func (s *Service) LookupBatch(ctx context.Context, ips []string) ([]*ip.GeoLocation, error) {
+	results := make([]*ip.GeoLocation, len(ips))
+	for i, ipAddr := range ips {
+		loc, err := s.Lookup(ctx, ipAddr)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = loc
+	}
+	return results, nil
+}
+
+// GetThreatInfo combines the feeds listing the address: the highest Level
+// is its ThreatLevel and each feed's category is reported once.
+func (s *Service) GetThreatInfo(ctx context.Context, ipAddr string) (*ip.ThreatInfo, error) {
+	addr, err := parseAddr(ipAddr)
+	if err != nil {
+		return nil, err
+	}
+	data := s.data.Load()
+
+	info := &ip.ThreatInfo{IP: net.IP(addr.AsSlice())}
+	seen := make(map[int]bool)
+	data.threats.WalkPrefixes(addrKey(addr), func(_ string, feeds []int) bool {
+		for _, i := range feeds {
+			if seen[i] {
+				continue
+			}
+			seen[i] = true
+			f := s.cfg.Feeds[i]
+			info.ThreatLevel = max(info.ThreatLevel, f.Level)
+			if f.Category != "" && !slices.Contains(info.Categories, f.Category) {
+				info.Categories = append(info.Categories, f.Category)
+			}
+			switch strings.ToLower(f.Category) {
+			case "vpn":
+				info.IsVPN = true
+			case "proxy":
+				info.IsProxy = true
+			case "tor":
+				info.IsTor = true
+			case "bot":
+				info.IsBot = true
+			case "datacenter":
+				info.IsDatacenter = true
+			}
+		}
+		return true
+	})
+	info.IsThreat = info.ThreatLevel > 0
+	return info, nil
+}
+
+// IsBlocked reports whether the address's ThreatLevel reaches
+// BlockThreshold.
+func (s *Service) IsBlocked(ctx context.Context, ipAddr string) (bool, error) {
+	info, err := s.GetThreatInfo(ctx, ipAddr)
+	if err != nil {
+		return false, err
+	}
+	return info.ThreatLevel >= s.cfg.BlockThreshold, nil
+}
+
+func (s *Service) IsCountryAllowed(ctx context.Context, ipAddr string, allowedCountries []string) (bool, error) {
+	loc, err := s.Lookup(ctx, ipAddr)
+	if err != nil {
+		return false, err
+	}
+
+	for _, country := range allowedCountries {
+		if strings.EqualFold(loc.Country, country) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func parseAddr(s string) (netip.Addr, error) {
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, errors.InvalidArgument("invalid IP address", err)
+	}
+	return addr.Unmap().WithZone(""), nil
+}
+
+func loadMMDB(path string) (*mmdb, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.InvalidArgument("cannot read "+path, err)
+	}
+	db, err := parseMMDB(buf)
+	if err != nil {
+		return nil, errors.Wrap(err, path)
+	}
+	return db, nil
+}
+
+// prefixKey encodes a prefix as its address family followed by its
+// significant bits, one character per bit.
+func prefixKey(p netip.Prefix) string {
+	return bitString(p.Addr(), p.Bits())
+}
+
+// addrKey encodes an address like a prefix of full length.
+func addrKey(addr netip.Addr) string {
+	return bitString(addr, addr.BitLen())
+}
+
+func bitString(addr netip.Addr, bits int) string {
+	var b strings.Builder
+	b.Grow(bits + 1)
+	if addr.Is4() {
+		b.WriteByte('4')
+	} else {
+		b.WriteByte('6')
+	}
+	raw := addr.AsSlice()
+	for i := range bits {
+		if raw[i/8]&(0x80>>(i%8)) != 0 {
+			b.WriteByte('1')
+		} else {
+			b.WriteByte('0')
+		}
+	}
+	return b.String()
+}
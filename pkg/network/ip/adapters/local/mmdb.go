@@ -0,0 +1,323 @@
+package local
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"math/big"
+	"net/netip"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+)
+
+// metadataMarker starts the metadata section at the end of an MMDB file.
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// mmdb is a parsed MaxMind DB file, as specified at
+// https://maxmind.github.io/MaxMind-DB/.
+type mmdb struct {
+	buf        []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	dbType     string
+	data       []byte // the data section
+	ipv4Start  uint   // the node of ::/96 in IPv6 trees
+}
+
+func parseMMDB(buf []byte) (*mmdb, error) {
+	at := bytes.LastIndex(buf, metadataMarker)
+	if at < 0 {
+		return nil, errors.InvalidArgument("not a MaxMind DB file", nil)
+	}
+	meta := buf[at+len(metadataMarker):]
+	v, _, err := (&decoder{buf: meta}).decode(0)
+	if err != nil {
+		return nil, errors.InvalidArgument("invalid MaxMind DB metadata", err)
+	}
+	md, ok := v.(map[string]any)
+	if !ok {
+		return nil, errors.InvalidArgument("invalid MaxMind DB metadata", nil)
+	}
+
+	db := &mmdb{
+		buf:        buf,
+		nodeCount:  uint(asUint(md["node_count"])),
+		recordSize: uint(asUint(md["record_size"])),
+		ipVersion:  uint(asUint(md["ip_version"])),
+	}
+	db.dbType, _ = md["database_type"].(string)
+	switch db.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, errors.InvalidArgument("unsupported MaxMind DB record size", nil)
+	}
+
+	treeSize := db.nodeCount * db.recordSize / 4
+	if treeSize+16 > uint(at) {
+		return nil, errors.InvalidArgument("truncated MaxMind DB search tree", nil)
+	}
+	db.data = buf[treeSize+16 : at]
+
+	if db.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < db.nodeCount; i++ {
+			node = db.record(node, 0)
+		}
+		db.ipv4Start = node
+	}
+	return db, nil
+}
+
+// record reads the left (bit 0) or right (bit 1) record of a node.
+func (db *mmdb) record(node, bit uint) uint {
+	switch db.recordSize {
+	case 24:
+		off := node*6 + bit*3
+		b := db.buf[off : off+3]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		off := node * 7
+		b := db.buf[off : off+7]
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		off := node*8 + bit*4
+		return uint(binary.BigEndian.Uint32(db.buf[off : off+4]))
+	}
+}
+
+// lookup returns the record for addr, or nil if the database has none.
+func (db *mmdb) lookup(addr netip.Addr) (map[string]any, error) {
+	addr = addr.Unmap()
+	node := uint(0)
+	if addr.Is4() && db.ipVersion == 6 {
+		node = db.ipv4Start
+	} else if addr.Is6() && db.ipVersion == 4 {
+		return nil, nil
+	}
+
+	raw := addr.AsSlice()
+	for i := 0; i < len(raw)*8 && node < db.nodeCount; i++ {
+		node = db.record(node, uint(raw[i/8]>>(7-i%8))&1)
+	}
+	if node == db.nodeCount {
+		return nil, nil
+	}
+	if node < db.nodeCount {
+		return nil, errors.Internal("MaxMind DB search tree is too deep", nil)
+	}
+
+	off := node - db.nodeCount - 16
+	if off >= uint(len(db.data)) {
+		return nil, errors.Internal("invalid MaxMind DB data pointer", nil)
+	}
+	v, _, err := (&decoder{buf: db.data}).decode(off)
+	if err != nil {
+		return nil, err
+	}
+	rec, _ := v.(map[string]any)
+	return rec, nil
+}
+
+// Data section types.
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// maxDepth bounds the nesting of maps, arrays and pointers, so corrupt
+// files cannot recurse without end.
+const maxDepth = 64
+
+// decoder decodes MMDB data fields. Pointers are offsets into buf.
+type decoder struct {
+	buf   []byte
+	depth int
+}
+
+var errCorrupt = errors.Internal("corrupt MaxMind DB data", nil)
+
+func (d *decoder) decode(off uint) (any, uint, error) {
+	typ, size, off, err := d.control(off)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if typ == typePointer || typ == typeMap || typ == typeArray {
+		if d.depth++; d.depth > maxDepth {
+			return nil, 0, errCorrupt
+		}
+		defer func() { d.depth-- }()
+	}
+
+	if typ == typePointer {
+		ptr, next, err := d.pointer(size, off)
+		if err != nil {
+			return nil, 0, err
+		}
+		v, _, err := d.decode(ptr)
+		return v, next, err
+	}
+
+	end := off + size
+	switch typ {
+	case typeMap:
+		m := make(map[string]any, min(size, 64))
+		for range size {
+			k, next, err := d.decode(off)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, errCorrupt
+			}
+			v, next, err := d.decode(next)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+			off = next
+		}
+		return m, off, nil
+	case typeArray:
+		a := make([]any, 0, min(size, 64))
+		for range size {
+			v, next, err := d.decode(off)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+			off = next
+		}
+		return a, off, nil
+	}
+
+	if end > uint(len(d.buf)) {
+		return nil, 0, errCorrupt
+	}
+	b := d.buf[off:end]
+	switch typ {
+	case typeString:
+		return string(b), end, nil
+	case typeBytes:
+		return bytes.Clone(b), end, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, errCorrupt
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), end, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, errCorrupt
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), end, nil
+	case typeUint16, typeUint32, typeUint64:
+		var n uint64
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		return n, end, nil
+	case typeInt32:
+		var n uint32
+		for _, c := range b {
+			n = n<<8 | uint32(c)
+		}
+		return int64(int32(n)), end, nil
+	case typeUint128:
+		return new(big.Int).SetBytes(b), end, nil
+	case typeBool:
+		return size != 0, off, nil
+	case typeContainer, typeEndMarker:
+		return nil, off, nil
+	}
+	return nil, 0, errCorrupt
+}
+
+// control reads a field's control byte, returning its type, payload size
+// and the offset of the payload. A pointer's size holds its size bits.
+func (d *decoder) control(off uint) (int, uint, uint, error) {
+	if off >= uint(len(d.buf)) {
+		return 0, 0, 0, errCorrupt
+	}
+	ctrl := d.buf[off]
+	off++
+	typ := int(ctrl >> 5)
+	if typ == typePointer {
+		return typ, uint(ctrl & 0x1F), off, nil
+	}
+	if typ == typeExtended {
+		if off >= uint(len(d.buf)) {
+			return 0, 0, 0, errCorrupt
+		}
+		typ = 7 + int(d.buf[off])
+		off++
+	}
+
+	size := uint(ctrl & 0x1F)
+	if size >= 29 {
+		n := size - 28
+		if off+n > uint(len(d.buf)) {
+			return 0, 0, 0, errCorrupt
+		}
+		var v uint
+		for _, c := range d.buf[off : off+n] {
+			v = v<<8 | uint(c)
+		}
+		off += n
+		switch n {
+		case 1:
+			size = 29 + v
+		case 2:
+			size = 285 + v
+		default:
+			size = 65821 + v
+		}
+	}
+	return typ, size, off, nil
+}
+
+// pointer resolves a pointer whose control bits are ctrl, returning its
+// target and the offset after it.
+func (d *decoder) pointer(ctrl, off uint) (uint, uint, error) {
+	n := (ctrl>>3)&0x3 + 1
+	if off+n > uint(len(d.buf)) {
+		return 0, 0, errCorrupt
+	}
+	var v uint
+	if n < 4 {
+		v = ctrl & 0x7
+	}
+	for _, c := range d.buf[off : off+n] {
+		v = v<<8 | uint(c)
+	}
+	switch n {
+	case 2:
+		v += 2048
+	case 3:
+		v += 526336
+	}
+	return v, off + n, nil
+}
+
+func asUint(v any) uint64 {
+	n, _ := v.(uint64)
+	return n
+}
@@ -0,0 +1,215 @@
+package local
+
+import (
+	"bufio"
+	"encoding/csv"
+	"io"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/datastructures/tree/radix"
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/ip"
+)
+
+// fillFromRecord copies the fields of a MaxMind City, Country, ASN or ISP
+// record into loc, leaving fields the record lacks untouched.
+func fillFromRecord(loc *ip.GeoLocation, rec map[string]any, lang string) {
+	if rec == nil {
+		return
+	}
+
+	country, _ := rec["country"].(map[string]any)
+	if country == nil {
+		country, _ = rec["registered_country"].(map[string]any)
+	}
+	if country != nil {
+		set(&loc.Country, str(country["iso_code"]))
+		set(&loc.CountryName, name(country, lang))
+	}
+	if subs, _ := rec["subdivisions"].([]any); len(subs) > 0 {
+		if sub, ok := subs[0].(map[string]any); ok {
+			set(&loc.Region, str(sub["iso_code"]))
+			set(&loc.RegionName, name(sub, lang))
+		}
+	}
+	if city, ok := rec["city"].(map[string]any); ok {
+		set(&loc.City, name(city, lang))
+	}
+	if postal, ok := rec["postal"].(map[string]any); ok {
+		set(&loc.PostalCode, str(postal["code"]))
+	}
+	if l, ok := rec["location"].(map[string]any); ok {
+		if lat, ok := l["latitude"].(float64); ok {
+			loc.Latitude = lat
+		}
+		if lon, ok := l["longitude"].(float64); ok {
+			loc.Longitude = lon
+		}
+		set(&loc.Timezone, str(l["time_zone"]))
+	}
+
+	if n, ok := rec["autonomous_system_number"].(uint64); ok {
+		loc.ASN = int(n)
+	}
+	set(&loc.ASNOrg, str(rec["autonomous_system_organization"]))
+	set(&loc.ISP, str(rec["isp"]))
+	set(&loc.ISP, str(rec["organization"]))
+}
+
+// fillFromRow copies the fields of a CSV row that loc lacks.
+func fillFromRow(loc *ip.GeoLocation, row *ip.GeoLocation) {
+	set(&loc.Country, row.Country)
+	set(&loc.CountryName, row.CountryName)
+	set(&loc.Region, row.Region)
+	set(&loc.RegionName, row.RegionName)
+	set(&loc.City, row.City)
+	set(&loc.PostalCode, row.PostalCode)
+	if loc.Latitude == 0 && loc.Longitude == 0 {
+		loc.Latitude, loc.Longitude = row.Latitude, row.Longitude
+	}
+	set(&loc.Timezone, row.Timezone)
+	if loc.ASN == 0 {
+		loc.ASN = row.ASN
+	}
+	set(&loc.ASNOrg, row.ASNOrg)
+	set(&loc.ISP, row.ISP)
+}
+
+// set assigns v to an empty field.
+func set(field *string, v string) {
+	if *field == "" {
+		*field = v
+	}
+}
+
+func str(v any) string {
+	s, _ := v.(string)
+	return s
+}
+
+// name returns the localized name of a record, falling back to English.
+func name(rec map[string]any, lang string) string {
+	names, _ := rec["names"].(map[string]any)
+	if n := str(names[lang]); n != "" {
+		return n
+	}
+	return str(names["en"])
+}
+
+// loadGeoCSV reads a CSV geolocation database into a prefix tree.
+func loadGeoCSV(path string) (*radix.RadixTree[*ip.GeoLocation], error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.InvalidArgument("cannot read "+path, err)
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, errors.InvalidArgument("missing header in "+path, err)
+	}
+	cols := make(map[string]int)
+	for i, h := range header {
+		cols[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	if _, ok := cols["network"]; !ok {
+		return nil, errors.InvalidArgument("no network column in "+path, nil)
+	}
+
+	tree := radix.New[*ip.GeoLocation]()
+	for line := 2; ; line++ {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return tree, nil
+		}
+		if err != nil {
+			return nil, errors.InvalidArgument("invalid csv in "+path, err)
+		}
+		field := func(name string) string {
+			if i, ok := cols[name]; ok && i < len(rec) {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+
+		p, err := parsePrefix(field("network"))
+		if err != nil {
+			return nil, errors.InvalidArgument(path+": line "+strconv.Itoa(line), err)
+		}
+		loc := &ip.GeoLocation{
+			Country:     field("country"),
+			CountryName: field("country_name"),
+			Region:      field("region"),
+			RegionName:  field("region_name"),
+			City:        field("city"),
+			PostalCode:  field("postal_code"),
+			Timezone:    field("timezone"),
+			ASNOrg:      field("asn_org"),
+			ISP:         field("isp"),
+		}
+		loc.Latitude, _ = strconv.ParseFloat(field("latitude"), 64)
+		loc.Longitude, _ = strconv.ParseFloat(field("longitude"), 64)
+		asn := strings.TrimPrefix(strings.ToUpper(field("asn")), "AS")
+		loc.ASN, _ = strconv.Atoi(asn)
+		tree.Insert(prefixKey(p), loc)
+	}
+}
+
+// loadFeed reads the prefixes listed in a threat feed.
+func loadFeed(path string) ([]netip.Prefix, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.InvalidArgument("cannot read "+path, err)
+	}
+	defer f.Close()
+
+	var prefixes []netip.Prefix
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || text[0] == '#' || text[0] == ';' {
+			continue
+		}
+		if i := strings.IndexAny(text, " \t;,"); i >= 0 {
+			text = text[:i]
+		}
+		p, err := parsePrefix(text)
+		if err != nil {
+			return nil, errors.InvalidArgument(path+": line "+strconv.Itoa(line), err)
+		}
+		prefixes = append(prefixes, p)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, errors.InvalidArgument("cannot read "+path, err)
+	}
+	return prefixes, nil
+}
+
+// parsePrefix parses a CIDR or a single address, unmapping IPv4-mapped
+// IPv6 forms.
+func parsePrefix(s string) (netip.Prefix, error) {
+	if !strings.Contains(s, "/") {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	p, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	if p.Addr().Is4In6() && p.Bits() >= 96 {
+		p = netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
+	}
+	return p.Masked(), nil
+}
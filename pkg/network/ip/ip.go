@@ -8,6 +8,7 @@
 //
 // Supported backends:
 //   - Memory: In-memory for testing
+//   - Local: Offline MaxMind DB or CSV files and threat feeds
 //   - MaxMind: MaxMind GeoIP2
 //   - IPInfo: IPInfo.io
 //   - IPStack: IPStack API
@@ -28,6 +29,7 @@ import (
 // Driver constants for IP intelligence backends.
 const (
 	DriverMemory  = "memory"
+	DriverLocal   = "local"
 	DriverMaxMind = "maxmind"
 	DriverIPInfo  = "ipinfo"
 	DriverIPStack = "ipstack"
@@ -0,0 +1,300 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/ip/adapters/local"
+)
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+}
+
+// touch moves a file's modification time forward so reloads notice
+// rewrites within the file system's timestamp resolution.
+func touch(t *testing.T, path string) {
+	t.Helper()
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+}
+
+func cityDB(recordSize int) []byte {
+	w := newMMDBWriter("GeoLite2-City", recordSize)
+	us := w.share(map[string]any{"iso_code": "US", "names": map[string]any{"en": "United States", "de": "Vereinigte Staaten"}})
+	w.insert("8.8.0.0/16", map[string]any{
+		"country": us,
+		"city":    map[string]any{"names": map[string]any{"en": "Mountain View"}},
+		"subdivisions": []any{
+			map[string]any{"iso_code": "CA", "names": map[string]any{"en": "California"}},
+		},
+		"postal":   map[string]any{"code": "94035"},
+		"location": map[string]any{"latitude": 37.386, "longitude": -122.0838, "time_zone": "America/Los_Angeles"},
+	})
+	w.insert("8.8.8.0/24", map[string]any{
+		"country": us,
+		"city":    map[string]any{"names": map[string]any{"en": "Ashburn"}},
+	})
+	w.insert("2001:db8::/32", map[string]any{
+		"registered_country": map[string]any{"iso_code": "DE", "names": map[string]any{"en": "Germany", "de": "Deutschland"}},
+	})
+	return w.bytes()
+}
+
+func asnDB() []byte {
+	w := newMMDBWriter("GeoLite2-ASN", 24)
+	w.insert("8.8.0.0/16", map[string]any{
+		"autonomous_system_number":       uint32(15169),
+		"autonomous_system_organization": "Google LLC",
+	})
+	return w.bytes()
+}
+
+func TestLocalMMDBLookup(t *testing.T) {
+	for _, size := range []int{24, 28, 32} {
+		dir := t.TempDir()
+		writeFile(t, filepath.Join(dir, "city.mmdb"), cityDB(size))
+		writeFile(t, filepath.Join(dir, "asn.mmdb"), asnDB())
+
+		s, err := local.New(local.Config{
+			CityDB: filepath.Join(dir, "city.mmdb"),
+			ASNDB:  filepath.Join(dir, "asn.mmdb"),
+		})
+		if err != nil {
+			t.Fatalf("record size %d: New failed: %v", size, err)
+		}
+		ctx := context.Background()
+
+		loc, err := s.Lookup(ctx, "8.8.4.4")
+		if err != nil {
+			t.Fatalf("Lookup failed: %v", err)
+		}
+		if loc.Country != "US" || loc.CountryName != "United States" || loc.City != "Mountain View" ||
+			loc.Region != "CA" || loc.RegionName != "California" || loc.PostalCode != "94035" ||
+			loc.Timezone != "America/Los_Angeles" || loc.Latitude != 37.386 || loc.Longitude != -122.0838 ||
+			loc.ASN != 15169 || loc.ASNOrg != "Google LLC" {
+			t.Errorf("record size %d: 8.8.4.4 = %+v", size, loc)
+		}
+
+		// The more specific network wins.
+		if loc, _ := s.Lookup(ctx, "8.8.8.8"); loc.City != "Ashburn" || loc.Country != "US" {
+			t.Errorf("record size %d: 8.8.8.8 = %+v", size, loc)
+		}
+		if loc, _ := s.Lookup(ctx, "::ffff:8.8.8.8"); loc.City != "Ashburn" {
+			t.Errorf("record size %d: mapped 8.8.8.8 = %+v", size, loc)
+		}
+		if loc, _ := s.Lookup(ctx, "2001:db8::1"); loc.Country != "DE" || loc.CountryName != "Germany" {
+			t.Errorf("record size %d: 2001:db8::1 = %+v", size, loc)
+		}
+		if loc, _ := s.Lookup(ctx, "9.9.9.9"); loc.Country != "XX" {
+			t.Errorf("record size %d: unknown = %+v", size, loc)
+		}
+	}
+}
+
+func TestLocalLanguageAndCountries(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "city.mmdb"), cityDB(24))
+	s, err := local.New(local.Config{CityDB: filepath.Join(dir, "city.mmdb"), Language: "de"})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	ctx := context.Background()
+
+	loc, _ := s.Lookup(ctx, "8.8.8.8")
+	if loc.CountryName != "Vereinigte Staaten" || loc.City != "Ashburn" {
+		t.Errorf("localized lookup = %+v", loc)
+	}
+
+	if ok, _ := s.IsCountryAllowed(ctx, "8.8.8.8", []string{"ca", "us"}); !ok {
+		t.Error("US address not allowed")
+	}
+	if ok, _ := s.IsCountryAllowed(ctx, "2001:db8::1", []string{"US"}); ok {
+		t.Error("DE address allowed")
+	}
+	if _, err := s.Lookup(ctx, "not-an-ip"); err == nil {
+		t.Error("invalid address accepted")
+	}
+}
+
+func TestLocalCSVFallback(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "city.mmdb"), cityDB(24))
+	writeFile(t, filepath.Join(dir, "geo.csv"), []byte(`network,country,country_name,city,latitude,longitude,asn,asn_org
+# internal ranges
+10.0.0.0/8,ZZ,Internal,,0,0,,
+10.1.0.0/16,GB,United Kingdom,London,51.5072,-0.1276,AS64500,Example Ltd
+8.8.0.0/16,FR,France,Paris,48.8566,2.3522,,
+203.0.113.7,JP,Japan,Tokyo,35.6762,139.6503,64501,
+`))
+
+	s, err := local.New(local.Config{CityDB: filepath.Join(dir, "city.mmdb"), GeoCSV: filepath.Join(dir, "geo.csv")})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	ctx := context.Background()
+
+	loc, _ := s.Lookup(ctx, "10.1.2.3")
+	if loc.Country != "GB" || loc.City != "London" || loc.ASN != 64500 || loc.ASNOrg != "Example Ltd" || loc.Latitude != 51.5072 {
+		t.Errorf("10.1.2.3 = %+v", loc)
+	}
+	if loc, _ := s.Lookup(ctx, "10.2.0.1"); loc.Country != "ZZ" {
+		t.Errorf("10.2.0.1 = %+v", loc)
+	}
+	if loc, _ := s.Lookup(ctx, "203.0.113.7"); loc.City != "Tokyo" || loc.ASN != 64501 {
+		t.Errorf("203.0.113.7 = %+v", loc)
+	}
+	// The MaxMind database takes precedence over the CSV.
+	if loc, _ := s.Lookup(ctx, "8.8.4.4"); loc.Country != "US" || loc.City != "Mountain View" {
+		t.Errorf("8.8.4.4 = %+v", loc)
+	}
+}
+
+func TestLocalThreatFeeds(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "drop.txt"), []byte(`; Spamhaus DROP List 2026/10/16
+; Expires: Fri, 16 Oct 2026 12:00:00 GMT
+1.10.16.0/20 ; SBL256894
+192.0.2.0/24 ; SBL1
+`))
+	writeFile(t, filepath.Join(dir, "tor.txt"), []byte("# tor exits\n192.0.2.10\n2001:db8:1::1\n"))
+	writeFile(t, filepath.Join(dir, "vpn.txt"), []byte("198.51.100.0/24,ExampleVPN\n"))
+
+	s, err := local.New(local.Config{Feeds: []local.Feed{
+		{Path: filepath.Join(dir, "drop.txt"), Category: "spam", Level: 100},
+		{Path: filepath.Join(dir, "tor.txt"), Category: "tor", Level: 50},
+		{Path: filepath.Join(dir, "vpn.txt"), Category: "vpn"},
+	}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	ctx := context.Background()
+
+	info, err := s.GetThreatInfo(ctx, "192.0.2.10")
+	if err != nil {
+		t.Fatalf("GetThreatInfo failed: %v", err)
+	}
+	if !info.IsThreat || info.ThreatLevel != 100 || !info.IsTor || !slices.Equal(info.Categories, []string{"spam", "tor"}) {
+		t.Errorf("192.0.2.10 = %+v", info)
+	}
+
+	tests := []struct {
+		ip      string
+		threat  bool
+		level   int
+		blocked bool
+	}{
+		{"1.10.20.1", true, 100, true},
+		{"1.10.32.1", false, 0, false},
+		{"2001:db8:1::1", true, 50, false},
+		{"198.51.100.9", false, 0, false},
+		{"8.8.8.8", false, 0, false},
+	}
+	for _, tt := range tests {
+		info, err := s.GetThreatInfo(ctx, tt.ip)
+		if err != nil {
+			t.Fatalf("GetThreatInfo(%s) failed: %v", tt.ip, err)
+		}
+		blocked, _ := s.IsBlocked(ctx, tt.ip)
+		if info.IsThreat != tt.threat || info.ThreatLevel != tt.level || blocked != tt.blocked {
+			t.Errorf("%s = %+v blocked %v", tt.ip, info, blocked)
+		}
+	}
+	if info, _ := s.GetThreatInfo(ctx, "198.51.100.9"); !info.IsVPN {
+		t.Errorf("vpn range = %+v", info)
+	}
+}
+
+func TestLocalHotReload(t *testing.T) {
+	dir := t.TempDir()
+	feed := filepath.Join(dir, "block.txt")
+	city := filepath.Join(dir, "city.mmdb")
+	writeFile(t, feed, []byte("192.0.2.1\n"))
+	writeFile(t, city, cityDB(24))
+
+	s, err := local.New(local.Config{CityDB: city, Feeds: []local.Feed{{Path: feed, Category: "abuse", Level: 90}}, ReloadInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- s.Watch(ctx) }()
+
+	if blocked, _ := s.IsBlocked(ctx, "192.0.2.2"); blocked {
+		t.Fatal("blocked before the feed lists it")
+	}
+	writeFile(t, feed, []byte("192.0.2.1\n192.0.2.2\n"))
+	touch(t, feed)
+	waitFor(t, func() bool {
+		blocked, _ := s.IsBlocked(ctx, "192.0.2.2")
+		return blocked
+	})
+
+	// A broken file keeps the previous data.
+	writeFile(t, city, []byte("garbage"))
+	touch(t, city)
+	time.Sleep(50 * time.Millisecond)
+	if loc, _ := s.Lookup(ctx, "8.8.8.8"); loc.City != "Ashburn" {
+		t.Errorf("lookup after failed reload = %+v", loc)
+	}
+	if err := s.Reload(ctx); err == nil {
+		t.Error("Reload accepted a corrupt database")
+	}
+
+	w := newMMDBWriter("GeoLite2-City", 24)
+	w.insert("8.8.0.0/16", map[string]any{"country": map[string]any{"iso_code": "CH"}})
+	writeFile(t, city, w.bytes())
+	later := time.Now().Add(2 * time.Minute)
+	if err := os.Chtimes(city, later, later); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+	waitFor(t, func() bool {
+		loc, _ := s.Lookup(ctx, "8.8.8.8")
+		return loc.Country == "CH"
+	})
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Watch returned %v", err)
+	}
+}
+
+func TestLocalRejectsBadFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "bad.txt"), []byte("192.0.2.0/33\n"))
+	writeFile(t, filepath.Join(dir, "bad.csv"), []byte("country\nUS\n"))
+
+	for name, cfg := range map[string]local.Config{
+		"missing db":   {CityDB: filepath.Join(dir, "missing.mmdb")},
+		"not a db":     {CityDB: filepath.Join(dir, "bad.txt")},
+		"bad feed":     {Feeds: []local.Feed{{Path: filepath.Join(dir, "bad.txt")}}},
+		"bad level":    {Feeds: []local.Feed{{Path: filepath.Join(dir, "bad.txt"), Level: 101}}},
+		"csv no cidr":  {GeoCSV: filepath.Join(dir, "bad.csv")},
+		"missing feed": {Feeds: []local.Feed{{Path: filepath.Join(dir, "missing.txt")}}},
+	} {
+		if _, err := local.New(cfg); err == nil {
+			t.Errorf("%s: New succeeded", name)
+		}
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
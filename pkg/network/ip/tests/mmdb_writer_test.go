@@ -0,0 +1,220 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net/netip"
+	"sort"
+)
+
+// mmdbWriter builds small MaxMind DB files for tests: an IPv6 search tree
+// with IPv4 networks under ::/96.
+type mmdbWriter struct {
+	recordSize int
+	dbType     string
+	root       *trieNode
+	records    []map[string]any
+	shared     bytes.Buffer // values referenced by pointers
+}
+
+// mmdbPointer is a pointer to a shared value in the data section.
+type mmdbPointer int
+
+// share stores v once for records to point to.
+func (w *mmdbWriter) share(v any) mmdbPointer {
+	off := w.shared.Len()
+	encode(&w.shared, v)
+	return mmdbPointer(off)
+}
+
+type trieNode struct {
+	child [2]*trieNode
+	data  int // index into records, or -1
+	id    int
+}
+
+func newMMDBWriter(dbType string, recordSize int) *mmdbWriter {
+	return &mmdbWriter{recordSize: recordSize, dbType: dbType, root: &trieNode{data: -1}}
+}
+
+// insert maps a network to a record. Shorter prefixes must be inserted
+// before the longer prefixes they contain.
+func (w *mmdbWriter) insert(cidr string, rec map[string]any) {
+	p := netip.MustParsePrefix(cidr)
+	raw := p.Addr().As16()
+	bits := p.Bits()
+	if p.Addr().Is4() {
+		var v4 [16]byte
+		a4 := p.Addr().As4()
+		copy(v4[12:], a4[:])
+		raw = v4
+		bits += 96
+	}
+	w.records = append(w.records, rec)
+	data := len(w.records) - 1
+
+	n := w.root
+	for i := 0; i < bits; i++ {
+		bit := raw[i/8] >> (7 - i%8) & 1
+		if n.child[bit] == nil {
+			n.child[bit] = &trieNode{data: -1}
+			if n.data >= 0 {
+				// Split a covering network.
+				n.child[bit^1] = &trieNode{data: n.data}
+				n.child[bit].data = n.data
+				n.data = -1
+			}
+		}
+		n = n.child[bit]
+	}
+	n.data = data
+	n.child = [2]*trieNode{}
+}
+
+func (w *mmdbWriter) bytes() []byte {
+	// Number the inner nodes breadth first.
+	var nodes []*trieNode
+	queue := []*trieNode{w.root}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if n.data >= 0 {
+			continue
+		}
+		n.id = len(nodes)
+		nodes = append(nodes, n)
+		for _, c := range n.child {
+			if c != nil {
+				queue = append(queue, c)
+			}
+		}
+	}
+	count := len(nodes)
+
+	var data bytes.Buffer
+	data.Write(w.shared.Bytes())
+	offsets := make([]int, len(w.records))
+	for i, rec := range w.records {
+		offsets[i] = data.Len()
+		encode(&data, rec)
+	}
+
+	value := func(c *trieNode) uint32 {
+		switch {
+		case c == nil:
+			return uint32(count)
+		case c.data >= 0:
+			return uint32(count + 16 + offsets[c.data])
+		default:
+			return uint32(c.id)
+		}
+	}
+
+	var out bytes.Buffer
+	for _, n := range nodes {
+		l, r := value(n.child[0]), value(n.child[1])
+		switch w.recordSize {
+		case 24:
+			out.Write([]byte{byte(l >> 16), byte(l >> 8), byte(l), byte(r >> 16), byte(r >> 8), byte(r)})
+		case 28:
+			out.Write([]byte{byte(l >> 16), byte(l >> 8), byte(l), byte(l>>24)<<4 | byte(r>>24)&0x0F, byte(r >> 16), byte(r >> 8), byte(r)})
+		default:
+			out.Write(binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, l), r))
+		}
+	}
+	out.Write(make([]byte, 16))
+	out.Write(data.Bytes())
+	out.WriteString("\xAB\xCD\xEFMaxMind.com")
+	encode(&out, map[string]any{
+		"node_count":                  uint32(count),
+		"record_size":                 uint16(w.recordSize),
+		"ip_version":                  uint16(6),
+		"database_type":               w.dbType,
+		"languages":                   []any{"en", "de"},
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(1700000000),
+	})
+	return out.Bytes()
+}
+
+func control(buf *bytes.Buffer, typ int, size int) {
+	var ext []byte
+	if typ > 7 {
+		ext = []byte{byte(typ - 7)}
+		typ = 0
+	}
+	var extra []byte
+	switch {
+	case size < 29:
+	case size < 285:
+		extra = []byte{byte(size - 29)}
+		size = 29
+	default:
+		v := size - 285
+		extra = []byte{byte(v >> 8), byte(v)}
+		size = 30
+	}
+	buf.WriteByte(byte(typ<<5 | size))
+	buf.Write(ext)
+	buf.Write(extra)
+}
+
+func encode(buf *bytes.Buffer, v any) {
+	switch v := v.(type) {
+	case string:
+		control(buf, 2, len(v))
+		buf.WriteString(v)
+	case float64:
+		control(buf, 3, 8)
+		buf.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(v)))
+	case uint16:
+		b := trim(uint64(v))
+		control(buf, 5, len(b))
+		buf.Write(b)
+	case uint32:
+		b := trim(uint64(v))
+		control(buf, 6, len(b))
+		buf.Write(b)
+	case uint64:
+		b := trim(v)
+		control(buf, 9, len(b))
+		buf.Write(b)
+	case mmdbPointer:
+		// A two byte pointer: 001SSVVV then one byte, SS = 0.
+		buf.Write([]byte{byte(1<<5 | int(v)>>8&0x7), byte(v)})
+	case bool:
+		n := 0
+		if v {
+			n = 1
+		}
+		control(buf, 14, n)
+	case []any:
+		control(buf, 11, len(v))
+		for _, e := range v {
+			encode(buf, e)
+		}
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		control(buf, 7, len(v))
+		for _, k := range keys {
+			encode(buf, k)
+			encode(buf, v[k])
+		}
+	default:
+		panic("unsupported mmdb test value")
+	}
+}
+
+func trim(v uint64) []byte {
+	b := binary.BigEndian.AppendUint64(nil, v)
+	for len(b) > 0 && b[0] == 0 {
+		b = b[1:]
+	}
+	return b
+}
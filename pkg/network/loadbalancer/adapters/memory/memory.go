@@ -61,7 +61,7 @@ func (m *Manager) GetLoadBalancer(ctx context.Context, id string) (*loadbalancer
 		return nil, errors.NotFound("load balancer not found", nil)
 	}
 
-	return lb, nil
+	return copyLoadBalancer(lb), nil
 }
 
 func (m *Manager) ListLoadBalancers(ctx context.Context) ([]*loadbalancer.LoadBalancer, error) {
@@ -70,7 +70,7 @@ func (m *Manager) ListLoadBalancers(ctx context.Context) ([]*loadbalancer.LoadBa
 
 	lbs := make([]*loadbalancer.LoadBalancer, 0, len(m.loadBalancers))
 	for _, lb := range m.loadBalancers {
-		lbs = append(lbs, lb)
+		lbs = append(lbs, copyLoadBalancer(lb))
 	}
 
 	return lbs, nil
@@ -179,7 +179,7 @@ func (m *Manager) GetTargetPool(ctx context.Context, id string) (*loadbalancer.T
 		return nil, errors.NotFound("target pool not found", nil)
 	}
 
-	return pool, nil
+	return copyTargetPool(pool), nil
 }
 
 func (m *Manager) DeleteTargetPool(ctx context.Context, id string) error {
@@ -260,7 +260,29 @@ func (m *Manager) GetTargetHealth(ctx context.Context, poolID string) ([]*loadba
 		return nil, errors.NotFound("target pool not found", nil)
 	}
 
-	return pool.Targets, nil
+	return copyTargets(pool.Targets), nil
+}
+
+// SetTargetHealth sets the health status of a target, as a health checker
+// would.
+func (m *Manager) SetTargetHealth(ctx context.Context, poolID, targetID string, status loadbalancer.TargetStatus, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pool, ok := m.targetPools[poolID]
+	if !ok {
+		return errors.NotFound("target pool not found", nil)
+	}
+
+	for _, t := range pool.Targets {
+		if t.ID == targetID {
+			t.Status = status
+			t.Reason = reason
+			return nil
+		}
+	}
+
+	return errors.NotFound("target not found", nil)
 }
 
 func (m *Manager) AddRule(ctx context.Context, listenerID string, rule loadbalancer.Rule) (*loadbalancer.Rule, error) {
@@ -304,3 +326,40 @@ func (m *Manager) RemoveRule(ctx context.Context, listenerID, ruleID string) err
 
 	return errors.NotFound("rule not found", nil)
 }
+
+// The copy helpers keep callers from racing with later updates, such as a
+// proxy reading its configuration while targets change health.
+
+func copyLoadBalancer(lb *loadbalancer.LoadBalancer) *loadbalancer.LoadBalancer {
+	out := *lb
+	out.Listeners = make([]*loadbalancer.Listener, len(lb.Listeners))
+	for i, l := range lb.Listeners {
+		listener := *l
+		listener.Rules = make([]*loadbalancer.Rule, len(l.Rules))
+		for j, r := range l.Rules {
+			rule := *r
+			listener.Rules[j] = &rule
+		}
+		out.Listeners[i] = &listener
+	}
+	return &out
+}
+
+func copyTargetPool(pool *loadbalancer.TargetPool) *loadbalancer.TargetPool {
+	out := *pool
+	if pool.HealthCheck != nil {
+		hc := *pool.HealthCheck
+		out.HealthCheck = &hc
+	}
+	out.Targets = copyTargets(pool.Targets)
+	return &out
+}
+
+func copyTargets(targets []*loadbalancer.Target) []*loadbalancer.Target {
+	out := make([]*loadbalancer.Target, len(targets))
+	for i, t := range targets {
+		target := *t
+		out[i] = &target
+	}
+	return out
+}
@@ -13,6 +13,9 @@
 //
 //	lb := memory.New()
 //	err := lb.AddTarget(ctx, "pool-1", loadbalancer.Target{Address: "10.0.0.1", Port: 8080})
+//
+// pkg/network/loadbalancer/proxy serves a load balancer's configuration as a
+// working HTTP and TCP proxy.
 package loadbalancer
 
 import (
@@ -178,6 +181,26 @@ type RuleCondition struct {
 	Values []string
 }
 
+// Rule condition fields. A rule matches when all of its conditions match,
+// and a condition matches when any of its values does. Host and path values
+// may contain "*" and "?" wildcards.
+const (
+	ConditionHostHeader  = "host-header"
+	ConditionPathPattern = "path-pattern"
+	ConditionHTTPMethod  = "http-request-method"
+	ConditionSourceIP    = "source-ip"
+
+	// ConditionHTTPHeader is followed by the header name, as in
+	// "http-header:X-Canary"; see HTTPHeaderCondition.
+	ConditionHTTPHeader = "http-header:"
+)
+
+// HTTPHeaderCondition returns a condition matching requests whose header
+// name matches any of values.
+func HTTPHeaderCondition(name string, values ...string) RuleCondition {
+	return RuleCondition{Field: ConditionHTTPHeader + name, Values: values}
+}
+
 // TargetPool represents a pool of targets (target group).
 type TargetPool struct {
 	// ID is the unique identifier.
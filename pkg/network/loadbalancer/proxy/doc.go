@@ -0,0 +1,34 @@
+/*
+Package proxy runs a load balancer configuration as an embeddable HTTP and
+TCP reverse proxy.
+
+A Proxy binds the listeners of one load balancer from a
+loadbalancer.LoadBalancerManager:
+
+  - HTTP and HTTPS listeners route each request by the listener's rules,
+    in priority order, on host, path, method, source IP and header
+    conditions, falling back to the listener's default pool.
+  - TCP and TLS listeners forward connections to the default pool.
+
+Targets are chosen with the pkg/algorithms/loadbalancing balancer matching
+the pool's Algorithm; ip-hash pools use a consistent hash ring keyed by
+client IP. Pools with a HealthCheck are probed actively (HTTP, HTTPS, TCP
+or gRPC) and targets move in and out of service as they cross the
+thresholds; a new target takes no traffic until it passes its first
+check, which runs as soon as the target is added. Transitions are reported to managers implementing
+HealthReporter, such as the memory adapter. A pool without healthy targets
+answers 503.
+
+The configuration is re-read every ReloadInterval, or on Reload. Rule and
+pool changes apply to the next request; a removed target stops receiving
+new requests at once while its in-flight requests and connections get
+DrainTimeout to finish.
+
+Usage:
+
+	import "github.com/chris-alexander-pop/system-design-library/pkg/network/loadbalancer/proxy"
+
+	p := proxy.New(proxy.Config{}, manager, lb.ID)
+	err := p.ListenAndServe(ctx)
+*/
+package proxy
@@ -0,0 +1,245 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/loadbalancer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// runHealthChecks probes every target of the pool each interval until ctx
+// is cancelled, moving targets in and out of service as they cross the
+// healthy and unhealthy thresholds.
+func (pl *pool) runHealthChecks(ctx context.Context, hc loadbalancer.HealthCheck) {
+	interval := time.Duration(hc.IntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = pl.proxy.cfg.HealthCheckInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		pl.checkAll(ctx, hc)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (pl *pool) checkAll(ctx context.Context, hc loadbalancer.HealthCheck) {
+	pl.mu.RLock()
+	backends := make([]*backend, 0, len(pl.backends))
+	for _, b := range pl.backends {
+		backends = append(backends, b)
+	}
+	protocol := pl.cfg.Protocol
+	pl.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, b := range backends {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pl.check(ctx, hc, protocol, b)
+		}()
+	}
+	wg.Wait()
+}
+
+// check probes b once and records the result.
+func (pl *pool) check(ctx context.Context, hc loadbalancer.HealthCheck, protocol loadbalancer.Protocol, b *backend) {
+	timeout := time.Duration(hc.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = pl.proxy.cfg.HealthCheckTimeout
+	}
+	checkCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := probe(checkCtx, hc, protocol, b)
+	if ctx.Err() == nil {
+		pl.recordHealth(ctx, hc, b, err)
+	}
+}
+
+// recordHealth counts a probe result and changes the target's status once
+// a threshold is crossed, reporting the change to the manager. A new
+// target enters service on its first successful probe, and is reported
+// unhealthy if that probe fails.
+func (pl *pool) recordHealth(ctx context.Context, hc loadbalancer.HealthCheck, b *backend, err error) {
+	healthyThreshold := hc.HealthyThreshold
+	if healthyThreshold <= 0 {
+		healthyThreshold = pl.proxy.cfg.HealthyThreshold
+	}
+	unhealthyThreshold := hc.UnhealthyThreshold
+	if unhealthyThreshold <= 0 {
+		unhealthyThreshold = pl.proxy.cfg.UnhealthyThreshold
+	}
+
+	pl.mu.Lock()
+	if pl.backends[b.target.ID] != b {
+		// Removed while the probe ran.
+		pl.mu.Unlock()
+		return
+	}
+
+	first := !b.probed
+	b.probed = true
+
+	var status loadbalancer.TargetStatus
+	var reason string
+	if err == nil {
+		b.failures = 0
+		b.successes++
+		if !inService(b.target.Status) && (first || b.successes >= healthyThreshold) {
+			status = loadbalancer.TargetStatusHealthy
+			pl.add(b)
+		}
+	} else {
+		b.successes = 0
+		b.failures++
+		switch {
+		case inService(b.target.Status) && b.failures >= unhealthyThreshold:
+			status, reason = loadbalancer.TargetStatusUnhealthy, err.Error()
+			pl.remove(b)
+		case first && !inService(b.target.Status):
+			// Report why a new target has not entered service.
+			status, reason = loadbalancer.TargetStatusUnhealthy, err.Error()
+		}
+	}
+	if status != "" {
+		b.target.Status, b.target.Reason = status, reason
+	}
+	targetID, addr := b.target.ID, b.addr
+	pl.mu.Unlock()
+
+	if status == "" {
+		return
+	}
+	logger.L().InfoContext(ctx, "load balancer target health changed", "pool", pl.id, "target", addr, "status", status, "reason", reason)
+	if reporter, ok := pl.proxy.manager.(HealthReporter); ok {
+		if err := reporter.SetTargetHealth(ctx, pl.id, targetID, status, reason); err != nil {
+			logger.L().WarnContext(ctx, "failed to report target health", "pool", pl.id, "target", addr, "error", err)
+		}
+	}
+}
+
+// probe runs one health check against b.
+func probe(ctx context.Context, hc loadbalancer.HealthCheck, protocol loadbalancer.Protocol, b *backend) error {
+	host, port, _ := net.SplitHostPort(b.addr)
+	if hc.Port > 0 {
+		port = strconv.Itoa(hc.Port)
+	}
+	addr := net.JoinHostPort(host, port)
+
+	kind := hc.Type
+	if kind == "" {
+		kind = loadbalancer.HealthCheckTCP
+		if protocol == loadbalancer.ProtocolHTTP || protocol == loadbalancer.ProtocolHTTPS {
+			kind = loadbalancer.HealthCheckType(protocol)
+		}
+	}
+
+	switch kind {
+	case loadbalancer.HealthCheckHTTP, loadbalancer.HealthCheckHTTPS:
+		return probeHTTP(ctx, hc, kind, addr)
+
+	case loadbalancer.HealthCheckTCP:
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+
+	case loadbalancer.HealthCheckGRPC:
+		conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: hc.Path})
+		if err != nil {
+			return err
+		}
+		if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			return errors.Internal("grpc health status "+resp.GetStatus().String(), nil)
+		}
+		return nil
+	}
+	return errors.InvalidArgument("unsupported health check type "+string(kind), nil)
+}
+
+// healthClient performs HTTP health checks. Targets are addressed by IP,
+// which their certificates rarely name, so HTTPS checks do not verify them,
+// as with managed load balancers.
+var healthClient = &http.Client{
+	Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true}, //nolint:gosec // see above
+		DisableKeepAlives: true,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+}
+
+func probeHTTP(ctx context.Context, hc loadbalancer.HealthCheck, kind loadbalancer.HealthCheckType, addr string) error {
+	path := hc.Path
+	if path == "" {
+		path = "/"
+	}
+	url := "http://" + addr + path
+	if kind == loadbalancer.HealthCheckHTTPS {
+		url = "https://" + addr + path
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := healthClient.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+
+	if !expectedCode(hc.ExpectedCodes, resp.StatusCode) {
+		return errors.Internal(fmt.Sprintf("unexpected health check status %d", resp.StatusCode), nil)
+	}
+	return nil
+}
+
+// expectedCode reports whether code is in codes, a list such as "200",
+// "200,204" or "200-299". An empty list accepts 200.
+func expectedCode(codes string, code int) bool {
+	if strings.TrimSpace(codes) == "" {
+		return code == http.StatusOK
+	}
+	for _, part := range strings.Split(codes, ",") {
+		lo, hi, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		from, err := strconv.Atoi(lo)
+		if err != nil {
+			continue
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(hi); err != nil {
+				continue
+			}
+		}
+		if code >= from && code <= to {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/loadbalancer"
+)
+
+// listener is a bound load balancer listener. Its configuration is swapped
+// atomically on reload, so rule changes apply to the next request.
+type listener struct {
+	cfg atomic.Pointer[loadbalancer.Listener]
+	ln  net.Listener
+
+	// srv serves HTTP and HTTPS listeners.
+	srv *http.Server
+
+	// conns tracks the connections of TCP and TLS listeners.
+	mu      sync.Mutex
+	conns   map[net.Conn]struct{}
+	wg      sync.WaitGroup
+	stopped bool
+}
+
+func (p *Proxy) startListener(cfg *loadbalancer.Listener) (*listener, error) {
+	l := &listener{conns: make(map[net.Conn]struct{})}
+	l.setConfig(cfg)
+
+	secure := cfg.Protocol == loadbalancer.ProtocolHTTPS || cfg.Protocol == loadbalancer.ProtocolTLS
+	switch cfg.Protocol {
+	case loadbalancer.ProtocolHTTP, loadbalancer.ProtocolHTTPS, loadbalancer.ProtocolTCP, loadbalancer.ProtocolTLS:
+	default:
+		return nil, errors.Unimplemented("the proxy does not support "+string(cfg.Protocol)+" listeners", nil)
+	}
+	if secure && p.cfg.TLSConfig == nil {
+		return nil, errors.InvalidArgument(string(cfg.Protocol)+" listener "+cfg.ID+" requires a TLS config", nil)
+	}
+
+	ln, err := net.Listen("tcp", net.JoinHostPort(p.cfg.Host, strconv.Itoa(cfg.Port)))
+	if err != nil {
+		return nil, errors.Internal("failed to bind listener "+cfg.ID, err)
+	}
+	if secure {
+		ln = tls.NewListener(ln, p.cfg.TLSConfig)
+	}
+	l.ln = &onceCloseListener{Listener: ln}
+
+	logger.L().Info("started load balancer listener", "listener", cfg.ID, "protocol", cfg.Protocol, "addr", ln.Addr().String())
+
+	if cfg.Protocol == loadbalancer.ProtocolHTTP || cfg.Protocol == loadbalancer.ProtocolHTTPS {
+		l.srv = &http.Server{Handler: p.httpHandler(l), ReadHeaderTimeout: 30 * time.Second}
+		go func() { _ = l.srv.Serve(l.ln) }()
+		return l, nil
+	}
+
+	go l.accept(p)
+	return l, nil
+}
+
+// setConfig installs cfg with its rules in priority order.
+func (l *listener) setConfig(cfg *loadbalancer.Listener) {
+	c := *cfg
+	c.Rules = slices.Clone(cfg.Rules)
+	slices.SortStableFunc(c.Rules, func(a, b *loadbalancer.Rule) int { return a.Priority - b.Priority })
+	l.cfg.Store(&c)
+}
+
+// bindsLike reports whether cfg can be served without rebinding.
+func (l *listener) bindsLike(cfg *loadbalancer.Listener) bool {
+	cur := l.cfg.Load()
+	return cur.Protocol == cfg.Protocol && cur.Port == cfg.Port
+}
+
+func (l *listener) accept(p *Proxy) {
+	for {
+		conn, err := l.ln.Accept()
+		if err != nil {
+			return
+		}
+		l.mu.Lock()
+		if l.stopped {
+			l.mu.Unlock()
+			_ = conn.Close()
+			return
+		}
+		l.conns[conn] = struct{}{}
+		l.wg.Add(1)
+		l.mu.Unlock()
+
+		go func() {
+			defer func() {
+				l.mu.Lock()
+				delete(l.conns, conn)
+				l.mu.Unlock()
+				l.wg.Done()
+			}()
+			p.serveConn(l, conn)
+		}()
+	}
+}
+
+// stop closes the listener at once and gives in-flight requests and
+// connections timeout to finish. The returned channel is closed once they
+// have.
+func (l *listener) stop(timeout time.Duration) <-chan struct{} {
+	_ = l.ln.Close()
+	l.mu.Lock()
+	l.stopped = true
+	l.mu.Unlock()
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		if l.srv != nil {
+			if err := l.srv.Shutdown(ctx); err != nil {
+				_ = l.srv.Close()
+			}
+			return
+		}
+
+		drained := make(chan struct{})
+		go func() {
+			l.wg.Wait()
+			close(drained)
+		}()
+		select {
+		case <-drained:
+		case <-ctx.Done():
+			l.mu.Lock()
+			for conn := range l.conns {
+				_ = conn.Close()
+			}
+			l.mu.Unlock()
+			<-drained
+		}
+	}()
+	return done
+}
+
+// onceCloseListener lets stop close the socket before http.Server.Shutdown
+// closes it again, which would otherwise report an error.
+type onceCloseListener struct {
+	net.Listener
+	once sync.Once
+	err  error
+}
+
+func (l *onceCloseListener) Close() error {
+	l.once.Do(func() { l.err = l.Listener.Close() })
+	return l.err
+}
@@ -0,0 +1,303 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/algorithms/consistenthash/ring"
+	"github.com/chris-alexander-pop/system-design-library/pkg/algorithms/loadbalancing"
+	"github.com/chris-alexander-pop/system-design-library/pkg/algorithms/loadbalancing/leastconnections"
+	"github.com/chris-alexander-pop/system-design-library/pkg/algorithms/loadbalancing/random"
+	"github.com/chris-alexander-pop/system-design-library/pkg/algorithms/loadbalancing/roundrobin"
+	"github.com/chris-alexander-pop/system-design-library/pkg/algorithms/loadbalancing/weightedroundrobin"
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/loadbalancer"
+)
+
+// errNoTargets is returned when a pool has no target in service.
+var errNoTargets = errors.NotFound("no healthy targets in pool", nil)
+
+// ringReplicas is the number of virtual nodes per target for ip-hash pools.
+const ringReplicas = 100
+
+// pool is the runtime state of a target pool: its targets, the balancer
+// choosing among those in service, and its health checker.
+type pool struct {
+	proxy *Proxy
+	id    string
+
+	mu        sync.RWMutex
+	cfg       *loadbalancer.TargetPool
+	backends  map[string]*backend
+	balancer  loadbalancing.Balancer
+	ring      *ring.Ring
+	checks    *loadbalancer.HealthCheck
+	checkCtx  context.Context
+	stopCheck context.CancelFunc
+}
+
+// backend is a target of a pool.
+type backend struct {
+	target loadbalancer.Target // guarded by pool.mu
+	addr   string
+	url    *url.URL
+
+	// health check counters, guarded by pool.mu.
+	successes, failures int
+	// probed is set once a health check result has been recorded, guarded
+	// by pool.mu.
+	probed bool
+
+	active atomic.Int64
+
+	// ctx is cancelled when a removed target's drain timeout elapses,
+	// cutting its remaining requests and connections.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	draining bool
+	drained  chan struct{}
+	once     sync.Once
+}
+
+func newPool(p *Proxy, id string) *pool {
+	return &pool{proxy: p, id: id, backends: make(map[string]*backend)}
+}
+
+// inService reports whether a target may receive new requests.
+func inService(status loadbalancer.TargetStatus) bool {
+	switch status {
+	case loadbalancer.TargetStatusUnhealthy, loadbalancer.TargetStatusDraining, loadbalancer.TargetStatusUnused:
+		return false
+	}
+	return true
+}
+
+// update applies the pool configuration and target list from the manager.
+// Must be called with p.proxy.mu held.
+func (pl *pool) update(cfg *loadbalancer.TargetPool, targets []*loadbalancer.Target) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	rebuild := pl.cfg == nil || pl.cfg.Algorithm != cfg.Algorithm
+	pl.cfg = cfg
+	if rebuild {
+		pl.balancer, pl.ring = newBalancer(cfg.Algorithm)
+	}
+
+	checked := cfg.HealthCheck != nil
+	seen := make(map[string]bool, len(targets))
+	var fresh []*backend
+	for _, t := range targets {
+		seen[t.ID] = true
+		b, ok := pl.backends[t.ID]
+		if !ok {
+			b = pl.newBackend(t)
+			if checked {
+				// A health-checked target takes no traffic until it has
+				// passed a check.
+				b.target.Status, b.target.Reason = loadbalancer.TargetStatusUnhealthy, "awaiting health check"
+				fresh = append(fresh, b)
+			}
+			pl.backends[t.ID] = b
+			if inService(b.target.Status) {
+				pl.add(b)
+			}
+			continue
+		}
+
+		wasIn := inService(b.target.Status)
+		if wasIn && !rebuild && b.target.Weight != t.Weight {
+			pl.remove(b)
+			wasIn = false
+		}
+		b.target.Weight = t.Weight
+		// With health checks the proxy's own view of health wins.
+		if !checked {
+			b.target.Status, b.target.Reason = t.Status, t.Reason
+		}
+		if isIn := inService(b.target.Status); isIn && (!wasIn || rebuild) {
+			pl.add(b)
+		} else if !isIn && wasIn {
+			pl.remove(b)
+		}
+	}
+
+	for id, b := range pl.backends {
+		if !seen[id] {
+			pl.drain(b)
+		}
+	}
+
+	if !reflect.DeepEqual(pl.checks, cfg.HealthCheck) {
+		if pl.stopCheck != nil {
+			pl.stopCheck()
+			pl.stopCheck = nil
+		}
+		pl.checks, pl.checkCtx = nil, nil
+		if checked {
+			hc := *cfg.HealthCheck
+			pl.checks = &hc
+			ctx, cancel := context.WithCancel(context.Background())
+			pl.checkCtx, pl.stopCheck = ctx, cancel
+			// The first round probes every target, fresh ones included.
+			go pl.runHealthChecks(ctx, hc)
+			return
+		}
+	}
+
+	// Probe new targets now rather than leaving them out of service until
+	// the next round.
+	for _, b := range fresh {
+		go pl.check(pl.checkCtx, *pl.checks, cfg.Protocol, b)
+	}
+}
+
+func newBalancer(alg loadbalancer.Algorithm) (loadbalancing.Balancer, *ring.Ring) {
+	switch alg {
+	case loadbalancer.AlgorithmWeightedRoundRobin:
+		return weightedroundrobin.New(), nil
+	case loadbalancer.AlgorithmLeastConnections:
+		return leastconnections.New(), nil
+	case loadbalancer.AlgorithmRandom:
+		return random.New(), nil
+	case loadbalancer.AlgorithmIPHash:
+		return nil, ring.New(ringReplicas, nil)
+	default:
+		return roundrobin.New(), nil
+	}
+}
+
+func (pl *pool) newBackend(t *loadbalancer.Target) *backend {
+	port := t.Port
+	if port == 0 {
+		port = pl.cfg.Port
+	}
+	scheme := "http"
+	if pl.cfg.Protocol == loadbalancer.ProtocolHTTPS {
+		scheme = "https"
+	}
+	addr := net.JoinHostPort(t.Address, strconv.Itoa(port))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &backend{
+		target:  *t,
+		addr:    addr,
+		url:     &url.URL{Scheme: scheme, Host: addr},
+		ctx:     ctx,
+		cancel:  cancel,
+		drained: make(chan struct{}),
+	}
+}
+
+// add and remove change the targets the balancer chooses from. They must
+// be called with pl.mu held.
+func (pl *pool) add(b *backend) {
+	if pl.ring != nil {
+		pl.ring.Add(b.target.ID)
+		return
+	}
+	pl.balancer.Add(b.target.ID, b.target.Weight)
+}
+
+func (pl *pool) remove(b *backend) {
+	if pl.ring != nil {
+		pl.ring.Remove(b.target.ID)
+		return
+	}
+	pl.balancer.Remove(b.target.ID)
+}
+
+// acquire chooses a target for a request from clientIP. The caller must
+// release it when the request ends.
+func (pl *pool) acquire(ctx context.Context, clientIP string) (*backend, error) {
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+
+	var id string
+	if pl.ring != nil {
+		id = pl.ring.Get(clientIP)
+	} else {
+		next, err := pl.balancer.Next(ctx)
+		if err != nil {
+			return nil, errNoTargets
+		}
+		id = next
+	}
+
+	b, ok := pl.backends[id]
+	if !ok {
+		return nil, errNoTargets
+	}
+	b.active.Add(1)
+	if lc, ok := pl.balancer.(*leastconnections.Balancer); ok {
+		lc.Inc(id)
+	}
+	return b, nil
+}
+
+func (pl *pool) release(b *backend) {
+	pl.mu.RLock()
+	if lc, ok := pl.balancer.(*leastconnections.Balancer); ok {
+		lc.Dec(b.target.ID)
+	}
+	pl.mu.RUnlock()
+
+	if b.active.Add(-1) == 0 {
+		b.mu.Lock()
+		if b.draining {
+			b.once.Do(func() { close(b.drained) })
+		}
+		b.mu.Unlock()
+	}
+}
+
+// drain takes b out of the pool at once and cancels whatever it still
+// serves after the drain timeout. Must be called with pl.mu held.
+func (pl *pool) drain(b *backend) {
+	if inService(b.target.Status) {
+		pl.remove(b)
+	}
+	delete(pl.backends, b.target.ID)
+
+	b.mu.Lock()
+	b.draining = true
+	if b.active.Load() == 0 {
+		b.once.Do(func() { close(b.drained) })
+	}
+	b.mu.Unlock()
+
+	timeout := pl.proxy.cfg.DrainTimeout
+	poolID, target := pl.id, b.addr
+	go func() {
+		defer b.cancel()
+		select {
+		case <-b.drained:
+			logger.L().Info("drained load balancer target", "pool", poolID, "target", target)
+		case <-time.After(timeout):
+			logger.L().Warn("load balancer target drain timed out", "pool", poolID, "target", target, "active", b.active.Load())
+		}
+	}()
+}
+
+// close stops health checks and drains every target.
+func (pl *pool) close() {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	if pl.stopCheck != nil {
+		pl.stopCheck()
+		pl.stopCheck = nil
+	}
+	for _, b := range pl.backends {
+		pl.drain(b)
+	}
+}
@@ -0,0 +1,272 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	stderrors "errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/loadbalancer"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Config holds configuration for the proxy.
+type Config struct {
+	// Host is the interface listeners bind to; empty binds all interfaces.
+	Host string `env:"LB_PROXY_HOST"`
+
+	// ReloadInterval is how often the configuration is re-read from the
+	// manager. Reload applies changes immediately.
+	ReloadInterval time.Duration `env:"LB_PROXY_RELOAD_INTERVAL" env-default:"5s"`
+
+	// DrainTimeout bounds how long requests and connections to a removed
+	// target, or on a removed listener, may run before they are cut.
+	DrainTimeout time.Duration `env:"LB_PROXY_DRAIN_TIMEOUT" env-default:"30s"`
+
+	// DialTimeout bounds connecting to a target.
+	DialTimeout time.Duration `env:"LB_PROXY_DIAL_TIMEOUT" env-default:"5s"`
+
+	// HealthCheckInterval and HealthCheckTimeout apply to health checks
+	// that do not set their own.
+	HealthCheckInterval time.Duration `env:"LB_PROXY_HEALTH_INTERVAL" env-default:"30s"`
+	HealthCheckTimeout  time.Duration `env:"LB_PROXY_HEALTH_TIMEOUT" env-default:"5s"`
+
+	// HealthyThreshold and UnhealthyThreshold apply to health checks that
+	// do not set their own.
+	HealthyThreshold   int `env:"LB_PROXY_HEALTHY_THRESHOLD" env-default:"2"`
+	UnhealthyThreshold int `env:"LB_PROXY_UNHEALTHY_THRESHOLD" env-default:"2"`
+
+	// TLSConfig terminates TLS on HTTPS and TLS listeners, which are not
+	// bound without it.
+	TLSConfig *tls.Config
+}
+
+// HealthReporter is implemented by managers that accept health updates,
+// such as the memory adapter. The proxy reports health check transitions
+// to it so that GetTargetHealth reflects them.
+type HealthReporter interface {
+	SetTargetHealth(ctx context.Context, poolID, targetID string, status loadbalancer.TargetStatus, reason string) error
+}
+
+// Proxy runs the listeners of one load balancer, routing requests to the
+// targets of its pools.
+type Proxy struct {
+	cfg     Config
+	manager loadbalancer.LoadBalancerManager
+	lbID    string
+	tracer  trace.Tracer
+
+	transport *http.Transport
+
+	reloadMu  sync.Mutex // serializes Reload
+	mu        sync.RWMutex
+	listeners map[string]*listener
+	pools     map[string]*pool
+	closed    bool
+}
+
+// New creates a proxy for the load balancer lbID of manager. Nothing is
+// bound until ListenAndServe or Reload.
+func New(cfg Config, manager loadbalancer.LoadBalancerManager, lbID string) *Proxy {
+	if cfg.ReloadInterval <= 0 {
+		cfg.ReloadInterval = 5 * time.Second
+	}
+	if cfg.DrainTimeout <= 0 {
+		cfg.DrainTimeout = 30 * time.Second
+	}
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = 5 * time.Second
+	}
+	if cfg.HealthCheckInterval <= 0 {
+		cfg.HealthCheckInterval = 30 * time.Second
+	}
+	if cfg.HealthCheckTimeout <= 0 {
+		cfg.HealthCheckTimeout = 5 * time.Second
+	}
+	if cfg.HealthyThreshold <= 0 {
+		cfg.HealthyThreshold = 2
+	}
+	if cfg.UnhealthyThreshold <= 0 {
+		cfg.UnhealthyThreshold = 2
+	}
+
+	dialer := &net.Dialer{Timeout: cfg.DialTimeout}
+	return &Proxy{
+		cfg:     cfg,
+		manager: manager,
+		lbID:    lbID,
+		tracer:  instrument.NewTracer("pkg/network/loadbalancer/proxy"),
+		transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			MaxIdleConnsPerHost: 64,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		listeners: make(map[string]*listener),
+		pools:     make(map[string]*pool),
+	}
+}
+
+// ListenAndServe binds the load balancer's listeners and serves them until
+// ctx is cancelled, re-reading the configuration every ReloadInterval.
+// In-flight requests get DrainTimeout to finish on shutdown.
+func (p *Proxy) ListenAndServe(ctx context.Context) error {
+	if err := p.Reload(ctx); err != nil {
+		return err
+	}
+	logger.L().InfoContext(ctx, "started load balancer proxy", "load_balancer", p.lbID)
+
+	ticker := time.NewTicker(p.cfg.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			p.Close()
+			return nil
+		case <-ticker.C:
+			if err := p.Reload(ctx); err != nil {
+				logger.L().ErrorContext(ctx, "failed to reload load balancer", "load_balancer", p.lbID, "error", err)
+			}
+		}
+	}
+}
+
+// Reload applies the manager's current configuration: listeners are bound
+// or closed, pools pick up added and removed targets and health check
+// changes, and rules take effect for the next request. Removed targets
+// stop receiving new requests at once and are drained.
+func (p *Proxy) Reload(ctx context.Context) error {
+	p.reloadMu.Lock()
+	defer p.reloadMu.Unlock()
+
+	lb, err := p.manager.GetLoadBalancer(ctx, p.lbID)
+	if err != nil {
+		return err
+	}
+
+	// Load every pool the listeners route to.
+	pools := make(map[string]*loadbalancer.TargetPool)
+	var targets = make(map[string][]*loadbalancer.Target)
+	for _, l := range lb.Listeners {
+		ids := []string{l.TargetPoolID}
+		for _, r := range l.Rules {
+			ids = append(ids, r.TargetPoolID)
+		}
+		for _, id := range ids {
+			if id == "" || pools[id] != nil {
+				continue
+			}
+			tp, err := p.manager.GetTargetPool(ctx, id)
+			if err != nil {
+				return errors.Wrap(err, "failed to load target pool "+id)
+			}
+			ts, err := p.manager.GetTargetHealth(ctx, id)
+			if err != nil {
+				return errors.Wrap(err, "failed to load targets of pool "+id)
+			}
+			pools[id], targets[id] = tp, ts
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return errors.Internal("proxy is closed", nil)
+	}
+
+	for id, tp := range pools {
+		pl, ok := p.pools[id]
+		if !ok {
+			pl = newPool(p, id)
+			p.pools[id] = pl
+		}
+		pl.update(tp, targets[id])
+	}
+	for id, pl := range p.pools {
+		if _, ok := pools[id]; !ok {
+			pl.close()
+			delete(p.pools, id)
+		}
+	}
+
+	var errs []error
+	seen := make(map[string]bool)
+	for _, l := range lb.Listeners {
+		seen[l.ID] = true
+		cur, ok := p.listeners[l.ID]
+		if ok && cur.bindsLike(l) {
+			cur.setConfig(l)
+			continue
+		}
+		if ok {
+			cur.stop(p.cfg.DrainTimeout)
+			delete(p.listeners, l.ID)
+		}
+		nl, err := p.startListener(l)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		p.listeners[l.ID] = nl
+	}
+	for id, l := range p.listeners {
+		if !seen[id] {
+			l.stop(p.cfg.DrainTimeout)
+			delete(p.listeners, id)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.Internal("failed to bind listeners", stderrors.Join(errs...))
+	}
+	return nil
+}
+
+// Addr returns the bound address of a listener, which differs from its
+// port when the port is 0.
+func (p *Proxy) Addr(listenerID string) (net.Addr, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	l, ok := p.listeners[listenerID]
+	if !ok {
+		return nil, false
+	}
+	return l.ln.Addr(), true
+}
+
+// Close stops all listeners and health checks, giving in-flight requests
+// DrainTimeout to finish.
+func (p *Proxy) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+
+	var stopped []<-chan struct{}
+	for _, l := range p.listeners {
+		stopped = append(stopped, l.stop(p.cfg.DrainTimeout))
+	}
+	for _, pl := range p.pools {
+		pl.close()
+	}
+	p.mu.Unlock()
+
+	for _, done := range stopped {
+		<-done
+	}
+	p.transport.CloseIdleConnections()
+}
+
+func (p *Proxy) pool(id string) *pool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.pools[id]
+}
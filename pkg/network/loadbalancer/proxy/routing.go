@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/loadbalancer"
+)
+
+// route returns the target pool for r: that of the first matching rule in
+// priority order, or the listener's default pool.
+func route(l *loadbalancer.Listener, r *http.Request) string {
+	for _, rule := range l.Rules {
+		if ruleMatches(rule, r) {
+			return rule.TargetPoolID
+		}
+	}
+	return l.TargetPoolID
+}
+
+func ruleMatches(rule *loadbalancer.Rule, r *http.Request) bool {
+	for _, c := range rule.Conditions {
+		if !conditionMatches(c, r) {
+			return false
+		}
+	}
+	return true
+}
+
+func conditionMatches(c loadbalancer.RuleCondition, r *http.Request) bool {
+	switch {
+	case c.Field == loadbalancer.ConditionHostHeader:
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		return anyMatch(c.Values, strings.ToLower(host), true)
+
+	case c.Field == loadbalancer.ConditionPathPattern:
+		return anyMatch(c.Values, r.URL.Path, false)
+
+	case c.Field == loadbalancer.ConditionHTTPMethod:
+		for _, v := range c.Values {
+			if strings.EqualFold(v, r.Method) {
+				return true
+			}
+		}
+		return false
+
+	case c.Field == loadbalancer.ConditionSourceIP:
+		addr, err := netip.ParseAddr(clientIP(r.RemoteAddr))
+		if err != nil {
+			return false
+		}
+		for _, v := range c.Values {
+			if prefix, err := netip.ParsePrefix(v); err == nil && prefix.Contains(addr.Unmap()) {
+				return true
+			}
+			if ip, err := netip.ParseAddr(v); err == nil && ip == addr.Unmap() {
+				return true
+			}
+		}
+		return false
+
+	case strings.HasPrefix(c.Field, loadbalancer.ConditionHTTPHeader):
+		name := strings.TrimPrefix(c.Field, loadbalancer.ConditionHTTPHeader)
+		for _, h := range r.Header.Values(name) {
+			if anyMatch(c.Values, h, true) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Unknown fields never match, so a misspelt condition does not widen
+	// a rule.
+	return false
+}
+
+func anyMatch(patterns []string, s string, foldCase bool) bool {
+	for _, p := range patterns {
+		if foldCase {
+			p = strings.ToLower(p)
+			s = strings.ToLower(s)
+		}
+		if wildcardMatch(p, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// wildcardMatch matches s against pattern, where "*" matches any sequence
+// of characters, including "/", and "?" matches exactly one.
+func wildcardMatch(pattern, s string) bool {
+	px, sx := 0, 0
+	star, match := -1, 0
+	for sx < len(s) {
+		switch {
+		case px < len(pattern) && (pattern[px] == '?' || pattern[px] == s[sx]):
+			px++
+			sx++
+		case px < len(pattern) && pattern[px] == '*':
+			star, match = px, sx
+			px++
+		case star >= 0:
+			px = star + 1
+			match++
+			sx = match
+		default:
+			return false
+		}
+	}
+	for px < len(pattern) && pattern[px] == '*' {
+		px++
+	}
+	return px == len(pattern)
+}
+
+// clientIP returns the host part of a remote address.
+func clientIP(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
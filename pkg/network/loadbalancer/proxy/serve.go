@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type backendKey struct{}
+
+// httpHandler routes each request on l to a target of the matching pool.
+func (p *Proxy) httpHandler(l *listener) http.Handler {
+	rp := &httputil.ReverseProxy{
+		Transport: p.transport,
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			b := pr.In.Context().Value(backendKey{}).(*backend)
+			pr.SetURL(b.url)
+			pr.SetXForwarded()
+			// Targets see the host the client asked for, as behind any
+			// load balancer.
+			pr.Out.Host = pr.In.Host
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			trace.SpanFromContext(r.Context()).RecordError(err)
+			logger.L().WarnContext(r.Context(), "load balancer target request failed", "target", r.Context().Value(backendKey{}).(*backend).addr, "error", err)
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := l.cfg.Load()
+		ctx, span := p.tracer.Start(r.Context(), "loadbalancer.ProxyRequest", trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+			attribute.String("lb.listener.id", cfg.ID),
+			attribute.String("http.request.method", r.Method),
+			attribute.String("url.path", r.URL.Path),
+		))
+		defer span.End()
+
+		poolID := route(cfg, r)
+		pl := p.pool(poolID)
+		if pl == nil {
+			span.SetStatus(codes.Error, "no target pool")
+			http.Error(w, "no route", http.StatusNotFound)
+			return
+		}
+		span.SetAttributes(attribute.String("lb.pool.id", poolID))
+
+		b, err := pl.acquire(ctx, clientIP(r.RemoteAddr))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			http.Error(w, "no healthy targets", http.StatusServiceUnavailable)
+			return
+		}
+		defer pl.release(b)
+		span.SetAttributes(attribute.String("lb.target", b.addr))
+
+		// Cut the request if its target is removed and fails to drain.
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		defer context.AfterFunc(b.ctx, cancel)()
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		rp.ServeHTTP(rec, r.WithContext(context.WithValue(ctx, backendKey{}, b)))
+
+		span.SetAttributes(attribute.Int("http.response.status_code", rec.status))
+		if rec.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rec.status))
+		}
+	})
+}
+
+// statusRecorder captures the status code written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// serveConn proxies a TCP or TLS connection to a target of the listener's
+// default pool; rules apply to HTTP listeners only.
+func (p *Proxy) serveConn(l *listener, conn net.Conn) {
+	defer conn.Close()
+
+	cfg := l.cfg.Load()
+	ctx, span := p.tracer.Start(context.Background(), "loadbalancer.ProxyConn", trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+		attribute.String("lb.listener.id", cfg.ID),
+		attribute.String("lb.pool.id", cfg.TargetPoolID),
+	))
+	defer span.End()
+
+	pl := p.pool(cfg.TargetPoolID)
+	if pl == nil {
+		span.SetStatus(codes.Error, "no target pool")
+		return
+	}
+	b, err := pl.acquire(ctx, clientIP(conn.RemoteAddr().String()))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+	defer pl.release(b)
+	span.SetAttributes(attribute.String("lb.target", b.addr))
+
+	d := net.Dialer{Timeout: p.cfg.DialTimeout}
+	upstream, err := d.DialContext(b.ctx, "tcp", b.addr)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		logger.L().WarnContext(ctx, "failed to connect to load balancer target", "target", b.addr, "error", err)
+		return
+	}
+	defer upstream.Close()
+	defer context.AfterFunc(b.ctx, func() {
+		_ = conn.Close()
+		_ = upstream.Close()
+	})()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = io.Copy(upstream, conn)
+		if cw, ok := upstream.(interface{ CloseWrite() error }); ok {
+			_ = cw.CloseWrite()
+		}
+	}()
+	_, _ = io.Copy(conn, upstream)
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		_ = cw.CloseWrite()
+	}
+	<-done
+}
@@ -0,0 +1,319 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/loadbalancer"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/loadbalancer/adapters/memory"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/loadbalancer/proxy"
+	"github.com/stretchr/testify/suite"
+)
+
+// ProxySuite tests the reverse proxy against backends on the loopback
+// interface.
+type ProxySuite struct {
+	suite.Suite
+	manager  *memory.Manager
+	lb       *loadbalancer.LoadBalancer
+	proxy    *proxy.Proxy
+	backends []*httptest.Server
+	ctx      context.Context
+}
+
+// SetupTest creates a load balancer and a proxy serving it.
+func (s *ProxySuite) SetupTest() {
+	s.ctx = context.Background()
+	s.manager = memory.New()
+	lb, err := s.manager.CreateLoadBalancer(s.ctx, loadbalancer.CreateLoadBalancerOptions{Name: "edge"})
+	s.Require().NoError(err)
+	s.lb = lb
+	s.proxy = proxy.New(proxy.Config{
+		Host:                "127.0.0.1",
+		ReloadInterval:      time.Hour,
+		DrainTimeout:        2 * time.Second,
+		HealthCheckInterval: 20 * time.Millisecond,
+		HealthyThreshold:    1,
+		UnhealthyThreshold:  1,
+	}, s.manager, lb.ID)
+	s.backends = nil
+}
+
+// TearDownTest stops the proxy and the test's backends.
+func (s *ProxySuite) TearDownTest() {
+	s.proxy.Close()
+	for _, b := range s.backends {
+		b.Close()
+	}
+}
+
+// backend starts an HTTP server answering with name.
+func (s *ProxySuite) backend(name string, handler http.HandlerFunc) *httptest.Server {
+	if handler == nil {
+		handler = func(w http.ResponseWriter, r *http.Request) { _, _ = io.WriteString(w, name) }
+	}
+	srv := httptest.NewServer(handler)
+	s.backends = append(s.backends, srv)
+	return srv
+}
+
+func (s *ProxySuite) pool(opts loadbalancer.CreateTargetPoolOptions, backends ...*httptest.Server) *loadbalancer.TargetPool {
+	pool, err := s.manager.CreateTargetPool(s.ctx, opts)
+	s.Require().NoError(err)
+	for _, b := range backends {
+		s.addTarget(pool.ID, b.Listener.Addr(), 1)
+	}
+	return pool
+}
+
+func (s *ProxySuite) addTarget(poolID string, addr net.Addr, weight int) {
+	host, port, _ := net.SplitHostPort(addr.String())
+	p, _ := strconv.Atoi(port)
+	s.Require().NoError(s.manager.AddTarget(s.ctx, poolID, loadbalancer.Target{Address: host, Port: p, Weight: weight}))
+}
+
+func (s *ProxySuite) listener(protocol loadbalancer.Protocol, poolID string) (*loadbalancer.Listener, string) {
+	l, err := s.manager.CreateListener(s.ctx, loadbalancer.CreateListenerOptions{LoadBalancerID: s.lb.ID, Protocol: protocol, TargetPoolID: poolID})
+	s.Require().NoError(err)
+	s.reload()
+	addr, ok := s.proxy.Addr(l.ID)
+	s.Require().True(ok, "listener %s not bound", l.ID)
+	return l, addr.String()
+}
+
+func (s *ProxySuite) reload() {
+	s.Require().NoError(s.proxy.Reload(s.ctx))
+}
+
+func (s *ProxySuite) get(url string, header http.Header) (int, string) {
+	code, body, err := get(url, header)
+	s.Require().NoError(err)
+	return code, body
+}
+
+func get(url string, header http.Header) (int, string, error) {
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body), err
+}
+
+func (s *ProxySuite) TestRoutesByRules() {
+	web := s.pool(loadbalancer.CreateTargetPoolOptions{Name: "web"}, s.backend("web", nil))
+	api := s.pool(loadbalancer.CreateTargetPoolOptions{Name: "api"}, s.backend("api", nil))
+	canary := s.pool(loadbalancer.CreateTargetPoolOptions{Name: "canary"}, s.backend("canary", nil))
+
+	l, addr := s.listener(loadbalancer.ProtocolHTTP, web.ID)
+	rules := []loadbalancer.Rule{
+		{Priority: 20, TargetPoolID: api.ID, Conditions: []loadbalancer.RuleCondition{
+			{Field: loadbalancer.ConditionPathPattern, Values: []string{"/api/*"}},
+		}},
+		{Priority: 10, TargetPoolID: canary.ID, Conditions: []loadbalancer.RuleCondition{
+			{Field: loadbalancer.ConditionPathPattern, Values: []string{"/api/*"}},
+			loadbalancer.HTTPHeaderCondition("X-Canary", "true"),
+		}},
+	}
+	for _, r := range rules {
+		_, err := s.manager.AddRule(s.ctx, l.ID, r)
+		s.Require().NoError(err)
+	}
+
+	// Rules apply after a reload.
+	_, body := s.get("http://"+addr+"/api/orders", nil)
+	s.Require().Equal("web", body, "before reload")
+	s.reload()
+
+	tests := []struct {
+		path   string
+		header http.Header
+		want   string
+	}{
+		{"/", nil, "web"},
+		{"/api/orders/1", nil, "api"},
+		{"/api/orders/1", http.Header{"X-Canary": {"TRUE"}}, "canary"},
+		{"/apix", nil, "web"},
+	}
+	for _, tt := range tests {
+		code, body := s.get("http://"+addr+tt.path, tt.header)
+		s.Equal(http.StatusOK, code, "GET %s %v", tt.path, tt.header)
+		s.Equal(tt.want, body, "GET %s %v", tt.path, tt.header)
+	}
+}
+
+func (s *ProxySuite) TestBalancesAcrossTargets() {
+	pool := s.pool(loadbalancer.CreateTargetPoolOptions{Name: "web", Algorithm: loadbalancer.AlgorithmWeightedRoundRobin})
+	s.addTarget(pool.ID, s.backend("a", nil).Listener.Addr(), 3)
+	s.addTarget(pool.ID, s.backend("b", nil).Listener.Addr(), 1)
+	_, addr := s.listener(loadbalancer.ProtocolHTTP, pool.ID)
+
+	counts := make(map[string]int)
+	for range 40 {
+		_, body := s.get("http://"+addr, nil)
+		counts[body]++
+	}
+	s.Equal(map[string]int{"a": 30, "b": 10}, counts)
+}
+
+func (s *ProxySuite) TestHealthChecks() {
+	var failing atomic.Bool
+	flaky := s.backend("flaky", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" && failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = io.WriteString(w, "flaky")
+	})
+	pool := s.pool(loadbalancer.CreateTargetPoolOptions{
+		Name:        "web",
+		HealthCheck: &loadbalancer.HealthCheck{Type: loadbalancer.HealthCheckHTTP, Path: "/healthz", ExpectedCodes: "200-299"},
+	}, flaky, s.backend("steady", nil))
+	_, addr := s.listener(loadbalancer.ProtocolHTTP, pool.ID)
+
+	status := func() loadbalancer.TargetStatus {
+		targets, err := s.manager.GetTargetHealth(s.ctx, pool.ID)
+		if err != nil {
+			return ""
+		}
+		for _, target := range targets {
+			if net.JoinHostPort(target.Address, strconv.Itoa(target.Port)) == flaky.Listener.Addr().String() {
+				return target.Status
+			}
+		}
+		return ""
+	}
+
+	failing.Store(true)
+	s.Require().Eventually(func() bool { return status() == loadbalancer.TargetStatusUnhealthy }, 5*time.Second, 10*time.Millisecond)
+	for range 6 {
+		_, body := s.get("http://"+addr, nil)
+		s.Require().Equal("steady", body, "only the healthy target")
+	}
+
+	failing.Store(false)
+	s.Require().Eventually(func() bool { return status() == loadbalancer.TargetStatusHealthy }, 5*time.Second, 10*time.Millisecond)
+	seen := make(map[string]bool)
+	for range 6 {
+		_, body := s.get("http://"+addr, nil)
+		seen[body] = true
+	}
+	s.True(seen["flaky"], "recovered target got no requests: %v", seen)
+}
+
+func (s *ProxySuite) TestNewTargetsWaitForHealthCheck() {
+	sick := s.backend("sick", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = io.WriteString(w, "sick")
+	})
+	pool := s.pool(loadbalancer.CreateTargetPoolOptions{
+		Name:        "web",
+		HealthCheck: &loadbalancer.HealthCheck{Type: loadbalancer.HealthCheckHTTP, Path: "/healthz"},
+	}, s.backend("steady", nil))
+	_, addr := s.listener(loadbalancer.ProtocolHTTP, pool.ID)
+	s.Require().Eventually(func() bool {
+		code, _, err := get("http://"+addr, nil)
+		return err == nil && code == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+
+	s.addTarget(pool.ID, sick.Listener.Addr(), 1)
+	s.reload()
+	for range 10 {
+		_, body := s.get("http://"+addr, nil)
+		s.Require().Equal("steady", body, "only the checked target")
+	}
+}
+
+func (s *ProxySuite) TestDrainsRemovedTargets() {
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	old := s.backend("old", func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		_, _ = io.WriteString(w, "old")
+	})
+	pool := s.pool(loadbalancer.CreateTargetPoolOptions{Name: "web"}, old)
+	_, addr := s.listener(loadbalancer.ProtocolHTTP, pool.ID)
+
+	inFlight := make(chan string, 1)
+	go func() {
+		_, body, _ := get("http://"+addr, nil)
+		inFlight <- body
+	}()
+	<-started
+
+	s.addTarget(pool.ID, s.backend("new", nil).Listener.Addr(), 1)
+	targets, _ := s.manager.GetTargetHealth(s.ctx, pool.ID)
+	for _, target := range targets {
+		if net.JoinHostPort(target.Address, strconv.Itoa(target.Port)) == old.Listener.Addr().String() {
+			s.Require().NoError(s.manager.RemoveTarget(s.ctx, pool.ID, target.ID))
+		}
+	}
+	s.reload()
+
+	for range 3 {
+		_, body := s.get("http://"+addr, nil)
+		s.Require().Equal("new", body, "new requests go to the remaining target")
+	}
+
+	close(release)
+	select {
+	case body := <-inFlight:
+		s.Equal("old", body, "the drained request finishes")
+	case <-time.After(5 * time.Second):
+		s.Fail("in-flight request did not finish")
+	}
+}
+
+func (s *ProxySuite) TestTCPListener() {
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	s.Require().NoError(err)
+	defer echo.Close()
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	pool := s.pool(loadbalancer.CreateTargetPoolOptions{Name: "tcp", Protocol: loadbalancer.ProtocolTCP})
+	s.addTarget(pool.ID, echo.Addr(), 1)
+	_, addr := s.listener(loadbalancer.ProtocolTCP, pool.ID)
+
+	conn, err := net.Dial("tcp", addr)
+	s.Require().NoError(err)
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+	_, err = conn.Write([]byte("ping"))
+	s.Require().NoError(err)
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(conn, buf)
+	s.Require().NoError(err)
+	s.Equal("ping", string(buf))
+}
+
+// TestProxySuite runs the test suite.
+func TestProxySuite(t *testing.T) {
+	suite.Run(t, new(ProxySuite))
+}
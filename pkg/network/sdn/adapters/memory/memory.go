@@ -2,29 +2,98 @@ package memory
 
 import (
 	"context"
+	"net/netip"
+	"slices"
+	"strings"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/concurrency"
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/dhcp"
+	dhcpmemory "github.com/chris-alexander-pop/system-design-library/pkg/network/dhcp/adapters/memory"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/firewall/engine"
 	"github.com/chris-alexander-pop/system-design-library/pkg/network/sdn"
 	"github.com/google/uuid"
 )
 
-// MemoryNetworkManager is an in-memory implementation of NetworkManager.
+// PublicPoolID is the IPAM pool NAT gateway public addresses come from.
+// With an IPAM that can define pools it is 198.51.100.0/24.
+const PublicPoolID = "sdn-public"
+
+// poolDefiner is implemented by IPAMs whose pools can be defined at
+// runtime, such as the memory IPAM. With other IPAMs, a pool named after
+// each subnet ID, and PublicPoolID, must already exist.
+type poolDefiner interface {
+	AddPool(poolID string, first, last string) error
+}
+
+// Option configures a MemoryNetworkManager.
+type Option func(*MemoryNetworkManager)
+
+// WithIPAM allocates interface addresses from ipam, in one pool per subnet
+// named after the subnet ID. It defaults to an in-memory IPAM.
+func WithIPAM(ipam dhcp.IPAM) Option {
+	return func(m *MemoryNetworkManager) { m.ipam = ipam }
+}
+
+// WithFirewall enforces the security groups of interfaces with fw when
+// packets are sent. Without it security groups cannot be set.
+func WithFirewall(fw *engine.Engine) Option {
+	return func(m *MemoryNetworkManager) { m.fw = fw }
+}
+
+// MemoryNetworkManager is an in-memory implementation of NetworkManager
+// that also simulates the overlay (sdn.Overlay).
 type MemoryNetworkManager struct {
-	networks map[string]*sdn.Network
-	mu       *concurrency.SmartRWMutex
+	networks   map[string]*sdn.Network
+	tables     map[string]*sdn.RouteTable
+	interfaces map[string]*sdn.Interface
+	peerings   map[string]*sdn.Peering
+	nats       map[string]*sdn.NATGateway
+
+	// hosts indexes interface addresses by network.
+	hosts map[string]map[netip.Addr]string
+	// allocations are the IPAM allocations of interfaces and gateways.
+	allocations map[string][]string
+
+	ipam dhcp.IPAM
+	fw   *engine.Engine
+	mu   *concurrency.SmartRWMutex
 }
 
+var _ sdn.Overlay = (*MemoryNetworkManager)(nil)
+
 // New creates a new MemoryNetworkManager.
-func New() *MemoryNetworkManager {
-	return &MemoryNetworkManager{
-		networks: make(map[string]*sdn.Network),
+func New(opts ...Option) *MemoryNetworkManager {
+	m := &MemoryNetworkManager{
+		networks:    make(map[string]*sdn.Network),
+		tables:      make(map[string]*sdn.RouteTable),
+		interfaces:  make(map[string]*sdn.Interface),
+		peerings:    make(map[string]*sdn.Peering),
+		nats:        make(map[string]*sdn.NATGateway),
+		hosts:       make(map[string]map[netip.Addr]string),
+		allocations: make(map[string][]string),
 		mu: concurrency.NewSmartRWMutex(concurrency.MutexConfig{
 			Name: "memory-sdn",
 		}),
 	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.ipam == nil {
+		m.ipam = dhcpmemory.New()
+	}
+	if pools, ok := m.ipam.(poolDefiner); ok {
+		_ = pools.AddPool(PublicPoolID, "198.51.100.1", "198.51.100.254")
+	}
+	return m
 }
 
 func (m *MemoryNetworkManager) CreateNetwork(ctx context.Context, spec sdn.NetworkSpec) (string, error) {
+	prefix, err := netip.ParsePrefix(spec.CIDR)
+	if err != nil {
+		return "", errors.InvalidArgument("invalid network cidr", err)
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -39,12 +108,23 @@ func (m *MemoryNetworkManager) CreateNetwork(ctx context.Context, spec sdn.Netwo
 	network := &sdn.Network{
 		ID:      id,
 		Name:    spec.Name,
-		CIDR:    spec.CIDR,
+		CIDR:    prefix.Masked().String(),
 		Subnets: []sdn.Subnet{},
 		Tags:    spec.Tags,
 	}
 
 	m.networks[id] = network
+	m.hosts[id] = make(map[netip.Addr]string)
+
+	// Every network starts with a main route table delivering locally.
+	main := &sdn.RouteTable{
+		ID:        uuid.NewString(),
+		NetworkID: id,
+		Name:      "main",
+		Main:      true,
+		Routes:    []sdn.Route{{Destination: network.CIDR, Target: sdn.RouteTargetLocal}},
+	}
+	m.tables[main.ID] = main
 	return id, nil
 }
 
@@ -55,12 +135,35 @@ func (m *MemoryNetworkManager) DeleteNetwork(ctx context.Context, networkID stri
 	if _, ok := m.networks[networkID]; !ok {
 		return sdn.ErrNetworkNotFound
 	}
+	if len(m.hosts[networkID]) > 0 {
+		return sdn.ErrResourceInUse
+	}
 
+	for id, t := range m.tables {
+		if t.NetworkID == networkID {
+			delete(m.tables, id)
+		}
+	}
+	for id, p := range m.peerings {
+		if p.NetworkID == networkID || p.PeerNetworkID == networkID {
+			delete(m.peerings, id)
+		}
+	}
 	delete(m.networks, networkID)
+	delete(m.hosts, networkID)
 	return nil
 }
 
+// CreateSubnet adds a subnet and an IPAM pool for its addresses. The
+// network address, the first address (the subnet's gateway) and the
+// broadcast address are not allocated.
 func (m *MemoryNetworkManager) CreateSubnet(ctx context.Context, networkID string, spec sdn.SubnetSpec) (string, error) {
+	prefix, err := netip.ParsePrefix(spec.CIDR)
+	if err != nil {
+		return "", errors.InvalidArgument("invalid subnet cidr", err)
+	}
+	prefix = prefix.Masked()
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -69,14 +172,32 @@ func (m *MemoryNetworkManager) CreateSubnet(ctx context.Context, networkID strin
 		return "", sdn.ErrNetworkNotFound
 	}
 
-	// Simplistic overlap check would go here
+	netPrefix := netip.MustParsePrefix(network.CIDR)
+	if !netPrefix.Contains(prefix.Addr()) || prefix.Bits() < netPrefix.Bits() {
+		return "", errors.InvalidArgument("subnet is outside the network cidr", nil)
+	}
+	for _, s := range network.Subnets {
+		if netip.MustParsePrefix(s.CIDR).Overlaps(prefix) {
+			return "", sdn.ErrSubnetOverlap
+		}
+	}
 
 	id := uuid.NewString()
+	if pools, ok := m.ipam.(poolDefiner); ok {
+		first, last, ok := hostRange(prefix)
+		if !ok {
+			return "", errors.InvalidArgument("subnet is too small", nil)
+		}
+		if err := pools.AddPool(id, first.String(), last.String()); err != nil {
+			return "", err
+		}
+	}
+
 	subnet := sdn.Subnet{
 		ID:        id,
 		NetworkID: networkID,
 		Name:      spec.Name,
-		CIDR:      spec.CIDR,
+		CIDR:      prefix.String(),
 		Zone:      spec.Zone,
 		Tags:      spec.Tags,
 	}
@@ -89,12 +210,26 @@ func (m *MemoryNetworkManager) DeleteSubnet(ctx context.Context, subnetID string
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	for _, i := range m.interfaces {
+		if i.SubnetID == subnetID {
+			return sdn.ErrResourceInUse
+		}
+	}
+	for _, g := range m.nats {
+		if g.SubnetID == subnetID {
+			return sdn.ErrResourceInUse
+		}
+	}
+
 	// This is O(N) scan, acceptable for memory adapter
 	for _, network := range m.networks {
 		for i, subnet := range network.Subnets {
 			if subnet.ID == subnetID {
 				// Remove from slice
 				network.Subnets = append(network.Subnets[:i], network.Subnets[i+1:]...)
+				for _, t := range m.tables {
+					t.SubnetIDs = slices.DeleteFunc(t.SubnetIDs, func(id string) bool { return id == subnetID })
+				}
 				return nil
 			}
 		}
@@ -114,5 +249,388 @@ func (m *MemoryNetworkManager) GetNetwork(ctx context.Context, networkID string)
 
 	// Return copy to prevent race conditions
 	n := *network
+	n.Subnets = slices.Clone(network.Subnets)
 	return &n, nil
 }
+
+// CreateInterface attaches an interface to a subnet. Its security groups
+// are attached to the firewall engine under the interface ID.
+func (m *MemoryNetworkManager) CreateInterface(ctx context.Context, subnetID string, spec sdn.InterfaceSpec) (*sdn.Interface, error) {
+	if len(spec.SecurityGroups) > 0 && m.fw == nil {
+		return nil, errors.InvalidArgument("security groups need a firewall engine", nil)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	subnet, ok := m.subnet(subnetID)
+	if !ok {
+		return nil, sdn.ErrSubnetNotFound
+	}
+
+	iface := &sdn.Interface{
+		ID:             uuid.NewString(),
+		Name:           spec.Name,
+		NetworkID:      subnet.NetworkID,
+		SubnetID:       subnetID,
+		SecurityGroups: slices.Clone(spec.SecurityGroups),
+		Tags:           spec.Tags,
+	}
+	addr, err := m.allocate(ctx, iface.ID, subnet, spec.IP)
+	if err != nil {
+		return nil, err
+	}
+	iface.IP = addr.String()
+
+	if len(iface.SecurityGroups) > 0 {
+		err := m.fw.Attach(ctx, engine.Endpoint{ID: iface.ID, Addrs: []netip.Addr{addr}, GroupIDs: iface.SecurityGroups})
+		if err != nil {
+			m.release(ctx, iface.ID)
+			return nil, err
+		}
+	}
+
+	m.interfaces[iface.ID] = iface
+	m.hosts[iface.NetworkID][addr] = iface.ID
+	return copyInterface(iface), nil
+}
+
+func (m *MemoryNetworkManager) DeleteInterface(ctx context.Context, interfaceID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	iface, ok := m.interfaces[interfaceID]
+	if !ok {
+		return sdn.ErrInterfaceNotFound
+	}
+	if m.fw != nil && len(iface.SecurityGroups) > 0 {
+		m.fw.Detach(interfaceID)
+	}
+	delete(m.hosts[iface.NetworkID], netip.MustParseAddr(iface.IP))
+	delete(m.interfaces, interfaceID)
+	m.release(ctx, interfaceID)
+	return nil
+}
+
+func (m *MemoryNetworkManager) CreateRouteTable(ctx context.Context, networkID string, name string) (*sdn.RouteTable, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	network, ok := m.networks[networkID]
+	if !ok {
+		return nil, sdn.ErrNetworkNotFound
+	}
+
+	t := &sdn.RouteTable{
+		ID:        uuid.NewString(),
+		NetworkID: networkID,
+		Name:      name,
+		Routes:    []sdn.Route{{Destination: network.CIDR, Target: sdn.RouteTargetLocal}},
+	}
+	m.tables[t.ID] = t
+	return copyRouteTable(t), nil
+}
+
+func (m *MemoryNetworkManager) GetRouteTable(ctx context.Context, tableID string) (*sdn.RouteTable, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	t, ok := m.tables[tableID]
+	if !ok {
+		return nil, sdn.ErrRouteTableNotFound
+	}
+	return copyRouteTable(t), nil
+}
+
+func (m *MemoryNetworkManager) ListRouteTables(ctx context.Context, networkID string) ([]sdn.RouteTable, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.networks[networkID]; !ok {
+		return nil, sdn.ErrNetworkNotFound
+	}
+	var tables []sdn.RouteTable
+	for _, t := range m.tables {
+		if t.NetworkID == networkID {
+			tables = append(tables, *copyRouteTable(t))
+		}
+	}
+	slices.SortFunc(tables, func(a, b sdn.RouteTable) int {
+		if a.Main != b.Main {
+			if a.Main {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return tables, nil
+}
+
+// AddRoute adds a route. Peering and NAT gateway targets must belong to
+// the table's network.
+func (m *MemoryNetworkManager) AddRoute(ctx context.Context, tableID string, route sdn.Route) error {
+	prefix, err := netip.ParsePrefix(route.Destination)
+	if err != nil {
+		return errors.InvalidArgument("invalid route destination", err)
+	}
+	route.Destination = prefix.Masked().String()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.tables[tableID]
+	if !ok {
+		return sdn.ErrRouteTableNotFound
+	}
+
+	switch route.Target {
+	case sdn.RouteTargetLocal:
+		return errors.InvalidArgument("local routes are created with the route table", nil)
+	case sdn.RouteTargetPeering:
+		p, ok := m.peerings[route.TargetID]
+		if !ok {
+			return sdn.ErrPeeringNotFound
+		}
+		if p.NetworkID != t.NetworkID && p.PeerNetworkID != t.NetworkID {
+			return errors.InvalidArgument("peering does not connect the route table's network", nil)
+		}
+	case sdn.RouteTargetNATGateway:
+		g, ok := m.nats[route.TargetID]
+		if !ok {
+			return sdn.ErrNATGatewayNotFound
+		}
+		if g.NetworkID != t.NetworkID {
+			return errors.InvalidArgument("nat gateway is in another network", nil)
+		}
+	case sdn.RouteTargetInternet:
+		route.TargetID = ""
+	default:
+		return errors.InvalidArgument("unknown route target "+route.Target, nil)
+	}
+
+	for _, r := range t.Routes {
+		if r.Destination == route.Destination {
+			return errors.Conflict("route already exists for "+route.Destination, nil)
+		}
+	}
+	t.Routes = append(t.Routes, route)
+	return nil
+}
+
+func (m *MemoryNetworkManager) RemoveRoute(ctx context.Context, tableID string, destination string) error {
+	prefix, err := netip.ParsePrefix(destination)
+	if err != nil {
+		return errors.InvalidArgument("invalid route destination", err)
+	}
+	destination = prefix.Masked().String()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.tables[tableID]
+	if !ok {
+		return sdn.ErrRouteTableNotFound
+	}
+	for i, r := range t.Routes {
+		if r.Destination == destination {
+			if r.Target == sdn.RouteTargetLocal {
+				return errors.InvalidArgument("the local route cannot be removed", nil)
+			}
+			t.Routes = append(t.Routes[:i], t.Routes[i+1:]...)
+			return nil
+		}
+	}
+	return sdn.ErrRouteNotFound
+}
+
+func (m *MemoryNetworkManager) AssociateRouteTable(ctx context.Context, tableID string, subnetID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.tables[tableID]
+	if !ok {
+		return sdn.ErrRouteTableNotFound
+	}
+	subnet, ok := m.subnet(subnetID)
+	if !ok {
+		return sdn.ErrSubnetNotFound
+	}
+	if subnet.NetworkID != t.NetworkID {
+		return errors.InvalidArgument("subnet is in another network", nil)
+	}
+
+	for _, other := range m.tables {
+		other.SubnetIDs = slices.DeleteFunc(other.SubnetIDs, func(id string) bool { return id == subnetID })
+	}
+	if !t.Main {
+		t.SubnetIDs = append(t.SubnetIDs, subnetID)
+	}
+	return nil
+}
+
+func (m *MemoryNetworkManager) CreatePeering(ctx context.Context, networkID, peerNetworkID string) (*sdn.Peering, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a, ok := m.networks[networkID]
+	if !ok {
+		return nil, sdn.ErrNetworkNotFound
+	}
+	b, ok := m.networks[peerNetworkID]
+	if !ok {
+		return nil, sdn.ErrNetworkNotFound
+	}
+	if networkID == peerNetworkID {
+		return nil, errors.InvalidArgument("a network cannot peer with itself", nil)
+	}
+	if netip.MustParsePrefix(a.CIDR).Overlaps(netip.MustParsePrefix(b.CIDR)) {
+		return nil, errors.InvalidArgument("peered networks must not overlap", nil)
+	}
+
+	p := &sdn.Peering{ID: uuid.NewString(), NetworkID: networkID, PeerNetworkID: peerNetworkID}
+	m.peerings[p.ID] = p
+	cp := *p
+	return &cp, nil
+}
+
+// DeletePeering removes a peering. Routes to it are kept and drop
+// traffic, like blackhole routes.
+func (m *MemoryNetworkManager) DeletePeering(ctx context.Context, peeringID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.peerings[peeringID]; !ok {
+		return sdn.ErrPeeringNotFound
+	}
+	delete(m.peerings, peeringID)
+	return nil
+}
+
+// CreateNATGateway adds a NAT gateway with a private address in the subnet
+// and a public address from PublicPoolID.
+func (m *MemoryNetworkManager) CreateNATGateway(ctx context.Context, subnetID string) (*sdn.NATGateway, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	subnet, ok := m.subnet(subnetID)
+	if !ok {
+		return nil, sdn.ErrSubnetNotFound
+	}
+
+	g := &sdn.NATGateway{ID: uuid.NewString(), NetworkID: subnet.NetworkID, SubnetID: subnetID}
+	private, err := m.allocate(ctx, g.ID, subnet, "")
+	if err != nil {
+		return nil, err
+	}
+	public, err := m.ipam.AllocateIP(ctx, PublicPoolID)
+	if err != nil {
+		m.release(ctx, g.ID)
+		return nil, err
+	}
+	m.allocations[g.ID] = append(m.allocations[g.ID], public.ID)
+	g.PrivateIP, g.PublicIP = private.String(), public.IP
+
+	m.nats[g.ID] = g
+	m.hosts[g.NetworkID][private] = g.ID
+	cp := *g
+	return &cp, nil
+}
+
+// DeleteNATGateway removes a NAT gateway. Routes to it are kept and drop
+// traffic, like blackhole routes.
+func (m *MemoryNetworkManager) DeleteNATGateway(ctx context.Context, natGatewayID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	g, ok := m.nats[natGatewayID]
+	if !ok {
+		return sdn.ErrNATGatewayNotFound
+	}
+	delete(m.hosts[g.NetworkID], netip.MustParseAddr(g.PrivateIP))
+	delete(m.nats, natGatewayID)
+	m.release(ctx, natGatewayID)
+	return nil
+}
+
+// subnet finds a subnet by ID. The caller holds m.mu.
+func (m *MemoryNetworkManager) subnet(subnetID string) (sdn.Subnet, bool) {
+	for _, network := range m.networks {
+		for _, s := range network.Subnets {
+			if s.ID == subnetID {
+				return s, true
+			}
+		}
+	}
+	return sdn.Subnet{}, false
+}
+
+// allocate takes an address for owner from the subnet's pool: ip if set,
+// otherwise the next free one. The caller holds m.mu.
+func (m *MemoryNetworkManager) allocate(ctx context.Context, owner string, subnet sdn.Subnet, ip string) (netip.Addr, error) {
+	var alloc *dhcp.IPAllocation
+	var err error
+	if ip != "" {
+		addr, perr := netip.ParseAddr(ip)
+		if perr != nil || !netip.MustParsePrefix(subnet.CIDR).Contains(addr) {
+			return netip.Addr{}, errors.InvalidArgument("address "+ip+" is not in the subnet", perr)
+		}
+		alloc, err = m.ipam.ReserveIP(ctx, subnet.ID, addr.String())
+	} else {
+		alloc, err = m.ipam.AllocateIP(ctx, subnet.ID)
+	}
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	addr, err := netip.ParseAddr(alloc.IP)
+	if err != nil {
+		_ = m.ipam.ReleaseIP(ctx, alloc.ID)
+		return netip.Addr{}, errors.Internal("ipam returned an invalid address", err)
+	}
+	m.allocations[owner] = append(m.allocations[owner], alloc.ID)
+	return addr, nil
+}
+
+// release returns owner's addresses to the IPAM. The caller holds m.mu.
+func (m *MemoryNetworkManager) release(ctx context.Context, owner string) {
+	for _, id := range m.allocations[owner] {
+		_ = m.ipam.ReleaseIP(ctx, id)
+	}
+	delete(m.allocations, owner)
+}
+
+// hostRange returns the allocatable addresses of a subnet.
+func hostRange(p netip.Prefix) (netip.Addr, netip.Addr, bool) {
+	first := p.Addr().Next().Next()
+	last := lastAddr(p)
+	if p.Addr().Is4() {
+		last = last.Prev()
+	}
+	if !first.IsValid() || !last.IsValid() || last.Less(first) {
+		return netip.Addr{}, netip.Addr{}, false
+	}
+	return first, last, true
+}
+
+func lastAddr(p netip.Prefix) netip.Addr {
+	b := p.Addr().AsSlice()
+	for i := p.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+func copyInterface(i *sdn.Interface) *sdn.Interface {
+	cp := *i
+	cp.SecurityGroups = slices.Clone(i.SecurityGroups)
+	return &cp
+}
+
+func copyRouteTable(t *sdn.RouteTable) *sdn.RouteTable {
+	cp := *t
+	cp.Routes = slices.Clone(t.Routes)
+	cp.SubnetIDs = slices.Clone(t.SubnetIDs)
+	return &cp
+}
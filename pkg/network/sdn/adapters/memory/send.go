@@ -0,0 +1,196 @@
+package memory
+
+import (
+	"context"
+	"net/netip"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/firewall"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/firewall/engine"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/sdn"
+)
+
+// Send simulates delivering a packet from the interface with address srcIP
+// to dstIP. The packet is routed by the longest matching route of the
+// source subnet's route table; traffic leaving through a NAT gateway is
+// routed again by the gateway subnet's table, which must send it to the
+// internet. Security groups are checked outbound at the source and inbound
+// at the destination, and allowed flows are tracked so replies pass.
+// The protocol defaults to tcp.
+func (m *MemoryNetworkManager) Send(ctx context.Context, srcIP, dstIP string, packet sdn.Packet) (*sdn.Delivery, error) {
+	src, err := netip.ParseAddr(srcIP)
+	if err != nil {
+		return nil, errors.InvalidArgument("invalid source address", err)
+	}
+	dst, err := netip.ParseAddr(dstIP)
+	if err != nil {
+		return nil, errors.InvalidArgument("invalid destination address", err)
+	}
+	if packet.Protocol == "" {
+		packet.Protocol = firewall.ProtocolTCP
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	from, err := m.source(src)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &sdn.Delivery{SrcIP: src.String()}
+	route, ok := m.route(d, from.NetworkID, from.SubnetID, dst)
+	if !ok {
+		return drop(d, sdn.DropNoRoute), nil
+	}
+
+	var to *sdn.Interface
+	switch route.Target {
+	case sdn.RouteTargetLocal:
+		if to, ok = m.host(from.NetworkID, dst); !ok {
+			return drop(d, sdn.DropHostUnreachable), nil
+		}
+
+	case sdn.RouteTargetPeering:
+		p, ok := m.peerings[route.TargetID]
+		if !ok {
+			return drop(d, sdn.DropNoRoute), nil
+		}
+		peer := p.PeerNetworkID
+		if peer == from.NetworkID {
+			peer = p.NetworkID
+		}
+		// Peering carries traffic for the peer's own addresses only; it is
+		// not transitive.
+		if !netip.MustParsePrefix(m.networks[peer].CIDR).Contains(dst) {
+			return drop(d, sdn.DropNoRoute), nil
+		}
+		if to, ok = m.host(peer, dst); !ok {
+			return drop(d, sdn.DropHostUnreachable), nil
+		}
+
+	case sdn.RouteTargetNATGateway:
+		g, ok := m.nats[route.TargetID]
+		if !ok || g.NetworkID != from.NetworkID {
+			return drop(d, sdn.DropNoRoute), nil
+		}
+		next, ok := m.route(d, g.NetworkID, g.SubnetID, dst)
+		if !ok || next.Target != sdn.RouteTargetInternet {
+			return drop(d, sdn.DropNoRoute), nil
+		}
+		d.SrcIP = g.PublicIP
+
+	case sdn.RouteTargetInternet:
+		return drop(d, sdn.DropNoPublicIP), nil
+
+	default:
+		return drop(d, sdn.DropNoRoute), nil
+	}
+
+	allowed, err := m.allowed(ctx, from, firewall.DirectionOutbound, src, dst, packet)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return drop(d, sdn.DropFirewall), nil
+	}
+	if to != nil {
+		allowed, err := m.allowed(ctx, to, firewall.DirectionInbound, src, dst, packet)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			return drop(d, sdn.DropFirewall), nil
+		}
+		d.InterfaceID = to.ID
+	}
+
+	d.Delivered = true
+	return d, nil
+}
+
+// source finds the interface sending from addr, which must be unique
+// across networks. The caller holds m.mu.
+func (m *MemoryNetworkManager) source(addr netip.Addr) (*sdn.Interface, error) {
+	var found *sdn.Interface
+	for networkID := range m.hosts {
+		if i, ok := m.host(networkID, addr); ok {
+			if found != nil {
+				return nil, errors.InvalidArgument("source address "+addr.String()+" is in several networks", nil)
+			}
+			found = i
+		}
+	}
+	if found == nil {
+		return nil, sdn.ErrInterfaceNotFound
+	}
+	return found, nil
+}
+
+// host finds the interface with addr in a network. NAT gateway addresses
+// are not interfaces. The caller holds m.mu.
+func (m *MemoryNetworkManager) host(networkID string, addr netip.Addr) (*sdn.Interface, bool) {
+	i, ok := m.interfaces[m.hosts[networkID][addr]]
+	return i, ok
+}
+
+// route picks the longest route for dst from the subnet's route table,
+// recording the hop. The caller holds m.mu.
+func (m *MemoryNetworkManager) route(d *sdn.Delivery, networkID, subnetID string, dst netip.Addr) (sdn.Route, bool) {
+	var table *sdn.RouteTable
+	for _, t := range m.tables {
+		if t.NetworkID != networkID {
+			continue
+		}
+		for _, id := range t.SubnetIDs {
+			if id == subnetID {
+				table = t
+			}
+		}
+		if t.Main && table == nil {
+			table = t
+		}
+	}
+	if table == nil {
+		return sdn.Route{}, false
+	}
+
+	var best sdn.Route
+	bits := -1
+	for _, r := range table.Routes {
+		p := netip.MustParsePrefix(r.Destination)
+		if p.Contains(dst) && p.Bits() > bits {
+			best, bits = r, p.Bits()
+		}
+	}
+	if bits < 0 {
+		return sdn.Route{}, false
+	}
+	d.Hops = append(d.Hops, sdn.Hop{NetworkID: networkID, RouteTableID: table.ID, Route: best})
+	return best, true
+}
+
+// allowed checks a flow against the security groups of an interface.
+// Interfaces without security groups are not filtered.
+func (m *MemoryNetworkManager) allowed(ctx context.Context, i *sdn.Interface, direction string, src, dst netip.Addr, packet sdn.Packet) (bool, error) {
+	if m.fw == nil || len(i.SecurityGroups) == 0 {
+		return true, nil
+	}
+	decision, err := m.fw.Evaluate(ctx, i.ID, engine.Flow{
+		Direction: direction,
+		Protocol:  packet.Protocol,
+		SrcIP:     src,
+		SrcPort:   packet.SrcPort,
+		DstIP:     dst,
+		DstPort:   packet.DstPort,
+	})
+	if err != nil {
+		return false, err
+	}
+	return decision.Allowed, nil
+}
+
+func drop(d *sdn.Delivery, reason string) *sdn.Delivery {
+	d.Reason = reason
+	return d
+}
@@ -1,4 +1,11 @@
 // Package sdn provides management for Software Defined Networks.
 //
 // It handles the creation of isolated virtual networks (VPCs), subnets, and routing tables.
+//
+// The Overlay interface extends NetworkManager with the data plane: interfaces
+// with addresses allocated through a dhcp.IPAM, route tables matched by
+// longest prefix, peering between networks, NAT gateways, and a Send method
+// that simulates whether a packet reaches its destination. The memory
+// adapter implements it and enforces interface security groups with the
+// firewall engine.
 package sdn
@@ -14,4 +14,22 @@ var (
 
 	// ErrSubnetOverlap is returned when a new subnet overlaps with an existing one.
 	ErrSubnetOverlap = errors.InvalidArgument("subnet overlaps with existing subnet", nil)
+
+	// ErrInterfaceNotFound is returned when a requested interface or source address does not exist.
+	ErrInterfaceNotFound = errors.NotFound("interface not found", nil)
+
+	// ErrRouteTableNotFound is returned when a requested route table does not exist.
+	ErrRouteTableNotFound = errors.NotFound("route table not found", nil)
+
+	// ErrRouteNotFound is returned when a route table has no route for a destination.
+	ErrRouteNotFound = errors.NotFound("route not found", nil)
+
+	// ErrPeeringNotFound is returned when a requested peering connection does not exist.
+	ErrPeeringNotFound = errors.NotFound("peering not found", nil)
+
+	// ErrNATGatewayNotFound is returned when a requested NAT gateway does not exist.
+	ErrNATGatewayNotFound = errors.NotFound("nat gateway not found", nil)
+
+	// ErrResourceInUse is returned when deleting a resource that others still depend on.
+	ErrResourceInUse = errors.Conflict("resource in use", nil)
 )
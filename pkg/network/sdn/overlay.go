@@ -0,0 +1,166 @@
+package sdn
+
+import (
+	"context"
+)
+
+// Overlay is a NetworkManager that also models the data plane of its
+// networks: interfaces with addresses, route tables, peering, NAT gateways
+// and the delivery of packets between them.
+type Overlay interface {
+	NetworkManager
+
+	// CreateInterface attaches a network interface to a subnet, allocating
+	// its address unless the spec sets one.
+	CreateInterface(ctx context.Context, subnetID string, spec InterfaceSpec) (*Interface, error)
+
+	// DeleteInterface detaches an interface and releases its address.
+	DeleteInterface(ctx context.Context, interfaceID string) error
+
+	// CreateRouteTable adds a route table to a network. It applies to the
+	// subnets associated with it; other subnets use the network's main
+	// route table.
+	CreateRouteTable(ctx context.Context, networkID string, name string) (*RouteTable, error)
+
+	// GetRouteTable retrieves a route table.
+	GetRouteTable(ctx context.Context, tableID string) (*RouteTable, error)
+
+	// ListRouteTables lists the route tables of a network, main table
+	// first.
+	ListRouteTables(ctx context.Context, networkID string) ([]RouteTable, error)
+
+	// AddRoute adds a route to a route table.
+	AddRoute(ctx context.Context, tableID string, route Route) error
+
+	// RemoveRoute removes the route for a destination CIDR.
+	RemoveRoute(ctx context.Context, tableID string, destination string) error
+
+	// AssociateRouteTable makes a subnet use a route table.
+	AssociateRouteTable(ctx context.Context, tableID string, subnetID string) error
+
+	// CreatePeering connects two networks with non-overlapping CIDRs.
+	CreatePeering(ctx context.Context, networkID, peerNetworkID string) (*Peering, error)
+
+	// DeletePeering removes a peering connection.
+	DeletePeering(ctx context.Context, peeringID string) error
+
+	// CreateNATGateway adds a NAT gateway to a subnet, which is typically
+	// a public subnet routing to the internet.
+	CreateNATGateway(ctx context.Context, subnetID string) (*NATGateway, error)
+
+	// DeleteNATGateway removes a NAT gateway.
+	DeleteNATGateway(ctx context.Context, natGatewayID string) error
+
+	// Send simulates delivering a packet from the interface with address
+	// srcIP to dstIP.
+	Send(ctx context.Context, srcIP, dstIP string, packet Packet) (*Delivery, error)
+}
+
+// InterfaceSpec defines a network interface.
+type InterfaceSpec struct {
+	Name string `json:"name"`
+	// IP is a fixed address in the subnet; empty allocates one.
+	IP string `json:"ip,omitempty"`
+	// SecurityGroups are the firewall security groups applied to the
+	// interface.
+	SecurityGroups []string          `json:"security_groups,omitempty"`
+	Tags           map[string]string `json:"tags,omitempty"`
+}
+
+// Interface is a network interface attached to a subnet.
+type Interface struct {
+	ID             string            `json:"id"`
+	Name           string            `json:"name"`
+	NetworkID      string            `json:"network_id"`
+	SubnetID       string            `json:"subnet_id"`
+	IP             string            `json:"ip"`
+	SecurityGroups []string          `json:"security_groups,omitempty"`
+	Tags           map[string]string `json:"tags,omitempty"`
+}
+
+// Route targets.
+const (
+	// RouteTargetLocal delivers within the network. Every network's main
+	// route table has a local route for the network CIDR.
+	RouteTargetLocal = "local"
+	// RouteTargetPeering sends to a peered network; TargetID is the
+	// peering ID.
+	RouteTargetPeering = "peering"
+	// RouteTargetNATGateway sends through a NAT gateway of the network;
+	// TargetID is the gateway ID.
+	RouteTargetNATGateway = "nat-gateway"
+	// RouteTargetInternet leaves the overlay. Only NAT gateways can use
+	// it, since interfaces have no public addresses.
+	RouteTargetInternet = "internet"
+)
+
+// Route sends traffic for a destination CIDR to a target.
+type Route struct {
+	Destination string `json:"destination"`
+	Target      string `json:"target"`
+	TargetID    string `json:"target_id,omitempty"`
+}
+
+// RouteTable holds routes, matched by longest prefix.
+type RouteTable struct {
+	ID        string   `json:"id"`
+	NetworkID string   `json:"network_id"`
+	Name      string   `json:"name"`
+	Main      bool     `json:"main"`
+	Routes    []Route  `json:"routes"`
+	SubnetIDs []string `json:"subnet_ids,omitempty"`
+}
+
+// Peering connects two networks.
+type Peering struct {
+	ID            string `json:"id"`
+	NetworkID     string `json:"network_id"`
+	PeerNetworkID string `json:"peer_network_id"`
+}
+
+// NATGateway translates the private source addresses of outbound traffic
+// to its public address.
+type NATGateway struct {
+	ID        string `json:"id"`
+	NetworkID string `json:"network_id"`
+	SubnetID  string `json:"subnet_id"`
+	PrivateIP string `json:"private_ip"`
+	PublicIP  string `json:"public_ip"`
+}
+
+// Packet is the transport part of a simulated packet.
+type Packet struct {
+	Protocol string `json:"protocol"` // "tcp", "udp" or "icmp"
+	SrcPort  int    `json:"src_port,omitempty"`
+	DstPort  int    `json:"dst_port,omitempty"`
+	Payload  []byte `json:"payload,omitempty"`
+}
+
+// Reasons a packet is dropped.
+const (
+	DropNoRoute         = "no-route"
+	DropHostUnreachable = "host-unreachable"
+	DropFirewall        = "firewall"
+	DropNoPublicIP      = "no-public-ip"
+)
+
+// Delivery is the outcome of sending a packet.
+type Delivery struct {
+	Delivered bool `json:"delivered"`
+	// Reason is why the packet was dropped.
+	Reason string `json:"reason,omitempty"`
+	// Hops are the routing decisions taken, in order.
+	Hops []Hop `json:"hops"`
+	// SrcIP is the source address the receiver sees, after NAT.
+	SrcIP string `json:"src_ip"`
+	// InterfaceID is the receiving interface; it is empty for packets
+	// delivered to the internet.
+	InterfaceID string `json:"interface_id,omitempty"`
+}
+
+// Hop is a routing decision.
+type Hop struct {
+	NetworkID    string `json:"network_id"`
+	RouteTableID string `json:"route_table_id"`
+	Route        Route  `json:"route"`
+}
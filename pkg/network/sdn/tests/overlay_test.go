@@ -0,0 +1,281 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/dhcp"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/firewall"
+	fwmemory "github.com/chris-alexander-pop/system-design-library/pkg/network/firewall/adapters/memory"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/firewall/engine"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/sdn"
+	"github.com/chris-alexander-pop/system-design-library/pkg/network/sdn/adapters/memory"
+	"github.com/stretchr/testify/suite"
+)
+
+// OverlaySuite tests the overlay network of the memory SDN.
+type OverlaySuite struct {
+	suite.Suite
+	m   *memory.MemoryNetworkManager
+	fw  *engine.Engine
+	ctx context.Context
+}
+
+// SetupTest creates a network manager enforcing security groups.
+func (s *OverlaySuite) SetupTest() {
+	s.ctx = context.Background()
+	s.fw = engine.New(engine.Config{}, fwmemory.New())
+	s.m = memory.New(memory.WithFirewall(s.fw))
+}
+
+func (s *OverlaySuite) network(cidr string) string {
+	id, err := s.m.CreateNetwork(s.ctx, sdn.NetworkSpec{Name: cidr, CIDR: cidr})
+	s.Require().NoError(err)
+	return id
+}
+
+func (s *OverlaySuite) subnet(networkID, cidr string) string {
+	id, err := s.m.CreateSubnet(s.ctx, networkID, sdn.SubnetSpec{Name: cidr, CIDR: cidr})
+	s.Require().NoError(err)
+	return id
+}
+
+func (s *OverlaySuite) iface(subnetID string, spec sdn.InterfaceSpec) *sdn.Interface {
+	i, err := s.m.CreateInterface(s.ctx, subnetID, spec)
+	s.Require().NoError(err)
+	return i
+}
+
+func (s *OverlaySuite) send(src, dst string, packet sdn.Packet) *sdn.Delivery {
+	d, err := s.m.Send(s.ctx, src, dst, packet)
+	s.Require().NoError(err)
+	return d
+}
+
+func (s *OverlaySuite) mainTable(networkID string) *sdn.RouteTable {
+	tables, err := s.m.ListRouteTables(s.ctx, networkID)
+	s.Require().NoError(err)
+	s.Require().NotEmpty(tables)
+	s.Require().True(tables[0].Main, "the main table comes first")
+	return &tables[0]
+}
+
+// dropped asserts that d was not delivered, for reason.
+func (s *OverlaySuite) dropped(d *sdn.Delivery, reason, msg string) {
+	s.False(d.Delivered, "%s: %+v", msg, d)
+	s.Equal(reason, d.Reason, msg)
+}
+
+func (s *OverlaySuite) TestAllocatesAddresses() {
+	vpc := s.network("10.0.0.0/16")
+	subnet := s.subnet(vpc, "10.0.1.0/29")
+
+	// .0 is the network, .1 the gateway and .7 the broadcast address.
+	var got []string
+	var first *sdn.Interface
+	for i := 0; i < 4; i++ {
+		iface := s.iface(subnet, sdn.InterfaceSpec{})
+		if first == nil {
+			first = iface
+		}
+		got = append(got, iface.IP)
+	}
+	s.Require().Equal([]string{"10.0.1.2", "10.0.1.3", "10.0.1.4", "10.0.1.5"}, got)
+
+	fixed := s.iface(subnet, sdn.InterfaceSpec{IP: "10.0.1.6"})
+	s.Equal("10.0.1.6", fixed.IP)
+	_, err := s.m.CreateInterface(s.ctx, subnet, sdn.InterfaceSpec{})
+	s.True(errors.Is(err, dhcp.ErrIPExhausted), "full subnet: got %v", err)
+	_, err = s.m.CreateInterface(s.ctx, subnet, sdn.InterfaceSpec{IP: "10.0.2.6"})
+	s.Error(err, "address outside the subnet")
+
+	err = s.m.DeleteSubnet(s.ctx, subnet)
+	s.True(errors.Is(err, sdn.ErrResourceInUse), "DeleteSubnet with interfaces: got %v", err)
+	s.Require().NoError(s.m.DeleteInterface(s.ctx, first.ID))
+	s.Equal(first.IP, s.iface(subnet, sdn.InterfaceSpec{}).IP, "released address reused")
+}
+
+func (s *OverlaySuite) TestValidatesSubnets() {
+	vpc := s.network("10.0.0.0/16")
+	s.subnet(vpc, "10.0.1.0/24")
+
+	_, err := s.m.CreateSubnet(s.ctx, vpc, sdn.SubnetSpec{CIDR: "10.0.1.128/25"})
+	s.True(errors.Is(err, sdn.ErrSubnetOverlap), "overlapping subnet: got %v", err)
+	_, err = s.m.CreateSubnet(s.ctx, vpc, sdn.SubnetSpec{CIDR: "10.1.0.0/24"})
+	s.Error(err, "subnet outside the network")
+	_, err = s.m.CreateSubnet(s.ctx, vpc, sdn.SubnetSpec{CIDR: "10.0.0.0/8"})
+	s.Error(err, "subnet larger than the network")
+}
+
+func (s *OverlaySuite) TestRoutesLocally() {
+	vpc := s.network("10.0.0.0/16")
+	a := s.iface(s.subnet(vpc, "10.0.1.0/24"), sdn.InterfaceSpec{})
+	b := s.iface(s.subnet(vpc, "10.0.2.0/24"), sdn.InterfaceSpec{})
+
+	d := s.send(a.IP, b.IP, sdn.Packet{DstPort: 80})
+	s.Require().True(d.Delivered, "%+v", d)
+	s.Equal(b.ID, d.InterfaceID)
+	s.Equal(a.IP, d.SrcIP)
+	s.Require().Len(d.Hops, 1)
+	s.Equal(sdn.RouteTargetLocal, d.Hops[0].Route.Target)
+
+	s.dropped(s.send(a.IP, "10.0.2.200", sdn.Packet{}), sdn.DropHostUnreachable, "unknown host")
+	s.dropped(s.send(a.IP, "172.16.0.1", sdn.Packet{}), sdn.DropNoRoute, "outside the network")
+	_, err := s.m.Send(s.ctx, "10.0.9.9", b.IP, sdn.Packet{})
+	s.True(errors.Is(err, sdn.ErrInterfaceNotFound), "unknown source: got %v", err)
+}
+
+func (s *OverlaySuite) TestLongestPrefixMatch() {
+	vpc := s.network("10.0.0.0/16")
+	public := s.subnet(vpc, "10.0.0.0/24")
+	private := s.subnet(vpc, "10.0.1.0/24")
+	nat, err := s.m.CreateNATGateway(s.ctx, public)
+	s.Require().NoError(err)
+	a := s.iface(private, sdn.InterfaceSpec{})
+
+	main := s.mainTable(vpc)
+	s.Require().NoError(s.m.AddRoute(s.ctx, main.ID, sdn.Route{Destination: "0.0.0.0/0", Target: sdn.RouteTargetInternet}))
+
+	rt, err := s.m.CreateRouteTable(s.ctx, vpc, "private")
+	s.Require().NoError(err)
+	s.Require().NoError(s.m.AddRoute(s.ctx, rt.ID, sdn.Route{Destination: "0.0.0.0/0", Target: sdn.RouteTargetNATGateway, TargetID: nat.ID}))
+	s.Require().NoError(s.m.AddRoute(s.ctx, rt.ID, sdn.Route{Destination: "203.0.113.0/24", Target: sdn.RouteTargetInternet}))
+	s.Require().NoError(s.m.AssociateRouteTable(s.ctx, rt.ID, private))
+
+	// The /24 internet route beats the default route to the gateway, and
+	// the interface has no public address to use it.
+	s.dropped(s.send(a.IP, "203.0.113.5", sdn.Packet{}), sdn.DropNoPublicIP, "more specific route")
+
+	// Everything else leaves through the NAT gateway.
+	d := s.send(a.IP, "8.8.8.8", sdn.Packet{Protocol: firewall.ProtocolUDP, DstPort: 53})
+	s.Require().True(d.Delivered, "via nat: %+v", d)
+	s.Equal(nat.PublicIP, d.SrcIP)
+	s.Empty(d.InterfaceID)
+	s.Require().Len(d.Hops, 2)
+	s.Equal(rt.ID, d.Hops[0].RouteTableID)
+	s.Equal(main.ID, d.Hops[1].RouteTableID)
+
+	// The vpc route is still local.
+	d = s.send(a.IP, nat.PrivateIP, sdn.Packet{})
+	s.Equal(sdn.RouteTargetLocal, d.Hops[0].Route.Target, "local route preferred")
+
+	s.Require().NoError(s.m.RemoveRoute(s.ctx, main.ID, "0.0.0.0/0"))
+	s.dropped(s.send(a.IP, "8.8.8.8", sdn.Packet{}), sdn.DropNoRoute, "gateway without internet route")
+	s.Error(s.m.RemoveRoute(s.ctx, rt.ID, "10.0.0.0/16"), "removed the local route")
+	err = s.m.RemoveRoute(s.ctx, rt.ID, "192.168.0.0/16")
+	s.True(errors.Is(err, sdn.ErrRouteNotFound), "RemoveRoute missing: got %v", err)
+}
+
+func (s *OverlaySuite) TestPeering() {
+	vpcA := s.network("10.0.0.0/16")
+	vpcB := s.network("10.1.0.0/16")
+	vpcC := s.network("10.2.0.0/16")
+	a := s.iface(s.subnet(vpcA, "10.0.1.0/24"), sdn.InterfaceSpec{})
+	b := s.iface(s.subnet(vpcB, "10.1.1.0/24"), sdn.InterfaceSpec{})
+	c := s.iface(s.subnet(vpcC, "10.2.1.0/24"), sdn.InterfaceSpec{})
+
+	s.dropped(s.send(a.IP, b.IP, sdn.Packet{}), sdn.DropNoRoute, "before peering")
+
+	ab, err := s.m.CreatePeering(s.ctx, vpcA, vpcB)
+	s.Require().NoError(err)
+	bc, err := s.m.CreatePeering(s.ctx, vpcB, vpcC)
+	s.Require().NoError(err)
+	mainA, mainB := s.mainTable(vpcA), s.mainTable(vpcB)
+	for _, r := range []struct {
+		table string
+		route sdn.Route
+	}{
+		{mainA.ID, sdn.Route{Destination: "10.1.0.0/16", Target: sdn.RouteTargetPeering, TargetID: ab.ID}},
+		// A tries to reach C through B.
+		{mainA.ID, sdn.Route{Destination: "10.2.0.0/16", Target: sdn.RouteTargetPeering, TargetID: ab.ID}},
+		{mainB.ID, sdn.Route{Destination: "10.0.0.0/16", Target: sdn.RouteTargetPeering, TargetID: ab.ID}},
+		{mainB.ID, sdn.Route{Destination: "10.2.0.0/16", Target: sdn.RouteTargetPeering, TargetID: bc.ID}},
+	} {
+		s.Require().NoError(s.m.AddRoute(s.ctx, r.table, r.route))
+	}
+
+	for _, tt := range []struct {
+		name     string
+		src, dst *sdn.Interface
+	}{
+		{"a to b", a, b},
+		{"b to a", b, a},
+		{"b to c", b, c},
+	} {
+		d := s.send(tt.src.IP, tt.dst.IP, sdn.Packet{})
+		s.True(d.Delivered, "%s: %+v", tt.name, d)
+		s.Equal(tt.dst.ID, d.InterfaceID, tt.name)
+	}
+	// Peering is not transitive.
+	s.dropped(s.send(a.IP, c.IP, sdn.Packet{}), sdn.DropNoRoute, "a to c")
+
+	err = s.m.AddRoute(s.ctx, mainA.ID, sdn.Route{Destination: "10.3.0.0/16", Target: sdn.RouteTargetPeering, TargetID: bc.ID})
+	s.Error(err, "route to a peering of another network")
+	s.Require().NoError(s.m.DeletePeering(s.ctx, ab.ID))
+	s.dropped(s.send(a.IP, b.IP, sdn.Packet{}), sdn.DropNoRoute, "after deleting the peering")
+
+	overlap := s.network("10.0.128.0/17")
+	_, err = s.m.CreatePeering(s.ctx, vpcA, overlap)
+	s.Error(err, "peering overlapping networks")
+}
+
+func (s *OverlaySuite) TestEnforcesSecurityGroups() {
+	web, err := s.fw.CreateSecurityGroup(s.ctx, firewall.SecurityGroupSpec{Name: "web"})
+	s.Require().NoError(err)
+	app, err := s.fw.CreateSecurityGroup(s.ctx, firewall.SecurityGroupSpec{Name: "app"})
+	s.Require().NoError(err)
+	s.Require().NoError(s.fw.AddRule(s.ctx, web, firewall.Rule{Direction: firewall.DirectionOutbound, Protocol: firewall.ProtocolAny}))
+	s.Require().NoError(s.fw.AddRule(s.ctx, app, firewall.Rule{Direction: firewall.DirectionInbound, Protocol: firewall.ProtocolTCP, PortStart: 8080, SourceGroup: web}))
+
+	vpc := s.network("10.0.0.0/16")
+	subnet := s.subnet(vpc, "10.0.1.0/24")
+	w := s.iface(subnet, sdn.InterfaceSpec{SecurityGroups: []string{web}})
+	a := s.iface(subnet, sdn.InterfaceSpec{SecurityGroups: []string{app}})
+	open := s.iface(subnet, sdn.InterfaceSpec{})
+
+	request := sdn.Packet{Protocol: firewall.ProtocolTCP, SrcPort: 40000, DstPort: 8080}
+	s.True(s.send(w.IP, a.IP, request).Delivered, "web to app")
+	reply := sdn.Packet{Protocol: firewall.ProtocolTCP, SrcPort: 8080, DstPort: 40000}
+	s.True(s.send(a.IP, w.IP, reply).Delivered, "reply to a tracked connection")
+	s.dropped(s.send(w.IP, a.IP, sdn.Packet{Protocol: firewall.ProtocolTCP, SrcPort: 40001, DstPort: 22}), sdn.DropFirewall, "web to app ssh")
+	s.dropped(s.send(open.IP, a.IP, request), sdn.DropFirewall, "ungrouped to app")
+	// App has no outbound rules.
+	s.dropped(s.send(a.IP, open.IP, request), sdn.DropFirewall, "app outbound")
+	s.False(s.send(open.IP, w.IP, request).Delivered, "ungrouped to web")
+
+	nofw := memory.New()
+	nofwVPC, _ := nofw.CreateNetwork(s.ctx, sdn.NetworkSpec{CIDR: "10.0.0.0/16"})
+	nofwSubnet, _ := nofw.CreateSubnet(s.ctx, nofwVPC, sdn.SubnetSpec{CIDR: "10.0.1.0/24"})
+	_, err = nofw.CreateInterface(s.ctx, nofwSubnet, sdn.InterfaceSpec{SecurityGroups: []string{web}})
+	s.Error(err, "security groups without a firewall")
+}
+
+func (s *OverlaySuite) TestNATGatewayLifecycle() {
+	vpc := s.network("10.0.0.0/16")
+	public := s.subnet(vpc, "10.0.0.0/24")
+
+	g1, err := s.m.CreateNATGateway(s.ctx, public)
+	s.Require().NoError(err)
+	g2, err := s.m.CreateNATGateway(s.ctx, public)
+	s.Require().NoError(err)
+	s.NotEqual(g1.PublicIP, g2.PublicIP)
+	s.NotEqual(g1.PrivateIP, g2.PrivateIP)
+
+	err = s.m.DeleteSubnet(s.ctx, public)
+	s.True(errors.Is(err, sdn.ErrResourceInUse), "DeleteSubnet with gateways: got %v", err)
+	err = s.m.DeleteNetwork(s.ctx, vpc)
+	s.True(errors.Is(err, sdn.ErrResourceInUse), "DeleteNetwork with gateways: got %v", err)
+	for _, g := range []*sdn.NATGateway{g1, g2} {
+		s.Require().NoError(s.m.DeleteNATGateway(s.ctx, g.ID))
+	}
+	err = s.m.DeleteNATGateway(s.ctx, g1.ID)
+	s.True(errors.Is(err, sdn.ErrNATGatewayNotFound), "DeleteNATGateway twice: got %v", err)
+	s.NoError(s.m.DeleteSubnet(s.ctx, public))
+	s.NoError(s.m.DeleteNetwork(s.ctx, vpc))
+}
+
+// TestOverlaySuite runs the test suite.
+func TestOverlaySuite(t *testing.T) {
+	suite.Run(t, new(OverlaySuite))
+}
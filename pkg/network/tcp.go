@@ -56,8 +56,9 @@ func (s *TCPServer) ListenAndServe(ctx context.Context) error {
 
 		go func(c net.Conn) {
 			defer c.Close()
-			// Set timeouts if configured? (Advanced, not in basic req but good practice)
-			_ = c.SetDeadline(time.Now().Add(s.cfg.ReadTimeout))
+			if s.cfg.ReadTimeout > 0 {
+				_ = c.SetDeadline(time.Now().Add(s.cfg.ReadTimeout))
+			}
 			s.Handler(c)
 		}(conn)
 	}
@@ -3,7 +3,9 @@ package network
 import (
 	"context"
 	"net"
+	"sync"
 
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
 	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
 )
 
@@ -13,6 +15,13 @@ type UDPServer struct {
 	cfg        Config
 	Handler    UDPHandler
 	BufferSize int
+
+	// ListenConfig opens the socket; its Control hook can set socket
+	// options such as SO_BROADCAST.
+	ListenConfig net.ListenConfig
+
+	mu sync.RWMutex
+	pc net.PacketConn
 }
 
 func NewUDPServer(cfg Config, handler UDPHandler) *UDPServer {
@@ -24,12 +33,21 @@ func NewUDPServer(cfg Config, handler UDPHandler) *UDPServer {
 }
 
 func (s *UDPServer) ListenAndServe(ctx context.Context) error {
-	pc, err := net.ListenPacket("udp", s.cfg.Addr)
+	pc, err := s.ListenConfig.ListenPacket(ctx, "udp", s.cfg.Addr)
 	if err != nil {
 		return err
 	}
 	defer pc.Close()
 
+	s.mu.Lock()
+	s.pc = pc
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.pc = nil
+		s.mu.Unlock()
+	}()
+
 	logger.L().InfoContext(ctx, "started udp server", "addr", s.cfg.Addr)
 
 	go func() {
@@ -57,3 +75,15 @@ func (s *UDPServer) ListenAndServe(ctx context.Context) error {
 		go s.Handler(addr, data)
 	}
 }
+
+// WriteTo sends data to addr from the server's socket, so that a handler can
+// reply to the packet it received.
+func (s *UDPServer) WriteTo(data []byte, addr net.Addr) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.pc == nil {
+		return 0, errors.Internal("udp server is not listening", nil)
+	}
+	return s.pc.WriteTo(data, addr)
+}
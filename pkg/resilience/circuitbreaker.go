@@ -2,13 +2,18 @@ package resilience
 
 import (
 	"context"
+	"sync"
 	"sync/atomic"
 	"time"
+	"weak"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/concurrency"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
 	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 )
 
 // Error codes for circuit breaker
@@ -52,6 +57,7 @@ func NewCircuitBreaker(cfg CircuitBreakerConfig) *CircuitBreaker {
 		mu:     concurrency.NewSmartRWMutex(concurrency.MutexConfig{Name: "CircuitBreaker-" + cfg.Name}),
 	}
 	cb.state.Store(StateClosed)
+	registerBreaker(cb)
 	return cb
 }
 
@@ -201,3 +207,54 @@ type CircuitBreakerMetrics struct {
 	Successes   int64
 	LastFailure time.Time
 }
+
+// breakers holds every live circuit breaker for the
+// resilience.circuit_breaker.state gauge. Weak pointers keep the gauge from
+// holding on to breakers that are no longer used.
+var breakers struct {
+	once sync.Once
+	mu   sync.Mutex
+	list []weak.Pointer[CircuitBreaker]
+}
+
+func registerBreaker(cb *CircuitBreaker) {
+	breakers.once.Do(func() {
+		_, _ = otel.Meter("pkg/resilience").Int64ObservableGauge("resilience.circuit_breaker.state",
+			metric.WithDescription("Circuit breaker state: 0 closed, 1 half-open, 2 open"),
+			metric.WithInt64Callback(observeBreakers))
+	})
+
+	breakers.mu.Lock()
+	breakers.list = append(breakers.list, weak.Make(cb))
+	breakers.mu.Unlock()
+}
+
+func observeBreakers(_ context.Context, o metric.Int64Observer) error {
+	breakers.mu.Lock()
+	defer breakers.mu.Unlock()
+
+	live := breakers.list[:0]
+	for _, p := range breakers.list {
+		cb := p.Value()
+		if cb == nil {
+			continue
+		}
+		live = append(live, p)
+		o.Observe(stateValue(cb.State()), metric.WithAttributes(attribute.String("name", cb.config.Name)))
+	}
+	clear(breakers.list[len(live):])
+	breakers.list = live
+	return nil
+}
+
+// stateValue maps a state to the value reported by the state gauge.
+func stateValue(s State) int64 {
+	switch s {
+	case StateHalfOpen:
+		return 1
+	case StateOpen:
+		return 2
+	default:
+		return 0
+	}
+}
@@ -5,7 +5,7 @@ import (
 	"time"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
-	"go.opentelemetry.io/otel"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -20,7 +20,7 @@ type InstrumentedVerifier struct {
 func NewInstrumentedVerifier(next Verifier) *InstrumentedVerifier {
 	return &InstrumentedVerifier{
 		next:   next,
-		tracer: otel.Tracer("pkg/security/captcha"),
+		tracer: instrument.NewTracer("pkg/security/captcha"),
 	}
 }
 
@@ -5,7 +5,7 @@ import (
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
 	"github.com/chris-alexander-pop/system-design-library/pkg/security/iam"
-	"go.opentelemetry.io/otel"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
@@ -21,7 +21,7 @@ type InstrumentedIdentityProvider struct {
 func NewInstrumentedIdentityProvider(next IdentityProvider) *InstrumentedIdentityProvider {
 	return &InstrumentedIdentityProvider{
 		next:   next,
-		tracer: otel.Tracer("pkg/iam/provider"),
+		tracer: instrument.NewTracer("pkg/iam/provider"),
 	}
 }
 
@@ -7,7 +7,7 @@ import (
 	"time"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
-	"go.opentelemetry.io/otel"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
@@ -15,15 +15,17 @@ import (
 
 // InstrumentedStore wraps a Store with logging and tracing
 type InstrumentedStore struct {
-	next Store
-	name string
+	next   Store
+	name   string
+	tracer trace.Tracer
 }
 
 // NewInstrumentedStore creates a new decorator
 func NewInstrumentedStore(store Store, name string) *InstrumentedStore {
 	return &InstrumentedStore{
-		next: store,
-		name: name,
+		next:   store,
+		name:   name,
+		tracer: instrument.NewTracer("pkg/blob"),
 	}
 }
 
@@ -91,6 +93,5 @@ func (s *InstrumentedStore) URL(key string) string {
 }
 
 func (s *InstrumentedStore) startSpan(ctx context.Context, op string) (context.Context, trace.Span) {
-	tracer := otel.Tracer("pkg/blob")
-	return tracer.Start(ctx, fmt.Sprintf("%s.%s", s.name, op))
+	return s.tracer.Start(ctx, fmt.Sprintf("%s.%s", s.name, op))
 }
@@ -6,7 +6,7 @@ import (
 	"time"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
-	"go.opentelemetry.io/otel"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
@@ -24,7 +24,7 @@ func NewInstrumentedStore(store VolumeStore, name string) *InstrumentedStore {
 	return &InstrumentedStore{
 		next:   store,
 		name:   name,
-		tracer: otel.Tracer("pkg/storage/block"),
+		tracer: instrument.NewTracer("pkg/storage/block"),
 	}
 }
 
@@ -7,7 +7,7 @@ import (
 	"time"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
-	"go.opentelemetry.io/otel"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
@@ -25,7 +25,7 @@ func NewInstrumentedStore(store FileStore, name string) *InstrumentedStore {
 	return &InstrumentedStore{
 		next:   store,
 		name:   name,
-		tracer: otel.Tracer("pkg/storage/file"),
+		tracer: instrument.NewTracer("pkg/storage/file"),
 	}
 }
 
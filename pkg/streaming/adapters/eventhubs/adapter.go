@@ -2,9 +2,11 @@ package eventhubs
 
 import (
 	"context"
+	"errors"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs"
+	"github.com/chris-alexander-pop/system-design-library/pkg/streaming"
 )
 
 type Adapter struct {
@@ -44,6 +46,80 @@ func (a *Adapter) PutRecord(ctx context.Context, streamName string, partitionKey
 	return a.client.SendEventDataBatch(ctx, batch, nil)
 }
 
+// PutRecords sends entries in as few batches as possible. A batch carries a
+// single partition key, so entries are grouped by key (keeping their order
+// within a key) and a group is split whenever a batch reaches its size limit.
+// Each batch succeeds or fails as a whole.
+func (a *Adapter) PutRecords(ctx context.Context, streamName string, entries []streaming.Entry) ([]error, error) {
+	var keys []string
+	groups := make(map[string][]int)
+	for i, e := range entries {
+		if _, ok := groups[e.PartitionKey]; !ok {
+			keys = append(keys, e.PartitionKey)
+		}
+		groups[e.PartitionKey] = append(groups[e.PartitionKey], i)
+	}
+
+	errs := make([]error, len(entries))
+	for _, key := range keys {
+		idx := groups[key]
+		for len(idx) > 0 {
+			n, err := a.sendBatch(ctx, key, entries, idx, errs)
+			if err != nil {
+				for _, i := range idx[:n] {
+					if errs[i] == nil {
+						errs[i] = err
+					}
+				}
+			}
+			idx = idx[n:]
+		}
+	}
+	return errs, nil
+}
+
+// sendBatch sends as many of the entries at idx as fit in one batch and
+// returns how many it consumed. An entry too large for any batch is marked
+// failed in errs and skipped.
+func (a *Adapter) sendBatch(ctx context.Context, partitionKey string, entries []streaming.Entry, idx []int, errs []error) (int, error) {
+	batch, err := a.client.NewEventDataBatch(ctx, &azeventhubs.EventDataBatchOptions{
+		PartitionKey: &partitionKey,
+	})
+	if err != nil {
+		return len(idx), err
+	}
+
+	n := 0
+	for ; n < len(idx); n++ {
+		err := batch.AddEventData(eventData(entries[idx[n]]), nil)
+		if errors.Is(err, azeventhubs.ErrEventDataTooLarge) && batch.NumEvents() > 0 {
+			break
+		}
+		if err != nil {
+			errs[idx[n]] = err
+		}
+	}
+	if batch.NumEvents() == 0 {
+		return n, nil
+	}
+	return n, a.client.SendEventDataBatch(ctx, batch, nil)
+}
+
+// eventData converts an entry to an event, carrying its headers as
+// application properties.
+func eventData(e streaming.Entry) *azeventhubs.EventData {
+	ev := &azeventhubs.EventData{Body: e.Data}
+	if len(e.Headers) > 0 {
+		ev.Properties = make(map[string]any, len(e.Headers))
+		for k, v := range e.Headers {
+			ev.Properties[k] = v
+		}
+	}
+	return ev
+}
+
 func (a *Adapter) Close() error {
 	return a.client.Close(context.Background())
 }
+
+var _ streaming.BatchClient = (*Adapter)(nil)
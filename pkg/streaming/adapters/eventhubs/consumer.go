@@ -0,0 +1,186 @@
+package eventhubs
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs"
+	"github.com/chris-alexander-pop/system-design-library/pkg/streaming"
+)
+
+// receiveTimeout bounds how long ReadRecords waits for events to arrive.
+const receiveTimeout = time.Second
+
+// Consumer implements streaming.Consumer for one event hub and consumer
+// group. Partitions play the role of shards.
+type Consumer struct {
+	client *azeventhubs.ConsumerClient
+
+	mu      sync.Mutex
+	readers map[string]*partitionReader
+}
+
+// partitionReader keeps a partition link open between ReadRecords calls as
+// long as callers continue from where the previous call stopped.
+type partitionReader struct {
+	client *azeventhubs.PartitionClient
+	next   streaming.Position
+}
+
+// NewConsumer creates a consumer for eventHub in the given namespace. An
+// empty consumerGroup selects the default group.
+func NewConsumer(namespace, eventHub, consumerGroup string) (*Consumer, error) {
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, err
+	}
+	if consumerGroup == "" {
+		consumerGroup = azeventhubs.DefaultConsumerGroup
+	}
+
+	client, err := azeventhubs.NewConsumerClient(namespace+".servicebus.windows.net", eventHub, consumerGroup, cred, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Consumer{client: client, readers: make(map[string]*partitionReader)}, nil
+}
+
+// ListShards returns the partitions of the event hub. streamName is ignored
+// because the consumer is bound to a single hub.
+func (c *Consumer) ListShards(ctx context.Context, _ string) ([]streaming.Shard, error) {
+	props, err := c.client.GetEventHubProperties(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	shards := make([]streaming.Shard, len(props.PartitionIDs))
+	for i, id := range props.PartitionIDs {
+		shards[i] = streaming.Shard{ID: id}
+	}
+	return shards, nil
+}
+
+// ReadRecords receives up to limit events from a partition, waiting at most
+// one second for them to arrive.
+func (c *Consumer) ReadRecords(ctx context.Context, streamName, partitionID string, from streaming.Position, limit int) (*streaming.ReadOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r, err := c.reader(ctx, partitionID, from)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = 100
+	}
+
+	rctx, cancel := context.WithTimeout(ctx, receiveTimeout)
+	events, err := r.client.ReceiveEvents(rctx, limit, nil)
+	cancel()
+	if err != nil && (ctx.Err() != nil || !errors.Is(err, context.DeadlineExceeded)) {
+		c.closeReader(ctx, partitionID)
+		return nil, err
+	}
+
+	out := &streaming.ReadOutput{Next: from}
+	for _, e := range events {
+		rec := streaming.Record{
+			Stream:         streamName,
+			ShardID:        partitionID,
+			SequenceNumber: strconv.FormatInt(e.SequenceNumber, 10),
+			Data:           e.Body,
+		}
+		if e.PartitionKey != nil {
+			rec.PartitionKey = *e.PartitionKey
+		}
+		if e.EnqueuedTime != nil {
+			rec.Timestamp = *e.EnqueuedTime
+		}
+		for k, v := range e.Properties {
+			if str, ok := v.(string); ok {
+				if rec.Headers == nil {
+					rec.Headers = make(map[string]string)
+				}
+				rec.Headers[k] = str
+			}
+		}
+		out.Records = append(out.Records, rec)
+	}
+	if n := len(out.Records); n > 0 {
+		out.Next = streaming.AfterSequence(out.Records[n-1].SequenceNumber)
+	}
+	r.next = out.Next
+	return out, nil
+}
+
+// reader returns an open partition client positioned at from.
+func (c *Consumer) reader(ctx context.Context, partitionID string, from streaming.Position) (*partitionReader, error) {
+	if r, ok := c.readers[partitionID]; ok {
+		if r.next.Type == from.Type && r.next.SequenceNumber == from.SequenceNumber && r.next.Timestamp.Equal(from.Timestamp) {
+			return r, nil
+		}
+		c.closeReader(ctx, partitionID)
+	}
+
+	start, err := startPosition(from)
+	if err != nil {
+		return nil, err
+	}
+	pc, err := c.client.NewPartitionClient(partitionID, &azeventhubs.PartitionClientOptions{StartPosition: start})
+	if err != nil {
+		return nil, err
+	}
+	r := &partitionReader{client: pc, next: from}
+	c.readers[partitionID] = r
+	return r, nil
+}
+
+func (c *Consumer) closeReader(ctx context.Context, partitionID string) {
+	if r, ok := c.readers[partitionID]; ok {
+		r.client.Close(ctx)
+		delete(c.readers, partitionID)
+	}
+}
+
+func startPosition(from streaming.Position) (azeventhubs.StartPosition, error) {
+	var start azeventhubs.StartPosition
+	switch from.Type {
+	case streaming.PositionOldest:
+		earliest := true
+		start.Earliest = &earliest
+	case streaming.PositionLatest:
+		latest := true
+		start.Latest = &latest
+	case streaming.PositionAtSequence, streaming.PositionAfterSequence:
+		seq, err := strconv.ParseInt(from.SequenceNumber, 10, 64)
+		if err != nil {
+			return start, streaming.ErrInvalidPosition
+		}
+		start.SequenceNumber = &seq
+		start.Inclusive = from.Type == streaming.PositionAtSequence
+	case streaming.PositionAtTimestamp:
+		t := from.Timestamp
+		start.EnqueuedTime = &t
+		start.Inclusive = true
+	default:
+		return start, streaming.ErrInvalidPosition
+	}
+	return start, nil
+}
+
+// Close closes all open partition links and the consumer client.
+func (c *Consumer) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ctx := context.Background()
+	for id := range c.readers {
+		c.closeReader(ctx, id)
+	}
+	return c.client.Close(ctx)
+}
+
+var _ streaming.Consumer = (*Consumer)(nil)
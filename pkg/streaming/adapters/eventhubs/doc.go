@@ -1,4 +1,6 @@
-// Package eventhubs provides functionality for eventhubs.
+// Package eventhubs provides an Azure Event Hubs streaming backend.
 //
-// TODO: Add detailed documentation.
+// Adapter implements streaming.Client on an event hub producer, and Consumer
+// implements streaming.Consumer on a consumer group, exposing partitions as
+// shards and event sequence numbers as record sequence numbers.
 package eventhubs
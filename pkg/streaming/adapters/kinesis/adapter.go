@@ -2,10 +2,14 @@ package kinesis
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/chris-alexander-pop/system-design-library/pkg/streaming"
 )
 
 type Adapter struct {
@@ -31,6 +35,147 @@ func (a *Adapter) PutRecord(ctx context.Context, streamName, partitionKey string
 	return err
 }
 
+// PutRecords writes up to 500 entries in one PutRecords request. Kinesis
+// accepts or rejects each record separately, typically throttling a few when
+// a shard is over its write limit; those are reported per entry.
+func (a *Adapter) PutRecords(ctx context.Context, streamName string, entries []streaming.Entry) ([]error, error) {
+	in := &kinesis.PutRecordsInput{
+		StreamName: aws.String(streamName),
+		Records:    make([]types.PutRecordsRequestEntry, len(entries)),
+	}
+	for i, e := range entries {
+		in.Records[i] = types.PutRecordsRequestEntry{
+			PartitionKey: aws.String(e.PartitionKey),
+			Data:         e.Data,
+		}
+	}
+
+	out, err := a.client.PutRecords(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+
+	errs := make([]error, len(entries))
+	for i, r := range out.Records {
+		if i < len(errs) && r.ErrorCode != nil {
+			errs[i] = fmt.Errorf("kinesis: %s: %s", aws.ToString(r.ErrorCode), aws.ToString(r.ErrorMessage))
+		}
+	}
+	return errs, nil
+}
+
 func (a *Adapter) Close() error {
 	return nil
 }
+
+// ListShards returns all shards of the stream, including closed parents of
+// resharded shards that may still hold unread records.
+func (a *Adapter) ListShards(ctx context.Context, streamName string) ([]streaming.Shard, error) {
+	var (
+		shards []streaming.Shard
+		next   *string
+	)
+	for {
+		in := &kinesis.ListShardsInput{NextToken: next}
+		if next == nil {
+			in.StreamName = aws.String(streamName)
+		}
+		out, err := a.client.ListShards(ctx, in)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range out.Shards {
+			shards = append(shards, streaming.Shard{
+				ID:       aws.ToString(s.ShardId),
+				ParentID: aws.ToString(s.ParentShardId),
+			})
+		}
+		if out.NextToken == nil {
+			return shards, nil
+		}
+		next = out.NextToken
+	}
+}
+
+// ReadRecords reads up to limit records from a shard. The returned position
+// carries the next shard iterator; if it has expired, a new iterator is
+// requested from the position's sequence number or type.
+func (a *Adapter) ReadRecords(ctx context.Context, streamName, shardID string, from streaming.Position, limit int) (*streaming.ReadOutput, error) {
+	iterator := from.Token
+	if iterator == "" {
+		var err error
+		if iterator, err = a.shardIterator(ctx, streamName, shardID, from); err != nil {
+			return nil, err
+		}
+	}
+
+	in := &kinesis.GetRecordsInput{ShardIterator: aws.String(iterator)}
+	if limit > 0 {
+		in.Limit = aws.Int32(int32(limit))
+	}
+	out, err := a.client.GetRecords(ctx, in)
+	var expired *types.ExpiredIteratorException
+	if errors.As(err, &expired) && from.Token != "" {
+		from.Token = ""
+		return a.ReadRecords(ctx, streamName, shardID, from, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := &streaming.ReadOutput{Next: from}
+	for _, r := range out.Records {
+		res.Records = append(res.Records, streaming.Record{
+			Stream:         streamName,
+			ShardID:        shardID,
+			SequenceNumber: aws.ToString(r.SequenceNumber),
+			PartitionKey:   aws.ToString(r.PartitionKey),
+			Data:           r.Data,
+			Timestamp:      aws.ToTime(r.ApproximateArrivalTimestamp),
+		})
+	}
+	if n := len(res.Records); n > 0 {
+		res.Next = streaming.AfterSequence(res.Records[n-1].SequenceNumber)
+	}
+	if out.NextShardIterator == nil {
+		res.ShardClosed = true
+	} else {
+		res.Next.Token = aws.ToString(out.NextShardIterator)
+	}
+	return res, nil
+}
+
+func (a *Adapter) shardIterator(ctx context.Context, streamName, shardID string, from streaming.Position) (string, error) {
+	in := &kinesis.GetShardIteratorInput{
+		StreamName: aws.String(streamName),
+		ShardId:    aws.String(shardID),
+	}
+	switch from.Type {
+	case streaming.PositionOldest:
+		in.ShardIteratorType = types.ShardIteratorTypeTrimHorizon
+	case streaming.PositionLatest:
+		in.ShardIteratorType = types.ShardIteratorTypeLatest
+	case streaming.PositionAtSequence:
+		in.ShardIteratorType = types.ShardIteratorTypeAtSequenceNumber
+		in.StartingSequenceNumber = aws.String(from.SequenceNumber)
+	case streaming.PositionAfterSequence:
+		in.ShardIteratorType = types.ShardIteratorTypeAfterSequenceNumber
+		in.StartingSequenceNumber = aws.String(from.SequenceNumber)
+	case streaming.PositionAtTimestamp:
+		in.ShardIteratorType = types.ShardIteratorTypeAtTimestamp
+		in.Timestamp = aws.Time(from.Timestamp)
+	default:
+		return "", streaming.ErrInvalidPosition
+	}
+
+	out, err := a.client.GetShardIterator(ctx, in)
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(out.ShardIterator), nil
+}
+
+var (
+	_ streaming.BatchClient = (*Adapter)(nil)
+	_ streaming.Consumer    = (*Adapter)(nil)
+)
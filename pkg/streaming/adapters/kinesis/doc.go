@@ -1,4 +1,8 @@
-// Package kinesis provides functionality for kinesis.
+// Package kinesis provides an AWS Kinesis Data Streams backend.
 //
-// TODO: Add detailed documentation.
+// Adapter implements both streaming.Client and streaming.Consumer. Reads use
+// shard iterators, which are carried between calls in streaming.Position.Token
+// and re-created from the sequence number when they expire. Kinesis records
+// carry no attributes, so entry headers (and with them the trace context)
+// are not sent.
 package kinesis
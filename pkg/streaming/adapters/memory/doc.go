@@ -1,4 +1,7 @@
-// Package memory provides functionality for memory.
+// Package memory provides an in-memory streaming backend.
 //
-// TODO: Add detailed documentation.
+// Client implements both streaming.Client and streaming.Consumer, so
+// producers, consumers and consumer groups can be tested without a cloud
+// service. Each stream has a fixed number of shards (streaming.Config.ShardCount)
+// and keeps every record; sequence numbers are zero-padded counters per shard.
 package memory
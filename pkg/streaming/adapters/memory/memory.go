@@ -2,7 +2,13 @@ package memory
 
 import (
 	"context"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"sort"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/streaming"
 )
@@ -14,16 +20,25 @@ type Record struct {
 	Data         []byte
 }
 
-// Client implements streaming.Client in memory.
+// Client implements streaming.Client and streaming.Consumer in memory.
+// Every stream has cfg.ShardCount shards; records are assigned to shards by
+// a hash of their partition key and retained forever.
 type Client struct {
-	mu      sync.Mutex
-	records []Record
+	mu         sync.Mutex
+	records    []Record
+	shardCount int
+	streams    map[string][][]streaming.Record
 }
 
 // New creates a new in-memory streaming client.
-func New(_ streaming.Config) *Client {
+func New(cfg streaming.Config) *Client {
+	if cfg.ShardCount <= 0 {
+		cfg.ShardCount = 1
+	}
 	return &Client{
-		records: make([]Record, 0),
+		records:    make([]Record, 0),
+		shardCount: cfg.ShardCount,
+		streams:    make(map[string][][]streaming.Record),
 	}
 }
 
@@ -31,6 +46,22 @@ func (c *Client) PutRecord(ctx context.Context, streamName string, partitionKey
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	c.put(streamName, partitionKey, data, nil)
+	return nil
+}
+
+// PutRecords writes all entries; in memory no entry can fail.
+func (c *Client) PutRecords(ctx context.Context, streamName string, entries []streaming.Entry) ([]error, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, e := range entries {
+		c.put(streamName, e.PartitionKey, e.Data, e.Headers)
+	}
+	return make([]error, len(entries)), nil
+}
+
+func (c *Client) put(streamName string, partitionKey string, data []byte, headers map[string]string) {
 	// Clone data to avoid race conditions if caller modifies it
 	dataCopy := make([]byte, len(data))
 	copy(dataCopy, data)
@@ -40,13 +71,121 @@ func (c *Client) PutRecord(ctx context.Context, streamName string, partitionKey
 		PartitionKey: partitionKey,
 		Data:         dataCopy,
 	})
-	return nil
+
+	shards := c.stream(streamName)
+	i := shardFor(partitionKey, len(shards))
+	shards[i] = append(shards[i], streaming.Record{
+		Stream:         streamName,
+		ShardID:        shardID(i),
+		SequenceNumber: sequenceNumber(len(shards[i]) + 1),
+		PartitionKey:   partitionKey,
+		Data:           dataCopy,
+		Timestamp:      time.Now(),
+		Headers:        maps.Clone(headers),
+	})
+}
+
+// ListShards returns the shards of a stream. Streams are created on first use.
+func (c *Client) ListShards(ctx context.Context, streamName string) ([]streaming.Shard, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	shards := make([]streaming.Shard, len(c.stream(streamName)))
+	for i := range shards {
+		shards[i] = streaming.Shard{ID: shardID(i)}
+	}
+	return shards, nil
+}
+
+// ReadRecords returns up to limit records from a shard starting at from.
+func (c *Client) ReadRecords(ctx context.Context, streamName, id string, from streaming.Position, limit int) (*streaming.ReadOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	shards := c.stream(streamName)
+	i, err := parseShardID(id, len(shards))
+	if err != nil {
+		return nil, err
+	}
+	recs := shards[i]
+
+	// start is the index of the first record to return.
+	var start int
+	switch from.Type {
+	case streaming.PositionOldest:
+		start = 0
+	case streaming.PositionLatest:
+		start = len(recs)
+	case streaming.PositionAtSequence, streaming.PositionAfterSequence:
+		n, err := strconv.Atoi(from.SequenceNumber)
+		if err != nil || n < 1 {
+			return nil, streaming.ErrInvalidPosition
+		}
+		start = n - 1
+		if from.Type == streaming.PositionAfterSequence {
+			start = n
+		}
+		start = min(start, len(recs))
+	case streaming.PositionAtTimestamp:
+		start = sort.Search(len(recs), func(j int) bool { return !recs[j].Timestamp.Before(from.Timestamp) })
+	default:
+		return nil, streaming.ErrInvalidPosition
+	}
+
+	end := len(recs)
+	if limit > 0 {
+		end = min(end, start+limit)
+	}
+	out := &streaming.ReadOutput{
+		Records: make([]streaming.Record, end-start),
+		// Sequence numbers are 1-based, so AtSequence(end+1) is the next record.
+		Next: streaming.AtSequence(sequenceNumber(end + 1)),
+	}
+	copy(out.Records, recs[start:end])
+	return out, nil
+}
+
+func (c *Client) stream(name string) [][]streaming.Record {
+	shards, ok := c.streams[name]
+	if !ok {
+		shards = make([][]streaming.Record, c.shardCount)
+		c.streams[name] = shards
+	}
+	return shards
+}
+
+func shardFor(partitionKey string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(partitionKey))
+	return int(h.Sum32() % uint32(n))
+}
+
+func shardID(i int) string {
+	return fmt.Sprintf("shard-%06d", i)
+}
+
+func parseShardID(id string, n int) (int, error) {
+	var i int
+	if _, err := fmt.Sscanf(id, "shard-%d", &i); err != nil || i < 0 || i >= n {
+		return 0, streaming.ErrShardNotFound
+	}
+	return i, nil
+}
+
+// sequenceNumber formats n with zero padding so sequence numbers sort as strings.
+func sequenceNumber(n int) string {
+	return fmt.Sprintf("%020d", n)
 }
 
 func (c *Client) Close() error {
 	return nil
 }
 
+var (
+	_ streaming.BatchClient = (*Client)(nil)
+	_ streaming.Consumer    = (*Client)(nil)
+)
+
 // GetRecords is a test helper to inspect sent records.
 func (c *Client) GetRecords() []Record {
 	c.mu.Lock()
@@ -1,6 +1,7 @@
 package memory_test
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/streaming"
@@ -41,3 +42,47 @@ func (s *StreamingTestSuite) TestPutRecord() {
 func TestStreamingSuite(t *testing.T) {
 	test.Run(t, new(StreamingTestSuite))
 }
+
+func (s *StreamingTestSuite) TestReadRecords() {
+	client := memory.New(streaming.Config{ShardCount: 2})
+	for i := 0; i < 10; i++ {
+		s.Require().NoError(client.PutRecord(s.Ctx, "orders", fmt.Sprintf("user-%d", i), []byte{byte(i)}))
+	}
+
+	shards, err := client.ListShards(s.Ctx, "orders")
+	s.Require().NoError(err)
+	s.Require().Len(shards, 2)
+
+	total := 0
+	for _, shard := range shards {
+		out, err := client.ReadRecords(s.Ctx, "orders", shard.ID, streaming.Oldest(), 3)
+		s.Require().NoError(err)
+		s.LessOrEqual(len(out.Records), 3)
+
+		// Resuming from Next continues without gaps or repeats.
+		read := out.Records
+		for len(out.Records) > 0 {
+			out, err = client.ReadRecords(s.Ctx, "orders", shard.ID, out.Next, 3)
+			s.Require().NoError(err)
+			read = append(read, out.Records...)
+		}
+		for i := 1; i < len(read); i++ {
+			s.Less(read[i-1].SequenceNumber, read[i].SequenceNumber)
+		}
+		total += len(read)
+
+		// AfterSequence skips the first record; Latest returns nothing new.
+		if len(read) > 1 {
+			out, err = client.ReadRecords(s.Ctx, "orders", shard.ID, streaming.AfterSequence(read[0].SequenceNumber), 1)
+			s.Require().NoError(err)
+			s.Equal(read[1].Data, out.Records[0].Data)
+		}
+		out, err = client.ReadRecords(s.Ctx, "orders", shard.ID, streaming.Latest(), 10)
+		s.Require().NoError(err)
+		s.Empty(out.Records)
+	}
+	s.Equal(10, total)
+
+	_, err = client.ReadRecords(s.Ctx, "orders", "missing", streaming.Oldest(), 1)
+	s.ErrorIs(err, streaming.ErrShardNotFound)
+}
@@ -3,14 +3,39 @@ package pubsub
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"sync"
+	"time"
 
 	"cloud.google.com/go/pubsub/v2"
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/chris-alexander-pop/system-design-library/pkg/streaming"
 )
 
+// receiveTimeout bounds how long ReadRecords waits for messages to arrive.
+const receiveTimeout = time.Second
+
 // Adapter provides streaming interface for GCP Pub/Sub.
 type Adapter struct {
 	client    *pubsub.Client
 	projectID string
+
+	mu        sync.Mutex
+	receivers map[string]*receiver // by subscription
+	batches   int
+}
+
+// receiver keeps a streaming pull open for a subscription, so that messages
+// can be held until the consumer has handled them.
+type receiver struct {
+	cancel context.CancelFunc
+	msgs   chan *pubsub.Message
+	done   chan struct{}
+	err    error // set before done is closed
+
+	// pending holds the messages of batches returned by ReadRecords that
+	// have been neither acknowledged nor nacked, by continuation token.
+	pending map[string][]*pubsub.Message
 }
 
 // New creates a new Pub/Sub streaming adapter.
@@ -19,7 +44,7 @@ func New(ctx context.Context, projectID string) (*Adapter, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Adapter{client: client, projectID: projectID}, nil
+	return &Adapter{client: client, projectID: projectID, receivers: make(map[string]*receiver)}, nil
 }
 
 // topicFullName returns the fully qualified topic name.
@@ -47,7 +72,213 @@ func (a *Adapter) PutRecord(ctx context.Context, topicName, partitionKey string,
 	return err
 }
 
-// Close closes the Pub/Sub client.
+// PutRecords publishes entries through one publisher, which groups them into
+// as few Publish requests as its batch settings allow, and reports the
+// outcome of each message.
+func (a *Adapter) PutRecords(ctx context.Context, topicName string, entries []streaming.Entry) ([]error, error) {
+	publisher := a.client.Publisher(a.topicFullName(topicName))
+	defer publisher.Stop()
+
+	for _, e := range entries {
+		if e.PartitionKey != "" {
+			publisher.EnableMessageOrdering = true
+			break
+		}
+	}
+
+	results := make([]*pubsub.PublishResult, len(entries))
+	for i, e := range entries {
+		results[i] = publisher.Publish(ctx, &pubsub.Message{
+			Data:        e.Data,
+			OrderingKey: e.PartitionKey,
+			Attributes:  e.Headers,
+		})
+	}
+
+	errs := make([]error, len(entries))
+	for i, res := range results {
+		if _, err := res.Get(ctx); err != nil {
+			errs[i] = err
+			// A failed ordered message pauses its key until resumed.
+			if key := entries[i].PartitionKey; key != "" {
+				publisher.ResumePublish(key)
+			}
+		}
+	}
+	return errs, nil
+}
+
+// subscriptionFullName returns the fully qualified subscription name.
+func (a *Adapter) subscriptionFullName(subscription string) string {
+	return fmt.Sprintf("projects/%s/subscriptions/%s", a.projectID, subscription)
+}
+
+// ListShards returns a single shard named after the subscription. Pub/Sub
+// balances messages across subscribers itself, so there is nothing to lease.
+func (a *Adapter) ListShards(ctx context.Context, subscription string) ([]streaming.Shard, error) {
+	return []streaming.Shard{{ID: subscription}}, nil
+}
+
+// ReadRecords pulls up to limit messages from the subscription. Pub/Sub
+// tracks progress through acknowledgements rather than offsets: the messages
+// of a batch are acknowledged when ReadRecords is next called with the
+// batch's Next position, i.e. once the consumer has handled them and moved
+// on. Messages of batches that are not continued from, because the caller
+// read again from an earlier position after its handler failed, are nacked
+// and redelivered, and so are messages held by a process that stops without
+// acknowledging them. Apart from its continuation token, from is ignored;
+// message IDs are returned as sequence numbers but cannot be used to seek.
+// Each subscription must have a single reader.
+func (a *Adapter) ReadRecords(ctx context.Context, subscription, shardID string, from streaming.Position, limit int) (*streaming.ReadOutput, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	r := a.receiver(subscription, limit)
+
+	a.mu.Lock()
+	for token, msgs := range r.pending {
+		for _, m := range msgs {
+			if token == from.Token {
+				m.Ack()
+			} else {
+				m.Nack()
+			}
+		}
+		delete(r.pending, token)
+	}
+	a.mu.Unlock()
+
+	var msgs []*pubsub.Message
+	timer := time.NewTimer(receiveTimeout)
+	defer timer.Stop()
+collect:
+	for len(msgs) < limit {
+		select {
+		case m := <-r.msgs:
+			msgs = append(msgs, m)
+		case <-timer.C:
+			break collect
+		case <-r.done:
+			nack(msgs)
+			a.mu.Lock()
+			if a.receivers[subscription] == r {
+				delete(a.receivers, subscription)
+			}
+			a.mu.Unlock()
+			if r.err == nil {
+				return nil, errors.Internal("pubsub: receiving stopped", nil)
+			}
+			return nil, r.err
+		case <-ctx.Done():
+			nack(msgs)
+			return nil, ctx.Err()
+		}
+	}
+
+	next := from
+	next.Token = ""
+	if len(msgs) == 0 {
+		return &streaming.ReadOutput{Next: next}, nil
+	}
+
+	recs := make([]streaming.Record, len(msgs))
+	for i, m := range msgs {
+		recs[i] = streaming.Record{
+			Stream:         subscription,
+			ShardID:        shardID,
+			SequenceNumber: m.ID,
+			PartitionKey:   m.OrderingKey,
+			Data:           m.Data,
+			Timestamp:      m.PublishTime,
+			Headers:        m.Attributes,
+		}
+	}
+
+	a.mu.Lock()
+	a.batches++
+	next = streaming.AfterSequence(msgs[len(msgs)-1].ID)
+	next.Token = strconv.Itoa(a.batches)
+	r.pending[next.Token] = msgs
+	a.mu.Unlock()
+
+	return &streaming.ReadOutput{Records: recs, Next: next}, nil
+}
+
+// receiver returns the running receiver for subscription, starting one that
+// holds up to limit outstanding messages if there is none.
+func (a *Adapter) receiver(subscription string, limit int) *receiver {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if r, ok := a.receivers[subscription]; ok {
+		return r
+	}
+
+	sub := a.client.Subscriber(a.subscriptionFullName(subscription))
+	sub.ReceiveSettings.MaxOutstandingMessages = limit
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &receiver{
+		cancel:  cancel,
+		msgs:    make(chan *pubsub.Message, limit),
+		done:    make(chan struct{}),
+		pending: make(map[string][]*pubsub.Message),
+	}
+	a.receivers[subscription] = r
+
+	go func() {
+		defer close(r.done)
+		r.err = sub.Receive(ctx, func(ctx context.Context, m *pubsub.Message) {
+			select {
+			case r.msgs <- m:
+			case <-ctx.Done():
+				m.Nack()
+			}
+		})
+	}()
+	return r
+}
+
+func nack(msgs []*pubsub.Message) {
+	for _, m := range msgs {
+		m.Nack()
+	}
+}
+
+// Close nacks all held messages, stops receiving and closes the Pub/Sub
+// client.
 func (a *Adapter) Close() error {
+	a.mu.Lock()
+	receivers := a.receivers
+	a.receivers = make(map[string]*receiver)
+	for _, r := range receivers {
+		r.cancel()
+		for token, msgs := range r.pending {
+			nack(msgs)
+			delete(r.pending, token)
+		}
+	}
+	a.mu.Unlock()
+
+	// Receive returns once every message it delivered is settled.
+	for _, r := range receivers {
+		for stopped := false; !stopped; {
+			select {
+			case m := <-r.msgs:
+				m.Nack()
+			case <-r.done:
+				stopped = true
+			}
+		}
+		close(r.msgs)
+		for m := range r.msgs {
+			m.Nack()
+		}
+	}
 	return a.client.Close()
 }
+
+var (
+	_ streaming.BatchClient = (*Adapter)(nil)
+	_ streaming.Consumer    = (*Adapter)(nil)
+)
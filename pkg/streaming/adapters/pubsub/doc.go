@@ -1,4 +1,8 @@
-// Package pubsub provides functionality for pubsub.
+// Package pubsub provides a Google Cloud Pub/Sub streaming backend.
 //
-// TODO: Add detailed documentation.
+// Adapter implements streaming.Client by publishing to topics and
+// streaming.Consumer by pulling from subscriptions. Pub/Sub has no shards or
+// replayable offsets: a subscription is exposed as a single shard, and the
+// messages of a batch are acknowledged once the consumer reads on from the
+// batch's Next position, so that unhandled messages are redelivered.
 package pubsub
@@ -3,9 +3,15 @@ package pubsub_test
 import (
 	"context"
 	"os"
+	"strconv"
 	"testing"
+	"time"
 
+	pb "cloud.google.com/go/pubsub/v2/apiv1/pubsubpb"
+	"github.com/chris-alexander-pop/system-design-library/pkg/streaming"
 	"github.com/chris-alexander-pop/system-design-library/pkg/streaming/adapters/pubsub"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
 func TestPubSub_Init(t *testing.T) {
@@ -20,3 +26,76 @@ func TestPubSub_Init(t *testing.T) {
 		t.Error("Returned nil client")
 	}
 }
+
+// TestReadRecordsAcksHandledBatches runs against the Pub/Sub emulator
+// named by PUBSUB_EMULATOR_HOST.
+func TestReadRecordsAcksHandledBatches(t *testing.T) {
+	host := os.Getenv("PUBSUB_EMULATOR_HOST")
+	if host == "" {
+		t.Skip("Skipping PubSub emulator test")
+	}
+	ctx := context.Background()
+	conn, err := grpc.NewClient(host, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 36)
+	topic, subscription := "events-"+suffix, "workers-"+suffix
+	if _, err := pb.NewPublisherClient(conn).CreateTopic(ctx, &pb.Topic{Name: "projects/p/topics/" + topic}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pb.NewSubscriberClient(conn).CreateSubscription(ctx, &pb.Subscription{
+		Name:               "projects/p/subscriptions/" + subscription,
+		Topic:              "projects/p/topics/" + topic,
+		AckDeadlineSeconds: 60,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	newAdapter := func() *pubsub.Adapter {
+		a, err := pubsub.New(ctx, "p")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+	read := func(a *pubsub.Adapter, from streaming.Position) *streaming.ReadOutput {
+		t.Helper()
+		out, err := a.ReadRecords(ctx, subscription, subscription, from, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	a := newAdapter()
+	errs, err := a.PutRecords(ctx, topic, []streaming.Entry{{Data: []byte("a")}, {Data: []byte("b")}})
+	if err != nil || errs[0] != nil || errs[1] != nil {
+		t.Fatalf("PutRecords failed: %v %v", err, errs)
+	}
+
+	if first := read(a, streaming.Oldest()); len(first.Records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(first.Records))
+	}
+
+	// Reading again from the old position, as after a failed handler,
+	// redelivers the batch.
+	again := read(a, streaming.Oldest())
+	if len(again.Records) != 2 {
+		t.Fatalf("expected the batch to be redelivered, got %d records", len(again.Records))
+	}
+
+	// Moving on acknowledges it, so another reader does not get it again.
+	if out := read(a, again.Next); len(out.Records) != 0 {
+		t.Errorf("expected no more records, got %d", len(out.Records))
+	}
+	a.Close()
+
+	b := newAdapter()
+	defer b.Close()
+	if out := read(b, streaming.Oldest()); len(out.Records) != 0 {
+		t.Errorf("acknowledged records were redelivered: %d", len(out.Records))
+	}
+}
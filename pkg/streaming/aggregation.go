@@ -0,0 +1,227 @@
+package streaming
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+)
+
+// Aggregated records use the Kinesis Producer Library format so that KCL
+// consumers can read them: a magic prefix, a protobuf AggregatedRecord and
+// the MD5 digest of the protobuf bytes.
+//
+//	message AggregatedRecord {
+//	  repeated string partition_key_table     = 1;
+//	  repeated string explicit_hash_key_table = 2;
+//	  repeated Record records                 = 3;
+//	}
+//	message Record {
+//	  required uint64 partition_key_index     = 1;
+//	  optional uint64 explicit_hash_key_index = 2;
+//	  required bytes  data                    = 3;
+//	  repeated Tag    tags                    = 4;
+//	}
+var aggregateMagic = []byte{0xF3, 0x89, 0x9A, 0xC2}
+
+// aggregateOverhead is the size of the magic prefix and digest.
+const aggregateOverhead = 4 + md5.Size
+
+// Aggregate packs entries into a single record payload. The partition key of
+// the aggregate as a whole is chosen by the caller; the keys of the entries
+// are preserved for Deaggregate.
+func Aggregate(entries []Entry) []byte {
+	keys := make(map[string]uint64)
+	var table []string
+	for _, e := range entries {
+		if _, ok := keys[e.PartitionKey]; !ok {
+			keys[e.PartitionKey] = uint64(len(table))
+			table = append(table, e.PartitionKey)
+		}
+	}
+
+	var msg []byte
+	for _, k := range table {
+		msg = appendBytesField(msg, 1, []byte(k))
+	}
+	for _, e := range entries {
+		var rec []byte
+		rec = appendVarintField(rec, 1, keys[e.PartitionKey])
+		rec = appendBytesField(rec, 3, e.Data)
+		msg = appendBytesField(msg, 3, rec)
+	}
+
+	sum := md5.Sum(msg)
+	out := make([]byte, 0, aggregateOverhead+len(msg))
+	out = append(out, aggregateMagic...)
+	out = append(out, msg...)
+	return append(out, sum[:]...)
+}
+
+// IsAggregated reports whether data is an aggregated record payload.
+func IsAggregated(data []byte) bool {
+	if len(data) < aggregateOverhead || !bytes.HasPrefix(data, aggregateMagic) {
+		return false
+	}
+	msg := data[len(aggregateMagic) : len(data)-md5.Size]
+	sum := md5.Sum(msg)
+	return bytes.Equal(sum[:], data[len(data)-md5.Size:])
+}
+
+// Deaggregate unpacks an aggregated record payload into its entries. Data
+// that is not aggregated is returned as a single entry with an empty
+// partition key.
+func Deaggregate(data []byte) ([]Entry, error) {
+	if !IsAggregated(data) {
+		return []Entry{{Data: data}}, nil
+	}
+	msg := data[len(aggregateMagic) : len(data)-md5.Size]
+
+	var (
+		table   []string
+		entries []Entry
+		indexes []uint64
+	)
+	err := walkFields(msg, func(field int, v uint64, b []byte) error {
+		switch field {
+		case 1:
+			table = append(table, string(b))
+		case 3:
+			var e Entry
+			var idx uint64
+			if err := walkFields(b, func(field int, v uint64, b []byte) error {
+				switch field {
+				case 1:
+					idx = v
+				case 3:
+					e.Data = b
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			entries = append(entries, e)
+			indexes = append(indexes, idx)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, idx := range indexes {
+		if idx >= uint64(len(table)) {
+			return nil, ErrMalformedAggregate
+		}
+		entries[i].PartitionKey = table[idx]
+	}
+	return entries, nil
+}
+
+// DeaggregateRecords expands aggregated records into the records they carry.
+// Expanded records keep the sequence number of the aggregate, so a checkpoint
+// always covers a whole aggregate. Records that fail to decode are passed
+// through unchanged.
+func DeaggregateRecords(records []Record) []Record {
+	out := make([]Record, 0, len(records))
+	for _, r := range records {
+		if !IsAggregated(r.Data) {
+			out = append(out, r)
+			continue
+		}
+		entries, err := Deaggregate(r.Data)
+		if err != nil {
+			out = append(out, r)
+			continue
+		}
+		for _, e := range entries {
+			sub := r
+			sub.PartitionKey = e.PartitionKey
+			sub.Data = e.Data
+			out = append(out, sub)
+		}
+	}
+	return out
+}
+
+// aggregatedSize returns the encoded size of an aggregate of size bytes
+// after adding e. All entries of the aggregate share e's partition key; a size
+// of 0 stands for an empty aggregate.
+func aggregatedSize(size int, e Entry) int {
+	if size == 0 {
+		size = aggregateOverhead + fieldSize(len(e.PartitionKey))
+	}
+	rec := 1 + varintSize(0) + fieldSize(len(e.Data))
+	return size + fieldSize(rec)
+}
+
+func fieldSize(n int) int {
+	return 1 + varintSize(uint64(n)) + n
+}
+
+func varintSize(v uint64) int {
+	n := 1
+	for v >= 0x80 {
+		v >>= 7
+		n++
+	}
+	return n
+}
+
+func appendVarintField(b []byte, field int, v uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3)
+	return binary.AppendUvarint(b, v)
+}
+
+func appendBytesField(b []byte, field int, v []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// walkFields calls fn for every varint and length-delimited field in a
+// protobuf message and skips fixed-width fields.
+func walkFields(msg []byte, fn func(field int, v uint64, b []byte) error) error {
+	for len(msg) > 0 {
+		tag, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return ErrMalformedAggregate
+		}
+		msg = msg[n:]
+		field := int(tag >> 3)
+
+		switch tag & 7 {
+		case 0:
+			v, n := binary.Uvarint(msg)
+			if n <= 0 {
+				return ErrMalformedAggregate
+			}
+			msg = msg[n:]
+			if err := fn(field, v, nil); err != nil {
+				return err
+			}
+		case 1:
+			if len(msg) < 8 {
+				return ErrMalformedAggregate
+			}
+			msg = msg[8:]
+		case 2:
+			l, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < l {
+				return ErrMalformedAggregate
+			}
+			b := msg[n : n+int(l)]
+			msg = msg[n+int(l):]
+			if err := fn(field, 0, b); err != nil {
+				return err
+			}
+		case 5:
+			if len(msg) < 4 {
+				return ErrMalformedAggregate
+			}
+			msg = msg[4:]
+		default:
+			return ErrMalformedAggregate
+		}
+	}
+	return nil
+}
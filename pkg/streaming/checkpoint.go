@@ -0,0 +1,63 @@
+package streaming
+
+import (
+	"context"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/database/kv"
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+)
+
+// ShardEnd is the checkpoint a ConsumerGroup stores for a closed shard once
+// it has been read to the end.
+const ShardEnd = "SHARD_END"
+
+// CheckpointStore persists, per consumer group, the sequence number of the
+// last record processed in each shard.
+type CheckpointStore interface {
+	// GetCheckpoint returns the checkpointed sequence number, or an empty
+	// string if the shard has no checkpoint yet.
+	GetCheckpoint(ctx context.Context, group, streamName, shardID string) (string, error)
+
+	// SetCheckpoint records sequenceNumber as processed.
+	SetCheckpoint(ctx context.Context, group, streamName, shardID, sequenceNumber string) error
+}
+
+// KVCheckpointStore implements CheckpointStore on top of a kv.KV.
+type KVCheckpointStore struct {
+	store  kv.KV
+	prefix string
+}
+
+// NewKVCheckpointStore creates a checkpoint store that keeps one key per
+// group/stream/shard under prefix.
+func NewKVCheckpointStore(store kv.KV, prefix string) *KVCheckpointStore {
+	if prefix == "" {
+		prefix = "streaming:checkpoint:"
+	}
+	return &KVCheckpointStore{store: store, prefix: prefix}
+}
+
+// GetCheckpoint returns the checkpointed sequence number for a shard.
+func (s *KVCheckpointStore) GetCheckpoint(ctx context.Context, group, streamName, shardID string) (string, error) {
+	val, err := s.store.Get(ctx, s.key(group, streamName, shardID))
+	if err != nil {
+		var appErr *errors.AppError
+		if errors.As(err, &appErr) && appErr.Code == errors.CodeNotFound {
+			return "", nil
+		}
+		return "", errors.Wrap(err, "failed to load checkpoint")
+	}
+	return string(val), nil
+}
+
+// SetCheckpoint stores the sequence number for a shard without expiry.
+func (s *KVCheckpointStore) SetCheckpoint(ctx context.Context, group, streamName, shardID, sequenceNumber string) error {
+	if err := s.store.Set(ctx, s.key(group, streamName, shardID), []byte(sequenceNumber), 0); err != nil {
+		return errors.Wrap(err, "failed to store checkpoint")
+	}
+	return nil
+}
+
+func (s *KVCheckpointStore) key(group, streamName, shardID string) string {
+	return s.prefix + group + "/" + streamName + "/" + shardID
+}
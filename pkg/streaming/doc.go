@@ -17,5 +17,51 @@ Usage:
 
 	// Send data
 	err := client.PutRecord(ctx, "orders", "user-123", []byte("data"))
+
+Producing:
+
+PutRecord makes one request per record. For high-volume writers a Producer
+buffers records per stream, sends them in batches (one PutRecords request
+when the client is a BatchClient), retries records the backend rejected and
+reports each record's outcome through a Result. With Aggregate set, small
+records sharing a partition key are packed into one stream record in the
+Kinesis Producer Library format; consumers expand them with
+DeaggregateRecords.
+
+	producer := streaming.NewProducer(client, streaming.ProducerConfig{
+		Linger:    50 * time.Millisecond,
+		Aggregate: true,
+	})
+	defer producer.Close() // flushes buffered records
+
+	res, err := producer.Put(ctx, "orders", "user-123", []byte("data"))
+	...
+	err = res.Wait(ctx)
+
+Consuming:
+
+Adapters that implement Consumer expose a stream's shards (partitions) and
+read them from an oldest, latest, sequence-number or timestamp Position. A
+ConsumerGroup runs readers across several instances: shards are leased through
+a distlock.Locker and progress is stored in a CheckpointStore, for example
+one backed by kv.KV:
+
+	group := streaming.NewConsumerGroup(client,
+		streaming.NewKVCheckpointStore(kvStore, ""),
+		locker,
+		streaming.GroupConfig{Group: "billing", Stream: "orders"},
+		func(ctx context.Context, records []streaming.Record) error {
+			return process(records)
+		})
+	err := group.Run(ctx)
+
+Tracing:
+
+InstrumentedClient and Producer.Put carry the caller's trace context in
+record Headers (not on Kinesis, whose records have no attributes), and
+InstrumentedConsumer links each read to the spans that wrote its records. A
+handler continues a record's trace with instrument.ExtractHeaders:
+
+	ctx := instrument.ExtractHeaders(ctx, record.Headers)
 */
 package streaming
@@ -0,0 +1,21 @@
+package streaming
+
+import "github.com/chris-alexander-pop/system-design-library/pkg/errors"
+
+// Sentinel errors for streaming operations.
+var (
+	// ErrStreamNotFound is returned when a stream does not exist.
+	ErrStreamNotFound = errors.New(errors.CodeNotFound, "stream not found", nil)
+
+	// ErrShardNotFound is returned when a shard does not exist in a stream.
+	ErrShardNotFound = errors.New(errors.CodeNotFound, "shard not found", nil)
+
+	// ErrInvalidPosition is returned when a position cannot be used with a shard.
+	ErrInvalidPosition = errors.New(errors.CodeInvalidArgument, "invalid stream position", nil)
+
+	// ErrMalformedAggregate is returned when an aggregated record cannot be decoded.
+	ErrMalformedAggregate = errors.New(errors.CodeInvalidArgument, "malformed aggregated record", nil)
+
+	// ErrProducerClosed is returned when a record is put to a closed Producer.
+	ErrProducerClosed = errors.New(errors.CodeInternal, "producer closed", nil)
+)
@@ -0,0 +1,327 @@
+package streaming
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/concurrency/distlock"
+	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+)
+
+// Handler processes a batch of records from a single shard. Returning an
+// error leaves the checkpoint unchanged, so the batch is delivered again.
+type Handler func(ctx context.Context, records []Record) error
+
+// GroupConfig configures a ConsumerGroup.
+type GroupConfig struct {
+	// Group names the consumer group. Checkpoints and leases are scoped to it.
+	Group string `env:"STREAMING_CONSUMER_GROUP" env-default:"default"`
+
+	// Stream is the stream to consume.
+	Stream string `env:"STREAMING_STREAM"`
+
+	// InitialPosition is where shards without a checkpoint start.
+	InitialPosition Position
+
+	// BatchSize is the maximum number of records passed to the handler.
+	BatchSize int `env:"STREAMING_BATCH_SIZE" env-default:"100"`
+
+	// PollInterval is how long a shard reader waits when no records are available.
+	PollInterval time.Duration `env:"STREAMING_POLL_INTERVAL" env-default:"1s"`
+
+	// LeaseTTL is how long a shard lease lasts without renewal. Leases are
+	// renewed, and unowned shards claimed, every LeaseTTL/3.
+	LeaseTTL time.Duration `env:"STREAMING_LEASE_TTL" env-default:"10s"`
+
+	// MaxShards caps the number of shards one instance leases, so that
+	// shards spread across instances. 0 means no limit.
+	MaxShards int `env:"STREAMING_MAX_SHARDS" env-default:"0"`
+}
+
+// ConsumerGroup reads a stream with several cooperating instances. Each
+// instance leases shards through a distlock.Locker, runs one reader per
+// leased shard and checkpoints after every successfully handled batch, so
+// a shard whose lease expires resumes on another instance where the previous
+// owner left off. Delivery is at-least-once.
+//
+// A shard with a ParentID is only read once its parent has been read to the
+// end, which is recorded by checkpointing ShardEnd, so that records of a key
+// stay in order across resharding.
+type ConsumerGroup struct {
+	consumer    Consumer
+	checkpoints CheckpointStore
+	locker      distlock.Locker
+	handler     Handler
+	cfg         GroupConfig
+
+	mu       sync.Mutex
+	owned    map[string]*shardReader
+	stopping map[string]*shardReader // readers cancelled after losing their lease
+	closed   map[string]bool         // closed shards that have been read to the end
+}
+
+type shardReader struct {
+	lease  distlock.Lock
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// ended is set before done is closed when the shard was read to the end.
+	ended bool
+}
+
+// NewConsumerGroup creates a ConsumerGroup. Zero config values get defaults.
+func NewConsumerGroup(consumer Consumer, checkpoints CheckpointStore, locker distlock.Locker, cfg GroupConfig, handler Handler) *ConsumerGroup {
+	if cfg.Group == "" {
+		cfg.Group = "default"
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.LeaseTTL <= 0 {
+		cfg.LeaseTTL = 10 * time.Second
+	}
+	return &ConsumerGroup{
+		consumer:    consumer,
+		checkpoints: checkpoints,
+		locker:      locker,
+		handler:     handler,
+		cfg:         cfg,
+		owned:       make(map[string]*shardReader),
+		stopping:    make(map[string]*shardReader),
+		closed:      make(map[string]bool),
+	}
+}
+
+// Run claims shards and processes records until ctx is cancelled, then stops
+// all readers and releases their leases.
+func (g *ConsumerGroup) Run(ctx context.Context) error {
+	defer g.releaseAll(context.WithoutCancel(ctx))
+
+	ticker := time.NewTicker(g.cfg.LeaseTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		g.balance(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Shards returns the IDs of the shards currently leased by this instance.
+func (g *ConsumerGroup) Shards() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ids := make([]string, 0, len(g.owned))
+	for id := range g.owned {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// balance renews held leases, drops the ones that were lost and tries to
+// lease shards nobody holds. Readers of lost shards are stopped without
+// waiting for them, so that a slow handler cannot delay renewing the other
+// leases; their shards are not claimed again until they have exited.
+func (g *ConsumerGroup) balance(ctx context.Context) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for id, r := range g.stopping {
+		select {
+		case <-r.done:
+			delete(g.stopping, id)
+		default:
+		}
+	}
+
+	for id, r := range g.owned {
+		select {
+		case <-r.done:
+			// The reader only exits on its own after finishing a closed shard.
+			g.closed[id] = r.ended
+			r.lease.Release(ctx)
+			delete(g.owned, id)
+			continue
+		default:
+		}
+		if err := r.lease.Extend(ctx, g.cfg.LeaseTTL); err != nil || !r.lease.IsHeld() {
+			logger.L().WarnContext(ctx, "lost shard lease", "group", g.cfg.Group, "stream", g.cfg.Stream, "shard", id, "error", err)
+			r.cancel()
+			g.stopping[id] = r
+			delete(g.owned, id)
+		}
+	}
+
+	shards, err := g.consumer.ListShards(ctx, g.cfg.Stream)
+	if err != nil {
+		logger.L().ErrorContext(ctx, "failed to list shards", "stream", g.cfg.Stream, "error", err)
+		return
+	}
+
+	listed := make(map[string]bool, len(shards))
+	for _, shard := range shards {
+		listed[shard.ID] = true
+	}
+
+	for _, shard := range shards {
+		if g.cfg.MaxShards > 0 && len(g.owned) >= g.cfg.MaxShards {
+			return
+		}
+		if g.owned[shard.ID] != nil || g.stopping[shard.ID] != nil || g.closed[shard.ID] {
+			continue
+		}
+		// A parent that is no longer listed has expired and cannot be read.
+		if shard.ParentID != "" && listed[shard.ParentID] && !g.ended(ctx, shard.ParentID) {
+			continue
+		}
+
+		lease := g.locker.NewLock(g.leaseKey(shard.ID), g.cfg.LeaseTTL)
+		ok, err := lease.Acquire(ctx)
+		if err != nil {
+			logger.L().ErrorContext(ctx, "failed to acquire shard lease", "shard", shard.ID, "error", err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		readerCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		r := &shardReader{lease: lease, cancel: cancel, done: make(chan struct{})}
+		g.owned[shard.ID] = r
+		go g.read(readerCtx, shard.ID, r)
+	}
+}
+
+// read processes one shard until ctx is cancelled or the shard is closed.
+func (g *ConsumerGroup) read(ctx context.Context, shardID string, r *shardReader) {
+	defer close(r.done)
+
+	pos := g.cfg.InitialPosition
+	for {
+		seq, err := g.checkpoints.GetCheckpoint(ctx, g.cfg.Group, g.cfg.Stream, shardID)
+		if err == nil {
+			if seq == ShardEnd {
+				r.ended = true
+				return
+			}
+			if seq != "" {
+				pos = AfterSequence(seq)
+			}
+			break
+		}
+		logger.L().ErrorContext(ctx, "failed to load checkpoint", "shard", shardID, "error", err)
+		if !g.sleep(ctx) {
+			return
+		}
+	}
+
+	for ctx.Err() == nil {
+		out, err := g.consumer.ReadRecords(ctx, g.cfg.Stream, shardID, pos, g.cfg.BatchSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.L().ErrorContext(ctx, "failed to get records", "shard", shardID, "error", err)
+			}
+			if !g.sleep(ctx) {
+				return
+			}
+			continue
+		}
+
+		if n := len(out.Records); n > 0 {
+			if err := g.handler(ctx, out.Records); err != nil {
+				logger.L().ErrorContext(ctx, "record handler failed", "shard", shardID, "error", err)
+				if !g.sleep(ctx) {
+					return
+				}
+				continue
+			}
+			last := out.Records[n-1].SequenceNumber
+			if err := g.checkpoints.SetCheckpoint(ctx, g.cfg.Group, g.cfg.Stream, shardID, last); err != nil {
+				logger.L().ErrorContext(ctx, "failed to checkpoint", "shard", shardID, "error", err)
+			}
+		}
+		pos = out.Next
+
+		if out.ShardClosed {
+			// Children of the shard wait for this checkpoint.
+			for {
+				err := g.checkpoints.SetCheckpoint(ctx, g.cfg.Group, g.cfg.Stream, shardID, ShardEnd)
+				if err == nil {
+					break
+				}
+				logger.L().ErrorContext(ctx, "failed to checkpoint shard end", "shard", shardID, "error", err)
+				if !g.sleep(ctx) {
+					return
+				}
+			}
+			r.ended = true
+			return
+		}
+		if len(out.Records) == 0 && !g.sleep(ctx) {
+			return
+		}
+	}
+}
+
+// ended reports whether shardID has been read to the end. Caller must hold g.mu.
+func (g *ConsumerGroup) ended(ctx context.Context, shardID string) bool {
+	if g.closed[shardID] {
+		return true
+	}
+	seq, err := g.checkpoints.GetCheckpoint(ctx, g.cfg.Group, g.cfg.Stream, shardID)
+	if err != nil {
+		logger.L().ErrorContext(ctx, "failed to load checkpoint", "shard", shardID, "error", err)
+		return false
+	}
+	if seq == ShardEnd {
+		g.closed[shardID] = true
+		return true
+	}
+	return false
+}
+
+func (g *ConsumerGroup) sleep(ctx context.Context) bool {
+	t := time.NewTimer(g.cfg.PollInterval)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+func (g *ConsumerGroup) releaseAll(ctx context.Context) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, r := range g.owned {
+		r.cancel()
+	}
+	for id, r := range g.stopping {
+		<-r.done
+		delete(g.stopping, id)
+	}
+	for id, r := range g.owned {
+		<-r.done
+		if err := r.lease.Release(ctx); err != nil {
+			logger.L().WarnContext(ctx, "failed to release shard lease", "shard", id, "error", err)
+		}
+		delete(g.owned, id)
+	}
+}
+
+func (g *ConsumerGroup) leaseKey(shardID string) string {
+	return "streaming:lease:" + g.cfg.Group + "/" + g.cfg.Stream + "/" + shardID
+}
@@ -2,11 +2,14 @@ package streaming
 
 import (
 	"context"
+	"time"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -20,12 +23,12 @@ type InstrumentedClient struct {
 func NewInstrumentedClient(next Client) *InstrumentedClient {
 	return &InstrumentedClient{
 		next:   next,
-		tracer: otel.Tracer("pkg/streaming"),
+		tracer: instrument.NewTracer("pkg/streaming"),
 	}
 }
 
 func (c *InstrumentedClient) PutRecord(ctx context.Context, streamName string, partitionKey string, data []byte) error {
-	ctx, span := c.tracer.Start(ctx, "streaming.PutRecord", trace.WithAttributes(
+	ctx, span := c.tracer.Start(ctx, "streaming.PutRecord", trace.WithSpanKind(trace.SpanKindProducer), trace.WithAttributes(
 		attribute.String("stream.name", streamName),
 		attribute.String("partition.key", partitionKey),
 		attribute.Int("data.size", len(data)),
@@ -34,7 +37,19 @@ func (c *InstrumentedClient) PutRecord(ctx context.Context, streamName string, p
 
 	logger.L().InfoContext(ctx, "putting record to stream", "stream", streamName, "partition_key", partitionKey)
 
-	err := c.next.PutRecord(ctx, streamName, partitionKey, data)
+	var err error
+	headers := instrument.InjectHeaders(ctx, nil)
+	if batch, ok := c.next.(BatchClient); ok && len(headers) > 0 {
+		// PutRecord cannot carry headers, so the record is sent as a batch of
+		// one to propagate the trace context.
+		var errs []error
+		errs, err = batch.PutRecords(ctx, streamName, []Entry{{PartitionKey: partitionKey, Data: data, Headers: headers}})
+		if err == nil && len(errs) == 1 {
+			err = errs[0]
+		}
+	} else {
+		err = c.next.PutRecord(ctx, streamName, partitionKey, data)
+	}
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
@@ -43,6 +58,141 @@ func (c *InstrumentedClient) PutRecord(ctx context.Context, streamName string, p
 	return err
 }
 
+// PutRecords writes entries in one request if the wrapped client is a
+// BatchClient, and one by one otherwise.
+func (c *InstrumentedClient) PutRecords(ctx context.Context, streamName string, entries []Entry) ([]error, error) {
+	ctx, span := c.tracer.Start(ctx, "streaming.PutRecords", trace.WithSpanKind(trace.SpanKindProducer), trace.WithAttributes(
+		attribute.String("stream.name", streamName),
+		attribute.Int("record.count", len(entries)),
+	))
+	defer span.End()
+
+	// Entries that already carry a trace context, such as those buffered by
+	// a Producer, keep the context of the caller that produced them.
+	traced := make([]Entry, len(entries))
+	for i, e := range entries {
+		if !hasTraceContext(e.Headers) {
+			e.Headers = instrument.InjectHeaders(ctx, e.Headers)
+		}
+		traced[i] = e
+	}
+	entries = traced
+
+	var (
+		errs []error
+		err  error
+	)
+	if batch, ok := c.next.(BatchClient); ok {
+		errs, err = batch.PutRecords(ctx, streamName, entries)
+	} else {
+		errs = make([]error, len(entries))
+		for i, e := range entries {
+			errs[i] = c.next.PutRecord(ctx, streamName, e.PartitionKey, e.Data)
+		}
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		logger.L().ErrorContext(ctx, "failed to put records", "stream", streamName, "error", err)
+		return nil, err
+	}
+
+	failed := 0
+	for _, e := range errs {
+		if e != nil {
+			failed++
+		}
+	}
+	span.SetAttributes(attribute.Int("record.failed", failed))
+	if failed > 0 {
+		logger.L().WarnContext(ctx, "some records were not written", "stream", streamName, "failed", failed)
+	}
+	return errs, nil
+}
+
 func (c *InstrumentedClient) Close() error {
 	return c.next.Close()
 }
+
+// InstrumentedConsumer wraps a Consumer with logging, tracing and metrics.
+type InstrumentedConsumer struct {
+	next   Consumer
+	tracer trace.Tracer
+	lag    metric.Float64Histogram
+}
+
+// NewInstrumentedConsumer creates a new InstrumentedConsumer.
+func NewInstrumentedConsumer(next Consumer) *InstrumentedConsumer {
+	lag, _ := otel.Meter("pkg/streaming").Float64Histogram("streaming.consumer.lag",
+		metric.WithDescription("Age of the newest record returned by a read"),
+		metric.WithUnit("s"))
+	return &InstrumentedConsumer{
+		next:   next,
+		tracer: instrument.NewTracer("pkg/streaming"),
+		lag:    lag,
+	}
+}
+
+func (c *InstrumentedConsumer) ListShards(ctx context.Context, streamName string) ([]Shard, error) {
+	ctx, span := c.tracer.Start(ctx, "streaming.ListShards", trace.WithAttributes(
+		attribute.String("stream.name", streamName),
+	))
+	defer span.End()
+
+	shards, err := c.next.ListShards(ctx, streamName)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		logger.L().ErrorContext(ctx, "failed to list shards", "stream", streamName, "error", err)
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("shard.count", len(shards)))
+	return shards, nil
+}
+
+func (c *InstrumentedConsumer) ReadRecords(ctx context.Context, streamName, shardID string, from Position, limit int) (*ReadOutput, error) {
+	ctx, span := c.tracer.Start(ctx, "streaming.ReadRecords", trace.WithSpanKind(trace.SpanKindConsumer), trace.WithAttributes(
+		attribute.String("stream.name", streamName),
+		attribute.String("shard.id", shardID),
+		attribute.Int("limit", limit),
+	))
+	defer span.End()
+
+	out, err := c.next.ReadRecords(ctx, streamName, shardID, from, limit)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		logger.L().ErrorContext(ctx, "failed to read records", "stream", streamName, "shard", shardID, "error", err)
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("record.count", len(out.Records)))
+	c.linkProducers(span, out.Records)
+	if n := len(out.Records); n > 0 && !out.Records[n-1].Timestamp.IsZero() {
+		c.lag.Record(ctx, time.Since(out.Records[n-1].Timestamp).Seconds(), metric.WithAttributes(
+			attribute.String("stream.name", streamName),
+			attribute.String("shard.id", shardID),
+		))
+	}
+	return out, nil
+}
+
+func (c *InstrumentedConsumer) Close() error {
+	return c.next.Close()
+}
+
+// linkProducers links the read span to the spans that wrote the records. A
+// span can only have one parent, so a batch read is linked to its producers
+// instead; handlers continue a record's own trace with
+// instrument.ExtractHeaders(ctx, record.Headers).
+func (c *InstrumentedConsumer) linkProducers(span trace.Span, records []Record) {
+	for _, r := range records {
+		if sc := trace.SpanContextFromContext(instrument.ExtractHeaders(context.Background(), r.Headers)); sc.IsValid() {
+			span.AddLink(trace.Link{SpanContext: sc})
+		}
+	}
+}
+
+// hasTraceContext reports whether headers already carry a trace context.
+func hasTraceContext(headers map[string]string) bool {
+	return trace.SpanContextFromContext(instrument.ExtractHeaders(context.Background(), headers)).IsValid()
+}
@@ -0,0 +1,434 @@
+package streaming
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
+)
+
+// ProducerConfig configures a Producer.
+type ProducerConfig struct {
+	// MaxBatchRecords is the maximum number of records sent in one request.
+	// Kinesis accepts up to 500.
+	MaxBatchRecords int `env:"STREAMING_PRODUCER_MAX_BATCH_RECORDS" env-default:"500"`
+
+	// MaxBatchBytes is the maximum size of one request, counting partition
+	// keys and data. Kinesis accepts up to 5 MiB.
+	MaxBatchBytes int `env:"STREAMING_PRODUCER_MAX_BATCH_BYTES" env-default:"5242880"`
+
+	// Linger is how long a record may wait in the buffer for a batch to fill.
+	Linger time.Duration `env:"STREAMING_PRODUCER_LINGER" env-default:"100ms"`
+
+	// Aggregate packs small records with the same partition key into one
+	// stream record in the Kinesis Producer Library format. Consumers must
+	// expand them with DeaggregateRecords (KCL does this automatically).
+	Aggregate bool `env:"STREAMING_PRODUCER_AGGREGATE" env-default:"false"`
+
+	// MaxAggregateBytes caps the size of one aggregated record.
+	MaxAggregateBytes int `env:"STREAMING_PRODUCER_MAX_AGGREGATE_BYTES" env-default:"51200"`
+
+	// MaxRetries is how often a failed record is resent before its Result
+	// reports the error. A negative value disables retries.
+	MaxRetries int `env:"STREAMING_PRODUCER_MAX_RETRIES" env-default:"3"`
+
+	// RetryBackoff is the delay before the first retry; it doubles with
+	// every further attempt.
+	RetryBackoff time.Duration `env:"STREAMING_PRODUCER_RETRY_BACKOFF" env-default:"100ms"`
+
+	// MaxInFlight is the number of requests sent concurrently. Set it to 1
+	// to keep records with the same partition key in order.
+	MaxInFlight int `env:"STREAMING_PRODUCER_MAX_IN_FLIGHT" env-default:"4"`
+
+	// MaxBufferedRecords bounds the records that are buffered or in flight.
+	// Put blocks while the limit is reached.
+	MaxBufferedRecords int `env:"STREAMING_PRODUCER_MAX_BUFFERED_RECORDS" env-default:"100000"`
+}
+
+// Result is the delivery outcome of a record written through a Producer.
+type Result struct {
+	done chan struct{}
+	err  error
+}
+
+// Done is closed once the record was written or finally failed.
+func (r *Result) Done() <-chan struct{} {
+	return r.done
+}
+
+// Err returns the delivery error. It is only meaningful after Done is closed.
+func (r *Result) Err() error {
+	return r.err
+}
+
+// Wait blocks until the record was delivered or ctx is done.
+func (r *Result) Wait(ctx context.Context) error {
+	select {
+	case <-r.done:
+		return r.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Producer buffers records and writes them in batches, trading a little
+// latency (at most Linger) for far fewer requests. Records are flushed when a
+// stream's buffer reaches MaxBatchRecords or MaxBatchBytes, after Linger, on
+// Flush and on Close. Records that fail are retried with exponential backoff;
+// each Put returns a Result that reports the final outcome.
+//
+// If the wrapped Client implements BatchClient a whole batch is one request;
+// otherwise records are written one by one from the background senders.
+// Producer itself implements Client, so it can be used wherever a Client is.
+type Producer struct {
+	client Client
+	batch  BatchClient
+	cfg    ProducerConfig
+
+	slots chan struct{}  // one per buffered or in-flight record
+	wg    sync.WaitGroup // senders
+
+	mu          sync.Mutex
+	ready       *sync.Cond // signalled when queue grows or the producer closes
+	streams     map[string]*streamBuffer
+	queue       []sendBatch // flushed batches waiting for a sender
+	outstanding int
+	idle        chan struct{} // closed while outstanding is 0
+	closed      bool
+}
+
+type streamBuffer struct {
+	items []*pendingEntry          // entries ready to send
+	open  map[string]*pendingEntry // aggregates still accepting records, by partition key
+	bytes int
+	timer *time.Timer
+}
+
+// pendingEntry is one stream record: a single user record, or an aggregate of
+// several with the same partition key.
+type pendingEntry struct {
+	parts   []Entry
+	results []*Result
+	size    int // encoded size of an aggregate
+}
+
+type sendBatch struct {
+	stream string
+	items  []*pendingEntry
+}
+
+// NewProducer creates a Producer writing through client. Zero config values
+// get defaults.
+func NewProducer(client Client, cfg ProducerConfig) *Producer {
+	if cfg.MaxBatchRecords <= 0 {
+		cfg.MaxBatchRecords = 500
+	}
+	if cfg.MaxBatchBytes <= 0 {
+		cfg.MaxBatchBytes = 5 << 20
+	}
+	if cfg.Linger <= 0 {
+		cfg.Linger = 100 * time.Millisecond
+	}
+	if cfg.MaxAggregateBytes <= 0 {
+		cfg.MaxAggregateBytes = 50 << 10
+	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = 3
+	} else if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = 100 * time.Millisecond
+	}
+	if cfg.MaxInFlight <= 0 {
+		cfg.MaxInFlight = 4
+	}
+	if cfg.MaxBufferedRecords <= 0 {
+		cfg.MaxBufferedRecords = 100000
+	}
+
+	p := &Producer{
+		client:  client,
+		cfg:     cfg,
+		slots:   make(chan struct{}, cfg.MaxBufferedRecords),
+		streams: make(map[string]*streamBuffer),
+		idle:    make(chan struct{}),
+	}
+	close(p.idle)
+	p.ready = sync.NewCond(&p.mu)
+	p.batch, _ = client.(BatchClient)
+
+	for i := 0; i < cfg.MaxInFlight; i++ {
+		p.wg.Add(1)
+		go p.sender()
+	}
+	return p
+}
+
+// Put buffers a record and returns its Result without waiting for delivery.
+// It blocks only while MaxBufferedRecords records are outstanding.
+func (p *Producer) Put(ctx context.Context, streamName, partitionKey string, data []byte) (*Result, error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		<-p.slots
+		return nil, ErrProducerClosed
+	}
+
+	r := &Result{done: make(chan struct{})}
+	// The caller's trace context travels with the record; it is lost when
+	// the record is aggregated, as aggregates have a single set of headers.
+	e := Entry{PartitionKey: partitionKey, Data: append([]byte(nil), data...), Headers: instrument.InjectHeaders(ctx, nil)}
+	if p.outstanding == 0 {
+		p.idle = make(chan struct{})
+	}
+	p.outstanding++
+
+	b := p.streams[streamName]
+	if b == nil {
+		b = &streamBuffer{open: make(map[string]*pendingEntry)}
+		p.streams[streamName] = b
+	}
+	p.add(streamName, b, e, r)
+
+	if len(b.items)+len(b.open) >= p.cfg.MaxBatchRecords || b.bytes >= p.cfg.MaxBatchBytes {
+		p.flushLocked(streamName)
+	} else if b.timer == nil {
+		b.timer = time.AfterFunc(p.cfg.Linger, func() { p.flushStream(streamName) })
+	}
+	return r, nil
+}
+
+// PutRecord buffers a record and waits for it to be delivered.
+func (p *Producer) PutRecord(ctx context.Context, streamName, partitionKey string, data []byte) error {
+	r, err := p.Put(ctx, streamName, partitionKey, data)
+	if err != nil {
+		return err
+	}
+	return r.Wait(ctx)
+}
+
+// Flush sends all buffered records and waits until every record put so far
+// has been delivered or has failed.
+func (p *Producer) Flush(ctx context.Context) error {
+	p.mu.Lock()
+	for name := range p.streams {
+		p.flushLocked(name)
+	}
+	idle := p.idle
+	p.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close flushes all buffered records, waits for them to be delivered and
+// closes the underlying client.
+func (p *Producer) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	for name := range p.streams {
+		p.flushLocked(name)
+	}
+	p.closed = true
+	p.ready.Broadcast()
+	p.mu.Unlock()
+
+	p.wg.Wait()
+	return p.client.Close()
+}
+
+// add appends a record to a stream buffer. With aggregation the record joins
+// the open aggregate for its partition key, which is sealed first if the
+// record would not fit. The caller holds p.mu.
+func (p *Producer) add(streamName string, b *streamBuffer, e Entry, r *Result) {
+	if !p.cfg.Aggregate {
+		size := len(e.PartitionKey) + len(e.Data)
+		p.reserve(streamName, b, size)
+		b.items = append(b.items, &pendingEntry{parts: []Entry{e}, results: []*Result{r}})
+		b.bytes += size
+		return
+	}
+
+	agg := b.open[e.PartitionKey]
+	if agg != nil && aggregatedSize(agg.size, e) > p.cfg.MaxAggregateBytes {
+		b.items = append(b.items, agg)
+		delete(b.open, e.PartitionKey)
+		agg = nil
+	}
+	if agg == nil {
+		p.reserve(streamName, b, len(e.PartitionKey)+aggregatedSize(0, e))
+		agg = &pendingEntry{}
+		b.open[e.PartitionKey] = agg
+		b.bytes += len(e.PartitionKey)
+	}
+	size := aggregatedSize(agg.size, e)
+	b.bytes += size - agg.size
+	agg.size = size
+	agg.parts = append(agg.parts, e)
+	agg.results = append(agg.results, r)
+}
+
+// reserve flushes a non-empty buffer that cannot take size more bytes.
+func (p *Producer) reserve(streamName string, b *streamBuffer, size int) {
+	if len(b.items)+len(b.open) > 0 && b.bytes+size > p.cfg.MaxBatchBytes {
+		p.flushLocked(streamName)
+	}
+}
+
+func (p *Producer) flushStream(streamName string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.closed {
+		p.flushLocked(streamName)
+	}
+}
+
+// flushLocked hands a stream's buffered records to the senders. The caller
+// holds p.mu.
+func (p *Producer) flushLocked(streamName string) {
+	b := p.streams[streamName]
+	if b == nil {
+		return
+	}
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	items := b.items
+	for _, agg := range b.open {
+		items = append(items, agg)
+	}
+	if len(items) == 0 {
+		return
+	}
+	b.items, b.open, b.bytes = nil, make(map[string]*pendingEntry), 0
+	p.queue = append(p.queue, sendBatch{stream: streamName, items: items})
+	p.ready.Signal()
+}
+
+func (p *Producer) sender() {
+	defer p.wg.Done()
+	for {
+		p.mu.Lock()
+		for len(p.queue) == 0 && !p.closed {
+			p.ready.Wait()
+		}
+		if len(p.queue) == 0 {
+			p.mu.Unlock()
+			return
+		}
+		b := p.queue[0]
+		p.queue = p.queue[1:]
+		p.mu.Unlock()
+
+		p.send(b)
+	}
+}
+
+// send writes a batch, retrying the entries that failed.
+func (p *Producer) send(b sendBatch) {
+	ctx := context.Background()
+	items := b.items
+	backoff := p.cfg.RetryBackoff
+
+	for attempt := 0; ; attempt++ {
+		errs := p.write(ctx, b.stream, items)
+
+		var failed []*pendingEntry
+		var lastErr error
+		for i, it := range items {
+			if errs[i] == nil {
+				p.complete(it, nil)
+				continue
+			}
+			if attempt >= p.cfg.MaxRetries {
+				p.complete(it, errs[i])
+				continue
+			}
+			failed = append(failed, it)
+			lastErr = errs[i]
+		}
+		if len(failed) == 0 {
+			return
+		}
+
+		logger.L().WarnContext(ctx, "retrying failed stream records", "stream", b.stream, "count", len(failed), "attempt", attempt+1, "error", lastErr)
+		time.Sleep(backoff)
+		backoff *= 2
+		items = failed
+	}
+}
+
+// write sends items and returns one error per item.
+func (p *Producer) write(ctx context.Context, streamName string, items []*pendingEntry) []error {
+	entries := make([]Entry, len(items))
+	for i, it := range items {
+		entries[i] = it.entry()
+	}
+
+	if p.batch != nil {
+		errs, err := p.batch.PutRecords(ctx, streamName, entries)
+		if err == nil && len(errs) == len(entries) {
+			return errs
+		}
+		if err == nil {
+			// Results cannot be matched to entries, so none is known to
+			// have been written.
+			err = errors.Internal("batch result count mismatch", nil)
+		}
+		errs = make([]error, len(entries))
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+
+	errs := make([]error, len(entries))
+	for i, e := range entries {
+		errs[i] = p.client.PutRecord(ctx, streamName, e.PartitionKey, e.Data)
+	}
+	return errs
+}
+
+func (p *Producer) complete(it *pendingEntry, err error) {
+	for _, r := range it.results {
+		r.err = err
+		close(r.done)
+		<-p.slots
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.outstanding -= len(it.results)
+	if p.outstanding == 0 {
+		close(p.idle)
+	}
+}
+
+// entry returns the stream record to send for it.
+func (it *pendingEntry) entry() Entry {
+	if len(it.parts) == 1 {
+		return it.parts[0]
+	}
+	return Entry{PartitionKey: it.parts[0].PartitionKey, Data: Aggregate(it.parts)}
+}
+
+var _ Client = (*Producer)(nil)
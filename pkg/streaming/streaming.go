@@ -1,6 +1,9 @@
 package streaming
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // Config holds configuration for streaming clients.
 type Config struct {
@@ -12,6 +15,10 @@ type Config struct {
 
 	// BufferSize for batching (optional).
 	BufferSize int `env:"STREAMING_BUFFER_SIZE" env-default:"100"`
+
+	// ShardCount is the number of shards per stream (memory backend only;
+	// cloud backends report their own shard layout).
+	ShardCount int `env:"STREAMING_SHARD_COUNT" env-default:"1"`
 }
 
 // Client abstracts real-time data streaming services.
@@ -22,3 +29,139 @@ type Client interface {
 	// Close closes the client and flushes any buffers.
 	Close() error
 }
+
+// Entry is a record to be written with PutRecords.
+type Entry struct {
+	PartitionKey string
+	Data         []byte
+
+	// Headers are optional key-value pairs carried with the record, such as
+	// the trace context. They are sent as event properties (Event Hubs) or
+	// message attributes (Pub/Sub); Kinesis records have no attributes, so
+	// the Kinesis adapter drops them.
+	Headers map[string]string
+}
+
+// BatchClient is implemented by clients that can write many records in one
+// request. Producer uses it when available.
+type BatchClient interface {
+	Client
+
+	// PutRecords writes entries to a stream. On success the returned slice
+	// has one element per entry, nil for entries that were written and the
+	// cause for those that failed; a non-nil error means the whole request
+	// failed.
+	PutRecords(ctx context.Context, streamName string, entries []Entry) ([]error, error)
+}
+
+// Record is a data record read from a shard.
+type Record struct {
+	// Stream is the stream (or topic / event hub) the record was read from.
+	Stream string
+
+	// ShardID identifies the shard or partition holding the record.
+	ShardID string
+
+	// SequenceNumber orders records within a shard. It is opaque to callers
+	// but can be passed back in a Position to resume reading.
+	SequenceNumber string
+
+	// PartitionKey is the key the record was written with.
+	PartitionKey string
+
+	// Data is the record payload.
+	Data []byte
+
+	// Timestamp is when the backend accepted the record.
+	Timestamp time.Time
+
+	// Headers are the headers the record was written with, if the backend
+	// carries them.
+	Headers map[string]string
+}
+
+// Shard describes a shard (Kinesis) or partition (Event Hubs) of a stream.
+type Shard struct {
+	// ID identifies the shard within the stream.
+	ID string
+
+	// ParentID is the shard this one was split or merged from, if any.
+	ParentID string
+}
+
+// PositionType selects where reading starts within a shard.
+type PositionType int
+
+const (
+	// PositionOldest starts at the oldest retained record.
+	PositionOldest PositionType = iota
+	// PositionLatest starts just after the newest record, so only records
+	// written from now on are returned.
+	PositionLatest
+	// PositionAtSequence starts at the record with SequenceNumber.
+	PositionAtSequence
+	// PositionAfterSequence starts just after the record with SequenceNumber.
+	PositionAfterSequence
+	// PositionAtTimestamp starts at the first record written at or after Timestamp.
+	PositionAtTimestamp
+)
+
+// Position is a starting point for ReadRecords. The zero value reads from the
+// oldest retained record.
+type Position struct {
+	Type           PositionType
+	SequenceNumber string
+	Timestamp      time.Time
+
+	// Token is an adapter-specific continuation token (such as a Kinesis
+	// shard iterator) set on positions returned by ReadRecords. Adapters fall
+	// back to the other fields if it is empty or has expired.
+	Token string
+}
+
+// Oldest returns a Position at the oldest retained record.
+func Oldest() Position { return Position{Type: PositionOldest} }
+
+// Latest returns a Position after the newest record.
+func Latest() Position { return Position{Type: PositionLatest} }
+
+// AtSequence returns a Position at the given sequence number.
+func AtSequence(seq string) Position {
+	return Position{Type: PositionAtSequence, SequenceNumber: seq}
+}
+
+// AfterSequence returns a Position just after the given sequence number.
+func AfterSequence(seq string) Position {
+	return Position{Type: PositionAfterSequence, SequenceNumber: seq}
+}
+
+// AtTimestamp returns a Position at the first record written at or after t.
+func AtTimestamp(t time.Time) Position {
+	return Position{Type: PositionAtTimestamp, Timestamp: t}
+}
+
+// ReadOutput is the result of a ReadRecords call.
+type ReadOutput struct {
+	// Records are in shard order.
+	Records []Record
+
+	// Next is the position to pass to the following ReadRecords call.
+	Next Position
+
+	// ShardClosed is set once a closed shard (for example the parent of a
+	// resharding) has been read to the end; no more records will arrive.
+	ShardClosed bool
+}
+
+// Consumer reads records from the shards of a stream.
+type Consumer interface {
+	// ListShards returns the shards of a stream.
+	ListShards(ctx context.Context, streamName string) ([]Shard, error)
+
+	// ReadRecords returns up to limit records from a shard starting at from.
+	// It returns an empty batch, not an error, when no records are available.
+	ReadRecords(ctx context.Context, streamName, shardID string, from Position, limit int) (*ReadOutput, error)
+
+	// Close releases the consumer's resources.
+	Close() error
+}
@@ -0,0 +1,238 @@
+package streaming_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	distlockmemory "github.com/chris-alexander-pop/system-design-library/pkg/concurrency/distlock/adapters/memory"
+	kvmemory "github.com/chris-alexander-pop/system-design-library/pkg/database/kv/adapters/memory"
+	"github.com/chris-alexander-pop/system-design-library/pkg/streaming"
+	"github.com/chris-alexander-pop/system-design-library/pkg/streaming/adapters/memory"
+)
+
+type collector struct {
+	mu   sync.Mutex
+	seen map[string]int
+}
+
+func (c *collector) handle(ctx context.Context, records []streaming.Record) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, r := range records {
+		c.seen[string(r.Data)]++
+	}
+	return nil
+}
+
+func (c *collector) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.seen)
+}
+
+func TestConsumerGroupSharesShards(t *testing.T) {
+	ctx := context.Background()
+	client := memory.New(streaming.Config{ShardCount: 4})
+	for i := 0; i < 100; i++ {
+		if err := client.PutRecord(ctx, "orders", fmt.Sprintf("key-%d", i), []byte(fmt.Sprintf("msg-%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checkpoints := streaming.NewKVCheckpointStore(kvmemory.New(), "")
+	locker := distlockmemory.New()
+	cfg := streaming.GroupConfig{
+		Group:        "billing",
+		Stream:       "orders",
+		BatchSize:    10,
+		PollInterval: 5 * time.Millisecond,
+		LeaseTTL:     30 * time.Millisecond,
+		MaxShards:    2,
+	}
+
+	c := &collector{seen: make(map[string]int)}
+	g1 := streaming.NewConsumerGroup(client, checkpoints, locker, cfg, c.handle)
+	g2 := streaming.NewConsumerGroup(client, checkpoints, locker, cfg, c.handle)
+
+	runCtx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	for _, g := range []*streaming.ConsumerGroup{g1, g2} {
+		wg.Add(1)
+		go func(g *streaming.ConsumerGroup) {
+			defer wg.Done()
+			g.Run(runCtx)
+		}(g)
+	}
+
+	waitFor(t, func() bool { return c.count() == 100 })
+	if n1, n2 := len(g1.Shards()), len(g2.Shards()); n1 != 2 || n2 != 2 {
+		t.Errorf("expected shards split 2/2, got %d/%d", n1, n2)
+	}
+
+	// Stopping one instance hands its shards to the other, which resumes
+	// from the checkpoints instead of re-reading everything.
+	cancel()
+	wg.Wait()
+
+	for i := 100; i < 120; i++ {
+		client.PutRecord(ctx, "orders", fmt.Sprintf("key-%d", i), []byte(fmt.Sprintf("msg-%d", i)))
+	}
+	cfg.MaxShards = 0
+	g3 := streaming.NewConsumerGroup(client, checkpoints, locker, cfg, c.handle)
+	runCtx, cancel = context.WithCancel(ctx)
+	defer cancel()
+	go g3.Run(runCtx)
+
+	waitFor(t, func() bool { return c.count() == 120 })
+	waitFor(t, func() bool { return len(g3.Shards()) == 4 })
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for msg, n := range c.seen {
+		if n != 1 {
+			t.Errorf("%s delivered %d times", msg, n)
+		}
+	}
+}
+
+func TestConsumerGroupRetriesFailedBatch(t *testing.T) {
+	ctx := context.Background()
+	client := memory.New(streaming.Config{})
+	client.PutRecord(ctx, "orders", "k", []byte("a"))
+
+	var (
+		mu    sync.Mutex
+		calls int
+	)
+	handler := func(ctx context.Context, records []streaming.Record) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 1 {
+			return fmt.Errorf("transient")
+		}
+		return nil
+	}
+
+	checkpoints := streaming.NewKVCheckpointStore(kvmemory.New(), "")
+	g := streaming.NewConsumerGroup(client, checkpoints, distlockmemory.New(), streaming.GroupConfig{
+		Stream:       "orders",
+		PollInterval: 5 * time.Millisecond,
+		LeaseTTL:     30 * time.Millisecond,
+	}, handler)
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go g.Run(runCtx)
+
+	waitFor(t, func() bool {
+		seq, _ := checkpoints.GetCheckpoint(ctx, "default", "orders", "shard-000000")
+		return seq != ""
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	if calls < 2 {
+		t.Errorf("expected the failed batch to be retried, handler called %d times", calls)
+	}
+}
+
+// reshardedConsumer serves a closed parent shard and its child.
+type reshardedConsumer struct {
+	records map[string][]streaming.Record
+}
+
+func (c *reshardedConsumer) ListShards(ctx context.Context, streamName string) ([]streaming.Shard, error) {
+	return []streaming.Shard{{ID: "child", ParentID: "parent"}, {ID: "parent"}}, nil
+}
+
+func (c *reshardedConsumer) ReadRecords(ctx context.Context, streamName, shardID string, from streaming.Position, limit int) (*streaming.ReadOutput, error) {
+	recs := c.records[shardID]
+	start := 0
+	if from.Type == streaming.PositionAfterSequence {
+		for i, r := range recs {
+			if r.SequenceNumber == from.SequenceNumber {
+				start = i + 1
+			}
+		}
+	}
+	end := min(start+limit, len(recs))
+	out := &streaming.ReadOutput{Records: recs[start:end], Next: from}
+	if end > start {
+		out.Next = streaming.AfterSequence(recs[end-1].SequenceNumber)
+	}
+	out.ShardClosed = shardID == "parent" && end == len(recs)
+	return out, nil
+}
+
+func (c *reshardedConsumer) Close() error { return nil }
+
+func TestConsumerGroupReadsParentShardFirst(t *testing.T) {
+	ctx := context.Background()
+	consumer := &reshardedConsumer{records: map[string][]streaming.Record{}}
+	for _, shard := range []string{"parent", "child"} {
+		for i := 0; i < 3; i++ {
+			consumer.records[shard] = append(consumer.records[shard], streaming.Record{
+				ShardID:        shard,
+				SequenceNumber: fmt.Sprint(i),
+				Data:           []byte(fmt.Sprintf("%s-%d", shard, i)),
+			})
+		}
+	}
+
+	var (
+		mu    sync.Mutex
+		order []string
+	)
+	handler := func(ctx context.Context, records []streaming.Record) error {
+		if records[0].ShardID == "parent" {
+			time.Sleep(20 * time.Millisecond)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, r := range records {
+			order = append(order, string(r.Data))
+		}
+		return nil
+	}
+
+	checkpoints := streaming.NewKVCheckpointStore(kvmemory.New(), "")
+	g := streaming.NewConsumerGroup(consumer, checkpoints, distlockmemory.New(), streaming.GroupConfig{
+		Stream:       "orders",
+		BatchSize:    1,
+		PollInterval: 5 * time.Millisecond,
+		LeaseTTL:     30 * time.Millisecond,
+	}, handler)
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go g.Run(runCtx)
+
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(order) == 6
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"parent-0", "parent-1", "parent-2", "child-0", "child-1", "child-2"}
+	if fmt.Sprint(order) != fmt.Sprint(want) {
+		t.Errorf("expected %v, got %v", want, order)
+	}
+	if seq, _ := checkpoints.GetCheckpoint(ctx, "default", "orders", "parent"); seq != streaming.ShardEnd {
+		t.Errorf("expected the parent to be checkpointed at its end, got %q", seq)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,246 @@
+package streaming_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/streaming"
+	"github.com/chris-alexander-pop/system-design-library/pkg/streaming/adapters/memory"
+)
+
+// flakyClient wraps the memory client, counts requests and rejects every
+// entry whose data is listed in failOnce the first time it is sent.
+type flakyClient struct {
+	*memory.Client
+
+	mu       sync.Mutex
+	requests int
+	failOnce map[string]bool
+}
+
+func (c *flakyClient) PutRecords(ctx context.Context, streamName string, entries []streaming.Entry) ([]error, error) {
+	c.mu.Lock()
+	c.requests++
+	errs := make([]error, len(entries))
+	var ok []streaming.Entry
+	for i, e := range entries {
+		if c.failOnce[string(e.Data)] {
+			delete(c.failOnce, string(e.Data))
+			errs[i] = errors.New("ProvisionedThroughputExceededException")
+			continue
+		}
+		ok = append(ok, e)
+	}
+	c.mu.Unlock()
+
+	if _, err := c.Client.PutRecords(ctx, streamName, ok); err != nil {
+		return nil, err
+	}
+	return errs, nil
+}
+
+func TestProducerBatchesAndFlushesOnClose(t *testing.T) {
+	ctx := context.Background()
+	client := &flakyClient{Client: memory.New(streaming.Config{})}
+	p := streaming.NewProducer(client, streaming.ProducerConfig{
+		MaxBatchRecords: 100,
+		Linger:          time.Hour,
+		MaxInFlight:     1,
+	})
+
+	var results []*streaming.Result
+	for i := 0; i < 1000; i++ {
+		r, err := p.Put(ctx, "events", fmt.Sprintf("key-%d", i%7), []byte(fmt.Sprintf("msg-%d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, r)
+	}
+	for i := 1000; i < 1050; i++ {
+		p.Put(ctx, "events", "key", []byte(fmt.Sprintf("msg-%d", i)))
+	}
+
+	// The last 50 records stay buffered until Close flushes them.
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if err := r.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(client.GetRecords()); n != 1050 {
+		t.Errorf("expected 1050 records, got %d", n)
+	}
+	if client.requests != 11 {
+		t.Errorf("expected 11 requests, got %d", client.requests)
+	}
+	if _, err := p.Put(ctx, "events", "key", nil); !errors.Is(err, streaming.ErrProducerClosed) {
+		t.Errorf("expected ErrProducerClosed, got %v", err)
+	}
+}
+
+func TestProducerLingerAndRetry(t *testing.T) {
+	ctx := context.Background()
+	client := &flakyClient{
+		Client:   memory.New(streaming.Config{}),
+		failOnce: map[string]bool{"b": true, "d": true},
+	}
+	p := streaming.NewProducer(client, streaming.ProducerConfig{
+		Linger:       10 * time.Millisecond,
+		RetryBackoff: time.Millisecond,
+	})
+	defer p.Close()
+
+	// No threshold is reached; the linger timer sends the batch and the
+	// rejected records are retried.
+	var results []*streaming.Result
+	for _, d := range []string{"a", "b", "c", "d"} {
+		r, err := p.Put(ctx, "events", d, []byte(d))
+		if err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, r)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	for _, r := range results {
+		if err := r.Wait(waitCtx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(client.GetRecords()); n != 4 {
+		t.Errorf("expected 4 records, got %d", n)
+	}
+}
+
+func TestProducerReportsFinalFailure(t *testing.T) {
+	ctx := context.Background()
+	client := &flakyClient{
+		Client:   memory.New(streaming.Config{}),
+		failOnce: map[string]bool{"bad": true},
+	}
+	p := streaming.NewProducer(client, streaming.ProducerConfig{MaxRetries: -1})
+	defer p.Close()
+
+	good, _ := p.Put(ctx, "events", "k", []byte("good"))
+	bad, _ := p.Put(ctx, "events", "k", []byte("bad"))
+	if err := p.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if good.Err() != nil {
+		t.Errorf("unexpected error: %v", good.Err())
+	}
+	if bad.Err() == nil {
+		t.Error("expected the rejected record to fail")
+	}
+}
+
+// shortClient writes the entries but returns too few results.
+type shortClient struct {
+	*memory.Client
+}
+
+func (c *shortClient) PutRecords(ctx context.Context, streamName string, entries []streaming.Entry) ([]error, error) {
+	errs, err := c.Client.PutRecords(ctx, streamName, entries)
+	if err != nil {
+		return nil, err
+	}
+	return errs[:len(errs)-1], nil
+}
+
+func TestProducerFailsOnResultCountMismatch(t *testing.T) {
+	ctx := context.Background()
+	client := &shortClient{Client: memory.New(streaming.Config{})}
+	p := streaming.NewProducer(client, streaming.ProducerConfig{MaxRetries: -1})
+	defer p.Close()
+
+	a, _ := p.Put(ctx, "events", "a", []byte("a"))
+	b, _ := p.Put(ctx, "events", "b", []byte("b"))
+	if err := p.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if a.Err() == nil || b.Err() == nil {
+		t.Errorf("expected every record to fail, got %v and %v", a.Err(), b.Err())
+	}
+}
+
+func TestProducerAggregates(t *testing.T) {
+	ctx := context.Background()
+	client := memory.New(streaming.Config{})
+	p := streaming.NewProducer(client, streaming.ProducerConfig{
+		Aggregate:         true,
+		MaxAggregateBytes: 1024,
+		Linger:            time.Hour,
+	})
+
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("user-%d", i%2)
+		if _, err := p.Put(ctx, "events", key, []byte(fmt.Sprintf("%s/%03d", key, i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := client.GetRecords()
+	if len(stored) >= 200 || len(stored) < 4 {
+		t.Fatalf("expected records to be aggregated into a few stream records, got %d", len(stored))
+	}
+
+	out, err := client.ReadRecords(ctx, "events", "shard-000000", streaming.Oldest(), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := streaming.DeaggregateRecords(out.Records)
+	if len(records) != 200 {
+		t.Fatalf("expected 200 records after deaggregation, got %d", len(records))
+	}
+
+	// Records with the same partition key keep their order.
+	last := map[string]string{}
+	for _, r := range records {
+		if string(r.Data) <= last[r.PartitionKey] {
+			t.Fatalf("record %s out of order after %s", r.Data, last[r.PartitionKey])
+		}
+		last[r.PartitionKey] = string(r.Data)
+	}
+}
+
+func TestAggregateRoundTrip(t *testing.T) {
+	entries := []streaming.Entry{
+		{PartitionKey: "a", Data: []byte("one")},
+		{PartitionKey: "b", Data: []byte("two")},
+		{PartitionKey: "a", Data: nil},
+	}
+	data := streaming.Aggregate(entries)
+	if !streaming.IsAggregated(data) {
+		t.Fatal("expected aggregated payload")
+	}
+
+	got, err := streaming.Deaggregate(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(entries) {
+		t.Fatalf("expected %d entries, got %d", len(entries), len(got))
+	}
+	for i := range entries {
+		if got[i].PartitionKey != entries[i].PartitionKey || string(got[i].Data) != string(entries[i].Data) {
+			t.Errorf("entry %d: got %+v, want %+v", i, got[i], entries[i])
+		}
+	}
+
+	// A corrupted payload no longer matches its digest and is treated as
+	// plain data.
+	data[len(data)/2] ^= 0xFF
+	if streaming.IsAggregated(data) {
+		t.Error("expected corrupted payload to be rejected")
+	}
+}
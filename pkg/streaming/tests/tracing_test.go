@@ -0,0 +1,61 @@
+package streaming_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/streaming"
+	"github.com/chris-alexander-pop/system-design-library/pkg/streaming/adapters/memory"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestInstrumentedClientPropagatesTraceContext(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+		_ = tp.Shutdown(context.Background())
+	})
+
+	mem := memory.New(streaming.Config{})
+	client := streaming.NewInstrumentedClient(mem)
+	consumer := streaming.NewInstrumentedConsumer(mem)
+	ctx := context.Background()
+
+	reqCtx, request := tp.Tracer("test").Start(ctx, "http.request")
+	if err := client.PutRecord(reqCtx, "orders", "user-1", []byte("a")); err != nil {
+		t.Fatalf("PutRecord failed: %v", err)
+	}
+	request.End()
+
+	out, err := consumer.ReadRecords(ctx, "orders", "shard-000000", streaming.Oldest(), 10)
+	if err != nil {
+		t.Fatalf("ReadRecords failed: %v", err)
+	}
+	if len(out.Records) != 1 {
+		t.Fatalf("got %d records, want 1", len(out.Records))
+	}
+
+	recCtx := instrument.ExtractHeaders(ctx, out.Records[0].Headers)
+	if trace.SpanContextFromContext(recCtx).TraceID() != request.SpanContext().TraceID() {
+		t.Errorf("record headers %v do not carry the request trace", out.Records[0].Headers)
+	}
+
+	for _, s := range recorder.Ended() {
+		if s.Name() != "streaming.ReadRecords" {
+			continue
+		}
+		if links := s.Links(); len(links) != 1 || links[0].SpanContext.TraceID() != request.SpanContext().TraceID() {
+			t.Errorf("read span links = %v, want a link to the request trace", links)
+		}
+		return
+	}
+	t.Fatal("no ReadRecords span recorded")
+}
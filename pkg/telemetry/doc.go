@@ -1,9 +1,16 @@
 /*
-Package telemetry provides OpenTelemetry tracing initialization.
+Package telemetry provides OpenTelemetry tracing and metrics initialization.
 
-This package sets up the OpenTelemetry tracer provider with OTLP export.
+This package sets up the OpenTelemetry tracer and meter providers with OTLP
+export, and optionally a Prometheus endpoint for pull-based scraping.
 Traces are automatically correlated with logs via pkg/logger.
 
+Every Instrumented* wrapper in the library records RED metrics (operation
+counts, error counts and latency histograms) through package instrument, so
+they are exported as soon as Init has run. Some wrappers add domain metrics:
+cache.hit_ratio, messaging.consumer.lag, streaming.consumer.lag and
+resilience.circuit_breaker.state.
+
 Usage:
 
 	import "github.com/chris-alexander-pop/system-design-library/pkg/telemetry"
@@ -11,6 +18,8 @@ Usage:
 	shutdown, err := telemetry.Init(telemetry.Config{
 		ServiceName: "my-service",
 		Endpoint:    "localhost:4317",
+		// Optional: serve metrics on :9464/metrics for Prometheus.
+		PrometheusAddr: ":9464",
 	})
 	if err != nil {
 		log.Fatal(err)
@@ -0,0 +1,132 @@
+// Package instrument provides the tracing and RED metrics shared by the
+// Instrumented* wrappers.
+//
+// NewTracer returns a trace.Tracer whose spans also record, when they end:
+//
+//   - <prefix>.operations: a counter of operations by operation and outcome
+//   - <prefix>.errors: a counter of failed operations by operation
+//   - <prefix>.duration: a histogram of operation latency in seconds
+//
+// The prefix is the instrumentation scope without its leading "pkg/", with
+// slashes replaced by dots ("pkg/database/sql" records database.sql.*), and
+// the operation is the span name. A span counts as failed when an error is
+// recorded on it or its status is set to codes.Error, which is what every
+// wrapper already does on failure.
+//
+// Instruments are created on the global meter provider, so they report
+// through whatever telemetry.Init installs, even when the wrapper was created
+// first.
+//
+// InjectHeaders and ExtractHeaders carry the trace context across message
+// brokers in message headers, so a trace continues from a producer into the
+// consumers of its messages.
+package instrument
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// AttrOperation is the operation attribute of every RED metric.
+	AttrOperation = "operation"
+
+	// AttrOutcome is "ok" or "error".
+	AttrOutcome = "outcome"
+)
+
+// Tracer is a trace.Tracer that records RED metrics for the spans it starts.
+type Tracer struct {
+	trace.Tracer
+
+	operations metric.Int64Counter
+	errors     metric.Int64Counter
+	duration   metric.Float64Histogram
+}
+
+// NewTracer returns a Tracer for the instrumentation scope.
+func NewTracer(scope string) *Tracer {
+	meter := otel.Meter(scope)
+	prefix := MetricPrefix(scope)
+
+	// Instrument creation only fails for invalid names, which the prefix
+	// rules out; the returned no-op instruments keep the tracer usable.
+	operations, _ := meter.Int64Counter(prefix+".operations",
+		metric.WithDescription("Number of operations"),
+		metric.WithUnit("{operation}"))
+	errs, _ := meter.Int64Counter(prefix+".errors",
+		metric.WithDescription("Number of failed operations"),
+		metric.WithUnit("{error}"))
+	duration, _ := meter.Float64Histogram(prefix+".duration",
+		metric.WithDescription("Duration of operations"),
+		metric.WithUnit("s"))
+
+	return &Tracer{
+		Tracer:     otel.Tracer(scope),
+		operations: operations,
+		errors:     errs,
+		duration:   duration,
+	}
+}
+
+// Start starts a span like the wrapped tracer and measures it until End.
+func (t *Tracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	ctx, span := t.Tracer.Start(ctx, name, opts...)
+	s := &measuredSpan{Span: span, tracer: t, name: name, start: time.Now()}
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+// MetricPrefix returns the metric name prefix of an instrumentation scope.
+func MetricPrefix(scope string) string {
+	return strings.ReplaceAll(strings.TrimPrefix(scope, "pkg/"), "/", ".")
+}
+
+type measuredSpan struct {
+	trace.Span
+
+	tracer *Tracer
+	name   string
+	start  time.Time
+	failed atomic.Bool
+	ended  atomic.Bool
+}
+
+func (s *measuredSpan) RecordError(err error, opts ...trace.EventOption) {
+	if err != nil {
+		s.failed.Store(true)
+	}
+	s.Span.RecordError(err, opts...)
+}
+
+func (s *measuredSpan) SetStatus(code codes.Code, description string) {
+	s.failed.Store(code == codes.Error)
+	s.Span.SetStatus(code, description)
+}
+
+func (s *measuredSpan) End(opts ...trace.SpanEndOption) {
+	s.Span.End(opts...)
+	if s.ended.Swap(true) {
+		return
+	}
+
+	ctx := trace.ContextWithSpanContext(context.Background(), s.SpanContext())
+	outcome := "ok"
+	if s.failed.Load() {
+		outcome = "error"
+		s.tracer.errors.Add(ctx, 1, metric.WithAttributes(attribute.String(AttrOperation, s.name)))
+	}
+	attrs := metric.WithAttributes(
+		attribute.String(AttrOperation, s.name),
+		attribute.String(AttrOutcome, outcome),
+	)
+	s.tracer.operations.Add(ctx, 1, attrs)
+	s.tracer.duration.Record(ctx, time.Since(s.start).Seconds(), attrs)
+}
@@ -0,0 +1,79 @@
+package instrument
+
+import (
+	"context"
+	"maps"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InjectHeaders returns headers with the span context and baggage of ctx
+// added in the configured propagation format (W3C traceparent, tracestate
+// and baggage once telemetry.Init has run). headers itself is not modified;
+// it is returned unchanged when there is nothing to propagate.
+func InjectHeaders(ctx context.Context, headers map[string]string) map[string]string {
+	carrier := make(headerCarrier)
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return headers
+	}
+
+	out := make(map[string]string, len(headers)+len(carrier))
+	maps.Copy(out, headers)
+	maps.Copy(out, carrier)
+	return out
+}
+
+// ExtractHeaders returns ctx with the span context and baggage propagated in
+// headers. Without propagated fields ctx is returned unchanged.
+func ExtractHeaders(ctx context.Context, headers map[string]string) context.Context {
+	if len(headers) == 0 {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, headerCarrier(headers))
+}
+
+// StartConsumerSpan starts a consumer span for a message that carried
+// headers. The span is a child of the producer's span propagated in headers
+// and links to the span ctx already carried, such as the span of a consume
+// loop, so that both traces lead to it.
+func StartConsumerSpan(ctx context.Context, tracer trace.Tracer, name string, headers map[string]string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	local := trace.SpanContextFromContext(ctx)
+	ctx = ExtractHeaders(ctx, headers)
+	if remote := trace.SpanContextFromContext(ctx); local.IsValid() && !remote.Equal(local) {
+		opts = append(opts, trace.WithLinks(trace.Link{SpanContext: local}))
+	}
+	opts = append(opts, trace.WithSpanKind(trace.SpanKindConsumer))
+	return tracer.Start(ctx, name, opts...)
+}
+
+// headerCarrier adapts message headers to propagation.TextMapCarrier. Keys
+// are looked up case-insensitively as a fallback, since some brokers
+// canonicalize header names in transit.
+type headerCarrier map[string]string
+
+func (c headerCarrier) Get(key string) string {
+	if v, ok := c[key]; ok {
+		return v
+	}
+	for k, v := range c {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+func (c headerCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
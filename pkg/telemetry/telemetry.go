@@ -2,11 +2,21 @@ package telemetry
 
 import (
 	"context"
+	stderrors "errors"
+	"net"
+	"net/http"
+	"time"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/chris-alexander-pop/system-design-library/pkg/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	otelprometheus "go.opentelemetry.io/otel/exporters/prometheus"
 	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
@@ -25,9 +35,20 @@ type Config struct {
 
 	// Endpoint is the OTLP collector endpoint.
 	Endpoint string `env:"OTEL_EXPORTER_OTLP_ENDPOINT" env-default:"localhost:4317"`
+
+	// MetricsInterval is how often metrics are pushed to the OTLP collector.
+	MetricsInterval time.Duration `env:"OTEL_METRICS_INTERVAL" env-default:"30s"`
+
+	// PrometheusAddr, when set, serves metrics for Prometheus to scrape on
+	// this address (e.g. ":9464"), in addition to pushing them over OTLP.
+	PrometheusAddr string `env:"OTEL_PROMETHEUS_ADDR"`
+
+	// PrometheusPath is the HTTP path of the Prometheus endpoint.
+	PrometheusPath string `env:"OTEL_PROMETHEUS_PATH" env-default:"/metrics"`
 }
 
-// Init initializes the OpenTelemetry tracer provider and returns a shutdown function
+// Init initializes the OpenTelemetry tracer and meter providers and returns a
+// shutdown function that flushes and stops both.
 func Init(cfg Config) (func(context.Context) error, error) {
 	ctx := context.Background()
 
@@ -65,5 +86,69 @@ func Init(cfg Config) (func(context.Context) error, error) {
 		propagation.Baggage{},
 	))
 
-	return tp.Shutdown, nil
+	mp, stopPrometheus, err := newMeterProvider(ctx, cfg, res)
+	if err != nil {
+		_ = tp.Shutdown(ctx)
+		return nil, err
+	}
+	otel.SetMeterProvider(mp)
+
+	return func(ctx context.Context) error {
+		return stderrors.Join(stopPrometheus(ctx), mp.Shutdown(ctx), tp.Shutdown(ctx))
+	}, nil
+}
+
+// newMeterProvider creates a meter provider that pushes to the OTLP collector
+// and, if configured, serves a Prometheus endpoint. The returned function
+// stops the endpoint.
+func newMeterProvider(ctx context.Context, cfg Config, res *resource.Resource) (*sdkmetric.MeterProvider, func(context.Context) error, error) {
+	if cfg.MetricsInterval <= 0 {
+		cfg.MetricsInterval = 30 * time.Second
+	}
+	if cfg.PrometheusPath == "" {
+		cfg.PrometheusPath = "/metrics"
+	}
+
+	// The Prometheus endpoint is set up first, so that nothing needs to be
+	// shut down when it fails.
+	var opts []sdkmetric.Option
+	stop := func(context.Context) error { return nil }
+	if cfg.PrometheusAddr != "" {
+		registry := prometheus.NewRegistry()
+		reader, err := otelprometheus.New(otelprometheus.WithRegisterer(registry))
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to create prometheus exporter")
+		}
+		opts = append(opts, sdkmetric.WithReader(reader))
+
+		// Listen before returning so that a taken address fails Init.
+		ln, err := net.Listen("tcp", cfg.PrometheusAddr)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to listen for prometheus scrapes")
+		}
+		mux := http.NewServeMux()
+		mux.Handle(cfg.PrometheusPath, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+		srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+		go func() {
+			if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+				logger.L().Error("prometheus endpoint stopped", "addr", cfg.PrometheusAddr, "error", err)
+			}
+		}()
+		stop = srv.Shutdown
+	}
+
+	exporter, err := otlpmetricgrpc.New(ctx,
+		otlpmetricgrpc.WithEndpoint(cfg.Endpoint),
+		otlpmetricgrpc.WithInsecure(),
+	)
+	if err != nil {
+		_ = stop(ctx)
+		return nil, nil, errors.Wrap(err, "failed to create metric exporter")
+	}
+	opts = append(opts,
+		sdkmetric.WithResource(res),
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(cfg.MetricsInterval))),
+	)
+
+	return sdkmetric.NewMeterProvider(opts...), stop, nil
 }
@@ -0,0 +1,214 @@
+package telemetry_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/chris-alexander-pop/system-design-library/pkg/cache"
+	"github.com/chris-alexander-pop/system-design-library/pkg/cache/adapters/memory"
+	"github.com/chris-alexander-pop/system-design-library/pkg/errors"
+	"github.com/chris-alexander-pop/system-design-library/pkg/resilience"
+	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry/instrument"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// reader collects from the package's meter provider. The global provider
+// only delegates to the first one installed and instrumented packages bind
+// their instruments once, so all tests share it and assert on deltas.
+var reader = sdkmetric.NewManualReader()
+
+func TestMain(m *testing.M) {
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	otel.SetMeterProvider(mp)
+	code := m.Run()
+	_ = mp.Shutdown(context.Background())
+	os.Exit(code)
+}
+
+func collect(t *testing.T) map[string]metricdata.Metrics {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	metrics := make(map[string]metricdata.Metrics)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m
+		}
+	}
+	return metrics
+}
+
+func counterValue(t *testing.T, metrics map[string]metricdata.Metrics, name string, attrs ...attribute.KeyValue) int64 {
+	t.Helper()
+	m, ok := metrics[name]
+	if !ok {
+		return 0
+	}
+	want := attribute.NewSet(attrs...)
+	var total int64
+	for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+		if len(attrs) == 0 || dp.Attributes.Equals(&want) {
+			total += dp.Value
+		}
+	}
+	return total
+}
+
+func histogramCount(metrics map[string]metricdata.Metrics, name string) uint64 {
+	m, ok := metrics[name]
+	if !ok {
+		return 0
+	}
+	var count uint64
+	for _, dp := range m.Data.(metricdata.Histogram[float64]).DataPoints {
+		count += dp.Count
+	}
+	return count
+}
+
+func TestTracerRecordsREDMetrics(t *testing.T) {
+	tracer := instrument.NewTracer("pkg/database/sql")
+	ctx := context.Background()
+
+	op := attribute.String(instrument.AttrOperation, "sql.Query")
+	ok := attribute.String(instrument.AttrOutcome, "ok")
+	failed := attribute.String(instrument.AttrOutcome, "error")
+	before := collect(t)
+
+	for i := 0; i < 3; i++ {
+		_, span := tracer.Start(ctx, "sql.Query")
+		span.End()
+	}
+	_, span := tracer.Start(ctx, "sql.Query")
+	span.RecordError(errors.Internal("boom", nil))
+	span.SetStatus(codes.Error, "boom")
+	span.End()
+	span.End() // ending twice must not count twice
+
+	metrics := collect(t)
+
+	delta := func(name string, attrs ...attribute.KeyValue) int64 {
+		return counterValue(t, metrics, name, attrs...) - counterValue(t, before, name, attrs...)
+	}
+	if got := delta("database.sql.operations", op, ok); got != 3 {
+		t.Errorf("ok operations = %d, want 3", got)
+	}
+	if got := delta("database.sql.operations", op, failed); got != 1 {
+		t.Errorf("failed operations = %d, want 1", got)
+	}
+	if got := delta("database.sql.errors", op); got != 1 {
+		t.Errorf("errors = %d, want 1", got)
+	}
+	if _, recorded := metrics["database.sql.duration"]; !recorded {
+		t.Fatal("duration histogram not recorded")
+	}
+	if got := histogramCount(metrics, "database.sql.duration") - histogramCount(before, "database.sql.duration"); got != 4 {
+		t.Errorf("duration count = %d, want 4", got)
+	}
+}
+
+func TestInstrumentedCacheRecordsHitsAndMisses(t *testing.T) {
+	sessions := cache.NewInstrumentedCache(memory.New(), "sessions")
+	defer sessions.Close()
+	pages := cache.NewInstrumentedCache(memory.New(), "pages")
+	defer pages.Close()
+	ctx := context.Background()
+	named := func(name string) attribute.KeyValue { return attribute.String("name", name) }
+
+	before := collect(t)
+	hits := counterValue(t, before, "cache.hits", named("sessions"))
+	misses := counterValue(t, before, "cache.misses", named("sessions"))
+	pageMisses := counterValue(t, before, "cache.misses", named("pages"))
+
+	if err := sessions.Set(ctx, "k", "v", time.Minute); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	var v string
+	for i := 0; i < 3; i++ {
+		if err := sessions.Get(ctx, "k", &v); err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+	}
+	if err := sessions.Get(ctx, "missing", &v); err == nil {
+		t.Fatal("expected a miss")
+	}
+	if err := pages.Get(ctx, "missing", &v); err == nil {
+		t.Fatal("expected a miss")
+	}
+
+	metrics := collect(t)
+	if got := counterValue(t, metrics, "cache.hits", named("sessions")) - hits; got != 3 {
+		t.Errorf("hits = %d, want 3", got)
+	}
+	if got := counterValue(t, metrics, "cache.misses", named("sessions")) - misses; got != 1 {
+		t.Errorf("misses = %d, want 1", got)
+	}
+	if got := counterValue(t, metrics, "cache.misses", named("pages")) - pageMisses; got != 1 {
+		t.Errorf("page misses = %d, want 1", got)
+	}
+
+	// A miss is not a failed operation.
+	get := attribute.String(instrument.AttrOperation, "cache.Get")
+	failed := attribute.String(instrument.AttrOutcome, "error")
+	if got := counterValue(t, metrics, "cache.operations", get, failed) - counterValue(t, before, "cache.operations", get, failed); got != 0 {
+		t.Errorf("failed gets = %d, want 0", got)
+	}
+
+	ratio, ok := metrics["cache.hit_ratio"]
+	if !ok {
+		t.Fatal("hit ratio not observed")
+	}
+	ratios := map[string]float64{}
+	for _, dp := range ratio.Data.(metricdata.Gauge[float64]).DataPoints {
+		name, _ := dp.Attributes.Value("name")
+		ratios[name.AsString()] = dp.Value
+	}
+	if ratios["sessions"] != 0.75 || ratios["pages"] != 0 {
+		t.Errorf("hit ratios = %v, want sessions 0.75 and pages 0", ratios)
+	}
+}
+
+func TestCircuitBreakerStateGauge(t *testing.T) {
+	// Breakers from earlier runs may still be live, so the name is unique.
+	name := fmt.Sprintf("gauge-test-%d", time.Now().UnixNano())
+	cb := resilience.NewCircuitBreaker(resilience.CircuitBreakerConfig{
+		Name:             name,
+		FailureThreshold: 1,
+		Timeout:          time.Hour,
+	})
+
+	state := func() int64 {
+		t.Helper()
+		m, ok := collect(t)["resilience.circuit_breaker.state"]
+		if !ok {
+			t.Fatal("circuit breaker state not observed")
+		}
+		name := attribute.NewSet(attribute.String("name", name))
+		for _, dp := range m.Data.(metricdata.Gauge[int64]).DataPoints {
+			if dp.Attributes.Equals(&name) {
+				return dp.Value
+			}
+		}
+		t.Fatal("no data point for the breaker")
+		return -1
+	}
+
+	if got := state(); got != 0 {
+		t.Errorf("closed state = %d, want 0", got)
+	}
+	_ = cb.Execute(context.Background(), func(context.Context) error {
+		return errors.Internal("boom", nil)
+	})
+	if got := state(); got != 2 {
+		t.Errorf("open state = %d, want 2", got)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/chris-alexander-pop/system-design-library/pkg/telemetry"
+	"go.opentelemetry.io/otel"
 )
 
 func TestInit(t *testing.T) {
@@ -12,6 +13,11 @@ func TestInit(t *testing.T) {
 	// otlptracegrpc might attempt connection.
 	// Let's rely on standard timeouts if it blocks.
 
+	// Init installs global providers; restore the ones the instrumentation
+	// tests collect from.
+	prev := otel.GetMeterProvider()
+	defer otel.SetMeterProvider(prev)
+
 	done := make(chan bool)
 	go func() {
 		shutdown, err := telemetry.Init(telemetry.Config{